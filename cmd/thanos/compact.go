@@ -265,6 +265,40 @@ func runCompact(
 			"msg", "vertical compaction is enabled", "compact.enable-vertical-compaction", fmt.Sprintf("%v", conf.enableVerticalCompaction),
 		)
 	}
+	archiveConfContentYaml, err := conf.archiveObjStore.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of archive object store configuration")
+	}
+	var (
+		archive                         *archiveTier
+		archiveBkt                      objstore.InstrumentedBucket
+		archiveIgnoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter
+	)
+	if len(archiveConfContentYaml) > 0 {
+		b, err := client.NewBucket(logger, archiveConfContentYaml, component.String())
+		if err != nil {
+			return errors.Wrap(err, "create archive bucket client")
+		}
+		archiveBkt = objstoretracing.WrapWithTraces(objstore.WrapWithMetrics(b, extprom.WrapRegistererWithPrefix("thanos_archive_", reg), b.Name()))
+		defer func() {
+			if rerr != nil {
+				runutil.CloseWithLogOnErr(logger, archiveBkt, "archive bucket client")
+			}
+		}()
+
+		archiveIgnoreDeletionMarkFilter = block.NewIgnoreDeletionMarkFilter(logger, archiveBkt, deleteDelay/2, conf.blockMetaFetchConcurrency)
+		archiveFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, archiveBkt, block.NewConcurrentLister(logger, archiveBkt), "", extprom.WrapRegistererWithPrefix("thanos_archive_", reg),
+			[]block.MetadataFilter{timePartitionMetaFilter, labelShardedMetaFilter, archiveIgnoreDeletionMarkFilter})
+		if err != nil {
+			return errors.Wrap(err, "create archive meta fetcher")
+		}
+		archive = &archiveTier{bkt: archiveBkt, fetcher: archiveFetcher, resolution: downsample.ResLevel2}
+		if conf.archiveResolution == "5m" {
+			archive.resolution = downsample.ResLevel1
+		}
+		level.Info(logger).Log("msg", "downsampled blocks are written to the archive bucket", "resolution", conf.archiveResolution)
+	}
+
 	var (
 		api = blocksAPI.NewBlocksAPI(logger, conf.webConf.disableCORS, conf.label, flagsMap, insBkt)
 		sy  *compact.Syncer
@@ -384,12 +418,33 @@ func runCompact(
 		planner = largeIndexFilterPlanner
 	}
 	blocksCleaner := compact.NewBlocksCleaner(logger, insBkt, ignoreDeletionMarkFilter, deleteDelay, compactMetrics.blocksCleaned, compactMetrics.blockCleanupFailures)
-	compactor, err := compact.NewBucketCompactor(
+	var archiveBlocksCleaner *compact.BlocksCleaner
+	if archive != nil {
+		archiveBlocksCleaner = compact.NewBlocksCleaner(logger, archiveBkt, archiveIgnoreDeletionMarkFilter, deleteDelay, compactMetrics.blocksCleaned, compactMetrics.blockCleanupFailures)
+	}
+
+	var bucketIndexUpdater *block.BucketIndexUpdater
+	if conf.bucketIndexUpdateInterval > 0 {
+		bucketIndexUpdater = block.NewBucketIndexUpdater(logger, insBkt, baseMetaFetcher, conf.blockMetaFetchConcurrency, reg)
+	}
+	var compactionLifecycleCallback compact.CompactionLifecycleCallback = compact.DefaultCompactionLifecycleCallback{}
+	if conf.parallelPopulate {
+		if conf.parallelPopulateConcurrency <= 0 {
+			return errors.New("--compact.parallel-populate.concurrency must be positive")
+		}
+		compactionLifecycleCallback = compact.NewParallelPopulatorCallback(compactionLifecycleCallback, compact.ParallelBlockPopulator{
+			Concurrency:  conf.parallelPopulateConcurrency,
+			MemoryBudget: int64(conf.parallelPopulateMemoryBudget),
+		})
+	}
+	compactor, err := compact.NewBucketCompactorWithCheckerAndCallback(
 		logger,
 		sy,
 		grouper,
 		planner,
 		comp,
+		compact.DefaultBlockDeletableChecker{},
+		compactionLifecycleCallback,
 		compactDir,
 		insBkt,
 		conf.compactionConcurrency,
@@ -398,6 +453,8 @@ func runCompact(
 	if err != nil {
 		return errors.Wrap(err, "create bucket compactor")
 	}
+	backlog := compact.NewCompactionBacklog(conf.compactionConcurrency)
+	compactor.WithBacklog(backlog)
 
 	retentionByResolution := map[compact.ResolutionLevel]time.Duration{
 		compact.ResolutionLevelRaw: time.Duration(conf.retentionRaw),
@@ -423,6 +480,24 @@ func runCompact(
 		level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
 	}
 
+	retentionPoliciesYaml, err := conf.retentionPolicies.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of retention policies")
+	}
+	var retentionPolicies []compact.RetentionPolicy
+	if len(retentionPoliciesYaml) > 0 {
+		if retentionPolicies, err = compact.ParseRetentionPolicies(retentionPoliciesYaml); err != nil {
+			return errors.Wrap(err, "parse retention policies")
+		}
+	}
+	for _, p := range retentionPolicies {
+		// Policies apply to the blocks of all resolutions, raw ones included.
+		if r := time.Duration(p.Retention); r != 0 && !conf.disableDownsampling && r.Milliseconds() < downsample.ResLevel1DownsampleRange {
+			return errors.Errorf("retention of the policy %s must be higher than the minimum block size after which 5m resolution downsampling will occur (40 hours)", p.Selector)
+		}
+		level.Info(logger).Log("msg", "retention policy of matching blocks is enabled", "selector", p.Selector, "duration", time.Duration(p.Retention))
+	}
+
 	var cleanMtx sync.Mutex
 	// TODO(GiedriusS): we could also apply retention policies here but the logic would be a bit more complex.
 	cleanPartialMarked := func() error {
@@ -437,6 +512,16 @@ func runCompact(
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "cleaning marked blocks")
 		}
+		if archive != nil {
+			_, partial, err := archive.fetcher.Fetch(ctx)
+			if err != nil {
+				return errors.Wrap(err, "syncing metas of archive bucket")
+			}
+			compact.BestEffortCleanAbortedPartialUploads(ctx, logger, partial, archiveBkt, compactMetrics.partialUploadDeleteAttempts, compactMetrics.blocksCleaned, compactMetrics.blockCleanupFailures)
+			if err := archiveBlocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
+				return errors.Wrap(err, "cleaning marked blocks of archive bucket")
+			}
+		}
 		compactMetrics.cleanups.Inc()
 
 		return nil
@@ -473,6 +558,7 @@ func runCompact(
 				logger,
 				downsampleMetrics,
 				insBkt,
+				archive,
 				filteredMetas,
 				downsamplingDir,
 				conf.downsampleConcurrency,
@@ -493,6 +579,7 @@ func runCompact(
 				logger,
 				downsampleMetrics,
 				insBkt,
+				archive,
 				filteredMetas,
 				downsamplingDir,
 				conf.downsampleConcurrency,
@@ -513,15 +600,37 @@ func runCompact(
 			return errors.Wrap(err, "sync before retention")
 		}
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, insBkt, sy.Metas(), retentionByResolution, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")); err != nil {
+		if _, err := compact.ApplyRetentionPolicies(ctx, logger, insBkt, sy.Metas(), retentionPolicies, retentionByResolution, conf.retentionDryRun, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")); err != nil {
 			return errors.Wrap(err, "retention failed")
 		}
+		if archive != nil {
+			archiveMetas, _, err := archive.fetcher.Fetch(ctx)
+			if err != nil {
+				return errors.Wrap(err, "sync archive bucket before retention")
+			}
+			if _, err := compact.ApplyRetentionPolicies(ctx, logger, archiveBkt, archiveMetas, retentionPolicies, retentionByResolution, conf.retentionDryRun, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")); err != nil {
+				return errors.Wrap(err, "retention of archive bucket failed")
+			}
+		}
+
+		if err := cleanPartialMarked(); err != nil {
+			return err
+		}
 
-		return cleanPartialMarked()
+		// Stores fall back to iterating the bucket if the bucket index is not updated, so don't fail the iteration.
+		if bucketIndexUpdater != nil {
+			if err := bucketIndexUpdater.Update(ctx); err != nil {
+				level.Error(logger).Log("msg", "failed to update bucket index", "err", err)
+			}
+		}
+		return nil
 	}
 
 	g.Add(func() error {
 		defer runutil.CloseWithLogOnErr(logger, insBkt, "bucket client")
+		if archiveBkt != nil {
+			defer runutil.CloseWithLogOnErr(logger, archiveBkt, "archive bucket client")
+		}
 
 		if !conf.wait {
 			return compactMainFn()
@@ -570,6 +679,7 @@ func runCompact(
 
 			global := ui.NewBucketUI(logger, conf.webConf.externalPrefix, conf.webConf.prefixHeaderName, component)
 			global.Register(r, ins)
+			ui.NewCompactionUI(logger, conf.webConf.externalPrefix, conf.webConf.prefixHeaderName, backlog.Status).Register(r, ins)
 
 			// Configure Request Logging for HTTP calls.
 			opts := []logging.Option{logging.WithDecider(func(_ string, _ error) logging.Decision {
@@ -577,6 +687,7 @@ func runCompact(
 			})}
 			logMiddleware := logging.NewHTTPServerMiddleware(logger, opts...)
 			api.Register(r.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
+			api.SetCompactionBacklog(backlog.Status)
 
 			// Separate fetcher for global view.
 			// TODO(bwplotka): Allow Bucket UI to visualize the state of the block as well.
@@ -629,11 +740,25 @@ func runCompact(
 			})
 		}
 
+		// Periodically update the bucket index, since one iteration potentially could take a long time.
+		if bucketIndexUpdater != nil {
+			g.Add(func() error {
+				return runutil.Repeat(conf.bucketIndexUpdateInterval, ctx.Done(), func() error {
+					if err := bucketIndexUpdater.Update(ctx); err != nil {
+						level.Error(logger).Log("msg", "failed to update bucket index", "err", err)
+					}
+					return nil
+				})
+			}, func(error) {
+				cancel()
+			})
+		}
+
 		// Periodically calculate the progress of compaction, downsampling and retention.
 		if conf.progressCalculateInterval > 0 {
 			g.Add(func() error {
-				ps := compact.NewCompactionProgressCalculator(reg, tsdbPlanner)
-				rs := compact.NewRetentionProgressCalculator(reg, retentionByResolution)
+				ps := compact.NewCompactionProgressCalculator(reg, tsdbPlanner).WithBacklog(backlog)
+				rs := compact.NewRetentionProgressCalculator(reg, retentionByResolution).WithRetentionPolicies(retentionPolicies)
 				var ds *compact.DownsampleProgressCalculator
 				if !conf.disableDownsampling {
 					ds = compact.NewDownsampleProgressCalculator(reg)
@@ -703,8 +828,12 @@ type compactConfig struct {
 	http                                           httpConfig
 	dataDir                                        string
 	objStore                                       extflag.PathOrContent
+	archiveObjStore                                extflag.PathOrContent
+	archiveResolution                              string
 	consistencyDelay                               time.Duration
 	retentionRaw, retentionFiveMin, retentionOneHr model.Duration
+	retentionPolicies                              extflag.PathOrContent
+	retentionDryRun                                bool
 	wait                                           bool
 	waitInterval                                   time.Duration
 	disableDownsampling                            bool
@@ -714,7 +843,11 @@ type compactConfig struct {
 	blockViewerSyncBlockInterval                   time.Duration
 	blockViewerSyncBlockTimeout                    time.Duration
 	cleanupBlocksInterval                          time.Duration
+	bucketIndexUpdateInterval                      time.Duration
 	compactionConcurrency                          int
+	parallelPopulate                               bool
+	parallelPopulateConcurrency                    int
+	parallelPopulateMemoryBudget                   units.Base2Bytes
 	downsampleConcurrency                          int
 	compactBlocksFetchConcurrency                  int
 	deleteDelay                                    model.Duration
@@ -748,6 +881,7 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("./data").StringVar(&cc.dataDir)
 
 	cc.objStore = *extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
+	cc.archiveObjStore = *extkingpin.RegisterCommonObjStoreFlags(cmd, "-archive", false, "Downsampled blocks of at least --downsample.archive-resolution are written to it instead of the main bucket, retention is applied to them and they are not compacted further. Store gateways must be configured to also load blocks from it.")
 
 	cmd.Flag("consistency-delay", fmt.Sprintf("Minimum age of fresh (non-compacted) blocks before they are being processed. Malformed blocks older than the maximum of consistency-delay and %v will be removed.", compact.PartialUploadThresholdAge)).
 		Default("30m").DurationVar(&cc.consistencyDelay)
@@ -759,6 +893,9 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("0d").SetValue(&cc.retentionFiveMin)
 	cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").
 		Default("0d").SetValue(&cc.retentionOneHr)
+	cc.retentionPolicies = *extflag.RegisterPathOrContent(cmd, "retention.policies-config", "YAML file that contains the retention policies of the blocks whose external labels match their selectors, overriding the retention of their resolution. See format details: https://thanos.io/tip/components/compact.md/#retention-policies", extflag.WithEnvSubstitution())
+	cmd.Flag("retention.dry-run", "Only log the blocks exceeding their retention, instead of marking them for deletion.").
+		Default("false").BoolVar(&cc.retentionDryRun)
 
 	// TODO(kakkoyun, pgough): https://github.com/thanos-io/thanos/issues/2266.
 	cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
@@ -783,15 +920,25 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("5m").DurationVar(&cc.blockViewerSyncBlockTimeout)
 	cmd.Flag("compact.cleanup-interval", "How often we should clean up partially uploaded blocks and blocks with deletion mark in the background when --wait has been enabled. Setting it to \"0s\" disables it - the cleaning will only happen at the end of an iteration.").
 		Default("5m").DurationVar(&cc.cleanupBlocksInterval)
+	cmd.Flag("bucket-index.update-interval", "How often the bucket index, listing all blocks with their meta and deletion marks in a single file read by stores instead of iterating the bucket, is updated when --wait has been enabled. It is also updated at the end of every iteration. Only a single compactor per bucket should update it. Setting it to \"0s\" disables updating the bucket index.").
+		Default("0s").DurationVar(&cc.bucketIndexUpdateInterval)
 	cmd.Flag("compact.progress-interval", "Frequency of calculating the compaction progress in the background when --wait has been enabled. Setting it to \"0s\" disables it. Now compaction, downsampling and retention progress are supported.").
 		Default("5m").DurationVar(&cc.progressCalculateInterval)
 
 	cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
 		Default("1").IntVar(&cc.compactionConcurrency)
+	cmd.Flag("compact.parallel-populate", "Experimental: merge the symbol tables of the compacted blocks, merge their series, write chunks and add series to the index of the new block in concurrent goroutines, instead of a single one. Reduces the duration of the compaction of large blocks, using more CPU. The new blocks are the same.").
+		Default("false").BoolVar(&cc.parallelPopulate)
+	cmd.Flag("compact.parallel-populate.concurrency", "Number of goroutines merging series and reading their chunks in every compaction, when --compact.parallel-populate is enabled.").
+		Default("1").IntVar(&cc.parallelPopulateConcurrency)
+	cmd.Flag("compact.parallel-populate.memory-budget", "Maximum size of the merged series waiting to be written in every compaction, when --compact.parallel-populate is enabled. Bounds the memory used by the goroutines merging series ahead of the ones writing them. Setting it to 0 disables the limit.").
+		Default("0").BytesVar(&cc.parallelPopulateMemoryBudget)
 	cmd.Flag("compact.blocks-fetch-concurrency", "Number of goroutines to use when download block during compaction.").
 		Default("1").IntVar(&cc.compactBlocksFetchConcurrency)
 	cmd.Flag("downsample.concurrency", "Number of goroutines to use when downsampling blocks.").
 		Default("1").IntVar(&cc.downsampleConcurrency)
+	cmd.Flag("downsample.archive-resolution", "Minimum resolution, 5m or 1h, of the downsampled blocks written to the archive bucket, if --objstore-archive.config is set.").
+		Default("1h").EnumVar(&cc.archiveResolution, "5m", "1h")
 
 	cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket. "+
 		"If delete-delay is non zero, blocks will be marked for deletion and compactor component will delete blocks marked for deletion from the bucket. "+
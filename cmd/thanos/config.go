@@ -31,6 +31,8 @@ type grpcConfig struct {
 	tlsSrvClientCA   string
 	gracePeriod      time.Duration
 	maxConnectionAge time.Duration
+	reflection       bool
+	healthService    bool
 }
 
 func (gc *grpcConfig) registerFlag(cmd extkingpin.FlagClause) *grpcConfig {
@@ -51,6 +53,12 @@ func (gc *grpcConfig) registerFlag(cmd extkingpin.FlagClause) *grpcConfig {
 	cmd.Flag("grpc-grace-period",
 		"Time to wait after an interrupt received for GRPC Server.").
 		Default("2m").DurationVar(&gc.gracePeriod)
+	cmd.Flag("grpc-server-reflection",
+		"Enable the gRPC server reflection service, to discover the served services with clients like grpcurl. Use --no-grpc-server-reflection to disable it.").
+		Default("true").BoolVar(&gc.reflection)
+	cmd.Flag("grpc-server-health-service",
+		"Enable the standard gRPC health checking service, reporting the readiness of the component and of each served service, e.g. thanos.Store. Use --no-grpc-server-health-service to disable it.").
+		Default("true").BoolVar(&gc.healthService)
 
 	return gc
 }
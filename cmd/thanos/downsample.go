@@ -134,7 +134,7 @@ func RunDownsample(
 					metrics.downsamples.WithLabelValues(resolutionLabel)
 					metrics.downsampleFailures.WithLabelValues(resolutionLabel)
 				}
-				if err := downsampleBucket(ctx, logger, metrics, insBkt, metas, dataDir, downsampleConcurrency, blockFilesConcurrency, hashFunc, false); err != nil {
+				if err := downsampleBucket(ctx, logger, metrics, insBkt, nil, metas, dataDir, downsampleConcurrency, blockFilesConcurrency, hashFunc, false); err != nil {
 					return errors.Wrap(err, "downsampling failed")
 				}
 
@@ -143,7 +143,7 @@ func RunDownsample(
 				if err != nil {
 					return errors.Wrap(err, "sync before second pass of downsampling")
 				}
-				if err := downsampleBucket(ctx, logger, metrics, insBkt, metas, dataDir, downsampleConcurrency, blockFilesConcurrency, hashFunc, false); err != nil {
+				if err := downsampleBucket(ctx, logger, metrics, insBkt, nil, metas, dataDir, downsampleConcurrency, blockFilesConcurrency, hashFunc, false); err != nil {
 					return errors.Wrap(err, "downsampling failed")
 				}
 				return nil
@@ -174,11 +174,26 @@ func RunDownsample(
 	return nil
 }
 
+// archiveTier is an alternate bucket the downsampled blocks of high resolutions are written to, e.g. a cheaper
+// storage class for long term retention.
+type archiveTier struct {
+	bkt     objstore.Bucket
+	fetcher block.MetadataFetcher
+	// resolution is the minimum resolution of the downsampled blocks written to the archive bucket.
+	resolution int64
+}
+
+// stores returns true if the blocks of the given resolution are written to the archive bucket.
+func (a *archiveTier) stores(resolution int64) bool {
+	return a != nil && resolution >= a.resolution
+}
+
 func downsampleBucket(
 	ctx context.Context,
 	logger log.Logger,
 	metrics *DownsampleMetrics,
 	bkt objstore.Bucket,
+	archive *archiveTier,
 	metas map[ulid.ULID]*metadata.Meta,
 	dir string,
 	downsampleConcurrency int,
@@ -201,6 +216,26 @@ func downsampleBucket(
 		}
 	}()
 
+	// Blocks already downsampled to the archive bucket must not be downsampled again, and archived blocks of
+	// lower resolutions than 1h are downsampled from it.
+	archived := map[ulid.ULID]struct{}{}
+	if archive != nil {
+		archiveMetas, _, err := archive.fetcher.Fetch(ctx)
+		if err != nil {
+			return compact.NewRetryError(errors.Wrap(err, "fetch metas of archive bucket"))
+		}
+		merged := make(map[ulid.ULID]*metadata.Meta, len(metas)+len(archiveMetas))
+		for id, m := range archiveMetas {
+			merged[id] = m
+			archived[id] = struct{}{}
+		}
+		for id, m := range metas {
+			merged[id] = m
+			delete(archived, id)
+		}
+		metas = merged
+	}
+
 	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
 	// if a downsampled version with the same hash already exists.
 	sources5m := map[ulid.ULID]struct{}{}
@@ -262,7 +297,14 @@ func downsampleBucket(
 					resolution = downsample.ResLevel2
 					errMsg = "downsampling to 60 min"
 				}
-				if err := processDownsampling(workerCtx, logger, bkt, m, dir, resolution, hashFunc, metrics, acceptMalformedIndex, blockFilesConcurrency); err != nil {
+				src, dst := bkt, bkt
+				if _, ok := archived[m.ULID]; ok {
+					src = archive.bkt
+				}
+				if archive.stores(resolution) {
+					dst = archive.bkt
+				}
+				if err := processDownsampling(workerCtx, logger, src, dst, m, dir, resolution, hashFunc, metrics, acceptMalformedIndex, blockFilesConcurrency); err != nil {
 					metrics.downsampleFailures.WithLabelValues(m.Thanos.ResolutionString()).Inc()
 					errCh <- errors.Wrap(err, errMsg)
 
@@ -342,10 +384,12 @@ metaSendLoop:
 	return downsampleErrs.Err()
 }
 
+// processDownsampling downsamples the given block of the src bucket to the given resolution, and uploads the
+// downsampled block to the dst bucket.
 func processDownsampling(
 	ctx context.Context,
 	logger log.Logger,
-	bkt objstore.Bucket,
+	src, dst objstore.Bucket,
 	m *metadata.Meta,
 	dir string,
 	resolution int64,
@@ -357,7 +401,7 @@ func processDownsampling(
 	begin := time.Now()
 	bdir := filepath.Join(dir, m.ULID.String())
 
-	err := block.Download(ctx, logger, bkt, m.ULID, bdir, objstore.WithFetchConcurrency(blockFilesConcurrency))
+	err := block.Download(ctx, logger, src, m.ULID, bdir, objstore.WithFetchConcurrency(blockFilesConcurrency))
 	if err != nil {
 		return compact.NewRetryError(errors.Wrapf(err, "download block %s", m.ULID))
 	}
@@ -418,7 +462,7 @@ func processDownsampling(
 
 	begin = time.Now()
 
-	err = block.Upload(ctx, logger, bkt, resdir, hashFunc)
+	err = block.Upload(ctx, logger, dst, resdir, hashFunc)
 	if err != nil {
 		return compact.NewRetryError(errors.Wrapf(err, "upload downsampled block %s", id))
 	}
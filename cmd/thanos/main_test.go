@@ -164,7 +164,7 @@ func TestRegression4960_Deadlock(t *testing.T) {
 
 	metas, _, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
-	err = downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, 1, metadata.NoneFunc, false)
+	err = downsampleBucket(ctx, logger, metrics, bkt, nil, metas, dir, 1, 1, metadata.NoneFunc, false)
 	testutil.NotOk(t, err)
 
 	testutil.Assert(t, strings.Contains(err.Error(), "some random error has occurred"))
@@ -204,9 +204,59 @@ func TestCleanupDownsampleCacheFolder(t *testing.T) {
 
 	metas, _, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
-	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, 1, metadata.NoneFunc, false))
+	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, nil, metas, dir, 1, 1, metadata.NoneFunc, false))
 	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(meta.Thanos.ResolutionString())))
 
 	_, err = os.Stat(dir)
 	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
 }
+
+func TestDownsampleBucketArchive(t *testing.T) {
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	archiveBkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	id, err := e2eutil.CreateBlock(
+		ctx,
+		dir,
+		[]labels.Labels{{{Name: "a", Value: "1"}}},
+		100, 0, downsample.ResLevel2DownsampleRange+1, // Pass the minimum ResLevel2DownsampleRange check.
+		labels.Labels{{Name: "e1", Value: "1"}},
+		downsample.ResLevel0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, id.String()), metadata.NoneFunc))
+
+	metaFetcher, err := block.NewMetaFetcher(nil, block.FetcherConcurrency, bkt, block.NewConcurrentLister(logger, bkt), "", nil, nil)
+	testutil.Ok(t, err)
+	archiveFetcher, err := block.NewMetaFetcher(nil, block.FetcherConcurrency, archiveBkt, block.NewConcurrentLister(logger, archiveBkt), "", nil, nil)
+	testutil.Ok(t, err)
+	archive := &archiveTier{bkt: archiveBkt, fetcher: archiveFetcher, resolution: downsample.ResLevel1}
+
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	metrics := newDownsampleMetrics(prometheus.NewRegistry())
+	for i := 0; i < 3; i++ {
+		testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, archive, metas, t.TempDir(), 1, 1, metadata.NoneFunc, false))
+	}
+	// The raw block is downsampled to 5m, which is downsampled to 1h from the archive bucket, once.
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(metas[id].Thanos.ResolutionString())))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(fmt.Sprint(downsample.ResLevel1))))
+
+	metas, _, err = metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(metas))
+
+	archiveMetas, _, err := archiveFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	var resolutions []int64
+	for _, m := range archiveMetas {
+		testutil.Equals(t, []ulid.ULID{id}, m.Compaction.Sources)
+		resolutions = append(resolutions, m.Thanos.Downsample.Resolution)
+	}
+	testutil.Assert(t, len(resolutions) == 2, "expected 5m and 1h blocks in the archive bucket, got resolutions %v", resolutions)
+	testutil.Assert(t, resolutions[0] != resolutions[1], "expected 5m and 1h blocks in the archive bucket, got resolutions %v", resolutions)
+}
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
 	extflag "github.com/efficientgo/tools/extkingpin"
 	"google.golang.org/grpc"
 
@@ -22,6 +24,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	commonmodel "github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/file"
@@ -33,6 +36,7 @@ import (
 	apiv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/api/query/querypb"
 	"github.com/thanos-io/thanos/pkg/block"
+	thanoscache "github.com/thanos-io/thanos/pkg/cache"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
@@ -48,6 +52,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/info/infopb"
 	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/metadata"
+	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules"
@@ -129,6 +134,9 @@ func registerQuery(app *extkingpin.App) {
 
 	defaultMetadataTimeRange := cmd.Flag("query.metadata.default-time-range", "The default metadata time range duration for retrieving labels through Labels and Series API when the range parameters are not specified. The zero value means range covers the time since the beginning.").Default("0s").Duration()
 
+	metadataCacheTTL := cmd.Flag("query.metadata.cache-ttl", "Duration the responses of the Labels, Label Values and Series API are cached in memory for, by tenant and request parameters. Useful without a query frontend caching them. 0s disables the cache.").Default("0s").Duration()
+	metadataCacheMaxSize := cmd.Flag("query.metadata.cache-max-size", "Maximum size of the in-memory cache of the Labels, Label Values and Series API responses.").Default("64MB").Bytes()
+
 	selectorLabels := cmd.Flag("selector-label", "Query selector labels that will be exposed in info endpoint (repeated).").
 		PlaceHolder("<name>=\"<value>\"").Strings()
 
@@ -164,6 +172,8 @@ func registerQuery(app *extkingpin.App) {
 	strictEndpointGroups := extkingpin.Addrs(cmd.Flag("endpoint-group-strict", "Experimental: DNS name of statically configured Thanos API server groups (repeatable) that are always used, even if the health check fails.").
 		PlaceHolder("<endpoint-group-strict>"))
 
+	endpointConfig := extflag.RegisterPathOrContent(cmd, "endpoint.config", "YAML file with the configuration of endpoints, with their own TLS, authentication and compression settings overriding the gRPC client flags. The file is reloaded when it changes. For format details see: https://thanos.io/tip/components/query.md/#endpoint-configuration", extflag.WithEnvSubstitution())
+
 	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers. The path can be a glob pattern (repeatable).").
 		PlaceHolder("<path>").Strings()
 
@@ -181,15 +191,50 @@ func registerQuery(app *extkingpin.App) {
 
 	endpointInfoTimeout := extkingpin.ModelDuration(cmd.Flag("endpoint.info-timeout", "Timeout of gRPC Info requests.").Default("5s").Hidden())
 
+	endpointInfoStalenessGracePeriod := extkingpin.ModelDuration(cmd.Flag("endpoint.info-staleness-grace-period", "Time since the last successful Info call during which an endpoint failing its Info calls is still queried using its last known label sets and time range. Such endpoints have the stale field set in the /api/v1/stores API. 0 disables it, dropping endpoints from queries on the first failed Info call.").Default("0s"))
+
 	enableAutodownsampling := cmd.Flag("query.auto-downsampling", "Enable automatic adjustment (step / 5) to what source of data should be used in store gateways if no max_source_resolution param is specified.").
 		Default("false").Bool()
 
+	downsampleRetry := cmd.Flag("query.downsample-retry", "Experimental: if true, queries exceeding the samples limit of the engine or the chunks or samples limits of stores at a resolution finer than a downsampling level are retried at the next downsampling levels, returning the results with a warning instead of failing.").
+		Default("false").Bool()
+	tenantDownsampleRetryFlags := cmd.Flag("query.tenant-downsample-retry", "Experimental: enables or disables the retry of queries of a tenant exceeding samples limits at the next downsampling levels, overriding --query.downsample-retry, in the <tenant>=<bool> format. Can be repeated for multiple tenants.").PlaceHolder("<tenant>=<bool>").Strings()
+
+	accountingLabel := cmd.Flag("query.accounting.label", "Experimental: label of the selectors of queries telling the owner of the series they select, e.g. team, to account for the queries, their samples and their latency per owner in the thanos_query_accounting_* metrics. Selectors without an equality matcher on the label are accounted as unattributed. Empty disables it.").
+		Default("").String()
+	accountingMaxOwners := cmd.Flag("query.accounting.max-owners", "Experimental: maximum number of distinct owners accounted for with --query.accounting.label. The queries of the next owners are accounted as other, to bound the cardinality of the metrics.").
+		Default("100").Int()
+
+	maxSamples := cmd.Flag("query.max-samples", "Maximum number of samples a single query can load into memory. Queries loading more samples fail, or are retried at the next downsampling levels with --query.downsample-retry.").
+		Default(strconv.Itoa(math.MaxInt32)).Int()
+
+	stitchWindow := extkingpin.ModelDuration(cmd.Flag("query.resolution-stitch-window", "Experimental: window before the end of downsampled data, when downsampled data is allowed, for which raw data is also queried and used instead, to fill gaps at the boundary between resolutions if no resolution_stitch_window param is specified. 0 disables it.").
+		Default("0s"))
+
+	aggregationPushdown := cmd.Flag("query.aggregation-pushdown", "Experimental: hint stores with the sum, min or max by labels surrounding the series selectors of queries over downsampled data, so that store gateways with --store.enable-aggregation-pushdown aggregate the series themselves instead of sending them one by one.").
+		Default("false").Bool()
+
+	sortSeries := cmd.Flag("query.sort-series", "Sort the series of query results by labels if no sort_series param is specified, so that results are the same across queriers and retries. Results of instant queries sorted by the sort functions are not sorted by labels.").
+		Default("false").Bool()
+
 	enableQueryPartialResponse := cmd.Flag("query.partial-response", "Enable partial response for queries if no partial_response param is specified. --no-query.partial-response for disabling.").
 		Default("true").Bool()
 
 	enableRulePartialResponse := cmd.Flag("rule.partial-response", "Enable partial response for rules endpoint. --no-rule.partial-response for disabling.").
 		Hidden().Default("true").Bool()
 
+	enableRuleSortedDedup := cmd.Flag("rule.sorted-dedup", "Experimental: request rule groups sorted by file and name from rules APIs and deduplicate them as they are received, instead of buffering all of them. Rules APIs which don't sort rule groups are treated as failing.").
+		Default("false").Bool()
+
+	ruleDedupStrategy := cmd.Flag("rule.dedup-strategy", "Strategy choosing the replica of the rules kept when deduplicating rules: "+strings.Join(rules.DedupStrategies, ", ")+". prefer-firing keeps firing, then pending alerts, then the most recently evaluated rules; prefer-most-recent keeps the most recently evaluated rules first; prefer-lowest-replica keeps the rules of the replica with the lowest replica labels, so that rules come from the same replica while it is available. Equally preferred rules are deduplicated to the replica with the lowest replica labels.").
+		Default(string(rules.DedupPreferFiring)).Enum(rules.DedupStrategies...)
+
+	ruleGroupMergeStrategy := cmd.Flag("rule.group-merge-strategy", "Strategy choosing which of the rule groups with the same file and name received from different rules APIs are merged into one group: "+strings.Join(rules.GroupMergeStrategies, ", ")+". file merges all of them; source only merges those of rules APIs with the same external labels once the replica labels are removed, so that distinct rulers sharing file and group names are kept apart; endpoint only merges those of the same rules API.").
+		Default(string(rules.GroupMergeByFile)).Enum(rules.GroupMergeStrategies...)
+
+	ruleEndpointTimeout := extkingpin.ModelDuration(cmd.Flag("rule.endpoint-timeout", "Maximum time spent receiving the rule groups of every rules API on a rules request, not counting the time spent waiting for other rules APIs. Rules APIs exceeding it are skipped with a warning if partial response is enabled, or fail the request otherwise. 0 disables it.").
+		Default("0s"))
+
 	enableTargetPartialResponse := cmd.Flag("target.partial-response", "Enable partial response for targets endpoint. --no-target.partial-response for disabling.").
 		Hidden().Default("true").Bool()
 
@@ -220,6 +265,9 @@ func registerQuery(app *extkingpin.App) {
 	reqLogConfig := extkingpin.RegisterRequestLoggingFlags(cmd)
 
 	alertQueryURL := cmd.Flag("alert.query-url", "The external Thanos Query URL that would be set in all alerts 'Source' field.").String()
+	storeResponseValidation := cmd.Flag("store.response-validation", "Validation of the series the stores respond with. Series with chunks that can't be decoded, with duplicate timestamps or out of order samples, and counters (series whose name ends with _total) with negative or NaN samples other than staleness markers are invalid. If drop, invalid series are dropped, with a warning if partial responses are enabled. If strict, queries fail on invalid series. The thanos_proxy_store_invalid_series_total metric counts invalid series by store.").
+		Default(string(store.NoResponseValidation)).Enum(string(store.NoResponseValidation), string(store.DropResponseValidation), string(store.StrictResponseValidation))
+	storeLabelsLimit := cmd.Flag("store.label-results-limit", "Maximum number of label names or values returned by the stores for a single label names or label values request. Results are merged as the stores respond: once the limit is reached, the stores which didn't respond yet aren't waited for and a truncated result is returned with a warning. 0 disables the limit.").Default("0").Int()
 	grpcProxyStrategy := cmd.Flag("grpc.proxy-strategy", "Strategy to use when proxying Series requests to leaf nodes. Hidden and only used for testing, will be removed after lazy becomes the default.").Default(string(store.EagerRetrieval)).Hidden().Enum(string(store.EagerRetrieval), string(store.LazyRetrieval))
 
 	queryTelemetryDurationQuantiles := cmd.Flag("query.telemetry.request-duration-seconds-quantiles", "The quantiles for exporting metrics about the request duration quantiles.").Default("0.1", "0.25", "0.75", "1.25", "1.75", "2.5", "3", "5", "10").Float64List()
@@ -231,6 +279,7 @@ func registerQuery(app *extkingpin.App) {
 	tenantCertField := cmd.Flag("query.tenant-certificate-field", "Use TLS client's certificate field to determine tenant for write requests. Must be one of "+tenancy.CertificateFieldOrganization+", "+tenancy.CertificateFieldOrganizationalUnit+" or "+tenancy.CertificateFieldCommonName+". This setting will cause the query.tenant-header flag value to be ignored.").Default("").Enum("", tenancy.CertificateFieldOrganization, tenancy.CertificateFieldOrganizationalUnit, tenancy.CertificateFieldCommonName)
 	enforceTenancy := cmd.Flag("query.enforce-tenancy", "Enforce tenancy on Query APIs. Responses are returned only if the label value of the configured tenant-label-name and the value of the tenant header matches.").Default("false").Bool()
 	tenantLabel := cmd.Flag("query.tenant-label-name", "Label name to use when enforcing tenancy (if --query.enforce-tenancy is enabled).").Default(tenancy.DefaultTenantLabel).String()
+	tenantEvaluationIntervalFlags := cmd.Flag("query.tenant-evaluation-interval", "Default evaluation interval for sub queries of a tenant, overriding --query.default-evaluation-interval, in the <tenant>=<duration> format. Sub queries without step are evaluated, and aligned, at this interval for queries of the tenant. Can be repeated for multiple tenants.").PlaceHolder("<tenant>=<duration>").Strings()
 
 	var storeRateLimits store.SeriesSelectLimits
 	storeRateLimits.RegisterFlags(cmd)
@@ -293,6 +342,16 @@ func registerQuery(app *extkingpin.App) {
 			return err
 		}
 
+		tenantEvaluationIntervals, err := parseTenantEvaluationIntervals(*tenantEvaluationIntervalFlags)
+		if err != nil {
+			return err
+		}
+
+		tenantDownsampleRetry, err := parseTenantDownsampleRetry(*tenantDownsampleRetryFlags)
+		if err != nil {
+			return err
+		}
+
 		return runQuery(
 			g,
 			logger,
@@ -338,6 +397,10 @@ func registerQuery(app *extkingpin.App) {
 			*enableAutodownsampling,
 			*enableQueryPartialResponse,
 			*enableRulePartialResponse,
+			*enableRuleSortedDedup,
+			rules.DedupStrategy(*ruleDedupStrategy),
+			rules.GroupMergeStrategy(*ruleGroupMergeStrategy),
+			time.Duration(*ruleEndpointTimeout),
 			*enableTargetPartialResponse,
 			*enableMetricMetadataPartialResponse,
 			*enableExemplarPartialResponse,
@@ -347,14 +410,23 @@ func registerQuery(app *extkingpin.App) {
 			*dnsSDResolver,
 			time.Duration(*unhealthyStoreTimeout),
 			time.Duration(*endpointInfoTimeout),
+			time.Duration(*endpointInfoStalenessGracePeriod),
 			time.Duration(*instantDefaultMaxSourceResolution),
 			*defaultMetadataTimeRange,
+			*metadataCacheTTL,
+			*metadataCacheMaxSize,
+			time.Duration(*stitchWindow),
+			*aggregationPushdown,
+			*sortSeries,
 			*strictStores,
 			*strictEndpoints,
 			*strictEndpointGroups,
+			endpointConfig,
 			*webDisableCORS,
 			*alertQueryURL,
 			*grpcProxyStrategy,
+			store.ResponseValidationMode(*storeResponseValidation),
+			*storeLabelsLimit,
 			component.Query,
 			*queryTelemetryDurationQuantiles,
 			*queryTelemetrySamplesQuantiles,
@@ -369,10 +441,59 @@ func registerQuery(app *extkingpin.App) {
 			*tenantCertField,
 			*enforceTenancy,
 			*tenantLabel,
+			tenantEvaluationIntervals,
+			*downsampleRetry,
+			tenantDownsampleRetry,
+			*maxSamples,
+			*accountingLabel,
+			*accountingMaxOwners,
 		)
 	})
 }
 
+// parseTenantEvaluationIntervals parses the <tenant>=<duration> evaluation intervals of tenants.
+func parseTenantEvaluationIntervals(flags []string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration, len(flags))
+	for _, f := range flags {
+		tenant, d, ok := strings.Cut(f, "=")
+		if !ok || tenant == "" {
+			return nil, errors.Errorf("invalid tenant evaluation interval %q, expected <tenant>=<duration>", f)
+		}
+		interval, err := commonmodel.ParseDuration(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse evaluation interval of tenant %q", tenant)
+		}
+		if interval <= 0 {
+			return nil, errors.Errorf("evaluation interval of tenant %q must be positive", tenant)
+		}
+		if _, ok := intervals[tenant]; ok {
+			return nil, errors.Errorf("duplicate evaluation interval of tenant %q", tenant)
+		}
+		intervals[tenant] = time.Duration(interval)
+	}
+	return intervals, nil
+}
+
+// parseTenantDownsampleRetry parses the <tenant>=<bool> downsample retry settings of tenants.
+func parseTenantDownsampleRetry(flags []string) (map[string]bool, error) {
+	retry := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		tenant, v, ok := strings.Cut(f, "=")
+		if !ok || tenant == "" {
+			return nil, errors.Errorf("invalid tenant downsample retry %q, expected <tenant>=<bool>", f)
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse downsample retry of tenant %q", tenant)
+		}
+		if _, ok := retry[tenant]; ok {
+			return nil, errors.Errorf("duplicate downsample retry of tenant %q", tenant)
+		}
+		retry[tenant] = enabled
+	}
+	return retry, nil
+}
+
 // runQuery starts a server that exposes PromQL Query API. It is responsible for querying configured
 // store nodes, merging and duplicating the data to satisfy user query.
 func runQuery(
@@ -420,6 +541,10 @@ func runQuery(
 	enableAutodownsampling bool,
 	enableQueryPartialResponse bool,
 	enableRulePartialResponse bool,
+	enableRuleSortedDedup bool,
+	ruleDedupStrategy rules.DedupStrategy,
+	ruleGroupMergeStrategy rules.GroupMergeStrategy,
+	ruleEndpointTimeout time.Duration,
 	enableTargetPartialResponse bool,
 	enableMetricMetadataPartialResponse bool,
 	enableExemplarPartialResponse bool,
@@ -429,14 +554,23 @@ func runQuery(
 	dnsSDResolver string,
 	unhealthyStoreTimeout time.Duration,
 	endpointInfoTimeout time.Duration,
+	endpointInfoStalenessGracePeriod time.Duration,
 	instantDefaultMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
+	metadataCacheTTL time.Duration,
+	metadataCacheMaxSize units.Base2Bytes,
+	stitchWindow time.Duration,
+	aggregationPushdown bool,
+	sortSeries bool,
 	strictStores []string,
 	strictEndpoints []string,
 	strictEndpointGroups []string,
+	endpointConfig *extflag.PathOrContent,
 	disableCORS bool,
 	alertQueryURL string,
 	grpcProxyStrategy string,
+	responseValidationMode store.ResponseValidationMode,
+	labelsLimit int,
 	comp component.Component,
 	queryTelemetryDurationQuantiles []float64,
 	queryTelemetrySamplesQuantiles []float64,
@@ -451,6 +585,12 @@ func runQuery(
 	tenantCertField string,
 	enforceTenancy bool,
 	tenantLabel string,
+	tenantEvaluationIntervals map[string]time.Duration,
+	downsampleRetry bool,
+	tenantDownsampleRetry map[string]bool,
+	maxSamples int,
+	accountingLabel string,
+	accountingMaxOwners int,
 ) error {
 	if alertQueryURL == "" {
 		lastColon := strings.LastIndex(httpBindAddr, ":")
@@ -522,9 +662,26 @@ func runQuery(
 		dns.ResolverType(dnsSDResolver),
 	)
 
+	configuredEndpoints := query.NewConfiguredEndpoints(logger, dns.NewProvider(
+		logger,
+		extprom.WrapRegistererWithPrefix("thanos_query_endpoint_config_", reg),
+		dns.ResolverType(dnsSDResolver),
+	))
+	endpointConfigContent, err := endpointConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of endpoint configuration")
+	}
+	if len(endpointConfigContent) > 0 {
+		if err := configuredEndpoints.Reload(endpointConfigContent); err != nil {
+			return errors.Wrap(err, "load endpoint configuration")
+		}
+	}
+
 	options := []store.ProxyStoreOption{
 		store.WithTSDBSelector(tsdbSelector),
 		store.WithProxyStoreDebugLogging(debugLogging),
+		store.WithResponseValidation(responseValidationMode),
+		store.WithLabelsLimit(labelsLimit),
 	}
 
 	var (
@@ -545,14 +702,16 @@ func runQuery(
 			strictEndpoints,
 			endpointGroupAddrs,
 			strictEndpointGroups,
+			configuredEndpoints,
 			dialOpts,
 			unhealthyStoreTimeout,
 			endpointInfoTimeout,
+			endpointInfoStalenessGracePeriod,
 			queryConnMetricLabels...,
 		)
 
 		proxy            = store.NewProxyStore(logger, reg, endpoints.GetStoreClients, component.Query, selectorLset, storeResponseTimeout, store.RetrievalStrategy(grpcProxyStrategy), options...)
-		rulesProxy       = rules.NewProxy(logger, endpoints.GetRulesClients)
+		rulesProxy       = rules.NewProxy(logger, endpoints.GetRulesClients, rules.WithEndpointTimeout(ruleEndpointTimeout), rules.WithTenantLabel(tenantLabel))
 		targetsProxy     = targets.NewProxy(logger, endpoints.GetTargetsClients)
 		metadataProxy    = metadata.NewProxy(logger, endpoints.GetMetricMetadataClients)
 		exemplarsProxy   = exemplars.NewProxy(logger, endpoints.GetExemplarsStores, selectorLset)
@@ -562,6 +721,7 @@ func runQuery(
 			proxy,
 			maxConcurrentSelects,
 			queryTimeout,
+			query.WithAggregationPushdown(aggregationPushdown),
 		)
 	)
 
@@ -630,6 +790,9 @@ func runQuery(
 					level.Error(logger).Log("msg", "failed to resolve addresses passed using endpoint flag", "err", err)
 
 				}
+				if err := configuredEndpoints.Resolve(resolveCtx); err != nil {
+					level.Error(logger).Log("msg", "failed to resolve addresses of the endpoint configuration", "err", err)
+				}
 				return nil
 			})
 		}, func(error) {
@@ -637,6 +800,34 @@ func runQuery(
 		})
 	}
 
+	// Reload the endpoint configuration when its file changes.
+	if endpointConfig.Path() != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			if err := extkingpin.PathContentReloader(ctx, endpointConfig, logger, func() {
+				level.Info(logger).Log("msg", "reloading endpoint configuration")
+				content, err := endpointConfig.Content()
+				if err == nil {
+					err = configuredEndpoints.Reload(content)
+				}
+				if err != nil {
+					level.Error(logger).Log("msg", "error reloading endpoint configuration, keeping the previous one", "path", endpointConfig.Path(), "err", err)
+					return
+				}
+				if err := configuredEndpoints.Resolve(ctx); err != nil {
+					level.Error(logger).Log("msg", "failed to resolve addresses of the endpoint configuration", "err", err)
+				}
+				endpoints.Update(ctx)
+			}, 1*time.Second); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -646,10 +837,9 @@ func runQuery(
 	)
 
 	engineOpts := promql.EngineOpts{
-		Logger: logger,
-		Reg:    reg,
-		// TODO(bwplotka): Expose this as a flag: https://github.com/thanos-io/thanos/issues/703.
-		MaxSamples:    math.MaxInt32,
+		Logger:        logger,
+		Reg:           reg,
+		MaxSamples:    maxSamples,
 		Timeout:       queryTimeout,
 		LookbackDelta: lookbackDelta,
 		NoStepSubqueryIntervalFn: func(int64) int64 {
@@ -710,6 +900,29 @@ func runQuery(
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
 		ui.NewQueryUI(logger, endpoints, webExternalPrefix, webPrefixHeaderName, alertQueryURL, tenantHeader, defaultTenant, enforceTenancy).Register(router, ins)
 
+		rulesClient := rules.NewGRPCClientWithDedup(rulesProxy, queryReplicaLabels)
+		if enableRuleSortedDedup {
+			rulesClient = rules.NewGRPCClientWithSortedDedup(rulesProxy, queryReplicaLabels)
+		}
+		rulesClient.WithDedupStrategy(ruleDedupStrategy).WithGroupMergeStrategy(ruleGroupMergeStrategy)
+
+		var metadataCache *apiv1.MetadataCache
+		if metadataCacheTTL > 0 {
+			c, err := thanoscache.NewInMemoryCacheWithConfig("query-metadata", logger, reg, thanoscache.InMemoryCacheConfig{
+				MaxSize:     model.Bytes(metadataCacheMaxSize),
+				MaxItemSize: model.Bytes(metadataCacheMaxSize),
+			})
+			if err != nil {
+				return errors.Wrap(err, "create metadata cache")
+			}
+			metadataCache = apiv1.NewMetadataCache(logger, c, metadataCacheTTL, reg)
+		}
+
+		var accounting *apiv1.QueryAccounting
+		if accountingLabel != "" {
+			accounting = apiv1.NewQueryAccounting(reg, accountingLabel, accountingMaxOwners)
+		}
+
 		api := apiv1.NewQueryAPI(
 			logger,
 			endpoints.GetEndpointStatus,
@@ -718,7 +931,7 @@ func runQuery(
 			lookbackDeltaCreator,
 			queryableCreator,
 			// NOTE: Will share the same replica label as the query for now.
-			rules.NewGRPCClientWithDedup(rulesProxy, queryReplicaLabels),
+			rulesClient,
 			targets.NewGRPCClientWithDedup(targetsProxy, queryReplicaLabels),
 			metadata.NewGRPCClient(metadataProxy),
 			exemplars.NewGRPCClientWithDedup(exemplarsProxy, queryReplicaLabels),
@@ -733,6 +946,8 @@ func runQuery(
 			defaultRangeQueryStep,
 			instantDefaultMaxSourceResolution,
 			defaultMetadataTimeRange,
+			stitchWindow,
+			sortSeries,
 			disableCORS,
 			gate.New(
 				extprom.WrapRegistererWithPrefix("thanos_query_concurrent_", reg),
@@ -751,6 +966,11 @@ func runQuery(
 			tenantCertField,
 			enforceTenancy,
 			tenantLabel,
+			metadataCache,
+			tenantEvaluationIntervals,
+			downsampleRetry,
+			tenantDownsampleRetry,
+			accounting,
 		)
 
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
@@ -792,6 +1012,7 @@ func runQuery(
 						SupportsSharding:             true,
 						SupportsWithoutReplicaLabels: true,
 						TsdbInfos:                    proxy.TSDBInfos(),
+						SupportsTimeFiltering:        proxy.SupportsTimeFiltering(),
 					}, nil
 				}
 				return nil, errors.New("Not ready")
@@ -817,6 +1038,8 @@ func runQuery(
 			grpcserver.WithListen(grpcServerConfig.bindAddress),
 			grpcserver.WithGracePeriod(grpcServerConfig.gracePeriod),
 			grpcserver.WithMaxConnAge(grpcServerConfig.maxConnectionAge),
+			grpcserver.WithReflection(grpcServerConfig.reflection),
+			grpcserver.WithHealthService(grpcServerConfig.healthService),
 			grpcserver.WithTLSConfig(tlsCfg),
 		)
 
@@ -860,9 +1083,11 @@ func prepareEndpointSet(
 	strictEndpoints []string,
 	endpointGroupAddrs []string,
 	strictEndpointGroups []string,
+	configuredEndpoints *query.ConfiguredEndpoints,
 	dialOpts []grpc.DialOption,
 	unhealthyStoreTimeout time.Duration,
 	endpointInfoTimeout time.Duration,
+	endpointInfoStalenessGracePeriod time.Duration,
 	queryConnMetricLabels ...string,
 ) *query.EndpointSet {
 	endpointSet := query.NewEndpointSet(
@@ -901,11 +1126,16 @@ func prepareEndpointSet(
 				specs = append(specs, spec)
 			}
 
+			if configuredEndpoints != nil {
+				specs = append(specs, configuredEndpoints.Specs()...)
+			}
+
 			return specs
 		},
 		dialOpts,
 		unhealthyStoreTimeout,
 		endpointInfoTimeout,
+		endpointInfoStalenessGracePeriod,
 		queryConnMetricLabels...,
 	)
 
@@ -4,7 +4,7 @@
 package main
 
 import (
-	"net"
+	"context"
 	"net/http"
 	"time"
 
@@ -19,15 +19,13 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/thanos-io/promql-engine/execution/parse"
 	"github.com/weaveworks/common/user"
-	"gopkg.in/yaml.v2"
 
-	cortexfrontend "github.com/thanos-io/thanos/internal/cortex/frontend"
 	"github.com/thanos-io/thanos/internal/cortex/frontend/transport"
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	cortexvalidation "github.com/thanos-io/thanos/internal/cortex/util/validation"
 	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/api/frontend"
 	"github.com/thanos-io/thanos/pkg/component"
-	"github.com/thanos-io/thanos/pkg/exthttp"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
@@ -45,6 +43,9 @@ type queryFrontendConfig struct {
 	http           httpConfig
 	webDisableCORS bool
 	orgIdHeaders   []string
+
+	ruleSuggestionsMaxFingerprints int
+	canaryQueriesPathOrContent     extflag.PathOrContent
 }
 
 func registerQueryFrontend(app *extkingpin.App) {
@@ -138,8 +139,20 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("query-frontend.downstream-url", "URL of downstream Prometheus Query compatible API.").
 		Default("http://localhost:9090").StringVar(&cfg.DownstreamURL)
 
+	cmd.Flag("query-frontend.downstream-request-encoding", "Encoding of the parameters of the POST requests sent downstream: 'form' for URL encoded forms, or 'json' for JSON objects, e.g. for API gateways. Both encodings are accepted from clients, and by Thanos Query.").
+		Default(string(queryfrontend.FormRequestEncoding)).EnumVar((*string)(&cfg.DownstreamRequestEncoding), string(queryfrontend.FormRequestEncoding), string(queryfrontend.JSONRequestEncoding))
+
 	cfg.DownstreamTripperConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-frontend.downstream-tripper-config", "YAML file that contains downstream tripper configuration. If your downstream URL is localhost or 127.0.0.1 then it is highly recommended to increase max_idle_conns_per_host to at least 100.", extflag.WithEnvSubstitution())
 
+	cmd.Flag("query-frontend.downstream-concurrency.max", "Maximum number of concurrent requests to the downstream. "+
+		"The limit is adapted between query-frontend.downstream-concurrency.min and this value: it is decreased when downstream requests fail, are rejected or are slower than query-frontend.downstream-concurrency.latency-threshold, and increased back while they succeed. "+
+		"Requests over the limit wait for in-flight ones to complete. Set to 0 to disable.").
+		Default("0").IntVar(&cfg.AdaptiveConcurrency.MaxConcurrency)
+	cmd.Flag("query-frontend.downstream-concurrency.min", "Minimum number of concurrent requests to the downstream the adaptive concurrency limit is decreased to.").
+		Default("1").IntVar(&cfg.AdaptiveConcurrency.MinConcurrency)
+	cmd.Flag("query-frontend.downstream-concurrency.latency-threshold", "Latency above which downstream requests decrease the adaptive concurrency limit, as if the downstream was overloaded. Set to 0 to only decrease it on failed requests.").
+		Default("0").DurationVar(&cfg.AdaptiveConcurrency.LatencyThreshold)
+
 	cmd.Flag("query-frontend.compress-responses", "Compress HTTP responses.").
 		Default("false").BoolVar(&cfg.CompressResponses)
 
@@ -163,6 +176,16 @@ func registerQueryFrontend(app *extkingpin.App) {
 
 	cmd.Flag("query-frontend.slow-query-logs-user-header", "Set the value of the field remote_user in the slow query logs to the value of the given HTTP header. Falls back to reading the user from the basic auth header.").PlaceHolder("<http-header-name>").Default("").StringVar(&cfg.CortexHandlerConfig.SlowQueryLogsUserHeader)
 
+	cmd.Flag("query-frontend.rule-suggestions.max-fingerprints", "Maximum number of slow query fingerprints tracked to suggest recording rules on the /api/v1/rule_suggestions endpoint. "+
+		"Queries are tracked when they are slower than query-frontend.log-queries-longer-than. Set to 0 to disable.").
+		Default("1000").IntVar(&cfg.ruleSuggestionsMaxFingerprints)
+
+	cfg.QueryAttributesPathOrContent = *extflag.RegisterPathOrContent(cmd, "query-frontend.query-attributes-config", "YAML file that contains query attribute matchers and the policies applied to queries matching them, e.g. rejecting them.", extflag.WithEnvSubstitution())
+
+	cfg.HeaderPolicyPathOrContent = *extflag.RegisterPathOrContent(cmd, "query-frontend.header-policy-config", "YAML file that contains the policy of the client headers propagated to downstream queriers, forwarding or stripping each of them.", extflag.WithEnvSubstitution())
+
+	cfg.canaryQueriesPathOrContent = *extflag.RegisterPathOrContent(cmd, "query-frontend.canary-queries-config", "YAML file that contains canary queries periodically executed by the query-frontend through all its middlewares, exporting the thanos_query_frontend_canary_* metrics about their outcome and latency.", extflag.WithEnvSubstitution())
+
 	reqLogConfig := extkingpin.RegisterRequestLoggingFlags(cmd)
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
@@ -175,60 +198,6 @@ func registerQueryFrontend(app *extkingpin.App) {
 	})
 }
 
-func parseTransportConfiguration(downstreamTripperConfContentYaml []byte) (*http.Transport, error) {
-	downstreamTripper := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-
-	if len(downstreamTripperConfContentYaml) > 0 {
-		tripperConfig := &queryfrontend.DownstreamTripperConfig{}
-		if err := yaml.UnmarshalStrict(downstreamTripperConfContentYaml, tripperConfig); err != nil {
-			return nil, errors.Wrap(err, "parsing downstream tripper config YAML file")
-		}
-
-		if tripperConfig.TLSConfig != nil {
-			tlsConfig, err := exthttp.NewTLSConfig(tripperConfig.TLSConfig)
-			if err != nil {
-				return nil, errors.Wrap(err, "parsing downstream tripper TLS config YAML")
-			}
-			downstreamTripper.TLSClientConfig = tlsConfig
-		}
-		if tripperConfig.IdleConnTimeout > 0 {
-			downstreamTripper.IdleConnTimeout = time.Duration(tripperConfig.IdleConnTimeout)
-		}
-		if tripperConfig.ResponseHeaderTimeout > 0 {
-			downstreamTripper.ResponseHeaderTimeout = time.Duration(tripperConfig.ResponseHeaderTimeout)
-		}
-		if tripperConfig.TLSHandshakeTimeout > 0 {
-			downstreamTripper.TLSHandshakeTimeout = time.Duration(tripperConfig.TLSHandshakeTimeout)
-		}
-		if tripperConfig.ExpectContinueTimeout > 0 {
-			downstreamTripper.ExpectContinueTimeout = time.Duration(tripperConfig.ExpectContinueTimeout)
-		}
-		if tripperConfig.MaxIdleConns != nil {
-			downstreamTripper.MaxIdleConns = *tripperConfig.MaxIdleConns
-		}
-		if tripperConfig.MaxIdleConnsPerHost != nil {
-			downstreamTripper.MaxIdleConnsPerHost = *tripperConfig.MaxIdleConnsPerHost
-		}
-		if tripperConfig.MaxConnsPerHost != nil {
-			downstreamTripper.MaxConnsPerHost = *tripperConfig.MaxConnsPerHost
-		}
-	}
-
-	return downstreamTripper, nil
-}
-
 func runQueryFrontend(
 	g *run.Group,
 	logger log.Logger,
@@ -288,6 +257,40 @@ func runQueryFrontend(
 		}
 	}
 
+	queryAttributesConfContentYaml, err := cfg.QueryAttributesPathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(queryAttributesConfContentYaml) > 0 {
+		cfg.QueryAttributes, err = queryfrontend.ParseQueryAttributesConfig(queryAttributesConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the query attributes config")
+		}
+	}
+
+	headerPolicyConfContentYaml, err := cfg.HeaderPolicyPathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(headerPolicyConfContentYaml) > 0 {
+		cfg.HeaderPolicy, err = queryfrontend.ParseHeaderPolicyConfig(headerPolicyConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the header policy config")
+		}
+	}
+
+	var canaryQueries *queryfrontend.CanaryQueriesConfig
+	canaryQueriesConfContentYaml, err := cfg.canaryQueriesPathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(canaryQueriesConfContentYaml) > 0 {
+		canaryQueries, err = queryfrontend.ParseCanaryQueriesConfig(canaryQueriesConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the canary queries config")
+		}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return errors.Wrap(err, "error validating the config")
 	}
@@ -298,34 +301,34 @@ func runQueryFrontend(
 		}
 	}
 
-	tripperWare, err := queryfrontend.NewTripperware(cfg.Config, reg, logger)
-	if err != nil {
-		return errors.Wrap(err, "setup tripperwares")
-	}
-
 	// Create a downstream roundtripper.
 	downstreamTripperConfContentYaml, err := cfg.DownstreamTripperConfig.CachePathOrContent.Content()
 	if err != nil {
 		return err
 	}
-	downstreamTripper, err := parseTransportConfiguration(downstreamTripperConfContentYaml)
+	downstreamTripper, err := queryfrontend.NewDownstreamTransport(downstreamTripperConfContentYaml)
 	if err != nil {
 		return err
 	}
-
-	roundTripper, err := cortexfrontend.NewDownstreamRoundTripper(cfg.DownstreamURL, downstreamTripper)
+	downstreamRoundTripper, err := queryfrontend.NewDownstreamRoundTripper(cfg.DownstreamURL, downstreamTripper)
 	if err != nil {
-		return errors.Wrap(err, "setup downstream roundtripper")
+		return err
 	}
 
-	// Wrap the downstream RoundTripper into query frontend Tripperware.
-	roundTripper = tripperWare(roundTripper)
-
-	// Create the query frontend transport.
-	handler := transport.NewHandler(*cfg.CortexHandlerConfig, roundTripper, logger, nil)
-	if cfg.CompressResponses {
-		handler = gzhttp.GzipHandler(handler)
+	// Wrap the downstream RoundTripper into the query frontend middleware chain.
+	fe, err := queryfrontend.NewFrontend(
+		cfg.Config,
+		downstreamRoundTripper,
+		reg,
+		logger,
+		queryfrontend.WithRuleSuggestions(cfg.ruleSuggestionsMaxFingerprints),
+		queryfrontend.WithOrgIDHeaders(cfg.orgIdHeaders...),
+	)
+	if err != nil {
+		return err
 	}
+	ruleSuggestions := fe.RuleSuggestions()
+	maintenanceWindows := fe.MaintenanceWindows()
 
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -369,7 +372,24 @@ func runQueryFrontend(
 			})
 			return hf
 		}
-		srv.Handle("/", instr(handler.ServeHTTP))
+		srv.Handle("/", instr(fe.ServeHTTP))
+		if ruleSuggestions != nil {
+			srv.Handle("/api/v1/rule_suggestions", instr(ruleSuggestions.ServeHTTP))
+		}
+		if maintenanceWindows != nil {
+			srv.Handle("/api/v1/maintenance_windows", instr(maintenanceWindows.ServeHTTP))
+		}
+		srv.Handle(frontend.SpecPath, instr(frontend.SpecHandler().ServeHTTP))
+
+		if canaryQueries != nil && len(canaryQueries.Queries) > 0 {
+			canaryProber := queryfrontend.NewCanaryProber(logger, reg, canaryQueries, instr(fe.ServeHTTP), cfg.TenantHeader, cfg.DefaultTenant)
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return canaryProber.Run(ctx)
+			}, func(error) {
+				cancel()
+			})
+		}
 
 		g.Add(func() error {
 			statusProber.Healthy()
@@ -389,11 +409,5 @@ func runQueryFrontend(
 }
 
 func extractOrgId(conf *queryFrontendConfig, r *http.Request) string {
-	for _, header := range conf.orgIdHeaders {
-		headerVal := r.Header.Get(header)
-		if headerVal != "" {
-			return headerVal
-		}
-	}
-	return "anonymous"
+	return queryfrontend.OrgIDFromHeaders(r, conf.orgIdHeaders)
 }
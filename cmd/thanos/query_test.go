@@ -94,3 +94,36 @@ func TestLookbackDeltaFactory(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTenantEvaluationIntervals(t *testing.T) {
+	intervals, err := parseTenantEvaluationIntervals([]string{"team-a=15s", "team-b=5m"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]time.Duration{"team-a": 15 * time.Second, "team-b": 5 * time.Minute}, intervals)
+
+	for _, flags := range [][]string{
+		{"team-a"},
+		{"=15s"},
+		{"team-a=fast"},
+		{"team-a=0s"},
+		{"team-a=15s", "team-a=1m"},
+	} {
+		_, err := parseTenantEvaluationIntervals(flags)
+		testutil.NotOk(t, err, "%v", flags)
+	}
+}
+
+func TestParseTenantDownsampleRetry(t *testing.T) {
+	retry, err := parseTenantDownsampleRetry([]string{"team-a=true", "team-b=false"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]bool{"team-a": true, "team-b": false}, retry)
+
+	for _, flags := range [][]string{
+		{"team-a"},
+		{"=true"},
+		{"team-a=maybe"},
+		{"team-a=true", "team-a=false"},
+	} {
+		_, err := parseTenantDownsampleRetry(flags)
+		testutil.NotOk(t, err, "%v", flags)
+	}
+}
@@ -80,6 +80,14 @@ func registerReceive(app *extkingpin.App) {
 			return errors.Wrap(err, "error while parsing config for request logging")
 		}
 
+		if conf.tsdbWriteQueueSize < 0 {
+			return errors.Errorf("the tsdb write queue size must not be negative, got %d", conf.tsdbWriteQueueSize)
+		}
+
+		if conf.hashringsKubernetesService != "" && (conf.hashringsFilePath != "" || conf.hashringsFileContent != "") {
+			return errors.New("the hashring can be configured by either a hashrings file or content, or a Kubernetes service, not both")
+		}
+
 		tsdbOpts := &tsdb.Options{
 			MinBlockDuration:               int64(time.Duration(*conf.tsdbMinBlockDuration) / time.Millisecond),
 			MaxBlockDuration:               int64(time.Duration(*conf.tsdbMaxBlockDuration) / time.Millisecond),
@@ -88,7 +96,7 @@ func registerReceive(app *extkingpin.App) {
 			MaxBytes:                       int64(conf.tsdbMaxBytes),
 			OutOfOrderCapMax:               conf.tsdbOutOfOrderCapMax,
 			NoLockfile:                     conf.noLockFile,
-			WALCompression:                 wlog.ParseCompressionType(conf.walCompression, string(wlog.CompressionSnappy)),
+			WALCompression:                 wlog.ParseCompressionType(conf.walCompression, conf.walCompressionType),
 			MaxExemplars:                   conf.tsdbMaxExemplars,
 			EnableExemplarStorage:          conf.tsdbMaxExemplars > 0,
 			HeadChunksWriteQueueSize:       int(conf.tsdbWriteQueueSize),
@@ -205,6 +213,48 @@ func runReceive(
 		return errors.Wrap(err, "parse relabel configuration")
 	}
 
+	aggregationContentYaml, err := conf.aggregationConfigPath.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of streaming aggregation configuration")
+	}
+	var aggregator *receive.Aggregator
+	if len(aggregationContentYaml) > 0 {
+		aggregationConfigs, err := receive.ParseAggregationConfigs(aggregationContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "parse streaming aggregation configuration")
+		}
+		aggregator, err = receive.NewAggregator(log.With(logger, "component", "receive-aggregator"), reg, aggregationConfigs, conf.endpoint)
+		if err != nil {
+			return errors.Wrap(err, "create streaming aggregator")
+		}
+	}
+
+	tenantRetentionContentYaml, err := conf.tenantRetentionPath.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of tenant retention configuration")
+	}
+	var multiTSDBOptions []receive.MultiTSDBOption
+	if len(tenantRetentionContentYaml) > 0 {
+		tenantRetention, err := receive.ParseTenantRetentionConfig(tenantRetentionContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "parse tenant retention configuration")
+		}
+		multiTSDBOptions = append(multiTSDBOptions, receive.WithTenantRetention(tenantRetention))
+	}
+	multiTSDBOptions = append(multiTSDBOptions, receive.WithTenantDeletionDelay(time.Duration(*conf.tenantDeletionDelay)))
+
+	var storageHealth *receive.StorageHealth
+	if *conf.storageHealthCheckInterval > 0 && enableIngestion {
+		storageHealth, err = receive.NewStorageHealth(log.With(logger, "component", "receive-storage-health"), reg, conf.dataDir, receive.StorageHealthOptions{
+			MinFreeDiskRatio: conf.storageHealthMinFreeDiskRatio,
+			RetryInterval:    time.Duration(*conf.storageHealthRetryInterval),
+		})
+		if err != nil {
+			return errors.Wrap(err, "creating storage health")
+		}
+		multiTSDBOptions = append(multiTSDBOptions, receive.WithStorageHealth(storageHealth))
+	}
+
 	dbs := receive.NewMultiTSDB(
 		conf.dataDir,
 		logger,
@@ -215,11 +265,16 @@ func runReceive(
 		bkt,
 		conf.allowOutOfOrderUpload,
 		hashFunc,
+		multiTSDBOptions...,
 	)
-	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs, &receive.WriterOptions{
-		Intern:                   conf.writerInterning,
-		TooFarInFutureTimeWindow: int64(time.Duration(*conf.tsdbTooFarInFutureTimeWindow)),
-	})
+	var writeFailures *receive.WriteFailures
+	if *conf.writeFailuresWindow > 0 {
+		writeFailures = receive.NewWriteFailures(time.Duration(*conf.writeFailuresWindow), receive.DefaultWriteFailureExamples)
+	}
+	var seriesChurn *receive.SeriesChurn
+	if *conf.seriesChurnWindow > 0 {
+		seriesChurn = receive.NewSeriesChurn(time.Duration(*conf.seriesChurnWindow))
+	}
 
 	var limitsConfig *receive.RootLimitsConfig
 	if conf.writeLimitsConfig != nil {
@@ -237,6 +292,30 @@ func runReceive(
 		return errors.Wrap(err, "creating limiter")
 	}
 
+	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs, reg, &receive.WriterOptions{
+		Intern:                   conf.writerInterning,
+		TooFarInFutureTimeWindow: int64(time.Duration(*conf.tsdbTooFarInFutureTimeWindow)),
+		DelayedSampleThreshold:   time.Duration(*conf.delayedSampleThreshold),
+		Failures:                 writeFailures,
+		StorageHealth:            storageHealth,
+		SeriesChurn:              seriesChurn,
+		Limiter:                  limiter,
+	})
+
+	var memoryAdmission *receive.MemoryAdmission
+	if conf.memoryAdmissionRejectRatio > 0 {
+		memoryAdmission, err = receive.NewMemoryAdmission(log.With(logger, "component", "receive-memory-admission"), reg, conf.memoryAdmissionRejectRatio, conf.memoryAdmissionResumeRatio)
+		if err != nil {
+			return errors.Wrap(err, "creating memory admission")
+		}
+	}
+
+	// Only ingesting receivers hold the data of tenants.
+	var tenantDeleter receive.TenantDeleter
+	if enableIngestion {
+		tenantDeleter = dbs
+	}
+
 	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
 		Writer:               writer,
 		ListenAddress:        conf.rwAddress,
@@ -252,13 +331,36 @@ func runReceive(
 		Tracer:               tracer,
 		TLSConfig:            rwTLSConfig,
 		SplitTenantLabelName: conf.splitTenantLabelName,
+		TenantLabelName:      conf.tenantLabelName,
 		DialOpts:             dialOpts,
 		ForwardTimeout:       time.Duration(*conf.forwardTimeout),
 		MaxBackoff:           time.Duration(*conf.maxBackoff),
 		TSDBStats:            dbs,
 		Limiter:              limiter,
+		MemoryAdmission:      memoryAdmission,
 
 		AsyncForwardWorkerCount: conf.asyncForwardWorkerCount,
+		Aggregator:              aggregator,
+		WriteFailures:           writeFailures,
+		NormalizeLabels:         conf.normalizeLabels,
+		TenantDeleter:           tenantDeleter,
+		EnableTenantDeletionAPI: conf.tenantDeletionAPI,
+
+		OTLPPromoteResourceAttributes: conf.otlpPromoteResourceAttributes,
+
+		ReplicationWriteQuorum: conf.replicationWriteQuorum,
+		ReplicationMode:        receive.ReplicationMode(conf.replicationMode),
+		AsyncReplication: receive.AsyncReplicationOptions{
+			QueueSize: conf.asyncReplicationQueueSize,
+			MaxAge:    time.Duration(*conf.asyncReplicationMaxAge),
+		},
+		StorageHealth: storageHealth,
+		ForwardCircuitBreaker: receive.CircuitBreakerOptions{
+			ConsecutiveFailures: conf.forwardCircuitBreakerFailures,
+			OpenDuration:        time.Duration(*conf.forwardCircuitBreakerOpenDuration),
+			HalfOpenProbes:      conf.forwardCircuitBreakerHalfOpenProbes,
+		},
+		SeriesChurn: seriesChurn,
 	})
 
 	grpcProbe := prober.NewGRPC()
@@ -368,6 +470,8 @@ func runReceive(
 			grpcserver.WithListen(conf.grpcConfig.bindAddress),
 			grpcserver.WithGracePeriod(conf.grpcConfig.gracePeriod),
 			grpcserver.WithMaxConnAge(conf.grpcConfig.maxConnectionAge),
+			grpcserver.WithReflection(conf.grpcConfig.reflection),
+			grpcserver.WithHealthService(conf.grpcConfig.healthService),
 			grpcserver.WithTLSConfig(tlsCfg),
 		)
 
@@ -398,12 +502,45 @@ func runReceive(
 		)
 	}
 
-	if limitsConfig.AreHeadSeriesLimitsConfigured() {
+	if aggregator != nil {
+		level.Debug(logger).Log("msg", "setting up streaming aggregation")
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return aggregator.Run(ctx, webHandler.WriteAggregates)
+			}, func(err error) {
+				cancel()
+			})
+		}
+	}
+
+	switch {
+	case !limitsConfig.AreHeadSeriesLimitsConfigured():
+	case limitsConfig.IsHeadSeriesSourceHashring():
+		// Ingestors don't limit head series, nor have a hashring to gather them from.
+		if receiveMode == receive.IngestorOnly {
+			break
+		}
+		level.Info(logger).Log("msg", "setting up periodic (every 15s) head series exchange with the hashring for limiting cache")
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return runutil.Repeat(receive.HeadSeriesLimitsRefreshInterval, ctx.Done(), func() error {
+					if err := webHandler.UpdateHeadSeriesLimits(ctx); err != nil {
+						level.Error(logger).Log("msg", "failed to gather head series from the hashring", "err", err.Error())
+					}
+					return nil
+				})
+			}, func(err error) {
+				cancel()
+			})
+		}
+	default:
 		level.Info(logger).Log("msg", "setting up periodic (every 15s) meta-monitoring query for limiting cache")
 		{
 			ctx, cancel := context.WithCancel(context.Background())
 			g.Add(func() error {
-				return runutil.Repeat(15*time.Second, ctx.Done(), func() error {
+				return runutil.Repeat(receive.HeadSeriesLimitsRefreshInterval, ctx.Done(), func() error {
 					if err := limiter.HeadSeriesLimiter().QueryMetaMonitoring(ctx); err != nil {
 						level.Error(logger).Log("msg", "failed to query meta-monitoring", "err", err.Error())
 					}
@@ -415,6 +552,45 @@ func runReceive(
 		}
 	}
 
+	if memoryAdmission != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Second, ctx.Done(), func() error {
+				memoryAdmission.Check()
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if storageHealth != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Duration(*conf.storageHealthCheckInterval), ctx.Done(), func() error {
+				storageHealth.Check()
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if enableIngestion {
+		level.Debug(logger).Log("msg", "setting up periodic purge of tenants marked for deletion")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+				if err := dbs.PurgeDeletedTenants(ctx); err != nil {
+					level.Error(logger).Log("msg", "failed to purge tenants marked for deletion", "err", err)
+				}
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
 	level.Debug(logger).Log("msg", "setting up periodic tenant pruning")
 	{
 		ctx, cancel := context.WithCancel(context.Background())
@@ -475,8 +651,27 @@ func setupHashring(g *run.Group,
 	updates := make(chan []receive.HashringConfig, 1)
 	algorithm := receive.HashringAlgorithm(conf.hashringsAlgorithm)
 
-	// The Hashrings config file path is given initializing config watcher.
-	if conf.hashringsFilePath != "" {
+	// The Kubernetes service is given initializing its endpoints watcher.
+	if conf.hashringsKubernetesService != "" {
+		opts := conf.hashringsKubernetesOpts
+		opts.Service = conf.hashringsKubernetesService
+		if ns, svc, ok := strings.Cut(opts.Service, "/"); ok {
+			opts.Namespace, opts.Service = ns, svc
+		}
+		kw, err := receive.NewKubernetesHashringWatcher(log.With(logger, "component", "kubernetes-hashring-watcher"), reg, opts)
+		if err != nil {
+			close(updates)
+			return errors.Wrap(err, "failed to initialize Kubernetes hashring watcher")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return kw.Run(ctx, updates)
+		}, func(error) {
+			cancel()
+		})
+	} else if conf.hashringsFilePath != "" {
+		// The Hashrings config file path is given initializing config watcher.
 		cw, err := receive.NewConfigWatcher(log.With(logger, "component", "config-watcher"), reg, conf.hashringsFilePath, *conf.refreshInterval)
 		if err != nil {
 			return errors.Wrap(err, "failed to initialize config watcher")
@@ -803,6 +998,9 @@ type receiveConfig struct {
 	hashringsFileContent string
 	hashringsAlgorithm   string
 
+	hashringsKubernetesService string
+	hashringsKubernetesOpts    receive.KubernetesHashringOptions
+
 	refreshInterval   *model.Duration
 	endpoint          string
 	tenantHeader      string
@@ -828,23 +1026,52 @@ type receiveConfig struct {
 	tsdbEnableNativeHistograms   bool
 
 	walCompression       bool
+	walCompressionType   string
 	noLockFile           bool
 	writerInterning      bool
 	splitTenantLabelName string
+	normalizeLabels      bool
+
+	otlpPromoteResourceAttributes []string
+
+	delayedSampleThreshold *model.Duration
+	writeFailuresWindow    *model.Duration
+	seriesChurnWindow      *model.Duration
 
 	hashFunc string
 
 	ignoreBlockSize       bool
 	allowOutOfOrderUpload bool
 
-	reqLogConfig      *extflag.PathOrContent
-	relabelConfigPath *extflag.PathOrContent
+	reqLogConfig          *extflag.PathOrContent
+	relabelConfigPath     *extflag.PathOrContent
+	aggregationConfigPath *extflag.PathOrContent
+	tenantRetentionPath   *extflag.PathOrContent
 
 	writeLimitsConfig       *extflag.PathOrContent
 	storeRateLimits         store.SeriesSelectLimits
 	limitsConfigReloadTimer time.Duration
 
+	memoryAdmissionRejectRatio float64
+	memoryAdmissionResumeRatio float64
+
+	tenantDeletionAPI   bool
+	tenantDeletionDelay *model.Duration
+
 	asyncForwardWorkerCount uint
+
+	replicationMode           string
+	replicationWriteQuorum    uint64
+	asyncReplicationQueueSize int
+	asyncReplicationMaxAge    *model.Duration
+
+	storageHealthCheckInterval    *model.Duration
+	storageHealthMinFreeDiskRatio float64
+	storageHealthRetryInterval    *model.Duration
+
+	forwardCircuitBreakerFailures       int
+	forwardCircuitBreakerOpenDuration   *model.Duration
+	forwardCircuitBreakerHalfOpenProbes int
 }
 
 func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -886,14 +1113,25 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("receive.hashrings", "Alternative to 'receive.hashrings-file' flag (lower priority). Content of file that contains the hashring configuration.").PlaceHolder("<content>").StringVar(&rc.hashringsFileContent)
 
-	hashringAlgorithmsHelptext := strings.Join([]string{string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama)}, ", ")
+	hashringAlgorithmsHelptext := strings.Join([]string{string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama), string(receive.AlgorithmKetamaBoundedLoads)}, ", ")
 	cmd.Flag("receive.hashrings-algorithm", "The algorithm used when distributing series in the hashrings. Must be one of "+hashringAlgorithmsHelptext+". Will be overwritten by the tenant-specific algorithm in the hashring config.").
 		Default(string(receive.AlgorithmHashmod)).
-		EnumVar(&rc.hashringsAlgorithm, string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama))
+		EnumVar(&rc.hashringsAlgorithm, string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama), string(receive.AlgorithmKetamaBoundedLoads))
 
 	rc.refreshInterval = extkingpin.ModelDuration(cmd.Flag("receive.hashrings-file-refresh-interval", "Refresh interval to re-read the hashring configuration file. (used as a fallback)").
 		Default("5m"))
 
+	cmd.Flag("receive.hashrings-kubernetes.service", "Alternative to 'receive.hashrings-file': Kubernetes Service, as <namespace>/<name> or <name> in the namespace of the pod, whose ready endpoints are the members of a hashring of all the tenants. Its EndpointSlices are watched to update the hashring as receivers are scaled.").
+		PlaceHolder("<namespace>/<name>").StringVar(&rc.hashringsKubernetesService)
+	cmd.Flag("receive.hashrings-kubernetes.port", "Name or number of the port of the endpoints of the Kubernetes Service receiving forwarded requests.").
+		Default("10901").StringVar(&rc.hashringsKubernetesOpts.Port)
+	cmd.Flag("receive.hashrings-kubernetes.debounce", "Duration the endpoints of the Kubernetes Service have to be stable for before the hashring is updated, so that rollouts and scale events update it once.").
+		Default("10s").DurationVar(&rc.hashringsKubernetesOpts.Debounce)
+	cmd.Flag("receive.hashrings-kubernetes.min-members", "Minimum number of ready endpoints of the Kubernetes Service. While fewer endpoints are ready, the previous hashring is kept.").
+		Default("1").IntVar(&rc.hashringsKubernetesOpts.MinMembers)
+	cmd.Flag("receive.hashrings-kubernetes.api-server", "URL of the Kubernetes API server. If empty, the in-cluster configuration of the pod is used.").
+		Hidden().Default("").StringVar(&rc.hashringsKubernetesOpts.APIServer)
+
 	cmd.Flag("receive.local-endpoint", "Endpoint of local receive node. Used to identify the local node in the hashring configuration. If it's empty AND hashring configuration was provided, it means that receive will run in RoutingOnly mode.").StringVar(&rc.endpoint)
 
 	cmd.Flag("receive.tenant-header", "HTTP header to determine tenant for write requests.").Default(tenancy.DefaultTenantHeader).StringVar(&rc.tenantHeader)
@@ -914,12 +1152,39 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("receive.replication-factor", "How many times to replicate incoming write requests.").Default("1").Uint64Var(&rc.replicationFactor)
 
+	cmd.Flag("receive.replication-write-quorum", "Number of replicas a series has to be written to before acknowledging a write request, capped at the replication factor. 0 means the majority of the replicas.").
+		Default("0").Uint64Var(&rc.replicationWriteQuorum)
+
+	cmd.Flag("receive.replication-mode", "How the writes to the replicas remaining once the write quorum is reached are completed. With "+string(receive.ReplicationModeSync)+", they run until the forward timeout without being retried. With "+string(receive.ReplicationModeAsync)+", the failed ones are retried in the background from a queue per endpoint.").
+		Default(string(receive.ReplicationModeSync)).EnumVar(&rc.replicationMode, string(receive.ReplicationModeSync), string(receive.ReplicationModeAsync))
+
+	cmd.Flag("receive.async-replication.queue-size", "Maximum number of failed writes queued per endpoint to be retried with the "+string(receive.ReplicationModeAsync)+" replication mode. Writes are dropped once it is full.").
+		Default("1000").IntVar(&rc.asyncReplicationQueueSize)
+
+	rc.asyncReplicationMaxAge = extkingpin.ModelDuration(cmd.Flag("receive.async-replication.max-age", "How long failed writes are retried after the acknowledgment of their request with the "+string(receive.ReplicationModeAsync)+" replication mode.").
+		Default("10m"))
+
 	rc.forwardTimeout = extkingpin.ModelDuration(cmd.Flag("receive-forward-timeout", "Timeout for each forward request.").Default("5s").Hidden())
 
 	rc.maxBackoff = extkingpin.ModelDuration(cmd.Flag("receive-forward-max-backoff", "Maximum backoff for each forward fan-out request").Default("5s").Hidden())
 
+	cmd.Flag("receive.forward.circuit-breaker.consecutive-failures", "Number of consecutive requests forwarded to a peer which failed as unavailable or timed out after which the circuit breaker of the peer opens, failing the requests to the peer right away instead of letting them wait for the forward timeout. 0 disables the circuit breakers.").
+		Default("0").IntVar(&rc.forwardCircuitBreakerFailures)
+	rc.forwardCircuitBreakerOpenDuration = extkingpin.ModelDuration(cmd.Flag("receive.forward.circuit-breaker.open-duration", "Duration the circuit breaker of a peer stays open before letting probe requests through to the peer.").
+		Default("30s"))
+	cmd.Flag("receive.forward.circuit-breaker.half-open-probes", "Maximum number of concurrent probe requests forwarded to a peer once its circuit breaker open duration elapsed. The circuit breaker closes once a probe succeeds, and opens again once one fails.").
+		Default("1").IntVar(&rc.forwardCircuitBreakerHalfOpenProbes)
+
 	rc.relabelConfigPath = extflag.RegisterPathOrContent(cmd, "receive.relabel-config", "YAML file that contains relabeling configuration.", extflag.WithEnvSubstitution())
 
+	cmd.Flag("receive.normalize-labels", "If true, the labels of series sent with out of order labels, or with duplicate labels of the same value, are sorted and deduplicated, instead of rejecting these series. Series with duplicate label names of different values are still rejected.").
+		Default("false").BoolVar(&rc.normalizeLabels)
+
+	cmd.Flag("receive.otlp-promote-resource-attributes", "Resource attribute of the metrics received over OTLP on /api/v1/otlp/v1/metrics to promote to a label of their series, in addition to the job and instance labels derived from the service attributes. Repeat the flag to promote several attributes.").
+		PlaceHolder("<attribute>").StringsVar(&rc.otlpPromoteResourceAttributes)
+
+	rc.aggregationConfigPath = extflag.RegisterPathOrContent(cmd, "receive.aggregation-config", "YAML file that contains streaming aggregation configuration. Aggregations apply to the series received from clients, after relabeling.", extflag.WithEnvSubstitution())
+
 	rc.tsdbMinBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.min-block-duration", "Min duration for local TSDB blocks").Default("2h").Hidden())
 
 	rc.tsdbMaxBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.max-block-duration", "Max duration for local TSDB blocks").Default("2h").Hidden())
@@ -940,10 +1205,16 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("tsdb.allow-overlapping-blocks", "Allow overlapping blocks, which in turn enables vertical compaction and vertical query merge. Does not do anything, enabled all the time.").Default("false").BoolVar(&rc.tsdbAllowOverlappingBlocks)
 
+	rc.tenantRetentionPath = extflag.RegisterPathOrContent(cmd, "tsdb.tenant-retention-config", "YAML file that contains the local retention of tenants, overriding --tsdb.retention and --tsdb.max-retention-bytes for them. "+
+		"For more details, refer to the Tenant lifecycle management section in the Receive documentation: https://thanos.io/tip/components/receive.md/#tenant-lifecycle-management", extflag.WithEnvSubstitution())
+
 	cmd.Flag("tsdb.max-retention-bytes", "Maximum number of bytes that can be stored for blocks. A unit is required, supported units: B, KB, MB, GB, TB, PB, EB. Ex: \"512MB\". Based on powers-of-2, so 1KB is 1024B.").Default("0").BytesVar(&rc.tsdbMaxBytes)
 
 	cmd.Flag("tsdb.wal-compression", "Compress the tsdb WAL.").Default("true").BoolVar(&rc.walCompression)
 
+	cmd.Flag("tsdb.wal-compression-type", "Compression algorithm of the WAL of the TSDB of each tenant, if --tsdb.wal-compression is enabled. zstd compresses the WAL better than snappy, at the cost of more CPU.").
+		Default(string(wlog.CompressionSnappy)).EnumVar(&rc.walCompressionType, string(wlog.CompressionSnappy), string(wlog.CompressionZstd))
+
 	cmd.Flag("tsdb.no-lockfile", "Do not create lockfile in TSDB data directory. In any case, the lockfiles will be deleted on next startup.").Default("false").BoolVar(&rc.noLockFile)
 
 	cmd.Flag("tsdb.max-exemplars",
@@ -953,13 +1224,15 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("0").Int64Var(&rc.tsdbMaxExemplars)
 
 	cmd.Flag("tsdb.write-queue-size",
-		"[EXPERIMENTAL] Enables configuring the size of the chunk write queue used in the head chunks mapper. "+
+		"[EXPERIMENTAL] Enables configuring the size of the chunk write queue used in the head chunks mapper of the TSDB of each tenant. "+
+			"Head chunks are then written to disk in the background instead of on the write path, the queue holding up to this number of chunks. "+
 			"A queue size of zero (default) disables this feature entirely.").
-		Default("0").Hidden().Int64Var(&rc.tsdbWriteQueueSize)
+		Default("0").Int64Var(&rc.tsdbWriteQueueSize)
 
 	cmd.Flag("tsdb.memory-snapshot-on-shutdown",
-		"[EXPERIMENTAL] Enables feature to snapshot in-memory chunks on shutdown for faster restarts.").
-		Default("false").Hidden().BoolVar(&rc.tsdbMemorySnapshotOnShutdown)
+		"[EXPERIMENTAL] Enables feature to snapshot in-memory chunks on shutdown for faster restarts. "+
+			"The head of the TSDB of each tenant is then restored from its snapshot instead of replaying its whole WAL.").
+		Default("false").BoolVar(&rc.tsdbMemorySnapshotOnShutdown)
 
 	cmd.Flag("tsdb.enable-native-histograms",
 		"[EXPERIMENTAL] Enables the ingestion of native histograms.").
@@ -969,6 +1242,18 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"[EXPERIMENTAL] Enables string interning in receive writer, for more optimized memory usage.").
 		Default("false").Hidden().BoolVar(&rc.writerInterning)
 
+	rc.delayedSampleThreshold = extkingpin.ModelDuration(cmd.Flag("receive.delayed-sample-threshold",
+		"Age of samples, compared to the time they are ingested at, above which they are counted in the per-tenant thanos_receive_delayed_samples_total metric. 0s disables it.").
+		Default("0s"))
+
+	rc.writeFailuresWindow = extkingpin.ModelDuration(cmd.Flag("receive.write-failures-window",
+		"Duration the write failures of a tenant with the same cause are reported by the /api/v1/status/write_failures endpoint, after they were last seen. 0s disables tracking write failures.").
+		Default("1h"))
+
+	rc.seriesChurnWindow = extkingpin.ModelDuration(cmd.Flag("receive.series-churn-window",
+		"Window the series created in the heads of tenants are counted over by metric name, to report the metrics with the highest churn on the /api/v1/status/cardinality endpoint. Series are counted over the last one to two windows. 0s disables counting them.").
+		Default("1h"))
+
 	cmd.Flag("hash-func", "Specify which hash function to use when calculating the hashes of produced files. If no function has been specified, it does not happen. This permits avoiding downloading some files twice albeit at some performance cost. Possible values are: \"\", \"SHA256\".").
 		Default("").EnumVar(&rc.hashFunc, "SHA256", "")
 
@@ -985,13 +1270,33 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 	rc.writeLimitsConfig = extflag.RegisterPathOrContent(cmd, "receive.limits-config", "YAML file that contains limit configuration.", extflag.WithEnvSubstitution(), extflag.WithHidden())
 	cmd.Flag("receive.limits-config-reload-timer", "Minimum amount of time to pass for the limit configuration to be reloaded. Helps to avoid excessive reloads.").
 		Default("1s").Hidden().DurationVar(&rc.limitsConfigReloadTimer)
+
+	cmd.Flag("receive.memory-admission.reject-ratio", "Experimental: ratio of the Go memory limit (GOMEMLIMIT) at which remote write requests are rejected with 503, until the live heap goes back below the resume ratio of the limit. Gives clients back pressure before the Go runtime spends most of its time garbage collecting. 0 disables it.").
+		Default("0").FloatVar(&rc.memoryAdmissionRejectRatio)
+	cmd.Flag("receive.memory-admission.resume-ratio", "Experimental: ratio of the Go memory limit (GOMEMLIMIT) below which the live heap must go for remote write requests to be admitted again, once rejected. Must not be greater than --receive.memory-admission.reject-ratio.").
+		Default("0.8").FloatVar(&rc.memoryAdmissionResumeRatio)
+
+	cmd.Flag("receive.tenant-deletion.enable-api", "Experimental: serve the admin API to mark tenants for deletion on /api/v1/admin/tenants/<tenant>/deletion. The writes of tenants marked for deletion are rejected, and their local data is purged once the deletion delay elapsed.").
+		Default("false").BoolVar(&rc.tenantDeletionAPI)
+	rc.tenantDeletionDelay = extkingpin.ModelDuration(cmd.Flag("receive.tenant-deletion.delay",
+		"Duration after which the data of tenants marked for deletion is purged. Their deletion can be cancelled until then.").
+		Default("24h"))
+
+	rc.storageHealthCheckInterval = extkingpin.ModelDuration(cmd.Flag("receive.storage-health.check-interval",
+		"Experimental: interval of the self-check of the local storage. Enables the degraded mode, rejecting the writes of tenants with 503 on disk full, WAL corruption or head chunks corruption while still serving their data, instead of failing or crash looping. The failures are reported on /api/v1/status/storage_health. 0s disables it.").
+		Default("0s"))
+	cmd.Flag("receive.storage-health.min-free-disk-ratio", "Experimental: ratio of free space of the disk of the data directory below which the writes of all tenants are rejected, until the disk has more free space again. 0 only rejects them once writes failed on a full disk.").
+		Default("0.02").FloatVar(&rc.storageHealthMinFreeDiskRatio)
+	rc.storageHealthRetryInterval = extkingpin.ModelDuration(cmd.Flag("receive.storage-health.retry-interval",
+		"Experimental: duration the writes of tenants in degraded mode are rejected for, before being accepted again to probe whether their storage recovered.").
+		Default("5m"))
 }
 
 // determineMode returns the ReceiverMode that this receiver is configured to run in.
 // This is used to configure this Receiver's forwarding and ingesting behavior at runtime.
 func (rc *receiveConfig) determineMode() receive.ReceiverMode {
 	// Has the user provided some kind of hashring configuration?
-	hashringSpecified := rc.hashringsFileContent != "" || rc.hashringsFilePath != ""
+	hashringSpecified := rc.hashringsFileContent != "" || rc.hashringsFilePath != "" || rc.hashringsKubernetesService != ""
 	// Has the user specified the --receive.local-endpoint flag?
 	localEndpointSpecified := rc.endpoint != ""
 
@@ -45,7 +45,6 @@ import (
 	"github.com/thanos-io/objstore/client"
 	objstoretracing "github.com/thanos-io/objstore/tracing/opentracing"
 	"github.com/thanos-io/promql-engine/execution/parse"
-	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/alert"
 	v1 "github.com/thanos-io/thanos/pkg/api/rule"
@@ -66,6 +65,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/promclient"
 	"github.com/thanos-io/thanos/pkg/query"
 	thanosrules "github.com/thanos-io/thanos/pkg/rules"
+	"github.com/thanos-io/thanos/pkg/rules/remotewrite"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
@@ -95,20 +95,31 @@ type ruleConfig struct {
 	alertQueryURL          *url.URL
 	alertRelabelConfigYAML []byte
 
+	alertHistory               bool
+	alertHistoryMaxTransitions int
+
 	rwConfig *extflag.PathOrContent
 
 	resendDelay       time.Duration
 	evalInterval      time.Duration
+	queryOffset       time.Duration
 	outageTolerance   time.Duration
 	forGracePeriod    time.Duration
+	concurrentEvals   int64
 	ruleFiles         []string
 	objStoreConfig    *extflag.PathOrContent
+	ruleAPIDir        string
+	ruleAPIObjStore   *extflag.PathOrContent
 	dataDir           string
 	lset              labels.Labels
 	ignoredLabelNames []string
 	storeRateLimits   store.SeriesSelectLimits
 
 	extendedFunctionsEnabled bool
+
+	shardingPeers         []string
+	shardingSelf          string
+	shardingCheckInterval time.Duration
 }
 
 type Expression struct {
@@ -145,10 +156,27 @@ func registerRule(app *extkingpin.App) {
 	cmd.Flag("data-dir", "data directory").Default("data/").StringVar(&conf.dataDir)
 	cmd.Flag("rule-file", "Rule files that should be used by rule manager. Can be in glob format (repeated). Note that rules are not automatically detected, use SIGHUP or do HTTP POST /-/reload to re-read them.").
 		Default("rules/").StringsVar(&conf.ruleFiles)
+	cmd.Flag("rule-api.dir", "Directory of the rule files managed through the rule group management API, one file per namespace. "+
+		"Setting it enables the GET, POST and DELETE /api/v1/rules/{namespace}/{group} endpoints, which hot-reload rules on changes.").
+		Default("").StringVar(&conf.ruleAPIDir)
+	cmd.Flag("rule.sharding.peers", "Base HTTP URLs of all the ruler replicas rule groups are sharded across, including this one (repeated). Every rule group is evaluated by a single healthy replica, groups of unhealthy replicas are re-assigned to the healthy ones. Empty disables sharding.").
+		PlaceHolder("<url>").StringsVar(&conf.shardingPeers)
+	cmd.Flag("rule.sharding.self", "Base HTTP URL of this ruler replica, as listed in --rule.sharding.peers.").
+		PlaceHolder("<url>").StringVar(&conf.shardingSelf)
+	cmd.Flag("rule.sharding.check-interval", "Interval of the readiness checks of the ruler replicas of --rule.sharding.peers.").
+		Default("10s").DurationVar(&conf.shardingCheckInterval)
 	cmd.Flag("resend-delay", "Minimum amount of time to wait before resending an alert to Alertmanager.").
 		Default("1m").DurationVar(&conf.resendDelay)
 	cmd.Flag("eval-interval", "The default evaluation interval to use.").
 		Default("1m").DurationVar(&conf.evalInterval)
+	cmd.Flag("rule-query-offset", "The default offset of the evaluation timestamp of rule queries, for rule groups without query_offset. Useful to evaluate rules with data ingested with delay, e.g. through remote write.").
+		Default("0s").DurationVar(&conf.queryOffset)
+	cmd.Flag("rule-concurrent-evals", "Maximum number of rules evaluated concurrently, across all rule groups. Only rules which neither depend on, nor are depended on by, other rules of their group are evaluated concurrently, the other ones are evaluated sequentially. 1 disables concurrent evaluations.").
+		Default("1").Int64Var(&conf.concurrentEvals)
+	cmd.Flag("alert.history", "Record the state transitions of alerts, from inactive to pending, pending to firing and back to inactive, as samples of the ALERTS_TRANSITIONS series, stored like the series of recording rules, i.e. uploaded to object storage or remote written. The most recent transitions are also served by the /api/v1/alerts/history endpoint.").
+		Default("false").BoolVar(&conf.alertHistory)
+	cmd.Flag("alert.history.max-transitions", "Maximum number of most recent alert state transitions kept in memory for the /api/v1/alerts/history endpoint, if --alert.history is set.").
+		Default("10000").IntVar(&conf.alertHistoryMaxTransitions)
 	cmd.Flag("for-outage-tolerance", "Max time to tolerate prometheus outage for restoring \"for\" state of alert.").
 		Default("1h").DurationVar(&conf.outageTolerance)
 	cmd.Flag("for-grace-period", "Minimum duration between alert and restored \"for\" state. This is maintained only for alerts with configured \"for\" time greater than grace period.").
@@ -164,6 +192,7 @@ func registerRule(app *extkingpin.App) {
 	conf.rwConfig = extflag.RegisterPathOrContent(cmd, "remote-write.config", "YAML config for the remote-write configurations, that specify servers where samples should be sent to (see https://prometheus.io/docs/prometheus/latest/configuration/configuration/#remote_write). This automatically enables stateless mode for ruler and no series will be stored in the ruler's TSDB. If an empty config (or file) is provided, the flag is ignored and ruler is run with its own TSDB.", extflag.WithEnvSubstitution())
 
 	conf.objStoreConfig = extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
+	conf.ruleAPIObjStore = extkingpin.RegisterCommonObjStoreFlags(cmd, "-rule-api", false, "The rule files of the rule group management API are persisted to it, and synced from it on startup and reloads. Requires --rule-api.dir.")
 
 	reqLogConfig := extkingpin.RegisterRequestLoggingFlags(cmd)
 
@@ -185,6 +214,8 @@ func registerRule(app *extkingpin.App) {
 			RetentionDuration: int64(time.Duration(*tsdbRetention) / time.Millisecond),
 			NoLockfile:        *noLockFile,
 			WALCompression:    wlog.ParseCompressionType(*walCompression, string(wlog.CompressionSnappy)),
+			// Recording rules over native histograms produce native histograms.
+			EnableNativeHistograms: true,
 		}
 
 		agentOpts := &agent.Options{
@@ -192,6 +223,13 @@ func registerRule(app *extkingpin.App) {
 			NoLockfile:     *noLockFile,
 		}
 
+		if conf.alertHistoryMaxTransitions < 0 {
+			return errors.Errorf("--alert.history.max-transitions must not be negative, got %d", conf.alertHistoryMaxTransitions)
+		}
+		if conf.concurrentEvals < 1 {
+			return errors.Errorf("--rule-concurrent-evals must be at least 1, got %d", conf.concurrentEvals)
+		}
+
 		// Parse and check query configuration.
 		lookupQueries := map[string]struct{}{}
 		for _, q := range conf.query.addrs {
@@ -437,9 +475,11 @@ func runRule(
 			nil,
 			nil,
 			nil,
+			nil,
 			dialOpts,
 			5*time.Minute,
 			5*time.Second,
+			0,
 		)
 
 		// Periodically update the GRPC addresses from query config by resolving them using DNS SD if necessary.
@@ -473,12 +513,26 @@ func runRule(
 	}
 
 	if len(rwCfgYAML) > 0 {
-		var rwCfg struct {
-			RemoteWriteConfigs []*config.RemoteWriteConfig `yaml:"remote_write,omitempty"`
-		}
-		if err := yaml.Unmarshal(rwCfgYAML, &rwCfg); err != nil {
+		rwCfgs, err := remotewrite.LoadConfigs(rwCfgYAML)
+		if err != nil {
 			return errors.Wrapf(err, "failed to parse remote write config %v", string(rwCfgYAML))
 		}
+		// Series are sent with Remote Write 1.0 by the Prometheus remote storage, and with Remote Write 2.0 by
+		// Thanos, as the vendored remote storage does not support it.
+		var (
+			rwCfgsV1 []*config.RemoteWriteConfig
+			rwCfgsV2 []*remotewrite.Config
+		)
+		for _, c := range rwCfgs {
+			if !c.SendNativeHistograms {
+				level.Warn(logger).Log("msg", "remote write config does not send native histograms, native histograms produced by recording rules will be dropped", "url", c.URL.Redacted(), "hint", "set send_native_histograms: true")
+			}
+			if c.IsV2() {
+				rwCfgsV2 = append(rwCfgsV2, c)
+				continue
+			}
+			rwCfgsV1 = append(rwCfgsV1, &c.RemoteWriteConfig)
+		}
 
 		// flushDeadline is set to 1m, but it is for metadata watcher only so not used here.
 		remoteStore := remote.NewStorage(logger, reg, func() (int64, error) {
@@ -488,15 +542,32 @@ func runRule(
 			GlobalConfig: config.GlobalConfig{
 				ExternalLabels: labelsTSDBToProm(conf.lset),
 			},
-			RemoteWriteConfigs: rwCfg.RemoteWriteConfigs,
+			RemoteWriteConfigs: rwCfgsV1,
 		}); err != nil {
 			return errors.Wrap(err, "applying config to remote storage")
 		}
+		remoteStoreV2, err := remotewrite.NewWriteV2Storage(logger, reg, conf.dataDir, labelsTSDBToProm(conf.lset), rwCfgsV2)
+		if err != nil {
+			return errors.Wrap(err, "create Remote Write 2.0 storage")
+		}
 
-		agentDB, err = agent.Open(logger, reg, remoteStore, conf.dataDir, agentOpts)
+		agentDB, err = agent.Open(logger, reg, remotewrite.WALTruncationStorage(logger, remoteStore, conf.dataDir, rwCfgs), conf.dataDir, agentOpts)
 		if err != nil {
 			return errors.Wrap(err, "start remote write agent db")
 		}
+		// Send the series as soon as they are written to the WAL, instead of polling it.
+		agentDB.SetWriteNotified(remotewrite.WriteNotifiers{remoteStore, remoteStoreV2})
+		{
+			done := make(chan struct{})
+			g.Add(func() error {
+				remoteStoreV2.Start()
+				<-done
+				remoteStoreV2.Stop()
+				return nil
+			}, func(error) {
+				close(done)
+			})
+		}
 		fanoutStore := storage.NewFanout(logger, agentDB, remoteStore)
 		appendable = fanoutStore
 		// Use a separate queryable to restore the ALERTS firing states.
@@ -585,8 +656,10 @@ func runRule(
 	}
 
 	var (
-		ruleMgr *thanosrules.Manager
-		alertQ  = alert.NewQueue(logger, reg, 10000, 100, labelsTSDBToProm(conf.lset), conf.alertmgr.alertExcludeLabels, alertRelabelConfigs)
+		ruleMgr      *thanosrules.Manager
+		sharder      *thanosrules.Sharder
+		alertHistory *thanosrules.AlertHistory
+		alertQ       = alert.NewQueue(logger, reg, 10000, 100, labelsTSDBToProm(conf.lset), conf.alertmgr.alertExcludeLabels, alertRelabelConfigs)
 	)
 	{
 		if conf.extendedFunctionsEnabled {
@@ -623,6 +696,20 @@ func runRule(
 			alertQ.Push(res)
 		}
 
+		evaluations := thanosrules.NewQueryEvaluations()
+		mgrOpts := []thanosrules.ManagerOption{thanosrules.WithQueryEvaluations(evaluations)}
+		if conf.alertHistory {
+			alertHistory = thanosrules.NewAlertHistory(logger, reg, appendable, conf.alertHistoryMaxTransitions)
+			mgrOpts = append(mgrOpts, thanosrules.WithAlertHistory(alertHistory))
+		}
+		if len(conf.shardingPeers) > 0 {
+			sharder, err = thanosrules.NewSharder(log.With(logger, "component", "rule-sharder"), reg, conf.shardingSelf, conf.shardingPeers, &http.Client{Timeout: conf.shardingCheckInterval})
+			if err != nil {
+				return errors.Wrap(err, "create rule sharder")
+			}
+			mgrOpts = append(mgrOpts, thanosrules.WithGroupFilter(sharder.Owns))
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
 		logger = log.With(logger, "component", "rules")
 		ruleMgr = thanosrules.NewManager(
@@ -638,13 +725,20 @@ func runRule(
 				ResendDelay:     conf.resendDelay,
 				OutageTolerance: conf.outageTolerance,
 				ForGracePeriod:  conf.forGracePeriod,
+				DefaultRuleQueryOffset: func() time.Duration {
+					return conf.queryOffset
+				},
+				// The group goroutine evaluates rules too, only the other ones are concurrency slots.
+				ConcurrentEvalsEnabled: conf.concurrentEvals > 1,
+				MaxConcurrentEvals:     conf.concurrentEvals - 1,
 			},
-			queryFuncCreator(logger, queryClients, promClients, grpcEndpointSet, metrics.duplicatedQuery, metrics.ruleEvalWarnings, conf.query.httpMethod, conf.query.doNotAddThanosParams),
+			queryFuncCreator(logger, queryClients, promClients, grpcEndpointSet, metrics.duplicatedQuery, metrics.ruleEvalWarnings, evaluations, conf.query.httpMethod, conf.query.doNotAddThanosParams),
 			conf.lset,
 			// In our case the querying URL is the external URL because in Prometheus
 			// --web.external-url points to it i.e. it points at something where the user
 			// could execute the alert or recording rule's expression and get results.
 			conf.alertQueryURL.String(),
+			mgrOpts...,
 		)
 
 		// Schedule rule manager that evaluates rules.
@@ -683,22 +777,38 @@ func runRule(
 
 	// Handle reload and termination interrupts.
 	reloadWebhandler := make(chan chan error)
+	managedRules, err := newManagedRules(logger, reg, conf, reloadWebhandler)
+	if err != nil {
+		return err
+	}
+	ruleFiles := conf.ruleFiles
+	if managedRules != nil {
+		ruleFiles = append(append([]string{}, conf.ruleFiles...), managedRules.FilesPattern())
+	}
 	{
 		ctx, cancel := context.WithCancel(context.Background())
+		reload := func() error {
+			if managedRules != nil {
+				if err := managedRules.Sync(ctx); err != nil {
+					level.Warn(logger).Log("msg", "failed to sync managed rules, using the local rule files", "err", err)
+				}
+			}
+			return reloadRules(logger, ruleFiles, ruleMgr, conf.evalInterval, metrics)
+		}
 		g.Add(func() error {
 			// Initialize rules.
-			if err := reloadRules(logger, conf.ruleFiles, ruleMgr, conf.evalInterval, metrics); err != nil {
+			if err := reload(); err != nil {
 				level.Error(logger).Log("msg", "initialize rules failed", "err", err)
 				return err
 			}
 			for {
 				select {
 				case <-reloadSignal:
-					if err := reloadRules(logger, conf.ruleFiles, ruleMgr, conf.evalInterval, metrics); err != nil {
+					if err := reload(); err != nil {
 						level.Error(logger).Log("msg", "reload rules by sighup failed", "err", err)
 					}
 				case reloadMsg := <-reloadWebhandler:
-					err := reloadRules(logger, conf.ruleFiles, ruleMgr, conf.evalInterval, metrics)
+					err := reload()
 					if err != nil {
 						level.Error(logger).Log("msg", "reload rules by webhandler failed", "err", err)
 					}
@@ -712,6 +822,30 @@ func runRule(
 		})
 	}
 
+	// Re-assign rule groups whenever the set of healthy ruler replicas changes.
+	if sharder != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(conf.shardingCheckInterval, ctx.Done(), func() error {
+				if !sharder.CheckPeers(ctx) {
+					return nil
+				}
+				reloadMsg := make(chan error)
+				select {
+				case reloadWebhandler <- reloadMsg:
+				case <-ctx.Done():
+					return nil
+				}
+				if err := <-reloadMsg; err != nil {
+					level.Error(logger).Log("msg", "reload rules after ruler peers change failed", "err", err)
+				}
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -731,6 +865,8 @@ func runRule(
 		grpcserver.WithListen(conf.grpc.bindAddress),
 		grpcserver.WithGracePeriod(conf.grpc.gracePeriod),
 		grpcserver.WithGracePeriod(conf.grpc.maxConnectionAge),
+		grpcserver.WithReflection(conf.grpc.reflection),
+		grpcserver.WithHealthService(conf.grpc.healthService),
 		grpcserver.WithTLSConfig(tlsCfg),
 	}
 	infoOptions := []info.ServerOptionFunc{info.WithRulesInfoFunc()}
@@ -803,7 +939,7 @@ func runRule(
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
 		ui.NewRuleUI(logger, reg, ruleMgr, conf.alertQueryURL.String(), conf.web.externalPrefix, conf.web.prefixHeaderName).Register(router, ins)
 
-		api := v1.NewRuleAPI(logger, reg, thanosrules.NewGRPCClient(ruleMgr), ruleMgr, conf.web.disableCORS, flagsMap)
+		api := v1.NewRuleAPI(logger, reg, thanosrules.NewGRPCClient(ruleMgr), ruleMgr, managedRules, alertHistory, conf.web.disableCORS, flagsMap)
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
 		srv := httpserver.New(logger, reg, comp, httpProbe,
@@ -902,6 +1038,7 @@ func queryFuncCreator(
 	grpcEndpointSet *query.EndpointSet,
 	duplicatedQuery prometheus.Counter,
 	ruleEvalWarnings *prometheus.CounterVec,
+	evaluations *thanosrules.QueryEvaluations,
 	httpMethod string,
 	doNotAddThanosParams bool,
 ) func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
@@ -922,6 +1059,10 @@ func queryFuncCreator(
 		}
 
 		return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+			var (
+				lastEndpoint string
+				lastErr      error
+			)
 			for _, i := range rand.Perm(len(queriers)) {
 				promClient := promClients[i]
 				endpoints := thanosrules.RemoveDuplicateQueryEndpoints(logger, duplicatedQuery, queriers[i].Endpoints())
@@ -937,13 +1078,14 @@ func queryFuncCreator(
 
 					if err != nil {
 						level.Error(logger).Log("err", err, "query", qs)
+						lastEndpoint, lastErr = endpoints[i].Host, err
 						continue
 					}
 					if len(warns) > 0 {
 						ruleEvalWarnings.WithLabelValues(strings.ToLower(partialResponseStrategy.String())).Inc()
-						// TODO(bwplotka): Propagate those to UI, probably requires changing rule manager code ):
 						level.Warn(logger).Log("warnings", strings.Join(warns, ", "), "query", qs)
 					}
+					evaluations.Observe(partialResponseStrategy, qs, t, warns)
 					return v, nil
 				}
 			}
@@ -955,11 +1097,13 @@ func queryFuncCreator(
 					expr, err := extpromql.ParseExpr(qs)
 					if err != nil {
 						level.Error(logger).Log("err", err, "query", qs)
+						lastEndpoint, lastErr = queryAPIClients[i].GetAddress(), err
 						continue
 					}
 					q, err := e.NewInstantQuery(ctx, nil, expr, t)
 					if err != nil {
 						level.Error(logger).Log("err", err, "query", qs)
+						lastEndpoint, lastErr = queryAPIClients[i].GetAddress(), err
 						continue
 					}
 
@@ -967,22 +1111,30 @@ func queryFuncCreator(
 					v, err := result.Vector()
 					if err != nil {
 						level.Error(logger).Log("err", err, "query", qs)
+						lastEndpoint, lastErr = queryAPIClients[i].GetAddress(), err
 						continue
 					}
 
+					var warnings []string
 					if len(result.Warnings) > 0 {
 						ruleEvalWarnings.WithLabelValues(strings.ToLower(partialResponseStrategy.String())).Inc()
-						warnings := make([]string, 0, len(result.Warnings))
+						warnings = make([]string, 0, len(result.Warnings))
 						for _, w := range result.Warnings {
 							warnings = append(warnings, w.Error())
 						}
 						level.Warn(logger).Log("warnings", strings.Join(warnings, ", "), "query", qs)
 					}
+					evaluations.Observe(partialResponseStrategy, qs, t, warnings)
 
 					return v, nil
 				}
 			}
-			return nil, errors.Errorf("no query API server reachable")
+			err := errors.Errorf("no query API server reachable")
+			if lastErr == nil {
+				lastErr = err
+			}
+			evaluations.ObserveError(partialResponseStrategy, qs, t, lastEndpoint, lastErr)
+			return nil, err
 		}
 	}
 }
@@ -1006,6 +1158,35 @@ func addDiscoveryGroups(g *run.Group, c *clientconfig.HTTPClient, interval time.
 	})
 }
 
+// newManagedRules returns the rules managed through the rule group management API, nil if it is disabled.
+// Changes are applied by reloading rules through the given channel.
+func newManagedRules(logger log.Logger, reg prometheus.Registerer, conf ruleConfig, reloadWebhandler chan chan error) (*thanosrules.ManagedRules, error) {
+	bktConfContentYaml, err := conf.ruleAPIObjStore.Content()
+	if err != nil {
+		return nil, err
+	}
+	if conf.ruleAPIDir == "" {
+		if len(bktConfContentYaml) > 0 {
+			return nil, errors.New("--objstore-rule-api.config requires --rule-api.dir")
+		}
+		return nil, nil
+	}
+
+	var bkt objstore.Bucket
+	if len(bktConfContentYaml) > 0 {
+		b, err := client.NewBucket(logger, bktConfContentYaml, component.Rule.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "create rule API bucket client")
+		}
+		bkt = objstoretracing.WrapWithTraces(objstore.WrapWithMetrics(b, extprom.WrapRegistererWithPrefix("thanos_rule_api_", reg), b.Name()))
+	}
+	return thanosrules.NewManagedRules(logger, conf.ruleAPIDir, bkt, func() error {
+		reloadMsg := make(chan error)
+		reloadWebhandler <- reloadMsg
+		return <-reloadMsg
+	})
+}
+
 func reloadRules(logger log.Logger,
 	ruleFiles []string,
 	ruleMgr *thanosrules.Manager,
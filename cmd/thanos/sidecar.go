@@ -345,6 +345,8 @@ func runSidecar(
 			grpcserver.WithListen(conf.grpc.bindAddress),
 			grpcserver.WithGracePeriod(conf.grpc.gracePeriod),
 			grpcserver.WithMaxConnAge(conf.grpc.maxConnectionAge),
+			grpcserver.WithReflection(conf.grpc.reflection),
+			grpcserver.WithHealthService(conf.grpc.healthService),
 			grpcserver.WithTLSConfig(tlsCfg),
 		)
 
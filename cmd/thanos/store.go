@@ -40,6 +40,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/info/infopb"
 	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/pool"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
@@ -60,33 +61,41 @@ const (
 type syncStrategy string
 
 const (
-	concurrentDiscovery syncStrategy = "concurrent"
-	recursiveDiscovery  syncStrategy = "recursive"
+	concurrentDiscovery  syncStrategy = "concurrent"
+	recursiveDiscovery   syncStrategy = "recursive"
+	bucketIndexDiscovery syncStrategy = "bucket-index"
 )
 
 type storeConfig struct {
 	indexCacheConfigs           extflag.PathOrContent
+	chunksCacheConfigs          extflag.PathOrContent
 	objStoreConfig              extflag.PathOrContent
+	archiveObjStoreConfig       extflag.PathOrContent
 	dataDir                     string
 	cacheIndexHeader            bool
 	grpcConfig                  grpcConfig
 	httpConfig                  httpConfig
 	indexCacheSizeBytes         units.Base2Bytes
 	chunkPoolSize               units.Base2Bytes
+	chunkPoolConfig             chunkPoolConfig
 	estimatedMaxSeriesSize      uint64
 	estimatedMaxChunkSize       uint64
 	seriesBatchSize             int
 	storeRateLimits             store.SeriesSelectLimits
 	maxDownloadedBytes          units.Base2Bytes
+	seriesMemoryQuota           units.Base2Bytes
 	maxConcurrency              int
 	component                   component.StoreAPI
 	debugLogging                bool
 	syncInterval                time.Duration
 	blockListStrategy           string
+	blockDiscoveryConcurrency   int
+	bucketIndexMaxStalePeriod   time.Duration
 	blockSyncConcurrency        int
 	blockMetaFetchConcurrency   int
 	filterConf                  *store.FilterConfig
 	selectorRelabelConf         extflag.PathOrContent
+	tenantBlockSelectorsConf    extflag.PathOrContent
 	advertiseCompatibilityLabel bool
 	consistencyDelay            commonmodel.Duration
 	ignoreDeletionMarksDelay    commonmodel.Duration
@@ -98,9 +107,33 @@ type storeConfig struct {
 	reqLogConfig                *extflag.PathOrContent
 	lazyIndexReaderEnabled      bool
 	lazyIndexReaderIdleTimeout  time.Duration
+	lazyIndexReaderMaxLoaded    int
+	lazyIndexReaderMaxBytes     units.Base2Bytes
 	lazyExpandedPostingsEnabled bool
 
+	aggregationPushdownEnabled bool
+
+	seriesResponsePoolingEnabled bool
+
+	verticalMergeFunc string
+
+	timeFilteringEnabled bool
+
+	postingsForMatchersCacheTTL        time.Duration
+	postingsForMatchersCacheMaxEntries int
+
 	indexHeaderLazyDownloadStrategy string
+
+	blockHeatmapTopN int
+
+	bucketReadConcurrency store.BucketReadConcurrencyConfig
+}
+
+type chunkPoolConfig struct {
+	minBucketSize    units.Base2Bytes
+	maxBucketSize    units.Base2Bytes
+	bucketFactor     float64
+	adaptiveInterval time.Duration
 }
 
 func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -122,6 +155,11 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 		extflag.WithEnvSubstitution(),
 	)
 
+	sc.chunksCacheConfigs = *extflag.RegisterPathOrContent(cmd, "store.chunks-cache.config",
+		"YAML file that contains chunks cache configuration. Chunks aren't cached if not set. See format details: https://thanos.io/tip/components/store.md/#chunks-cache",
+		extflag.WithEnvSubstitution(),
+	)
+
 	sc.cachingBucketConfig = *extflag.RegisterPathOrContent(hidden.HiddenCmdClause(cmd), "store.caching-bucket.config",
 		"YAML that contains configuration for caching bucket. Experimental feature, with high risk of changes. See format details: https://thanos.io/tip/components/store.md/#caching-bucket",
 		extflag.WithEnvSubstitution(),
@@ -129,6 +167,14 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("chunk-pool-size", "Maximum size of concurrently allocatable bytes reserved strictly to reuse for chunks in memory.").
 		Default("2GB").BytesVar(&sc.chunkPoolSize)
+	cmd.Flag("store.chunk-pool.min-bucket-size", "Size of the smallest bucket of byte slices of the chunk pool. Requests for fewer bytes are given slices of this size.").
+		Default("64KiB").BytesVar(&sc.chunkPoolConfig.minBucketSize)
+	cmd.Flag("store.chunk-pool.max-bucket-size", "Size of the largest bucket of byte slices of the chunk pool. Requests for more bytes are allocated directly, and not pooled.").
+		Default("64MiB").BytesVar(&sc.chunkPoolConfig.maxBucketSize)
+	cmd.Flag("store.chunk-pool.bucket-factor", "Factor between the sizes of consecutive buckets of the chunk pool. Must be greater than 1.").
+		Default("2").Float64Var(&sc.chunkPoolConfig.bucketFactor)
+	cmd.Flag("store.chunk-pool.adaptive-interval", "Interval at which the sizes of the buckets of the chunk pool are adapted to the sizes requested since, within the minimum and maximum bucket sizes: the smallest bucket fits the 10th percentile of the requested sizes, and the largest one their 99th percentile. 0s disables adaptive sizing.").
+		Default("0s").DurationVar(&sc.chunkPoolConfig.adaptiveInterval)
 
 	cmd.Flag("store.grpc.touched-series-limit", "DEPRECATED: use store.limits.request-series.").Default("0").Uint64Var(&sc.storeRateLimits.SeriesPerRequest)
 	cmd.Flag("store.grpc.series-sample-limit", "DEPRECATED: use store.limits.request-samples.").Default("0").Uint64Var(&sc.storeRateLimits.SamplesPerRequest)
@@ -137,19 +183,30 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"Maximum amount of downloaded (either fetched or touched) bytes in a single Series/LabelNames/LabelValues call. The Series call fails if this limit is exceeded. 0 means no limit.").
 		Default("0").BytesVar(&sc.maxDownloadedBytes)
 
+	cmd.Flag("store.grpc.series-memory-limit",
+		"Maximum amount of memory a single Series call holds at once out of the chunk and series pools. The Series call fails with a resource exhausted error naming the query if this limit is exceeded, instead of evicting the memory of the other calls. Unlike the downloaded bytes limit, memory given back to the pools during the call no longer counts towards it. 0 means no limit.").
+		Default("0").BytesVar(&sc.seriesMemoryQuota)
+
 	cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of concurrent Series calls.").Default("20").IntVar(&sc.maxConcurrency)
 
 	sc.component = component.Store
 
 	sc.objStoreConfig = *extkingpin.RegisterCommonObjStoreFlags(cmd, "", true)
+	sc.archiveObjStoreConfig = *extkingpin.RegisterCommonObjStoreFlags(cmd, "-archive", false, "Blocks are also loaded from it, typically downsampled blocks archived to it by the compactor. Blocks present in both buckets are loaded from the main bucket.")
 
 	cmd.Flag("sync-block-duration", "Repeat interval for syncing the blocks between local and remote view.").
 		Default("15m").DurationVar(&sc.syncInterval)
 
-	strategies := strings.Join([]string{string(concurrentDiscovery), string(recursiveDiscovery)}, ", ")
-	cmd.Flag("block-discovery-strategy", "One of "+strategies+". When set to concurrent, stores will concurrently issue one call per directory to discover active blocks in the bucket. The recursive strategy iterates through all objects in the bucket, recursively traversing into each directory. This avoids N+1 calls at the expense of having slower bucket iterations.").
+	strategies := strings.Join([]string{string(concurrentDiscovery), string(recursiveDiscovery), string(bucketIndexDiscovery)}, ", ")
+	cmd.Flag("block-discovery-strategy", "One of "+strategies+". When set to concurrent, stores will concurrently issue one call per directory to discover active blocks in the bucket. The recursive strategy iterates through all objects in the bucket, recursively traversing into each directory. This avoids N+1 calls at the expense of having slower bucket iterations. The bucket-index strategy reads the blocks, their meta and deletion marks from the bucket index updated by the compactor, falling back to the concurrent strategy if the bucket index is missing or stale.").
 		Default(string(concurrentDiscovery)).StringVar(&sc.blockListStrategy)
 
+	cmd.Flag("block-discovery-concurrency", "Number of goroutines to use when checking the meta.json files of the blocks discovered with the concurrent strategy. Must be equal or greater than 1.").
+		Default(strconv.Itoa(block.DefaultConcurrentListerConcurrency)).IntVar(&sc.blockDiscoveryConcurrency)
+
+	cmd.Flag("bucket-index.max-stale-period", "Maximum age of the bucket index, since it was last updated by the compactor, for it to be used by the bucket-index block discovery strategy. 0s disables the check.").
+		Default("1h").DurationVar(&sc.bucketIndexMaxStalePeriod)
+
 	cmd.Flag("block-sync-concurrency", "Number of goroutines to use when constructing index-cache.json blocks from object storage. Must be equal or greater than 1.").
 		Default("20").IntVar(&sc.blockSyncConcurrency)
 
@@ -178,6 +235,10 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	sc.selectorRelabelConf = *extkingpin.RegisterSelectorRelabelFlags(cmd)
 
+	sc.tenantBlockSelectorsConf = *extflag.RegisterPathOrContent(cmd, "store.tenant-block-selectors",
+		"YAML file that contains the relabel configs selecting the blocks the requests of every tenant, as set in the tenant header, can touch. See format details: https://thanos.io/tip/components/store.md/#tenant-block-selectors",
+	)
+
 	cmd.Flag("store.index-header-posting-offsets-in-mem-sampling", "Controls what is the ratio of postings offsets store will hold in memory. "+
 		"Larger value will keep less offsets, which will increase CPU cycles needed for query touching those postings. It's meant for setups that want low baseline memory pressure and where less traffic is expected. "+
 		"On the contrary, smaller value will increase baseline memory usage, but improve latency slightly. 1 will keep all in memory. Default value is the same as in Prometheus which gives a good balance.").
@@ -199,13 +260,53 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("store.index-header-lazy-reader-idle-timeout", "If index-header lazy reader is enabled and this idle timeout setting is > 0, memory map-ed index-headers will be automatically released after 'idle timeout' inactivity.").
 		Hidden().Default("5m").DurationVar(&sc.lazyIndexReaderIdleTimeout)
 
+	cmd.Flag("store.index-header-lazy-reader-max-loaded", "If index-header lazy reader is enabled and this setting is > 0, at most this many index-headers are kept memory map-ed, the least recently used ones are released first.").
+		Default("0").IntVar(&sc.lazyIndexReaderMaxLoaded)
+
+	cmd.Flag("store.index-header-lazy-reader-max-loaded-bytes", "If index-header lazy reader is enabled and this setting is > 0, memory map-ed index-headers are released, least recently used first, while their total size exceeds it.").
+		Default("0").BytesVar(&sc.lazyIndexReaderMaxBytes)
+
 	cmd.Flag("store.enable-lazy-expanded-postings", "If true, Store Gateway will estimate postings size and try to lazily expand postings if it downloads less data than expanding all postings.").
 		Default("false").BoolVar(&sc.lazyExpandedPostingsEnabled)
 
+	cmd.Flag("store.postings-for-matchers-cache.ttl", "TTL of the expanded postings cached in memory by every block by set of matchers, so that queries repeating the same selectors skip the index lookups. 0 disables the cache.").
+		Default("0s").DurationVar(&sc.postingsForMatchersCacheTTL)
+
+	cmd.Flag("store.postings-for-matchers-cache.max-entries", "Maximum number of sets of matchers whose expanded postings are cached by every block. 0 means no limit.").
+		Default("1000").IntVar(&sc.postingsForMatchersCacheMaxEntries)
+
+	cmd.Flag("store.enable-aggregation-pushdown", "Experimental: if true, Store Gateway evaluates the aggregation hints of Series requests selecting only downsampled blocks, sending one aggregated series per group instead of the series themselves.").
+		Default("false").BoolVar(&sc.aggregationPushdownEnabled)
+
+	cmd.Flag("store.enable-series-response-pooling", "[EXPERIMENTAL] If true, Store Gateway allocates the labels and chunks of the series it sends out of pools, and releases them as soon as they are sent instead of once the Series request is done, reducing garbage collection under concurrent heavy queries.").
+		Default("false").BoolVar(&sc.seriesResponsePoolingEnabled)
+
+	cmd.Flag("store.enable-time-filtering", "Experimental: if true, Store Gateway slices the chunks overlapping the start or end of the time range of Series requests, so that only samples within the range are sent, and advertises it for queriers to skip filtering them again. "+
+		"It reduces the bytes sent for short ranges over long chunks, at the cost of re-encoding the sliced chunks.").
+		Default("false").BoolVar(&sc.timeFilteringEnabled)
+
+	cmd.Flag("store.vertical-merge-func", "Experimental. Algorithm merging the overlapping raw chunks of the series of vertically overlapping blocks, e.g. of buckets without vertical compaction, instead of returning their duplicated samples. "+
+		"Possible values are: \"\", \""+store.VerticalMergeChain+"\", \""+store.VerticalMergePenalty+"\". If no value is specified, overlapping chunks are returned as is. "+
+		"When set to "+store.VerticalMergeChain+", samples are deduplicated 1:1 like by vertical compaction, which suits blocks with precisely the same samples like produced by Receiver replication. "+
+		"When set to "+store.VerticalMergePenalty+", the penalty based deduplication algorithm is used, which suits blocks of Prometheus replicas.").
+		Default("").EnumVar(&sc.verticalMergeFunc, "", store.VerticalMergeChain, store.VerticalMergePenalty)
+
 	cmd.Flag("store.index-header-lazy-download-strategy", "Strategy of how to download index headers lazily. Supported values: eager, lazy. If eager, always download index header during initial load. If lazy, download index header during query time.").
 		Default(string(indexheader.EagerDownloadStrategy)).
 		EnumVar(&sc.indexHeaderLazyDownloadStrategy, string(indexheader.EagerDownloadStrategy), string(indexheader.LazyDownloadStrategy))
 
+	cmd.Flag("store.block-heatmap-metrics-top-n", "Number of most queried blocks to export the query heat of as metrics, i.e. the number of Series calls and bytes touched and fetched from object storage since they were loaded. The query heat of all loaded blocks is served by the /api/v1/blocks/heatmap endpoint. 0 disables the metrics.").
+		Default("0").IntVar(&sc.blockHeatmapTopN)
+
+	cmd.Flag("store.bucket-read-concurrency.max", "Maximum number of concurrent reads of objects and object ranges from the object storage. "+
+		"The limit is adapted between store.bucket-read-concurrency.min and this value: it is decreased when reads fail or their time to first byte is above store.bucket-read-concurrency.latency-threshold, and increased back while they succeed, so that the concurrency of reads tunes itself to the object storage. "+
+		"Reads over the limit wait for in-flight ones to complete. Set to 0 to disable.").
+		Default("0").IntVar(&sc.bucketReadConcurrency.MaxConcurrency)
+	cmd.Flag("store.bucket-read-concurrency.min", "Minimum number of concurrent reads from the object storage the adaptive concurrency limit is decreased to.").
+		Default("1").IntVar(&sc.bucketReadConcurrency.MinConcurrency)
+	cmd.Flag("store.bucket-read-concurrency.latency-threshold", "Time to first byte above which reads from the object storage decrease the adaptive concurrency limit, as if the object storage was overloaded. Set to 0 to only decrease it on failed reads.").
+		Default("0").DurationVar(&sc.bucketReadConcurrency.LatencyThreshold)
+
 	cmd.Flag("web.disable", "Disable Block Viewer UI.").Default("false").BoolVar(&sc.disableWeb)
 
 	cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the bucket web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos bucket web UI to be served behind a reverse proxy that strips a URL sub-path.").
@@ -315,6 +416,14 @@ func runStore(
 	}
 	insBkt := objstoretracing.WrapWithTraces(objstore.WrapWithMetrics(bkt, extprom.WrapRegistererWithPrefix("thanos_", reg), bkt.Name()))
 
+	if err := conf.bucketReadConcurrency.Validate(); err != nil {
+		return errors.Wrap(err, "validate bucket read concurrency")
+	}
+	if conf.bucketReadConcurrency.Enabled() {
+		// Limit the reads sent to the object storage, not the ones served by the caching bucket.
+		insBkt = store.NewAdaptiveConcurrencyBucket(insBkt, conf.bucketReadConcurrency, reg)
+	}
+
 	cachingBucketConfigYaml, err := conf.cachingBucketConfig.Content()
 	if err != nil {
 		return errors.Wrap(err, "get caching bucket configuration")
@@ -359,16 +468,42 @@ func runStore(
 		return errors.Wrap(err, "create index cache")
 	}
 
-	var blockLister block.Lister
+	chunksCacheContentYaml, err := conf.chunksCacheConfigs.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of chunks cache configuration")
+	}
+	var chunksCache storecache.ChunksCache
+	if len(chunksCacheContentYaml) > 0 {
+		chunksCache, err = storecache.NewChunksCache(logger, chunksCacheContentYaml, reg)
+		if err != nil {
+			return errors.Wrap(err, "create chunks cache")
+		}
+	}
+
+	if conf.blockDiscoveryConcurrency < 1 {
+		return errors.Errorf("block discovery concurrency must be equal or greater than 1 (got %v)", conf.blockDiscoveryConcurrency)
+	}
+
+	var (
+		blockLister       block.Lister
+		bucketIndexLister *block.BucketIndexLister
+	)
 	switch syncStrategy(conf.blockListStrategy) {
 	case concurrentDiscovery:
-		blockLister = block.NewConcurrentLister(logger, insBkt)
+		blockLister = block.NewConcurrentLister(logger, insBkt).WithConcurrency(conf.blockDiscoveryConcurrency)
 	case recursiveDiscovery:
 		blockLister = block.NewRecursiveLister(logger, insBkt)
+	case bucketIndexDiscovery:
+		fallback := block.NewConcurrentLister(logger, insBkt).WithConcurrency(conf.blockDiscoveryConcurrency)
+		bucketIndexLister = block.NewBucketIndexLister(logger, insBkt, fallback, conf.bucketIndexMaxStalePeriod, reg)
+		blockLister = bucketIndexLister
 	default:
 		return errors.Errorf("unknown sync strategy %s", conf.blockListStrategy)
 	}
 	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, insBkt, time.Duration(conf.ignoreDeletionMarksDelay), conf.blockMetaFetchConcurrency)
+	if bucketIndexLister != nil {
+		ignoreDeletionMarkFilter.WithBucketIndex(bucketIndexLister)
+	}
 	metaFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, insBkt, blockLister, dataDir, extprom.WrapRegistererWithPrefix("thanos_", reg),
 		[]block.MetadataFilter{
 			block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
@@ -381,6 +516,19 @@ func runStore(
 		return errors.Wrap(err, "meta fetcher")
 	}
 
+	archiveConfContentYaml, err := conf.archiveObjStoreConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of archive object store configuration")
+	}
+	var archiveBkt objstore.InstrumentedBucket
+	if len(archiveConfContentYaml) > 0 {
+		b, err := client.NewBucket(logger, archiveConfContentYaml, conf.component.String())
+		if err != nil {
+			return errors.Wrap(err, "create archive bucket client")
+		}
+		archiveBkt = objstoretracing.WrapWithTraces(objstore.WrapWithMetrics(b, extprom.WrapRegistererWithPrefix("thanos_archive_", reg), b.Name()))
+	}
+
 	// Limit the concurrency on queries against the Thanos store.
 	if conf.maxConcurrency < 0 {
 		return errors.Errorf("max concurrency value cannot be lower than 0 (got %v)", conf.maxConcurrency)
@@ -388,10 +536,40 @@ func runStore(
 
 	queriesGate := gate.New(extprom.WrapRegistererWithPrefix("thanos_bucket_store_series_", reg), int(conf.maxConcurrency), gate.Queries)
 
-	chunkPool, err := store.NewDefaultChunkBytesPool(uint64(conf.chunkPoolSize))
+	if conf.chunkPoolConfig.minBucketSize > conf.chunkPoolConfig.maxBucketSize {
+		return errors.Errorf("chunk pool minimum bucket size %v cannot be greater than its maximum bucket size %v", conf.chunkPoolConfig.minBucketSize, conf.chunkPoolConfig.maxBucketSize)
+	}
+	if conf.chunkPoolConfig.bucketFactor <= 1 {
+		return errors.Errorf("chunk pool bucket factor must be greater than 1 (got %v)", conf.chunkPoolConfig.bucketFactor)
+	}
+	chunkPool, err := pool.NewBucketedBytes(
+		int(conf.chunkPoolConfig.minBucketSize),
+		int(conf.chunkPoolConfig.maxBucketSize),
+		conf.chunkPoolConfig.bucketFactor,
+		uint64(conf.chunkPoolSize),
+	)
 	if err != nil {
 		return errors.Wrap(err, "create chunk pool")
 	}
+	chunkPool.WithMetrics(extprom.WrapRegistererWithPrefix("thanos_bucket_store_chunk_", reg))
+	if conf.chunkPoolConfig.adaptiveInterval > 0 {
+		chunkPool.WithAdaptiveSizing()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(conf.chunkPoolConfig.adaptiveInterval, ctx.Done(), func() error {
+				chunkPool.Adapt()
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
+	verticalMergeFunc, err := store.NewVerticalChunkSeriesMergeFunc(conf.verticalMergeFunc)
+	if err != nil {
+		return err
+	}
 
 	options := []store.BucketStoreOption{
 		store.WithLogger(logger),
@@ -424,14 +602,56 @@ func runStore(
 			return conf.estimatedMaxChunkSize
 		}),
 		store.WithLazyExpandedPostings(conf.lazyExpandedPostingsEnabled),
+		store.WithPostingsForMatchersCache(conf.postingsForMatchersCacheTTL, conf.postingsForMatchersCacheMaxEntries),
+		store.WithAggregationPushdown(conf.aggregationPushdownEnabled),
+		store.WithSeriesResponsePooling(conf.seriesResponsePoolingEnabled),
+		store.WithVerticalMerge(verticalMergeFunc),
+		store.WithTimeFiltering(conf.timeFilteringEnabled),
+		store.WithBlockHeatmapMetrics(conf.blockHeatmapTopN),
+		store.WithSeriesMemoryQuota(uint64(conf.seriesMemoryQuota)),
 		store.WithIndexHeaderLazyDownloadStrategy(
 			indexheader.IndexHeaderLazyDownloadStrategy(conf.indexHeaderLazyDownloadStrategy).StrategyToDownloadFunc(),
 		),
 	}
 
+	if conf.lazyIndexReaderMaxLoaded > 0 {
+		options = append(options, store.WithIndexHeaderEvictionPolicies(indexheader.NewLRUEvictionPolicy(conf.lazyIndexReaderMaxLoaded)))
+	}
+	if conf.lazyIndexReaderMaxBytes > 0 {
+		options = append(options, store.WithIndexHeaderEvictionPolicies(indexheader.NewSizeEvictionPolicy(int64(conf.lazyIndexReaderMaxBytes))))
+	}
+
 	if conf.debugLogging {
 		options = append(options, store.WithDebugLogging())
 	}
+	if chunksCache != nil {
+		options = append(options, store.WithChunksCache(chunksCache))
+	}
+	tenantBlockSelectorsYaml, err := conf.tenantBlockSelectorsConf.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of tenant block selectors configuration")
+	}
+	if len(tenantBlockSelectorsYaml) > 0 {
+		tenantBlockSelectors, err := store.ParseTenantBlockSelectors(tenantBlockSelectorsYaml)
+		if err != nil {
+			return err
+		}
+		options = append(options, store.WithTenantBlockSelectors(tenantBlockSelectors))
+	}
+	if archiveBkt != nil {
+		archiveMetaFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, archiveBkt,
+			block.NewConcurrentLister(logger, archiveBkt).WithConcurrency(conf.blockDiscoveryConcurrency), "", extprom.WrapRegistererWithPrefix("thanos_archive_", reg),
+			[]block.MetadataFilter{
+				block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
+				block.NewLabelShardedMetaFilter(relabelConfig),
+				block.NewConsistencyDelayMetaFilter(logger, time.Duration(conf.consistencyDelay), extprom.WrapRegistererWithPrefix("thanos_archive_", reg)),
+				block.NewIgnoreDeletionMarkFilter(logger, archiveBkt, time.Duration(conf.ignoreDeletionMarksDelay), conf.blockMetaFetchConcurrency),
+			})
+		if err != nil {
+			return errors.Wrap(err, "archive meta fetcher")
+		}
+		options = append(options, store.WithArchiveBucket(archiveBkt, archiveMetaFetcher))
+	}
 
 	bs, err := store.NewBucketStore(
 		insBkt,
@@ -459,6 +679,9 @@ func runStore(
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			defer runutil.CloseWithLogOnErr(logger, insBkt, "bucket client")
+			if archiveBkt != nil {
+				defer runutil.CloseWithLogOnErr(logger, archiveBkt, "archive bucket client")
+			}
 
 			level.Info(logger).Log("msg", "initializing bucket store")
 			begin := time.Now()
@@ -508,6 +731,7 @@ func runStore(
 					SupportsSharding:             true,
 					SupportsWithoutReplicaLabels: true,
 					TsdbInfos:                    bs.TSDBInfos(),
+					SupportsTimeFiltering:        bs.SupportsTimeFiltering(),
 				}, nil
 			}
 			return nil, errors.New("Not ready")
@@ -528,6 +752,8 @@ func runStore(
 			grpcserver.WithListen(conf.grpcConfig.bindAddress),
 			grpcserver.WithGracePeriod(conf.grpcConfig.gracePeriod),
 			grpcserver.WithMaxConnAge(conf.grpcConfig.maxConnectionAge),
+			grpcserver.WithReflection(conf.grpcConfig.reflection),
+			grpcserver.WithHealthService(conf.grpcConfig.healthService),
 			grpcserver.WithTLSConfig(tlsCfg),
 		)
 
@@ -552,6 +778,8 @@ func runStore(
 			// Configure Request Logging for HTTP calls.
 			logMiddleware := logging.NewHTTPServerMiddleware(logger, httpLogOpts...)
 			api := blocksAPI.NewBlocksAPI(logger, conf.webConfig.disableCORS, conf.label, flagsMap, insBkt)
+			api.SetBlockHeatmap(bs.BlockHeatmap)
+			api.SetStoreBlocks(bs.LoadedBlocks)
 			api.Register(r.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
 			metaFetcher.UpdateOnChange(func(blocks []metadata.Meta, err error) {
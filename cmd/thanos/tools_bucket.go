@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/csv"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -57,11 +59,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/replay"
 	"github.com/thanos-io/thanos/pkg/replicate"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/ui"
 	"github.com/thanos-io/thanos/pkg/verifier"
 )
@@ -109,8 +113,10 @@ type bucketVerifyConfig struct {
 }
 
 type bucketLsConfig struct {
-	output        string
-	excludeDelete bool
+	output              string
+	excludeDelete       bool
+	annotate            bool
+	storeGatewaysConfig *extflag.PathOrContent
 }
 
 type bucketWebConfig struct {
@@ -151,6 +157,7 @@ type bucketRetentionConfig struct {
 	consistencyDelay     time.Duration
 	blockSyncConcurrency int
 	deleteDelay          time.Duration
+	dryRun               bool
 }
 
 type bucketMarkBlockConfig struct {
@@ -160,6 +167,21 @@ type bucketMarkBlockConfig struct {
 	removeMarker bool
 }
 
+type bucketReplayConfig struct {
+	blockIDs           []string
+	tmpDir             string
+	remoteWriteURL     string
+	timeout            time.Duration
+	maxRetries         int
+	tenant             string
+	tenantHeader       string
+	tenantLabelName    string
+	defaultTenantID    string
+	withExternalLabels bool
+	samplesPerRequest  int
+	samplesPerSecond   float64
+}
+
 type bucketUploadBlocksConfig struct {
 	path   string
 	labels []string
@@ -184,6 +206,9 @@ func (tbc *bucketLsConfig) registerBucketLsFlag(cmd extkingpin.FlagClause) *buck
 		Short('o').Default("").StringVar(&tbc.output)
 	cmd.Flag("exclude-delete", "Exclude blocks marked for deletion.").
 		Default("false").BoolVar(&tbc.excludeDelete)
+	cmd.Flag("annotate", "Annotate blocks with the store gateways loading them, the store gateways caching their index header and the blocks they overlap with.").
+		Default("false").BoolVar(&tbc.annotate)
+	tbc.storeGatewaysConfig = extflag.RegisterPathOrContent(cmd, "annotate.store-gateways-config", "YAML file that contains the store gateways blocks are annotated with, i.e. their time range, selector relabel config and data directory. See format details: https://thanos.io/tip/components/tools.md/#bucket-ls", extflag.WithEnvSubstitution())
 	return tbc
 }
 
@@ -280,6 +305,25 @@ func (tbc *bucketRetentionConfig) registerBucketRetentionFlag(cmd extkingpin.Fla
 		Default("30m").DurationVar(&tbc.consistencyDelay)
 	cmd.Flag("block-sync-concurrency", "Number of goroutines to use when syncing block metadata from object storage.").
 		Default("20").IntVar(&tbc.blockSyncConcurrency)
+	cmd.Flag("dry-run", "Only log the blocks exceeding their retention, instead of marking them for deletion.").
+		Default("false").BoolVar(&tbc.dryRun)
+
+	return tbc
+}
+
+func (tbc *bucketReplayConfig) registerBucketReplayFlag(cmd extkingpin.FlagClause) *bucketReplayConfig {
+	cmd.Flag("id", "ID (ULID) of the blocks to replay (repeated flag). If none is specified, all the raw blocks not marked for deletion are replayed.").StringsVar(&tbc.blockIDs)
+	cmd.Flag("tmp.dir", "Working directory for temporary files").Default(filepath.Join(os.TempDir(), "thanos-replay")).StringVar(&tbc.tmpDir)
+	cmd.Flag("remote-write.url", "URL of the remote write endpoint of the receive hashring to replay the blocks into.").Required().StringVar(&tbc.remoteWriteURL)
+	cmd.Flag("remote-write.timeout", "Timeout of a single remote write request.").Default("30s").DurationVar(&tbc.timeout)
+	cmd.Flag("remote-write.max-retries", "Number of times a remote write request failing with a recoverable error (5xx or 429 status code) is retried before the replay is aborted.").Default("10").IntVar(&tbc.maxRetries)
+	cmd.Flag("tenant", "Tenant to replay all the blocks for. If not specified, the tenant of a block is taken from its --receive.tenant-label-name external label.").Default("").StringVar(&tbc.tenant)
+	cmd.Flag("receive.tenant-header", "HTTP header the receive hashring determines the tenant of write requests with.").Default(tenancy.DefaultTenantHeader).StringVar(&tbc.tenantHeader)
+	cmd.Flag("receive.tenant-label-name", "External label holding the tenant of a block.").Default(tenancy.DefaultTenantLabel).StringVar(&tbc.tenantLabelName)
+	cmd.Flag("receive.default-tenant-id", "Tenant to replay the blocks without tenant external label for.").Default(tenancy.DefaultTenant).StringVar(&tbc.defaultTenantID)
+	cmd.Flag("with-external-labels", "Add the external labels of a block, except the tenant label, to its replayed series.").Default("false").BoolVar(&tbc.withExternalLabels)
+	cmd.Flag("samples-per-request", "Maximum number of samples sent in a single remote write request.").Default("5000").IntVar(&tbc.samplesPerRequest)
+	cmd.Flag("samples-per-second", "Maximum number of samples replayed per second for every tenant. 0 means no limit.").Default("0").Float64Var(&tbc.samplesPerSecond)
 
 	return tbc
 }
@@ -306,6 +350,7 @@ func registerBucket(app extkingpin.AppClause) {
 	registerBucketRewrite(cmd, objStoreConfig)
 	registerBucketRetention(cmd, objStoreConfig)
 	registerBucketUploadBlocks(cmd, objStoreConfig)
+	registerBucketReplay(cmd, objStoreConfig)
 }
 
 func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
@@ -437,44 +482,65 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
 
+		var gateways []*storeGateway
+		if tbc.annotate {
+			gatewaysContentYaml, err := tbc.storeGatewaysConfig.Content()
+			if err != nil {
+				return err
+			}
+			if gateways, err = parseStoreGatewaysConfig(gatewaysContentYaml); err != nil {
+				return errors.Wrap(err, "parse store gateways config")
+			}
+		}
+
 		var (
 			format     = tbc.output
 			objects    = 0
-			printBlock func(m *metadata.Meta) error
+			printBlock func(b *lsBlock) error
 		)
 
 		switch format {
 		case "":
-			printBlock = func(m *metadata.Meta) error {
-				fmt.Fprintln(os.Stdout, m.ULID.String())
+			printBlock = func(b *lsBlock) error {
+				if b.Annotations != nil {
+					fmt.Fprintf(os.Stdout, "%s %s\n", b.ULID, b.Annotations)
+					return nil
+				}
+				fmt.Fprintln(os.Stdout, b.ULID.String())
 				return nil
 			}
 		case "wide":
-			printBlock = func(m *metadata.Meta) error {
-				minTime := time.Unix(m.MinTime/1000, 0)
-				maxTime := time.Unix(m.MaxTime/1000, 0)
+			printBlock = func(b *lsBlock) error {
+				minTime := time.Unix(b.MinTime/1000, 0)
+				maxTime := time.Unix(b.MaxTime/1000, 0)
 
-				if _, err = fmt.Fprintf(os.Stdout, "%s -- %s - %s Diff: %s, Compaction: %d, Downsample: %d, Source: %s\n",
-					m.ULID, minTime.Format(time.RFC3339), maxTime.Format(time.RFC3339), maxTime.Sub(minTime),
-					m.Compaction.Level, m.Thanos.Downsample.Resolution, m.Thanos.Source); err != nil {
+				if _, err = fmt.Fprintf(os.Stdout, "%s -- %s - %s Diff: %s, Compaction: %d, Downsample: %d, Source: %s",
+					b.ULID, minTime.Format(time.RFC3339), maxTime.Format(time.RFC3339), maxTime.Sub(minTime),
+					b.Compaction.Level, b.Thanos.Downsample.Resolution, b.Thanos.Source); err != nil {
 					return err
 				}
-				return nil
+				if b.Annotations != nil {
+					if _, err = fmt.Fprintf(os.Stdout, ", %s", b.Annotations); err != nil {
+						return err
+					}
+				}
+				_, err = fmt.Fprintln(os.Stdout, "")
+				return err
 			}
 		case "json":
 			enc := json.NewEncoder(os.Stdout)
 			enc.SetIndent("", "\t")
 
-			printBlock = func(m *metadata.Meta) error {
-				return enc.Encode(&m)
+			printBlock = func(b *lsBlock) error {
+				return enc.Encode(b)
 			}
 		default:
 			tmpl, err := template.New("").Parse(format)
 			if err != nil {
 				return errors.Wrap(err, "invalid template")
 			}
-			printBlock = func(m *metadata.Meta) error {
-				if err := tmpl.Execute(os.Stdout, &m); err != nil {
+			printBlock = func(b *lsBlock) error {
+				if err := tmpl.Execute(os.Stdout, b); err != nil {
 					return errors.Wrap(err, "execute template")
 				}
 				fmt.Fprintln(os.Stdout, "")
@@ -487,9 +553,16 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 			return err
 		}
 
-		for _, meta := range metas {
+		var annotations map[ulid.ULID]*blockAnnotations
+		if tbc.annotate {
+			if annotations, err = annotateBlocks(ctx, logger, metas, gateways); err != nil {
+				return errors.Wrap(err, "annotate blocks")
+			}
+		}
+
+		for id, meta := range metas {
 			objects++
-			if err := printBlock(meta); err != nil {
+			if err := printBlock(&lsBlock{Meta: meta, Annotations: annotations[id]}); err != nil {
 				return errors.Wrap(err, "iter")
 			}
 		}
@@ -498,6 +571,158 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 	})
 }
 
+// storeGatewayConfig describes a store gateway, so that blocks can be annotated with whether it serves them.
+type storeGatewayConfig struct {
+	Name string `yaml:"name"`
+	// MinTime and MaxTime are the --min-time and --max-time flags of the store gateway.
+	MinTime string `yaml:"min_time"`
+	MaxTime string `yaml:"max_time"`
+	// SelectorRelabelConfig is the --selector.relabel-config of the store gateway.
+	SelectorRelabelConfig []*relabel.Config `yaml:"selector_relabel_config"`
+	// DataDir is the --data-dir of the store gateway, used to tell whether it caches the index header of blocks.
+	DataDir string `yaml:"data_dir"`
+}
+
+type storeGateway struct {
+	name    string
+	filters []block.MetadataFilter
+	dataDir string
+}
+
+func parseStoreGatewaysConfig(contentYaml []byte) ([]*storeGateway, error) {
+	var configs []storeGatewayConfig
+	dec := yaml.NewDecoder(bytes.NewReader(contentYaml))
+	dec.KnownFields(true)
+	if err := dec.Decode(&configs); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "parsing store gateways configuration")
+	}
+
+	gateways := make([]*storeGateway, 0, len(configs))
+	for i, c := range configs {
+		if c.Name == "" {
+			return nil, errors.Errorf("store gateway %d: empty name", i)
+		}
+		minTime, maxTime := c.MinTime, c.MaxTime
+		if minTime == "" {
+			minTime = "0000-01-01T00:00:00Z"
+		}
+		if maxTime == "" {
+			maxTime = "9999-12-31T23:59:59Z"
+		}
+		var mint, maxt model.TimeOrDurationValue
+		if err := mint.Set(minTime); err != nil {
+			return nil, errors.Wrapf(err, "store gateway %s: parse min_time", c.Name)
+		}
+		if err := maxt.Set(maxTime); err != nil {
+			return nil, errors.Wrapf(err, "store gateway %s: parse max_time", c.Name)
+		}
+		for _, cfg := range c.SelectorRelabelConfig {
+			if _, ok := block.SelectorSupportedRelabelActions[cfg.Action]; !ok {
+				return nil, errors.Errorf("store gateway %s: unsupported relabel action: %v", c.Name, cfg.Action)
+			}
+		}
+		gateways = append(gateways, &storeGateway{
+			name: c.Name,
+			filters: []block.MetadataFilter{
+				block.NewTimePartitionMetaFilter(mint, maxt),
+				block.NewLabelShardedMetaFilter(c.SelectorRelabelConfig),
+			},
+			dataDir: c.DataDir,
+		})
+	}
+	return gateways, nil
+}
+
+// blockAnnotations describes which components serve a block at query time.
+type blockAnnotations struct {
+	// StoreGateways are the store gateways loading the block.
+	StoreGateways []string `json:"storeGateways"`
+	// CachedBy are the store gateways having the index header of the block in their data directory.
+	CachedBy []string `json:"cachedBy"`
+	// Overlaps are the blocks of the same compaction group overlapping with the block.
+	Overlaps []ulid.ULID `json:"overlaps"`
+}
+
+func (a *blockAnnotations) String() string {
+	list := func(s []string) string {
+		if len(s) == 0 {
+			return "-"
+		}
+		return strings.Join(s, ",")
+	}
+	overlaps := make([]string, 0, len(a.Overlaps))
+	for _, id := range a.Overlaps {
+		overlaps = append(overlaps, id.String())
+	}
+	return fmt.Sprintf("Store gateways: %s, Cached by: %s, Overlaps: %s", list(a.StoreGateways), list(a.CachedBy), list(overlaps))
+}
+
+// lsBlock is a block printed by bucket ls, with its annotations if enabled.
+type lsBlock struct {
+	*metadata.Meta
+	Annotations *blockAnnotations `json:"annotations,omitempty"`
+}
+
+// annotateBlocks returns the annotations of the given blocks with the store gateways serving them and their overlaps.
+func annotateBlocks(ctx context.Context, logger log.Logger, metas map[ulid.ULID]*metadata.Meta, gateways []*storeGateway) (map[ulid.ULID]*blockAnnotations, error) {
+	annotations := make(map[ulid.ULID]*blockAnnotations, len(metas))
+	for id := range metas {
+		annotations[id] = &blockAnnotations{StoreGateways: []string{}, CachedBy: []string{}, Overlaps: []ulid.ULID{}}
+	}
+
+	// Filters only report metrics, which are not needed here.
+	synced := promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+	modified := promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{Name: "modified"}, []string{"modified"})
+	for _, gw := range gateways {
+		loaded := make(map[ulid.ULID]*metadata.Meta, len(metas))
+		for id, m := range metas {
+			loaded[id] = m
+		}
+		for _, f := range gw.filters {
+			if err := f.Filter(ctx, loaded, synced, modified); err != nil {
+				return nil, errors.Wrapf(err, "filter blocks of store gateway %s", gw.name)
+			}
+		}
+		for id := range loaded {
+			annotations[id].StoreGateways = append(annotations[id].StoreGateways, gw.name)
+		}
+
+		if gw.dataDir == "" {
+			continue
+		}
+		for id := range metas {
+			if _, err := os.Stat(filepath.Join(gw.dataDir, id.String(), block.IndexHeaderFilename)); err == nil {
+				annotations[id].CachedBy = append(annotations[id].CachedBy, gw.name)
+			}
+		}
+	}
+
+	groups := map[string][]tsdb.BlockMeta{}
+	for _, m := range metas {
+		groups[m.Thanos.GroupKey()] = append(groups[m.Thanos.GroupKey()], m.BlockMeta)
+	}
+	for k, groupMetas := range groups {
+		sort.Slice(groupMetas, func(i, j int) bool {
+			return groupMetas[i].MinTime < groupMetas[j].MinTime
+		})
+		for interval, overlapping := range tsdb.OverlappingBlocks(groupMetas) {
+			level.Warn(logger).Log("msg", "found overlapped blocks", "group", k, "interval", interval, "blocks", len(overlapping))
+			for _, m := range overlapping {
+				for _, o := range overlapping {
+					if o.ULID != m.ULID {
+						annotations[m.ULID].Overlaps = append(annotations[m.ULID].Overlaps, o.ULID)
+					}
+				}
+			}
+		}
+	}
+	for _, a := range annotations {
+		sort.Slice(a.Overlaps, func(i, j int) bool { return a.Overlaps[i].Compare(a.Overlaps[j]) < 0 })
+		a.Overlaps = slices.Compact(a.Overlaps)
+	}
+	return annotations, nil
+}
+
 func registerBucketInspect(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command("inspect", "Inspect all blocks in the bucket in detailed, table-like way.")
 
@@ -1339,6 +1564,7 @@ func registerBucketRetention(app extkingpin.AppClause, objStoreConfig *extflag.P
 		Default("0d").SetValue(&retentionFiveMin)
 	cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").
 		Default("0d").SetValue(&retentionOneHr)
+	retentionPolicies := extflag.RegisterPathOrContent(cmd, "retention.policies-config", "YAML file that contains the retention policies of the blocks whose external labels match their selectors, overriding the retention of their resolution. See format details: https://thanos.io/tip/components/compact.md/#retention-policies", extflag.WithEnvSubstitution())
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		retentionByResolution := map[compact.ResolutionLevel]time.Duration{
 			compact.ResolutionLevelRaw: time.Duration(retentionRaw),
@@ -1356,6 +1582,20 @@ func registerBucketRetention(app extkingpin.AppClause, objStoreConfig *extflag.P
 			level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
 		}
 
+		retentionPoliciesYaml, err := retentionPolicies.Content()
+		if err != nil {
+			return errors.Wrap(err, "get content of retention policies")
+		}
+		var policies []compact.RetentionPolicy
+		if len(retentionPoliciesYaml) > 0 {
+			if policies, err = compact.ParseRetentionPolicies(retentionPoliciesYaml); err != nil {
+				return errors.Wrap(err, "parse retention policies")
+			}
+		}
+		for _, p := range policies {
+			level.Info(logger).Log("msg", "retention policy of matching blocks is enabled", "selector", p.Selector, "duration", time.Duration(p.Retention))
+		}
+
 		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
@@ -1429,9 +1669,13 @@ func registerBucketRetention(app extkingpin.AppClause, objStoreConfig *extflag.P
 
 		level.Warn(logger).Log("msg", "GLOBAL COMPACTOR SHOULD __NOT__ BE RUNNING ON THE SAME BUCKET")
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, insBkt, sy.Metas(), retentionByResolution, stubCounter); err != nil {
+		expired, err := compact.ApplyRetentionPolicies(ctx, logger, insBkt, sy.Metas(), policies, retentionByResolution, tbc.dryRun, stubCounter)
+		if err != nil {
 			return errors.Wrap(err, "retention failed")
 		}
+		if tbc.dryRun {
+			level.Info(logger).Log("msg", "dry run: no block was marked for deletion", "expiredBlocks", len(expired))
+		}
 		return nil
 	})
 }
@@ -1486,3 +1730,119 @@ func registerBucketUploadBlocks(app extkingpin.AppClause, objStoreConfig *extfla
 		return nil
 	})
 }
+
+func registerBucketReplay(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command(component.Replay.String(), "Replay blocks from the bucket as remote write requests into a receive hashring, "+
+		"e.g. to migrate historical data into a new cluster or to repopulate a hashring after a disaster. "+
+		"Samples are written for the tenant of their block, rate limited per tenant. Only raw blocks can be replayed. "+
+		"NOTE: Receivers only accept samples within their TSDB head and out-of-order time window, samples rejected by the hashring are dropped and counted in thanos_replay_rejected_samples_total.")
+
+	tbc := &bucketReplayConfig{}
+	tbc.registerBucketReplayFlag(cmd)
+
+	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range limit to replay. Thanos Replay will replay only samples, which happened later than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("0000-01-01T00:00:00Z"))
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range limit to replay. Thanos Replay will replay only samples, which happened earlier than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("9999-12-31T23:59:59Z"))
+
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, component.Replay.String())
+		if err != nil {
+			return err
+		}
+		insBkt := objstoretracing.WrapWithTraces(objstore.WrapWithMetrics(bkt, extprom.WrapRegistererWithPrefix("thanos_", reg), bkt.Name()))
+
+		replayer, err := replay.NewReplayer(logger, reg, replay.Config{
+			URL:                tbc.remoteWriteURL,
+			Timeout:            tbc.timeout,
+			MaxRetries:         tbc.maxRetries,
+			TenantHeader:       tbc.tenantHeader,
+			TenantLabel:        tbc.tenantLabelName,
+			DefaultTenant:      tbc.defaultTenantID,
+			Tenant:             tbc.tenant,
+			WithExternalLabels: tbc.withExternalLabels,
+			SamplesPerRequest:  tbc.samplesPerRequest,
+			SamplesPerSecond:   tbc.samplesPerSecond,
+			MinTime:            minTime.PrometheusTimestamp(),
+			MaxTime:            maxTime.PrometheusTimestamp(),
+		})
+		if err != nil {
+			return err
+		}
+
+		var ids []ulid.ULID
+		for _, id := range tbc.blockIDs {
+			u, err := ulid.Parse(id)
+			if err != nil {
+				return errors.Errorf("id is not a valid block ULID, got: %v", id)
+			}
+			ids = append(ids, u)
+		}
+
+		if err := os.RemoveAll(tbc.tmpDir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(tbc.tmpDir, os.ModePerm); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			defer runutil.CloseWithLogOnErr(logger, insBkt, "bucket client")
+
+			if len(ids) == 0 {
+				filters := []block.MetadataFilter{
+					block.NewIgnoreDeletionMarkFilter(logger, insBkt, 0, block.FetcherConcurrency),
+				}
+				fetcher, err := block.NewMetaFetcher(logger, block.FetcherConcurrency, insBkt, block.NewConcurrentLister(logger, insBkt), "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), filters)
+				if err != nil {
+					return err
+				}
+				metas, _, err := fetcher.Fetch(ctx)
+				if err != nil {
+					return err
+				}
+				for id, meta := range metas {
+					if meta.Thanos.Downsample.Resolution != downsample.ResLevel0 {
+						continue
+					}
+					if meta.MaxTime <= minTime.PrometheusTimestamp() || meta.MinTime > maxTime.PrometheusTimestamp() {
+						continue
+					}
+					ids = append(ids, id)
+				}
+				// Replay blocks in time order, so that receivers get samples as close as possible to in-order.
+				sort.Slice(ids, func(i, j int) bool {
+					return metas[ids[i]].MinTime < metas[ids[j]].MinTime
+				})
+			}
+
+			for _, id := range ids {
+				dir := filepath.Join(tbc.tmpDir, id.String())
+				level.Info(logger).Log("msg", "downloading block", "id", id)
+				if err := block.Download(ctx, logger, insBkt, id, dir); err != nil {
+					return errors.Wrapf(err, "download %v", id)
+				}
+
+				level.Info(logger).Log("msg", "replaying block", "id", id)
+				if err := replayer.ReplayBlock(ctx, dir); err != nil {
+					return errors.Wrapf(err, "replay %v", id)
+				}
+				if err := os.RemoveAll(dir); err != nil {
+					return errors.Wrapf(err, "remove %v", dir)
+				}
+				level.Info(logger).Log("msg", "replayed block", "id", id)
+			}
+			level.Info(logger).Log("msg", "replay done", "blocks", len(ids))
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
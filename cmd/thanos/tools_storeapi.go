@@ -0,0 +1,129 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/run"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/extgrpc"
+	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/extpromql"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storecheck"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+type storeAPICheckConfig struct {
+	endpoint      string
+	minTime       *model.TimeOrDurationValue
+	maxTime       *model.TimeOrDurationValue
+	selector      string
+	replicaLabels []string
+	output        string
+	timeout       time.Duration
+
+	secure     bool
+	skipVerify bool
+	cert       string
+	key        string
+	caCert     string
+	serverName string
+}
+
+func (tc *storeAPICheckConfig) registerFlag(cmd extkingpin.FlagClause) *storeAPICheckConfig {
+	cmd.Flag("endpoint", "Address of the gRPC StoreAPI to check.").Required().StringVar(&tc.endpoint)
+	tc.minTime = model.TimeOrDuration(cmd.Flag("min-time", "Start of the time range of the requests. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("-2h"))
+	tc.maxTime = model.TimeOrDuration(cmd.Flag("max-time", "End of the time range of the requests. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("0s"))
+	cmd.Flag("selector", "Series selector, e.g. '{job=\"prometheus\"}', of the series to check. If empty, the series of the first metric name are checked.").
+		Default("").StringVar(&tc.selector)
+	cmd.Flag("replica-label", "Replica label to check the without replica labels behavior of the StoreAPI with (repeated). If empty, the first external label is used.").
+		StringsVar(&tc.replicaLabels)
+	cmd.Flag("output", "Format of the compatibility report.").Short('o').Default("table").EnumVar(&tc.output, "table", "json")
+	cmd.Flag("timeout", "Timeout of the whole check.").Default("5m").DurationVar(&tc.timeout)
+
+	cmd.Flag("grpc-client-tls-secure", "Use TLS when talking to the gRPC server").Default("false").BoolVar(&tc.secure)
+	cmd.Flag("grpc-client-tls-skip-verify", "Disable TLS certificate verification i.e self signed, signed by fake CA").Default("false").BoolVar(&tc.skipVerify)
+	cmd.Flag("grpc-client-tls-cert", "TLS Certificates to use to identify this client to the server").Default("").StringVar(&tc.cert)
+	cmd.Flag("grpc-client-tls-key", "TLS Key for the client's certificate").Default("").StringVar(&tc.key)
+	cmd.Flag("grpc-client-tls-ca", "TLS CA Certificates to use to verify gRPC servers").Default("").StringVar(&tc.caCert)
+	cmd.Flag("grpc-client-server-name", "Server name to verify the hostname on the returned gRPC certificates. See https://tools.ietf.org/html/rfc4366#section-3.1").Default("").StringVar(&tc.serverName)
+	return tc
+}
+
+func registerStoreAPICheck(app extkingpin.AppClause) {
+	cmd := app.Command("storeapi-check", "Run a conformance suite against a StoreAPI, e.g. of a third-party implementation, and print a compatibility report: "+
+		"correctness of its info, sorting of series and labels, matcher semantics, label APIs restricted by matchers and the without replica labels behavior. Exits with an error if any check failed.")
+	tc := &storeAPICheckConfig{}
+	tc.registerFlag(cmd)
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+		return checkStoreAPI(logger, reg, tracer, tc, os.Stdout)
+	})
+}
+
+func checkStoreAPI(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer, tc *storeAPICheckConfig, w io.Writer) error {
+	matchers, err := extpromql.ParseMetricSelector(tc.selector)
+	if tc.selector != "" && err != nil {
+		return errors.Wrap(err, "parse selector")
+	}
+	cfg := storecheck.Config{
+		MinTime:       tc.minTime.PrometheusTimestamp(),
+		MaxTime:       tc.maxTime.PrometheusTimestamp(),
+		Matchers:      matchers,
+		ReplicaLabels: tc.replicaLabels,
+	}
+	if cfg.MinTime > cfg.MaxTime {
+		return errors.Errorf("min time %d is after max time %d", cfg.MinTime, cfg.MaxTime)
+	}
+
+	dialOpts, err := extgrpc.StoreClientGRPCOpts(logger, reg, tracer, tc.secure, tc.skipVerify, tc.cert, tc.key, tc.caCert, tc.serverName)
+	if err != nil {
+		return errors.Wrap(err, "build gRPC dial options")
+	}
+	conn, err := grpc.NewClient(tc.endpoint, dialOpts...)
+	if err != nil {
+		return errors.Wrapf(err, "dial %s", tc.endpoint)
+	}
+	defer runutil.CloseWithLogOnErr(logger, conn, "storeapi connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+	defer cancel()
+	report := storecheck.NewChecker(storepb.NewStoreClient(conn), infopb.NewInfoClient(conn), cfg).Run(ctx)
+	if err := printStoreCheckReport(w, report, tc.output); err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(report.Results))
+	}
+	return nil
+}
+
+func printStoreCheckReport(w io.Writer, report storecheck.Report, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	t := Table{Header: []string{"Check", "Status", "Message"}}
+	for _, r := range report.Results {
+		t.Lines = append(t.Lines, []string{r.Check, string(r.Status), r.Message})
+	}
+	return printTable(w, t)
+}
@@ -4,11 +4,33 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"google.golang.org/grpc"
 
 	"github.com/efficientgo/core/testutil"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storecheck"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
 func Test_CheckRules(t *testing.T) {
@@ -45,3 +67,88 @@ func Test_CheckRules_Glob(t *testing.T) {
 	files = &[]string{"./testdata/rules-files/*.yamlaaa"}
 	testutil.NotOk(t, checkRulesFiles(logger, files), "expected err for file %s", files)
 }
+
+func Test_AnnotateBlocks(t *testing.T) {
+	dataDir := t.TempDir()
+	gateways, err := parseStoreGatewaysConfig([]byte(`
+- name: store-a
+  selector_relabel_config:
+  - action: keep
+    source_labels: [cluster]
+    regex: a
+  data_dir: ` + dataDir + `
+- name: store-recent
+  min_time: 1970-01-01T00:00:01Z
+`))
+	testutil.Ok(t, err)
+
+	newMeta := func(id ulid.ULID, cluster string, mint, maxt int64) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: mint, MaxTime: maxt},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": cluster}},
+		}
+	}
+	id1, id2, id3 := ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)
+	metas := map[ulid.ULID]*metadata.Meta{
+		id1: newMeta(id1, "a", 0, 500),
+		id2: newMeta(id2, "a", 400, 2000),
+		id3: newMeta(id3, "b", 0, 2000),
+	}
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dataDir, id2.String()), os.ModePerm))
+	testutil.Ok(t, os.WriteFile(filepath.Join(dataDir, id2.String(), block.IndexHeaderFilename), nil, os.ModePerm))
+
+	annotations, err := annotateBlocks(context.Background(), log.NewNopLogger(), metas, gateways)
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[ulid.ULID]*blockAnnotations{
+		id1: {StoreGateways: []string{"store-a"}, CachedBy: []string{}, Overlaps: []ulid.ULID{id2}},
+		id2: {StoreGateways: []string{"store-a", "store-recent"}, CachedBy: []string{"store-a"}, Overlaps: []ulid.ULID{id1}},
+		id3: {StoreGateways: []string{"store-recent"}, CachedBy: []string{}, Overlaps: []ulid.ULID{}},
+	}, annotations)
+	testutil.Equals(t, "Store gateways: store-a,store-recent, Cached by: store-a, Overlaps: "+id1.String(), annotations[id2].String())
+
+	for _, invalid := range []string{
+		`[{min_time: -1d}]`,
+		`[{name: store, min_time: yesterday}]`,
+		`[{name: store, selector_relabel_config: [{action: replace, target_label: a}]}]`,
+		`[{name: store, unknown: true}]`,
+	} {
+		_, err := parseStoreGatewaysConfig([]byte(invalid))
+		testutil.NotOk(t, err, "expected err for config %s", invalid)
+	}
+}
+
+func Test_CheckStoreAPI(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, db.Close()) })
+	app := db.Appender(context.Background())
+	for i := 0; i < 3; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "up", "instance", fmt.Sprintf("instance-%d", i)), 10, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, store.NewTSDBStore(nil, db, component.Rule, labels.FromStrings("replica", "a")))
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	tc := &storeAPICheckConfig{endpoint: l.Addr().String(), output: "json", timeout: time.Minute}
+	tc.minTime, tc.maxTime = &model.TimeOrDurationValue{}, &model.TimeOrDurationValue{}
+	testutil.Ok(t, tc.minTime.Set("1970-01-01T00:00:00Z"))
+	testutil.Ok(t, tc.maxTime.Set("1970-01-01T00:01:00Z"))
+
+	var buf bytes.Buffer
+	testutil.Ok(t, checkStoreAPI(log.NewNopLogger(), nil, opentracing.NoopTracer{}, tc, &buf))
+	var report storecheck.Report
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &report))
+	testutil.Equals(t, 0, report.Failed())
+	testutil.Equals(t, "series", report.Results[3].Check)
+	testutil.Equals(t, storecheck.StatusPass, report.Results[3].Status)
+
+	// Invalid selectors fail the check.
+	tc.selector = "{instance=\"instance-0\""
+	testutil.NotOk(t, checkStoreAPI(log.NewNopLogger(), nil, opentracing.NoopTracer{}, tc, &buf))
+}
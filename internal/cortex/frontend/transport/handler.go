@@ -176,6 +176,10 @@ func (f *Handler) reportSlowQuery(r *http.Request, responseHeaders http.Header,
 	if traceID := responseHeaders.Get("X-Thanos-Trace-Id"); traceID != "" {
 		thanosTraceID = traceID
 	}
+	queryFingerprint := "-"
+	if fp := responseHeaders.Get("X-Thanos-Query-Fingerprint"); fp != "" {
+		queryFingerprint = fp
+	}
 
 	var remoteUser string
 	// Prefer reading remote user from header. Fall back to the value of basic authentication.
@@ -196,6 +200,7 @@ func (f *Handler) reportSlowQuery(r *http.Request, responseHeaders http.Header,
 		"grafana_dashboard_uid", grafanaDashboardUID,
 		"grafana_panel_id", grafanaPanelID,
 		"trace_id", thanosTraceID,
+		"query_fingerprint", queryFingerprint,
 	}, formatQueryString(queryString)...)
 
 	level.Info(util_log.WithContext(r.Context(), f.log)).Log(logMessage...)
@@ -5,10 +5,12 @@ package queryrange
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/weaveworks/common/httpgrpc"
 
@@ -61,7 +63,7 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 	}
 
 	// Clamp the time range based on the max query lookback.
-
+	var warnings []string
 	if maxQueryLookback := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxQueryLookback); maxQueryLookback > 0 {
 		minStartTime := util.TimeToMillis(time.Now().Add(-maxQueryLookback))
 
@@ -74,7 +76,9 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 				"redEnd", util.FormatTimeMillis(r.GetEnd()),
 				"maxQueryLookback", maxQueryLookback)
 
-			return NewEmptyPrometheusResponse(), nil
+			return AddWarnings(NewEmptyPrometheusResponse(), fmt.Sprintf(
+				"the query-frontend returned no data, as the query ends before its max query lookback of %s", model.Duration(maxQueryLookback),
+			)), nil
 		}
 
 		if r.GetStart() < minStartTime {
@@ -84,6 +88,10 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 				"original", util.FormatTimeMillis(r.GetStart()),
 				"updated", util.FormatTimeMillis(minStartTime))
 
+			warnings = append(warnings, fmt.Sprintf(
+				"the query-frontend moved the start of the query from %s to %s, as the query starts before its max query lookback of %s",
+				timestamp.Time(r.GetStart()).Format(time.RFC3339), timestamp.Time(minStartTime).Format(time.RFC3339), model.Duration(maxQueryLookback),
+			))
 			r = r.WithStartEnd(minStartTime, r.GetEnd())
 		}
 	}
@@ -96,5 +104,9 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 		}
 	}
 
-	return l.next.Do(ctx, r)
+	resp, err := l.next.Do(ctx, r)
+	if err != nil || len(warnings) == 0 {
+		return resp, err
+	}
+	return AddWarnings(resp, warnings...), nil
 }
@@ -28,6 +28,7 @@ func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
 		reqStartTime      time.Time
 		reqEndTime        time.Time
 		expectedSkipped   bool
+		expectedWarning   bool
 		expectedStartTime time.Time
 		expectedEndTime   time.Time
 	}{
@@ -58,6 +59,7 @@ func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
 			reqEndTime:        now,
 			expectedStartTime: now.Add(-thirtyDays),
 			expectedEndTime:   now,
+			expectedWarning:   true,
 		},
 		"should skip executing a query outside the allowed time range": {
 			maxQueryLookback: thirtyDays,
@@ -91,9 +93,17 @@ func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
 				// which we expect has been skipped.
 				assert.NotSame(t, innerRes, res)
 				assert.Len(t, inner.Calls, 0)
+				assert.Len(t, res.(*PrometheusResponse).Warnings, 1)
 			} else {
-				// We expect the response returned by the inner handler.
-				assert.Same(t, innerRes, res)
+				if testData.expectedWarning {
+					// We expect the response returned by the inner handler, with a warning about the manipulated time range.
+					assert.Equal(t, innerRes.Data, res.(*PrometheusResponse).Data)
+					assert.Len(t, res.(*PrometheusResponse).Warnings, 1)
+					assert.Empty(t, innerRes.Warnings)
+				} else {
+					// We expect the response returned by the inner handler.
+					assert.Same(t, innerRes, res)
+				}
 
 				// Assert on the time range of the request passed to the inner handler (5s delta).
 				delta := float64(5000)
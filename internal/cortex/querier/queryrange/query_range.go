@@ -32,6 +32,7 @@ import (
 	"github.com/thanos-io/thanos/internal/cortex/cortexpb"
 	"github.com/thanos-io/thanos/internal/cortex/util"
 	"github.com/thanos-io/thanos/internal/cortex/util/spanlogger"
+	"github.com/thanos-io/thanos/pkg/extannotations"
 )
 
 // StatusSuccess Prometheus success result.
@@ -209,6 +210,23 @@ func NewEmptyPrometheusInstantQueryResponse() *PrometheusInstantQueryResponse {
 	}
 }
 
+// AddWarnings returns a copy of the response with the given warnings added, for Grafana to display them along its
+// results, e.g. when the query-frontend altered the query. Responses which cannot hold warnings are returned as is.
+func AddWarnings(r Response, warnings ...string) Response {
+	switch resp := r.(type) {
+	case *PrometheusResponse:
+		c := *resp
+		c.Warnings = extannotations.DedupStrings(append(append([]string(nil), resp.Warnings...), warnings...))
+		return &c
+	case *PrometheusInstantQueryResponse:
+		c := *resp
+		c.Warnings = extannotations.DedupStrings(append(append([]string(nil), resp.Warnings...), warnings...))
+		return &c
+	default:
+		return r
+	}
+}
+
 func traverseAnalysis(a *Analysis, results *[]*Analysis) {
 	if a == nil {
 		return
@@ -281,7 +299,8 @@ func (prometheusCodec) MergeResponse(_ Request, responses ...Response) (Response
 			Stats:      StatsMerge(responses),
 			Analysis:   AnalyzesMerge(analyzes...),
 		},
-		Warnings: warnings,
+		// Splits and shards of the same query usually return the same warnings.
+		Warnings: extannotations.DedupStrings(warnings),
 	}
 
 	if len(resultsCacheGenNumberHeaderValues) != 0 {
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -21,6 +22,7 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/promql"
@@ -155,6 +157,59 @@ func (t constSplitter) GenerateCacheKey(userID string, r Request) string {
 // or not. If not, just send the request to next handler.
 type ShouldCacheFn func(r Request) bool
 
+// CacheBypass controls which results cache operations are skipped for a request.
+type CacheBypass struct {
+	// SkipRead makes the request ignore cached results. Results are still written to the cache.
+	SkipRead bool
+	// SkipWrite prevents results of the request from being written to the cache.
+	SkipWrite bool
+}
+
+type cacheBypassContextKey struct{}
+
+// InjectCacheBypass returns a derived context making the results cache skip the given operations.
+func InjectCacheBypass(ctx context.Context, bypass CacheBypass) context.Context {
+	return context.WithValue(ctx, cacheBypassContextKey{}, bypass)
+}
+
+// ExtractCacheBypass gets the results cache bypass from the context.
+func ExtractCacheBypass(ctx context.Context) CacheBypass {
+	bypass, _ := ctx.Value(cacheBypassContextKey{}).(CacheBypass)
+	return bypass
+}
+
+type staleWhileRevalidateContextKey struct{}
+
+// InjectStaleWhileRevalidate returns a derived context allowing the results cache to serve cached results missing
+// at most the given duration at the end of the request range. The missing data is then fetched asynchronously.
+func InjectStaleWhileRevalidate(ctx context.Context, staleness time.Duration) context.Context {
+	return context.WithValue(ctx, staleWhileRevalidateContextKey{}, staleness)
+}
+
+// ExtractStaleWhileRevalidate gets the staleness tolerated by the request from the context, zero if none.
+func ExtractStaleWhileRevalidate(ctx context.Context) time.Duration {
+	staleness, _ := ctx.Value(staleWhileRevalidateContextKey{}).(time.Duration)
+	return staleness
+}
+
+type cacheOnlyContextKey struct{}
+
+// InjectCacheOnly returns a derived context making the results cache serve the cached results covering the request,
+// even partially, without requesting the parts of its range which are not cached. Requests without any cached
+// result are still passed to the next handler.
+func InjectCacheOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheOnlyContextKey{}, true)
+}
+
+// ExtractCacheOnly gets whether the request should only be served from cached results from the context.
+func ExtractCacheOnly(ctx context.Context) bool {
+	cacheOnly, _ := ctx.Value(cacheOnlyContextKey{}).(bool)
+	return cacheOnly
+}
+
+// staleRevalidationTimeout is the timeout of the requests fetching the data missing from stale responses.
+const staleRevalidationTimeout = 2 * time.Minute
+
 type resultsCache struct {
 	logger   log.Logger
 	cfg      ResultsCacheConfig
@@ -169,6 +224,10 @@ type resultsCache struct {
 	cacheGenNumberLoader       CacheGenNumberLoader
 	shouldCache                ShouldCacheFn
 	cacheQueryableSamplesStats bool
+
+	// revalidating holds the keys of the cached results being revalidated after a stale response.
+	revalidating   *sync.Map
+	staleResponses prometheus.Counter
 }
 
 // NewResultsCacheMiddleware creates results cache middleware from config.
@@ -200,6 +259,13 @@ func NewResultsCacheMiddleware(
 		c = cache.NewCacheGenNumMiddleware(c)
 	}
 
+	revalidating := &sync.Map{}
+	staleResponses := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Namespace: "thanos",
+		Name:      "query_frontend_results_cache_stale_responses_total",
+		Help:      "Total number of responses served from stale cached results while the missing data is fetched asynchronously.",
+	})
+
 	return MiddlewareFunc(func(next Handler) Handler {
 		return &resultsCache{
 			logger:                     logger,
@@ -214,6 +280,8 @@ func NewResultsCacheMiddleware(
 			cacheGenNumberLoader:       cacheGenNumberLoader,
 			shouldCache:                shouldCache,
 			cacheQueryableSamplesStats: cfg.CacheQueryableSamplesStats,
+			revalidating:               revalidating,
+			staleResponses:             staleResponses,
 		}
 	}), c, nil
 }
@@ -236,6 +304,11 @@ func (s resultsCache) Do(ctx context.Context, r Request) (Response, error) {
 		return s.next.Do(ctx, r)
 	}
 
+	bypass := ExtractCacheBypass(ctx)
+	if bypass.SkipRead && bypass.SkipWrite {
+		return s.next.Do(ctx, r)
+	}
+
 	if s.cacheGenNumberLoader != nil {
 		ctx = cache.InjectCacheGenNumber(ctx, s.cacheGenNumberLoader.GetResultsCacheGenNumber(tenantIDs))
 	}
@@ -246,20 +319,54 @@ func (s resultsCache) Do(ctx context.Context, r Request) (Response, error) {
 		response Response
 	)
 
+	if ExtractCacheOnly(ctx) && !bypass.SkipRead {
+		if cached, ok := s.get(ctx, key); ok {
+			_, responses, err := s.partition(r, cached)
+			if err != nil {
+				return nil, err
+			}
+			if len(responses) > 0 {
+				response, err := s.merger.MergeResponse(r, responses...)
+				if err == nil && !respWithStats {
+					response = s.extractor.ResponseWithoutStats(response)
+				}
+				return response, err
+			}
+		}
+	}
+
 	maxCacheFreshness := validation.MaxDurationPerTenant(tenantIDs, s.limits.MaxCacheFreshness)
 	maxCacheTime := int64(model.Now().Add(-maxCacheFreshness))
 	if r.GetStart() > maxCacheTime {
 		return s.next.Do(ctx, r)
 	}
 
-	cached, ok := s.get(ctx, key)
+	var (
+		cached []Extent
+		ok     bool
+	)
+	if !bypass.SkipRead {
+		cached, ok = s.get(ctx, key)
+	}
+	if staleness := ExtractStaleWhileRevalidate(ctx); ok && staleness > 0 && !bypass.SkipWrite {
+		response, stale, err := s.handleStaleHit(ctx, key, r, cached, staleness, maxCacheTime, maxCacheFreshness)
+		if err != nil {
+			return nil, err
+		}
+		if stale {
+			if !respWithStats {
+				response = s.extractor.ResponseWithoutStats(response)
+			}
+			return response, nil
+		}
+	}
 	if ok {
 		response, extents, err = s.handleHit(ctx, r, cached, maxCacheTime)
 	} else {
 		response, extents, err = s.handleMiss(ctx, r, maxCacheTime)
 	}
 
-	if err == nil && len(extents) > 0 {
+	if err == nil && len(extents) > 0 && !bypass.SkipWrite {
 		extents, err := s.filterRecentExtents(r, maxCacheFreshness, extents)
 		if err != nil {
 			return nil, err
@@ -527,6 +634,47 @@ func (s resultsCache) handleHit(ctx context.Context, r Request, extents []Extent
 	return response, mergedExtents, err
 }
 
+// handleStaleHit serves the cached results if they only miss at most the given staleness at the end of the
+// request range, and fetches the missing data asynchronously. It returns false if the results are not served.
+func (s resultsCache) handleStaleHit(ctx context.Context, key string, r Request, extents []Extent, staleness time.Duration, maxCacheTime int64, maxCacheFreshness time.Duration) (Response, bool, error) {
+	requests, responses, err := s.partition(r, extents)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(requests) != 1 || len(responses) == 0 || requests[0].GetEnd() != r.GetEnd() || r.GetEnd()-requests[0].GetStart() > staleness.Milliseconds() {
+		return nil, false, nil
+	}
+
+	response, err := s.merger.MergeResponse(r, responses...)
+	if err != nil {
+		return nil, false, err
+	}
+	s.staleResponses.Inc()
+
+	// Only a single revalidation of the same cached results is needed at a time.
+	if _, loaded := s.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return response, true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), staleRevalidationTimeout)
+	go func() {
+		defer cancel()
+		defer s.revalidating.Delete(key)
+
+		_, extents, err := s.handleHit(ctx, r, extents, maxCacheTime)
+		if err == nil && len(extents) > 0 {
+			extents, err = s.filterRecentExtents(r, maxCacheFreshness, extents)
+		}
+		if err != nil {
+			level.Warn(s.logger).Log("msg", "failed to revalidate stale cached results", "err", err)
+			return
+		}
+		if len(extents) > 0 {
+			s.put(ctx, key, extents)
+		}
+	}()
+	return response, true, nil
+}
+
 type accumulator struct {
 	Response
 	Extent
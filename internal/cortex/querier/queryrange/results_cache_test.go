@@ -1141,6 +1141,122 @@ func TestResultsCacheRecent(t *testing.T) {
 	require.Equal(t, parsedResponse, resp)
 }
 
+func TestResultsCacheStaleWhileRevalidate(t *testing.T) {
+	now := int64(model.Now()) / 10 * 10
+	req := &PrometheusRequest{
+		Path:  "/api/v1/query_range",
+		Start: now - 300*1e3,
+		End:   now,
+		Step:  10,
+		Query: "sum(container_memory_rss) by (namespace)",
+	}
+
+	for _, tc := range []struct {
+		name      string
+		staleness time.Duration
+		stale     bool
+	}{
+		{name: "missing data within staleness", staleness: 2 * time.Minute, stale: true},
+		{name: "missing data beyond staleness", staleness: 30 * time.Second},
+		{name: "stale while revalidate disabled"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg ResultsCacheConfig
+			flagext.DefaultValues(&cfg)
+			cfg.CacheConfig.Cache = cache.NewMockCache()
+			rcm, _, err := NewResultsCacheMiddleware(
+				log.NewNopLogger(),
+				cfg,
+				constSplitter(day),
+				mockLimits{maxCacheFreshness: 10 * time.Second},
+				PrometheusCodec,
+				PrometheusResponseExtractor{},
+				nil,
+				nil,
+				nil,
+			)
+			require.NoError(t, err)
+
+			requests := make(chan Request, 1)
+			rc := rcm.Wrap(HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+				requests <- r
+				return mkAPIResponse(r.GetStart(), r.GetEnd(), r.GetStep()), nil
+			}))
+			ctx := InjectStaleWhileRevalidate(user.InjectOrgID(context.Background(), "1"), tc.staleness)
+
+			key := constSplitter(day).GenerateCacheKey("1", req)
+			rc.(*resultsCache).put(ctx, key, []Extent{mkExtent(now-600*1e3, now-60*1e3)})
+
+			resp, err := rc.Do(ctx, req)
+			require.NoError(t, err)
+			if !tc.stale {
+				require.Equal(t, 1, len(requests))
+				require.Equal(t, mkAPIResponse(req.GetStart(), req.GetEnd(), req.GetStep()), resp)
+				return
+			}
+			require.Equal(t, mkAPIResponse(req.GetStart(), now-60*1e3, req.GetStep()), resp)
+
+			// The missing data is fetched asynchronously, and cached up to the max cache freshness.
+			r := <-requests
+			require.Equal(t, now-60*1e3, r.GetStart())
+			require.Equal(t, now, r.GetEnd())
+			require.Eventually(t, func() bool {
+				extents, ok := rc.(*resultsCache).get(ctx, key)
+				return ok && len(extents) == 1 && extents[0].End > now-60*1e3
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestResultsCacheCacheOnly(t *testing.T) {
+	now := int64(model.Now()) / 10 * 10
+	req := &PrometheusRequest{
+		Path:  "/api/v1/query_range",
+		Start: now - 300*1e3,
+		End:   now,
+		Step:  10,
+		Query: "sum(container_memory_rss) by (namespace)",
+	}
+
+	var cfg ResultsCacheConfig
+	flagext.DefaultValues(&cfg)
+	cfg.CacheConfig.Cache = cache.NewMockCache()
+	rcm, _, err := NewResultsCacheMiddleware(
+		log.NewNopLogger(),
+		cfg,
+		constSplitter(day),
+		mockLimits{maxCacheFreshness: 10 * time.Second},
+		PrometheusCodec,
+		PrometheusResponseExtractor{},
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	calls := 0
+	rc := rcm.Wrap(HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+		calls++
+		return mkAPIResponse(r.GetStart(), r.GetEnd(), r.GetStep()), nil
+	}))
+	ctx := InjectCacheOnly(user.InjectOrgID(context.Background(), "1"))
+
+	// Requests without cached results are passed to the next handler.
+	other := req.WithQuery("up")
+	resp, err := rc.Do(ctx, other)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, mkAPIResponse(other.GetStart(), other.GetEnd(), other.GetStep()), resp)
+
+	// The cached results are served, whatever the range missing from them.
+	key := constSplitter(day).GenerateCacheKey("1", req)
+	rc.(*resultsCache).put(ctx, key, []Extent{mkExtent(now-240*1e3, now-180*1e3)})
+	resp, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, mkAPIResponse(now-240*1e3, now-180*1e3, req.GetStep()), resp)
+}
+
 func TestResultsCacheMaxFreshness(t *testing.T) {
 	modelNow := model.Now()
 	for i, tc := range []struct {
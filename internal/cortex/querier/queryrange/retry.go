@@ -60,6 +60,11 @@ func (r retry) Do(ctx context.Context, req Request) (Response, error) {
 	tries := 0
 	defer func() { r.metrics.retriesCount.Observe(float64(tries)) }()
 
+	// Requests served from cached results only are never sent downstream, there is nothing to retry.
+	if ExtractCacheOnly(ctx) {
+		return r.next.Do(ctx, req)
+	}
+
 	var lastErr error
 	for ; tries < r.maxRetries; tries++ {
 		if ctx.Err() != nil {
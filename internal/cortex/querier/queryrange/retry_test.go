@@ -94,3 +94,15 @@ func Test_RetryMiddlewareCancel(t *testing.T) {
 	require.Equal(t, int32(1), try.Load())
 	require.Equal(t, ctx.Err(), err)
 }
+
+func TestRetryCacheOnly(t *testing.T) {
+	var try atomic.Int32
+	_, err := NewRetryMiddleware(log.NewNopLogger(), 5, nil).Wrap(
+		HandlerFunc(func(c context.Context, r Request) (Response, error) {
+			try.Inc()
+			return nil, httpgrpc.Errorf(http.StatusServiceUnavailable, "Service Unavailable")
+		}),
+	).Do(InjectCacheOnly(context.Background()), nil)
+	require.Equal(t, httpgrpc.Errorf(http.StatusServiceUnavailable, "Service Unavailable"), err)
+	require.Equal(t, int32(1), try.Load())
+}
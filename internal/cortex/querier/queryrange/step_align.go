@@ -5,6 +5,8 @@ package queryrange
 
 import (
 	"context"
+	"fmt"
+	"time"
 )
 
 // StepAlignMiddleware aligns the start and end of request to the step to
@@ -22,5 +24,16 @@ type stepAlign struct {
 func (s stepAlign) Do(ctx context.Context, r Request) (Response, error) {
 	start := (r.GetStart() / r.GetStep()) * r.GetStep()
 	end := (r.GetEnd() / r.GetStep()) * r.GetStep()
-	return s.next.Do(ctx, r.WithStartEnd(start, end))
+	if start == r.GetStart() && end == r.GetEnd() {
+		return s.next.Do(ctx, r)
+	}
+
+	resp, err := s.next.Do(ctx, r.WithStartEnd(start, end))
+	if err != nil {
+		return nil, err
+	}
+	return AddWarnings(resp, fmt.Sprintf(
+		"the query-frontend aligned the start and end of the query to its step of %s, the results may be shifted by up to one step",
+		time.Duration(r.GetStep())*time.Millisecond,
+	)), nil
 }
@@ -14,6 +14,7 @@ import (
 func TestStepAlign(t *testing.T) {
 	for i, tc := range []struct {
 		input, expected *PrometheusRequest
+		expectedWarning bool
 	}{
 		{
 			input: &PrometheusRequest{
@@ -39,6 +40,7 @@ func TestStepAlign(t *testing.T) {
 				End:   100,
 				Step:  10,
 			},
+			expectedWarning: true,
 		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
@@ -46,12 +48,17 @@ func TestStepAlign(t *testing.T) {
 			s := stepAlign{
 				next: HandlerFunc(func(_ context.Context, req Request) (Response, error) {
 					result = req.(*PrometheusRequest)
-					return nil, nil
+					return NewEmptyPrometheusResponse(), nil
 				}),
 			}
-			_, err := s.Do(context.Background(), tc.input)
+			resp, err := s.Do(context.Background(), tc.input)
 			require.NoError(t, err)
 			require.Equal(t, tc.expected, result)
+			if tc.expectedWarning {
+				require.Equal(t, []string{"the query-frontend aligned the start and end of the query to its step of 10ms, the results may be shifted by up to one step"}, resp.(*PrometheusResponse).Warnings)
+			} else {
+				require.Empty(t, resp.(*PrometheusResponse).Warnings)
+			}
 		})
 	}
 }
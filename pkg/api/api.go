@@ -57,6 +57,7 @@ const (
 	ErrorExec     ErrorType = "execution"
 	ErrorBadData  ErrorType = "bad_data"
 	ErrorInternal ErrorType = "internal"
+	ErrorNotFound ErrorType = "not_found"
 )
 
 var corsHeaders = map[string]string{
@@ -214,6 +215,13 @@ func GetInstr(
 			if !disableCORS {
 				SetCORS(w)
 			}
+			// Parse the parameters of JSON bodies upfront, so that handlers get them with r.FormValue.
+			if IsJSONRequest(r) {
+				if err := ParseForm(r); err != nil {
+					RespondError(w, &ApiError{Typ: ErrorBadData, Err: err}, nil)
+					return
+				}
+			}
 			if data, warnings, err, releaseResources := f(r); err != nil {
 				RespondError(w, err, data)
 				releaseResources()
@@ -280,6 +288,8 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 		code = http.StatusServiceUnavailable
 	case ErrorInternal:
 		code = http.StatusInternalServerError
+	case ErrorNotFound:
+		code = http.StatusNotFound
 	default:
 		code = http.StatusInternalServerError
 	}
@@ -4,7 +4,9 @@
 package v1
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,13 +17,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/api"
+	qapi "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/extpromql"
 	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/store"
 )
 
 // BlocksAPI is a very simple API used by Thanos Block Viewer.
@@ -35,8 +43,28 @@ type BlocksAPI struct {
 	disableCORS            bool
 	bkt                    objstore.Bucket
 	disableAdminOperations bool
+
+	heatmapLock sync.Mutex
+	heatmap     BlockHeatmapFunc
+
+	storeBlocksLock sync.Mutex
+	storeBlocks     StoreBlocksFunc
+
+	compactionBacklogLock sync.Mutex
+	compactionBacklog     CompactionBacklogFunc
 }
 
+// BlockHeatmapFunc returns the query heat of at most limit loaded blocks, or all of them if limit is 0,
+// the hottest first, or the coldest first if coldest is true.
+type BlockHeatmapFunc func(limit int, coldest bool) []store.BlockHeat
+
+// StoreBlocksFunc returns the blocks loaded by a store gateway overlapping the time range [mint, maxt] whose labels
+// match any of the given sets of matchers, or all of them if there is none.
+type StoreBlocksFunc func(mint, maxt int64, matcherSets ...[]*labels.Matcher) []store.LoadedBlock
+
+// CompactionBacklogFunc returns the compaction backlog of a compactor.
+type CompactionBacklogFunc func() compact.CompactionBacklogStatus
+
 type BlocksInfo struct {
 	Label       string          `json:"label"`
 	Blocks      []metadata.Meta `json:"blocks"`
@@ -90,6 +118,45 @@ func (bapi *BlocksAPI) Register(r *route.Router, tracer opentracing.Tracer, logg
 
 	r.Get("/blocks", instr("blocks", bapi.blocks))
 	r.Post("/blocks/mark", instr("blocks_mark", bapi.markBlock))
+	r.Get("/blocks/heatmap", instr("blocks_heatmap", bapi.blockHeatmap))
+	r.Get("/compaction/backlog", instr("compaction_backlog", bapi.compactionBacklogStatus))
+}
+
+func (bapi *BlocksAPI) compactionBacklogStatus(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	bapi.compactionBacklogLock.Lock()
+	backlog := bapi.compactionBacklog
+	bapi.compactionBacklogLock.Unlock()
+	if backlog == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.New("compaction backlog is not available")}, func() {}
+	}
+	return backlog(), nil, nil, func() {}
+}
+
+func (bapi *BlocksAPI) blockHeatmap(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	bapi.heatmapLock.Lock()
+	heatmap := bapi.heatmap
+	bapi.heatmapLock.Unlock()
+	if heatmap == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.New("block heatmap is not available")}, func() {}
+	}
+
+	limit := 0
+	if v := r.FormValue("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid limit %q, it must be a non-negative integer", v)}, func() {}
+		}
+	}
+
+	var coldest bool
+	switch order := r.FormValue("order"); order {
+	case "", "hottest":
+	case "coldest":
+		coldest = true
+	default:
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid order %q, it must be hottest or coldest", order)}, func() {}
+	}
+	return heatmap(limit, coldest), nil, nil, func() {}
 }
 
 func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
@@ -133,6 +200,9 @@ func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.Ap
 
 func (bapi *BlocksAPI) blocks(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
 	viewParam := r.URL.Query().Get("view")
+	if viewParam == "store" {
+		return bapi.loadedStoreBlocks(r)
+	}
 	if viewParam == "loaded" {
 		bapi.loadedLock.Lock()
 		defer bapi.loadedLock.Unlock()
@@ -146,6 +216,49 @@ func (bapi *BlocksAPI) blocks(r *http.Request) (interface{}, []error, *api.ApiEr
 	return bapi.globalBlocksInfo, nil, nil, func() {}
 }
 
+// loadedStoreBlocks returns the blocks loaded by the store gateway, filtered by the match[], start and end parameters.
+func (bapi *BlocksAPI) loadedStoreBlocks(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	bapi.storeBlocksLock.Lock()
+	storeBlocks := bapi.storeBlocks
+	bapi.storeBlocksLock.Unlock()
+	if storeBlocks == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.New("store blocks are not available")}, func() {}
+	}
+
+	// Blocks are not filtered by time if start or end are not set.
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+	start, err := qapi.ParseTimeParam(r, "start", time.Time{})
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+	if !start.IsZero() {
+		mint = timestamp.FromTime(start)
+	}
+	end, err := qapi.ParseTimeParam(r, "end", time.Time{})
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+	if !end.IsZero() {
+		maxt = timestamp.FromTime(end)
+	}
+	if maxt < mint {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("end timestamp must not be before start time")}, func() {}
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "parse form")}, func() {}
+	}
+	matcherSets := make([][]*labels.Matcher, 0, len(r.Form["match[]"]))
+	for _, s := range r.Form["match[]"] {
+		matchers, err := extpromql.ParseMetricSelector(s)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+	return storeBlocks(mint, maxt, matcherSets...), nil, nil, func() {}
+}
+
 func (b *BlocksInfo) set(blocks []metadata.Meta, err error) {
 	if err != nil {
 		// Last view is maintained.
@@ -174,3 +287,27 @@ func (bapi *BlocksAPI) SetLoaded(blocks []metadata.Meta, err error) {
 
 	bapi.loadedBlocksInfo.set(blocks, err)
 }
+
+// SetBlockHeatmap sets the function serving the query heat of the loaded blocks.
+func (bapi *BlocksAPI) SetBlockHeatmap(heatmap BlockHeatmapFunc) {
+	bapi.heatmapLock.Lock()
+	defer bapi.heatmapLock.Unlock()
+
+	bapi.heatmap = heatmap
+}
+
+// SetCompactionBacklog sets the function serving the compaction backlog of the compactor.
+func (bapi *BlocksAPI) SetCompactionBacklog(backlog CompactionBacklogFunc) {
+	bapi.compactionBacklogLock.Lock()
+	defer bapi.compactionBacklogLock.Unlock()
+
+	bapi.compactionBacklog = backlog
+}
+
+// SetStoreBlocks sets the function serving the blocks loaded by the store gateway.
+func (bapi *BlocksAPI) SetStoreBlocks(storeBlocks StoreBlocksFunc) {
+	bapi.storeBlocksLock.Lock()
+	defer bapi.storeBlocksLock.Unlock()
+
+	bapi.storeBlocks = storeBlocks
+}
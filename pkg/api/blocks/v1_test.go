@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,6 +27,8 @@ import (
 	baseAPI "github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/testutil/custom"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
@@ -186,3 +189,82 @@ func TestMarkBlockEndpoint(t *testing.T) {
 	_, err = os.Stat(file)
 	testutil.Ok(t, err)
 }
+
+func TestBlockHeatmapEndpoint(t *testing.T) {
+	api := &BlocksAPI{baseAPI: &baseAPI.BaseAPI{}}
+	testEndpoint(t, endpointTestCase{endpoint: api.blockHeatmap, errType: baseAPI.ErrorNotFound}, "not available", reflect.DeepEqual)
+
+	var (
+		gotLimit   int
+		gotColdest bool
+		heatmap    = []store.BlockHeat{{ULID: ulid.MustNew(1, nil), Queries: 3}}
+	)
+	api.SetBlockHeatmap(func(limit int, coldest bool) []store.BlockHeat {
+		gotLimit, gotColdest = limit, coldest
+		return heatmap
+	})
+
+	for i, test := range []endpointTestCase{
+		{endpoint: api.blockHeatmap, response: heatmap},
+		{endpoint: api.blockHeatmap, query: url.Values{"limit": []string{"10"}, "order": []string{"coldest"}}, response: heatmap},
+		{endpoint: api.blockHeatmap, query: url.Values{"limit": []string{"-1"}}, errType: baseAPI.ErrorBadData},
+		{endpoint: api.blockHeatmap, query: url.Values{"order": []string{"random"}}, errType: baseAPI.ErrorBadData},
+	} {
+		testEndpoint(t, test, fmt.Sprintf("#%d %s", i, test.query.Encode()), reflect.DeepEqual)
+	}
+	testutil.Equals(t, 10, gotLimit)
+	testutil.Equals(t, true, gotColdest)
+}
+
+func TestCompactionBacklogEndpoint(t *testing.T) {
+	api := &BlocksAPI{baseAPI: &baseAPI.BaseAPI{}}
+	testEndpoint(t, endpointTestCase{endpoint: api.compactionBacklogStatus, errType: baseAPI.ErrorNotFound}, "not available", reflect.DeepEqual)
+
+	status := compact.CompactionBacklogStatus{
+		Groups:             []compact.GroupBacklog{{Key: "0@1", Plans: []compact.PlannedCompaction{{Blocks: 4, Level: 2, Bytes: 1024}}, Blocks: 4, Bytes: 1024}},
+		Halted:             []compact.HaltedGroup{},
+		PendingCompactions: 1,
+		PendingBlocks:      4,
+		PendingBytes:       1024,
+	}
+	api.SetCompactionBacklog(func() compact.CompactionBacklogStatus { return status })
+	testEndpoint(t, endpointTestCase{endpoint: api.compactionBacklogStatus, response: status}, "set", reflect.DeepEqual)
+}
+
+func TestStoreBlocksEndpoint(t *testing.T) {
+	api := &BlocksAPI{baseAPI: &baseAPI.BaseAPI{}}
+	testEndpoint(t, endpointTestCase{endpoint: api.blocks, query: url.Values{"view": []string{"store"}}, errType: baseAPI.ErrorNotFound}, "not available", reflect.DeepEqual)
+
+	var (
+		gotMint, gotMaxt int64
+		gotMatcherSets   [][]*labels.Matcher
+		blocks           = []store.LoadedBlock{{ULID: ulid.MustNew(1, nil), IndexHeader: store.IndexHeaderUnloaded}}
+	)
+	api.SetStoreBlocks(func(mint, maxt int64, matcherSets ...[]*labels.Matcher) []store.LoadedBlock {
+		gotMint, gotMaxt, gotMatcherSets = mint, maxt, matcherSets
+		return blocks
+	})
+
+	testEndpoint(t, endpointTestCase{endpoint: api.blocks, query: url.Values{"view": []string{"store"}}, response: blocks}, "all", reflect.DeepEqual)
+	testutil.Equals(t, int64(math.MinInt64), gotMint)
+	testutil.Equals(t, int64(math.MaxInt64), gotMaxt)
+	testutil.Equals(t, 0, len(gotMatcherSets))
+
+	testEndpoint(t, endpointTestCase{endpoint: api.blocks, query: url.Values{
+		"view":    []string{"store"},
+		"start":   []string{"10"},
+		"end":     []string{"2024-01-01T00:00:00Z"},
+		"match[]": []string{`{tenant="a"}`, `{tenant=~"b.*", replica!="0"}`},
+	}, response: blocks}, "filtered", reflect.DeepEqual)
+	testutil.Equals(t, int64(10000), gotMint)
+	testutil.Equals(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), gotMaxt)
+	testutil.Equals(t, `[[tenant="a"] [tenant=~"b.*" replica!="0"]]`, fmt.Sprint(gotMatcherSets))
+
+	for i, query := range []url.Values{
+		{"view": []string{"store"}, "start": []string{"yesterday"}},
+		{"view": []string{"store"}, "start": []string{"20"}, "end": []string{"10"}},
+		{"view": []string{"store"}, "match[]": []string{"{"}},
+	} {
+		testEndpoint(t, endpointTestCase{endpoint: api.blocks, query: query, errType: baseAPI.ErrorBadData}, fmt.Sprintf("#%d %s", i, query.Encode()), reflect.DeepEqual)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+// JSONContentType is the content type of request bodies encoding their parameters in JSON.
+const JSONContentType = "application/json"
+
+// IsJSONRequest returns whether the body of the given request encodes its parameters in JSON.
+func IsJSONRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		return false
+	}
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && ct == JSONContentType
+}
+
+// ParseForm parses the parameters of the given request into r.Form and r.PostForm, like http.Request.ParseForm.
+// Request bodies can also encode their parameters in JSON, as an object whose values are strings, numbers or
+// booleans, or arrays of them for repeated parameters, e.g. {"query": "up", "match[]": ["up", "down"]}. The body
+// of JSON requests is kept, so that it can be read again, and parsed again by every call.
+func ParseForm(r *http.Request) error {
+	if !IsJSONRequest(r) {
+		return r.ParseForm()
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errors.Wrap(err, "read request body")
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	params, err := DecodeJSONParams(body)
+	if err != nil {
+		return err
+	}
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return errors.Wrap(err, "parse query parameters")
+	}
+	// Same as http.Request.ParseForm, values of the body come before the ones of the URL.
+	form := make(url.Values, len(params)+len(query))
+	for k, vs := range params {
+		form[k] = append(form[k], vs...)
+	}
+	for k, vs := range query {
+		form[k] = append(form[k], vs...)
+	}
+	r.PostForm = params
+	r.Form = form
+	return nil
+}
+
+// DecodeJSONParams decodes the request parameters encoded in JSON by EncodeJSONParams.
+func DecodeJSONParams(body []byte) (url.Values, error) {
+	params := url.Values{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return params, nil
+	}
+
+	var raw map[string]jsoniter.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "decode JSON request body, expected an object of parameters")
+	}
+	for k, v := range raw {
+		var vs []jsoniter.RawMessage
+		if len(v) > 0 && v[0] == '[' {
+			if err := json.Unmarshal(v, &vs); err != nil {
+				return nil, errors.Wrapf(err, "decode JSON parameter %s", k)
+			}
+		} else {
+			vs = []jsoniter.RawMessage{v}
+		}
+		for _, e := range vs {
+			s, err := jsonParamValue(e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "decode JSON parameter %s", k)
+			}
+			params[k] = append(params[k], s)
+		}
+	}
+	return params, nil
+}
+
+// jsonParamValue returns the string value of a scalar JSON value. Numbers are kept as written.
+func jsonParamValue(v jsoniter.RawMessage) (string, error) {
+	v = bytes.TrimSpace(v)
+	switch {
+	case len(v) > 0 && v[0] == '"':
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	case string(v) == "true", string(v) == "false":
+		return string(v), nil
+	}
+	var f float64
+	if string(v) == "null" || json.Unmarshal(v, &f) != nil {
+		return "", errors.Errorf("expected a string, number or boolean, got %s", v)
+	}
+	return string(v), nil
+}
+
+// EncodeJSONParams encodes the given request parameters in JSON, as an object whose values are strings, or arrays
+// of strings for repeated parameters.
+func EncodeJSONParams(params url.Values) ([]byte, error) {
+	obj := make(map[string]interface{}, len(params))
+	for k, vs := range params {
+		switch len(vs) {
+		case 0:
+		case 1:
+			obj[k] = vs[0]
+		default:
+			obj[k] = vs
+		}
+	}
+	return json.Marshal(obj)
+}
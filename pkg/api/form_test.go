@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/opentracing/opentracing-go"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/logging"
+)
+
+func TestParseForm(t *testing.T) {
+	for _, tcase := range []struct {
+		name        string
+		contentType string
+		body        string
+		expected    url.Values
+		expectedErr bool
+	}{
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "query=up&match%5B%5D=a&match%5B%5D=b",
+			expected:    url.Values{"query": {"up"}, "match[]": {"a", "b"}, "dedup": {"true"}},
+		},
+		{
+			name:        "JSON",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"query": "up", "match[]": ["a", "b"], "step": 1.5, "partial_response": false}`,
+			expected:    url.Values{"query": {"up"}, "match[]": {"a", "b"}, "step": {"1.5"}, "partial_response": {"false"}, "dedup": {"true"}},
+		},
+		{
+			name:        "empty JSON",
+			contentType: "application/json",
+			expected:    url.Values{"dedup": {"true"}},
+		},
+		{name: "JSON array", contentType: "application/json", body: `["up"]`, expectedErr: true},
+		{name: "JSON object value", contentType: "application/json", body: `{"query": {"expr": "up"}}`, expectedErr: true},
+		{name: "JSON null value", contentType: "application/json", body: `{"query": null}`, expectedErr: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "/api/v1/query?dedup=true", strings.NewReader(tcase.body))
+			testutil.Ok(t, err)
+			r.Header.Set("Content-Type", tcase.contentType)
+
+			err = ParseForm(r)
+			if tcase.expectedErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, r.Form)
+		})
+	}
+}
+
+func TestJSONParamsRoundTrip(t *testing.T) {
+	params := url.Values{"query": {"up"}, "match[]": {"a", "b"}, "empty": {}}
+	body, err := EncodeJSONParams(params)
+	testutil.Ok(t, err)
+
+	decoded, err := DecodeJSONParams(body)
+	testutil.Ok(t, err)
+	testutil.Equals(t, url.Values{"query": {"up"}, "match[]": {"a", "b"}}, decoded)
+}
+
+func TestGetInstr_JSONRequest(t *testing.T) {
+	instr := GetInstr(opentracing.NoopTracer{}, log.NewNopLogger(), extpromhttp.NewNopInstrumentationMiddleware(), logging.NewHTTPServerMiddleware(log.NewNopLogger()), false)
+	h := instr("query", func(r *http.Request) (interface{}, []error, *ApiError, func()) {
+		return r.FormValue("query"), nil, nil, func() {}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(`{"query": "up"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	b, err := io.ReadAll(rec.Body)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"status":"success","data":"up"}`, strings.TrimSpace(string(b)))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(`{"query": `))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	testutil.Equals(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,347 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// Response is the envelope of the responses of the API.
+type Response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// Error is the error of a request the API did not respond to with a 2xx status code.
+type Error struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// ThanosParams are the Thanos specific parameters of query requests. Parameters with zero values are not sent, so
+// that the defaults of the Queriers apply.
+type ThanosParams struct {
+	Dedup                  *bool
+	PartialResponse        *bool
+	MaxSourceResolution    string
+	ResolutionStitchWindow time.Duration
+	ReplicaLabels          []string
+	StoreMatchers          []string
+	Engine                 string
+	SortSeries             *bool
+}
+
+func (p ThanosParams) encode(v url.Values) {
+	setBool(v, "dedup", p.Dedup)
+	setBool(v, "partial_response", p.PartialResponse)
+	setString(v, "max_source_resolution", p.MaxSourceResolution)
+	setDuration(v, "resolution_stitch_window", p.ResolutionStitchWindow)
+	v["replicaLabels[]"] = p.ReplicaLabels
+	v["storeMatch[]"] = p.StoreMatchers
+	setString(v, "engine", p.Engine)
+	setBool(v, "sort_series", p.SortSeries)
+}
+
+// QueryParams are the parameters of instant queries.
+type QueryParams struct {
+	Query string
+	// Time is the evaluation timestamp. The current time is used if zero.
+	Time          time.Time
+	Timeout       time.Duration
+	LookbackDelta time.Duration
+	Analyze       bool
+
+	ThanosParams
+}
+
+func (p QueryParams) encode() url.Values {
+	v := url.Values{"query": []string{p.Query}}
+	setTime(v, "time", p.Time)
+	setDuration(v, "timeout", p.Timeout)
+	setDuration(v, "lookback_delta", p.LookbackDelta)
+	if p.Analyze {
+		v.Set("analyze", "true")
+	}
+	p.ThanosParams.encode(v)
+	return v
+}
+
+// QueryRangeParams are the parameters of range queries.
+type QueryRangeParams struct {
+	Query         string
+	Start, End    time.Time
+	Step          time.Duration
+	Timeout       time.Duration
+	LookbackDelta time.Duration
+	Analyze       bool
+
+	ThanosParams
+}
+
+func (p QueryRangeParams) encode() url.Values {
+	v := url.Values{"query": []string{p.Query}}
+	setTime(v, "start", p.Start)
+	setTime(v, "end", p.End)
+	setDuration(v, "step", p.Step)
+	setDuration(v, "timeout", p.Timeout)
+	setDuration(v, "lookback_delta", p.LookbackDelta)
+	if p.Analyze {
+		v.Set("analyze", "true")
+	}
+	p.ThanosParams.encode(v)
+	return v
+}
+
+// MetadataParams are the parameters of label names, label values and series requests.
+type MetadataParams struct {
+	Matchers        []string
+	Start, End      time.Time
+	Dedup           *bool
+	PartialResponse *bool
+	ReplicaLabels   []string
+	StoreMatchers   []string
+}
+
+func (p MetadataParams) encode() url.Values {
+	v := url.Values{"match[]": p.Matchers}
+	setTime(v, "start", p.Start)
+	setTime(v, "end", p.End)
+	setBool(v, "dedup", p.Dedup)
+	setBool(v, "partial_response", p.PartialResponse)
+	v["replicaLabels[]"] = p.ReplicaLabels
+	v["storeMatch[]"] = p.StoreMatchers
+	return v
+}
+
+// RuleSuggestionsParams are the parameters of recording rule suggestions requests.
+type RuleSuggestionsParams struct {
+	Interval time.Duration
+	Limit    int
+	MinCount int
+	// Format is either json, the default, or yaml.
+	Format string
+}
+
+func (p RuleSuggestionsParams) encode() url.Values {
+	v := url.Values{}
+	if p.Interval > 0 {
+		v.Set("interval", p.Interval.String())
+	}
+	if p.Limit > 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.MinCount > 0 {
+		v.Set("min_count", strconv.Itoa(p.MinCount))
+	}
+	setString(v, "format", p.Format)
+	return v
+}
+
+func setString(v url.Values, k, s string) {
+	if s != "" {
+		v.Set(k, s)
+	}
+}
+
+func setBool(v url.Values, k string, b *bool) {
+	if b != nil {
+		v.Set(k, strconv.FormatBool(*b))
+	}
+}
+
+func setTime(v url.Values, k string, t time.Time) {
+	if !t.IsZero() {
+		v.Set(k, strconv.FormatFloat(float64(t.UnixMilli())/1e3, 'f', -1, 64))
+	}
+}
+
+func setDuration(v url.Values, k string, d time.Duration) {
+	if d > 0 {
+		v.Set(k, strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+	}
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are performed with. http.DefaultClient is used by default.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(cl *Client) {
+		cl.client = c
+	}
+}
+
+// WithHeader sets a header of all requests, e.g. the tenant header.
+func WithHeader(key, value string) ClientOption {
+	return func(cl *Client) {
+		cl.header.Set(key, value)
+	}
+}
+
+// Client is a client of the HTTP API of Query Frontend, with a method per operation of its OpenAPI specification.
+type Client struct {
+	base   *url.URL
+	client *http.Client
+	header http.Header
+}
+
+// NewClient returns a Client of the Query Frontend with the given base URL.
+func NewClient(baseURL string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse base URL")
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("base URL %q must have a scheme and a host", baseURL)
+	}
+	c := &Client{base: u, client: http.DefaultClient, header: http.Header{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Query evaluates an instant query.
+func (c *Client) Query(ctx context.Context, p QueryParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/query", p.encode())
+}
+
+// QueryRange evaluates a range query.
+func (c *Client) QueryRange(ctx context.Context, p QueryRangeParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/query_range", p.encode())
+}
+
+// QueryExplain explains the plan of an instant query.
+func (c *Client) QueryExplain(ctx context.Context, p QueryParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/query_explain", p.encode())
+}
+
+// QueryRangeExplain explains the plan of a range query.
+func (c *Client) QueryRangeExplain(ctx context.Context, p QueryRangeParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/query_range_explain", p.encode())
+}
+
+// Labels returns the label names of the matching series.
+func (c *Client) Labels(ctx context.Context, p MetadataParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/labels", p.encode())
+}
+
+// LabelValues returns the values of the given label of the matching series.
+func (c *Client) LabelValues(ctx context.Context, name string, p MetadataParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/label/"+url.PathEscape(name)+"/values", p.encode())
+}
+
+// Series returns the label sets of the matching series.
+func (c *Client) Series(ctx context.Context, p MetadataParams) (*Response, error) {
+	return c.api(ctx, "/api/v1/series", p.encode())
+}
+
+// RuleSuggestions returns the suggested recording rules. Rule files in YAML are returned as is, in Data.
+func (c *Client) RuleSuggestions(ctx context.Context, p RuleSuggestionsParams) (*Response, error) {
+	if p.Format != "yaml" {
+		return c.api(ctx, "/api/v1/rule_suggestions", p.encode())
+	}
+	body, err := c.get(ctx, "/api/v1/rule_suggestions", p.encode())
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Status: "success", Data: body}, nil
+}
+
+// OpenAPI returns the OpenAPI specification served by the Query Frontend.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	return c.get(ctx, SpecPath, nil)
+}
+
+// Healthy returns nil if the Query Frontend is healthy.
+func (c *Client) Healthy(ctx context.Context) error {
+	_, err := c.get(ctx, "/-/healthy", nil)
+	return err
+}
+
+// Ready returns nil if the Query Frontend is ready to serve traffic.
+func (c *Client) Ready(ctx context.Context) error {
+	_, err := c.get(ctx, "/-/ready", nil)
+	return err
+}
+
+// api performs a request of an API operation, decoding its response envelope.
+func (c *Client) api(ctx context.Context, p string, v url.Values) (*Response, error) {
+	body, err := c.get(ctx, p, v)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, errors.Wrap(err, "decode response")
+	}
+	return &resp, nil
+}
+
+// get performs a GET request, returning the body of 2xx responses and an *Error otherwise.
+func (c *Client) get(ctx context.Context, p string, v url.Values) ([]byte, error) {
+	code, body, err := c.do(ctx, p, v)
+	if err != nil {
+		return nil, err
+	}
+	if code/100 == 2 {
+		return body, nil
+	}
+
+	apiErr := &Error{StatusCode: code, Message: string(body)}
+	var r Response
+	if json.Unmarshal(body, &r) == nil && r.Status == "error" {
+		apiErr.Type, apiErr.Message = r.ErrorType, r.Error
+	}
+	return nil, apiErr
+}
+
+func (c *Client) do(ctx context.Context, p string, v url.Values) (_ int, _ []byte, err error) {
+	u := *c.base
+	u.Path = path.Join(u.Path, p)
+	u.RawQuery = v.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "create request")
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "perform request against %s", u.Redacted())
+	}
+	defer runutil.ExhaustCloseWithErrCapture(&err, resp.Body, "close response body")
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "read response body")
+	}
+	return resp.StatusCode, body, nil
+}
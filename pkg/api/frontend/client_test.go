@@ -0,0 +1,116 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSpec_OperationsHaveClientMethods(t *testing.T) {
+	var s struct {
+		Paths map[string]map[string]struct {
+			OperationID string `yaml:"operationId"`
+		} `yaml:"paths"`
+	}
+	testutil.Ok(t, yaml.Unmarshal(Spec(), &s))
+	testutil.Assert(t, len(s.Paths) > 0)
+
+	clientType := reflect.TypeOf(&Client{})
+	for p, ops := range s.Paths {
+		for method, op := range ops {
+			testutil.Assert(t, op.OperationID != "", "%s %s has no operationId", method, p)
+			_, ok := clientType.MethodByName(op.OperationID)
+			testutil.Assert(t, ok, "operation %s of %s %s has no client method", op.OperationID, method, p)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	var (
+		lastPath   string
+		lastQuery  url.Values
+		lastHeader http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath, lastQuery, lastHeader = r.URL.Path, r.URL.Query(), r.Header
+		switch r.URL.Path {
+		case SpecPath:
+			SpecHandler().ServeHTTP(w, r)
+		case "/prefix/api/v1/query":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"invalid query"}`))
+		case "/prefix/-/ready":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":["a"],"warnings":["w"]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	c, err := NewClient(srv.URL+"/prefix", WithHeader("THANOS-TENANT", "team-a"))
+	testutil.Ok(t, err)
+
+	t.Run("query range", func(t *testing.T) {
+		dedup := false
+		resp, err := c.QueryRange(ctx, QueryRangeParams{
+			Query: "up",
+			Start: time.UnixMilli(1500),
+			End:   time.UnixMilli(3000),
+			Step:  30 * time.Second,
+			ThanosParams: ThanosParams{
+				Dedup:               &dedup,
+				MaxSourceResolution: "auto",
+				ReplicaLabels:       []string{"replica", "rule_replica"},
+				Engine:              "thanos",
+			},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, &Response{Status: "success", Data: []byte(`["a"]`), Warnings: []string{"w"}}, resp)
+
+		testutil.Equals(t, "/prefix/api/v1/query_range", lastPath)
+		testutil.Equals(t, url.Values{
+			"query":                 {"up"},
+			"start":                 {"1.5"},
+			"end":                   {"3"},
+			"step":                  {"30"},
+			"dedup":                 {"false"},
+			"max_source_resolution": {"auto"},
+			"replicaLabels[]":       {"replica", "rule_replica"},
+			"engine":                {"thanos"},
+		}, lastQuery)
+		testutil.Equals(t, "team-a", lastHeader.Get("THANOS-TENANT"))
+	})
+	t.Run("label values", func(t *testing.T) {
+		_, err := c.LabelValues(ctx, "job", MetadataParams{Matchers: []string{`up{env="prod"}`}})
+		testutil.Ok(t, err)
+		testutil.Equals(t, "/prefix/api/v1/label/job/values", lastPath)
+		testutil.Equals(t, url.Values{"match[]": {`up{env="prod"}`}}, lastQuery)
+	})
+	t.Run("api error", func(t *testing.T) {
+		_, err := c.Query(ctx, QueryParams{Query: "up{"})
+		testutil.NotOk(t, err)
+		testutil.Equals(t, &Error{StatusCode: http.StatusBadRequest, Type: "bad_data", Message: "invalid query"}, err)
+	})
+	t.Run("not ready", func(t *testing.T) {
+		testutil.NotOk(t, c.Ready(ctx))
+		testutil.Ok(t, c.Healthy(ctx))
+	})
+	t.Run("spec", func(t *testing.T) {
+		c, err := NewClient(srv.URL)
+		testutil.Ok(t, err)
+		spec, err := c.OpenAPI(ctx)
+		testutil.Ok(t, err)
+		testutil.Equals(t, Spec(), spec)
+	})
+}
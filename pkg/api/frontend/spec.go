@@ -0,0 +1,30 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package frontend provides the OpenAPI specification of the HTTP API of Thanos Query Frontend, and a client
+// implementing its operations.
+package frontend
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// SpecPath is the path the OpenAPI specification is served on.
+const SpecPath = "/api/v1/openapi.yaml"
+
+//go:embed openapi.yaml
+var spec []byte
+
+// Spec returns the OpenAPI specification of the HTTP API of Query Frontend, in YAML.
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler serves the OpenAPI specification.
+func SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(spec)
+	})
+}
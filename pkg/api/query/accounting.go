@@ -0,0 +1,143 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/extpromql"
+)
+
+const (
+	// unattributedOwner is the owner of the selectors without a matcher on the accounting label telling their owner.
+	unattributedOwner = "unattributed"
+	// otherOwner is the owner of the selectors of owners beyond the maximum number of owners accounted for.
+	otherOwner = "other"
+)
+
+// QueryAccounting attributes the queries, their samples and their latency to the owners of the series they select,
+// e.g. teams or lines of business, told by the value of a label of their selectors, such as team="payments". This
+// gives usage attribution without tenancy headers. The owners of the selectors of a query are each accounted for the
+// whole query. A nil QueryAccounting accounts for nothing.
+type QueryAccounting struct {
+	label     string
+	maxOwners int
+
+	mtx    sync.Mutex
+	owners map[string]struct{}
+
+	queries  *prometheus.CounterVec
+	samples  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewQueryAccounting returns a QueryAccounting of the owners told by the given label, accounting for up to the given
+// number of distinct owners, the queries of the next ones being accounted for as "other".
+func NewQueryAccounting(reg prometheus.Registerer, label string, maxOwners int) *QueryAccounting {
+	return &QueryAccounting{
+		label:     label,
+		maxOwners: maxOwners,
+		owners:    map[string]struct{}{},
+		queries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_accounting_queries_total",
+			Help: "The total number of queries selecting series of the owner, told by the value of the accounting label of their selectors.",
+		}, []string{"owner", "handler"}),
+		samples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_accounting_samples_total",
+			Help: "The total number of samples processed by the queries selecting series of the owner.",
+		}, []string{"owner", "handler"}),
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_query_accounting_query_duration_seconds",
+			Help:    "The execution duration of the queries selecting series of the owner.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"owner", "handler"}),
+	}
+}
+
+// observe accounts for the execution of the given query by the given handler to the owners of its selectors.
+func (a *QueryAccounting) observe(handler, queryStr string, qry promql.Query, duration time.Duration) {
+	if a == nil {
+		return
+	}
+	var samples int64
+	if s := qry.Stats(); s != nil && s.Samples != nil {
+		samples = s.Samples.TotalSamples
+	}
+	for _, owner := range a.queryOwners(queryStr) {
+		a.queries.WithLabelValues(owner, handler).Inc()
+		a.samples.WithLabelValues(owner, handler).Add(float64(samples))
+		a.duration.WithLabelValues(owner, handler).Observe(duration.Seconds())
+	}
+}
+
+// queryOwners returns the sorted owners of the selectors of the given query.
+func (a *QueryAccounting) queryOwners(queryStr string) []string {
+	expr, err := extpromql.ParseExpr(queryStr)
+	if err != nil {
+		return []string{unattributedOwner}
+	}
+
+	set := map[string]struct{}{}
+	for _, selector := range parser.ExtractSelectors(expr) {
+		for _, owner := range a.selectorOwners(selector) {
+			set[a.account(owner)] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return []string{unattributedOwner}
+	}
+	owners := make([]string, 0, len(set))
+	for owner := range set {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// selectorOwners returns the owners the matchers of a selector select series of, which are the values of the equality
+// matcher on the accounting label, or of a regular expression matcher matching a set of values.
+func (a *QueryAccounting) selectorOwners(matchers []*labels.Matcher) []string {
+	for _, m := range matchers {
+		if m.Name != a.label {
+			continue
+		}
+		switch m.Type {
+		case labels.MatchEqual:
+			if m.Value != "" {
+				return []string{m.Value}
+			}
+		case labels.MatchRegexp:
+			if values := m.SetMatches(); len(values) > 0 {
+				return values
+			}
+		}
+	}
+	return []string{unattributedOwner}
+}
+
+// account returns the owner the given one is accounted as, bounding the number of owners as they come from queries.
+func (a *QueryAccounting) account(owner string) string {
+	if owner == unattributedOwner {
+		return owner
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if _, ok := a.owners[owner]; ok {
+		return owner
+	}
+	if len(a.owners) >= a.maxOwners {
+		return otherOwner
+	}
+	a.owners[owner] = struct{}{}
+	return owner
+}
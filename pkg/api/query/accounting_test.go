@@ -0,0 +1,72 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestQueryAccounting_QueryOwners(t *testing.T) {
+	a := NewQueryAccounting(prometheus.NewRegistry(), "team", 3)
+	for _, tcase := range []struct {
+		query    string
+		expected []string
+	}{
+		{query: `up{team="a"}`, expected: []string{"a"}},
+		{query: `sum(rate(http_requests_total{team="b"}[5m])) / sum(rate(http_requests_total{team="a"}[5m]))`, expected: []string{"a", "b"}},
+		{query: `up{team=~"a|c"}`, expected: []string{"a", "c"}},
+		{query: `up{team=~"a.*"}`, expected: []string{unattributedOwner}},
+		{query: `up{team!="a"} or up{team="b"}`, expected: []string{"b", unattributedOwner}},
+		{query: `vector(1)`, expected: []string{unattributedOwner}},
+		{query: `up{`, expected: []string{unattributedOwner}},
+		// Owners beyond the maximum number of owners are accounted as other.
+		{query: `up{team="d"}`, expected: []string{otherOwner}},
+		{query: `up{team="c"}`, expected: []string{"c"}},
+	} {
+		testutil.Equals(t, tcase.expected, a.queryOwners(tcase.query), "query %s", tcase.query)
+	}
+}
+
+func TestQueryAccounting_Observe(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, db.Close()) })
+
+	app := db.Appender(context.Background())
+	for _, team := range []string{"a", "b"} {
+		for ts := int64(0); ts < 3; ts++ {
+			_, err := app.Append(0, labels.FromStrings("__name__", "up", "team", team), ts*1000, 1)
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1000, Timeout: time.Minute})
+	query := `sum(count_over_time(up{team="a"}[5s])) + sum(count_over_time(up{team="b"}[5s]))`
+	qry, err := engine.NewInstantQuery(context.Background(), db, nil, query, time.Unix(3, 0))
+	testutil.Ok(t, err)
+	testutil.Ok(t, qry.Exec(context.Background()).Err)
+
+	a := NewQueryAccounting(prometheus.NewRegistry(), "team", 10)
+	a.observe("query", query, qry, time.Second)
+	for _, team := range []string{"a", "b"} {
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(a.queries.WithLabelValues(team, "query")))
+		testutil.Equals(t, 6.0, promtestutil.ToFloat64(a.samples.WithLabelValues(team, "query")))
+	}
+	testutil.Equals(t, 2, promtestutil.CollectAndCount(a.duration))
+
+	// A nil QueryAccounting accounts for nothing.
+	var nilAccounting *QueryAccounting
+	nilAccounting.observe("query", query, qry, time.Second)
+}
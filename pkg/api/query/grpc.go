@@ -88,6 +88,7 @@ func (g *GRPCAPI) Query(request *querypb.QueryRequest, server querypb.Query_Quer
 		replicaLabels,
 		storeMatchers,
 		maxResolution,
+		0,
 		request.EnablePartialResponse,
 		false,
 		request.ShardInfo,
@@ -208,6 +209,7 @@ func (g *GRPCAPI) QueryRange(request *querypb.QueryRangeRequest, srv querypb.Que
 		replicaLabels,
 		storeMatchers,
 		maxResolution,
+		0,
 		request.EnablePartialResponse,
 		false,
 		request.ShardInfo,
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/route"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/cache"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// MetadataCache caches the responses of the labels, label values and series APIs, for deployments without
+// a query frontend caching them. Responses are cached by endpoint, tenant and request parameters, which include
+// the matchers and the time range. Responses with warnings, e.g. partial responses, are not cached.
+// A nil MetadataCache caches nothing.
+type MetadataCache struct {
+	logger log.Logger
+	cache  cache.Cache
+	ttl    time.Duration
+
+	requests *prometheus.CounterVec
+	hits     *prometheus.CounterVec
+}
+
+// NewMetadataCache returns a new MetadataCache, storing responses in the given cache for the given TTL.
+func NewMetadataCache(logger log.Logger, c cache.Cache, ttl time.Duration, reg prometheus.Registerer) *MetadataCache {
+	return &MetadataCache{
+		logger: logger,
+		cache:  c,
+		ttl:    ttl,
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_metadata_cache_requests_total",
+			Help: "Total number of metadata API requests looked up in the metadata cache, by handler.",
+		}, []string{"handler"}),
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_metadata_cache_hits_total",
+			Help: "Total number of metadata API requests served from the metadata cache, by handler.",
+		}, []string{"handler"}),
+	}
+}
+
+// cachedMetadata wraps the given metadata handler, whose responses are of type T, serving them from the cache.
+func cachedMetadata[T any](qapi *QueryAPI, name string, f api.ApiFunc) api.ApiFunc {
+	c := qapi.metadataCache
+	if c == nil {
+		return f
+	}
+	return func(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+		key, err := qapi.metadataCacheKey(name, r)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+		}
+
+		c.requests.WithLabelValues(name).Inc()
+		if b, ok := c.cache.Fetch(r.Context(), []string{key})[key]; ok {
+			var data T
+			if err := json.Unmarshal(b, &data); err == nil {
+				c.hits.WithLabelValues(name).Inc()
+				return data, nil, nil, func() {}
+			}
+			level.Warn(c.logger).Log("msg", "failed to decode cached metadata response", "handler", name, "err", err)
+		}
+
+		data, warnings, apiErr, releaseResources := f(r)
+		if apiErr != nil || len(warnings) > 0 {
+			return data, warnings, apiErr, releaseResources
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "failed to encode metadata response to cache", "handler", name, "err", err)
+			return data, warnings, apiErr, releaseResources
+		}
+		c.cache.Store(map[string][]byte{key: b}, c.ttl)
+		return data, warnings, apiErr, releaseResources
+	}
+}
+
+// metadataCacheKey returns the cache key of the metadata request: a hash of the handler, the tenant, the path
+// parameters and the sorted request parameters.
+func (qapi *QueryAPI) metadataCacheKey(name string, r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", errors.Wrap(err, "parse form")
+	}
+	tenant, err := tenancy.GetTenantFromHTTP(r, qapi.tenantHeader, qapi.defaultTenant, qapi.tenantCertField)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(r.Form))
+	for k := range r.Form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	write := func(s string) {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0xff})
+	}
+	write(name)
+	write(tenant)
+	write(route.Param(r.Context(), "name"))
+	for _, k := range keys {
+		// The order of matchers and other repeated parameters doesn't change the response.
+		vals := append([]string(nil), r.Form[k]...)
+		sort.Strings(vals)
+		write(k)
+		for _, v := range vals {
+			write(v)
+		}
+	}
+	return "metadata:" + hex.EncodeToString(h.Sum(nil)), nil
+}
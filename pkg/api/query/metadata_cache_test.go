@@ -0,0 +1,72 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/cache"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestMetadataCache(t *testing.T) {
+	c, err := cache.NewInMemoryCacheWithConfig("test", log.NewNopLogger(), nil, cache.DefaultInMemoryCacheConfig)
+	testutil.Ok(t, err)
+	qapi := &QueryAPI{
+		tenantHeader:  tenancy.DefaultTenantHeader,
+		defaultTenant: tenancy.DefaultTenant,
+		metadataCache: NewMetadataCache(log.NewNopLogger(), c, time.Minute, prometheus.NewRegistry()),
+	}
+
+	var (
+		calls    int
+		warnings []error
+	)
+	handler := cachedMetadata[[]labels.Labels](qapi, "series", func(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+		calls++
+		return []labels.Labels{labels.FromStrings("__name__", "up", "tenant", r.Header.Get(tenancy.DefaultTenantHeader))}, warnings, nil, func() {}
+	})
+	get := func(tenant, name, query string) interface{} {
+		r := httptest.NewRequest("GET", "/api/v1/series?"+query, nil)
+		r = r.WithContext(route.WithParam(r.Context(), "name", name))
+		if tenant != "" {
+			r.Header.Set(tenancy.DefaultTenantHeader, tenant)
+		}
+		data, _, apiErr, _ := handler(r)
+		testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+		return data
+	}
+
+	expected := []labels.Labels{labels.FromStrings("__name__", "up", "tenant", "a")}
+	testutil.Equals(t, expected, get("a", "", "match[]=up&match[]=down&start=1&end=2"))
+	// The order of parameters doesn't matter.
+	testutil.Equals(t, expected, get("a", "", "end=2&match[]=down&match[]=up&start=1"))
+	testutil.Equals(t, 1, calls)
+
+	// Tenants, path and request parameters are cached separately.
+	testutil.Equals(t, []labels.Labels{labels.FromStrings("__name__", "up", "tenant", "b")}, get("b", "", "match[]=up&match[]=down&start=1&end=2"))
+	get("a", "job", "match[]=up&match[]=down&start=1&end=2")
+	get("a", "", "match[]=up&match[]=down&start=1&end=3")
+	testutil.Equals(t, 4, calls)
+	testutil.Equals(t, 5.0, promtestutil.ToFloat64(qapi.metadataCache.requests.WithLabelValues("series")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(qapi.metadataCache.hits.WithLabelValues("series")))
+
+	// Responses with warnings are not cached.
+	warnings = []error{errors.New("partial response")}
+	get("a", "", "match[]=up")
+	get("a", "", "match[]=up")
+	testutil.Equals(t, 6, calls)
+}
@@ -21,6 +21,7 @@ package v1
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"math"
 	"net/http"
@@ -49,8 +50,10 @@ import (
 	"github.com/thanos-io/promql-engine/logicalplan"
 
 	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/exemplars"
 	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/extannotations"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/extpromql"
 	"github.com/thanos-io/thanos/pkg/gate"
@@ -62,6 +65,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/targets"
 	"github.com/thanos-io/thanos/pkg/targets/targetspb"
@@ -73,6 +77,7 @@ const (
 	DedupParam               = "dedup"
 	PartialResponseParam     = "partial_response"
 	MaxSourceResolutionParam = "max_source_resolution"
+	StitchWindowParam        = "resolution_stitch_window"
 	ReplicaLabelsParam       = "replicaLabels[]"
 	MatcherParam             = "match[]"
 	StoreMatcherParam        = "storeMatch[]"
@@ -82,6 +87,7 @@ const (
 	LookbackDeltaParam       = "lookback_delta"
 	EngineParam              = "engine"
 	QueryAnalyzeParam        = "analyze"
+	SortSeriesParam          = "sort_series"
 )
 
 type PromqlEngineType string
@@ -178,8 +184,11 @@ type QueryAPI struct {
 	defaultRangeQueryStep                  time.Duration
 	defaultInstantQueryMaxSourceResolution time.Duration
 	defaultMetadataTimeRange               time.Duration
+	defaultStitchWindow                    time.Duration
+	defaultSortSeries                      bool
 
 	queryRangeHist prometheus.Histogram
+	warningsTotal  *prometheus.CounterVec
 
 	seriesStatsAggregatorFactory store.SeriesQueryPerformanceMetricsAggregatorFactory
 
@@ -188,6 +197,20 @@ type QueryAPI struct {
 	tenantCertField string
 	enforceTenancy  bool
 	tenantLabel     string
+
+	metadataCache *MetadataCache
+
+	// tenantEvaluationIntervals holds the default subquery evaluation interval of tenants which don't use the one of the engine.
+	tenantEvaluationIntervals map[string]time.Duration
+
+	// downsampleRetry enables the retry of queries exceeding samples limits at the next downsampling levels, unless
+	// overridden for the tenant by tenantDownsampleRetry.
+	downsampleRetry       bool
+	tenantDownsampleRetry map[string]bool
+	downsampleRetries     *prometheus.CounterVec
+
+	// accounting attributes the queries to the owners of the series they select, if set.
+	accounting *QueryAccounting
 }
 
 // NewQueryAPI returns an initialized QueryAPI type.
@@ -213,6 +236,8 @@ func NewQueryAPI(
 	defaultRangeQueryStep time.Duration,
 	defaultInstantQueryMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
+	defaultStitchWindow time.Duration,
+	defaultSortSeries bool,
 	disableCORS bool,
 	gate gate.Gate,
 	statsAggregatorFactory store.SeriesQueryPerformanceMetricsAggregatorFactory,
@@ -222,6 +247,11 @@ func NewQueryAPI(
 	tenantCertField string,
 	enforceTenancy bool,
 	tenantLabel string,
+	metadataCache *MetadataCache,
+	tenantEvaluationIntervals map[string]time.Duration,
+	downsampleRetry bool,
+	tenantDownsampleRetry map[string]bool,
+	accounting *QueryAccounting,
 ) *QueryAPI {
 	if statsAggregatorFactory == nil {
 		statsAggregatorFactory = &store.NoopSeriesStatsAggregatorFactory{}
@@ -249,6 +279,8 @@ func NewQueryAPI(
 		defaultRangeQueryStep:                  defaultRangeQueryStep,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
 		defaultMetadataTimeRange:               defaultMetadataTimeRange,
+		defaultStitchWindow:                    defaultStitchWindow,
+		defaultSortSeries:                      defaultSortSeries,
 		disableCORS:                            disableCORS,
 		seriesStatsAggregatorFactory:           statsAggregatorFactory,
 		tenantHeader:                           tenantHeader,
@@ -256,12 +288,25 @@ func NewQueryAPI(
 		tenantCertField:                        tenantCertField,
 		enforceTenancy:                         enforceTenancy,
 		tenantLabel:                            tenantLabel,
+		metadataCache:                          metadataCache,
+		tenantEvaluationIntervals:              tenantEvaluationIntervals,
+		downsampleRetry:                        downsampleRetry,
+		tenantDownsampleRetry:                  tenantDownsampleRetry,
+		accounting:                             accounting,
 
 		queryRangeHist: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 			Name:    "thanos_query_range_requested_timespan_duration_seconds",
 			Help:    "A histogram of the query range window in seconds",
 			Buckets: prometheus.ExponentialBuckets(15*60, 2, 12),
 		}),
+		warningsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_api_warnings_total",
+			Help: "Total number of deduplicated warnings returned by the query API, by handler and category.",
+		}, []string{"handler", "category"}),
+		downsampleRetries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_downsample_retries_total",
+			Help: "Total number of queries exceeding samples limits retried at a downsampling level, by max source resolution of the retry.",
+		}, []string{"resolution"}),
 	}
 }
 
@@ -269,7 +314,10 @@ func NewQueryAPI(
 func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware, logMiddleware *logging.HTTPServerMiddleware) {
 	qapi.baseAPI.Register(r, tracer, logger, ins, logMiddleware)
 
-	instr := api.GetInstr(tracer, logger, ins, logMiddleware, qapi.disableCORS)
+	apiInstr := api.GetInstr(tracer, logger, ins, logMiddleware, qapi.disableCORS)
+	instr := func(name string, f api.ApiFunc) http.HandlerFunc {
+		return apiInstr(name, qapi.dedupWarnings(name, f))
+	}
 
 	r.Get("/query", instr("query", qapi.query))
 	r.Post("/query", instr("query", qapi.query))
@@ -283,13 +331,13 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Get("/query_range_explain", instr("query", qapi.queryRangeExplain))
 	r.Post("/query_range_explain", instr("query", qapi.queryRangeExplain))
 
-	r.Get("/label/:name/values", instr("label_values", qapi.labelValues))
+	r.Get("/label/:name/values", instr("label_values", cachedMetadata[[]string](qapi, "label_values", qapi.labelValues)))
 
-	r.Get("/series", instr("series", qapi.series))
-	r.Post("/series", instr("series", qapi.series))
+	r.Get("/series", instr("series", cachedMetadata[[]labels.Labels](qapi, "series", qapi.series)))
+	r.Post("/series", instr("series", cachedMetadata[[]labels.Labels](qapi, "series", qapi.series)))
 
-	r.Get("/labels", instr("label_names", qapi.labelNames))
-	r.Post("/labels", instr("label_names", qapi.labelNames))
+	r.Get("/labels", instr("label_names", cachedMetadata[[]string](qapi, "label_names", qapi.labelNames)))
+	r.Post("/labels", instr("label_names", cachedMetadata[[]string](qapi, "label_names", qapi.labelNames)))
 
 	r.Get("/stores", instr("stores", qapi.stores))
 
@@ -304,6 +352,18 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Post("/query_exemplars", instr("exemplars", NewExemplarsHandler(qapi.exemplars, qapi.enableExemplarPartialResponse)))
 }
 
+// dedupWarnings wraps the given handler, deduplicating its warnings and counting them by category.
+func (qapi *QueryAPI) dedupWarnings(name string, f api.ApiFunc) api.ApiFunc {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+		data, warnings, apiErr, releaseResources := f(r)
+		warnings = extannotations.Dedup(warnings)
+		for _, w := range warnings {
+			qapi.warningsTotal.WithLabelValues(name, extannotations.Category(w.Error())).Inc()
+		}
+		return data, warnings, apiErr, releaseResources
+	}
+}
+
 type queryData struct {
 	ResultType parser.ValueType `json:"resultType"`
 	Result     parser.Value     `json:"result"`
@@ -311,6 +371,17 @@ type queryData struct {
 	// Additional Thanos Response field.
 	QueryAnalysis queryTelemetry `json:"analysis,omitempty"`
 	Warnings      []error        `json:"warnings,omitempty"`
+	// DownsampleRetry is set if the query exceeded samples limits and its result is the one of a retry at a
+	// downsampling level.
+	DownsampleRetry *downsampleRetryData `json:"downsampleRetry,omitempty"`
+}
+
+// downsampleRetryData describes the retry of a query exceeding samples limits at a downsampling level.
+type downsampleRetryData struct {
+	// MaxSourceResolution is the max source resolution the query was retried at.
+	MaxSourceResolution string `json:"maxSourceResolution"`
+	// Reason is the error of the query at the requested max source resolution.
+	Reason string `json:"reason"`
 }
 
 type queryTelemetry struct {
@@ -421,6 +492,23 @@ func (qapi *QueryAPI) parseDownsamplingParamMillis(r *http.Request, defaultVal t
 	return int64(maxSourceResolution / time.Millisecond), nil
 }
 
+func (qapi *QueryAPI) parseStitchWindowParamMillis(r *http.Request) (int64, *api.ApiError) {
+	stitchWindow := qapi.defaultStitchWindow
+	if val := r.FormValue(StitchWindowParam); val != "" {
+		var err error
+		stitchWindow, err = parseDuration(val)
+		if err != nil {
+			return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", StitchWindowParam)}
+		}
+	}
+
+	if stitchWindow < 0 {
+		return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("negative '%s' is not accepted. Try a positive integer", StitchWindowParam)}
+	}
+
+	return int64(stitchWindow / time.Millisecond), nil
+}
+
 func (qapi *QueryAPI) parsePartialResponseParam(r *http.Request, defaultEnablePartialResponse bool) (enablePartialResponse bool, _ *api.ApiError) {
 	// Overwrite the cli flag when provided as a query parameter.
 	if val := r.FormValue(PartialResponseParam); val != "" {
@@ -433,6 +521,18 @@ func (qapi *QueryAPI) parsePartialResponseParam(r *http.Request, defaultEnablePa
 	return defaultEnablePartialResponse, nil
 }
 
+func (qapi *QueryAPI) parseSortSeriesParam(r *http.Request) (bool, *api.ApiError) {
+	val := r.FormValue(SortSeriesParam)
+	if val == "" {
+		return qapi.defaultSortSeries, nil
+	}
+	sortSeries, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", SortSeriesParam)}
+	}
+	return sortSeries, nil
+}
+
 func (qapi *QueryAPI) parseStep(r *http.Request, defaultRangeQueryStep time.Duration, rangeSeconds int64) (time.Duration, *api.ApiError) {
 	// Overwrite the cli flag when provided as a query parameter.
 	if val := r.FormValue(Step); val != "" {
@@ -548,6 +648,11 @@ func (qapi *QueryAPI) queryExplain(r *http.Request) (interface{}, []error, *api.
 		return nil, nil, apiErr, func() {}
 	}
 
+	stitchWindow, apiErr := qapi.parseStitchWindowParamMillis(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	shardInfo, apiErr := qapi.parseShardInfo(r)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
@@ -578,13 +683,14 @@ func (qapi *QueryAPI) queryExplain(r *http.Request) (interface{}, []error, *api.
 			replicaLabels,
 			storeDebugMatchers,
 			maxSourceResolution,
+			stitchWindow,
 			enablePartialResponse,
 			false,
 			shardInfo,
 			query.NewAggregateStatsReporter(&seriesStats),
 		),
 		promql.NewPrometheusQueryOpts(false, lookbackDelta),
-		r.FormValue("query"),
+		qapi.withTenantSubqueryStep(tenant, r.FormValue("query")),
 		ts,
 	)
 
@@ -643,6 +749,11 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		return nil, nil, apiErr, func() {}
 	}
 
+	stitchWindow, apiErr := qapi.parseStitchWindowParamMillis(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	shardInfo, apiErr := qapi.parseShardInfo(r)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
@@ -653,34 +764,41 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		return nil, nil, apiErr, func() {}
 	}
 
-	lookbackDelta := qapi.lookbackDeltaCreate(maxSourceResolution)
+	sortSeries, apiErr := qapi.parseSortSeriesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	// Get custom lookback delta from request.
 	lookbackDeltaFromReq, apiErr := qapi.parseLookbackDeltaParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
 	}
-	if lookbackDeltaFromReq > 0 {
-		lookbackDelta = lookbackDeltaFromReq
-	}
 
 	queryStr, tenant, ctx, err := tenancy.RewritePromQL(ctx, r, qapi.tenantHeader, qapi.defaultTenant, qapi.tenantCertField, qapi.enforceTenancy, qapi.tenantLabel, r.FormValue("query"))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
 	}
+	queryStr = qapi.withTenantSubqueryStep(tenant, queryStr)
 
 	var (
 		qry         promql.Query
 		seriesStats []storepb.SeriesStatsCounter
 	)
-	if err := tracing.DoInSpanWithErr(ctx, "instant_query_create", func(ctx context.Context) error {
-		var err error
-		qry, err = engine.NewInstantQuery(
+	newQuery := func(ctx context.Context, maxSourceResolution int64) (promql.Query, error) {
+		lookbackDelta := qapi.lookbackDeltaCreate(maxSourceResolution)
+		if lookbackDeltaFromReq > 0 {
+			lookbackDelta = lookbackDeltaFromReq
+		}
+		seriesStats = seriesStats[:0]
+		return engine.NewInstantQuery(
 			ctx,
 			qapi.queryableCreate(
 				enableDedup,
 				replicaLabels,
 				storeDebugMatchers,
 				maxSourceResolution,
+				stitchWindow,
 				enablePartialResponse,
 				false,
 				shardInfo,
@@ -690,6 +808,10 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 			queryStr,
 			ts,
 		)
+	}
+	if err := tracing.DoInSpanWithErr(ctx, "instant_query_create", func(ctx context.Context) error {
+		var err error
+		qry, err = newQuery(ctx, maxSourceResolution)
 		return err
 	}); err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
@@ -706,10 +828,8 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	defer qapi.gate.Done()
 	beforeRange := time.Now()
 
-	var res *promql.Result
-	tracing.DoInSpan(ctx, "instant_query_exec", func(ctx context.Context) {
-		res = qry.Exec(ctx)
-	})
+	qry, res, downsampleRetry := qapi.execWithDownsampleRetry(ctx, "instant_query_exec", tenant, qry, maxSourceResolution, newQuery)
+	qapi.accounting.observe("query", queryStr, qry, time.Since(beforeRange))
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -733,14 +853,153 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	if r.FormValue(Stats) != "" {
 		qs = stats.NewQueryStats(qry.Stats())
 	}
+	if sortSeries {
+		sortResultSeries(queryStr, res.Value)
+	}
 	return &queryData{
-		ResultType:    res.Value.Type(),
-		Result:        res.Value,
-		Stats:         qs,
-		QueryAnalysis: analysis,
+		ResultType:      res.Value.Type(),
+		Result:          res.Value,
+		Stats:           qs,
+		QueryAnalysis:   analysis,
+		DownsampleRetry: downsampleRetry,
 	}, res.Warnings.AsErrors(), nil, qry.Close
 }
 
+// execWithDownsampleRetry executes the given query and, if it exceeds samples limits at a resolution finer than a
+// downsampling level and retries are enabled for the tenant, the queries created by newQuery at the next downsampling
+// levels until one succeeds. The result of a retry has a warning, and its downsampleRetryData is returned; the error
+// of the last retry is returned if they all fail. The returned query is the one of the result, which must be closed.
+func (qapi *QueryAPI) execWithDownsampleRetry(
+	ctx context.Context,
+	spanName string,
+	tenant string,
+	qry promql.Query,
+	maxSourceResolution int64,
+	newQuery func(ctx context.Context, maxSourceResolution int64) (promql.Query, error),
+) (promql.Query, *promql.Result, *downsampleRetryData) {
+	var res *promql.Result
+	tracing.DoInSpan(ctx, spanName, func(ctx context.Context) {
+		res = qry.Exec(ctx)
+	})
+	if !qapi.downsampleRetryEnabled(tenant) {
+		return qry, res, nil
+	}
+
+	var retry *downsampleRetryData
+	for res.Err != nil && isSamplesLimitError(res.Err) {
+		resolution, ok := nextDownsampleResolution(maxSourceResolution)
+		if !ok {
+			break
+		}
+		retryQry, err := newQuery(ctx, resolution)
+		if err != nil {
+			break
+		}
+		if retry == nil {
+			retry = &downsampleRetryData{Reason: res.Err.Error()}
+		}
+		qry.Close()
+		qry, maxSourceResolution = retryQry, resolution
+		retry.MaxSourceResolution = model.Duration(time.Duration(resolution) * time.Millisecond).String()
+		qapi.downsampleRetries.WithLabelValues(retry.MaxSourceResolution).Inc()
+
+		tracing.DoInSpan(ctx, spanName+"_downsample_retry", func(ctx context.Context) {
+			res = qry.Exec(ctx)
+		})
+	}
+	if res.Err != nil || retry == nil {
+		return qry, res, nil
+	}
+	res.Warnings.Add(errors.Errorf("query exceeded samples limits (%s), results are from data downsampled to %s", retry.Reason, retry.MaxSourceResolution))
+	return qry, res, retry
+}
+
+// downsampleRetryEnabled returns true if queries of the tenant exceeding samples limits are retried at the next
+// downsampling levels.
+func (qapi *QueryAPI) downsampleRetryEnabled(tenant string) bool {
+	if enabled, ok := qapi.tenantDownsampleRetry[tenant]; ok {
+		return enabled
+	}
+	return qapi.downsampleRetry
+}
+
+// nextDownsampleResolution returns the resolution of the first downsampling level coarser than the given max source
+// resolution, if any.
+func nextDownsampleResolution(maxSourceResolution int64) (int64, bool) {
+	for _, resolution := range []int64{downsample.ResLevel1, downsample.ResLevel2} {
+		if maxSourceResolution < resolution {
+			return resolution, true
+		}
+	}
+	return 0, false
+}
+
+// isSamplesLimitError returns true if the error is the one of a query loading more samples than the engine allows, or
+// than the chunks or samples limits of stores allow.
+func isSamplesLimitError(err error) bool {
+	var tooManySamples promql.ErrTooManySamples
+	if errors.As(err, &tooManySamples) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "exceeded chunks limit") || strings.Contains(msg, "failed to send samples")
+}
+
+// withTenantSubqueryStep sets the step of the subqueries of the query which have none to the evaluation interval of
+// the tenant, when it is configured, instead of the default evaluation interval of the engine. As subqueries are
+// evaluated at multiples of their step, this also aligns them on the evaluation interval of the tenant.
+// Queries which can't be parsed are returned as they are, for the engine to report the error.
+func (qapi *QueryAPI) withTenantSubqueryStep(tenant, queryStr string) string {
+	interval, ok := qapi.tenantEvaluationIntervals[tenant]
+	if !ok {
+		return queryStr
+	}
+	expr, err := extpromql.ParseExpr(queryStr)
+	if err != nil {
+		return queryStr
+	}
+
+	var rewritten bool
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if sq, ok := node.(*parser.SubqueryExpr); ok && sq.Step == 0 {
+			sq.Step = interval
+			rewritten = true
+		}
+		return nil
+	})
+	if !rewritten {
+		return queryStr
+	}
+	return expr.String()
+}
+
+// sortResultSeries sorts the series of vector and matrix results by labels, so that results do not depend on the order
+// series are received from stores in. Vectors of queries sorted by the sort functions are left as they are.
+func sortResultSeries(query string, v parser.Value) {
+	switch v := v.(type) {
+	case promql.Vector:
+		if expr, err := parser.ParseExpr(query); err == nil && isSortedExpr(expr) {
+			return
+		}
+		sort.Slice(v, func(i, j int) bool { return labels.Compare(v[i].Metric, v[j].Metric) < 0 })
+	case promql.Matrix:
+		sort.Sort(v)
+	}
+}
+
+func isSortedExpr(expr parser.Expr) bool {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return isSortedExpr(e.Expr)
+	case *parser.Call:
+		switch e.Func.Name {
+		case "sort", "sort_desc", "sort_by_label", "sort_by_label_desc":
+			return true
+		}
+	}
+	return false
+}
+
 func (qapi *QueryAPI) queryRangeExplain(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
 	engine, engineParam, apiErr := qapi.parseEngineParam(r)
 	if apiErr != nil {
@@ -814,6 +1073,11 @@ func (qapi *QueryAPI) queryRangeExplain(r *http.Request) (interface{}, []error,
 		return nil, nil, apiErr, func() {}
 	}
 
+	stitchWindow, apiErr := qapi.parseStitchWindowParamMillis(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
@@ -849,13 +1113,14 @@ func (qapi *QueryAPI) queryRangeExplain(r *http.Request) (interface{}, []error,
 			replicaLabels,
 			storeDebugMatchers,
 			maxSourceResolution,
+			stitchWindow,
 			enablePartialResponse,
 			false,
 			shardInfo,
 			query.NewAggregateStatsReporter(&seriesStats),
 		),
 		promql.NewPrometheusQueryOpts(false, lookbackDelta),
-		r.FormValue("query"),
+		qapi.withTenantSubqueryStep(tenant, r.FormValue("query")),
 		start,
 		end,
 		step,
@@ -936,6 +1201,11 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr, func() {}
 	}
 
+	stitchWindow, apiErr := qapi.parseStitchWindowParamMillis(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
@@ -951,20 +1221,22 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr, func() {}
 	}
 
-	lookbackDelta := qapi.lookbackDeltaCreate(maxSourceResolution)
+	sortSeries, apiErr := qapi.parseSortSeriesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr, func() {}
+	}
+
 	// Get custom lookback delta from request.
 	lookbackDeltaFromReq, apiErr := qapi.parseLookbackDeltaParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr, func() {}
 	}
-	if lookbackDeltaFromReq > 0 {
-		lookbackDelta = lookbackDeltaFromReq
-	}
 
 	queryStr, tenant, ctx, err := tenancy.RewritePromQL(ctx, r, qapi.tenantHeader, qapi.defaultTenant, qapi.tenantCertField, qapi.enforceTenancy, qapi.tenantLabel, r.FormValue("query"))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
 	}
+	queryStr = qapi.withTenantSubqueryStep(tenant, queryStr)
 
 	// Record the query range requested.
 	qapi.queryRangeHist.Observe(end.Sub(start).Seconds())
@@ -973,15 +1245,20 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		qry         promql.Query
 		seriesStats []storepb.SeriesStatsCounter
 	)
-	if err := tracing.DoInSpanWithErr(ctx, "range_query_create", func(ctx context.Context) error {
-		var err error
-		qry, err = engine.NewRangeQuery(
+	newQuery := func(ctx context.Context, maxSourceResolution int64) (promql.Query, error) {
+		lookbackDelta := qapi.lookbackDeltaCreate(maxSourceResolution)
+		if lookbackDeltaFromReq > 0 {
+			lookbackDelta = lookbackDeltaFromReq
+		}
+		seriesStats = seriesStats[:0]
+		return engine.NewRangeQuery(
 			ctx,
 			qapi.queryableCreate(
 				enableDedup,
 				replicaLabels,
 				storeDebugMatchers,
 				maxSourceResolution,
+				stitchWindow,
 				enablePartialResponse,
 				false,
 				shardInfo,
@@ -993,6 +1270,10 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 			end,
 			step,
 		)
+	}
+	if err := tracing.DoInSpanWithErr(ctx, "range_query_create", func(ctx context.Context) error {
+		var err error
+		qry, err = newQuery(ctx, maxSourceResolution)
 		return err
 	}); err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
@@ -1007,11 +1288,9 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	}
 	defer qapi.gate.Done()
 
-	var res *promql.Result
-	tracing.DoInSpan(ctx, "range_query_exec", func(ctx context.Context) {
-		res = qry.Exec(ctx)
-
-	})
+	beforeExec := time.Now()
+	qry, res, downsampleRetry := qapi.execWithDownsampleRetry(ctx, "range_query_exec", tenant, qry, maxSourceResolution, newQuery)
+	qapi.accounting.observe("query_range", queryStr, qry, time.Since(beforeExec))
 	beforeRange := time.Now()
 	if res.Err != nil {
 		switch res.Err.(type) {
@@ -1033,11 +1312,15 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	if r.FormValue(Stats) != "" {
 		qs = stats.NewQueryStats(qry.Stats())
 	}
+	if sortSeries {
+		sortResultSeries(queryStr, res.Value)
+	}
 	return &queryData{
-		ResultType:    res.Value.Type(),
-		Result:        res.Value,
-		Stats:         qs,
-		QueryAnalysis: analysis,
+		ResultType:      res.Value.Type(),
+		Result:          res.Value,
+		Stats:           qs,
+		QueryAnalysis:   analysis,
+		DownsampleRetry: downsampleRetry,
 	}, res.Warnings.AsErrors(), nil, qry.Close
 }
 
@@ -1075,6 +1358,7 @@ func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.A
 		nil,
 		storeDebugMatchers,
 		0,
+		0,
 		enablePartialResponse,
 		true,
 		nil,
@@ -1167,6 +1451,7 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		replicaLabels,
 		storeDebugMatchers,
 		math.MaxInt64,
+		0,
 		enablePartialResponse,
 		true,
 		nil,
@@ -1223,6 +1508,7 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 		nil,
 		storeDebugMatchers,
 		0,
+		0,
 		enablePartialResponse,
 		true,
 		nil,
@@ -1333,6 +1619,31 @@ func NewAlertsHandler(client rules.UnaryClient, enablePartialResponse bool) func
 			err      error
 		)
 
+		sortBy := r.FormValue("sort")
+		if sortBy != "" && sortBy != alertsSortActiveAt && sortBy != alertsSortActiveAtDesc && sortBy != alertsSortSeverity {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid sort parameter '%v', expected '%s', '%s' or '%s'", sortBy, alertsSortActiveAt, alertsSortActiveAtDesc, alertsSortSeverity)}, func() {}
+		}
+		var limit int64
+		if v := r.FormValue("limit"); v != "" {
+			limit, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || limit <= 0 {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid limit parameter '%v', it has to be a positive integer", v)}, func() {}
+			}
+		}
+		var nextToken *alertKey
+		if v := r.FormValue("next_token"); v != "" {
+			if limit == 0 {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("limit parameter is required to paginate over alerts")}, func() {}
+			}
+			if nextToken, err = parseAlertKey(v); err != nil {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "invalid next_token parameter")}, func() {}
+			}
+		}
+		// Alerts are paginated in a stable order.
+		if sortBy == "" && limit > 0 {
+			sortBy = alertsSortActiveAt
+		}
+
 		// TODO(bwplotka): Allow exactly the same functionality as query API: passing replica, dedup and partial response as HTTP params as well.
 		req := &rulespb.RulesRequest{
 			Type:                    rulespb.RulesRequest_ALERT,
@@ -1346,21 +1657,137 @@ func NewAlertsHandler(client rules.UnaryClient, enablePartialResponse bool) func
 		}
 
 		var resp struct {
-			Alerts []*rulespb.AlertInstance `json:"alerts"`
+			Alerts    []*rulespb.AlertInstance `json:"alerts"`
+			NextToken string                   `json:"nextToken,omitempty"`
 		}
+		var keyed []keyedAlert
 		for _, g := range groups.Groups {
 			for _, r := range g.Rules {
 				a := r.GetAlert()
 				if a == nil {
 					continue
 				}
-				resp.Alerts = append(resp.Alerts, a.Alerts...)
+				if sortBy == "" {
+					resp.Alerts = append(resp.Alerts, a.Alerts...)
+					continue
+				}
+				for _, inst := range a.Alerts {
+					keyed = append(keyed, keyedAlert{key: newAlertKey(sortBy, g, inst), alert: inst})
+				}
 			}
 		}
+		if sortBy == "" {
+			return resp, warnings.AsErrors(), nil, func() {}
+		}
+
+		sort.Slice(keyed, func(i, j int) bool { return keyed[i].key.compare(keyed[j].key) < 0 })
+		if nextToken != nil {
+			keyed = keyed[sort.Search(len(keyed), func(i int) bool { return keyed[i].key.compare(*nextToken) > 0 }):]
+		}
+		if limit > 0 && int64(len(keyed)) > limit {
+			keyed = keyed[:limit]
+			resp.NextToken = keyed[limit-1].key.String()
+		}
+		for _, k := range keyed {
+			resp.Alerts = append(resp.Alerts, k.alert)
+		}
 		return resp, warnings.AsErrors(), nil, func() {}
 	}
 }
 
+// Sort orders of the alerts API.
+const (
+	// alertsSortActiveAt sorts alerts by the time they became active, the oldest first.
+	alertsSortActiveAt = "active_at"
+	// alertsSortActiveAtDesc sorts alerts by the time they became active, the most recent first.
+	alertsSortActiveAtDesc = "-active_at"
+	// alertsSortSeverity sorts alerts by their severity label, the most severe first, then the oldest first.
+	alertsSortSeverity = "severity"
+)
+
+// alertSeverities ranks the usual values of the severity label of alerts, the most severe first.
+var alertSeverities = map[string]int64{"critical": 0, "error": 1, "warning": 2, "info": 3}
+
+type keyedAlert struct {
+	key   alertKey
+	alert *rulespb.AlertInstance
+}
+
+// alertKey is the sort key of an alert, the labels of the alert and the key of its group making it unique.
+type alertKey struct {
+	primary   int64
+	secondary int64
+	labels    string
+	group     string
+}
+
+func newAlertKey(sortBy string, g *rulespb.RuleGroup, a *rulespb.AlertInstance) alertKey {
+	var activeAt int64
+	if a.ActiveAt != nil {
+		activeAt = a.ActiveAt.UnixNano()
+	}
+	lset := labelpb.ZLabelsToPromLabels(a.Labels.Labels)
+	k := alertKey{labels: lset.String(), group: g.Key()}
+	switch sortBy {
+	case alertsSortActiveAtDesc:
+		k.primary = -activeAt
+	case alertsSortSeverity:
+		k.primary, k.secondary = int64(len(alertSeverities)), activeAt
+		if rank, ok := alertSeverities[strings.ToLower(lset.Get("severity"))]; ok {
+			k.primary = rank
+		}
+	default:
+		k.primary = activeAt
+	}
+	return k
+}
+
+func (k alertKey) compare(o alertKey) int {
+	switch {
+	case k.primary != o.primary:
+		return cmpInt64(k.primary, o.primary)
+	case k.secondary != o.secondary:
+		return cmpInt64(k.secondary, o.secondary)
+	case k.labels != o.labels:
+		return strings.Compare(k.labels, o.labels)
+	default:
+		return strings.Compare(k.group, o.group)
+	}
+}
+
+func cmpInt64(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// String returns the key as an opaque pagination token.
+func (k alertKey) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join([]string{
+		strconv.FormatInt(k.primary, 10), strconv.FormatInt(k.secondary, 10), k.group, k.labels,
+	}, "\xff")))
+}
+
+func parseAlertKey(token string) (*alertKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(b), "\xff", 4)
+	if len(parts) != 4 {
+		return nil, errors.New("malformed token")
+	}
+	k := &alertKey{group: parts[2], labels: parts[3]}
+	if k.primary, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	if k.secondary, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	return k, nil
+}
+
 // NewRulesHandler created handler compatible with HTTP /api/v1/rules https://prometheus.io/docs/prometheus/latest/querying/api/#rules
 // which uses gRPC Unary Rules API.
 func NewRulesHandler(client rules.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError, func()) {
@@ -1392,11 +1819,41 @@ func NewRulesHandler(client rules.UnaryClient, enablePartialResponse bool) func(
 			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Errorf("error parsing request form='%v'", MatcherParam)}, func() {}
 		}
 
+		var groupLimit int64
+		if v := r.Form.Get("group_limit"); v != "" {
+			groupLimit, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || groupLimit <= 0 {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid group_limit parameter '%v', it has to be a positive integer", v)}, func() {}
+			}
+		}
+		groupNextToken := r.Form.Get("group_next_token")
+		if groupNextToken != "" && groupLimit == 0 {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("group_limit parameter is required to paginate over rule groups")}, func() {}
+		}
+
+		for _, h := range r.Form["health[]"] {
+			if h != "ok" && h != "err" && h != "unknown" {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid health parameter '%v', expected 'ok', 'err' or 'unknown'", h)}, func() {}
+			}
+		}
+		for _, st := range r.Form["state[]"] {
+			if _, ok := rulespb.AlertState_value[strings.ToUpper(st)]; !ok || st != strings.ToLower(st) {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid state parameter '%v', expected 'firing', 'pending' or 'inactive'", st)}, func() {}
+			}
+		}
+
 		// TODO(bwplotka): Allow exactly the same functionality as query API: passing replica, dedup and partial response as HTTP params as well.
 		req := &rulespb.RulesRequest{
 			Type:                    rulespb.RulesRequest_Type(typ),
 			PartialResponseStrategy: ps,
 			MatcherString:           r.Form[MatcherParam],
+			GroupLimit:              groupLimit,
+			GroupNextToken:          groupNextToken,
+			RuleName:                r.Form["rule_name[]"],
+			RuleGroup:               r.Form["rule_group[]"],
+			File:                    r.Form["file[]"],
+			Health:                  r.Form["health[]"],
+			State:                   r.Form["state[]"],
 		}
 		tracing.DoInSpan(ctx, "retrieve_rules", func(ctx context.Context) {
 			groups, warnings, err = client.Rules(ctx, req)
@@ -1488,6 +1945,12 @@ func parseMetadataTimeRange(r *http.Request, defaultMetadataTimeRange time.Durat
 	return start, end, nil
 }
 
+// ParseTimeParam parses the given time parameter of the request, as a unix timestamp or RFC3339 time, returning the
+// given default value if it is not set.
+func ParseTimeParam(r *http.Request, paramName string, defaultValue time.Time) (time.Time, error) {
+	return parseTimeParam(r, paramName, defaultValue)
+}
+
 func parseTimeParam(r *http.Request, paramName string, defaultValue time.Time) (time.Time, error) {
 	val := r.FormValue(paramName)
 	if val == "" {
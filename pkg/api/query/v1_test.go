@@ -32,8 +32,10 @@ import (
 
 	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
@@ -51,7 +53,9 @@ import (
 	"github.com/thanos-io/promql-engine/engine"
 	baseAPI "github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/extannotations"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
@@ -1647,6 +1651,220 @@ func TestParseDownsamplingParamMillis(t *testing.T) {
 	}
 }
 
+func TestParseStitchWindowParamMillis(t *testing.T) {
+	for _, tcase := range []struct {
+		param         string
+		defaultWindow time.Duration
+		result        int64
+		fail          bool
+	}{
+		{param: "", result: 0},
+		{param: "", defaultWindow: time.Hour, result: int64(time.Hour / time.Millisecond)},
+		{param: "30m", defaultWindow: time.Hour, result: int64(30 * time.Minute / time.Millisecond)},
+		{param: "0s", defaultWindow: time.Hour, result: 0},
+		{param: "-1h", fail: true},
+		{param: "abc", fail: true},
+	} {
+		t.Run(tcase.param, func(t *testing.T) {
+			api := QueryAPI{defaultStitchWindow: tcase.defaultWindow}
+			v := url.Values{}
+			v.Set(StitchWindowParam, tcase.param)
+
+			stitchWindow, apiErr := api.parseStitchWindowParamMillis(&http.Request{PostForm: v})
+			if tcase.fail {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, tcase.result, stitchWindow)
+		})
+	}
+}
+
+func TestWithTenantSubqueryStep(t *testing.T) {
+	qapi := &QueryAPI{tenantEvaluationIntervals: map[string]time.Duration{"team-a": 15 * time.Second}}
+	for _, tcase := range []struct {
+		tenant   string
+		query    string
+		expected string
+	}{
+		{tenant: "team-a", query: "max_over_time(rate(up[1m])[1h:])", expected: "max_over_time(rate(up[1m])[1h:15s])"},
+		{tenant: "team-a", query: "max_over_time(rate(up[1m])[1h:1m])", expected: "max_over_time(rate(up[1m])[1h:1m])"},
+		{tenant: "team-a", query: "sum(max_over_time(up[1h:]) + min_over_time(up[1h:5m]))", expected: "sum(max_over_time(up[1h:15s]) + min_over_time(up[1h:5m]))"},
+		{tenant: "team-a", query: "rate(up[5m])", expected: "rate(up[5m])"},
+		{tenant: "team-a", query: "invalid(", expected: "invalid("},
+		{tenant: "team-b", query: "max_over_time(up[1h:])", expected: "max_over_time(up[1h:])"},
+	} {
+		t.Run(tcase.tenant+" "+tcase.query, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, qapi.withTenantSubqueryStep(tcase.tenant, tcase.query))
+		})
+	}
+}
+
+// fakeResolutionQuery is a query returning the error of its max source resolution, if any.
+type fakeResolutionQuery struct {
+	promql.Query
+	err    error
+	closed bool
+}
+
+func (q *fakeResolutionQuery) Exec(context.Context) *promql.Result {
+	if q.err != nil {
+		return &promql.Result{Err: q.err}
+	}
+	return &promql.Result{Value: promql.Vector{}}
+}
+
+func (q *fakeResolutionQuery) Close() { q.closed = true }
+
+func TestExecWithDownsampleRetry(t *testing.T) {
+	tooManySamples := promql.ErrTooManySamples("query execution")
+	storeLimit := errors.New("proxy Series(): rpc error: code = Aborted desc = exceeded chunks limit: limit 10 violated (got 20)")
+	otherErr := errors.New("other")
+
+	for _, tcase := range []struct {
+		name          string
+		tenant        string
+		maxSourceRes  int64
+		errs          map[int64]error
+		expectedErr   error
+		expectedRetry *downsampleRetryData
+	}{
+		{
+			name:   "no error",
+			tenant: "default",
+			errs:   map[int64]error{},
+		},
+		{
+			name:          "retried at the next level",
+			tenant:        "default",
+			errs:          map[int64]error{0: storeLimit},
+			expectedRetry: &downsampleRetryData{MaxSourceResolution: "5m", Reason: storeLimit.Error()},
+		},
+		{
+			name:          "retried at all the levels",
+			tenant:        "default",
+			errs:          map[int64]error{0: tooManySamples, downsample.ResLevel1: tooManySamples},
+			expectedRetry: &downsampleRetryData{MaxSourceResolution: "1h", Reason: tooManySamples.Error()},
+		},
+		{
+			name:         "retries failing",
+			tenant:       "default",
+			maxSourceRes: downsample.ResLevel1,
+			errs:         map[int64]error{downsample.ResLevel1: tooManySamples, downsample.ResLevel2: tooManySamples},
+			expectedErr:  tooManySamples,
+		},
+		{
+			name:        "other errors",
+			tenant:      "default",
+			errs:        map[int64]error{0: otherErr},
+			expectedErr: otherErr,
+		},
+		{
+			name:        "disabled for the tenant",
+			tenant:      "no-retry",
+			errs:        map[int64]error{0: tooManySamples},
+			expectedErr: tooManySamples,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			qapi := &QueryAPI{
+				downsampleRetry:       true,
+				tenantDownsampleRetry: map[string]bool{"no-retry": false},
+				downsampleRetries:     promauto.With(nil).NewCounterVec(prometheus.CounterOpts{Name: "retries"}, []string{"resolution"}),
+			}
+			var queries []*fakeResolutionQuery
+			newQuery := func(_ context.Context, maxSourceResolution int64) (promql.Query, error) {
+				q := &fakeResolutionQuery{err: tcase.errs[maxSourceResolution]}
+				queries = append(queries, q)
+				return q, nil
+			}
+			qry, _ := newQuery(context.Background(), tcase.maxSourceRes)
+
+			qry, res, retry := qapi.execWithDownsampleRetry(context.Background(), "exec", tcase.tenant, qry, tcase.maxSourceRes, newQuery)
+			testutil.Equals(t, tcase.expectedErr, res.Err)
+			testutil.Equals(t, tcase.expectedRetry, retry)
+			testutil.Assert(t, qry == queries[len(queries)-1])
+			for _, q := range queries[:len(queries)-1] {
+				testutil.Assert(t, q.closed)
+			}
+			if retry != nil {
+				testutil.Equals(t, 1, len(res.Warnings))
+				testutil.Equals(t, 1.0, promtestutil.ToFloat64(qapi.downsampleRetries.WithLabelValues(retry.MaxSourceResolution)))
+			} else {
+				testutil.Equals(t, 0, len(res.Warnings))
+			}
+		})
+	}
+}
+
+func TestSortResultSeries(t *testing.T) {
+	a, b, c := labels.FromStrings("a", "1"), labels.FromStrings("a", "2"), labels.FromStrings("b", "1")
+	for _, tcase := range []struct {
+		query    string
+		value    parser.Value
+		expected parser.Value
+	}{
+		{
+			query:    "up",
+			value:    promql.Vector{{Metric: c}, {Metric: a}, {Metric: b}},
+			expected: promql.Vector{{Metric: a}, {Metric: b}, {Metric: c}},
+		},
+		{
+			query:    "up[5m]",
+			value:    promql.Matrix{{Metric: b}, {Metric: c}, {Metric: a}},
+			expected: promql.Matrix{{Metric: a}, {Metric: b}, {Metric: c}},
+		},
+		{
+			query:    "(sort_desc(up))",
+			value:    promql.Vector{{Metric: c}, {Metric: a}, {Metric: b}},
+			expected: promql.Vector{{Metric: c}, {Metric: a}, {Metric: b}},
+		},
+		{
+			query:    "sum by (a) (sort(up))",
+			value:    promql.Vector{{Metric: b}, {Metric: a}},
+			expected: promql.Vector{{Metric: a}, {Metric: b}},
+		},
+		{
+			query:    "1",
+			value:    promql.Scalar{V: 1},
+			expected: promql.Scalar{V: 1},
+		},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			sortResultSeries(tcase.query, tcase.value)
+			testutil.Equals(t, tcase.expected, tcase.value)
+		})
+	}
+}
+
+func TestParseSortSeriesParam(t *testing.T) {
+	for _, tcase := range []struct {
+		param    string
+		def      bool
+		expected bool
+		fail     bool
+	}{
+		{param: "", expected: false},
+		{param: "", def: true, expected: true},
+		{param: "false", def: true, expected: false},
+		{param: "true", expected: true},
+		{param: "abc", fail: true},
+	} {
+		api := QueryAPI{defaultSortSeries: tcase.def}
+		v := url.Values{}
+		v.Set(SortSeriesParam, tcase.param)
+
+		sortSeries, apiErr := api.parseSortSeriesParam(&http.Request{PostForm: v})
+		if tcase.fail {
+			testutil.Assert(t, apiErr != nil, "expected error for %q", tcase.param)
+			continue
+		}
+		testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+		testutil.Equals(t, tcase.expected, sortSeries)
+	}
+}
+
 func TestParseStoreDebugMatchersParam(t *testing.T) {
 	for i, tc := range []struct {
 		storeMatchers string
@@ -1998,6 +2216,183 @@ func TestRulesHandler(t *testing.T) {
 	}
 }
 
+func TestRulesHandlerRequestParams(t *testing.T) {
+	client := &requestRecordingRulesClient{}
+	endpoint := NewRulesHandler(client, false)
+
+	for _, tcase := range []struct {
+		query       url.Values
+		expectedErr bool
+		expectedReq *rulespb.RulesRequest
+	}{
+		{
+			query:       url.Values{"group_limit": []string{"10"}, "group_next_token": []string{"file;group"}},
+			expectedReq: &rulespb.RulesRequest{GroupLimit: 10, GroupNextToken: "file;group"},
+		},
+		{
+			query: url.Values{"rule_name[]": []string{"r1", "r2"}, "rule_group[]": []string{"g"}, "file[]": []string{"f"}},
+			expectedReq: &rulespb.RulesRequest{
+				RuleName:  []string{"r1", "r2"},
+				RuleGroup: []string{"g"},
+				File:      []string{"f"},
+			},
+		},
+		{
+			query: url.Values{"health[]": []string{"ok", "err"}, "state[]": []string{"firing"}},
+			expectedReq: &rulespb.RulesRequest{
+				Health: []string{"ok", "err"},
+				State:  []string{"firing"},
+			},
+		},
+		{
+			query:       url.Values{"health[]": []string{"good"}},
+			expectedErr: true,
+		},
+		{
+			query:       url.Values{"state[]": []string{"FIRING"}},
+			expectedErr: true,
+		},
+		{
+			query:       url.Values{"group_limit": []string{"0"}},
+			expectedErr: true,
+		},
+		{
+			query:       url.Values{"group_limit": []string{"-1"}},
+			expectedErr: true,
+		},
+		{
+			query:       url.Values{"group_limit": []string{"a"}},
+			expectedErr: true,
+		},
+		{
+			query:       url.Values{"group_next_token": []string{"file;group"}},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tcase.query.Encode(), func(t *testing.T) {
+			client.req = nil
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", tcase.query.Encode()), nil)
+			testutil.Ok(t, err)
+
+			_, _, apiErr, releaseResources := endpoint(req)
+			defer releaseResources()
+			if tcase.expectedErr {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, baseAPI.ErrorBadData, apiErr.Typ)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, tcase.expectedReq.GroupLimit, client.req.GroupLimit)
+			testutil.Equals(t, tcase.expectedReq.GroupNextToken, client.req.GroupNextToken)
+			testutil.Equals(t, tcase.expectedReq.RuleName, client.req.RuleName)
+			testutil.Equals(t, tcase.expectedReq.RuleGroup, client.req.RuleGroup)
+			testutil.Equals(t, tcase.expectedReq.File, client.req.File)
+			testutil.Equals(t, tcase.expectedReq.Health, client.req.Health)
+			testutil.Equals(t, tcase.expectedReq.State, client.req.State)
+		})
+	}
+}
+
+func TestAlertsHandlerSortAndPagination(t *testing.T) {
+	now := time.Now()
+	alert := func(name, severity string, activeAgo time.Duration) *rulespb.AlertInstance {
+		activeAt := now.Add(-activeAgo)
+		return &rulespb.AlertInstance{
+			Labels:   labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "alertname", Value: name}, {Name: "severity", Value: severity}}},
+			State:    rulespb.AlertState_FIRING,
+			ActiveAt: &activeAt,
+		}
+	}
+	endpoint := NewAlertsHandler(mockedRulesClient{
+		g: map[rulespb.RulesRequest_Type][]*rulespb.RuleGroup{
+			rulespb.RulesRequest_ALERT: {
+				{
+					Name: "grp1",
+					File: "file1",
+					Rules: []*rulespb.Rule{
+						rulespb.NewAlertingRule(&rulespb.Alert{Name: "a", Alerts: []*rulespb.AlertInstance{
+							alert("a", "info", time.Minute), alert("b", "critical", 2*time.Minute),
+						}}),
+					},
+				},
+				{
+					Name: "grp2",
+					File: "file2",
+					Rules: []*rulespb.Rule{
+						rulespb.NewAlertingRule(&rulespb.Alert{Name: "b", Alerts: []*rulespb.AlertInstance{
+							alert("c", "warning", 3*time.Minute), alert("d", "critical", 4*time.Minute), alert("e", "unknown", 5*time.Minute),
+						}}),
+					},
+				},
+			},
+		},
+	}, false)
+
+	alerts := func(query url.Values) ([]string, string) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", query.Encode()), nil)
+		testutil.Ok(t, err)
+		res, _, apiErr, releaseResources := endpoint(req)
+		defer releaseResources()
+		testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+		b, err := json.Marshal(res)
+		testutil.Ok(t, err)
+		var resp struct {
+			Alerts []struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"alerts"`
+			NextToken string `json:"nextToken"`
+		}
+		testutil.Ok(t, json.Unmarshal(b, &resp))
+		var names []string
+		for _, a := range resp.Alerts {
+			names = append(names, a.Labels["alertname"])
+		}
+		return names, resp.NextToken
+	}
+
+	names, token := alerts(url.Values{})
+	testutil.Equals(t, []string{"a", "b", "c", "d", "e"}, names)
+	testutil.Equals(t, "", token)
+
+	names, _ = alerts(url.Values{"sort": []string{"active_at"}})
+	testutil.Equals(t, []string{"e", "d", "c", "b", "a"}, names)
+	names, _ = alerts(url.Values{"sort": []string{"-active_at"}})
+	testutil.Equals(t, []string{"a", "b", "c", "d", "e"}, names)
+	names, _ = alerts(url.Values{"sort": []string{"severity"}})
+	testutil.Equals(t, []string{"d", "b", "c", "a", "e"}, names)
+
+	var pages [][]string
+	query := url.Values{"sort": []string{"severity"}, "limit": []string{"2"}}
+	for {
+		names, token := alerts(query)
+		pages = append(pages, names)
+		if token == "" {
+			break
+		}
+		query.Set("next_token", token)
+	}
+	testutil.Equals(t, [][]string{{"d", "b"}, {"c", "a"}, {"e"}}, pages)
+
+	// Alerts are paginated by activeAt by default.
+	names, token = alerts(url.Values{"limit": []string{"3"}})
+	testutil.Equals(t, []string{"e", "d", "c"}, names)
+	testutil.Assert(t, token != "", "expected a next token")
+
+	for _, query := range []url.Values{
+		{"sort": []string{"name"}},
+		{"limit": []string{"0"}},
+		{"next_token": []string{token}},
+		{"limit": []string{"1"}, "next_token": []string{"not-a-token"}},
+	} {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", query.Encode()), nil)
+		testutil.Ok(t, err)
+		_, _, apiErr, _ := endpoint(req)
+		testutil.Assert(t, apiErr != nil, "expected error for %v", query)
+		testutil.Equals(t, baseAPI.ErrorBadData, apiErr.Typ)
+	}
+}
+
 func BenchmarkQueryResultEncoding(b *testing.B) {
 	var mat promql.Matrix
 	for i := 0; i < 1000; i++ {
@@ -2042,6 +2437,15 @@ func (c mockedRulesClient) Rules(_ context.Context, req *rulespb.RulesRequest) (
 	return &rulespb.RuleGroups{Groups: c.g[req.Type]}, c.w, c.err
 }
 
+type requestRecordingRulesClient struct {
+	req *rulespb.RulesRequest
+}
+
+func (c *requestRecordingRulesClient) Rules(_ context.Context, req *rulespb.RulesRequest) (*rulespb.RuleGroups, annotations.Annotations, error) {
+	c.req = req
+	return &rulespb.RuleGroups{}, nil, nil
+}
+
 type sample struct {
 	t int64
 	f float64
@@ -2067,3 +2471,26 @@ func (s sample) FH() *histogram.FloatHistogram {
 func (s sample) Type() chunkenc.ValueType {
 	return chunkenc.ValFloat
 }
+
+func TestDedupWarnings(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	qapi := &QueryAPI{
+		warningsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_api_warnings_total",
+		}, []string{"handler", "category"}),
+	}
+
+	f := qapi.dedupWarnings("query", func(r *http.Request) (interface{}, []error, *baseAPI.ApiError, func()) {
+		return nil, []error{
+			errors.New("receive series from a: EOF"),
+			errors.New("receive series from a: EOF"),
+			errors.New("exceeded series limit: limit 10 violated"),
+		}, nil, func() {}
+	})
+
+	_, warnings, apiErr, _ := f(&http.Request{})
+	testutil.Assert(t, apiErr == nil)
+	testutil.Equals(t, 2, len(warnings))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(qapi.warningsTotal.WithLabelValues("query", extannotations.CategoryPartialResponse)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(qapi.warningsTotal.WithLabelValues("query", extannotations.CategoryLimit)))
+}
@@ -4,10 +4,13 @@
 package v1
 
 import (
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/route"
 
@@ -27,6 +30,9 @@ type RuleAPI struct {
 	alerts      alertsRetriever
 	reg         prometheus.Registerer
 	disableCORS bool
+
+	managedRules *rules.ManagedRules
+	alertHistory *rules.AlertHistory
 }
 
 type alertsRetriever interface {
@@ -39,16 +45,20 @@ func NewRuleAPI(
 	reg prometheus.Registerer,
 	ruleGroups rules.UnaryClient,
 	activeAlerts alertsRetriever,
+	managedRules *rules.ManagedRules,
+	alertHistory *rules.AlertHistory,
 	disableCORS bool,
 	flagsMap map[string]string,
 ) *RuleAPI {
 	return &RuleAPI{
-		baseAPI:     api.NewBaseAPI(logger, disableCORS, flagsMap),
-		logger:      logger,
-		ruleGroups:  ruleGroups,
-		alerts:      activeAlerts,
-		reg:         reg,
-		disableCORS: disableCORS,
+		baseAPI:      api.NewBaseAPI(logger, disableCORS, flagsMap),
+		logger:       logger,
+		ruleGroups:   ruleGroups,
+		alerts:       activeAlerts,
+		reg:          reg,
+		disableCORS:  disableCORS,
+		managedRules: managedRules,
+		alertHistory: alertHistory,
 	}
 }
 
@@ -61,4 +71,79 @@ func (rapi *RuleAPI) Register(r *route.Router, tracer opentracing.Tracer, logger
 		return struct{ Alerts []*rulespb.AlertInstance }{Alerts: rapi.alerts.Active()}, nil, nil, func() {}
 	}))
 	r.Get("/rules", instr("rules", qapi.NewRulesHandler(rapi.ruleGroups, false)))
+
+	if rapi.alertHistory != nil {
+		r.Get("/alerts/history", instr("alerts_history", rapi.alertsHistory))
+	}
+
+	if rapi.managedRules != nil {
+		r.Get("/rules/:namespace/:group", instr("get_rule_group", rapi.getRuleGroup))
+		r.Post("/rules/:namespace/:group", instr("set_rule_group", rapi.setRuleGroup))
+		r.Del("/rules/:namespace/:group", instr("delete_rule_group", rapi.deleteRuleGroup))
+	}
+}
+
+// alertsHistory returns the recorded state transitions of alerts, optionally filtered by alert name, rule group and
+// time range.
+func (rapi *RuleAPI) alertsHistory(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	start, err := qapi.ParseTimeParam(r, "start", time.Time{})
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+	end, err := qapi.ParseTimeParam(r, "end", time.Time{})
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+	transitions := rapi.alertHistory.Transitions(rules.AlertTransitionsFilter{
+		AlertName: r.FormValue("alertname"),
+		Group:     r.FormValue("group"),
+		Start:     start,
+		End:       end,
+	})
+	return struct {
+		Transitions []rules.AlertTransition `json:"transitions"`
+	}{Transitions: transitions}, nil, nil, func() {}
+}
+
+// maxRuleGroupSize is the maximum size of the rule groups submitted to the rule group management API.
+const maxRuleGroupSize = 1 << 20
+
+func (rapi *RuleAPI) getRuleGroup(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	group, err := rapi.managedRules.Group(route.Param(r.Context(), "namespace"), route.Param(r.Context(), "group"))
+	if err != nil {
+		return nil, nil, managedRulesError(err), func() {}
+	}
+	return group, nil, nil, func() {}
+}
+
+func (rapi *RuleAPI) setRuleGroup(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRuleGroupSize+1))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "read rule group")}, func() {}
+	}
+	if len(body) > maxRuleGroupSize {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("rule group exceeds %d bytes", maxRuleGroupSize)}, func() {}
+	}
+	if err := rapi.managedRules.SetGroup(r.Context(), route.Param(r.Context(), "namespace"), route.Param(r.Context(), "group"), body); err != nil {
+		return nil, nil, managedRulesError(err), func() {}
+	}
+	return nil, nil, nil, func() {}
+}
+
+func (rapi *RuleAPI) deleteRuleGroup(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	if err := rapi.managedRules.DeleteGroup(r.Context(), route.Param(r.Context(), "namespace"), route.Param(r.Context(), "group")); err != nil {
+		return nil, nil, managedRulesError(err), func() {}
+	}
+	return nil, nil, nil, func() {}
+}
+
+func managedRulesError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, rules.ErrRuleGroupNotFound):
+		return &api.ApiError{Typ: api.ErrorNotFound, Err: err}
+	case rules.IsValidationError(err):
+		return &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	default:
+		return &api.ApiError{Typ: api.ErrorInternal, Err: err}
+	}
 }
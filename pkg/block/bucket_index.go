@@ -0,0 +1,277 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// BucketIndexFilename is the name of the bucket index file, at the root of the bucket.
+	BucketIndexFilename = "bucket-index.json.gz"
+	// BucketIndexVersion1 is the first version of the bucket index.
+	BucketIndexVersion1 = 1
+)
+
+// ErrBucketIndexNotFound is returned when the bucket has no bucket index.
+var ErrBucketIndexNotFound = errors.New("bucket index not found")
+
+// BucketIndex lists the blocks of a bucket, with their meta and deletion marks, in a single object, so that the
+// blocks can be discovered without iterating the bucket and fetching the meta of every block.
+type BucketIndex struct {
+	// Version of the bucket index.
+	Version int `json:"version"`
+	// UpdatedAt is a unix timestamp of when the bucket index was written.
+	UpdatedAt int64 `json:"updated_at"`
+	// Blocks are the metas of the blocks of the bucket, sorted by ID. Partial blocks are not listed.
+	Blocks []*metadata.Meta `json:"blocks"`
+	// DeletionMarks are the deletion marks of the blocks of the bucket, sorted by ID.
+	DeletionMarks []*metadata.DeletionMark `json:"deletion_marks"`
+}
+
+// ReadBucketIndex reads the bucket index of the bucket. It returns ErrBucketIndexNotFound if there is none.
+func ReadBucketIndex(ctx context.Context, logger log.Logger, bkt objstore.InstrumentedBucketReader) (*BucketIndex, error) {
+	r, err := bkt.ReaderWithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, BucketIndexFilename)
+	if bkt.IsObjNotFoundErr(err) {
+		return nil, ErrBucketIndexNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get bucket index %s", BucketIndexFilename)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close bucket index reader")
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "create gzip reader of bucket index")
+	}
+	defer runutil.CloseWithLogOnErr(logger, gz, "close bucket index gzip reader")
+
+	idx := &BucketIndex{}
+	if err := json.NewDecoder(gz).Decode(idx); err != nil {
+		return nil, errors.Wrap(err, "decode bucket index")
+	}
+	if idx.Version != BucketIndexVersion1 {
+		return nil, errors.Errorf("unexpected bucket index version %d", idx.Version)
+	}
+	return idx, nil
+}
+
+// WriteBucketIndex writes the given bucket index to the bucket.
+func WriteBucketIndex(ctx context.Context, bkt objstore.Bucket, idx *BucketIndex) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(idx); err != nil {
+		return errors.Wrap(err, "encode bucket index")
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "close gzip writer of bucket index")
+	}
+	return errors.Wrapf(bkt.Upload(ctx, BucketIndexFilename, &buf), "upload bucket index %s", BucketIndexFilename)
+}
+
+// BucketIndexUpdater writes the bucket index of a bucket from the blocks discovered in it. Only a single instance
+// should update the bucket index of a bucket.
+type BucketIndexUpdater struct {
+	logger log.Logger
+	bkt    objstore.Bucket
+
+	// mtx serializes updates, as the deletion mark filter is not go-routine safe.
+	mtx         sync.Mutex
+	fetcher     *MetaFetcher
+	deleteMarks *IgnoreDeletionMarkFilter
+
+	updates        prometheus.Counter
+	updateFailures prometheus.Counter
+	lastUpdate     prometheus.Gauge
+}
+
+// NewBucketIndexUpdater returns a new BucketIndexUpdater, discovering blocks with the given fetcher, which caches
+// the metas of the blocks across updates.
+func NewBucketIndexUpdater(logger log.Logger, bkt objstore.InstrumentedBucket, fetcher *BaseFetcher, concurrency int, reg prometheus.Registerer) *BucketIndexUpdater {
+	// Deletion marks are gathered without ever filtering out the marked blocks, so that they are all indexed.
+	deleteMarks := NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(math.MaxInt64), concurrency)
+	return &BucketIndexUpdater{
+		logger:      logger,
+		bkt:         bkt,
+		fetcher:     fetcher.NewMetaFetcher(nil, []MetadataFilter{deleteMarks}, "component", "bucketIndexUpdater"),
+		deleteMarks: deleteMarks,
+		updates: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_index_updates_total",
+			Help: "Total number of bucket index updates.",
+		}),
+		updateFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_index_update_failures_total",
+			Help: "Total number of failed bucket index updates.",
+		}),
+		lastUpdate: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_bucket_index_last_successful_update_timestamp_seconds",
+			Help: "Timestamp of the last successful bucket index update.",
+		}),
+	}
+}
+
+// Update discovers the blocks of the bucket and writes the bucket index. The bucket index is not written if some
+// blocks could not be discovered.
+func (u *BucketIndexUpdater) Update(ctx context.Context) (err error) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	u.updates.Inc()
+	defer func() {
+		if err != nil {
+			u.updateFailures.Inc()
+		}
+	}()
+
+	metas, _, err := u.fetcher.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch metas")
+	}
+
+	idx := &BucketIndex{
+		Version:   BucketIndexVersion1,
+		UpdatedAt: time.Now().Unix(),
+		Blocks:    make([]*metadata.Meta, 0, len(metas)),
+	}
+	for _, m := range metas {
+		idx.Blocks = append(idx.Blocks, m)
+	}
+	sort.Slice(idx.Blocks, func(i, j int) bool { return idx.Blocks[i].ULID.Compare(idx.Blocks[j].ULID) < 0 })
+	for _, m := range u.deleteMarks.DeletionMarkBlocks() {
+		idx.DeletionMarks = append(idx.DeletionMarks, m)
+	}
+	sort.Slice(idx.DeletionMarks, func(i, j int) bool { return idx.DeletionMarks[i].ID.Compare(idx.DeletionMarks[j].ID) < 0 })
+
+	if err := WriteBucketIndex(ctx, u.bkt, idx); err != nil {
+		return err
+	}
+	u.lastUpdate.SetToCurrentTime()
+	level.Info(u.logger).Log("msg", "updated bucket index", "blocks", len(idx.Blocks), "deletion_marks", len(idx.DeletionMarks))
+	return nil
+}
+
+// BucketIndexLister lists the blocks of the bucket index, falling back to another lister if the bucket has no
+// bucket index, or if it was not updated for too long. Metas and deletion marks of the blocks are served from the
+// bucket index to the fetchers and deletion mark filters using the lister.
+type BucketIndexLister struct {
+	logger       log.Logger
+	bkt          objstore.InstrumentedBucketReader
+	fallback     Lister
+	maxStaleness time.Duration
+
+	mtx           sync.Mutex
+	metas         map[ulid.ULID]*metadata.Meta
+	deletionMarks map[ulid.ULID]*metadata.DeletionMark
+
+	loads     prometheus.Counter
+	fallbacks prometheus.Counter
+}
+
+// NewBucketIndexLister returns a new BucketIndexLister, falling back to the given lister if the bucket index was last
+// updated more than the given max staleness ago. 0 disables the staleness check.
+func NewBucketIndexLister(logger log.Logger, bkt objstore.InstrumentedBucketReader, fallback Lister, maxStaleness time.Duration, reg prometheus.Registerer) *BucketIndexLister {
+	return &BucketIndexLister{
+		logger:       logger,
+		bkt:          bkt,
+		fallback:     fallback,
+		maxStaleness: maxStaleness,
+		loads: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_index_loads_total",
+			Help: "Total number of bucket index loads to list blocks.",
+		}),
+		fallbacks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_index_fallbacks_total",
+			Help: "Total number of block listings falling back to iterating the bucket, because the bucket index is missing, stale or corrupted.",
+		}),
+	}
+}
+
+func (l *BucketIndexLister) GetActiveAndPartialBlockIDs(ctx context.Context, ch chan<- ulid.ULID) (partialBlocks map[ulid.ULID]bool, err error) {
+	l.loads.Inc()
+	idx, err := ReadBucketIndex(ctx, l.logger, l.bkt)
+	if err == nil && l.maxStaleness > 0 && time.Since(time.Unix(idx.UpdatedAt, 0)) > l.maxStaleness {
+		err = errors.Errorf("bucket index was last updated at %s", time.Unix(idx.UpdatedAt, 0).UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		level.Warn(l.logger).Log("msg", "cannot list blocks from the bucket index; falling back to iterating the bucket", "err", err)
+		l.fallbacks.Inc()
+		l.setIndex(nil)
+		return l.fallback.GetActiveAndPartialBlockIDs(ctx, ch)
+	}
+
+	l.setIndex(idx)
+	for _, m := range idx.Blocks {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case ch <- m.ULID:
+		}
+	}
+	return map[ulid.ULID]bool{}, nil
+}
+
+func (l *BucketIndexLister) setIndex(idx *BucketIndex) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if idx == nil {
+		l.metas, l.deletionMarks = nil, nil
+		return
+	}
+	l.metas = make(map[ulid.ULID]*metadata.Meta, len(idx.Blocks))
+	for _, m := range idx.Blocks {
+		l.metas[m.ULID] = m
+	}
+	l.deletionMarks = make(map[ulid.ULID]*metadata.DeletionMark, len(idx.DeletionMarks))
+	for _, m := range idx.DeletionMarks {
+		l.deletionMarks[m.ID] = m
+	}
+}
+
+// blockMeta returns the meta of the given block from the last listed bucket index, if any.
+func (l *BucketIndexLister) blockMeta(id ulid.ULID) (*metadata.Meta, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	m, ok := l.metas[id]
+	return m, ok
+}
+
+// blockDeletionMarks returns the deletion marks of the last listed bucket index. It returns false if the blocks
+// were not last listed from the bucket index.
+func (l *BucketIndexLister) blockDeletionMarks() (map[ulid.ULID]*metadata.DeletionMark, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.deletionMarks, l.deletionMarks != nil
+}
+
+// metaLister is a Lister which also knows the metas of the blocks it lists.
+type metaLister interface {
+	Lister
+	blockMeta(id ulid.ULID) (*metadata.Meta, bool)
+}
+
+var _ metaLister = &BucketIndexLister{}
@@ -0,0 +1,90 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBucketIndex(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	insBkt := objstore.WithNoopInstr(bkt)
+
+	for _, id := range ULIDs(1, 2, 3) {
+		var meta metadata.Meta
+		meta.Version = 1
+		meta.ULID = id
+
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&meta))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.MetaFilename), &buf))
+	}
+	mark := &metadata.DeletionMark{ID: ULID(2), Version: metadata.DeletionMarkVersion1, DeletionTime: time.Now().Add(-time.Hour).Unix()}
+	var buf bytes.Buffer
+	testutil.Ok(t, json.NewEncoder(&buf).Encode(mark))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(mark.ID.String(), metadata.DeletionMarkFilename), &buf))
+
+	_, err := ReadBucketIndex(ctx, log.NewNopLogger(), insBkt)
+	testutil.Equals(t, ErrBucketIndexNotFound, err)
+
+	baseFetcher, err := NewBaseFetcher(log.NewNopLogger(), 4, insBkt, NewConcurrentLister(log.NewNopLogger(), insBkt), "", nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, NewBucketIndexUpdater(log.NewNopLogger(), insBkt, baseFetcher, 4, nil).Update(ctx))
+
+	idx, err := ReadBucketIndex(ctx, log.NewNopLogger(), insBkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, BucketIndexVersion1, idx.Version)
+	var ids []ulid.ULID
+	for _, m := range idx.Blocks {
+		ids = append(ids, m.ULID)
+	}
+	testutil.Equals(t, ULIDs(1, 2, 3), ids)
+	testutil.Equals(t, []*metadata.DeletionMark{mark}, idx.DeletionMarks)
+
+	// Metas and deletion marks are read from the bucket index, not from the blocks.
+	testutil.Ok(t, bkt.Delete(ctx, path.Join(ULID(3).String(), metadata.MetaFilename)))
+	reg := prometheus.NewRegistry()
+	lister := NewBucketIndexLister(log.NewNopLogger(), insBkt, NewConcurrentLister(log.NewNopLogger(), insBkt), time.Hour, reg)
+	fetch := func(delay time.Duration) []ulid.ULID {
+		filter := NewIgnoreDeletionMarkFilter(log.NewNopLogger(), insBkt, delay, 4).WithBucketIndex(lister)
+		f, err := NewMetaFetcher(log.NewNopLogger(), 4, insBkt, lister, "", nil, []MetadataFilter{filter})
+		testutil.Ok(t, err)
+		metas, _, err := f.Fetch(ctx)
+		testutil.Ok(t, err)
+
+		var ids []ulid.ULID
+		for _, id := range ULIDs(1, 2, 3) {
+			if _, ok := metas[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	testutil.Equals(t, ULIDs(1, 2, 3), fetch(2*time.Hour))
+	testutil.Equals(t, ULIDs(1, 3), fetch(time.Minute))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(lister.fallbacks))
+
+	// Blocks are listed from the bucket if the bucket index is stale or missing.
+	idx.UpdatedAt = time.Now().Add(-2 * time.Hour).Unix()
+	testutil.Ok(t, WriteBucketIndex(ctx, bkt, idx))
+	testutil.Equals(t, ULIDs(1), fetch(time.Minute))
+	testutil.Ok(t, bkt.Delete(ctx, BucketIndexFilename))
+	testutil.Equals(t, ULIDs(1, 2), fetch(2*time.Hour))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(lister.fallbacks))
+}
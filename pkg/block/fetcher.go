@@ -41,7 +41,9 @@ const FetcherConcurrency = 32
 // to allow depending projects (eg. Cortex) to implement their own custom metadata fetcher while tracking
 // compatible metrics.
 type BaseFetcherMetrics struct {
-	Syncs prometheus.Counter
+	Syncs         prometheus.Counter
+	PhaseDuration *prometheus.HistogramVec
+	Progress      *prometheus.GaugeVec
 }
 
 // FetcherMetrics holds metrics tracked by the metadata fetcher. This struct and its fields are exported
@@ -93,6 +95,16 @@ const (
 
 	// Modified label values.
 	replicaRemovedMeta = "replica-label-removed"
+
+	// Phase label values. Metas are loaded while blocks are still being listed, so the load phase starts with the
+	// synchronization, like the list phase.
+	listPhase     = "list"
+	loadMetaPhase = "load_meta"
+	filterPhase   = "filter"
+
+	// Progress label values.
+	listedProgress = "listed"
+	loadedProgress = "loaded"
 )
 
 func NewBaseFetcherMetrics(reg prometheus.Registerer) *BaseFetcherMetrics {
@@ -103,6 +115,17 @@ func NewBaseFetcherMetrics(reg prometheus.Registerer) *BaseFetcherMetrics {
 		Name:      "base_syncs_total",
 		Help:      "Total blocks metadata synchronization attempts by base Fetcher",
 	})
+	m.PhaseDuration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: FetcherSubSys,
+		Name:      "base_sync_phase_duration_seconds",
+		Help:      "Duration of the phases of the blocks metadata synchronization by base Fetcher: listing blocks, loading their metadata and filtering them.",
+		Buckets:   []float64{0.01, 1, 10, 100, 300, 600, 1000},
+	}, []string{"phase"})
+	m.Progress = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: FetcherSubSys,
+		Name:      "base_sync_progress_blocks",
+		Help:      "Number of blocks listed, and with their metadata loaded, by the current or last blocks metadata synchronization of base Fetcher.",
+	}, []string{"state"})
 
 	return &m
 }
@@ -220,27 +243,36 @@ func (f *RecursiveLister) GetActiveAndPartialBlockIDs(ctx context.Context, ch ch
 // ConcurrentLister lists block IDs by doing a top level iteration of the bucket
 // followed by one Exists call for each discovered block to detect partial blocks.
 type ConcurrentLister struct {
-	logger log.Logger
-	bkt    objstore.InstrumentedBucketReader
+	logger      log.Logger
+	bkt         objstore.InstrumentedBucketReader
+	concurrency int
 }
 
+// DefaultConcurrentListerConcurrency is the default number of goroutines checking the meta.json of discovered blocks.
+const DefaultConcurrentListerConcurrency = 64
+
 func NewConcurrentLister(logger log.Logger, bkt objstore.InstrumentedBucketReader) *ConcurrentLister {
 	return &ConcurrentLister{
-		logger: logger,
-		bkt:    bkt,
+		logger:      logger,
+		bkt:         bkt,
+		concurrency: DefaultConcurrentListerConcurrency,
 	}
 }
 
-func (f *ConcurrentLister) GetActiveAndPartialBlockIDs(ctx context.Context, ch chan<- ulid.ULID) (partialBlocks map[ulid.ULID]bool, err error) {
-	const concurrency = 64
+// WithConcurrency sets the number of goroutines checking the meta.json of discovered blocks.
+func (f *ConcurrentLister) WithConcurrency(concurrency int) *ConcurrentLister {
+	f.concurrency = concurrency
+	return f
+}
 
+func (f *ConcurrentLister) GetActiveAndPartialBlockIDs(ctx context.Context, ch chan<- ulid.ULID) (partialBlocks map[ulid.ULID]bool, err error) {
 	partialBlocks = make(map[ulid.ULID]bool)
 	var (
-		metaChan = make(chan ulid.ULID, concurrency)
+		metaChan = make(chan ulid.ULID, f.concurrency)
 		eg, gCtx = errgroup.WithContext(ctx)
 		mu       sync.Mutex
 	)
-	for i := 0; i < concurrency; i++ {
+	for i := 0; i < f.concurrency; i++ {
 		eg.Go(func() error {
 			for uid := range metaChan {
 				// TODO(bwplotka): If that causes problems (obj store rate limits), add longer ttl to cached items.
@@ -309,9 +341,11 @@ type BaseFetcher struct {
 	blockIDsLister Lister
 
 	// Optional local directory to cache meta.json files.
-	cacheDir string
-	syncs    prometheus.Counter
-	g        singleflight.Group
+	cacheDir      string
+	syncs         prometheus.Counter
+	phaseDuration *prometheus.HistogramVec
+	progress      *prometheus.GaugeVec
+	g             singleflight.Group
 
 	mtx    sync.Mutex
 	cached map[ulid.ULID]*metadata.Meta
@@ -344,6 +378,8 @@ func NewBaseFetcherWithMetrics(logger log.Logger, concurrency int, bkt objstore.
 		cacheDir:       cacheDir,
 		cached:         map[ulid.ULID]*metadata.Meta{},
 		syncs:          metrics.Syncs,
+		phaseDuration:  metrics.PhaseDuration,
+		progress:       metrics.Progress,
 	}, nil
 }
 
@@ -398,6 +434,13 @@ func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID) (*metadata.Met
 		return m, nil
 	}
 
+	// Listers knowing the metas of the blocks save fetching them.
+	if l, ok := f.blockIDsLister.(metaLister); ok {
+		if m, ok := l.blockMeta(id); ok {
+			return m, nil
+		}
+	}
+
 	// Best effort load from local dir.
 	if f.cacheDir != "" {
 		m, err := metadata.ReadFromDir(cachedBlockDir)
@@ -469,15 +512,24 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 			metas:   make(map[ulid.ULID]*metadata.Meta),
 			partial: make(map[ulid.ULID]error),
 		}
-		eg  errgroup.Group
-		ch  = make(chan ulid.ULID, f.concurrency)
-		mtx sync.Mutex
+		eg     errgroup.Group
+		listed = make(chan ulid.ULID, f.concurrency)
+		ch     = make(chan ulid.ULID, f.concurrency)
+		mtx    sync.Mutex
+		start  = time.Now()
+
+		listedBlocks = f.progress.WithLabelValues(listedProgress)
+		loadedBlocks = f.progress.WithLabelValues(loadedProgress)
 	)
+	listedBlocks.Set(0)
+	loadedBlocks.Set(0)
+
 	level.Debug(f.logger).Log("msg", "fetching meta data", "concurrency", f.concurrency)
 	for i := 0; i < f.concurrency; i++ {
 		eg.Go(func() error {
 			for id := range ch {
 				meta, err := f.loadMeta(ctx, id)
+				loadedBlocks.Inc()
 				if err == nil {
 					mtx.Lock()
 					resp.metas[id] = meta
@@ -509,18 +561,30 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 		})
 	}
 
+	// Listed blocks are counted before being distributed to the workers.
+	eg.Go(func() error {
+		defer close(ch)
+		for id := range listed {
+			listedBlocks.Inc()
+			ch <- id
+		}
+		return nil
+	})
+
 	var partialBlocks map[ulid.ULID]bool
 	var err error
 	// Workers scheduled, distribute blocks.
 	eg.Go(func() error {
-		defer close(ch)
-		partialBlocks, err = f.blockIDsLister.GetActiveAndPartialBlockIDs(ctx, ch)
+		defer close(listed)
+		partialBlocks, err = f.blockIDsLister.GetActiveAndPartialBlockIDs(ctx, listed)
+		f.phaseDuration.WithLabelValues(listPhase).Observe(time.Since(start).Seconds())
 		return err
 	})
 
 	if err := eg.Wait(); err != nil {
 		return nil, errors.Wrap(err, "BaseFetcher: iter bucket")
 	}
+	f.phaseDuration.WithLabelValues(loadMetaPhase).Observe(time.Since(start).Seconds())
 
 	mtx.Lock()
 	for blockULID, isPartial := range partialBlocks {
@@ -607,12 +671,14 @@ func (f *BaseFetcher) fetch(ctx context.Context, metrics *FetcherMetrics, filter
 	metrics.Synced.WithLabelValues(NoMeta).Set(resp.noMetas)
 	metrics.Synced.WithLabelValues(CorruptedMeta).Set(resp.corruptedMetas)
 
+	filterStart := time.Now()
 	for _, filter := range filters {
 		// NOTE: filter can update synced metric accordingly to the reason of the exclude.
 		if err := filter.Filter(ctx, metas, metrics.Synced, metrics.Modified); err != nil {
 			return nil, nil, errors.Wrap(err, "filter metas")
 		}
 	}
+	f.phaseDuration.WithLabelValues(filterPhase).Observe(time.Since(filterStart).Seconds())
 
 	metrics.Synced.WithLabelValues(LoadedMeta).Set(float64(len(metas)))
 
@@ -953,6 +1019,7 @@ type IgnoreDeletionMarkFilter struct {
 	delay       time.Duration
 	concurrency int
 	bkt         objstore.InstrumentedBucketReader
+	bucketIndex *BucketIndexLister
 
 	mtx             sync.Mutex
 	deletionMarkMap map[ulid.ULID]*metadata.DeletionMark
@@ -968,6 +1035,13 @@ func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBuc
 	}
 }
 
+// WithBucketIndex makes the filter use the deletion marks of the bucket index listed by the given lister, instead of
+// fetching the deletion mark of every block, when the blocks were listed from the bucket index.
+func (f *IgnoreDeletionMarkFilter) WithBucketIndex(l *BucketIndexLister) *IgnoreDeletionMarkFilter {
+	f.bucketIndex = l
+	return f
+}
+
 // DeletionMarkBlocks returns block ids that were marked for deletion.
 func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.DeletionMark {
 	f.mtx.Lock()
@@ -986,6 +1060,27 @@ func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.
 func (f *IgnoreDeletionMarkFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec) error {
 	deletionMarkMap := make(map[ulid.ULID]*metadata.DeletionMark)
 
+	if f.bucketIndex != nil {
+		if marks, ok := f.bucketIndex.blockDeletionMarks(); ok {
+			for id := range metas {
+				m, ok := marks[id]
+				if !ok {
+					continue
+				}
+				deletionMarkMap[id] = m
+				if time.Since(time.Unix(m.DeletionTime, 0)).Seconds() > f.delay.Seconds() {
+					synced.WithLabelValues(MarkedForDeletionMeta).Inc()
+					delete(metas, id)
+				}
+			}
+
+			f.mtx.Lock()
+			f.deletionMarkMap = deletionMarkMap
+			f.mtx.Unlock()
+			return nil
+		}
+	}
+
 	// Make a copy of block IDs to check, in order to avoid concurrency issues
 	// between the scheduler and workers.
 	blockIDs := make([]ulid.ULID, 0, len(metas))
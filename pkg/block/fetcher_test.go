@@ -290,6 +290,11 @@ func TestMetaFetcher_Fetch(t *testing.T) {
 				testutil.Equals(t, 0.0, promtest.ToFloat64(fetcher.metrics.Synced.WithLabelValues(timeExcludedMeta)))
 				testutil.Equals(t, float64(expectedFailures), promtest.ToFloat64(fetcher.metrics.Synced.WithLabelValues(FailedMeta)))
 				testutil.Equals(t, 0.0, promtest.ToFloat64(fetcher.metrics.Synced.WithLabelValues(tooFreshMeta)))
+
+				// All listed blocks had their meta loaded, or failed to.
+				listed := promtest.ToFloat64(baseFetcher.progress.WithLabelValues(listedProgress))
+				testutil.Equals(t, listed, promtest.ToFloat64(baseFetcher.progress.WithLabelValues(loadedProgress)))
+				testutil.Equals(t, float64(len(tcase.expectedMetas)+tcase.expectedFiltered+len(tcase.expectedCorruptedMeta)+expectedFailures), listed)
 			}); !ok {
 				return
 			}
@@ -31,6 +31,7 @@ import (
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
 )
 
@@ -51,6 +52,28 @@ const (
 
 var NotFoundRange = index.Range{Start: -1, End: -1}
 
+var (
+	errInvalidMagic   = errors.New("invalid magic number")
+	errUnknownVersion = errors.New("unknown index header file version")
+)
+
+// isCorruptionErr returns true if the given error was caused by index-header content
+// that failed validation, as opposed to e.g. the file not being present.
+func isCorruptionErr(err error) bool {
+	if merr, ok := err.(errutil.NonNilMultiError); ok {
+		for _, err := range merr {
+			if isCorruptionErr(err) {
+				return true
+			}
+		}
+		return false
+	}
+	return errors.Is(err, encoding.ErrInvalidChecksum) ||
+		errors.Is(err, encoding.ErrInvalidSize) ||
+		errors.Is(err, errInvalidMagic) ||
+		errors.Is(err, errUnknownVersion)
+}
+
 // The table gets initialized with sync.Once but may still cause a race
 // with any other use of the crc32 package anywhere. Thus we initialize it
 // before.
@@ -70,6 +93,7 @@ func newCRC32() hash.Hash32 {
 type BinaryReaderMetrics struct {
 	downloadDuration prometheus.Histogram
 	loadDuration     prometheus.Histogram
+	corruptedCount   prometheus.Counter
 }
 
 // NewBinaryReaderMetrics makes new BinaryReaderMetrics.
@@ -85,6 +109,10 @@ func NewBinaryReaderMetrics(reg prometheus.Registerer) *BinaryReaderMetrics {
 			Help:    "Duration of the index-header loading in seconds.",
 			Buckets: []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 15, 30, 60, 90, 120, 300},
 		}),
+		corruptedCount: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "indexheader_corrupted_total",
+			Help: "Total number of index-header files found corrupted on disk and recreated from object storage.",
+		}),
 	}
 }
 
@@ -566,7 +594,17 @@ func NewBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.Bucket
 			return br, nil
 		}
 
-		level.Debug(logger).Log("msg", "failed to read index-header from disk; recreating", "path", binfn, "err", err)
+		if isCorruptionErr(err) {
+			// The file failed checksum or format validation, most likely due to disk corruption. Remove it
+			// so it's never served again, even if recreating it below fails.
+			metrics.corruptedCount.Inc()
+			level.Warn(logger).Log("msg", "index-header on disk is corrupted; removing and recreating", "path", binfn, "err", err)
+			if err := os.Remove(binfn); err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrap(err, "remove corrupted index header")
+			}
+		} else {
+			level.Debug(logger).Log("msg", "failed to read index-header from disk; recreating", "path", binfn, "err", err)
+		}
 
 		start := time.Now()
 		if _, err := WriteBinary(ctx, bkt, id, binfn); err != nil {
@@ -663,7 +701,7 @@ func (r *BinaryReader) init() (err error) {
 		return errors.Wrap(encoding.ErrInvalidSize, "index header's header")
 	}
 	if m := binary.BigEndian.Uint32(r.b.Range(0, 4)); m != MagicIndex {
-		return errors.Errorf("invalid magic number %x", m)
+		return errors.Wrapf(errInvalidMagic, "%x", m)
 	}
 	r.version = int(r.b.Range(4, 5)[0])
 	r.indexVersion = int(r.b.Range(5, 6)[0])
@@ -671,7 +709,10 @@ func (r *BinaryReader) init() (err error) {
 	r.indexLastPostingEnd = int64(binary.BigEndian.Uint64(r.b.Range(6, headerLen)))
 
 	if r.version != BinaryFormatV1 {
-		return errors.Errorf("unknown index header file version %d", r.version)
+		return errors.Wrapf(errUnknownVersion, "%d", r.version)
+	}
+	if r.indexVersion != index.FormatV1 && r.indexVersion != index.FormatV2 {
+		return errors.Wrapf(errUnknownVersion, "index version %d", r.indexVersion)
 	}
 
 	r.toc, err = newBinaryTOCFromByteSlice(r.b)
@@ -679,6 +720,8 @@ func (r *BinaryReader) init() (err error) {
 		return errors.Wrap(err, "read index header TOC")
 	}
 
+	// Both symbols and postings offset table sections are verified against their CRC32 checksums
+	// while being read below, so on-disk corruption of those is detected at open time.
 	// TODO(bwplotka): Consider contributing to Prometheus to allow specifying custom number for symbolsFactor.
 	r.symbols, err = index.NewSymbols(r.b, r.indexVersion, int(r.toc.Symbols))
 	if err != nil {
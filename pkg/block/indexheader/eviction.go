@@ -0,0 +1,108 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package indexheader
+
+import (
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// LoadedReader describes a loaded lazy index-header reader to eviction policies.
+type LoadedReader struct {
+	BlockID ulid.ULID
+	// LastUsed is the last time the reader was used.
+	LastUsed time.Time
+	// Size is the size of the loaded index-header, in bytes.
+	Size int64
+}
+
+// EvictionPolicy selects the lazy index-header readers to unload from memory. Unloaded readers are loaded again
+// upon their next usage.
+type EvictionPolicy interface {
+	// Name identifies the policy in metrics and logs.
+	Name() string
+	// Evict returns the blocks of the given loaded readers to unload at the given time.
+	Evict(now time.Time, loaded []LoadedReader) []ulid.ULID
+}
+
+type idleEvictionPolicy struct {
+	timeout time.Duration
+}
+
+// NewIdleEvictionPolicy returns an eviction policy unloading the readers which were not used for the given timeout.
+func NewIdleEvictionPolicy(timeout time.Duration) EvictionPolicy {
+	return idleEvictionPolicy{timeout: timeout}
+}
+
+func (p idleEvictionPolicy) Name() string { return "idle" }
+
+func (p idleEvictionPolicy) Evict(now time.Time, loaded []LoadedReader) []ulid.ULID {
+	var evict []ulid.ULID
+	for _, r := range loaded {
+		if !r.LastUsed.After(now.Add(-p.timeout)) {
+			evict = append(evict, r.BlockID)
+		}
+	}
+	return evict
+}
+
+type lruEvictionPolicy struct {
+	maxReaders int
+}
+
+// NewLRUEvictionPolicy returns an eviction policy keeping at most the given number of readers loaded, unloading the
+// least recently used ones first.
+func NewLRUEvictionPolicy(maxReaders int) EvictionPolicy {
+	return lruEvictionPolicy{maxReaders: maxReaders}
+}
+
+func (p lruEvictionPolicy) Name() string { return "lru" }
+
+func (p lruEvictionPolicy) Evict(_ time.Time, loaded []LoadedReader) []ulid.ULID {
+	if len(loaded) <= p.maxReaders {
+		return nil
+	}
+	var evict []ulid.ULID
+	for _, r := range leastRecentlyUsed(loaded)[:len(loaded)-p.maxReaders] {
+		evict = append(evict, r.BlockID)
+	}
+	return evict
+}
+
+type sizeEvictionPolicy struct {
+	maxBytes int64
+}
+
+// NewSizeEvictionPolicy returns an eviction policy keeping the total size of the loaded index-headers at most the
+// given number of bytes, unloading the least recently used readers first.
+func NewSizeEvictionPolicy(maxBytes int64) EvictionPolicy {
+	return sizeEvictionPolicy{maxBytes: maxBytes}
+}
+
+func (p sizeEvictionPolicy) Name() string { return "size" }
+
+func (p sizeEvictionPolicy) Evict(_ time.Time, loaded []LoadedReader) []ulid.ULID {
+	var size int64
+	for _, r := range loaded {
+		size += r.Size
+	}
+	var evict []ulid.ULID
+	for _, r := range leastRecentlyUsed(loaded) {
+		if size <= p.maxBytes {
+			break
+		}
+		evict = append(evict, r.BlockID)
+		size -= r.Size
+	}
+	return evict
+}
+
+// leastRecentlyUsed returns a copy of the given readers, sorted from the least to the most recently used.
+func leastRecentlyUsed(loaded []LoadedReader) []LoadedReader {
+	sorted := append([]LoadedReader(nil), loaded...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].LastUsed.Before(sorted[j].LastUsed) })
+	return sorted
+}
@@ -0,0 +1,44 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package indexheader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/oklog/ulid"
+)
+
+func TestEvictionPolicies(t *testing.T) {
+	now := time.Now()
+	var (
+		a = ulid.MustNew(1, nil)
+		b = ulid.MustNew(2, nil)
+		c = ulid.MustNew(3, nil)
+	)
+	loaded := []LoadedReader{
+		{BlockID: a, LastUsed: now.Add(-time.Minute), Size: 100},
+		{BlockID: b, LastUsed: now.Add(-time.Hour), Size: 200},
+		{BlockID: c, LastUsed: now, Size: 300},
+	}
+
+	for _, tcase := range []struct {
+		policy EvictionPolicy
+		evict  []ulid.ULID
+	}{
+		{policy: NewIdleEvictionPolicy(2 * time.Hour)},
+		{policy: NewIdleEvictionPolicy(time.Minute), evict: []ulid.ULID{a, b}},
+		{policy: NewLRUEvictionPolicy(3)},
+		{policy: NewLRUEvictionPolicy(2), evict: []ulid.ULID{b}},
+		{policy: NewLRUEvictionPolicy(0), evict: []ulid.ULID{b, a, c}},
+		{policy: NewSizeEvictionPolicy(600)},
+		{policy: NewSizeEvictionPolicy(400), evict: []ulid.ULID{b}},
+		{policy: NewSizeEvictionPolicy(300), evict: []ulid.ULID{b, a}},
+	} {
+		testutil.Equals(t, tcase.evict, tcase.policy.Evict(now, loaded), "%s %+v", tcase.policy.Name(), tcase.policy)
+	}
+	// Policies don't reorder the given readers.
+	testutil.Equals(t, a, loaded[0].BlockID)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -17,6 +18,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
@@ -625,3 +627,61 @@ func TestReaderPostingsOffsets(t *testing.T) {
 		require.Equal(t, rngs2, rngs, "Got mismatched results from batched and non-batched API.\nInput cluster labels: %v.\nValues queried: %v", clusterLbls, vals)
 	}
 }
+
+func TestBinaryReader_RecreatesCorruptedIndexHeader(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	id, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+		labels.FromStrings("a", "3"),
+	}, 100, 0, 1000, labels.FromStrings("ext1", "1"), 124, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, id.String()), metadata.NoneFunc))
+
+	fn := filepath.Join(tmpDir, id.String(), block.IndexHeaderFilename)
+	_, err = WriteBinary(ctx, bkt, id, fn)
+	testutil.Ok(t, err)
+
+	expected, err := os.ReadFile(fn)
+	testutil.Ok(t, err)
+
+	for _, tcase := range []struct {
+		name    string
+		corrupt func(b []byte)
+	}{
+		{name: "magic", corrupt: func(b []byte) { b[0] ^= 0xff }},
+		{name: "index version", corrupt: func(b []byte) { b[5] = 42 }},
+		// First byte of symbols content, after the section length.
+		{name: "symbols", corrupt: func(b []byte) { b[headerLen+4] ^= 0xff }},
+		{name: "toc", corrupt: func(b []byte) { b[len(b)-binaryTOCLen] ^= 0xff }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			corrupted := make([]byte, len(expected))
+			copy(corrupted, expected)
+			tcase.corrupt(corrupted)
+			testutil.Ok(t, os.WriteFile(fn, corrupted, os.ModePerm))
+
+			m := NewBinaryReaderMetrics(nil)
+			br, err := NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, id, 3, m)
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, br.Close()) }()
+
+			testutil.Equals(t, float64(1), promtest.ToFloat64(m.corruptedCount))
+
+			vals, err := br.LabelValues("a")
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"1", "2", "3"}, vals)
+
+			recreated, err := os.ReadFile(fn)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expected, recreated)
+		})
+	}
+}
@@ -35,6 +35,7 @@ type LazyBinaryReaderMetrics struct {
 	unloadCount       prometheus.Counter
 	unloadFailedCount prometheus.Counter
 	loadDuration      prometheus.Histogram
+	loadedBytes       *prometheus.GaugeVec
 }
 
 // NewLazyBinaryReaderMetrics makes new LazyBinaryReaderMetrics.
@@ -61,6 +62,10 @@ func NewLazyBinaryReaderMetrics(reg prometheus.Registerer) *LazyBinaryReaderMetr
 			Help:    "Duration of the index-header lazy loading in seconds.",
 			Buckets: []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 15, 30, 60, 90, 120, 300},
 		}),
+		loadedBytes: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "indexheader_lazy_loaded_bytes",
+			Help: "Size of the index-header of every block loaded by a lazy reader, in bytes.",
+		}, []string{"block"}),
 	}
 }
 
@@ -80,6 +85,8 @@ type LazyBinaryReader struct {
 	readerMx  sync.RWMutex
 	reader    *BinaryReader
 	readerErr error
+	// Size of the loaded index-header, in bytes.
+	readerSize int64
 
 	// Keep track of the last time it was used.
 	usedAt *atomic.Int64
@@ -274,8 +281,10 @@ func (r *LazyBinaryReader) load() (returnErr error) {
 	}
 
 	r.reader = reader
+	r.readerSize = int64(reader.b.Len())
 	level.Debug(r.logger).Log("msg", "lazy loaded index-header", "block", r.id, "elapsed", time.Since(startTime))
 	r.metrics.loadDuration.Observe(time.Since(startTime).Seconds())
+	r.metrics.loadedBytes.WithLabelValues(r.id.String()).Set(float64(r.readerSize))
 
 	return nil
 }
@@ -303,19 +312,27 @@ func (r *LazyBinaryReader) unloadIfIdleSince(ts int64) error {
 	}
 
 	r.reader = nil
+	r.readerSize = 0
+	r.metrics.loadedBytes.DeleteLabelValues(r.id.String())
 	return nil
 }
 
-// isIdleSince returns true if the reader is idle since given time (as unix nano).
-func (r *LazyBinaryReader) isIdleSince(ts int64) bool {
-	if r.usedAt.Load() > ts {
-		return false
-	}
+// Loaded returns the description of the reader, and whether it is currently loaded in memory.
+func (r *LazyBinaryReader) Loaded() (LoadedReader, bool) {
+	return r.loaded()
+}
 
-	// A reader can be considered idle only if it's loaded.
+// loaded returns the description of the reader for eviction policies, and whether it is loaded.
+func (r *LazyBinaryReader) loaded() (LoadedReader, bool) {
 	r.readerMx.RLock()
-	loaded := r.reader != nil
-	r.readerMx.RUnlock()
+	defer r.readerMx.RUnlock()
 
-	return loaded
+	if r.reader == nil {
+		return LoadedReader{}, false
+	}
+	return LoadedReader{
+		BlockID:  r.id,
+		LastUsed: time.Unix(0, r.usedAt.Load()),
+		Size:     r.readerSize,
+	}, true
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -22,6 +23,7 @@ import (
 type ReaderPoolMetrics struct {
 	lazyReader   *LazyBinaryReaderMetrics
 	binaryReader *BinaryReaderMetrics
+	evictions    *prometheus.CounterVec
 }
 
 // NewReaderPoolMetrics makes new ReaderPoolMetrics.
@@ -29,13 +31,22 @@ func NewReaderPoolMetrics(reg prometheus.Registerer) *ReaderPoolMetrics {
 	return &ReaderPoolMetrics{
 		lazyReader:   NewLazyBinaryReaderMetrics(reg),
 		binaryReader: NewBinaryReaderMetrics(reg),
+		evictions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "indexheader_lazy_evictions_total",
+			Help: "Total number of index-headers unloaded by the given eviction policy.",
+		}, []string{"policy"}),
 	}
 }
 
+// defaultEvictionCheckInterval is the interval the eviction policies are checked at, unless the idle timeout requires
+// more frequent checks.
+const defaultEvictionCheckInterval = 10 * time.Second
+
 // ReaderPool is used to istantiate new index-header readers and keep track of them.
 // When the lazy reader is enabled, the pool keeps track of all instantiated readers
-// and automatically close them once the idle timeout is reached. A closed lazy reader
-// will be automatically re-opened upon next usage.
+// and automatically close them once the idle timeout is reached, or once any other
+// eviction policy selects them. A closed lazy reader will be automatically re-opened
+// upon next usage.
 type ReaderPool struct {
 	lazyReaderEnabled     bool
 	lazyReaderIdleTimeout time.Duration
@@ -50,6 +61,19 @@ type ReaderPool struct {
 	lazyReaders   map[*LazyBinaryReader]struct{}
 
 	lazyDownloadFunc LazyDownloadIndexHeaderFunc
+
+	evictionPolicies []EvictionPolicy
+}
+
+// ReaderPoolOption configures the ReaderPool.
+type ReaderPoolOption func(*ReaderPool)
+
+// WithEvictionPolicies adds eviction policies of lazy readers to the one of the idle timeout. Readers are unloaded
+// as soon as any of the policies selects them.
+func WithEvictionPolicies(policies ...EvictionPolicy) ReaderPoolOption {
+	return func(p *ReaderPool) {
+		p.evictionPolicies = append(p.evictionPolicies, policies...)
+	}
 }
 
 // IndexHeaderLazyDownloadStrategy specifies how to download index headers
@@ -88,7 +112,7 @@ func AlwaysLazyDownloadIndexHeader(meta *metadata.Meta) bool {
 }
 
 // NewReaderPool makes a new ReaderPool.
-func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, metrics *ReaderPoolMetrics, lazyDownloadFunc LazyDownloadIndexHeaderFunc) *ReaderPool {
+func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, metrics *ReaderPoolMetrics, lazyDownloadFunc LazyDownloadIndexHeaderFunc, opts ...ReaderPoolOption) *ReaderPool {
 	p := &ReaderPool{
 		logger:                logger,
 		metrics:               metrics,
@@ -98,10 +122,19 @@ func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTime
 		close:                 make(chan struct{}),
 		lazyDownloadFunc:      lazyDownloadFunc,
 	}
+	if lazyReaderIdleTimeout > 0 {
+		p.evictionPolicies = append(p.evictionPolicies, NewIdleEvictionPolicy(lazyReaderIdleTimeout))
+	}
+	for _, o := range opts {
+		o(p)
+	}
 
-	// Start a goroutine to close idle readers (only if required).
-	if p.lazyReaderEnabled && p.lazyReaderIdleTimeout > 0 {
-		checkFreq := p.lazyReaderIdleTimeout / 10
+	// Start a goroutine to evict readers (only if required).
+	if p.lazyReaderEnabled && len(p.evictionPolicies) > 0 {
+		checkFreq := defaultEvictionCheckInterval
+		if p.lazyReaderIdleTimeout > 0 && p.lazyReaderIdleTimeout/10 < checkFreq {
+			checkFreq = p.lazyReaderIdleTimeout / 10
+		}
 
 		go func() {
 			for {
@@ -109,7 +142,7 @@ func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTime
 				case <-p.close:
 					return
 				case <-time.After(checkFreq):
-					p.closeIdleReaders()
+					p.evictReaders()
 				}
 			}
 		}()
@@ -120,7 +153,8 @@ func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTime
 
 // NewBinaryReader creates and returns a new binary reader. If the pool has been configured
 // with lazy reader enabled, this function will return a lazy reader. The returned lazy reader
-// is tracked by the pool and automatically closed once the idle timeout expires.
+// is tracked by the pool and automatically closed once the idle timeout expires, or any other
+// eviction policy selects it.
 func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID, postingOffsetsInMemSampling int, meta *metadata.Meta) (Reader, error) {
 	var reader Reader
 	var err error
@@ -136,7 +170,7 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	}
 
 	// Keep track of lazy readers only if required.
-	if p.lazyReaderEnabled && p.lazyReaderIdleTimeout > 0 {
+	if p.lazyReaderEnabled && len(p.evictionPolicies) > 0 {
 		p.lazyReadersMx.Lock()
 		p.lazyReaders[reader.(*LazyBinaryReader)] = struct{}{}
 		p.lazyReadersMx.Unlock()
@@ -151,28 +185,64 @@ func (p *ReaderPool) Close() {
 	close(p.close)
 }
 
-func (p *ReaderPool) closeIdleReaders() {
-	idleTimeoutAgo := time.Now().Add(-p.lazyReaderIdleTimeout).UnixNano()
+// evictReaders unloads the loaded readers selected by the eviction policies. Readers used since they were selected
+// are not unloaded.
+func (p *ReaderPool) evictReaders() {
+	now := time.Now()
+	loaded, readers := p.getLoadedReaders()
 
-	for _, r := range p.getIdleReadersSince(idleTimeoutAgo) {
-		if err := r.unloadIfIdleSince(idleTimeoutAgo); err != nil && !errors.Is(err, errNotIdle) {
-			level.Warn(p.logger).Log("msg", "failed to close idle index-header reader", "err", err)
+	for _, policy := range p.evictionPolicies {
+		if len(loaded) == 0 {
+			return
 		}
+
+		for _, id := range policy.Evict(now, loaded) {
+			r, ok := readers[id]
+			if !ok {
+				continue
+			}
+			if err := r.reader.unloadIfIdleSince(r.LastUsed.UnixNano()); err != nil {
+				if !errors.Is(err, errNotIdle) {
+					level.Warn(p.logger).Log("msg", "failed to close index-header reader", "policy", policy.Name(), "block", id, "err", err)
+				}
+				continue
+			}
+			p.metrics.evictions.WithLabelValues(policy.Name()).Inc()
+			delete(readers, id)
+		}
+
+		// The next policies select among the readers which are still loaded.
+		remaining := loaded[:0]
+		for _, r := range loaded {
+			if _, ok := readers[r.BlockID]; ok {
+				remaining = append(remaining, r)
+			}
+		}
+		loaded = remaining
 	}
 }
 
-func (p *ReaderPool) getIdleReadersSince(ts int64) []*LazyBinaryReader {
+type loadedLazyReader struct {
+	LoadedReader
+	reader *LazyBinaryReader
+}
+
+func (p *ReaderPool) getLoadedReaders() ([]LoadedReader, map[ulid.ULID]loadedLazyReader) {
 	p.lazyReadersMx.Lock()
 	defer p.lazyReadersMx.Unlock()
 
-	var idle []*LazyBinaryReader
+	var (
+		loaded  []LoadedReader
+		readers = make(map[ulid.ULID]loadedLazyReader, len(p.lazyReaders))
+	)
 	for r := range p.lazyReaders {
-		if r.isIdleSince(ts) {
-			idle = append(idle, r)
+		if lr, ok := r.loaded(); ok {
+			loaded = append(loaded, lr)
+			readers[lr.BlockID] = loadedLazyReader{LoadedReader: lr, reader: r}
 		}
 	}
 
-	return idle
+	return loaded, readers
 }
 
 func (p *ReaderPool) isTracking(r *LazyBinaryReader) bool {
@@ -132,3 +132,63 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.loadCount))
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.unloadCount))
 }
+
+func TestReaderPool_ShouldEvictLazyReadersByPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	metrics := NewReaderPoolMetrics(nil)
+	pool := NewReaderPool(log.NewNopLogger(), true, 0, metrics, AlwaysEagerDownloadIndexHeader, WithEvictionPolicies(NewLRUEvictionPolicy(1)))
+	defer pool.Close()
+
+	// Create blocks, and read each of them in turn.
+	var readers []Reader
+	for i := 0; i < 2; i++ {
+		blockID, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+			labels.FromStrings("a", "1"),
+			labels.FromStrings("a", "2"),
+		}, 100, 0, 1000, labels.FromStrings("ext1", "1"), 124, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+		meta, err := metadata.ReadFromDir(filepath.Join(tmpDir, blockID.String()))
+		testutil.Ok(t, err)
+
+		r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3, meta)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, r.Close()) }()
+		readers = append(readers, r)
+
+		_, err = r.LabelNames()
+		testutil.Ok(t, err)
+		time.Sleep(time.Millisecond)
+	}
+	testutil.Equals(t, 2, promtestutil.CollectAndCount(metrics.lazyReader.loadedBytes))
+
+	// The least recently used reader is unloaded, but not released from the pool.
+	pool.evictReaders()
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(metrics.evictions.WithLabelValues("lru")))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(metrics.lazyReader.unloadCount))
+	testutil.Equals(t, 1, promtestutil.CollectAndCount(metrics.lazyReader.loadedBytes))
+	_, loaded := readers[0].(*LazyBinaryReader).loaded()
+	testutil.Assert(t, !loaded)
+	testutil.Assert(t, pool.isTracking(readers[0].(*LazyBinaryReader)))
+	lr, loaded := readers[1].(*LazyBinaryReader).loaded()
+	testutil.Assert(t, loaded)
+	testutil.Assert(t, lr.Size > 0)
+	testutil.Equals(t, float64(lr.Size), promtestutil.ToFloat64(metrics.lazyReader.loadedBytes.WithLabelValues(lr.BlockID.String())))
+
+	// Reading the unloaded reader loads it again, and makes the other one the least recently used.
+	_, err = readers[0].LabelNames()
+	testutil.Ok(t, err)
+	pool.evictReaders()
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.evictions.WithLabelValues("lru")))
+	_, loaded = readers[0].(*LazyBinaryReader).loaded()
+	testutil.Assert(t, loaded)
+	_, loaded = readers[1].(*LazyBinaryReader).loaded()
+	testutil.Assert(t, !loaded)
+}
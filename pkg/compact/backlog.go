@@ -0,0 +1,180 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// compactionDurationWeight is the weight of the last compaction in the moving average of the compaction durations.
+const compactionDurationWeight = 0.2
+
+// PlannedCompaction is a compaction planned for a group.
+type PlannedCompaction struct {
+	// Blocks is the number of blocks to compact.
+	Blocks int `json:"blocks"`
+	// Level is the compaction level of the resulting block.
+	Level int `json:"level"`
+	// Bytes is the estimated size of the blocks to compact. Sizes of blocks without files in their meta.json are
+	// not known and not accounted for.
+	Bytes int64 `json:"bytes"`
+}
+
+// GroupBacklog is the compaction backlog of a group.
+type GroupBacklog struct {
+	Key        string              `json:"key"`
+	Labels     map[string]string   `json:"labels"`
+	Resolution int64               `json:"resolution"`
+	Plans      []PlannedCompaction `json:"plans"`
+	Blocks     int                 `json:"blocks"`
+	Bytes      int64               `json:"bytes"`
+}
+
+// HaltedGroup is a group whose compaction halted, with the reason.
+type HaltedGroup struct {
+	Key        string            `json:"key"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Reason     string            `json:"reason"`
+	HaltedAt   time.Time         `json:"haltedAt"`
+}
+
+// CompactionBacklogStatus is the state of the compaction backlog, telling whether the compactor keeps up.
+type CompactionBacklogStatus struct {
+	// CalculatedAt is the time the backlog was last calculated, zero if it was not yet.
+	CalculatedAt       time.Time      `json:"calculatedAt"`
+	Groups             []GroupBacklog `json:"groups"`
+	Halted             []HaltedGroup  `json:"halted"`
+	PendingCompactions int            `json:"pendingCompactions"`
+	PendingBlocks      int            `json:"pendingBlocks"`
+	PendingBytes       int64          `json:"pendingBytes"`
+	// AverageCompactionSeconds is the moving average of the durations of the last compactions, nil if no group was
+	// compacted yet.
+	AverageCompactionSeconds *float64 `json:"averageCompactionSeconds"`
+	// EstimatedDrainSeconds is the estimated time to do the pending compactions with the configured concurrency,
+	// nil if it cannot be estimated yet.
+	EstimatedDrainSeconds *float64 `json:"estimatedDrainSeconds"`
+}
+
+// CompactionBacklog tracks the compactions planned by the CompactionProgressCalculator, the groups whose compaction
+// halted and the durations of the compactions, to estimate the time the compactor needs to drain its backlog.
+// All methods are safe to call on a nil CompactionBacklog, and do nothing.
+type CompactionBacklog struct {
+	concurrency int
+
+	mtx                 sync.Mutex
+	calculatedAt        time.Time
+	groups              []GroupBacklog
+	halted              map[string]HaltedGroup
+	avgCompactionTime   time.Duration
+	compactionsObserved bool
+}
+
+// NewCompactionBacklog creates a CompactionBacklog for a compactor compacting the given number of groups concurrently.
+func NewCompactionBacklog(concurrency int) *CompactionBacklog {
+	return &CompactionBacklog{
+		concurrency: max(concurrency, 1),
+		halted:      map[string]HaltedGroup{},
+	}
+}
+
+// SetGroups replaces the backlog of the groups by the given one.
+func (b *CompactionBacklog) SetGroups(groups []GroupBacklog) {
+	if b == nil {
+		return
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.groups = groups
+	b.calculatedAt = time.Now()
+}
+
+// ObserveCompaction records a successful compaction of the given group, which took the given duration.
+func (b *CompactionBacklog) ObserveCompaction(g *Group, d time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.halted, g.Key())
+	if !b.compactionsObserved {
+		b.avgCompactionTime = d
+		b.compactionsObserved = true
+		return
+	}
+	b.avgCompactionTime = time.Duration(compactionDurationWeight*float64(d) + (1-compactionDurationWeight)*float64(b.avgCompactionTime))
+}
+
+// Halted records that the compaction of the given group halted because of the given error.
+func (b *CompactionBacklog) Halted(g *Group, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.halted[g.Key()] = HaltedGroup{
+		Key:        g.Key(),
+		Labels:     g.Labels().Map(),
+		Resolution: g.Resolution(),
+		Reason:     err.Error(),
+		HaltedAt:   time.Now(),
+	}
+}
+
+// Status returns the current state of the backlog.
+func (b *CompactionBacklog) Status() CompactionBacklogStatus {
+	s := CompactionBacklogStatus{Groups: []GroupBacklog{}, Halted: []HaltedGroup{}}
+	if b == nil {
+		return s
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	s.CalculatedAt = b.calculatedAt
+	s.Groups = append(s.Groups, b.groups...)
+	for _, g := range b.groups {
+		s.PendingCompactions += len(g.Plans)
+		s.PendingBlocks += g.Blocks
+		s.PendingBytes += g.Bytes
+	}
+	for _, h := range b.halted {
+		s.Halted = append(s.Halted, h)
+	}
+	sort.Slice(s.Halted, func(i, j int) bool { return s.Halted[i].Key < s.Halted[j].Key })
+
+	if b.compactionsObserved {
+		avg := b.avgCompactionTime.Seconds()
+		s.AverageCompactionSeconds = &avg
+		if !b.calculatedAt.IsZero() {
+			// Groups are compacted concurrently, but the compactions of a group one after the other.
+			var drain float64
+			for _, g := range b.groups {
+				drain = max(drain, float64(len(g.Plans))*avg)
+			}
+			drain = max(drain, float64(s.PendingCompactions)*avg/float64(b.concurrency))
+			s.EstimatedDrainSeconds = &drain
+		}
+	}
+	return s
+}
+
+// blockSize returns the size of the given block, according to the files of its meta.json.
+func blockSize(m *metadata.Meta) (size int64) {
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
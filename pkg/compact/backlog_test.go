@@ -0,0 +1,104 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestCompactionProgressCalculator_Backlog(t *testing.T) {
+	logger := log.NewNopLogger()
+	reg := prometheus.NewRegistry()
+	planner := NewTSDBBasedPlanner(logger, []int64{
+		int64(1 * time.Hour / time.Millisecond),
+		int64(2 * time.Hour / time.Millisecond),
+		int64(4 * time.Hour / time.Millisecond),
+		int64(8 * time.Hour / time.Millisecond),
+	})
+	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for compact progress tests"})
+	grouper := NewDefaultGrouper(logger, nil, false, false, reg, temp, temp, temp, "", 1, 1)
+
+	backlog := NewCompactionBacklog(2)
+	ps := NewCompactionProgressCalculator(reg, planner).WithBacklog(backlog)
+
+	blocks := map[ulid.ULID]*metadata.Meta{}
+	for i := 0; i < 5; i++ {
+		m := createBlockMeta(uint64(i), int64(time.Duration(2*i)*time.Hour/time.Millisecond), int64(time.Duration(2*i+2)*time.Hour/time.Millisecond), map[string]string{"a": "1"}, 0, []uint64{})
+		m.Thanos.Files = []metadata.File{{RelPath: "index", SizeBytes: 10}, {RelPath: "chunks/000001", SizeBytes: 90}, {RelPath: "meta.json"}}
+		blocks[m.ULID] = m
+	}
+	m := createBlockMeta(5, 0, int64(2*time.Hour/time.Millisecond), map[string]string{"b": "2"}, 0, []uint64{})
+	blocks[m.ULID] = m
+
+	groups, err := grouper.Groups(blocks)
+	testutil.Ok(t, err)
+	testutil.Ok(t, ps.ProgressCalculate(context.Background(), groups))
+
+	status := backlog.Status()
+	testutil.Assert(t, !status.CalculatedAt.IsZero())
+	testutil.Equals(t, []GroupBacklog{{
+		Key:    blocks[ulid.MustNew(0, nil)].Thanos.GroupKey(),
+		Labels: map[string]string{"a": "1"},
+		Plans: []PlannedCompaction{
+			{Blocks: 2, Level: 1, Bytes: 200},
+			{Blocks: 2, Level: 1, Bytes: 200},
+			// The size of the blocks resulting from the planned compactions is accounted for.
+			{Blocks: 2, Level: 2, Bytes: 400},
+		},
+		Blocks: 6,
+		Bytes:  800,
+	}}, status.Groups)
+	testutil.Equals(t, 3, status.PendingCompactions)
+	testutil.Equals(t, 6, status.PendingBlocks)
+	testutil.Equals(t, int64(800), status.PendingBytes)
+	testutil.Assert(t, status.EstimatedDrainSeconds == nil, "drain time estimated without any compaction")
+}
+
+func TestCompactionBacklog_Status(t *testing.T) {
+	var nilBacklog *CompactionBacklog
+	nilBacklog.SetGroups([]GroupBacklog{{Key: "a"}})
+	testutil.Equals(t, CompactionBacklogStatus{Groups: []GroupBacklog{}, Halted: []HaltedGroup{}}, nilBacklog.Status())
+
+	b := NewCompactionBacklog(2)
+	b.SetGroups([]GroupBacklog{
+		{Key: "b", Plans: make([]PlannedCompaction, 1)},
+		{Key: "a", Plans: make([]PlannedCompaction, 4)},
+		{Key: "c", Plans: make([]PlannedCompaction, 1)},
+	})
+
+	a := &Group{key: "a", labels: labels.FromStrings("a", "1")}
+	b.ObserveCompaction(a, 10*time.Second)
+	b.ObserveCompaction(a, 20*time.Second)
+	b.Halted(a, halt(errors.New("overlapping blocks")))
+
+	status := b.Status()
+	testutil.Equals(t, []string{"a", "b", "c"}, []string{status.Groups[0].Key, status.Groups[1].Key, status.Groups[2].Key})
+	testutil.Equals(t, 6, status.PendingCompactions)
+	testutil.Equals(t, 12.0, *status.AverageCompactionSeconds)
+	// The compactions of a group are not done concurrently.
+	testutil.Equals(t, 48.0, *status.EstimatedDrainSeconds)
+	testutil.Equals(t, 1, len(status.Halted))
+	testutil.Equals(t, "a", status.Halted[0].Key)
+	testutil.Equals(t, map[string]string{"a": "1"}, status.Halted[0].Labels)
+	testutil.Equals(t, "overlapping blocks", status.Halted[0].Reason)
+
+	// A compaction of the group clears its halted state.
+	b.SetGroups([]GroupBacklog{{Key: "a", Plans: make([]PlannedCompaction, 2)}, {Key: "b", Plans: make([]PlannedCompaction, 8)}})
+	b.ObserveCompaction(a, 12*time.Second)
+	status = b.Status()
+	testutil.Equals(t, 0, len(status.Halted))
+	testutil.Equals(t, 96.0, *status.EstimatedDrainSeconds)
+}
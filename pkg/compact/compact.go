@@ -571,6 +571,7 @@ type ProgressCalculator interface {
 // CompactionProgressCalculator contains a planner and ProgressMetrics, which are updated during the compaction simulation process.
 type CompactionProgressCalculator struct {
 	planner Planner
+	backlog *CompactionBacklog
 	*CompactProgressMetrics
 }
 
@@ -591,10 +592,19 @@ func NewCompactionProgressCalculator(reg prometheus.Registerer, planner *tsdbBas
 	}
 }
 
+// WithBacklog sets the backlog in which the planned compactions of each group are recorded.
+func (ps *CompactionProgressCalculator) WithBacklog(backlog *CompactionBacklog) *CompactionProgressCalculator {
+	ps.backlog = backlog
+	return ps
+}
+
 // ProgressCalculate calculates the number of blocks and compaction runs in the planning process of the given groups.
 func (ps *CompactionProgressCalculator) ProgressCalculate(ctx context.Context, groups []*Group) error {
 	groupCompactions := make(map[string]int, len(groups))
 	groupBlocks := make(map[string]int, len(groups))
+	backlogs := make(map[string]*GroupBacklog, len(groups))
+	// Sizes of the blocks resulting from the simulated compactions, which have no files.
+	simulatedSizes := map[*metadata.Meta]int64{}
 
 	for len(groups) > 0 {
 		tmpGroups := make([]*Group, 0, len(groups))
@@ -613,20 +623,38 @@ func (ps *CompactionProgressCalculator) ProgressCalculate(ctx context.Context, g
 
 			toRemove := make(map[ulid.ULID]struct{}, len(plan))
 			metas := make([]*tsdb.BlockMeta, 0, len(plan))
+			planned := PlannedCompaction{Blocks: len(plan)}
 			for _, p := range plan {
 				metas = append(metas, &p.BlockMeta)
 				toRemove[p.BlockMeta.ULID] = struct{}{}
+				planned.Level = max(planned.Level, p.Compaction.Level+1)
+				if size, ok := simulatedSizes[p]; ok {
+					planned.Bytes += size
+				} else {
+					planned.Bytes += blockSize(p)
+				}
 			}
 			g.deleteFromGroup(toRemove)
 
 			groupBlocks[g.key] += len(plan)
 
+			backlog, ok := backlogs[g.key]
+			if !ok {
+				backlog = &GroupBacklog{Key: g.key, Labels: g.Labels().Map(), Resolution: g.Resolution()}
+				backlogs[g.key] = backlog
+			}
+			backlog.Plans = append(backlog.Plans, planned)
+			backlog.Blocks += planned.Blocks
+			backlog.Bytes += planned.Bytes
+
 			if len(g.metasByMinTime) == 0 {
 				continue
 			}
 
 			newMeta := tsdb.CompactBlockMetas(ulid.MustNew(uint64(time.Now().Unix()), nil), metas...)
-			if err := g.AppendMeta(&metadata.Meta{BlockMeta: *newMeta, Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: g.Resolution()}, Labels: g.Labels().Map()}}); err != nil {
+			simulated := &metadata.Meta{BlockMeta: *newMeta, Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: g.Resolution()}, Labels: g.Labels().Map()}}
+			simulatedSizes[simulated] = planned.Bytes
+			if err := g.AppendMeta(simulated); err != nil {
 				return errors.Wrapf(err, "append meta")
 			}
 			tmpGroups = append(tmpGroups, g)
@@ -643,6 +671,13 @@ func (ps *CompactionProgressCalculator) ProgressCalculate(ctx context.Context, g
 		ps.CompactProgressMetrics.NumberOfCompactionBlocks.Add(float64(groupBlocks[key]))
 	}
 
+	if ps.backlog != nil {
+		groupBacklogs := make([]GroupBacklog, 0, len(backlogs))
+		for _, b := range backlogs {
+			groupBacklogs = append(groupBacklogs, *b)
+		}
+		ps.backlog.SetGroups(groupBacklogs)
+	}
 	return nil
 }
 
@@ -750,6 +785,7 @@ type RetentionProgressMetrics struct {
 type RetentionProgressCalculator struct {
 	*RetentionProgressMetrics
 	retentionByResolution map[ResolutionLevel]time.Duration
+	policies              []RetentionPolicy
 }
 
 // NewRetentionProgressCalculator creates a new RetentionProgressCalculator.
@@ -765,13 +801,20 @@ func NewRetentionProgressCalculator(reg prometheus.Registerer, retentionByResolu
 	}
 }
 
+// WithRetentionPolicies sets the retention policies overriding the retention of the resolution of the blocks matching
+// them.
+func (rs *RetentionProgressCalculator) WithRetentionPolicies(policies []RetentionPolicy) *RetentionProgressCalculator {
+	rs.policies = policies
+	return rs
+}
+
 // ProgressCalculate calculates the number of blocks to be retained for the given groups.
 func (rs *RetentionProgressCalculator) ProgressCalculate(ctx context.Context, groups []*Group) error {
 	groupBlocks := make(map[string]int, len(groups))
 
 	for _, group := range groups {
 		for _, m := range group.metasByMinTime {
-			retentionDuration := rs.retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
+			retentionDuration, _ := blockRetention(m, rs.policies, rs.retentionByResolution)
 			if retentionDuration.Seconds() == 0 {
 				continue
 			}
@@ -1364,6 +1407,7 @@ type BucketCompactor struct {
 	bkt                            objstore.Bucket
 	concurrency                    int
 	skipBlocksWithOutOfOrderChunks bool
+	backlog                        *CompactionBacklog
 }
 
 // NewBucketCompactor creates a new bucket compactor.
@@ -1427,6 +1471,12 @@ func NewBucketCompactorWithCheckerAndCallback(
 	}, nil
 }
 
+// WithBacklog sets the backlog in which the durations of the compactions and the halted groups are recorded.
+func (c *BucketCompactor) WithBacklog(backlog *CompactionBacklog) *BucketCompactor {
+	c.backlog = backlog
+	return c
+}
+
 // Compact runs compaction over bucket.
 func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 	defer func() {
@@ -1460,9 +1510,11 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 			go func() {
 				defer wg.Done()
 				for g := range groupChan {
+					begin := time.Now()
 					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.planner, c.comp, c.blockDeletableChecker, c.compactionLifecycleCallback)
 					if err == nil {
 						if shouldRerunGroup {
+							c.backlog.ObserveCompaction(g, time.Since(begin))
 							mtx.Lock()
 							finishedAllGroups = false
 							mtx.Unlock()
@@ -1495,6 +1547,9 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 							continue
 						}
 					}
+					if IsHaltError(err) {
+						c.backlog.Halted(g, err)
+					}
 					errChan <- errors.Wrapf(err, "group %s", g.Key())
 					return
 				}
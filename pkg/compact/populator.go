@@ -0,0 +1,492 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// populateSymbolsBatchSize is the number of symbols passed at once between the goroutines merging symbol tables.
+	populateSymbolsBatchSize = 4096
+	// populateSeriesBatchSize is the number of series passed at once between the stages writing series.
+	populateSeriesBatchSize = 256
+	// populateBufferedBatches is the number of batches buffered between goroutines, bounding the memory they use.
+	populateBufferedBatches = 4
+)
+
+// ParallelBlockPopulator populates compacted blocks like tsdb.DefaultBlockPopulator, using multiple goroutines on its
+// hot paths, which are single-threaded in the default populator:
+//   - The symbol tables of the blocks are read concurrently, and merged by a tree of goroutines.
+//   - Series are merged, their chunks are written, and the series are added to the index in a pipeline, every stage
+//     running in its own goroutine. Batches of series are merged, and their chunks read, by Concurrency goroutines.
+//
+// The output is the same as the one of the default populator. Postings are still written by the index writer, once
+// all series are added.
+type ParallelBlockPopulator struct {
+	// Concurrency is the number of goroutines merging series and reading their chunks. Defaults to one.
+	Concurrency int
+	// MemoryBudget bounds the bytes of the labels and chunks of the merged series waiting to be written, if positive.
+	// A single batch of series is written even if it exceeds the budget on its own.
+	MemoryBudget int64
+}
+
+// PopulateBlock fills the index and chunk writers with the union of the series of the given blocks, sorted by mint.
+func (p ParallelBlockPopulator) PopulateBlock(ctx context.Context, metrics *tsdb.CompactorMetrics, logger log.Logger, chunkPool chunkenc.Pool, mergeFunc storage.VerticalChunkSeriesMergeFunc, blocks []tsdb.BlockReader, meta *tsdb.BlockMeta, indexw tsdb.IndexWriter, chunkw tsdb.ChunkWriter) (err error) {
+	if len(blocks) == 0 {
+		return errors.New("cannot populate block from no readers")
+	}
+
+	var (
+		sets        []storage.ChunkSeriesSet
+		symbols     []index.StringIter
+		closers     []io.Closer
+		overlapping bool
+	)
+	defer func() {
+		errs := tsdb_errors.NewMulti(err)
+		if cerr := tsdb_errors.CloseAll(closers); cerr != nil {
+			errs.Add(errors.Wrap(cerr, "close"))
+		}
+		err = errs.Err()
+		metrics.PopulatingBlocks.Set(0)
+	}()
+	metrics.PopulatingBlocks.Set(1)
+
+	globalMaxt := blocks[0].Meta().MaxTime
+	for i, b := range blocks {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if !overlapping {
+			if i > 0 && b.Meta().MinTime < globalMaxt {
+				metrics.OverlappingBlocks.Inc()
+				overlapping = true
+				level.Info(logger).Log("msg", "found overlapping blocks during compaction", "ulid", meta.ULID)
+			}
+			if b.Meta().MaxTime > globalMaxt {
+				globalMaxt = b.Meta().MaxTime
+			}
+		}
+
+		indexr, err := b.Index()
+		if err != nil {
+			return errors.Wrapf(err, "open index reader for block %+v", b.Meta())
+		}
+		closers = append(closers, indexr)
+
+		chunkr, err := b.Chunks()
+		if err != nil {
+			return errors.Wrapf(err, "open chunk reader for block %+v", b.Meta())
+		}
+		closers = append(closers, chunkr)
+
+		tombsr, err := b.Tombstones()
+		if err != nil {
+			return errors.Wrapf(err, "open tombstone reader for block %+v", b.Meta())
+		}
+		closers = append(closers, tombsr)
+
+		k, v := index.AllPostingsKey()
+		all, err := indexr.Postings(ctx, k, v)
+		if err != nil {
+			return err
+		}
+		all = indexr.SortedPostings(all)
+		// Blocks meta is half open: [min, max), so subtract 1 to ensure we don't hold samples with exact meta.MaxTime timestamp.
+		sets = append(sets, tsdb.NewBlockChunkSeriesSet(b.Meta().ULID, indexr, chunkr, tombsr, all, meta.MinTime, meta.MaxTime-1, false))
+		symbols = append(symbols, indexr.Symbols())
+	}
+
+	if err := populateSymbols(ctx, symbols, indexw); err != nil {
+		return err
+	}
+
+	set := sets[0]
+	if len(sets) > 1 {
+		// Merge series using specified chunk series merger.
+		// The default one is the compacting series merger.
+		set = storage.NewMergeChunkSeriesSet(sets, mergeFunc)
+	}
+	return populateSeries(ctx, set, p.Concurrency, p.MemoryBudget, chunkPool, meta, indexw, chunkw)
+}
+
+// populateSymbols adds the union of the given sorted symbol tables to the index writer.
+func populateSymbols(ctx context.Context, symbols []index.StringIter, indexw tsdb.IndexWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	g, gctx := errgroup.WithContext(ctx)
+
+	// Every symbol table is read by its own goroutine. Pairs of streams are merged by their own goroutine too, until a
+	// single stream is left.
+	streams := make([]index.StringIter, 0, len(symbols))
+	for _, it := range symbols {
+		streams = append(streams, streamStrings(gctx, g, it))
+	}
+	for len(streams) > 1 {
+		merged := streams[:0]
+		for i := 0; i < len(streams); i += 2 {
+			if i+1 == len(streams) {
+				merged = append(merged, streams[i])
+				continue
+			}
+			merged = append(merged, streamStrings(gctx, g, tsdb.NewMergedStringIter(streams[i], streams[i+1])))
+		}
+		streams = merged
+	}
+
+	err := addSymbols(streams[0], indexw)
+	// Stop the goroutines which are still running if symbols could not be added.
+	cancel()
+	if gerr := g.Wait(); err == nil && gerr != nil {
+		err = errors.Wrap(gerr, "next symbol")
+	}
+	return err
+}
+
+func addSymbols(symbols index.StringIter, indexw tsdb.IndexWriter) error {
+	for symbols.Next() {
+		if err := indexw.AddSymbol(symbols.At()); err != nil {
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+	return errors.Wrap(symbols.Err(), "next symbol")
+}
+
+// streamStrings iterates the given iterator in a new goroutine of the group, and returns an iterator over its strings.
+// Errors of the iterator are returned by the group.
+func streamStrings(ctx context.Context, g *errgroup.Group, it index.StringIter) index.StringIter {
+	ch := make(chan []string, populateBufferedBatches)
+	g.Go(func() error {
+		defer close(ch)
+		batch := make([]string, 0, populateSymbolsBatchSize)
+		for it.Next() {
+			batch = append(batch, it.At())
+			if len(batch) < populateSymbolsBatchSize {
+				continue
+			}
+			select {
+			case ch <- batch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			batch = make([]string, 0, populateSymbolsBatchSize)
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			select {
+			case ch <- batch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	return &streamedStrings{ctx: ctx, ch: ch}
+}
+
+// streamedStrings iterates over batches of strings received from another goroutine.
+type streamedStrings struct {
+	ctx   context.Context
+	ch    <-chan []string
+	batch []string
+	cur   string
+}
+
+func (s *streamedStrings) Next() bool {
+	for len(s.batch) == 0 {
+		var ok bool
+		if s.batch, ok = <-s.ch; !ok {
+			return false
+		}
+	}
+	s.cur, s.batch = s.batch[0], s.batch[1:]
+	return true
+}
+
+func (s *streamedStrings) At() string { return s.cur }
+
+// Err returns the cancellation of the stream, if any. Errors of the goroutine sending strings are returned by its group.
+func (s *streamedStrings) Err() error { return s.ctx.Err() }
+
+type populatedSeries struct {
+	lset labels.Labels
+	chks []chunks.Meta
+}
+
+// populatedBatch is a batch of series, merged by one of the workers of populateSeries.
+type populatedBatch struct {
+	seq    int
+	series []populatedSeries
+	// size is the number of bytes of the labels and chunks of the series, accounted in the memory budget.
+	size int64
+}
+
+// populateJob is a batch of series of the set to be merged by a worker, which sends the merged batch to result.
+type populateJob struct {
+	seq    int
+	series []storage.ChunkSeries
+	result chan populatedBatch
+}
+
+// populateSeries writes the given sorted series in a pipeline: series of the set are iterated in one goroutine, and
+// handed out in batches to the given number of workers merging them and reading their chunks. Merged batches are
+// written to the chunk writer in order in another goroutine, and added to the index in the calling one.
+// The labels and chunks of the merged series held until they are added to the index are bounded by the given memory
+// budget, in bytes, if positive.
+func populateSeries(ctx context.Context, set storage.ChunkSeriesSet, concurrency int, memoryBudget int64, chunkPool chunkenc.Pool, meta *tsdb.BlockMeta, indexw tsdb.IndexWriter, chunkw tsdb.ChunkWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	g, gctx := errgroup.WithContext(ctx)
+
+	concurrency = max(concurrency, 1)
+	budget := newPopulateBudget(memoryBudget)
+
+	// Jobs are sent to ordered as they are handed out, so that merged batches are written in the order of the set.
+	jobs := make(chan populateJob)
+	ordered := make(chan populateJob, concurrency+populateBufferedBatches)
+	g.Go(func() error {
+		defer close(jobs)
+		defer close(ordered)
+
+		seq := 0
+		batch := make([]storage.ChunkSeries, 0, populateSeriesBatchSize)
+		send := func() error {
+			job := populateJob{seq: seq, series: batch, result: make(chan populatedBatch, 1)}
+			for _, ch := range []chan populateJob{ordered, jobs} {
+				select {
+				case ch <- job:
+				case <-gctx.Done():
+					return gctx.Err()
+				}
+			}
+			seq++
+			batch = make([]storage.ChunkSeries, 0, populateSeriesBatchSize)
+			return nil
+		}
+		for set.Next() {
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			default:
+			}
+			// Series are kept as they are, their chunks being merged and read by the workers.
+			batch = append(batch, set.At())
+			if len(batch) < populateSeriesBatchSize {
+				continue
+			}
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if err := set.Err(); err != nil {
+			return errors.Wrap(err, "iterate compaction set")
+		}
+		if len(batch) > 0 {
+			return send()
+		}
+		return nil
+	})
+
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			var chksIter chunks.Iterator
+			for job := range jobs {
+				merged := populatedBatch{seq: job.seq, series: make([]populatedSeries, 0, len(job.series))}
+				for _, s := range job.series {
+					chksIter = s.Iterator(chksIter)
+					var chks []chunks.Meta
+					for chksIter.Next() {
+						// We are not iterating in a streaming way over chunks as
+						// it's more efficient to do bulk write for index and
+						// chunk file purposes.
+						chks = append(chks, chksIter.At())
+					}
+					if err := chksIter.Err(); err != nil {
+						return errors.Wrap(err, "chunk iter")
+					}
+					// Skip series with all deleted chunks.
+					if len(chks) == 0 {
+						continue
+					}
+
+					lset := s.Labels().Copy()
+					merged.series = append(merged.series, populatedSeries{lset: lset, chks: chks})
+					merged.size += seriesSize(lset, chks)
+				}
+				if err := budget.acquire(gctx, merged.seq, merged.size); err != nil {
+					return err
+				}
+				job.result <- merged
+			}
+			return nil
+		})
+	}
+
+	written := make(chan populatedBatch, populateBufferedBatches)
+	g.Go(func() error {
+		defer close(written)
+		for job := range ordered {
+			var batch populatedBatch
+			select {
+			case batch = <-job.result:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			for _, s := range batch.series {
+				if err := chunkw.WriteChunks(s.chks...); err != nil {
+					return errors.Wrap(err, "write chunks")
+				}
+			}
+			select {
+			case written <- batch:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+
+	err := addSeries(written, budget, chunkPool, meta, indexw)
+	// Stop the pipeline if series could not be added, and drain it so that its goroutines don't block.
+	cancel()
+	for range written {
+	}
+	if gerr := g.Wait(); err == nil {
+		err = gerr
+	}
+	return err
+}
+
+func addSeries(written <-chan populatedBatch, budget *populateBudget, chunkPool chunkenc.Pool, meta *tsdb.BlockMeta, indexw tsdb.IndexWriter) error {
+	ref := storage.SeriesRef(0)
+	for batch := range written {
+		for _, s := range batch.series {
+			if err := indexw.AddSeries(ref, s.lset, s.chks...); err != nil {
+				return errors.Wrap(err, "add series")
+			}
+
+			meta.Stats.NumChunks += uint64(len(s.chks))
+			meta.Stats.NumSeries++
+			for _, chk := range s.chks {
+				meta.Stats.NumSamples += uint64(chk.Chunk.NumSamples())
+			}
+
+			for _, chk := range s.chks {
+				if err := chunkPool.Put(chk.Chunk); err != nil {
+					return errors.Wrap(err, "put chunk")
+				}
+			}
+			ref++
+		}
+		budget.release(batch.size)
+	}
+	return nil
+}
+
+// seriesSize returns the number of bytes of the labels and chunks of a merged series.
+func seriesSize(lset labels.Labels, chks []chunks.Meta) int64 {
+	var size int
+	lset.Range(func(l labels.Label) {
+		size += len(l.Name) + len(l.Value)
+	})
+	for _, chk := range chks {
+		size += len(chk.Chunk.Bytes())
+	}
+	return int64(size)
+}
+
+// populateBudget bounds the bytes of the merged batches of series held by populateSeries. Batches are released in
+// the order they are acquired by, which is the order of their sequence numbers.
+// A nil populateBudget is unlimited.
+type populateBudget struct {
+	limit int64
+
+	mtx  sync.Mutex
+	used int64
+	// next is the sequence number of the next batch to be released.
+	next int
+	// released is closed, and replaced, whenever a batch is released.
+	released chan struct{}
+}
+
+// newPopulateBudget returns a budget of the given number of bytes, or nil if it is not positive.
+func newPopulateBudget(limit int64) *populateBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &populateBudget{limit: limit, released: make(chan struct{})}
+}
+
+// acquire waits until the batch with the given sequence number and size fits in the budget. The next batch to be
+// released is never waiting, even if it exceeds the budget on its own, as the batches acquired after it are only
+// released once it is.
+func (b *populateBudget) acquire(ctx context.Context, seq int, size int64) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mtx.Lock()
+		if seq == b.next || b.used+size <= b.limit {
+			b.used += size
+			b.mtx.Unlock()
+			return nil
+		}
+		released := b.released
+		b.mtx.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release releases the next batch, of the given size.
+func (b *populateBudget) release(size int64) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.used -= size
+	b.next++
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// parallelPopulatorCallback is a compaction lifecycle callback populating blocks with a ParallelBlockPopulator.
+type parallelPopulatorCallback struct {
+	CompactionLifecycleCallback
+	populator ParallelBlockPopulator
+}
+
+// NewParallelPopulatorCallback returns the given compaction lifecycle callback, populating compacted blocks with the
+// given ParallelBlockPopulator.
+func NewParallelPopulatorCallback(cb CompactionLifecycleCallback, populator ParallelBlockPopulator) CompactionLifecycleCallback {
+	return parallelPopulatorCallback{CompactionLifecycleCallback: cb, populator: populator}
+}
+
+func (c parallelPopulatorCallback) GetBlockPopulator(_ context.Context, _ log.Logger, _ *Group) (tsdb.BlockPopulator, error) {
+	return c.populator, nil
+}
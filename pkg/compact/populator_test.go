@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/dedup"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestParallelBlockPopulator(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+
+	series := func(from, to int) []labels.Labels {
+		var res []labels.Labels
+		for i := from; i < to; i++ {
+			res = append(res, labels.FromStrings("__name__", "metric", "a", fmt.Sprintf("%d", i), fmt.Sprintf("name-%d", i%7), "value"))
+		}
+		return res
+	}
+	var dirs []string
+	for _, b := range []struct {
+		series     []labels.Labels
+		mint, maxt int64
+	}{
+		// Enough series and symbols to be streamed in multiple batches.
+		{series: series(0, 5000), mint: 0, maxt: 1000},
+		{series: series(2500, 7500), mint: 1000, maxt: 2000},
+		// Overlapping blocks are merged vertically.
+		{series: series(6000, 9000), mint: 1500, maxt: 2500},
+	} {
+		id, err := e2eutil.CreateBlock(ctx, src, b.series, 10, b.mint, b.maxt, labels.EmptyLabels(), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		dirs = append(dirs, filepath.Join(src, id.String()))
+	}
+
+	for _, mergeFunc := range []storage.VerticalChunkSeriesMergeFunc{
+		storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge),
+		dedup.NewChunkSeriesMerger(),
+	} {
+		comp, err := tsdb.NewLeveledCompactor(ctx, nil, log.NewNopLogger(), []int64{1000, 3000}, nil, mergeFunc)
+		testutil.Ok(t, err)
+
+		var blocks []string
+		for _, populator := range []tsdb.BlockPopulator{
+			tsdb.DefaultBlockPopulator{},
+			ParallelBlockPopulator{},
+			ParallelBlockPopulator{Concurrency: 4},
+			// A budget smaller than any batch of series lets a single batch through at once.
+			ParallelBlockPopulator{Concurrency: 4, MemoryBudget: 1},
+		} {
+			dest := t.TempDir()
+			ids, err := comp.CompactWithBlockPopulator(dest, dirs, nil, populator)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(ids))
+			blocks = append(blocks, filepath.Join(dest, ids[0].String()))
+		}
+
+		// All populators write the same index and chunks.
+		for _, b := range blocks[1:] {
+			for _, f := range []string{block.IndexFilename, filepath.Join(block.ChunksDirname, "000001")} {
+				want, err := os.ReadFile(filepath.Join(blocks[0], f))
+				testutil.Ok(t, err)
+				got, err := os.ReadFile(filepath.Join(b, f))
+				testutil.Ok(t, err)
+				testutil.Assert(t, len(want) > 0, "empty %s", f)
+				testutil.Assert(t, string(want) == string(got), "different %s", f)
+			}
+			want, err := metadata.ReadFromDir(blocks[0])
+			testutil.Ok(t, err)
+			got, err := metadata.ReadFromDir(b)
+			testutil.Ok(t, err)
+			testutil.Equals(t, want.Stats, got.Stats)
+			testutil.Equals(t, uint64(9000), got.Stats.NumSeries)
+		}
+	}
+}
+
+func TestPopulateBudget(t *testing.T) {
+	ctx := context.Background()
+	b := newPopulateBudget(10)
+
+	testutil.Ok(t, b.acquire(ctx, 0, 6))
+	testutil.Ok(t, b.acquire(ctx, 1, 4))
+
+	// Later batches wait for the budget to be released.
+	acquired := make(chan error)
+	go func() { acquired <- b.acquire(ctx, 2, 5) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired over the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.release(6)
+	testutil.Ok(t, <-acquired)
+
+	// The next batch to be released is never waiting.
+	b.release(4)
+	b.release(5)
+	testutil.Ok(t, b.acquire(ctx, 3, 100))
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	testutil.Equals(t, context.Canceled, b.acquire(cctx, 4, 1))
+
+	// A nil budget is unlimited.
+	var nilBudget *populateBudget
+	testutil.Ok(t, nilBudget.acquire(ctx, 1, 100))
+	nilBudget.release(100)
+}
@@ -6,6 +6,7 @@ package compact
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-kit/log"
@@ -13,12 +14,82 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/thanos-io/objstore"
+	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 )
 
+// RetentionPolicy is the retention of the blocks whose external labels match the selector of the policy, overriding
+// the retention of their resolution.
+type RetentionPolicy struct {
+	// Selector is a series selector over the external labels of blocks, e.g. {tenant="dev"}.
+	Selector string `yaml:"selector"`
+	// Retention is how long the blocks are retained. Zero retains them forever.
+	Retention model.Duration `yaml:"retention"`
+
+	matchers []*labels.Matcher
+}
+
+// Matches returns whether the given external labels of a block match the selector of the policy.
+func (p RetentionPolicy) Matches(lset labels.Labels) bool {
+	for _, m := range p.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRetentionPolicies parses the YAML list of retention policies.
+func ParseRetentionPolicies(content []byte) ([]RetentionPolicy, error) {
+	var policies []RetentionPolicy
+	if err := yaml.UnmarshalStrict(content, &policies); err != nil {
+		return nil, errors.Wrap(err, "parsing retention policies YAML")
+	}
+	for i, p := range policies {
+		if p.Selector == "" {
+			return nil, errors.Errorf("retention policy %d: empty selector", i)
+		}
+		matchers, err := parser.ParseMetricSelector(p.Selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "retention policy %d: parse selector %s", i, p.Selector)
+		}
+		if time.Duration(p.Retention) < 0 {
+			return nil, errors.Errorf("retention policy %d: negative retention %s", i, p.Retention)
+		}
+		policies[i].matchers = matchers
+	}
+	return policies, nil
+}
+
+// blockRetention returns the retention of the given block: the one of the first of the given policies matching its
+// external labels, if any, or else the one of its resolution.
+func blockRetention(m *metadata.Meta, policies []RetentionPolicy, retentionByResolution map[ResolutionLevel]time.Duration) (time.Duration, *RetentionPolicy) {
+	if len(policies) > 0 {
+		lset := labels.FromMap(m.Thanos.Labels)
+		for i := range policies {
+			if policies[i].Matches(lset) {
+				return time.Duration(policies[i].Retention), &policies[i]
+			}
+		}
+	}
+	return retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)], nil
+}
+
+// ExpiredBlock is a block exceeding its retention.
+type ExpiredBlock struct {
+	ID        ulid.ULID
+	MaxTime   time.Time
+	Retention time.Duration
+	// Policy is the selector of the retention policy of the block, empty if the retention of its resolution applies.
+	Policy string
+}
+
 // ApplyRetentionPolicyByResolution removes blocks depending on the specified retentionByResolution based on blocks MaxTime.
 // A value of 0 disables the retention for its resolution.
 func ApplyRetentionPolicyByResolution(
@@ -29,21 +100,60 @@ func ApplyRetentionPolicyByResolution(
 	retentionByResolution map[ResolutionLevel]time.Duration,
 	blocksMarkedForDeletion prometheus.Counter,
 ) error {
-	level.Info(logger).Log("msg", "start optional retention")
+	_, err := ApplyRetentionPolicies(ctx, logger, bkt, metas, nil, retentionByResolution, false, blocksMarkedForDeletion)
+	return err
+}
+
+// ApplyRetentionPolicies removes blocks depending on their retention based on blocks MaxTime: the retention of the
+// first of the given policies matching their external labels, or else the one of their resolution in the specified
+// retentionByResolution. A retention of 0 retains blocks forever.
+// It returns the blocks exceeding their retention, sorted by ID. In dry run mode, these blocks are only reported, and
+// not marked for deletion.
+func ApplyRetentionPolicies(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	metas map[ulid.ULID]*metadata.Meta,
+	policies []RetentionPolicy,
+	retentionByResolution map[ResolutionLevel]time.Duration,
+	dryRun bool,
+	blocksMarkedForDeletion prometheus.Counter,
+) ([]ExpiredBlock, error) {
+	level.Info(logger).Log("msg", "start optional retention", "dryRun", dryRun)
+
+	var expired []ExpiredBlock
 	for id, m := range metas {
-		retentionDuration := retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
+		retentionDuration, policy := blockRetention(m, policies, retentionByResolution)
 		if retentionDuration.Seconds() == 0 {
 			continue
 		}
 
 		maxTime := time.Unix(m.MaxTime/1000, 0)
-		if time.Now().After(maxTime.Add(retentionDuration)) {
-			level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", id, "maxTime", maxTime.String())
-			if err := block.MarkForDeletion(ctx, logger, bkt, id, fmt.Sprintf("block exceeding retention of %v", retentionDuration), blocksMarkedForDeletion); err != nil {
-				return errors.Wrap(err, "delete block")
-			}
+		if !time.Now().After(maxTime.Add(retentionDuration)) {
+			continue
+		}
+		b := ExpiredBlock{ID: id, MaxTime: maxTime, Retention: retentionDuration}
+		if policy != nil {
+			b.Policy = policy.Selector
+		}
+		expired = append(expired, b)
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID.Compare(expired[j].ID) < 0 })
+
+	for _, b := range expired {
+		if dryRun {
+			level.Info(logger).Log("msg", "dry run: block exceeding retention would be marked for deletion", "id", b.ID, "maxTime", b.MaxTime.String(), "retention", b.Retention, "policy", b.Policy)
+			continue
+		}
+		level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", b.ID, "maxTime", b.MaxTime.String(), "policy", b.Policy)
+		reason := fmt.Sprintf("block exceeding retention of %v", b.Retention)
+		if b.Policy != "" {
+			reason = fmt.Sprintf("block exceeding retention of %v of the policy %s", b.Retention, b.Policy)
+		}
+		if err := block.MarkForDeletion(ctx, logger, bkt, b.ID, reason, blocksMarkedForDeletion); err != nil {
+			return nil, errors.Wrap(err, "delete block")
 		}
 	}
-	level.Info(logger).Log("msg", "optional retention apply done")
-	return nil
+	level.Info(logger).Log("msg", "optional retention apply done", "expiredBlocks", len(expired))
+	return expired, nil
 }
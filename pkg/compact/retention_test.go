@@ -304,3 +304,93 @@ func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxT
 	testutil.Ok(t, bkt.Upload(context.Background(), id+"/chunks/000002", strings.NewReader("@test-data@")))
 	testutil.Ok(t, bkt.Upload(context.Background(), id+"/chunks/000003", strings.NewReader("@test-data@")))
 }
+
+func TestApplyRetentionPolicies(t *testing.T) {
+	logger := log.NewNopLogger()
+	ctx := context.TODO()
+
+	policies, err := compact.ParseRetentionPolicies([]byte(`
+- selector: '{tenant="dev"}'
+  retention: 30d
+- selector: '{env=~"prod|staging"}'
+  retention: 0d
+`))
+	testutil.Ok(t, err)
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for _, b := range []struct {
+		id     string
+		maxAge time.Duration
+		labels map[string]string
+	}{
+		// Expired by its policy, before the retention of its resolution.
+		{id: "01CPHBEX20729MJQZXE3W0BW40", maxAge: 40 * 24 * time.Hour, labels: map[string]string{"tenant": "dev"}},
+		{id: "01CPHBEX20729MJQZXE3W0BW41", maxAge: 20 * 24 * time.Hour, labels: map[string]string{"tenant": "dev"}},
+		// Policies with no retention retain blocks forever.
+		{id: "01CPHBEX20729MJQZXE3W0BW42", maxAge: 400 * 24 * time.Hour, labels: map[string]string{"env": "prod"}},
+		// The first matching policy applies.
+		{id: "01CPHBEX20729MJQZXE3W0BW43", maxAge: 400 * 24 * time.Hour, labels: map[string]string{"env": "prod", "tenant": "dev"}},
+		// Blocks matching no policy fall back to the retention of their resolution.
+		{id: "01CPHBEX20729MJQZXE3W0BW44", maxAge: 400 * 24 * time.Hour, labels: map[string]string{"env": "test"}},
+		{id: "01CPHBEX20729MJQZXE3W0BW45", maxAge: 40 * 24 * time.Hour},
+	} {
+		maxTime := time.Now().Add(-b.maxAge)
+		uploadMockBlock(t, bkt, b.id, maxTime.Add(-time.Hour), maxTime, int64(compact.ResolutionLevelRaw))
+		metas[ulid.MustParse(b.id)] = &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustParse(b.id), MaxTime: maxTime.Unix() * 1000},
+			Thanos:    metadata.Thanos{Labels: b.labels},
+		}
+	}
+	retentionByResolution := map[compact.ResolutionLevel]time.Duration{compact.ResolutionLevelRaw: 365 * 24 * time.Hour}
+
+	marked := func() []string {
+		var res []string
+		testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+			exists, err := bkt.Exists(ctx, filepath.Join(name, metadata.DeletionMarkFilename))
+			if exists {
+				res = append(res, name)
+			}
+			return err
+		}))
+		return res
+	}
+	ids := func(blocks []compact.ExpiredBlock) []string {
+		var res []string
+		for _, b := range blocks {
+			res = append(res, b.ID.String()+"/")
+		}
+		return res
+	}
+
+	// Blocks are only reported in dry run mode.
+	blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	expired, err := compact.ApplyRetentionPolicies(ctx, logger, bkt, metas, policies, retentionByResolution, true, blocksMarkedForDeletion)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"01CPHBEX20729MJQZXE3W0BW40/", "01CPHBEX20729MJQZXE3W0BW43/", "01CPHBEX20729MJQZXE3W0BW44/"}, ids(expired))
+	testutil.Equals(t, `{tenant="dev"}`, expired[1].Policy)
+	testutil.Equals(t, 30*24*time.Hour, expired[1].Retention)
+	testutil.Equals(t, "", expired[2].Policy)
+	testutil.Equals(t, 365*24*time.Hour, expired[2].Retention)
+	testutil.Equals(t, []string(nil), marked())
+
+	expired, err = compact.ApplyRetentionPolicies(ctx, logger, bkt, metas, policies, retentionByResolution, false, blocksMarkedForDeletion)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ids(expired), marked())
+	testutil.Equals(t, 3.0, promtest.ToFloat64(blocksMarkedForDeletion))
+}
+
+func TestParseRetentionPolicies(t *testing.T) {
+	for _, content := range []string{
+		`- retention: 30d`,
+		`- selector: '{tenant='
+  retention: 30d`,
+		`- selector: '{tenant="dev"}'
+  retention: -1d`,
+		`- selector: '{tenant="dev"}'
+  unknown: true`,
+	} {
+		_, err := compact.ParseRetentionPolicies([]byte(content))
+		testutil.NotOk(t, err, content)
+	}
+}
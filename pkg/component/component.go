@@ -117,6 +117,7 @@ var (
 	Compact         = source{component: component{name: "compact"}}
 	Downsample      = source{component: component{name: "downsample"}}
 	Replicate       = source{component: component{name: "replicate"}}
+	Replay          = source{component: component{name: "replay"}}
 	QueryFrontend   = source{component: component{name: "query-frontend"}}
 	Debug           = sourceStoreAPI{component: component{name: "debug"}}
 	Receive         = sourceStoreAPI{component: component{name: "receive"}}
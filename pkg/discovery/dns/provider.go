@@ -164,3 +164,11 @@ func (p *Provider) Addresses() []string {
 	}
 	return result
 }
+
+// AddressesOf returns the latest addresses the given address was resolved to.
+func (p *Provider) AddressesOf(addr string) []string {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.resolved[addr]
+}
@@ -50,6 +50,8 @@ func TestProvider(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(prv.resolverAddrs.WithLabelValues("any+a")))
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(prv.resolverAddrs.WithLabelValues("any+b")))
 	testutil.Equals(t, float64(1), promtestutil.ToFloat64(prv.resolverAddrs.WithLabelValues("any+c")))
+	testutil.Equals(t, ips[:2], prv.AddressesOf("any+a"))
+	testutil.Equals(t, []string(nil), prv.AddressesOf("any+d"))
 
 	err = prv.Resolve(ctx, []string{"any+b", "any+c"})
 	testutil.Ok(t, err)
@@ -6,10 +6,101 @@ package extannotations
 import (
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/util/annotations"
 )
 
+// Categories of the warnings returned along with API responses.
+const (
+	// CategoryPromQL is the category of the PromQL info and warning annotations.
+	CategoryPromQL = "promql"
+	// CategoryLimit is the category of the warnings about data truncated because of exceeded limits.
+	CategoryLimit = "limit"
+	// CategoryPartialResponse is the category of the warnings about stores which failed to return data.
+	CategoryPartialResponse = "partial_response"
+	// CategoryDeprecation is the category of the warnings about deprecated features.
+	CategoryDeprecation = "deprecation"
+	// CategoryOther is the category of all the other warnings.
+	CategoryOther = "other"
+)
+
+// partialResponseMarkers are the messages the proxy store and the querier wrap store errors with.
+var partialResponseMarkers = []string{
+	"receive series from",
+	"failed to receive any data",
+	"fetch series for",
+	"fetch label names from store",
+	"fetch label values from store",
+	"No StoreAPIs matched",
+}
+
 func IsPromQLAnnotation(s string) bool {
 	// We cannot use "errors.Is(w, annotations.PromQLInfo)" here because of gRPC so we use a string as argument
 	return strings.HasPrefix(s, annotations.PromQLInfo.Error()) || strings.HasPrefix(s, annotations.PromQLWarning.Error())
 }
+
+// Category returns the category of the given warning. As for IsPromQLAnnotation, warnings are matched
+// by their message since they lose their type when they cross gRPC.
+func Category(s string) string {
+	switch {
+	case IsPromQLAnnotation(s):
+		return CategoryPromQL
+	case strings.Contains(s, "ResourceExhausted") || (strings.Contains(s, "exceeded") && strings.Contains(s, "limit")):
+		// Limit errors are wrapped with the store they come from, so they have to be matched first.
+		return CategoryLimit
+	case strings.Contains(strings.ToLower(s), "deprecated"):
+		return CategoryDeprecation
+	}
+	for _, m := range partialResponseMarkers {
+		if strings.Contains(s, m) {
+			return CategoryPartialResponse
+		}
+	}
+	return CategoryOther
+}
+
+// Normalize collapses the whitespace of the given warning, so that the same warning formatted
+// by different components compares equal.
+func Normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Dedup returns the normalized warnings without duplicates, in the order they were first seen.
+// The same warning is often returned once per store, shard or split of a query.
+func Dedup(warnings []error) []error {
+	if len(warnings) == 0 {
+		return warnings
+	}
+	seen := make(map[string]struct{}, len(warnings))
+	res := make([]error, 0, len(warnings))
+	for _, w := range warnings {
+		s := Normalize(w.Error())
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		if s != w.Error() {
+			w = errors.New(s)
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+// DedupStrings is like Dedup for warnings already serialized to strings.
+func DedupStrings(warnings []string) []string {
+	if len(warnings) == 0 {
+		return warnings
+	}
+	seen := make(map[string]struct{}, len(warnings))
+	res := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		w = Normalize(w)
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		res = append(res, w)
+	}
+	return res
+}
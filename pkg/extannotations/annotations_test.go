@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package extannotations
+
+import (
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/util/annotations"
+)
+
+func TestCategory(t *testing.T) {
+	for _, tcase := range []struct {
+		warning  string
+		category string
+	}{
+		{warning: annotations.PromQLWarning.Error() + ": metric might not be a counter", category: CategoryPromQL},
+		{warning: annotations.PromQLInfo.Error() + ": metric might not be a counter", category: CategoryPromQL},
+		{warning: "receive series from Addr: 127.0.0.1:10901: rpc error: code = Unknown desc = exceeded series limit: limit 10 violated", category: CategoryLimit},
+		{warning: "rpc error: code = ResourceExhausted desc = too many chunks", category: CategoryLimit},
+		{warning: "receive series from Addr: 127.0.0.1:10901: rpc error: code = Unavailable desc = connection refused", category: CategoryPartialResponse},
+		{warning: "failed to receive any data in 5s from Addr: 127.0.0.1:10901: context canceled", category: CategoryPartialResponse},
+		{warning: "fetch label names from store Addr: 127.0.0.1:10901: EOF", category: CategoryPartialResponse},
+		{warning: "No StoreAPIs matched for this query", category: CategoryPartialResponse},
+		{warning: "the max_source_resolution parameter is deprecated", category: CategoryDeprecation},
+		{warning: "something else", category: CategoryOther},
+	} {
+		t.Run(tcase.warning, func(t *testing.T) {
+			testutil.Equals(t, tcase.category, Category(tcase.warning))
+		})
+	}
+}
+
+func TestDedup(t *testing.T) {
+	testutil.Equals(t, []error(nil), Dedup(nil))
+
+	warnings := Dedup([]error{
+		errors.New("receive series from a: EOF"),
+		errors.New("receive series from b: EOF"),
+		errors.New(" receive series from a:\tEOF\n"),
+		errors.New("receive series from a: EOF"),
+	})
+	testutil.Equals(t, 2, len(warnings))
+	testutil.Equals(t, "receive series from a: EOF", warnings[0].Error())
+	testutil.Equals(t, "receive series from b: EOF", warnings[1].Error())
+
+	// Single warnings are normalized too.
+	warnings = Dedup([]error{errors.New(" receive series from a:\tEOF\n")})
+	testutil.Equals(t, 1, len(warnings))
+	testutil.Equals(t, "receive series from a: EOF", warnings[0].Error())
+
+	testutil.Equals(t, []string{"a b", "c"}, DedupStrings([]string{"a b", "c", "a  b", "c"}))
+	testutil.Equals(t, []string{"a b"}, DedupStrings([]string{" a  b"}))
+	testutil.Equals(t, []string(nil), DedupStrings(nil))
+}
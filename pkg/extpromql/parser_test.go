@@ -59,6 +59,12 @@ func TestParseMetricSelector(t *testing.T) {
 			}
 
 			testutil.Equals(t, stringFmt(want), stringFmt(got))
+			// Regex matchers must keep their compiled regexp to match values.
+			for i := range want {
+				for _, v := range []string{"", "GET", "200", "500"} {
+					testutil.Equals(t, want[i].Matches(v), got[i].Matches(v), "matcher %v of value %q", got[i], v)
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,157 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package gate
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// adaptiveBackoff is the ratio the concurrency limit is multiplied by when the backend is overloaded.
+const adaptiveBackoff = 0.5
+
+// Adaptive limits the number of concurrent requests to a backend, adapting the limit with additive increase and
+// multiplicative decrease (AIMD): the limit is increased by 1 every limit requests which did not find the backend
+// overloaded, and multiplied by adaptiveBackoff on requests which did, e.g. because they failed or were slow.
+// Requests over the limit wait for in-flight ones to complete.
+//
+// The limit is decreased at most once per round of requests: only requests sent after the last decrease can decrease
+// it again, so that the requests in flight when the backend got overloaded don't collapse the limit.
+type Adaptive struct {
+	minConcurrency, maxConcurrency int
+
+	mtx      sync.Mutex
+	limit    float64
+	inflight int
+	waiting  list.List
+	// epoch is incremented every time requests sent in the current epoch find the backend overloaded.
+	epoch uint64
+
+	limitGauge    prometheus.Gauge
+	inflightGauge prometheus.Gauge
+	waitingGauge  prometheus.Gauge
+	decreases     prometheus.Counter
+}
+
+// NewAdaptive returns a new Adaptive limit between minConcurrency and maxConcurrency, starting with maxConcurrency.
+// Its metrics are prefixed with namePrefix, and describe the limited requests, e.g. "downstream requests".
+func NewAdaptive(reg prometheus.Registerer, namePrefix, requests string, minConcurrency, maxConcurrency int) *Adaptive {
+	l := &Adaptive{
+		minConcurrency: minConcurrency,
+		maxConcurrency: maxConcurrency,
+		limit:          float64(maxConcurrency),
+		limitGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: namePrefix + "_concurrency_limit",
+			Help: "The current limit of concurrent " + requests + ".",
+		}),
+		inflightGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: namePrefix + "_inflight_requests",
+			Help: "The number of " + requests + " in flight.",
+		}),
+		waitingGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: namePrefix + "_waiting_requests",
+			Help: "The number of " + requests + " waiting for the concurrency limit.",
+		}),
+		decreases: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: namePrefix + "_concurrency_limit_decreases_total",
+			Help: "The total number of decreases of the concurrency limit of " + requests + ", because they found their backend overloaded.",
+		}),
+	}
+	l.limitGauge.Set(l.limit)
+	return l
+}
+
+// Start waits for a request to be allowed by the concurrency limit. Once the request completes, done must be called
+// with whether its outcome tells that the backend is overloaded.
+func (l *Adaptive) Start(ctx context.Context) (done func(overloaded bool), err error) {
+	epoch, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(overloaded bool) { l.release(epoch, overloaded) }, nil
+}
+
+// acquire waits for a request to be allowed by the concurrency limit, and returns the epoch it is sent in.
+func (l *Adaptive) acquire(ctx context.Context) (uint64, error) {
+	l.mtx.Lock()
+	if l.waiting.Len() == 0 && l.inflight < l.allowed() {
+		l.inflight++
+		l.updateGauges()
+		epoch := l.epoch
+		l.mtx.Unlock()
+		return epoch, nil
+	}
+	ch := make(chan uint64, 1)
+	e := l.waiting.PushBack(ch)
+	l.updateGauges()
+	l.mtx.Unlock()
+
+	select {
+	case epoch := <-ch:
+		return epoch, nil
+	case <-ctx.Done():
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		select {
+		case <-ch:
+			// The request was allowed concurrently, give its slot to the next one.
+			l.inflight--
+			l.wakeWaiting()
+		default:
+			l.waiting.Remove(e)
+		}
+		l.updateGauges()
+		return 0, ctx.Err()
+	}
+}
+
+// release records the outcome of a request sent in the given epoch, adapts the limit, and allows waiting requests.
+func (l *Adaptive) release(epoch uint64, overloaded bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.inflight--
+	switch {
+	case overloaded && epoch == l.epoch:
+		l.epoch++
+		if l.limit > float64(l.minConcurrency) {
+			l.limit = math.Max(float64(l.minConcurrency), l.limit*adaptiveBackoff)
+			l.decreases.Inc()
+		}
+	case !overloaded:
+		l.limit = math.Min(float64(l.maxConcurrency), l.limit+1/l.limit)
+	}
+	l.limitGauge.Set(l.limit)
+	l.wakeWaiting()
+	l.updateGauges()
+}
+
+// Limit returns the current concurrency limit.
+func (l *Adaptive) Limit() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.allowed()
+}
+
+func (l *Adaptive) allowed() int {
+	return int(l.limit)
+}
+
+func (l *Adaptive) wakeWaiting() {
+	for l.waiting.Len() > 0 && l.inflight < l.allowed() {
+		ch := l.waiting.Remove(l.waiting.Front()).(chan uint64)
+		l.inflight++
+		ch <- l.epoch
+	}
+}
+
+func (l *Adaptive) updateGauges() {
+	l.inflightGauge.Set(float64(l.inflight))
+	l.waitingGauge.Set(float64(l.waiting.Len()))
+}
@@ -0,0 +1,92 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+func TestAdaptive(t *testing.T) {
+	l := NewAdaptive(prometheus.NewRegistry(), "test", "test requests", 2, 8)
+	testutil.Equals(t, 8, l.Limit())
+
+	ctx := context.Background()
+
+	// Requests in flight when the backend gets overloaded decrease the limit once.
+	var dones []func(bool)
+	for i := 0; i < 4; i++ {
+		done, err := l.Start(ctx)
+		testutil.Ok(t, err)
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		done(true)
+	}
+	testutil.Equals(t, 4, l.Limit())
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.decreases))
+
+	// Requests sent after the decrease decrease it again, down to the minimum.
+	for i := 0; i < 3; i++ {
+		done, err := l.Start(ctx)
+		testutil.Ok(t, err)
+		done(true)
+	}
+	testutil.Equals(t, 2, l.Limit())
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(l.decreases))
+
+	// Successful requests increase the limit by about one every limit requests, up to the maximum.
+	for i := 0; i < 3; i++ {
+		done, err := l.Start(ctx)
+		testutil.Ok(t, err)
+		done(false)
+	}
+	testutil.Equals(t, 3, l.Limit())
+	for i := 0; i < 100; i++ {
+		done, err := l.Start(ctx)
+		testutil.Ok(t, err)
+		done(false)
+	}
+	testutil.Equals(t, 8, l.Limit())
+	testutil.Equals(t, 8.0, promtestutil.ToFloat64(l.limitGauge))
+}
+
+func TestAdaptiveWaiting(t *testing.T) {
+	l := NewAdaptive(prometheus.NewRegistry(), "test", "test requests", 1, 1)
+
+	done, err := l.Start(context.Background())
+	testutil.Ok(t, err)
+
+	// Requests over the limit wait until they are canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Start(ctx)
+	testutil.Equals(t, context.DeadlineExceeded, err)
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(l.waitingGauge))
+
+	// Or until a request in flight completes.
+	acquired := make(chan error)
+	go func() {
+		_, err := l.Start(context.Background())
+		acquired <- err
+	}()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, nil, func() error {
+		if promtestutil.ToFloat64(l.waitingGauge) != 1 {
+			return errors.New("expected a waiting request")
+		}
+		return nil
+	}))
+	done(false)
+	testutil.Ok(t, <-acquired)
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.inflightGauge))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(l.waitingGauge))
+}
@@ -124,6 +124,9 @@ type StoreInfo struct {
 	SupportsWithoutReplicaLabels bool `protobuf:"varint,5,opt,name=supports_without_replica_labels,json=supportsWithoutReplicaLabels,proto3" json:"supports_without_replica_labels,omitempty"`
 	// TSDBInfos holds metadata for all TSDBs exposed by the store.
 	TsdbInfos []TSDBInfo `protobuf:"bytes,6,rep,name=tsdb_infos,json=tsdbInfos,proto3" json:"tsdb_infos"`
+	// supports_time_filtering means the series chunks returned by this store only hold samples within the
+	// min_time and max_time of StoreAPI.Series.
+	SupportsTimeFiltering bool `protobuf:"varint,7,opt,name=supports_time_filtering,json=supportsTimeFiltering,proto3" json:"supports_time_filtering,omitempty"`
 }
 
 func (m *StoreInfo) Reset()         { *m = StoreInfo{} }
@@ -350,6 +353,8 @@ type TSDBInfo struct {
 	Labels  labelpb.ZLabelSet `protobuf:"bytes,1,opt,name=labels,proto3" json:"labels"`
 	MinTime int64             `protobuf:"varint,2,opt,name=min_time,json=minTime,proto3" json:"min_time,omitempty"`
 	MaxTime int64             `protobuf:"varint,3,opt,name=max_time,json=maxTime,proto3" json:"max_time,omitempty"`
+	// head_series is the number of series in the head of the TSDB, if it has one.
+	HeadSeries uint64 `protobuf:"varint,4,opt,name=head_series,json=headSeries,proto3" json:"head_series,omitempty"`
 }
 
 func (m *TSDBInfo) Reset()         { *m = TSDBInfo{} }
@@ -400,44 +405,47 @@ func init() {
 func init() { proto.RegisterFile("info/infopb/rpc.proto", fileDescriptor_a1214ec45d2bf952) }
 
 var fileDescriptor_a1214ec45d2bf952 = []byte{
-	// 589 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x94, 0xdf, 0x8a, 0xda, 0x40,
-	0x14, 0xc6, 0x8d, 0x7f, 0xe3, 0x71, 0xdd, 0xee, 0x0e, 0xbb, 0x25, 0x4a, 0x89, 0x12, 0xf6, 0x42,
-	0x68, 0x31, 0x60, 0xa1, 0x94, 0xf6, 0xaa, 0x6e, 0x85, 0x6e, 0xe9, 0x42, 0x1b, 0x85, 0xc2, 0xde,
-	0x84, 0xa8, 0xb3, 0x1a, 0x48, 0x32, 0x63, 0x66, 0xa4, 0xfa, 0x16, 0x7d, 0x95, 0xbe, 0x85, 0x97,
-	0x7b, 0xd9, 0xab, 0xd2, 0xea, 0x43, 0xf4, 0xb6, 0xcc, 0x4c, 0x62, 0x0d, 0xdd, 0xbd, 0xe9, 0x8d,
-	0x66, 0xe6, 0xfb, 0x9d, 0xc9, 0x39, 0xdf, 0x39, 0x13, 0x38, 0xf7, 0xa3, 0x5b, 0x62, 0x8b, 0x1f,
-	0x3a, 0xb6, 0x63, 0x3a, 0xe9, 0xd2, 0x98, 0x70, 0x82, 0x6a, 0x7c, 0xee, 0x45, 0x84, 0x75, 0x85,
-	0xd0, 0x6c, 0x30, 0x4e, 0x62, 0x6c, 0x07, 0xde, 0x18, 0x07, 0x74, 0x6c, 0xf3, 0x35, 0xc5, 0x4c,
-	0x71, 0xcd, 0xb3, 0x19, 0x99, 0x11, 0xf9, 0x68, 0x8b, 0x27, 0xb5, 0x6b, 0xd5, 0xa1, 0x76, 0x15,
-	0xdd, 0x12, 0x07, 0x2f, 0x96, 0x98, 0x71, 0xeb, 0x5b, 0x01, 0x8e, 0xd4, 0x9a, 0x51, 0x12, 0x31,
-	0x8c, 0x5e, 0x00, 0xc8, 0xc3, 0x5c, 0x86, 0x39, 0x33, 0xb4, 0x76, 0xa1, 0x53, 0xeb, 0x9d, 0x76,
-	0x93, 0x57, 0xde, 0x7c, 0x10, 0xd2, 0x10, 0xf3, 0x7e, 0x71, 0xf3, 0xa3, 0x95, 0x73, 0xaa, 0x41,
-	0xb2, 0x66, 0xe8, 0x02, 0xea, 0x97, 0x24, 0xa4, 0x24, 0xc2, 0x11, 0x1f, 0xad, 0x29, 0x36, 0xf2,
-	0x6d, 0xad, 0x53, 0x75, 0xb2, 0x9b, 0xe8, 0x19, 0x94, 0x64, 0xc2, 0x46, 0xa1, 0xad, 0x75, 0x6a,
-	0xbd, 0xc7, 0xdd, 0x83, 0x5a, 0xba, 0x43, 0xa1, 0xc8, 0x64, 0x14, 0x24, 0xe8, 0x78, 0x19, 0x60,
-	0x66, 0x14, 0xef, 0xa1, 0x1d, 0xa1, 0x28, 0x5a, 0x42, 0xe8, 0x1d, 0x3c, 0x0a, 0x31, 0x8f, 0xfd,
-	0x89, 0x1b, 0x62, 0xee, 0x4d, 0x3d, 0xee, 0x19, 0x25, 0x19, 0xd7, 0xca, 0xc4, 0x5d, 0x4b, 0xe6,
-	0x3a, 0x41, 0xe4, 0x01, 0xc7, 0x61, 0x66, 0x0f, 0xf5, 0xa0, 0xc2, 0xbd, 0x78, 0x26, 0x0c, 0x28,
-	0xcb, 0x13, 0x8c, 0xcc, 0x09, 0x23, 0xa5, 0xc9, 0xd0, 0x14, 0x44, 0x2f, 0xa1, 0x8a, 0x57, 0x38,
-	0xa4, 0x81, 0x17, 0x33, 0xa3, 0x22, 0xa3, 0x9a, 0x99, 0xa8, 0x41, 0xaa, 0xca, 0xb8, 0xbf, 0x30,
-	0xb2, 0xa1, 0xb4, 0x58, 0xe2, 0x78, 0x6d, 0xe8, 0x32, 0xaa, 0x91, 0x89, 0xfa, 0x24, 0x94, 0x37,
-	0x1f, 0xaf, 0x54, 0xa1, 0x92, 0xb3, 0x7e, 0x6b, 0x50, 0xdd, 0x7b, 0x85, 0x1a, 0xa0, 0x87, 0x7e,
-	0xe4, 0x72, 0x3f, 0xc4, 0x86, 0xd6, 0xd6, 0x3a, 0x05, 0xa7, 0x12, 0xfa, 0xd1, 0xc8, 0x0f, 0xb1,
-	0x94, 0xbc, 0x95, 0x92, 0xf2, 0x89, 0xe4, 0xad, 0xa4, 0xf4, 0x14, 0x4e, 0xd9, 0x92, 0x52, 0x12,
-	0x73, 0xe6, 0xb2, 0xb9, 0x17, 0x4f, 0xfd, 0x68, 0x26, 0x9b, 0xa2, 0x3b, 0x27, 0xa9, 0x30, 0x4c,
-	0xf6, 0xd1, 0x00, 0x5a, 0x7b, 0xf8, 0x8b, 0xcf, 0xe7, 0x64, 0xc9, 0xdd, 0x18, 0xd3, 0xc0, 0x9f,
-	0x78, 0xae, 0x9c, 0x00, 0x26, 0x9d, 0xd6, 0x9d, 0x27, 0x29, 0xf6, 0x59, 0x51, 0x8e, 0x82, 0xe4,
-	0xd4, 0x30, 0xf4, 0x0a, 0x80, 0xb3, 0xe9, 0xd8, 0x15, 0x85, 0x09, 0x67, 0xc5, 0x68, 0x9d, 0x67,
-	0x9d, 0x1d, 0xbe, 0xed, 0x8b, 0xa2, 0xd2, 0xf1, 0x12, 0xb8, 0x58, 0xb3, 0xf7, 0x45, 0xbd, 0x78,
-	0x52, 0xb2, 0x6a, 0x50, 0xdd, 0xb7, 0xdd, 0x3a, 0x03, 0xf4, 0x6f, 0x2f, 0xc5, 0x7c, 0x1f, 0xf4,
-	0xc7, 0x1a, 0x40, 0x3d, 0x63, 0xfc, 0xff, 0xd9, 0x65, 0x1d, 0xc3, 0xd1, 0x61, 0x27, 0xac, 0x05,
-	0xe8, 0x69, 0xae, 0xc8, 0x86, 0x72, 0x62, 0x82, 0x26, 0x1b, 0xf8, 0xe0, 0x6d, 0x49, 0xb0, 0x4c,
-	0x0a, 0xf9, 0x87, 0x53, 0x28, 0x64, 0x52, 0xe8, 0x5d, 0x42, 0x51, 0xbe, 0xee, 0x75, 0xf2, 0x9f,
-	0x9d, 0xc9, 0x83, 0x3b, 0xdd, 0x6c, 0xdc, 0xa3, 0xa8, 0xdb, 0xdd, 0xbf, 0xd8, 0xfc, 0x32, 0x73,
-	0x9b, 0xad, 0xa9, 0xdd, 0x6d, 0x4d, 0xed, 0xe7, 0xd6, 0xd4, 0xbe, 0xee, 0xcc, 0xdc, 0xdd, 0xce,
-	0xcc, 0x7d, 0xdf, 0x99, 0xb9, 0x9b, 0xb2, 0xfa, 0xd6, 0x8c, 0xcb, 0xf2, 0x53, 0xf1, 0xfc, 0x4f,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0xf1, 0x5f, 0x0a, 0x2f, 0x81, 0x04, 0x00, 0x00,
+	// 628 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x94, 0xdd, 0x6a, 0x13, 0x41,
+	0x14, 0xc7, 0xb3, 0xf9, 0xce, 0xd9, 0xb6, 0xb6, 0x43, 0xab, 0x9b, 0x20, 0x9b, 0xb0, 0xf4, 0x22,
+	0xa0, 0x64, 0x21, 0x42, 0x11, 0xbd, 0xb2, 0xb5, 0x62, 0xc5, 0x82, 0x6e, 0x0a, 0x42, 0x6f, 0x96,
+	0x4d, 0x33, 0x4d, 0x16, 0x76, 0x77, 0xb6, 0x33, 0x13, 0x6c, 0xdf, 0x42, 0x7c, 0x11, 0xf1, 0x2d,
+	0x7a, 0xd9, 0x4b, 0xaf, 0x44, 0x9b, 0x17, 0x91, 0x39, 0xb3, 0x1b, 0xb3, 0x58, 0xbd, 0xf0, 0x26,
+	0xd9, 0x39, 0xff, 0xdf, 0x99, 0x39, 0x5f, 0x33, 0xb0, 0x13, 0x26, 0xe7, 0xcc, 0x55, 0x3f, 0xe9,
+	0xd8, 0xe5, 0xe9, 0xd9, 0x20, 0xe5, 0x4c, 0x32, 0x62, 0xca, 0x59, 0x90, 0x30, 0x31, 0x50, 0x42,
+	0xa7, 0x2d, 0x24, 0xe3, 0xd4, 0x8d, 0x82, 0x31, 0x8d, 0xd2, 0xb1, 0x2b, 0xaf, 0x52, 0x2a, 0x34,
+	0xd7, 0xd9, 0x9e, 0xb2, 0x29, 0xc3, 0x4f, 0x57, 0x7d, 0x69, 0xab, 0xb3, 0x0e, 0xe6, 0x51, 0x72,
+	0xce, 0x3c, 0x7a, 0x31, 0xa7, 0x42, 0x3a, 0x5f, 0x2b, 0xb0, 0xa6, 0xd7, 0x22, 0x65, 0x89, 0xa0,
+	0x64, 0x0f, 0x00, 0x37, 0xf3, 0x05, 0x95, 0xc2, 0x32, 0x7a, 0x95, 0xbe, 0x39, 0xdc, 0x1a, 0x64,
+	0x47, 0x9e, 0xbe, 0x55, 0xd2, 0x88, 0xca, 0xfd, 0xea, 0xf5, 0xf7, 0x6e, 0xc9, 0x6b, 0x45, 0xd9,
+	0x5a, 0x90, 0x5d, 0x58, 0x3f, 0x60, 0x71, 0xca, 0x12, 0x9a, 0xc8, 0x93, 0xab, 0x94, 0x5a, 0xe5,
+	0x9e, 0xd1, 0x6f, 0x79, 0x45, 0x23, 0x79, 0x0c, 0x35, 0x0c, 0xd8, 0xaa, 0xf4, 0x8c, 0xbe, 0x39,
+	0xbc, 0x3f, 0x58, 0xc9, 0x65, 0x30, 0x52, 0x0a, 0x06, 0xa3, 0x21, 0x45, 0xf3, 0x79, 0x44, 0x85,
+	0x55, 0xbd, 0x83, 0xf6, 0x94, 0xa2, 0x69, 0x84, 0xc8, 0x6b, 0xb8, 0x17, 0x53, 0xc9, 0xc3, 0x33,
+	0x3f, 0xa6, 0x32, 0x98, 0x04, 0x32, 0xb0, 0x6a, 0xe8, 0xd7, 0x2d, 0xf8, 0x1d, 0x23, 0x73, 0x9c,
+	0x21, 0xb8, 0xc1, 0x46, 0x5c, 0xb0, 0x91, 0x21, 0x34, 0x64, 0xc0, 0xa7, 0xaa, 0x00, 0x75, 0xdc,
+	0xc1, 0x2a, 0xec, 0x70, 0xa2, 0x35, 0x74, 0xcd, 0x41, 0xf2, 0x14, 0x5a, 0xf4, 0x92, 0xc6, 0x69,
+	0x14, 0x70, 0x61, 0x35, 0xd0, 0xab, 0x53, 0xf0, 0x3a, 0xcc, 0x55, 0xf4, 0xfb, 0x0d, 0x13, 0x17,
+	0x6a, 0x17, 0x73, 0xca, 0xaf, 0xac, 0x26, 0x7a, 0xb5, 0x0b, 0x5e, 0xef, 0x95, 0xf2, 0xe2, 0xdd,
+	0x91, 0x4e, 0x14, 0x39, 0xe7, 0x4b, 0x19, 0x5a, 0xcb, 0x5a, 0x91, 0x36, 0x34, 0xe3, 0x30, 0xf1,
+	0x65, 0x18, 0x53, 0xcb, 0xe8, 0x19, 0xfd, 0x8a, 0xd7, 0x88, 0xc3, 0xe4, 0x24, 0x8c, 0x29, 0x4a,
+	0xc1, 0xa5, 0x96, 0xca, 0x99, 0x14, 0x5c, 0xa2, 0xf4, 0x08, 0xb6, 0xc4, 0x3c, 0x4d, 0x19, 0x97,
+	0xc2, 0x17, 0xb3, 0x80, 0x4f, 0xc2, 0x64, 0x8a, 0x4d, 0x69, 0x7a, 0x9b, 0xb9, 0x30, 0xca, 0xec,
+	0xe4, 0x10, 0xba, 0x4b, 0xf8, 0x63, 0x28, 0x67, 0x6c, 0x2e, 0x7d, 0x4e, 0xd3, 0x28, 0x3c, 0x0b,
+	0x7c, 0x9c, 0x00, 0x81, 0x95, 0x6e, 0x7a, 0x0f, 0x73, 0xec, 0x83, 0xa6, 0x3c, 0x0d, 0xe1, 0xd4,
+	0x08, 0xf2, 0x0c, 0x40, 0x8a, 0xc9, 0xd8, 0x57, 0x89, 0xa9, 0xca, 0xaa, 0xd1, 0xda, 0x29, 0x56,
+	0x76, 0xf4, 0x72, 0x5f, 0x25, 0x95, 0x8f, 0x97, 0xc2, 0xd5, 0x5a, 0x90, 0x3d, 0x78, 0xb0, 0x0c,
+	0x41, 0xe5, 0xe3, 0x9f, 0x87, 0x91, 0xa4, 0x5c, 0x45, 0xdd, 0xc0, 0xa3, 0x77, 0x72, 0x59, 0xa5,
+	0xf7, 0x2a, 0x17, 0xdf, 0x54, 0x9b, 0xd5, 0xcd, 0x9a, 0x63, 0x42, 0x6b, 0x39, 0x2e, 0xce, 0x36,
+	0x90, 0x3f, 0x67, 0x40, 0xdd, 0x8b, 0x95, 0xbe, 0x3a, 0x87, 0xb0, 0x5e, 0x68, 0xd8, 0xff, 0x95,
+	0xd9, 0xd9, 0x80, 0xb5, 0xd5, 0x0e, 0x3a, 0x9f, 0x0d, 0x68, 0xe6, 0x49, 0x12, 0x17, 0xea, 0x59,
+	0xf5, 0x8c, 0x9e, 0xf1, 0xaf, 0x6b, 0x96, 0x61, 0x85, 0x18, 0xca, 0x7f, 0x8f, 0xa1, 0x52, 0x6c,
+	0x75, 0x17, 0xcc, 0x19, 0x0d, 0x26, 0xbe, 0xa0, 0x3c, 0xcc, 0xee, 0x52, 0xd5, 0x03, 0x65, 0x1a,
+	0xa1, 0x65, 0x78, 0x00, 0x55, 0x8c, 0xe7, 0x79, 0xf6, 0x5f, 0x9c, 0xf6, 0x95, 0xd7, 0xa2, 0xd3,
+	0xbe, 0x43, 0xd1, 0xef, 0xc6, 0xfe, 0xee, 0xf5, 0x4f, 0xbb, 0x74, 0x7d, 0x6b, 0x1b, 0x37, 0xb7,
+	0xb6, 0xf1, 0xe3, 0xd6, 0x36, 0x3e, 0x2d, 0xec, 0xd2, 0xcd, 0xc2, 0x2e, 0x7d, 0x5b, 0xd8, 0xa5,
+	0xd3, 0xba, 0x7e, 0xc5, 0xc6, 0x75, 0x7c, 0x84, 0x9e, 0xfc, 0x1a, 0x00, 0x66, 0x78, 0x79, 0x72,
+	0xdb, 0x04, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -681,6 +689,16 @@ func (m *StoreInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SupportsTimeFiltering {
+		i--
+		if m.SupportsTimeFiltering {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x38
+	}
 	if len(m.TsdbInfos) > 0 {
 		for iNdEx := len(m.TsdbInfos) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -873,6 +891,11 @@ func (m *TSDBInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.HeadSeries != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.HeadSeries))
+		i--
+		dAtA[i] = 0x20
+	}
 	if m.MaxTime != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.MaxTime))
 		i--
@@ -983,6 +1006,9 @@ func (m *StoreInfo) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.SupportsTimeFiltering {
+		n += 2
+	}
 	return n
 }
 
@@ -1051,6 +1077,9 @@ func (m *TSDBInfo) Size() (n int) {
 	if m.MaxTime != 0 {
 		n += 1 + sovRpc(uint64(m.MaxTime))
 	}
+	if m.HeadSeries != 0 {
+		n += 1 + sovRpc(uint64(m.HeadSeries))
+	}
 	return n
 }
 
@@ -1583,6 +1612,26 @@ func (m *StoreInfo) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsTimeFiltering", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsTimeFiltering = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -1992,6 +2041,25 @@ func (m *TSDBInfo) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HeadSeries", wireType)
+			}
+			m.HeadSeries = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.HeadSeries |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
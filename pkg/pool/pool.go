@@ -4,9 +4,14 @@
 package pool
 
 import (
+	"math/bits"
+	"slices"
+	"strconv"
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 // Bytes is a pool of bytes that can be reused.
@@ -37,9 +42,28 @@ type BucketedBytes struct {
 	usedTotal uint64
 	mtx       sync.RWMutex
 
+	// minSize and maxSize bound the sizes of the buckets, increasing by factor.
+	minSize, maxSize int
+	factor           float64
+	// requested counts the requested sizes by their next power of two exponent since the buckets were last adapted,
+	// if adaptive sizing is enabled.
+	requested []uint64
+	metrics   *bucketedBytesMetrics
+
 	new func(s int) *[]byte
 }
 
+type bucketedBytesMetrics struct {
+	requests      *prometheus.CounterVec
+	misses        *prometheus.CounterVec
+	exhausted     prometheus.Counter
+	minBucketSize prometheus.Gauge
+	maxBucketSize prometheus.Gauge
+}
+
+// oversizedBucket is the bucket label of the requests larger than the largest bucket, which are not pooled.
+const oversizedBucket = "oversized"
+
 // MustNewBucketedBytes is like NewBucketedBytes but panics if construction fails.
 // Useful for package internal pools.
 func MustNewBucketedBytes(minSize, maxSize int, factor float64, maxTotal uint64) *BucketedBytes {
@@ -60,19 +84,18 @@ func NewBucketedBytes(minSize, maxSize int, factor float64, maxTotal uint64) (*B
 	if maxSize < 1 {
 		return nil, errors.New("invalid maximum pool size")
 	}
-	if factor < 1 {
+	if factor <= 1 {
 		return nil, errors.New("invalid factor")
 	}
 
-	var sizes []int
-
-	for s := minSize; s <= maxSize; s = int(float64(s) * factor) {
-		sizes = append(sizes, s)
-	}
+	sizes := bucketSizes(minSize, maxSize, factor)
 	p := &BucketedBytes{
 		buckets:  make([]sync.Pool, len(sizes)),
 		sizes:    sizes,
 		maxTotal: maxTotal,
+		minSize:  minSize,
+		maxSize:  maxSize,
+		factor:   factor,
 		new: func(sz int) *[]byte {
 			s := make([]byte, 0, sz)
 			return &s
@@ -81,6 +104,117 @@ func NewBucketedBytes(minSize, maxSize int, factor float64, maxTotal uint64) (*B
 	return p, nil
 }
 
+func bucketSizes(minSize, maxSize int, factor float64) []int {
+	var sizes []int
+	for s := minSize; s <= maxSize; s = max(int(float64(s)*factor), s+1) {
+		sizes = append(sizes, s)
+	}
+	return sizes
+}
+
+// WithMetrics registers the metrics of the utilization of the pool with the given registerer, and returns the pool.
+func (p *BucketedBytes) WithMetrics(reg prometheus.Registerer) *BucketedBytes {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.metrics = &bucketedBytesMetrics{
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "pool_requests_total",
+			Help: "Total number of byte slices requested from the pool, by size of the bucket they were taken from.",
+		}, []string{"bucket"}),
+		misses: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "pool_misses_total",
+			Help: "Total number of byte slices requested from the pool which were allocated, as their bucket was empty or they did not fit any bucket.",
+		}, []string{"bucket"}),
+		exhausted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "pool_exhausted_requests_total",
+			Help: "Total number of byte slices requested from the pool which failed because the maximum number of used bytes would have been exceeded.",
+		}),
+		minBucketSize: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "pool_min_bucket_size_bytes",
+			Help: "Size of the smallest bucket of the pool.",
+		}),
+		maxBucketSize: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "pool_max_bucket_size_bytes",
+			Help: "Size of the largest bucket of the pool.",
+		}),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pool_used_bytes",
+		Help: "Number of bytes of the byte slices taken from the pool and not returned yet.",
+	}, func() float64 { return float64(p.UsedBytes()) })
+	promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "pool_max_bytes",
+		Help: "Maximum number of bytes of the byte slices taken from the pool at a given time, 0 if unlimited.",
+	}).Set(float64(p.maxTotal))
+	p.updateBucketMetrics()
+	return p
+}
+
+// WithAdaptiveSizing makes Adapt resize the buckets to the sizes requested from the pool, within the minimum and
+// maximum sizes of the pool, and returns the pool.
+func (p *BucketedBytes) WithAdaptiveSizing() *BucketedBytes {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.requested = make([]uint64, bits.UintSize+1)
+	return p
+}
+
+// minAdaptiveRequests is the minimum number of requests the buckets are adapted to.
+const minAdaptiveRequests = 100
+
+// Adapt resizes the buckets to the sizes requested since the last call, if adaptive sizing is enabled: the smallest
+// bucket fits the 10th percentile of the requested sizes, and the largest one their 99th percentile, both rounded up
+// to a power of two, so that small requests don't take slices much larger than them, and most of the large ones are
+// pooled. The byte slices held by the previous buckets are released. It is meant to be called periodically.
+func (p *BucketedBytes) Adapt() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.requested == nil {
+		return
+	}
+	var total uint64
+	for _, n := range p.requested {
+		total += n
+	}
+	if total < minAdaptiveRequests {
+		return
+	}
+
+	percentile := func(q float64) int {
+		var cum uint64
+		for exp, n := range p.requested {
+			cum += n
+			if float64(cum) >= q*float64(total) {
+				return 1 << exp
+			}
+		}
+		return p.maxSize
+	}
+	minSize := max(p.minSize, min(percentile(0.1), p.maxSize))
+	maxSize := min(p.maxSize, max(percentile(0.99), minSize))
+	clear(p.requested)
+
+	sizes := bucketSizes(minSize, maxSize, p.factor)
+	if slices.Equal(sizes, p.sizes) {
+		return
+	}
+	p.sizes = sizes
+	p.buckets = make([]sync.Pool, len(sizes))
+	p.updateBucketMetrics()
+}
+
+// updateBucketMetrics updates the metrics of the sizes of the buckets. The mutex must be held.
+func (p *BucketedBytes) updateBucketMetrics() {
+	if p.metrics == nil || len(p.sizes) == 0 {
+		return
+	}
+	p.metrics.minBucketSize.Set(float64(p.sizes[0]))
+	p.metrics.maxBucketSize.Set(float64(p.sizes[len(p.sizes)-1]))
+}
+
 // ErrPoolExhausted is returned if a pool cannot provide the request bytes.
 var ErrPoolExhausted = errors.New("pool exhausted")
 
@@ -90,8 +224,14 @@ func (p *BucketedBytes) Get(sz int) (*[]byte, error) {
 	defer p.mtx.Unlock()
 
 	if p.maxTotal > 0 && p.usedTotal+uint64(sz) > p.maxTotal {
+		if p.metrics != nil {
+			p.metrics.exhausted.Inc()
+		}
 		return nil, ErrPoolExhausted
 	}
+	if p.requested != nil && sz > 0 {
+		p.requested[bits.Len(uint(sz-1))]++
+	}
 
 	for i, bktSize := range p.sizes {
 		if sz > bktSize {
@@ -101,12 +241,23 @@ func (p *BucketedBytes) Get(sz int) (*[]byte, error) {
 		if !ok {
 			b = p.new(bktSize)
 		}
+		if p.metrics != nil {
+			bucket := strconv.Itoa(bktSize)
+			p.metrics.requests.WithLabelValues(bucket).Inc()
+			if !ok {
+				p.metrics.misses.WithLabelValues(bucket).Inc()
+			}
+		}
 
 		p.usedTotal += uint64(cap(*b))
 		return b, nil
 	}
 
 	// The requested size exceeds that of our highest bucket, allocate it directly.
+	if p.metrics != nil {
+		p.metrics.requests.WithLabelValues(oversizedBucket).Inc()
+		p.metrics.misses.WithLabelValues(oversizedBucket).Inc()
+	}
 	p.usedTotal += uint64(sz)
 	return p.new(sz), nil
 }
@@ -117,18 +268,23 @@ func (p *BucketedBytes) Put(b *[]byte) {
 		return
 	}
 
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	// The buckets may be adapted, so they are only read with the mutex held. Byte slices are returned to the largest
+	// bucket they fit, so that those taken from a bucket are never smaller than its size, even once the buckets were
+	// adapted.
 	sz := cap(*b)
-	for i, bktSize := range p.sizes {
-		if sz > bktSize {
-			continue
+	if len(p.sizes) > 0 && sz <= p.sizes[len(p.sizes)-1] {
+		for i := len(p.sizes) - 1; i >= 0; i-- {
+			if sz < p.sizes[i] {
+				continue
+			}
+			*b = (*b)[:0]
+			p.buckets[i].Put(b)
+			break
 		}
-		*b = (*b)[:0]
-		p.buckets[i].Put(b)
-		break
 	}
-
-	p.mtx.Lock()
-	defer p.mtx.Unlock()
 	// We could assume here that our users will not make the slices larger
 	// but lets be on the safe side to avoid an underflow of p.usedTotal.
 	if uint64(sz) >= p.usedTotal {
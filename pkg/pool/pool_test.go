@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/goleak"
 
 	"github.com/efficientgo/core/testutil"
@@ -25,6 +27,12 @@ func TestBytesPool(t *testing.T) {
 
 	testutil.Equals(t, []int{10, 20, 40, 80}, chunkPool.sizes)
 
+	_, err = NewBucketedBytes(10, 100, 1, 1000)
+	testutil.NotOk(t, err)
+	small, err := NewBucketedBytes(1, 4, 1.1, 1000)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int{1, 2, 3, 4}, small.sizes)
+
 	for i := 0; i < 10; i++ {
 		b, err := chunkPool.Get(40)
 		testutil.Ok(t, err)
@@ -64,6 +72,91 @@ func TestBytesPool(t *testing.T) {
 	testutil.Equals(t, uint64(0), chunkPool.usedTotal)
 }
 
+func TestBytesPoolMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	chunkPool, err := NewBucketedBytes(10, 100, 2, 1000)
+	testutil.Ok(t, err)
+	chunkPool.WithMetrics(reg)
+
+	b, err := chunkPool.Get(15)
+	testutil.Ok(t, err)
+	chunkPool.Put(b)
+	b, err = chunkPool.Get(20)
+	testutil.Ok(t, err)
+	_, err = chunkPool.Get(500)
+	testutil.Ok(t, err)
+	_, err = chunkPool.Get(600)
+	testutil.Equals(t, ErrPoolExhausted, err)
+	chunkPool.Put(b)
+
+	m := chunkPool.metrics
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(m.requests.WithLabelValues("20")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(m.requests.WithLabelValues(oversizedBucket)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(m.misses.WithLabelValues("20")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(m.misses.WithLabelValues(oversizedBucket)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(m.exhausted))
+	testutil.Equals(t, 10.0, promtestutil.ToFloat64(m.minBucketSize))
+	testutil.Equals(t, 80.0, promtestutil.ToFloat64(m.maxBucketSize))
+
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "pool_used_bytes":
+			testutil.Equals(t, 500.0, mf.GetMetric()[0].GetGauge().GetValue())
+		case "pool_max_bytes":
+			testutil.Equals(t, 1000.0, mf.GetMetric()[0].GetGauge().GetValue())
+		}
+	}
+}
+
+func TestBytesPoolAdapt(t *testing.T) {
+	chunkPool, err := NewBucketedBytes(8, 1024, 2, 0)
+	testutil.Ok(t, err)
+
+	// Adapting is a no-op unless adaptive sizing is enabled.
+	for i := 0; i < minAdaptiveRequests; i++ {
+		b, err := chunkPool.Get(100)
+		testutil.Ok(t, err)
+		chunkPool.Put(b)
+	}
+	chunkPool.Adapt()
+	testutil.Equals(t, []int{8, 16, 32, 64, 128, 256, 512, 1024}, chunkPool.sizes)
+
+	chunkPool.WithAdaptiveSizing()
+	get := func(sz, n int) {
+		for i := 0; i < n; i++ {
+			b, err := chunkPool.Get(sz)
+			testutil.Ok(t, err)
+			testutil.Assert(t, cap(*b) >= sz, "byte slice of capacity %d smaller than requested size %d", cap(*b), sz)
+			chunkPool.Put(b)
+		}
+	}
+
+	// Too few requests to adapt the buckets to.
+	get(100, minAdaptiveRequests-1)
+	chunkPool.Adapt()
+	testutil.Equals(t, []int{8, 16, 32, 64, 128, 256, 512, 1024}, chunkPool.sizes)
+
+	get(100, 1)
+	chunkPool.Adapt()
+	testutil.Equals(t, []int{128}, chunkPool.sizes)
+
+	// The requested sizes are counted again once adapted.
+	get(30, 10)
+	get(200, 88)
+	get(300, 2)
+	chunkPool.Adapt()
+	testutil.Equals(t, []int{32, 64, 128, 256, 512}, chunkPool.sizes)
+
+	// The buckets are bound to the configured sizes.
+	get(1, 50)
+	get(5000, 50)
+	chunkPool.Adapt()
+	testutil.Equals(t, []int{8, 16, 32, 64, 128, 256, 512, 1024}, chunkPool.sizes)
+	testutil.Equals(t, uint64(0), chunkPool.UsedBytes())
+}
+
 func TestRacePutGet(t *testing.T) {
 	chunkPool, err := NewBucketedBytes(3, 100, 2, 5000)
 	testutil.Ok(t, err)
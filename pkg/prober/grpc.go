@@ -4,6 +4,8 @@
 package prober
 
 import (
+	"sync"
+
 	"google.golang.org/grpc/health"
 	grpc_health "google.golang.org/grpc/health/grpc_health_v1"
 )
@@ -11,6 +13,10 @@ import (
 // GRPCProbe represents health and readiness status of given component, and provides GRPC integration.
 type GRPCProbe struct {
 	h *health.Server
+
+	mtx      sync.Mutex
+	status   grpc_health.HealthCheckResponse_ServingStatus
+	services map[string]struct{}
 }
 
 // NewGRPC creates a Probe that wrapped around grpc/healt.Server which reflects status of server.
@@ -18,7 +24,11 @@ func NewGRPC() *GRPCProbe {
 	h := health.NewServer()
 	h.SetServingStatus("", grpc_health.HealthCheckResponse_NOT_SERVING)
 
-	return &GRPCProbe{h: h}
+	return &GRPCProbe{
+		h:        h,
+		status:   grpc_health.HealthCheckResponse_NOT_SERVING,
+		services: map[string]struct{}{},
+	}
 }
 
 // HealthServer returns a gRPC health server which responds readiness and liveness checks.
@@ -26,19 +36,50 @@ func (p *GRPCProbe) HealthServer() *health.Server {
 	return p.h
 }
 
+// AddServices adds the given gRPC services, e.g. thanos.Store, to the ones whose health is reported, so that
+// clients can check the readiness of each service served by the component. Their status follows the status of
+// the component.
+func (p *GRPCProbe) AddServices(services ...string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, s := range services {
+		p.services[s] = struct{}{}
+		p.h.SetServingStatus(s, p.status)
+	}
+}
+
 // Ready sets components status to ready.
 func (p *GRPCProbe) Ready() {
-	p.h.SetServingStatus("", grpc_health.HealthCheckResponse_SERVING)
+	p.setServingStatus(grpc_health.HealthCheckResponse_SERVING)
 }
 
 // NotReady sets components status to not ready with given error as a cause.
 func (p *GRPCProbe) NotReady(err error) {
-	p.h.SetServingStatus("", grpc_health.HealthCheckResponse_NOT_SERVING)
+	p.setServingStatus(grpc_health.HealthCheckResponse_NOT_SERVING)
+}
+
+func (p *GRPCProbe) setServingStatus(status grpc_health.HealthCheckResponse_ServingStatus) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.status = status
+	p.h.SetServingStatus("", status)
+	for s := range p.services {
+		p.h.SetServingStatus(s, status)
+	}
 }
 
 // Healthy sets components status to healthy.
 func (p *GRPCProbe) Healthy() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
 	p.h.Resume()
+	// Resuming serves all services, the added ones are only served once the component is ready.
+	for s := range p.services {
+		p.h.SetServingStatus(s, p.status)
+	}
 }
 
 // NotHealthy sets components status to not healthy with given error as a cause.
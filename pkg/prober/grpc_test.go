@@ -0,0 +1,48 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package prober
+
+import (
+	"context"
+	"testing"
+
+	grpc_health "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestGRPCProberServicesStatus(t *testing.T) {
+	p := NewGRPC()
+	p.AddServices("thanos.Store", "thanos.Rules")
+
+	status := func(service string) grpc_health.HealthCheckResponse_ServingStatus {
+		resp, err := p.HealthServer().Check(context.Background(), &grpc_health.HealthCheckRequest{Service: service})
+		testutil.Ok(t, err)
+		return resp.Status
+	}
+
+	p.Healthy()
+	testutil.Equals(t, grpc_health.HealthCheckResponse_NOT_SERVING, status("thanos.Store"))
+	testutil.Equals(t, grpc_health.HealthCheckResponse_NOT_SERVING, status("thanos.Rules"))
+
+	p.Ready()
+	testutil.Equals(t, grpc_health.HealthCheckResponse_SERVING, status(""))
+	testutil.Equals(t, grpc_health.HealthCheckResponse_SERVING, status("thanos.Store"))
+
+	// Services added later follow the status of the component.
+	p.AddServices("thanos.Targets")
+	testutil.Equals(t, grpc_health.HealthCheckResponse_SERVING, status("thanos.Targets"))
+
+	p.NotHealthy(nil)
+	testutil.Equals(t, grpc_health.HealthCheckResponse_NOT_SERVING, status("thanos.Targets"))
+	p.Healthy()
+	testutil.Equals(t, grpc_health.HealthCheckResponse_SERVING, status("thanos.Targets"))
+
+	p.NotReady(nil)
+	testutil.Equals(t, grpc_health.HealthCheckResponse_NOT_SERVING, status(""))
+	testutil.Equals(t, grpc_health.HealthCheckResponse_NOT_SERVING, status("thanos.Rules"))
+
+	_, err := p.HealthServer().Check(context.Background(), &grpc_health.HealthCheckRequest{Service: "thanos.Exemplars"})
+	testutil.NotOk(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,6 +27,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/promql"
@@ -514,16 +516,137 @@ func (c *Client) PromqlQueryInstant(ctx context.Context, base *url.URL, query st
 		// TODO(mhoffm): shouldn't labels from prometheus results be already sorted?
 		b.Sort()
 
-		vec = append(vec, promql.Sample{
+		sample := promql.Sample{
 			Metric: b.Labels(),
 			T:      int64(e.Timestamp),
-			F:      float64(e.Value),
-		})
+		}
+		if e.Histogram != nil {
+			sample.H = floatHistogramFromSampleHistogram(e.Histogram)
+		} else {
+			sample.F = float64(e.Value)
+		}
+		vec = append(vec, sample)
 	}
 
 	return vec, warnings, nil
 }
 
+const (
+	minExponentialSchema = -4
+	maxExponentialSchema = 8
+)
+
+// floatHistogramFromSampleHistogram converts a native histogram of a query API response back into a FloatHistogram.
+// The API only exposes the boundaries of the populated buckets, so the schema of the histogram is inferred from them.
+func floatHistogramFromSampleHistogram(sh *model.SampleHistogram) *histogram.FloatHistogram {
+	fh := &histogram.FloatHistogram{
+		CounterResetHint: histogram.UnknownCounterReset,
+		Count:            float64(sh.Count),
+		Sum:              float64(sh.Sum),
+	}
+
+	buckets := make([]*model.HistogramBucket, 0, len(sh.Buckets))
+	for _, b := range sh.Buckets {
+		// The zero bucket is the only one spanning zero.
+		if b.Lower <= 0 && b.Upper >= 0 {
+			fh.ZeroThreshold, fh.ZeroCount = float64(b.Upper), float64(b.Count)
+			continue
+		}
+		buckets = append(buckets, b)
+	}
+	fh.Schema = inferHistogramSchema(buckets, fh.ZeroThreshold)
+
+	positive, negative := map[int32]float64{}, map[int32]float64{}
+	for _, b := range buckets {
+		if b.Lower > 0 {
+			positive[histogramBucketIndex(float64(b.Lower), float64(b.Upper), fh.Schema)] = float64(b.Count)
+		} else {
+			negative[histogramBucketIndex(-float64(b.Upper), -float64(b.Lower), fh.Schema)] = float64(b.Count)
+		}
+	}
+	fh.PositiveSpans, fh.PositiveBuckets = histogramSpans(positive)
+	fh.NegativeSpans, fh.NegativeBuckets = histogramSpans(negative)
+	return fh
+}
+
+// inferHistogramSchema returns the schema of the given non zero buckets. The boundaries of buckets overlapping the
+// zero bucket are clamped to the zero threshold and the upper bound of the last bucket is adjusted, but the absolute
+// upper bound of every other bucket is always one of the boundaries of the schema.
+func inferHistogramSchema(buckets []*model.HistogramBucket, zeroThreshold float64) int32 {
+	absUpper := func(b *model.HistogramBucket) float64 {
+		return math.Max(math.Abs(float64(b.Lower)), math.Abs(float64(b.Upper)))
+	}
+	matches := func(schema int32) bool {
+		for _, b := range buckets {
+			bound := absUpper(b)
+			if math.IsInf(bound, 0) || bound == math.MaxFloat64 {
+				continue
+			}
+			idx := math.Log2(bound) * math.Exp2(float64(schema))
+			if math.Abs(idx-math.Round(idx)) > 1e-9 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// The ratio between the boundaries of a bucket gives the schema away.
+	for _, b := range buckets {
+		lower, upper := math.Min(math.Abs(float64(b.Lower)), math.Abs(float64(b.Upper))), absUpper(b)
+		if lower <= zeroThreshold || math.IsInf(upper, 0) || upper == math.MaxFloat64 {
+			continue
+		}
+		schema := min(max(int32(math.Round(-math.Log2(math.Log2(upper/lower)))), minExponentialSchema), maxExponentialSchema)
+		if matches(schema) {
+			return schema
+		}
+	}
+	// Otherwise, pick the coarsest schema the upper bounds belong to.
+	for schema := int32(minExponentialSchema); schema < maxExponentialSchema; schema++ {
+		if matches(schema) {
+			return schema
+		}
+	}
+	return maxExponentialSchema
+}
+
+// histogramBucketIndex returns the index of the bucket with the given absolute boundaries.
+func histogramBucketIndex(lower, upper float64, schema int32) int32 {
+	if math.IsInf(upper, 0) {
+		return histogramBucketIndex(0, lower, schema) + 1
+	}
+	return int32(math.Round(math.Log2(upper) * math.Exp2(float64(schema))))
+}
+
+// histogramSpans returns the spans and the counts of the buckets with the given indexes.
+func histogramSpans(counts map[int32]float64) ([]histogram.Span, []float64) {
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	idxs := make([]int32, 0, len(counts))
+	for idx := range counts {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	var (
+		spans   []histogram.Span
+		buckets = make([]float64, 0, len(idxs))
+	)
+	for i, idx := range idxs {
+		switch {
+		case i == 0:
+			spans = append(spans, histogram.Span{Offset: idx, Length: 1})
+		case idx == idxs[i-1]+1:
+			spans[len(spans)-1].Length++
+		default:
+			spans = append(spans, histogram.Span{Offset: idx - idxs[i-1] - 1, Length: 1})
+		}
+		buckets = append(buckets, counts[idx])
+	}
+	return spans, buckets
+}
+
 // QueryRange performs a range query using a default HTTP client and returns results in model.Matrix type.
 func (c *Client) QueryRange(ctx context.Context, base *url.URL, query string, startTime, endTime, step int64, opts QueryOptions) (model.Matrix, []string, *Explanation, error) {
 	params, err := url.ParseQuery(base.RawQuery)
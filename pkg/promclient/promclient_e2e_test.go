@@ -5,7 +5,10 @@ package promclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -16,6 +19,7 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"gopkg.in/yaml.v3"
@@ -154,6 +158,92 @@ func TestRule_UnmarshalScalarResponse(t *testing.T) {
 	testutil.NotOk(t, err)
 }
 
+func TestPromqlQueryInstant_NativeHistograms(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		h    *histogram.FloatHistogram
+	}{
+		{
+			name: "positive buckets with gaps",
+			h: &histogram.FloatHistogram{
+				Schema:          0,
+				Count:           10,
+				Sum:             42,
+				PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}, {Offset: 3, Length: 1}},
+				PositiveBuckets: []float64{3, 4, 3},
+			},
+		},
+		{
+			name: "zero and negative buckets",
+			h: &histogram.FloatHistogram{
+				Schema:          3,
+				Count:           14,
+				Sum:             -7.5,
+				ZeroThreshold:   0.001,
+				ZeroCount:       2,
+				PositiveSpans:   []histogram.Span{{Offset: -2, Length: 1}},
+				PositiveBuckets: []float64{5},
+				NegativeSpans:   []histogram.Span{{Offset: 4, Length: 2}, {Offset: 1, Length: 1}},
+				NegativeBuckets: []float64{1, 2, 4},
+			},
+		},
+		{
+			name: "bucket clamped by the zero threshold",
+			h: &histogram.FloatHistogram{
+				Schema:          0,
+				Count:           5,
+				Sum:             3,
+				ZeroThreshold:   0.3,
+				ZeroCount:       1,
+				PositiveSpans:   []histogram.Span{{Offset: -1, Length: 1}},
+				PositiveBuckets: []float64{4},
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			// Native histograms are exposed by the query API with the boundaries of their populated buckets only.
+			sh := &model.SampleHistogram{Count: model.FloatString(tcase.h.Count), Sum: model.FloatString(tcase.h.Sum)}
+			it := tcase.h.AllBucketIterator()
+			for it.Next() {
+				b := it.At()
+				if b.Count == 0 {
+					continue
+				}
+				var boundaries int32
+				switch {
+				case b.LowerInclusive && b.UpperInclusive:
+					boundaries = 3
+				case b.LowerInclusive:
+					boundaries = 1
+				case !b.UpperInclusive:
+					boundaries = 2
+				}
+				sh.Buckets = append(sh.Buckets, &model.HistogramBucket{
+					Boundaries: boundaries,
+					Lower:      model.FloatString(b.Lower),
+					Upper:      model.FloatString(b.Upper),
+					Count:      model.FloatString(b.Count),
+				})
+			}
+			result, err := json.Marshal(model.Vector{{Metric: model.Metric{"__name__": "h"}, Histogram: sh, Timestamp: 1000}})
+			testutil.Ok(t, err)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+			}))
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			testutil.Ok(t, err)
+
+			vec, _, err := NewDefaultClient().PromqlQueryInstant(context.Background(), u, "h", time.Unix(1, 0), QueryOptions{})
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(vec))
+			testutil.Equals(t, int64(1000), vec[0].T)
+			testutil.Equals(t, tcase.h, vec[0].H)
+		})
+	}
+}
+
 func TestQueryRange_e2e(t *testing.T) {
 	e2eutil.ForeachPrometheus(t, func(t testing.TB, p *e2eutil.Prometheus) {
 		now := time.Now()
@@ -0,0 +1,251 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/extgrpc"
+	"github.com/thanos-io/thanos/pkg/extgrpc/snappy"
+	thanostls "github.com/thanos-io/thanos/pkg/tls"
+)
+
+// EndpointConfig configures a set of endpoints sharing the same connection settings.
+// Settings which are not configured default to the ones of the querier flags.
+type EndpointConfig struct {
+	// Addresses of the endpoints. They may be prefixed with 'dns+' or 'dnssrv+' to be discovered through DNS lookups,
+	// except for groups, whose addresses are DNS names resolved by gRPC.
+	Addresses []string `yaml:"addresses"`
+	// Strict endpoints are always used, even if their health check fails.
+	Strict bool `yaml:"strict"`
+	// Group queries the targets resolved from an address in a round-robin, instead of a fanout manner.
+	Group bool `yaml:"group"`
+	// Labels are the labels the endpoints are grouped by, exposed on the endpoint status.
+	Labels map[string]string `yaml:"labels"`
+
+	// TLSConfig overrides the TLS settings of the gRPC client flags.
+	TLSConfig *EndpointTLSConfig `yaml:"tls_config"`
+	// BearerToken, or the content of BearerTokenFile, is sent with every request to the endpoints. It requires TLS.
+	BearerToken     string `yaml:"bearer_token"`
+	BearerTokenFile string `yaml:"bearer_token_file"`
+	// Compression overrides the compression algorithm of the gRPC requests, either "none" or "snappy".
+	Compression string `yaml:"compression"`
+}
+
+// EndpointTLSConfig configures the TLS client of the connections to endpoints.
+type EndpointTLSConfig struct {
+	// Enabled enables TLS. Disabling it allows plain text connections to endpoints when TLS is enabled by flags.
+	Enabled bool `yaml:"enabled"`
+	// CAFile verifies the certificate of endpoints, the system certificates are used if empty.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key used to authenticate to endpoints, i.e. mTLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName verifies the hostname of the certificate of endpoints.
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify disables the verification of the certificate of endpoints.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// LoadEndpointConfig parses and validates the endpoints configuration file.
+func LoadEndpointConfig(content []byte) ([]EndpointConfig, error) {
+	var configs []EndpointConfig
+	if err := yaml.UnmarshalStrict(content, &configs); err != nil {
+		return nil, errors.Wrap(err, "parsing config YAML file")
+	}
+
+	for i, c := range configs {
+		if len(c.Addresses) == 0 {
+			return nil, errors.Errorf("endpoint config %d: no addresses", i)
+		}
+		for _, addr := range c.Addresses {
+			if c.Group && dns.IsDynamicNode(addr) {
+				return nil, errors.Errorf("endpoint config %d: group address %s must be a DNS name without SD prefix", i, addr)
+			}
+			if c.Strict && !c.Group && dns.IsDynamicNode(addr) {
+				return nil, errors.Errorf("endpoint config %d: %s is a dynamically specified endpoint i.e. it uses SD and that is not permitted under strict mode", i, addr)
+			}
+		}
+		for name := range c.Labels {
+			if !model.LabelName(name).IsValid() {
+				return nil, errors.Errorf("endpoint config %d: invalid label name %q", i, name)
+			}
+		}
+		if c.BearerToken != "" && c.BearerTokenFile != "" {
+			return nil, errors.Errorf("endpoint config %d: at most one of bearer_token and bearer_token_file must be configured", i)
+		}
+		if c.TLSConfig != nil && (c.TLSConfig.CertFile != "") != (c.TLSConfig.KeyFile != "") {
+			return nil, errors.Errorf("endpoint config %d: both cert_file and key_file must be configured", i)
+		}
+		switch c.Compression {
+		case "", "none", snappy.Name:
+		default:
+			return nil, errors.Errorf("endpoint config %d: unsupported compression %q, expected \"none\" or %q", i, c.Compression, snappy.Name)
+		}
+	}
+	return configs, nil
+}
+
+// dialOptions returns the gRPC dial options of the endpoints. They are applied after the ones of the querier flags, overriding them.
+func (c EndpointConfig) dialOptions(logger log.Logger) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if c.Group {
+		opts = append(opts, extgrpc.EndpointGroupGRPCOpts()...)
+	}
+
+	if c.TLSConfig != nil {
+		if c.TLSConfig.Enabled {
+			tlsCfg, err := thanostls.NewClientConfig(logger, c.TLSConfig.CertFile, c.TLSConfig.KeyFile, c.TLSConfig.CAFile, c.TLSConfig.ServerName, c.TLSConfig.InsecureSkipVerify)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		}
+	}
+
+	if c.BearerToken != "" || c.BearerTokenFile != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&bearerTokenCredentials{token: c.BearerToken, tokenFile: c.BearerTokenFile}))
+	}
+
+	switch c.Compression {
+	case "none":
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(encoding.Identity)))
+	case snappy.Name:
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(snappy.Name)))
+	}
+	return opts, nil
+}
+
+// bearerTokenCredentials authenticates requests with a bearer token. The token file is read on every request,
+// so that rotated tokens are picked up.
+type bearerTokenCredentials struct {
+	token     string
+	tokenFile string
+}
+
+func (b *bearerTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token := b.token
+	if b.tokenFile != "" {
+		content, err := os.ReadFile(b.tokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read bearer token file")
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity makes sure tokens are never sent over plain text connections.
+func (b *bearerTokenCredentials) RequireTransportSecurity() bool { return true }
+
+// ConfiguredEndpoints holds the endpoints of the endpoints configuration file of the querier.
+// The configuration can be reloaded at runtime, the connections to endpoints whose configuration changed are re-established.
+type ConfiguredEndpoints struct {
+	logger   log.Logger
+	provider *dns.Provider
+
+	mtx     sync.RWMutex
+	entries []configuredEndpoints
+}
+
+type configuredEndpoints struct {
+	cfg         EndpointConfig
+	key         string
+	groupLabels labels.Labels
+	dialOpts    []grpc.DialOption
+}
+
+// NewConfiguredEndpoints returns empty configured endpoints, resolving dynamic addresses with the given provider.
+func NewConfiguredEndpoints(logger log.Logger, provider *dns.Provider) *ConfiguredEndpoints {
+	return &ConfiguredEndpoints{logger: logger, provider: provider}
+}
+
+// Reload replaces the configured endpoints with the ones of the given configuration file content.
+// The previous endpoints are kept if the configuration is invalid.
+func (c *ConfiguredEndpoints) Reload(content []byte) error {
+	configs, err := LoadEndpointConfig(content)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]configuredEndpoints, 0, len(configs))
+	for i, cfg := range configs {
+		dialOpts, err := cfg.dialOptions(c.logger)
+		if err != nil {
+			return errors.Wrapf(err, "endpoint config %d: build dial options", i)
+		}
+		// The key is the configuration without its addresses, so that it is shared by all of them.
+		keyCfg := cfg
+		keyCfg.Addresses = nil
+		key, err := yaml.Marshal(keyCfg)
+		if err != nil {
+			return errors.Wrapf(err, "endpoint config %d: marshal", i)
+		}
+		entries = append(entries, configuredEndpoints{
+			cfg:         cfg,
+			key:         string(key),
+			groupLabels: labels.FromMap(cfg.Labels),
+			dialOpts:    dialOpts,
+		})
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.entries = entries
+	return nil
+}
+
+// Resolve resolves the dynamic addresses of the configured endpoints.
+func (c *ConfiguredEndpoints) Resolve(ctx context.Context) error {
+	c.mtx.RLock()
+	var addrs []string
+	for _, e := range c.entries {
+		if !e.cfg.Group {
+			addrs = append(addrs, e.cfg.Addresses...)
+		}
+	}
+	c.mtx.RUnlock()
+
+	return c.provider.Resolve(ctx, addrs)
+}
+
+// Specs returns the specs of the configured endpoints, with their latest resolved addresses.
+func (c *ConfiguredEndpoints) Specs() []*GRPCEndpointSpec {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var specs []*GRPCEndpointSpec
+	for _, e := range c.entries {
+		for _, addr := range e.cfg.Addresses {
+			resolved := []string{fmt.Sprintf("dns:///%s", addr)}
+			if !e.cfg.Group {
+				resolved = c.provider.AddressesOf(addr)
+			}
+			for _, r := range resolved {
+				spec := NewGRPCEndpointSpec(r, e.cfg.Strict, e.dialOpts...)
+				spec.configKey = e.key
+				spec.groupLabels = e.groupLabels
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs
+}
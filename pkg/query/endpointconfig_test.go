@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+)
+
+func TestLoadEndpointConfig(t *testing.T) {
+	for _, tcase := range []struct {
+		name    string
+		content string
+		want    []EndpointConfig
+		wantErr bool
+	}{
+		{
+			name: "valid config",
+			content: `
+- addresses: [sidecar-0:10901, dns+sidecar.example.com:10901]
+  labels:
+    cluster: eu-1
+  tls_config:
+    enabled: true
+    ca_file: /etc/ca.pem
+    server_name: sidecar.example.com
+  bearer_token_file: /etc/token
+- addresses: [store.example.com:10901]
+  strict: true
+  group: true
+  compression: none
+`,
+			want: []EndpointConfig{
+				{
+					Addresses:       []string{"sidecar-0:10901", "dns+sidecar.example.com:10901"},
+					Labels:          map[string]string{"cluster": "eu-1"},
+					TLSConfig:       &EndpointTLSConfig{Enabled: true, CAFile: "/etc/ca.pem", ServerName: "sidecar.example.com"},
+					BearerTokenFile: "/etc/token",
+				},
+				{
+					Addresses:   []string{"store.example.com:10901"},
+					Strict:      true,
+					Group:       true,
+					Compression: "none",
+				},
+			},
+		},
+		{
+			name:    "unknown field",
+			content: `[{addresses: [a:1], unknown: true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "no addresses",
+			content: `[{strict: true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "strict dynamic address",
+			content: `[{addresses: [dns+a:1], strict: true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "group with SD prefix",
+			content: `[{addresses: [dns+a:1], group: true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "both bearer token and file",
+			content: `[{addresses: [a:1], bearer_token: t, bearer_token_file: /etc/token}]`,
+			wantErr: true,
+		},
+		{
+			name:    "cert without key",
+			content: `[{addresses: [a:1], tls_config: {enabled: true, cert_file: /etc/cert.pem}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported compression",
+			content: `[{addresses: [a:1], compression: gzip}]`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			configs, err := LoadEndpointConfig([]byte(tcase.content))
+			if tcase.wantErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.want, configs)
+		})
+	}
+}
+
+func TestConfiguredEndpoints(t *testing.T) {
+	endpoints, err := startTestEndpoints([]testEndpointMeta{
+		{
+			InfoResponse: sidecarInfo,
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return labelpb.ZLabelSetsFromPromLabels(labels.FromStrings("addr", addr))
+			},
+		},
+	})
+	testutil.Ok(t, err)
+	defer endpoints.Close()
+	addr := endpoints.EndpointAddresses()[0]
+
+	configured := NewConfiguredEndpoints(log.NewNopLogger(), dns.NewProvider(log.NewNopLogger(), nil, ""))
+	endpointSet := NewEndpointSet(time.Now, nil, nil, configured.Specs, testGRPCOpts, time.Minute, time.Second, 0)
+	defer endpointSet.Close()
+
+	reload := func(content string) {
+		t.Helper()
+		testutil.Ok(t, configured.Reload([]byte(content)))
+		testutil.Ok(t, configured.Resolve(context.Background()))
+		endpointSet.Update(context.Background())
+	}
+
+	reload(fmt.Sprintf(`[{addresses: [%s], labels: {cluster: eu-1}}]`, addr))
+	statuses := endpointSet.GetEndpointStatus()
+	testutil.Equals(t, 1, len(statuses))
+	testutil.Equals(t, labels.FromStrings("cluster", "eu-1"), statuses[0].GroupLabels)
+	testutil.Equals(t, 1, len(endpointSet.GetStoreClients()))
+	previous := endpointSet.endpoints[addr]
+
+	// The connection is kept as long as the configuration of the endpoint does not change.
+	reload(fmt.Sprintf(`[{addresses: [%s], labels: {cluster: eu-1}}]`, addr))
+	testutil.Assert(t, previous == endpointSet.endpoints[addr], "expected the connection to be kept")
+
+	reload(fmt.Sprintf(`[{addresses: [%s], labels: {cluster: eu-2}, compression: none}]`, addr))
+	testutil.Assert(t, previous != endpointSet.endpoints[addr], "expected the connection to be re-established")
+	statuses = endpointSet.GetEndpointStatus()
+	testutil.Equals(t, 1, len(statuses))
+	testutil.Equals(t, labels.FromStrings("cluster", "eu-2"), statuses[0].GroupLabels)
+	testutil.Equals(t, 1, len(endpointSet.GetStoreClients()))
+
+	// Invalid configurations are rejected, keeping the previous endpoints.
+	testutil.NotOk(t, configured.Reload([]byte(`[{addresses: []}]`)))
+	testutil.Equals(t, 1, len(configured.Specs()))
+
+	// A bearer token requires TLS, which isn't used by the test endpoints.
+	reload(fmt.Sprintf(`[{addresses: [%s], bearer_token: secret}]`, addr))
+	testutil.Equals(t, 0, len(endpointSet.GetStoreClients()))
+
+	reload(`[]`)
+	testutil.Equals(t, 0, len(endpointSet.GetEndpointStatus()))
+}
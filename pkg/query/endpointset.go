@@ -51,6 +51,12 @@ type GRPCEndpointSpec struct {
 	addr           string
 	isStrictStatic bool
 	dialOpts       []grpc.DialOption
+
+	// configKey identifies the configuration the dial options of the spec were built from.
+	// The connection to an endpoint is re-established when its configuration changes.
+	configKey string
+	// groupLabels are the labels of the configured group the endpoint belongs to.
+	groupLabels labels.Labels
 }
 
 const externalLabelLimit = 1000
@@ -192,6 +198,11 @@ type EndpointStatus struct {
 	ComponentType component.Component `json:"-"`
 	MinTime       int64               `json:"minTime"`
 	MaxTime       int64               `json:"maxTime"`
+	// GroupLabels are the labels of the configured endpoint group the endpoint belongs to, if any.
+	GroupLabels labels.Labels `json:"groupLabels,omitempty"`
+	// Stale is true if the last Info call failed, but the endpoint is still queried using its last known
+	// metadata because the failure happened within the staleness grace period.
+	Stale bool `json:"stale"`
 }
 
 // endpointSetNodeCollector is a metric collector reporting the number of available storeAPIs for Querier.
@@ -301,6 +312,9 @@ type EndpointSet struct {
 	dialOpts                 []grpc.DialOption
 	endpointInfoTimeout      time.Duration
 	unhealthyEndpointTimeout time.Duration
+	// infoStalenessGracePeriod is the time since the last successful Info call during which an endpoint failing
+	// its Info calls is still queried using its last known metadata.
+	infoStalenessGracePeriod time.Duration
 
 	updateMtx sync.Mutex
 
@@ -324,6 +338,7 @@ func NewEndpointSet(
 	dialOpts []grpc.DialOption,
 	unhealthyEndpointTimeout time.Duration,
 	endpointInfoTimeout time.Duration,
+	infoStalenessGracePeriod time.Duration,
 	endpointMetricLabels ...string,
 ) *EndpointSet {
 	endpointsMetric := newEndpointSetNodeCollector(logger, endpointMetricLabels...)
@@ -347,6 +362,7 @@ func NewEndpointSet(
 		dialOpts:                 dialOpts,
 		endpointInfoTimeout:      endpointInfoTimeout,
 		unhealthyEndpointTimeout: unhealthyEndpointTimeout,
+		infoStalenessGracePeriod: infoStalenessGracePeriod,
 		endpointSpec: func() map[string]*GRPCEndpointSpec {
 			specs := make(map[string]*GRPCEndpointSpec)
 			for _, s := range endpointSpecs() {
@@ -377,7 +393,7 @@ func (e *EndpointSet) Update(ctx context.Context) {
 	for _, spec := range e.endpointSpec() {
 		spec := spec
 
-		if er, existingRef := e.endpoints[spec.Addr()]; existingRef {
+		if er, existingRef := e.endpoints[spec.Addr()]; existingRef && er.configKey == spec.configKey {
 			wg.Add(1)
 			go func(spec *GRPCEndpointSpec) {
 				defer wg.Done()
@@ -434,6 +450,10 @@ func (e *EndpointSet) Update(ctx context.Context) {
 	for addr, er := range newRefs {
 		extLset := labelpb.PromLabelSetsToString(er.LabelSets())
 		level.Info(e.logger).Log("msg", fmt.Sprintf("adding new %v with %+v", er.ComponentType(), er.apisPresent()), "address", addr, "extLset", extLset)
+		// The configuration of the endpoint changed, the connection using the previous one is replaced.
+		if replaced, ok := e.endpoints[addr]; ok {
+			replaced.Close()
+		}
 		e.endpoints[addr] = er
 	}
 	for addr, er := range staleRefs {
@@ -553,14 +573,20 @@ func (e *EndpointSet) GetQueryAPIClients() []Client {
 	return queryClients
 }
 
-// GetRulesClients returns a list of all active rules clients.
+// GetRulesClients returns a list of all active rules clients, annotating the rule groups they return with their endpoint.
 func (e *EndpointSet) GetRulesClients() []rulespb.RulesClient {
 	endpoints := e.getQueryableRefs()
 
 	rules := make([]rulespb.RulesClient, 0, len(endpoints))
 	for _, er := range endpoints {
 		if er.HasRulesAPI() {
-			rules = append(rules, rulespb.NewRulesClient(er.cc))
+			rules = append(rules, &rulespb.EndpointRulesClient{
+				RulesClient: rulespb.NewRulesClient(er.cc),
+				Source: &rulespb.RuleGroupSource{
+					Endpoint:  er.addr,
+					LabelSets: labelpb.ZLabelSetsFromPromLabels(er.LabelSets()...),
+				},
+			})
 		}
 	}
 	return rules
@@ -646,11 +672,16 @@ type endpointRef struct {
 	cc       *grpc.ClientConn
 	addr     string
 	isStrict bool
+	// configKey is the configuration key of the spec the connection was established with.
+	configKey   string
+	groupLabels labels.Labels
 
 	created  time.Time
 	metadata *endpointMetadata
 	status   *EndpointStatus
 
+	staleGracePeriod time.Duration
+
 	logger log.Logger
 }
 
@@ -672,6 +703,11 @@ func (e *EndpointSet) newEndpointRef(spec *GRPCEndpointSpec) (*endpointRef, erro
 		addr:     spec.Addr(),
 		isStrict: spec.isStrictStatic,
 		cc:       conn,
+
+		configKey:   spec.configKey,
+		groupLabels: spec.groupLabels,
+
+		staleGracePeriod: e.infoStalenessGracePeriod,
 	}, nil
 }
 
@@ -688,7 +724,7 @@ func (er *endpointRef) update(now nowFunc, metadata *endpointMetadata, err error
 func (er *endpointRef) updateStatus(now nowFunc, err error) {
 	mint, maxt := er.timeRange()
 	if er.status == nil {
-		er.status = &EndpointStatus{Name: er.addr}
+		er.status = &EndpointStatus{Name: er.addr, GroupLabels: er.groupLabels}
 	}
 
 	if err == nil {
@@ -698,8 +734,11 @@ func (er *endpointRef) updateStatus(now nowFunc, err error) {
 		er.status.MinTime = mint
 		er.status.MaxTime = maxt
 		er.status.LastError = nil
+		er.status.Stale = false
 	} else {
 		er.status.LastError = &stringError{originalErr: err}
+		// LastCheck is only set on successful checks, so a zero value means we never got any metadata.
+		er.status.Stale = !er.status.LastCheck.IsZero() && now().Sub(er.status.LastCheck) < er.staleGracePeriod
 	}
 }
 
@@ -718,12 +757,13 @@ func (er *endpointRef) updateMetadata(metadata *endpointMetadata, err error) {
 
 // isQueryable returns true if an endpointRef should be used for querying.
 // A strict endpointRef is always queriable. A non-strict endpointRef
-// is queryable if the last health check (info call) succeeded.
+// is queryable if the last health check (info call) succeeded, or if it
+// failed but the endpoint is still within its staleness grace period.
 func (er *endpointRef) isQueryable() bool {
 	er.mtx.RLock()
 	defer er.mtx.RUnlock()
 
-	return er.isStrict || er.status.LastError == nil
+	return er.isStrict || er.status.LastError == nil || er.status.Stale
 }
 
 func (er *endpointRef) ComponentType() component.Component {
@@ -859,6 +899,17 @@ func (er *endpointRef) SupportsWithoutReplicaLabels() bool {
 	return er.metadata.Store.SupportsWithoutReplicaLabels
 }
 
+func (er *endpointRef) SupportsTimeFiltering() bool {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	if er.metadata == nil || er.metadata.Store == nil {
+		return false
+	}
+
+	return er.metadata.Store.SupportsTimeFiltering
+}
+
 func (er *endpointRef) String() string {
 	mint, maxt := er.TimeRange()
 	return fmt.Sprintf(
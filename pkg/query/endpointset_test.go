@@ -734,7 +734,7 @@ func TestEndpointSetUpdate_AvailabilityScenarios(t *testing.T) {
 			}
 			return specs
 		},
-		testGRPCOpts, time.Minute, 2*time.Second)
+		testGRPCOpts, time.Minute, 2*time.Second, 0)
 	defer endpointSet.Close()
 
 	// Initial update.
@@ -1115,7 +1115,7 @@ func TestEndpointSet_Update_NoneAvailable(t *testing.T) {
 			}
 			return specs
 		},
-		testGRPCOpts, time.Minute, 2*time.Second)
+		testGRPCOpts, time.Minute, 2*time.Second, 0)
 	defer endpointSet.Close()
 
 	// Should not matter how many of these we run.
@@ -1224,7 +1224,7 @@ func TestEndpoint_Update_QuerierStrict(t *testing.T) {
 			NewGRPCEndpointSpec(discoveredEndpointAddr[1], false),
 			NewGRPCEndpointSpec(discoveredEndpointAddr[2], true),
 		}
-	}, testGRPCOpts, time.Minute, 1*time.Second)
+	}, testGRPCOpts, time.Minute, 1*time.Second, 0)
 	defer endpointSet.Close()
 
 	// Initial update.
@@ -1403,7 +1403,7 @@ func TestEndpointSet_APIs_Discovery(t *testing.T) {
 
 					return tc.states[currentState].endpointSpec()
 				},
-				testGRPCOpts, time.Minute, 2*time.Second)
+				testGRPCOpts, time.Minute, 2*time.Second, 0)
 
 			defer endpointSet.Close()
 
@@ -1581,6 +1581,50 @@ func TestUpdateEndpointStateForgetsPreviousErrors(t *testing.T) {
 	testutil.Equals(t, `null`, string(b))
 }
 
+func TestUpdateEndpointStateStaleGracePeriod(t *testing.T) {
+	now := time.Now()
+	nowFunc := func() time.Time { return now }
+
+	mockEndpointRef := &endpointRef{
+		addr:             "mockedStore",
+		staleGracePeriod: time.Minute,
+	}
+
+	// Endpoints which never succeeded are never stale.
+	mockEndpointRef.update(nowFunc, nil, errors.New("test err"))
+	testutil.Assert(t, !mockEndpointRef.status.Stale)
+	testutil.Assert(t, !mockEndpointRef.isQueryable())
+
+	metadata := &endpointMetadata{&infopb.InfoResponse{
+		LabelSets: labelpb.ZLabelSetsFromPromLabels(labels.FromStrings("a", "b")),
+		Store:     &infopb.StoreInfo{MinTime: 10, MaxTime: 20},
+	}}
+	mockEndpointRef.update(nowFunc, metadata, nil)
+	testutil.Assert(t, !mockEndpointRef.status.Stale)
+	testutil.Assert(t, mockEndpointRef.isQueryable())
+
+	// Failures within the grace period keep the endpoint queryable with its last known metadata.
+	now = now.Add(30 * time.Second)
+	mockEndpointRef.update(nowFunc, nil, errors.New("test err"))
+	testutil.Assert(t, mockEndpointRef.status.Stale)
+	testutil.Assert(t, mockEndpointRef.isQueryable())
+	testutil.Equals(t, []labels.Labels{labels.FromStrings("a", "b")}, mockEndpointRef.LabelSets())
+	mint, maxt := mockEndpointRef.TimeRange()
+	testutil.Equals(t, int64(10), mint)
+	testutil.Equals(t, int64(20), maxt)
+
+	// Past the grace period the endpoint is dropped from queries.
+	now = now.Add(30 * time.Second)
+	mockEndpointRef.update(nowFunc, nil, errors.New("test err"))
+	testutil.Assert(t, !mockEndpointRef.status.Stale)
+	testutil.Assert(t, !mockEndpointRef.isQueryable())
+
+	// A successful call clears the stale state.
+	mockEndpointRef.update(nowFunc, metadata, nil)
+	testutil.Assert(t, !mockEndpointRef.status.Stale)
+	testutil.Assert(t, mockEndpointRef.isQueryable())
+}
+
 func makeEndpointSet(discoveredEndpointAddr []string, strict bool, now nowFunc, metricLabels ...string) *EndpointSet {
 	endpointSet := NewEndpointSet(now, nil, nil,
 		func() (specs []*GRPCEndpointSpec) {
@@ -1589,7 +1633,7 @@ func makeEndpointSet(discoveredEndpointAddr []string, strict bool, now nowFunc,
 			}
 			return specs
 		},
-		testGRPCOpts, time.Minute, time.Second, metricLabels...)
+		testGRPCOpts, time.Minute, time.Second, 0, metricLabels...)
 	return endpointSet
 }
 
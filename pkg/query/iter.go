@@ -4,6 +4,8 @@
 package query
 
 import (
+	"math"
+
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
@@ -59,6 +61,90 @@ func (s *promSeriesSet) Warnings() annotations.Annotations {
 	return s.warns
 }
 
+// stitchedSeriesSet implements the SeriesSet interface of the Prometheus storage package on top of two storepb
+// SeriesSets, stitching series of the first one with the same raw series of the second one from the stitch time.
+type stitchedSeriesSet struct {
+	set, raw storepb.SeriesSet
+	stitchT  int64
+
+	mint, maxt int64
+	aggrs      []storepb.Aggr
+
+	warns annotations.Annotations
+
+	curr             *chunkSeries
+	setDone, rawDone bool
+}
+
+// newStitchedSeriesSet returns a storage.SeriesSet of the series of both sets. Series of the set are stitched with
+// the same series of the raw set, using the chunks of the former before the stitch time and the ones of the latter from it.
+func newStitchedSeriesSet(set, raw storepb.SeriesSet, stitchT, mint, maxt int64, aggrs []storepb.Aggr, warns annotations.Annotations) storage.SeriesSet {
+	s := &stitchedSeriesSet{
+		set:     set,
+		raw:     raw,
+		stitchT: stitchT,
+		mint:    mint,
+		maxt:    maxt,
+		aggrs:   aggrs,
+		warns:   warns,
+	}
+	// Next() needs one element look-ahead.
+	s.setDone = !s.set.Next()
+	s.rawDone = !s.raw.Next()
+	return s
+}
+
+func (s *stitchedSeriesSet) compare() int {
+	if s.setDone {
+		return 1
+	}
+	if s.rawDone {
+		return -1
+	}
+	lset, _ := s.set.At()
+	rawLset, _ := s.raw.At()
+	return labels.Compare(lset, rawLset)
+}
+
+func (s *stitchedSeriesSet) Next() bool {
+	if s.setDone && s.rawDone || s.Err() != nil {
+		return false
+	}
+
+	d := s.compare()
+	if d > 0 {
+		lset, chks := s.raw.At()
+		s.curr = newChunkSeries(lset, chks, s.mint, s.maxt, s.aggrs)
+		s.rawDone = !s.raw.Next()
+		return true
+	}
+
+	lset, chks := s.set.At()
+	s.curr = newChunkSeries(lset, chks, s.mint, s.maxt, s.aggrs)
+	if d == 0 {
+		_, s.curr.rawChunks = s.raw.At()
+		s.curr.stitchT = s.stitchT
+		s.rawDone = !s.raw.Next()
+	}
+	s.setDone = !s.set.Next()
+	return true
+}
+
+func (s *stitchedSeriesSet) At() storage.Series {
+	return s.curr
+}
+
+func (s *stitchedSeriesSet) Err() error {
+	if err := s.set.Err(); err != nil {
+		return err
+	}
+	return s.raw.Err()
+}
+
+func (s *stitchedSeriesSet) Warnings() annotations.Annotations {
+	return s.warns
+}
+
 // storeSeriesSet implements a storepb SeriesSet against a list of storepb.Series.
 type storeSeriesSet struct {
 	// TODO(bwplotka): Don't buffer all, we have to buffer single series (to sort and dedup chunks), but nothing more.
@@ -92,6 +178,10 @@ type chunkSeries struct {
 	chunks     []storepb.AggrChunk
 	mint, maxt int64
 	aggrs      []storepb.Aggr
+
+	// rawChunks are the raw chunks stitched with the chunks from stitchT, if any.
+	rawChunks []storepb.AggrChunk
+	stitchT   int64
 }
 
 // newChunkSeries allows to iterate over samples for each sorted and non-overlapped chunks.
@@ -110,64 +200,92 @@ func (s *chunkSeries) Labels() labels.Labels {
 }
 
 func (s *chunkSeries) Iterator(_ chunkenc.Iterator) chunkenc.Iterator {
-	var sit chunkenc.Iterator
-	its := make([]chunkenc.Iterator, 0, len(s.chunks))
+	if !supportedAggrs(s.aggrs) {
+		return errSeriesIterator{err: errors.Errorf("unexpected result aggregate type %v", s.aggrs)}
+	}
 
-	if len(s.aggrs) == 1 {
-		switch s.aggrs[0] {
-		case storepb.Aggr_COUNT:
-			for _, c := range s.chunks {
-				its = append(its, getFirstIterator(c.Count, c.Raw))
-			}
-			sit = newChunkSeriesIterator(its)
-		case storepb.Aggr_SUM:
-			for _, c := range s.chunks {
-				its = append(its, getFirstIterator(c.Sum, c.Raw))
-			}
-			sit = newChunkSeriesIterator(its)
-		case storepb.Aggr_MIN:
-			for _, c := range s.chunks {
-				its = append(its, getFirstIterator(c.Min, c.Raw))
-			}
-			sit = newChunkSeriesIterator(its)
-		case storepb.Aggr_MAX:
-			for _, c := range s.chunks {
-				its = append(its, getFirstIterator(c.Max, c.Raw))
+	its := make([]chunkenc.Iterator, 0, len(s.chunks)+len(s.rawChunks))
+	if s.rawChunks == nil {
+		for _, c := range s.chunks {
+			its = append(its, s.chunkIterator(c))
+		}
+	} else {
+		// Chunks are used before the stitch time and raw chunks from it.
+		for _, c := range s.chunks {
+			if c.MinTime < s.stitchT {
+				its = append(its, dedup.NewBoundedSeriesIterator(s.chunkIterator(c), math.MinInt64, s.stitchT-1))
 			}
-			sit = newChunkSeriesIterator(its)
-		case storepb.Aggr_COUNTER:
-			for _, c := range s.chunks {
-				its = append(its, getFirstIterator(c.Counter, c.Raw))
+		}
+		for _, c := range s.rawChunks {
+			if c.MaxTime >= s.stitchT {
+				its = append(its, dedup.NewBoundedSeriesIterator(s.chunkIterator(c), s.stitchT, math.MaxInt64))
 			}
-			// TODO(bwplotka): This breaks resets function. See https://github.com/thanos-io/thanos/issues/3644
-			sit = downsample.NewApplyCounterResetsIterator(its...)
-		default:
-			return errSeriesIterator{err: errors.Errorf("unexpected result aggregate type %v", s.aggrs)}
 		}
-		return dedup.NewBoundedSeriesIterator(sit, s.mint, s.maxt)
 	}
 
-	if len(s.aggrs) != 2 {
-		return errSeriesIterator{err: errors.Errorf("unexpected result aggregate type %v", s.aggrs)}
+	var sit chunkenc.Iterator
+	if len(s.aggrs) == 1 && s.aggrs[0] == storepb.Aggr_COUNTER {
+		// TODO(bwplotka): This breaks resets function. See https://github.com/thanos-io/thanos/issues/3644
+		sit = downsample.NewApplyCounterResetsIterator(its...)
+	} else {
+		sit = newChunkSeriesIterator(its)
+	}
+	// Stores supporting time filtering only return chunks within the requested range, whose samples don't need to
+	// be filtered again.
+	if s.rawChunks == nil && chunksWithinTimeRange(s.chunks, s.mint, s.maxt) {
+		return sit
 	}
+	return dedup.NewBoundedSeriesIterator(sit, s.mint, s.maxt)
+}
 
-	switch {
-	case s.aggrs[0] == storepb.Aggr_SUM && s.aggrs[1] == storepb.Aggr_COUNT,
-		s.aggrs[0] == storepb.Aggr_COUNT && s.aggrs[1] == storepb.Aggr_SUM:
+// chunksWithinTimeRange returns true if the given chunks only hold samples within the [mint, maxt] range.
+func chunksWithinTimeRange(chks []storepb.AggrChunk, mint, maxt int64) bool {
+	for _, c := range chks {
+		if c.MinTime < mint || c.MaxTime > maxt {
+			return false
+		}
+	}
+	return true
+}
 
-		for _, c := range s.chunks {
-			if c.Raw != nil {
-				its = append(its, getFirstIterator(c.Raw))
-			} else {
-				sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
-				its = append(its, downsample.NewAverageChunkIterator(cnt, sum))
-			}
+// supportedAggrs returns whether series can be iterated over for the given aggregates:
+// either a single aggregate, or the sum and count to compute an average.
+func supportedAggrs(aggrs []storepb.Aggr) bool {
+	switch len(aggrs) {
+	case 1:
+		switch aggrs[0] {
+		case storepb.Aggr_COUNT, storepb.Aggr_SUM, storepb.Aggr_MIN, storepb.Aggr_MAX, storepb.Aggr_COUNTER:
+			return true
 		}
-		sit = newChunkSeriesIterator(its)
+	case 2:
+		return aggrs[0] == storepb.Aggr_SUM && aggrs[1] == storepb.Aggr_COUNT ||
+			aggrs[0] == storepb.Aggr_COUNT && aggrs[1] == storepb.Aggr_SUM
+	}
+	return false
+}
+
+// chunkIterator returns the iterator of the samples of the aggregates of the series in the given chunk.
+func (s *chunkSeries) chunkIterator(c storepb.AggrChunk) chunkenc.Iterator {
+	if len(s.aggrs) == 2 {
+		if c.Raw != nil {
+			return getFirstIterator(c.Raw)
+		}
+		sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
+		return downsample.NewAverageChunkIterator(cnt, sum)
+	}
+
+	switch s.aggrs[0] {
+	case storepb.Aggr_COUNT:
+		return getFirstIterator(c.Count, c.Raw)
+	case storepb.Aggr_SUM:
+		return getFirstIterator(c.Sum, c.Raw)
+	case storepb.Aggr_MIN:
+		return getFirstIterator(c.Min, c.Raw)
+	case storepb.Aggr_MAX:
+		return getFirstIterator(c.Max, c.Raw)
 	default:
-		return errSeriesIterator{err: errors.Errorf("unexpected result aggregate type %v", s.aggrs)}
+		return getFirstIterator(c.Counter, c.Raw)
 	}
-	return dedup.NewBoundedSeriesIterator(sit, s.mint, s.maxt)
 }
 
 func getFirstIterator(cs ...*storepb.Chunk) chunkenc.Iterator {
@@ -45,18 +45,36 @@ func NewAggregateStatsReporter(stats *[]storepb.SeriesStatsCounter) seriesStatsR
 // When the replicaLabels argument is not empty it overwrites the global replicaLabels flag. This allows specifying
 // replicaLabels at query time.
 // maxResolutionMillis controls downsampling resolution that is allowed (specified in milliseconds).
+// stitchWindowMillis is the window before the end of downsampled data that raw data is queried for and
+// stitched with downsampled data, to fill gaps at the boundary between resolutions. Zero disables it.
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behavior of proxy.
 type QueryableCreator func(
 	deduplicate bool,
 	replicaLabels []string,
 	storeDebugMatchers [][]*labels.Matcher,
 	maxResolutionMillis int64,
+	stitchWindowMillis int64,
 	partialResponse,
 	skipChunks bool,
 	shardInfo *storepb.ShardInfo,
 	seriesStatsReporter seriesStatsReporter,
 ) storage.Queryable
 
+// QueryableCreatorOption configures the queryables created by a QueryableCreator.
+type QueryableCreatorOption func(*queryableCreatorOptions)
+
+type queryableCreatorOptions struct {
+	aggregationPushdown bool
+}
+
+// WithAggregationPushdown enables hinting stores with the sum, min or max by labels surrounding series selections of
+// downsampled data, so that stores supporting it aggregate the series instead of sending them one by one.
+func WithAggregationPushdown(enabled bool) QueryableCreatorOption {
+	return func(o *queryableCreatorOptions) {
+		o.aggregationPushdown = enabled
+	}
+}
+
 // NewQueryableCreator creates QueryableCreator.
 // NOTE(bwplotka): Proxy assumes to be replica_aware, see thanos.store.info.StoreInfo.replica_aware field.
 func NewQueryableCreator(
@@ -65,14 +83,20 @@ func NewQueryableCreator(
 	proxy storepb.StoreServer,
 	maxConcurrentSelects int,
 	selectTimeout time.Duration,
+	opts ...QueryableCreatorOption,
 ) QueryableCreator {
 	gf := gate.NewGateFactory(extprom.WrapRegistererWithPrefix("concurrent_selects_", reg), maxConcurrentSelects, gate.Selects)
+	var o queryableCreatorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	return func(
 		deduplicate bool,
 		replicaLabels []string,
 		storeDebugMatchers [][]*labels.Matcher,
 		maxResolutionMillis int64,
+		stitchWindowMillis int64,
 		partialResponse,
 		skipChunks bool,
 		shardInfo *storepb.ShardInfo,
@@ -85,6 +109,7 @@ func NewQueryableCreator(
 			proxy:               proxy,
 			deduplicate:         deduplicate,
 			maxResolutionMillis: maxResolutionMillis,
+			stitchWindowMillis:  stitchWindowMillis,
 			partialResponse:     partialResponse,
 			skipChunks:          skipChunks,
 			gateProviderFn: func() gate.Gate {
@@ -94,6 +119,7 @@ func NewQueryableCreator(
 			selectTimeout:        selectTimeout,
 			shardInfo:            shardInfo,
 			seriesStatsReporter:  seriesStatsReporter,
+			aggregationPushdown:  o.aggregationPushdown,
 		}
 	}
 }
@@ -105,6 +131,7 @@ type queryable struct {
 	proxy                storepb.StoreServer
 	deduplicate          bool
 	maxResolutionMillis  int64
+	stitchWindowMillis   int64
 	partialResponse      bool
 	skipChunks           bool
 	gateProviderFn       func() gate.Gate
@@ -112,11 +139,14 @@ type queryable struct {
 	selectTimeout        time.Duration
 	shardInfo            *storepb.ShardInfo
 	seriesStatsReporter  seriesStatsReporter
+	aggregationPushdown  bool
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.partialResponse, q.skipChunks, q.gateProviderFn(), q.selectTimeout, q.shardInfo, q.seriesStatsReporter), nil
+	qr := newQuerier(q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.stitchWindowMillis, q.partialResponse, q.skipChunks, q.gateProviderFn(), q.selectTimeout, q.shardInfo, q.seriesStatsReporter)
+	qr.aggregationPushdown = q.aggregationPushdown
+	return qr, nil
 }
 
 type querier struct {
@@ -127,12 +157,14 @@ type querier struct {
 	proxy                   storepb.StoreServer
 	deduplicate             bool
 	maxResolutionMillis     int64
+	stitchWindowMillis      int64
 	partialResponseStrategy storepb.PartialResponseStrategy
 	skipChunks              bool
 	selectGate              gate.Gate
 	selectTimeout           time.Duration
 	shardInfo               *storepb.ShardInfo
 	seriesStatsReporter     seriesStatsReporter
+	aggregationPushdown     bool
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -146,6 +178,7 @@ func newQuerier(
 	proxy storepb.StoreServer,
 	deduplicate bool,
 	maxResolutionMillis int64,
+	stitchWindowMillis int64,
 	partialResponse,
 	skipChunks bool,
 	selectGate gate.Gate,
@@ -177,6 +210,7 @@ func newQuerier(
 		proxy:                   proxy,
 		deduplicate:             deduplicate,
 		maxResolutionMillis:     maxResolutionMillis,
+		stitchWindowMillis:      stitchWindowMillis,
 		partialResponseStrategy: partialResponseStrategy,
 		skipChunks:              skipChunks,
 		shardInfo:               shardInfo,
@@ -241,6 +275,28 @@ func aggrsFromFunc(f string) []storepb.Aggr {
 	return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}
 }
 
+// aggregationHintFromSelectHints returns the aggregation hint of the aggregation surrounding a series selection, if
+// stores can evaluate it instead of the PromQL engine, i.e. if it's a sum, min or max by labels of an instant vector
+// selector. The engine still evaluates the aggregation, over the aggregated series, which gives the same results for
+// those only: e.g. the count of aggregated counts would be 1.
+func aggregationHintFromSelectHints(hints *storage.SelectHints) *storepb.AggregationHint {
+	if hints.Range != 0 || !hints.By || len(hints.Grouping) == 0 {
+		return nil
+	}
+	var f storepb.Aggr
+	switch hints.Func {
+	case "sum":
+		f = storepb.Aggr_SUM
+	case "min":
+		f = storepb.Aggr_MIN
+	case "max":
+		f = storepb.Aggr_MAX
+	default:
+		return nil
+	}
+	return &storepb.AggregationHint{Func: f, By: hints.Grouping}
+}
+
 func (q *querier) Select(ctx context.Context, _ bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
 	if hints == nil {
 		hints = &storage.SelectHints{
@@ -342,34 +398,97 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 		// Soft ask to sort without replica labels and push them at the end of labelset.
 		req.WithoutReplicaLabels = q.replicaLabels
 	}
+	// Series of the same group sharded across requests can't be aggregated by stores.
+	if q.aggregationPushdown && q.maxResolutionMillis > 0 && !q.skipChunks && q.shardInfo == nil {
+		req.AggregationHint = aggregationHintFromSelectHints(hints)
+	}
 
 	if err := q.proxy.Series(&req, resp); err != nil {
 		return nil, storepb.SeriesStatsCounter{}, errors.Wrap(err, "proxy Series()")
 	}
 	warns := annotations.New().Merge(resp.warnings)
 
+	var (
+		set   storepb.SeriesSet = newStoreSeriesSet(resp.seriesSet)
+		raw   storepb.SeriesSet
+		stats = resp.seriesSetStats
+	)
+	// Downsampled data ends at the boundary with raw data. Raw data is queried for the window before the boundary,
+	// so that series are stitched with their samples at the highest resolution around it.
+	// Aggregated series can't be stitched with raw series, whose labels differ.
+	var (
+		stitchT int64
+		ok      bool
+	)
+	if req.AggregationHint == nil {
+		stitchT, ok = q.stitchTime(resp.seriesSet, hints)
+	}
+	if ok {
+		rawResp := &seriesServer{ctx: ctx, seriesSetStats: resp.seriesSetStats}
+		rawReq := req
+		rawReq.MinTime = stitchT
+		rawReq.MaxResolutionWindow = 0
+		if err := q.proxy.Series(&rawReq, rawResp); err != nil {
+			return nil, storepb.SeriesStatsCounter{}, errors.Wrap(err, "proxy Series() for raw data")
+		}
+		warns.Merge(rawResp.warnings)
+		raw, stats = newStoreSeriesSet(rawResp.seriesSet), rawResp.seriesSetStats
+	}
+
 	if !q.isDedupEnabled() {
+		if raw != nil {
+			return newStitchedSeriesSet(set, raw, stitchT, q.mint, q.maxt, aggrs, warns), stats, nil
+		}
 		return NewPromSeriesSet(
-			newStoreSeriesSet(resp.seriesSet),
+			set,
 			q.mint,
 			q.maxt,
 			aggrs,
 			warns,
-		), resp.seriesSetStats, nil
+		), stats, nil
 	}
 
 	// TODO(bwplotka): Move to deduplication on chunk level inside promSeriesSet, similar to what we have in dedup.NewDedupChunkMerger().
 	// This however require big refactor, caring about correct AggrChunk to iterator conversion and counter reset apply.
 	// For now we apply simple logic that splits potential overlapping chunks into separate replica series, so we can split the work.
-	set := NewPromSeriesSet(
-		dedup.NewOverlapSplit(newStoreSeriesSet(resp.seriesSet)),
-		q.mint,
-		q.maxt,
-		aggrs,
-		warns,
-	)
+	var promSet storage.SeriesSet
+	if raw != nil {
+		promSet = newStitchedSeriesSet(dedup.NewOverlapSplit(set), dedup.NewOverlapSplit(raw), stitchT, q.mint, q.maxt, aggrs, warns)
+	} else {
+		promSet = NewPromSeriesSet(
+			dedup.NewOverlapSplit(set),
+			q.mint,
+			q.maxt,
+			aggrs,
+			warns,
+		)
+	}
+
+	return dedup.NewSeriesSet(promSet, hints.Func), stats, nil
+}
+
+// stitchTime returns the time from which series are stitched with raw data, if downsampled data ends in the
+// selected range and stitching is enabled.
+func (q *querier) stitchTime(series []storepb.Series, hints *storage.SelectHints) (int64, bool) {
+	if q.stitchWindowMillis <= 0 || q.maxResolutionMillis <= 0 || q.skipChunks {
+		return 0, false
+	}
 
-	return dedup.NewSeriesSet(set, hints.Func), resp.seriesSetStats, nil
+	var (
+		end int64
+		ok  bool
+	)
+	for _, s := range series {
+		for _, c := range s.Chunks {
+			if c.Raw == nil && (!ok || c.MaxTime > end) {
+				end, ok = c.MaxTime, true
+			}
+		}
+	}
+	if !ok || end >= hints.End {
+		return 0, false
+	}
+	return max(end-q.stitchWindowMillis, hints.Start), true
 }
 
 // LabelValues returns all potential values for a label name.
@@ -53,6 +53,7 @@ func TestQueryableCreator_MaxResolution(t *testing.T) {
 		nil,
 		nil,
 		oneHourMillis,
+		0,
 		false,
 		false,
 		nil,
@@ -94,6 +95,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 		nil,
 		nil,
 		9999999,
+		0,
 		false,
 		false,
 		nil,
@@ -393,7 +395,7 @@ func TestQuerier_Select_AfterPromQL(t *testing.T) {
 						g := gate.New(2)
 						mq := &mockedQueryable{
 							Creator: func(mint, maxt int64) storage.Querier {
-								return newQuerier(nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
+								return newQuerier(nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
 							},
 						}
 						t.Cleanup(func() {
@@ -780,6 +782,7 @@ func TestQuerier_Select(t *testing.T) {
 					newProxyStore(tcase.storeEndpoints...),
 					sc.dedup,
 					0,
+					0,
 					true,
 					false,
 					g,
@@ -1075,7 +1078,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 100 * time.Second
 		g := gate.New(2)
-		q := newQuerier(logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, newProxyStore(s), false, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
+		q := newQuerier(logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, newProxyStore(s), false, 0, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -1145,7 +1148,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 5 * time.Second
 		g := gate.New(2)
-		q := newQuerier(logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, newProxyStore(s), true, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
+		q := newQuerier(logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, newProxyStore(s), true, 0, 0, true, false, g, timeout, nil, NoopSeriesStatsReporter)
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -1268,3 +1271,163 @@ func storeSeriesResponse(t testing.TB, lset labels.Labels, smplChunks ...[]sampl
 	}
 	return storepb.NewSeriesResponse(&s)
 }
+
+// resolutionStoreServer serves downsampled series to requests allowing downsampled data, and raw series to the others.
+type resolutionStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	downsampled, raw         []*storepb.SeriesResponse
+	downsampledReqs, rawReqs []*storepb.SeriesRequest
+}
+
+func (s *resolutionStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	resps := s.downsampled
+	if r.MaxResolutionWindow > 0 {
+		s.downsampledReqs = append(s.downsampledReqs, r)
+	}
+	if r.MaxResolutionWindow == 0 {
+		s.rawReqs = append(s.rawReqs, r)
+		resps = s.raw
+	}
+	for _, resp := range resps {
+		if err := srv.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downsampledChunk creates a chunk with the sum and count aggregates of the given samples, each one aggregating two samples.
+func downsampledChunk(t testing.TB, smpls []sample) storepb.AggrChunk {
+	sum, count := chunkenc.NewXORChunk(), chunkenc.NewXORChunk()
+	sumApp, err := sum.Appender()
+	testutil.Ok(t, err)
+	countApp, err := count.Appender()
+	testutil.Ok(t, err)
+	for _, smpl := range smpls {
+		sumApp.Append(smpl.t, 2*smpl.v)
+		countApp.Append(smpl.t, 2)
+	}
+	return storepb.AggrChunk{
+		MinTime: smpls[0].t,
+		MaxTime: smpls[len(smpls)-1].t,
+		Sum:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: sum.Bytes()},
+		Count:   &storepb.Chunk{Type: storepb.Chunk_XOR, Data: count.Bytes()},
+	}
+}
+
+func TestQuerier_StitchResolutions(t *testing.T) {
+	stitched := labels.FromStrings("__name__", "a", "series", "stitched")
+	downsampled := storeSeriesResponse(t, stitched, []sample{{250, 25}, {300, 30}})
+	downsampled.GetSeries().Chunks = append([]storepb.AggrChunk{downsampledChunk(t, []sample{{0, 1}, {100, 2}, {200, 3}})}, downsampled.GetSeries().Chunks...)
+	downsampledOnly := storeSeriesResponse(t, labels.FromStrings("__name__", "a", "series", "downsampled"))
+	downsampledOnly.GetSeries().Chunks = []storepb.AggrChunk{downsampledChunk(t, []sample{{100, 4}, {200, 5}})}
+
+	newStore := func() *resolutionStoreServer {
+		return &resolutionStoreServer{
+			downsampled: []*storepb.SeriesResponse{downsampledOnly, downsampled},
+			raw: []*storepb.SeriesResponse{
+				storeSeriesResponse(t, labels.FromStrings("__name__", "a", "series", "raw"), []sample{{200, 7}, {300, 8}}),
+				storeSeriesResponse(t, stitched, []sample{{120, 12}, {160, 16}, {200, 20}, {250, 25}, {300, 30}}),
+			},
+		}
+	}
+	selectSeries := func(t *testing.T, st *resolutionStoreServer, stitchWindowMillis int64, dedup bool) map[string][]sample {
+		q := newQuerier(nil, 0, 300, []string{"replica"}, nil, newProxyStore(st), dedup, 10, stitchWindowMillis, false, false, gate.New(2), 10*time.Second, nil, NoopSeriesStatsReporter)
+		t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+		res := map[string][]sample{}
+		set := q.Select(context.Background(), false, &storage.SelectHints{Start: 0, End: 300}, labels.MustNewMatcher(labels.MatchEqual, "__name__", "a"))
+		for set.Next() {
+			res[set.At().Labels().Get("series")] = expandSeries(t, set.At().Iterator(nil))
+		}
+		testutil.Ok(t, set.Err())
+		return res
+	}
+
+	for _, dedup := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dedup=%v", dedup), func(t *testing.T) {
+			st := newStore()
+			// Raw data is not queried if stitching is disabled.
+			testutil.Equals(t, map[string][]sample{
+				"downsampled": {{100, 4}, {200, 5}},
+				"stitched":    {{0, 1}, {100, 2}, {200, 3}, {250, 25}, {300, 30}},
+			}, selectSeries(t, st, 0, dedup))
+			testutil.Equals(t, 0, len(st.rawReqs))
+
+			// Raw data is used instead of downsampled data from the stitch window before the end of downsampled data.
+			testutil.Equals(t, map[string][]sample{
+				"downsampled": {{100, 4}, {200, 5}},
+				"raw":         {{200, 7}, {300, 8}},
+				"stitched":    {{0, 1}, {100, 2}, {160, 16}, {200, 20}, {250, 25}, {300, 30}},
+			}, selectSeries(t, st, 50, dedup))
+			testutil.Equals(t, 1, len(st.rawReqs))
+			testutil.Equals(t, int64(150), st.rawReqs[0].MinTime)
+			testutil.Equals(t, int64(300), st.rawReqs[0].MaxTime)
+		})
+	}
+}
+
+func TestQuerier_AggregationPushdown(t *testing.T) {
+	downsampled := storeSeriesResponse(t, labels.FromStrings("__name__", "a", "cluster", "a"))
+	downsampled.GetSeries().Chunks = []storepb.AggrChunk{downsampledChunk(t, []sample{{0, 1}, {100, 2}, {200, 3}})}
+	raw := storeSeriesResponse(t, labels.FromStrings("__name__", "a", "cluster", "a"), []sample{{200, 7}, {300, 8}})
+
+	for _, tc := range []struct {
+		name                string
+		aggregationPushdown bool
+		hints               *storage.SelectHints
+
+		expectedHint *storepb.AggregationHint
+	}{
+		{
+			name:         "sum by",
+			hints:        &storage.SelectHints{Start: 0, End: 300, Func: "sum", By: true, Grouping: []string{"cluster"}},
+			expectedHint: &storepb.AggregationHint{Func: storepb.Aggr_SUM, By: []string{"cluster"}},
+		},
+		{
+			name:         "max by",
+			hints:        &storage.SelectHints{Start: 0, End: 300, Func: "max", By: true, Grouping: []string{"cluster"}},
+			expectedHint: &storepb.AggregationHint{Func: storepb.Aggr_MAX, By: []string{"cluster"}},
+		},
+		{
+			name:  "sum without",
+			hints: &storage.SelectHints{Start: 0, End: 300, Func: "sum", Grouping: []string{"cluster"}},
+		},
+		{
+			name:  "count by",
+			hints: &storage.SelectHints{Start: 0, End: 300, Func: "count", By: true, Grouping: []string{"cluster"}},
+		},
+		{
+			name:  "range function",
+			hints: &storage.SelectHints{Start: 0, End: 300, Func: "max_over_time", Range: 100, By: true, Grouping: []string{"cluster"}},
+		},
+	} {
+		for _, enabled := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/enabled=%v", tc.name, enabled), func(t *testing.T) {
+				st := &resolutionStoreServer{downsampled: []*storepb.SeriesResponse{downsampled}, raw: []*storepb.SeriesResponse{raw}}
+				queryable := NewQueryableCreator(nil, nil, newProxyStore(st), 2, 10*time.Second, WithAggregationPushdown(enabled))(
+					false, nil, nil, 10, 50, false, false, nil, NoopSeriesStatsReporter,
+				)
+				q, err := queryable.Querier(0, 300)
+				testutil.Ok(t, err)
+				t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+				set := q.Select(context.Background(), false, tc.hints, labels.MustNewMatcher(labels.MatchEqual, "__name__", "a"))
+				for set.Next() {
+				}
+				testutil.Ok(t, set.Err())
+
+				testutil.Equals(t, 1, len(st.downsampledReqs))
+				if !enabled {
+					testutil.Assert(t, st.downsampledReqs[0].AggregationHint == nil)
+					return
+				}
+				testutil.Equals(t, tc.expectedHint, st.downsampledReqs[0].AggregationHint)
+				// Aggregated series aren't stitched with raw series.
+				testutil.Equals(t, tc.expectedHint == nil, len(st.rawReqs) == 1)
+			})
+		}
+	}
+}
@@ -92,6 +92,7 @@ func benchQuerySelect(t testutil.TB, totalSamples, totalSeries int, dedup bool)
 		newProxyStore(&mockedStoreServer{responses: resps}),
 		dedup,
 		0,
+		0,
 		false,
 		false,
 		gate.NewNoop(),
@@ -85,6 +85,7 @@ func TestQuerier_Proxy(t *testing.T) {
 				nil,
 				nil,
 				0,
+				0,
 				false,
 				false,
 				nil,
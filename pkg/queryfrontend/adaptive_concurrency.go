@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+// AdaptiveConcurrencyConfig holds the config of the adaptive concurrency limit of downstream requests.
+type AdaptiveConcurrencyConfig struct {
+	// MinConcurrency is the lowest concurrency limit.
+	MinConcurrency int
+	// MaxConcurrency is the highest, and initial, concurrency limit. 0 disables adaptive concurrency.
+	MaxConcurrency int
+	// LatencyThreshold is the latency above which downstream requests are considered overloaded. 0 disables it.
+	LatencyThreshold time.Duration
+}
+
+// Enabled returns true if adaptive concurrency is configured.
+func (cfg AdaptiveConcurrencyConfig) Enabled() bool {
+	return cfg.MaxConcurrency > 0
+}
+
+// Validate validates the adaptive concurrency config.
+func (cfg AdaptiveConcurrencyConfig) Validate() error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.MinConcurrency < 1 || cfg.MinConcurrency > cfg.MaxConcurrency {
+		return errors.Errorf("minimum downstream concurrency must be between 1 and the maximum downstream concurrency %d, got %d", cfg.MaxConcurrency, cfg.MinConcurrency)
+	}
+	if cfg.LatencyThreshold < 0 {
+		return errors.Errorf("downstream latency threshold must not be negative, got %v", cfg.LatencyThreshold)
+	}
+	return nil
+}
+
+// AdaptiveConcurrencyLimiter limits the number of concurrent downstream requests with a gate.Adaptive limit, which
+// is decreased by requests which failed, were rejected by the downstream, or were slower than the latency threshold.
+type AdaptiveConcurrencyLimiter struct {
+	cfg   AdaptiveConcurrencyConfig
+	limit *gate.Adaptive
+}
+
+// NewAdaptiveConcurrencyLimiter returns a new AdaptiveConcurrencyLimiter, starting with the maximum concurrency limit.
+func NewAdaptiveConcurrencyLimiter(cfg AdaptiveConcurrencyConfig, reg prometheus.Registerer) *AdaptiveConcurrencyLimiter {
+	return &AdaptiveConcurrencyLimiter{
+		cfg:   cfg,
+		limit: gate.NewAdaptive(reg, "thanos_query_frontend_downstream", "downstream requests", cfg.MinConcurrency, cfg.MaxConcurrency),
+	}
+}
+
+// Wrap returns a round tripper sending requests to next within the concurrency limit.
+func (l *AdaptiveConcurrencyLimiter) Wrap(next http.RoundTripper) http.RoundTripper {
+	return adaptiveConcurrencyRoundTripper{limiter: l, next: next}
+}
+
+type adaptiveConcurrencyRoundTripper struct {
+	limiter *AdaptiveConcurrencyLimiter
+	next    http.RoundTripper
+}
+
+func (rt adaptiveConcurrencyRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	done, err := rt.limiter.limit.Start(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(r)
+	done(rt.limiter.overloaded(resp, err, time.Since(start)))
+	return resp, err
+}
+
+// overloaded returns true if the outcome of the downstream request tells that the downstream is overloaded.
+func (l *AdaptiveConcurrencyLimiter) overloaded(resp *http.Response, err error, latency time.Duration) bool {
+	if err != nil {
+		// Requests canceled by clients don't tell anything about the downstream.
+		return !errors.Is(err, context.Canceled)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return l.cfg.LatencyThreshold > 0 && latency > l.cfg.LatencyThreshold
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveConcurrencyLimiter) Limit() int {
+	return l.limit.Limit()
+}
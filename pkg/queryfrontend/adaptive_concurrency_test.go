@@ -0,0 +1,86 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAdaptiveConcurrencyConfigValidate(t *testing.T) {
+	for _, tcase := range []struct {
+		cfg   AdaptiveConcurrencyConfig
+		valid bool
+	}{
+		{cfg: AdaptiveConcurrencyConfig{}, valid: true},
+		{cfg: AdaptiveConcurrencyConfig{MinConcurrency: 1, MaxConcurrency: 10, LatencyThreshold: time.Second}, valid: true},
+		{cfg: AdaptiveConcurrencyConfig{MinConcurrency: 0, MaxConcurrency: 10}},
+		{cfg: AdaptiveConcurrencyConfig{MinConcurrency: 11, MaxConcurrency: 10}},
+		{cfg: AdaptiveConcurrencyConfig{MinConcurrency: 1, MaxConcurrency: 10, LatencyThreshold: -time.Second}},
+	} {
+		err := tcase.cfg.Validate()
+		testutil.Equals(t, tcase.valid, err == nil, "%+v: %v", tcase.cfg, err)
+	}
+}
+
+func TestAdaptiveConcurrencyLimiterOverloaded(t *testing.T) {
+	l := NewAdaptiveConcurrencyLimiter(AdaptiveConcurrencyConfig{MinConcurrency: 2, MaxConcurrency: 8, LatencyThreshold: time.Minute}, prometheus.NewRegistry())
+	testutil.Equals(t, 8, l.Limit())
+
+	resp := func(code int) *http.Response { return &http.Response{StatusCode: code} }
+	for _, tcase := range []struct {
+		resp       *http.Response
+		err        error
+		latency    time.Duration
+		overloaded bool
+	}{
+		{resp: resp(http.StatusOK), latency: time.Second},
+		{resp: resp(http.StatusBadRequest), latency: time.Second},
+		{resp: resp(http.StatusOK), latency: 2 * time.Minute, overloaded: true},
+		{resp: resp(http.StatusTooManyRequests), latency: time.Second, overloaded: true},
+		{resp: resp(http.StatusServiceUnavailable), latency: time.Second, overloaded: true},
+		{err: errors.New("connection refused"), latency: time.Second, overloaded: true},
+		// Requests canceled by clients don't tell anything about the downstream.
+		{err: errors.Wrap(context.Canceled, "round trip"), latency: time.Second},
+	} {
+		testutil.Equals(t, tcase.overloaded, l.overloaded(tcase.resp, tcase.err, tcase.latency), "%+v", tcase)
+	}
+}
+
+func TestAdaptiveConcurrencyRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/overloaded" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	l := NewAdaptiveConcurrencyLimiter(AdaptiveConcurrencyConfig{MinConcurrency: 1, MaxConcurrency: 4}, reg)
+	client := &http.Client{Transport: l.Wrap(http.DefaultTransport)}
+
+	for _, path := range []string{"/", "/overloaded"} {
+		resp, err := client.Get(srv.URL + path)
+		testutil.Ok(t, err)
+		testutil.Ok(t, resp.Body.Close())
+	}
+	testutil.Equals(t, 2, l.Limit())
+	testutil.Ok(t, promtestutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_query_frontend_downstream_concurrency_limit The current limit of concurrent downstream requests.
+# TYPE thanos_query_frontend_downstream_concurrency_limit gauge
+thanos_query_frontend_downstream_concurrency_limit 2
+# HELP thanos_query_frontend_downstream_inflight_requests The number of downstream requests in flight.
+# TYPE thanos_query_frontend_downstream_inflight_requests gauge
+thanos_query_frontend_downstream_inflight_requests 0
+`), "thanos_query_frontend_downstream_concurrency_limit", "thanos_query_frontend_downstream_inflight_requests"))
+}
@@ -0,0 +1,276 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/extpromql"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+const (
+	defaultCanaryInterval = model.Duration(time.Minute)
+	defaultCanaryStep     = model.Duration(time.Minute)
+
+	// canaryUserAgent is the User-Agent of the canary queries, to tell them apart from the queries of users.
+	canaryUserAgent = "thanos-query-frontend-canary"
+)
+
+// CanaryQueriesConfig holds the canary queries periodically executed by the query-frontend, through all its
+// middlewares, to monitor the query path.
+type CanaryQueriesConfig struct {
+	// Interval is the interval the canary queries are executed at. Defaults to 1m.
+	Interval model.Duration `yaml:"interval"`
+	// Timeout is the timeout of each canary query. Defaults to the interval.
+	Timeout model.Duration `yaml:"timeout"`
+	// Queries are the canary queries.
+	Queries []CanaryQuery `yaml:"queries"`
+}
+
+// CanaryQuery is a query executed by the canary prober.
+type CanaryQuery struct {
+	// Name identifies the query in the metrics of the prober. It must be unique.
+	Name string `yaml:"name"`
+	// Query is the PromQL query.
+	Query string `yaml:"query"`
+	// Range makes the query a range query over the last range, instead of an instant query.
+	Range model.Duration `yaml:"range"`
+	// Step is the step of range queries. Defaults to 1m.
+	Step model.Duration `yaml:"step"`
+	// Tenant is the tenant the query is executed for. Defaults to the default tenant of the query-frontend.
+	Tenant string `yaml:"tenant"`
+	// Headers are additional HTTP headers of the query, e.g. to select the datasource.
+	Headers map[string]string `yaml:"headers"`
+	// ExpectResults fails the query if it returns an empty result.
+	ExpectResults bool `yaml:"expect_results"`
+}
+
+// ParseCanaryQueriesConfig parses and validates the YAML canary queries config.
+func ParseCanaryQueriesConfig(content []byte) (*CanaryQueriesConfig, error) {
+	cfg := &CanaryQueriesConfig{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing canary queries config YAML")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultCanaryInterval
+	}
+	if cfg.Interval < 0 {
+		return nil, errors.Errorf("interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.Timeout < 0 {
+		return nil, errors.Errorf("timeout must be positive, got %v", cfg.Timeout)
+	}
+
+	names := map[string]struct{}{}
+	for i := range cfg.Queries {
+		q := &cfg.Queries[i]
+		if q.Name == "" {
+			return nil, errors.Errorf("canary query %d has no name", i)
+		}
+		if _, ok := names[q.Name]; ok {
+			return nil, errors.Errorf("duplicate canary query name %q", q.Name)
+		}
+		names[q.Name] = struct{}{}
+
+		if _, err := extpromql.ParseExpr(q.Query); err != nil {
+			return nil, errors.Wrapf(err, "canary query %q", q.Name)
+		}
+		if q.Range < 0 || q.Step < 0 {
+			return nil, errors.Errorf("canary query %q: range and step must be positive", q.Name)
+		}
+		if q.Range > 0 && q.Step == 0 {
+			q.Step = defaultCanaryStep
+		}
+	}
+	return cfg, nil
+}
+
+// CanaryProber periodically executes the canary queries against a handler, usually the query-frontend handler with
+// all its middlewares, and exports the outcome and latency of each query as metrics.
+type CanaryProber struct {
+	logger        log.Logger
+	cfg           *CanaryQueriesConfig
+	handler       http.Handler
+	tenantHeader  string
+	defaultTenant string
+
+	queries     *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	success     *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+}
+
+// NewCanaryProber returns a CanaryProber executing the configured queries against the given handler. The tenant of
+// the queries is set with the given tenant header.
+func NewCanaryProber(logger log.Logger, reg prometheus.Registerer, cfg *CanaryQueriesConfig, handler http.Handler, tenantHeader, defaultTenant string) *CanaryProber {
+	if tenantHeader == "" {
+		tenantHeader = tenancy.DefaultTenantHeader
+	}
+	return &CanaryProber{
+		logger:        logger,
+		cfg:           cfg,
+		handler:       handler,
+		tenantHeader:  tenantHeader,
+		defaultTenant: defaultTenant,
+		queries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_canary_queries_total",
+			Help: "Total number of canary queries executed.",
+		}, []string{"name"}),
+		failures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_canary_query_failures_total",
+			Help: "Total number of canary queries which failed.",
+		}, []string{"name"}),
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_query_frontend_canary_query_duration_seconds",
+			Help:    "Duration of the canary queries.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"name"}),
+		success: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_query_frontend_canary_query_success",
+			Help: "Whether the last execution of the canary query succeeded.",
+		}, []string{"name"}),
+		lastSuccess: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_query_frontend_canary_query_last_success_timestamp_seconds",
+			Help: "Timestamp of the last successful execution of the canary query.",
+		}, []string{"name"}),
+	}
+}
+
+// Run executes the canary queries at each interval until the context is canceled.
+func (p *CanaryProber) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(p.cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		p.ProbeAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll executes all the canary queries concurrently and waits for them.
+func (p *CanaryProber) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, q := range p.cfg.Queries {
+		wg.Add(1)
+		go func(q CanaryQuery) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := p.probe(ctx, q)
+			if ctx.Err() != nil {
+				// Shutting down, the outcome doesn't tell anything about the query path.
+				return
+			}
+
+			p.queries.WithLabelValues(q.Name).Inc()
+			p.duration.WithLabelValues(q.Name).Observe(time.Since(start).Seconds())
+			if err != nil {
+				level.Warn(p.logger).Log("msg", "canary query failed", "name", q.Name, "query", q.Query, "err", err)
+				p.failures.WithLabelValues(q.Name).Inc()
+				p.success.WithLabelValues(q.Name).Set(0)
+				return
+			}
+			p.success.WithLabelValues(q.Name).Set(1)
+			p.lastSuccess.WithLabelValues(q.Name).SetToCurrentTime()
+		}(q)
+	}
+	wg.Wait()
+}
+
+func (p *CanaryProber) probe(ctx context.Context, q CanaryQuery) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.cfg.Timeout))
+	defer cancel()
+
+	now := time.Now()
+	params := url.Values{"query": []string{q.Query}}
+	path := "/api/v1/query"
+	if q.Range > 0 {
+		path = "/api/v1/query_range"
+		params.Set("start", formatCanaryTime(now.Add(-time.Duration(q.Range))))
+		params.Set("end", formatCanaryTime(now))
+		params.Set("step", strconv.FormatFloat(time.Duration(q.Step).Seconds(), 'f', -1, 64))
+	} else {
+		params.Set("time", formatCanaryTime(now))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path+"?"+params.Encode(), nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.RequestURI = req.URL.RequestURI()
+	req.Header.Set("User-Agent", canaryUserAgent)
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+	tenant := q.Tenant
+	if tenant == "" {
+		tenant = p.defaultTenant
+	}
+	if tenant != "" {
+		req.Header.Set(p.tenantHeader, tenant)
+	}
+
+	rec := httptest.NewRecorder()
+	p.handler.ServeHTTP(rec, req)
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "query timed out")
+	}
+	if rec.Code != http.StatusOK {
+		return errors.Errorf("unexpected status code %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		return errors.Wrap(err, "decode response")
+	}
+	if resp.Status != "success" {
+		return errors.Errorf("query failed: %s", resp.Error)
+	}
+	if q.ExpectResults {
+		// Scalar and string results are [time, value] pairs: they are never empty.
+		var result []json.RawMessage
+		if err := json.Unmarshal(resp.Data.Result, &result); err != nil {
+			return errors.Wrap(err, "decode result")
+		}
+		if len(result) == 0 {
+			return errors.New("query returned no results")
+		}
+	}
+	return nil
+}
+
+func formatCanaryTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1e3, 'f', -1, 64)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestParseCanaryQueriesConfig(t *testing.T) {
+	cfg, err := ParseCanaryQueriesConfig([]byte(`
+queries:
+  - name: up
+    query: up
+  - name: up_range
+    query: sum(up)
+    range: 1h
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, defaultCanaryInterval, cfg.Interval)
+	testutil.Equals(t, defaultCanaryInterval, cfg.Timeout)
+	testutil.Equals(t, model.Duration(0), cfg.Queries[0].Step)
+	testutil.Equals(t, defaultCanaryStep, cfg.Queries[1].Step)
+
+	for _, content := range []string{
+		"queries: [{query: up}]",
+		"queries: [{name: up, query: up}, {name: up, query: up}]",
+		"queries: [{name: up, query: 'up{'}]",
+		"queries: [{name: up, query: up, range: -1h}]",
+		"interval: -1m",
+		"unknown: true",
+	} {
+		_, err := ParseCanaryQueriesConfig([]byte(content))
+		testutil.NotOk(t, err, content)
+	}
+}
+
+func TestCanaryProber(t *testing.T) {
+	var (
+		paths   = make(chan string, 10)
+		tenants = make(chan string, 10)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		tenants <- r.Header.Get(tenancy.DefaultTenantHeader)
+		testutil.Equals(t, canaryUserAgent, r.Header.Get("User-Agent"))
+
+		switch r.URL.Query().Get("query") {
+		case "up":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1,"1"]}]}}`))
+		case "absent":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","error":"bad query"}`))
+		}
+	})
+
+	cfg, err := ParseCanaryQueriesConfig([]byte(`
+timeout: 10s
+queries:
+  - name: up
+    query: up
+    range: 1h
+    tenant: acme
+    expect_results: true
+  - name: absent
+    query: absent
+    expect_results: true
+  - name: bad
+    query: bad
+`))
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	p := NewCanaryProber(log.NewNopLogger(), reg, cfg, handler, "", "default-tenant")
+	p.ProbeAll(context.Background())
+	close(paths)
+	close(tenants)
+
+	var gotPaths, gotTenants []string
+	for path := range paths {
+		gotPaths = append(gotPaths, path)
+	}
+	for tenant := range tenants {
+		gotTenants = append(gotTenants, tenant)
+	}
+	testutil.Equals(t, 3, len(gotPaths))
+	testutil.Assert(t, slices.Contains(gotPaths, "/api/v1/query_range") && slices.Contains(gotPaths, "/api/v1/query"), "got %v", gotPaths)
+	testutil.Assert(t, slices.Contains(gotTenants, "acme") && slices.Contains(gotTenants, "default-tenant"), "got %v", gotTenants)
+
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(p.success.WithLabelValues("up")))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(p.success.WithLabelValues("absent")))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(p.success.WithLabelValues("bad")))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(p.failures.WithLabelValues("up")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(p.failures.WithLabelValues("bad")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(p.queries.WithLabelValues("bad")))
+	testutil.Assert(t, promtestutil.ToFloat64(p.lastSuccess.WithLabelValues("up")) > float64(time.Now().Add(-time.Minute).Unix()))
+}
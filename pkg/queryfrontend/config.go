@@ -199,6 +199,7 @@ type Config struct {
 	QueryRangeConfig
 	LabelsConfig
 	DownstreamTripperConfig
+	AdaptiveConcurrency AdaptiveConcurrencyConfig
 
 	CortexHandlerConfig    *transport.HandlerConfig
 	CompressResponses      bool
@@ -211,6 +212,15 @@ type Config struct {
 	DefaultTenant          string
 	TenantCertField        string
 	EnableXFunctions       bool
+
+	QueryAttributes              *QueryAttributesConfig
+	QueryAttributesPathOrContent extflag.PathOrContent
+
+	HeaderPolicy              *HeaderPolicyConfig
+	HeaderPolicyPathOrContent extflag.PathOrContent
+
+	// DownstreamRequestEncoding is the encoding of the parameters of the POST requests sent downstream.
+	DownstreamRequestEncoding RequestEncoding
 }
 
 // QueryRangeConfig holds the config for query range tripperware.
@@ -250,6 +260,12 @@ type LabelsConfig struct {
 
 // Validate a fully initialized config.
 func (cfg *Config) Validate() error {
+	switch cfg.DownstreamRequestEncoding {
+	case "", FormRequestEncoding, JSONRequestEncoding:
+	default:
+		return errors.Errorf("invalid downstream request encoding %q", cfg.DownstreamRequestEncoding)
+	}
+
 	if cfg.QueryRangeConfig.ResultsCacheConfig != nil {
 		if cfg.QueryRangeConfig.SplitQueriesByInterval <= 0 && !cfg.isDynamicSplitSet() {
 			return errors.New("split queries or split threshold interval should be greater than 0 when caching is enabled")
@@ -287,6 +303,10 @@ func (cfg *Config) Validate() error {
 		return errors.New("downstream URL should be configured")
 	}
 
+	if err := cfg.AdaptiveConcurrency.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
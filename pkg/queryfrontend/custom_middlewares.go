@@ -0,0 +1,138 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+// MiddlewareSlot is a named position in the query-frontend tripperware chains custom middlewares can be inserted at.
+type MiddlewareSlot string
+
+const (
+	// SlotFrontend wraps all the tripperwares, before the tenancy conversion and query attribute policies
+	// are applied. Only tripperwares can be registered at this slot, see RegisterTripperware.
+	SlotFrontend MiddlewareSlot = "frontend"
+
+	// SlotQueryRangeFirst is the first position of the range query chain, right after limits are applied.
+	SlotQueryRangeFirst MiddlewareSlot = "query_range_first"
+	// SlotQueryRangeBeforeCache is the position of the range query chain right before the results cache,
+	// after the queries were split and sharded.
+	SlotQueryRangeBeforeCache MiddlewareSlot = "query_range_before_cache"
+	// SlotQueryRangeLast is the last position of the range query chain, right before the request is sent downstream.
+	SlotQueryRangeLast MiddlewareSlot = "query_range_last"
+
+	// SlotQueryInstantFirst is the first position of the instant query chain.
+	SlotQueryInstantFirst MiddlewareSlot = "query_instant_first"
+	// SlotQueryInstantLast is the last position of the instant query chain, right before the request is sent downstream.
+	SlotQueryInstantLast MiddlewareSlot = "query_instant_last"
+
+	// SlotLabelsFirst is the first position of the labels and series chain.
+	SlotLabelsFirst MiddlewareSlot = "labels_first"
+	// SlotLabelsLast is the last position of the labels and series chain, right before the request is sent downstream.
+	SlotLabelsLast MiddlewareSlot = "labels_last"
+)
+
+var middlewareSlots = map[MiddlewareSlot]struct{}{
+	SlotQueryRangeFirst:       {},
+	SlotQueryRangeBeforeCache: {},
+	SlotQueryRangeLast:        {},
+	SlotQueryInstantFirst:     {},
+	SlotQueryInstantLast:      {},
+	SlotLabelsFirst:           {},
+	SlotLabelsLast:            {},
+}
+
+// MiddlewareFactory creates a custom middleware. It is called once for every tripperware created with the slot
+// the middleware is registered at, with a registerer scoped to that tripperware and middleware.
+type MiddlewareFactory func(reg prometheus.Registerer, logger log.Logger) (queryrange.Middleware, error)
+
+// TripperwareFactory creates a custom tripperware. It is called once for every tripperware created by NewTripperware.
+type TripperwareFactory func(reg prometheus.Registerer, logger log.Logger) (queryrange.Tripperware, error)
+
+type customMiddleware struct {
+	name        string
+	middleware  MiddlewareFactory
+	tripperware TripperwareFactory
+}
+
+var customMiddlewares = struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+	slots map[MiddlewareSlot][]customMiddleware
+}{
+	names: map[string]struct{}{},
+	slots: map[MiddlewareSlot][]customMiddleware{},
+}
+
+// RegisterMiddleware registers a custom middleware with the given name at the given slot of the query-frontend
+// tripperware chains. It allows builds of Thanos to extend the query-frontend without patching it, and is meant
+// to be called from init functions. Middlewares registered at the same slot run in registration order.
+// It panics if the slot is not a middleware slot or if a custom middleware with the same name is already registered.
+func RegisterMiddleware(slot MiddlewareSlot, name string, f MiddlewareFactory) {
+	if _, ok := middlewareSlots[slot]; !ok {
+		panic(fmt.Sprintf("queryfrontend: unknown middleware slot %q for middleware %q", slot, name))
+	}
+	registerCustomMiddleware(slot, customMiddleware{name: name, middleware: f})
+}
+
+// RegisterTripperware registers a custom tripperware with the given name at the SlotFrontend slot. Tripperwares
+// registered earlier wrap the ones registered later. It panics if a custom middleware with the same name is already registered.
+func RegisterTripperware(name string, f TripperwareFactory) {
+	registerCustomMiddleware(SlotFrontend, customMiddleware{name: name, tripperware: f})
+}
+
+func registerCustomMiddleware(slot MiddlewareSlot, m customMiddleware) {
+	customMiddlewares.mu.Lock()
+	defer customMiddlewares.mu.Unlock()
+
+	if m.name == "" {
+		panic(fmt.Sprintf("queryfrontend: empty name for middleware at slot %q", slot))
+	}
+	if _, ok := customMiddlewares.names[m.name]; ok {
+		panic(fmt.Sprintf("queryfrontend: middleware %q registered twice", m.name))
+	}
+	customMiddlewares.names[m.name] = struct{}{}
+	customMiddlewares.slots[slot] = append(customMiddlewares.slots[slot], m)
+}
+
+func customMiddlewaresAt(slot MiddlewareSlot) []customMiddleware {
+	customMiddlewares.mu.Lock()
+	defer customMiddlewares.mu.Unlock()
+
+	return append([]customMiddleware(nil), customMiddlewares.slots[slot]...)
+}
+
+// newCustomMiddlewares returns the instrumented custom middlewares registered at the given slot.
+func newCustomMiddlewares(slot MiddlewareSlot, m *queryrange.InstrumentMiddlewareMetrics, reg prometheus.Registerer, logger log.Logger) ([]queryrange.Middleware, error) {
+	var middlewares []queryrange.Middleware
+	for _, cm := range customMiddlewaresAt(slot) {
+		mw, err := cm.middleware(prometheus.WrapRegistererWith(prometheus.Labels{"middleware": cm.name}, reg), log.With(logger, "middleware", cm.name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "create custom middleware %q", cm.name)
+		}
+		middlewares = append(middlewares, queryrange.InstrumentMiddleware(cm.name, m), mw)
+	}
+	return middlewares, nil
+}
+
+// newCustomTripperwares returns the custom tripperwares registered at the SlotFrontend slot.
+func newCustomTripperwares(reg prometheus.Registerer, logger log.Logger) ([]queryrange.Tripperware, error) {
+	var tripperwares []queryrange.Tripperware
+	for _, cm := range customMiddlewaresAt(SlotFrontend) {
+		tw, err := cm.tripperware(prometheus.WrapRegistererWith(prometheus.Labels{"middleware": cm.name}, reg), log.With(logger, "middleware", cm.name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "create custom tripperware %q", cm.name)
+		}
+		tripperwares = append(tripperwares, tw)
+	}
+	return tripperwares, nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+// resetCustomMiddlewares unregisters all custom middlewares once the test is done.
+func resetCustomMiddlewares(t *testing.T) {
+	t.Cleanup(func() {
+		customMiddlewares.mu.Lock()
+		defer customMiddlewares.mu.Unlock()
+
+		customMiddlewares.names = map[string]struct{}{}
+		customMiddlewares.slots = map[MiddlewareSlot][]customMiddleware{}
+	})
+}
+
+type middlewareCalls struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *middlewareCalls) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, name)
+}
+
+func (c *middlewareCalls) middleware(name string) MiddlewareFactory {
+	return func(_ prometheus.Registerer, _ log.Logger) (queryrange.Middleware, error) {
+		return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+			return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+				c.add(name)
+				return next.Do(ctx, r)
+			})
+		}), nil
+	}
+}
+
+func TestRegisterMiddleware(t *testing.T) {
+	resetCustomMiddlewares(t)
+
+	noop := func(_ prometheus.Registerer, _ log.Logger) (queryrange.Middleware, error) {
+		return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler { return next }), nil
+	}
+	RegisterMiddleware(SlotQueryRangeFirst, "noop", noop)
+
+	for _, tcase := range []struct {
+		name     string
+		register func()
+	}{
+		{name: "duplicate name", register: func() { RegisterMiddleware(SlotLabelsLast, "noop", noop) }},
+		{name: "empty name", register: func() { RegisterMiddleware(SlotLabelsLast, "", noop) }},
+		{name: "unknown slot", register: func() { RegisterMiddleware("unknown", "other", noop) }},
+		{name: "middleware at frontend slot", register: func() { RegisterMiddleware(SlotFrontend, "other", noop) }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			defer func() {
+				testutil.Assert(t, recover() != nil, "expected registration to panic")
+			}()
+			tcase.register()
+		})
+	}
+}
+
+func TestCustomMiddlewares(t *testing.T) {
+	resetCustomMiddlewares(t)
+
+	calls := &middlewareCalls{}
+	RegisterTripperware("frontend", func(_ prometheus.Registerer, _ log.Logger) (queryrange.Tripperware, error) {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				calls.add("frontend")
+				return next.RoundTrip(r)
+			})
+		}, nil
+	})
+	RegisterMiddleware(SlotQueryRangeLast, "last", calls.middleware("last"))
+	RegisterMiddleware(SlotQueryRangeFirst, "first", calls.middleware("first"))
+	RegisterMiddleware(SlotQueryRangeBeforeCache, "before_cache", calls.middleware("before_cache"))
+	RegisterMiddleware(SlotQueryRangeFirst, "second", calls.middleware("second"))
+	RegisterMiddleware(SlotLabelsFirst, "labels", calls.middleware("labels"))
+
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				Limits:                 defaultLimits,
+				SplitQueriesByInterval: time.Hour,
+			},
+			LabelsConfig: LabelsConfig{
+				Limits: defaultLimits,
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := promqlResults(false)
+	rt.setHandler(handler)
+
+	ctx := user.InjectOrgID(context.Background(), "1")
+	httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+		Query: "foo",
+	})
+	testutil.Ok(t, err)
+
+	_, err = tpw(rt).RoundTrip(httpReq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, *res)
+
+	// The query is split in two after the first slot, sub-queries run concurrently.
+	testutil.Equals(t, []string{"frontend", "first", "second"}, calls.calls[:3])
+	sort.Strings(calls.calls[3:])
+	testutil.Equals(t, []string{"before_cache", "before_cache", "last", "last"}, calls.calls[3:])
+}
+
+func TestCustomMiddlewaresFactoryError(t *testing.T) {
+	resetCustomMiddlewares(t)
+
+	RegisterMiddleware(SlotQueryInstantLast, "broken", func(_ prometheus.Registerer, _ log.Logger) (queryrange.Middleware, error) {
+		return nil, errors.New("broken")
+	})
+
+	_, err := NewTripperware(Config{}, nil, log.NewNopLogger())
+	testutil.NotOk(t, err)
+	testutil.Equals(t, `create custom middleware "broken": broken`, err.Error())
+}
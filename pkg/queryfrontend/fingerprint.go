@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/extpromql"
+)
+
+// queryFingerprintHeader is the response header holding the fingerprint of the query.
+const queryFingerprintHeader = "X-Thanos-Query-Fingerprint"
+
+// queryFingerprint returns the fingerprint of the given PromQL query. Queries differing only in their literals,
+// i.e. numbers, strings, label matcher values and @ timestamps, have the same fingerprint. Metric names, functions,
+// range and offset durations are kept, as they usually determine the cost of a query. Queries which fail to parse
+// are fingerprinted as they are.
+func queryFingerprint(query string) string {
+	expr, err := extpromql.ParseExpr(query)
+	if err != nil {
+		return fmt.Sprintf("%016x", xxhash.Sum64String(query))
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.NumberLiteral:
+			n.Val = 0
+		case *parser.StringLiteral:
+			n.Val = ""
+		case *parser.VectorSelector:
+			for i, m := range n.LabelMatchers {
+				if m.Name == labels.MetricName {
+					continue
+				}
+				n.LabelMatchers[i] = &labels.Matcher{Type: m.Type, Name: m.Name}
+			}
+			if n.Timestamp != nil {
+				n.Timestamp = new(int64)
+			}
+		case *parser.SubqueryExpr:
+			if n.Timestamp != nil {
+				n.Timestamp = new(int64)
+			}
+		}
+		return nil
+	})
+	return fmt.Sprintf("%016x", xxhash.Sum64String(expr.String()))
+}
+
+type queryFingerprintCtxKey struct{}
+
+// QueryFingerprintFromContext returns the fingerprint of the query of the request the context belongs to.
+// It is empty for requests which are not instant or range queries.
+func QueryFingerprintFromContext(ctx context.Context) string {
+	fp, _ := ctx.Value(queryFingerprintCtxKey{}).(string)
+	return fp
+}
+
+// newQueryFingerprintTripperware returns a Tripperware which fingerprints instant and range queries, attaching the
+// fingerprint to the request context and to the response. It must wrap all the tripperwares logging the fingerprint.
+func newQueryFingerprintTripperware() queryrange.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if op := getOperation(r); op != instantQueryOp && op != rangeQueryOp {
+				return next.RoundTrip(r)
+			}
+
+			if err := api.ParseForm(r); err != nil {
+				return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+			}
+			fp := queryFingerprint(r.FormValue("query"))
+
+			resp, err := next.RoundTrip(r.WithContext(context.WithValue(r.Context(), queryFingerprintCtxKey{}, fp)))
+			if err != nil {
+				return nil, err
+			}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			resp.Header.Set(queryFingerprintHeader, fp)
+			return resp, nil
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	for _, tcase := range []struct {
+		name   string
+		q1, q2 string
+		equal  bool
+	}{
+		{
+			name:  "different label matcher values",
+			q1:    `sum(rate(http_requests_total{namespace="a", code=~"5.."}[5m]))`,
+			q2:    `sum(rate(http_requests_total{namespace="b", code=~"4.."}[5m]))`,
+			equal: true,
+		},
+		{
+			name:  "different number literals",
+			q1:    `up > 1`,
+			q2:    `up > 0.5`,
+			equal: true,
+		},
+		{
+			name:  "different string literals",
+			q1:    `label_replace(up, "dst", "$1", "src", "(.*)")`,
+			q2:    `label_replace(up, "dst", "x$1", "src", "a(.*)")`,
+			equal: true,
+		},
+		{
+			name:  "different @ timestamps",
+			q1:    `up @ 100`,
+			q2:    `up @ 200`,
+			equal: true,
+		},
+		{
+			name:  "formatting is normalized",
+			q1:    `sum by (job) (up)`,
+			q2:    `sum(up)   by(job)`,
+			equal: true,
+		},
+		{
+			name: "different metric names",
+			q1:   `up`,
+			q2:   `down`,
+		},
+		{
+			name: "different range durations",
+			q1:   `rate(http_requests_total[5m])`,
+			q2:   `rate(http_requests_total[1h])`,
+		},
+		{
+			name: "different offsets",
+			q1:   `up offset 5m`,
+			q2:   `up offset 1w`,
+		},
+		{
+			name: "different matched labels",
+			q1:   `up{job="a"}`,
+			q2:   `up{instance="a"}`,
+		},
+		{
+			name: "different matcher types",
+			q1:   `up{job="a"}`,
+			q2:   `up{job!="a"}`,
+		},
+		{
+			name: "unparsable queries",
+			q1:   `sum(up{job="a"}`,
+			q2:   `sum(up{job="b"}`,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			fp1, fp2 := queryFingerprint(tcase.q1), queryFingerprint(tcase.q2)
+			testutil.Equals(t, 16, len(fp1))
+			testutil.Equals(t, tcase.equal, fp1 == fp2)
+		})
+	}
+}
+
+func TestQueryFingerprintTripperware(t *testing.T) {
+	var fingerprint string
+	tripper := newQueryFingerprintTripperware()(queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		fingerprint = QueryFingerprintFromContext(r.Context())
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	resp, err := tripper.RoundTrip(newQueryAttributesTestRequest(t, `up{job="a"}`, nil))
+	testutil.Ok(t, err)
+	testutil.Equals(t, queryFingerprint(`up{job="b"}`), fingerprint)
+	testutil.Equals(t, fingerprint, resp.Header.Get(queryFingerprintHeader))
+
+	resp, err = tripper.RoundTrip(httptest.NewRequest(http.MethodGet, "/api/v1/labels", nil))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "", fingerprint)
+	testutil.Equals(t, "", resp.Header.Get(queryFingerprintHeader))
+}
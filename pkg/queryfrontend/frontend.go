@@ -0,0 +1,226 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/klauspost/compress/gzhttp"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/user"
+	"gopkg.in/yaml.v2"
+
+	cortexfrontend "github.com/thanos-io/thanos/internal/cortex/frontend"
+	"github.com/thanos-io/thanos/internal/cortex/frontend/transport"
+	"github.com/thanos-io/thanos/pkg/exthttp"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// anonymousOrgID is the org ID of the requests without any of the org ID headers.
+const anonymousOrgID = "anonymous"
+
+// Frontend is the middleware chain of the query frontend in front of a downstream round tripper: the tripperwares
+// splitting, sharding, caching and retrying the requests, the adaptive concurrency limiter and the slow query report.
+// It serves requests in-process, so that it can be embedded in other gateways and exercised in tests without the HTTP
+// server of the query frontend component.
+type Frontend struct {
+	roundTripper       http.RoundTripper
+	handler            http.Handler
+	ruleSuggestions    *RuleSuggestionsHandler
+	maintenanceWindows *MaintenanceWindowsHandler
+	orgIDHeaders       []string
+}
+
+type frontendOptions struct {
+	ruleSuggestionsMaxFingerprints int
+	orgIDHeaders                   []string
+}
+
+// FrontendOption configures a Frontend.
+type FrontendOption func(*frontendOptions)
+
+// WithRuleSuggestions enables the slow query report of up to the given number of query fingerprints, and the rule
+// suggestions handler serving it. It requires the slow queries logging threshold of the handler config to be set.
+func WithRuleSuggestions(maxFingerprints int) FrontendOption {
+	return func(o *frontendOptions) {
+		o.ruleSuggestionsMaxFingerprints = maxFingerprints
+	}
+}
+
+// WithOrgIDHeaders sets the headers the org ID of the requests without one in their context is read from, the first
+// one set winning. It defaults to the default tenant header.
+func WithOrgIDHeaders(headers ...string) FrontendOption {
+	return func(o *frontendOptions) {
+		o.orgIDHeaders = headers
+	}
+}
+
+// NewFrontend returns the middleware chain of the query frontend configured by the given config, which is expected
+// to be validated, sending the requests it does not answer itself to the downstream round tripper.
+func NewFrontend(config Config, downstream http.RoundTripper, reg prometheus.Registerer, logger log.Logger, opts ...FrontendOption) (*Frontend, error) {
+	o := frontendOptions{orgIDHeaders: []string{tenancy.DefaultTenantHeader}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tripperware, err := NewTripperware(config, reg, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "setup tripperwares")
+	}
+
+	if config.AdaptiveConcurrency.Enabled() {
+		downstream = NewAdaptiveConcurrencyLimiter(config.AdaptiveConcurrency, reg).Wrap(downstream)
+	}
+
+	handlerConfig := transport.HandlerConfig{}
+	if config.CortexHandlerConfig != nil {
+		handlerConfig = *config.CortexHandlerConfig
+	}
+
+	f := &Frontend{
+		roundTripper: tripperware(downstream),
+		orgIDHeaders: o.orgIDHeaders,
+	}
+	if o.ruleSuggestionsMaxFingerprints > 0 && handlerConfig.LogQueriesLongerThan > 0 {
+		report := NewSlowQueryReport(handlerConfig.LogQueriesLongerThan, o.ruleSuggestionsMaxFingerprints, config.TenantHeader, config.DefaultTenant, config.TenantCertField)
+		f.roundTripper = report.Tripperware()(f.roundTripper)
+		f.ruleSuggestions = NewRuleSuggestionsHandler(logger, report, downstream)
+	}
+
+	if config.QueryAttributes != nil && len(config.QueryAttributes.MaintenanceWindows) > 0 {
+		if f.maintenanceWindows, err = NewMaintenanceWindowsHandler(logger, config.QueryAttributes.MaintenanceWindows, config.TenantHeader); err != nil {
+			return nil, errors.Wrap(err, "setup maintenance windows")
+		}
+	}
+
+	f.handler = transport.NewHandler(handlerConfig, f.roundTripper, logger, nil)
+	if config.CompressResponses {
+		f.handler = gzhttp.GzipHandler(f.handler)
+	}
+	return f, nil
+}
+
+// ServeHTTP serves the given request through the middleware chain, like the query frontend component.
+func (f *Frontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Cortex frontend middlewares require orgID.
+	if _, err := user.ExtractOrgID(r.Context()); err != nil {
+		r = r.WithContext(user.InjectOrgID(r.Context(), OrgIDFromHeaders(r, f.orgIDHeaders)))
+	}
+	f.handler.ServeHTTP(w, r)
+}
+
+// RoundTripper returns the middleware chain as a round tripper, without the HTTP handling of the frontend such as the
+// query stats and the slow queries logging. The requests it is given have to hold an org ID in their context.
+func (f *Frontend) RoundTripper() http.RoundTripper {
+	return f.roundTripper
+}
+
+// RuleSuggestions returns the handler of the rule suggestions, or nil if they are not enabled.
+func (f *Frontend) RuleSuggestions() *RuleSuggestionsHandler {
+	return f.ruleSuggestions
+}
+
+// MaintenanceWindows returns the handler announcing the maintenance windows, or nil if none is configured.
+func (f *Frontend) MaintenanceWindows() *MaintenanceWindowsHandler {
+	return f.maintenanceWindows
+}
+
+// OrgIDFromHeaders returns the org ID of the given request, from the first one of the given headers set.
+func OrgIDFromHeaders(r *http.Request, headers []string) string {
+	for _, header := range headers {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+	}
+	return anonymousOrgID
+}
+
+// NewDownstreamRoundTripper returns a round tripper sending the requests to the given downstream URL, e.g. of a
+// querier, with the given transport.
+func NewDownstreamRoundTripper(downstreamURL string, transport http.RoundTripper) (http.RoundTripper, error) {
+	rt, err := cortexfrontend.NewDownstreamRoundTripper(downstreamURL, transport)
+	if err != nil {
+		return nil, errors.Wrap(err, "setup downstream roundtripper")
+	}
+	return rt, nil
+}
+
+// NewDownstreamTransport returns the transport to the downstream configured by the given downstream tripper config
+// YAML, or the default one if empty.
+func NewDownstreamTransport(downstreamTripperConfContentYaml []byte) (*http.Transport, error) {
+	downstreamTripper := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if len(downstreamTripperConfContentYaml) > 0 {
+		tripperConfig := &DownstreamTripperConfig{}
+		if err := yaml.UnmarshalStrict(downstreamTripperConfContentYaml, tripperConfig); err != nil {
+			return nil, errors.Wrap(err, "parsing downstream tripper config YAML file")
+		}
+
+		if tripperConfig.TLSConfig != nil {
+			tlsConfig, err := exthttp.NewTLSConfig(tripperConfig.TLSConfig)
+			if err != nil {
+				return nil, errors.Wrap(err, "parsing downstream tripper TLS config YAML")
+			}
+			downstreamTripper.TLSClientConfig = tlsConfig
+		}
+		if tripperConfig.IdleConnTimeout > 0 {
+			downstreamTripper.IdleConnTimeout = time.Duration(tripperConfig.IdleConnTimeout)
+		}
+		if tripperConfig.ResponseHeaderTimeout > 0 {
+			downstreamTripper.ResponseHeaderTimeout = time.Duration(tripperConfig.ResponseHeaderTimeout)
+		}
+		if tripperConfig.TLSHandshakeTimeout > 0 {
+			downstreamTripper.TLSHandshakeTimeout = time.Duration(tripperConfig.TLSHandshakeTimeout)
+		}
+		if tripperConfig.ExpectContinueTimeout > 0 {
+			downstreamTripper.ExpectContinueTimeout = time.Duration(tripperConfig.ExpectContinueTimeout)
+		}
+		if tripperConfig.MaxIdleConns != nil {
+			downstreamTripper.MaxIdleConns = *tripperConfig.MaxIdleConns
+		}
+		if tripperConfig.MaxIdleConnsPerHost != nil {
+			downstreamTripper.MaxIdleConnsPerHost = *tripperConfig.MaxIdleConnsPerHost
+		}
+		if tripperConfig.MaxConnsPerHost != nil {
+			downstreamTripper.MaxConnsPerHost = *tripperConfig.MaxConnsPerHost
+		}
+	}
+
+	return downstreamTripper, nil
+}
+
+// HandlerRoundTripper returns a round tripper serving the requests with the given handler in-process, e.g. a querier
+// API, to exercise a Frontend without any network.
+func HandlerRoundTripper(h http.Handler) http.RoundTripper {
+	return handlerRoundTripper{h: h}
+}
+
+type handlerRoundTripper struct {
+	h http.Handler
+}
+
+func (rt handlerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	rt.h.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
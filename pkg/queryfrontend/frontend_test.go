@@ -0,0 +1,122 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/internal/cortex/frontend/transport"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestFrontend(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		path        string
+		handlerFunc func(bool) (*int, http.Handler)
+		expected    int
+		orgID       string
+	}{
+		{
+			name:        "query range request split to 2",
+			path:        "/api/v1/query_range?query=foo&start=0&end=7200&step=10",
+			handlerFunc: promqlResults,
+			expected:    2,
+			orgID:       "tenant-a",
+		},
+		{
+			name:        "labels request split to 2",
+			path:        "/api/v1/labels?start=0&end=7200",
+			handlerFunc: labelsResults,
+			expected:    2,
+			orgID:       "tenant-a",
+		},
+		{
+			name:        "other requests are forwarded as is",
+			path:        "/api/v1/status/buildinfo",
+			handlerFunc: labelsResults,
+			expected:    1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, handler := tc.handlerFunc(false)
+			var orgIDs []string
+			downstream := HandlerRoundTripper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgIDs = append(orgIDs, r.Header.Get(user.OrgIDHeaderName))
+				handler.ServeHTTP(w, r)
+			}))
+
+			fe, err := NewFrontend(Config{
+				QueryRangeConfig: QueryRangeConfig{
+					Limits:                 defaultLimits,
+					SplitQueriesByInterval: time.Hour,
+				},
+				LabelsConfig: LabelsConfig{
+					Limits:                 defaultLimits,
+					SplitQueriesByInterval: time.Hour,
+					DefaultTimeRange:       24 * time.Hour,
+				},
+				CortexHandlerConfig: &transport.HandlerConfig{MaxBodySize: 10 * 1024 * 1024},
+			}, downstream, prometheus.NewRegistry(), log.NewNopLogger())
+			testutil.Ok(t, err)
+			testutil.Assert(t, fe.RuleSuggestions() == nil)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set(tenancy.DefaultTenantHeader, "tenant-a")
+			rec := httptest.NewRecorder()
+			fe.ServeHTTP(rec, req)
+
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+			testutil.Equals(t, tc.expected, *res)
+			// The org ID is read from the tenant header.
+			for _, id := range orgIDs {
+				testutil.Equals(t, tc.orgID, id)
+			}
+		})
+	}
+}
+
+func TestFrontend_RoundTripper(t *testing.T) {
+	res, handler := promqlResults(false)
+	fe, err := NewFrontend(Config{
+		QueryRangeConfig: QueryRangeConfig{
+			Limits:                 defaultLimits,
+			SplitQueriesByInterval: time.Hour,
+		},
+		LabelsConfig: LabelsConfig{
+			Limits:           defaultLimits,
+			DefaultTimeRange: 24 * time.Hour,
+		},
+	}, HandlerRoundTripper(handler), nil, log.NewNopLogger(), WithRuleSuggestions(10))
+	testutil.Ok(t, err)
+	// Rule suggestions require the slow queries to be logged.
+	testutil.Assert(t, fe.RuleSuggestions() == nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/query_range?query=foo&start=0&end=10800&step=10", nil)
+	req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+	resp, err := fe.RoundTripper().RoundTrip(req)
+	testutil.Ok(t, err)
+	testutil.Ok(t, resp.Body.Close())
+	testutil.Equals(t, http.StatusOK, resp.StatusCode)
+	testutil.Equals(t, 3, *res)
+}
+
+func TestOrgIDFromHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	testutil.Equals(t, "anonymous", OrgIDFromHeaders(req, []string{"X-Org", "X-Tenant"}))
+
+	req.Header.Set("X-Tenant", "b")
+	testutil.Equals(t, "b", OrgIDFromHeaders(req, []string{"X-Org", "X-Tenant"}))
+	req.Header.Set("X-Org", "a")
+	testutil.Equals(t, "a", OrgIDFromHeaders(req, []string{"X-Org", "X-Tenant"}))
+}
@@ -0,0 +1,103 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+const (
+	// HeaderForward forwards the header of client requests to the downstream requests, including the ones of split
+	// and sharded queries.
+	HeaderForward = "forward"
+	// HeaderStrip removes the header from all the downstream requests.
+	HeaderStrip = "strip"
+)
+
+// HeaderPolicyConfig holds the policy of the client headers propagated by the query-frontend to the downstream
+// queriers, e.g. forwarding the identity of Grafana users and stripping credentials.
+type HeaderPolicyConfig struct {
+	// Headers are the policies of each header. Headers without a policy are only forwarded by the requests the
+	// query-frontend passes through as they are, or if listed by the forward header flag.
+	Headers []HeaderPolicy `yaml:"headers"`
+}
+
+// HeaderPolicy is the policy of a client header.
+type HeaderPolicy struct {
+	// Name is the name of the header, case insensitive.
+	Name string `yaml:"name"`
+	// Action is either forward or strip.
+	Action string `yaml:"action"`
+}
+
+// ParseHeaderPolicyConfig parses and validates the YAML header policy config.
+func ParseHeaderPolicyConfig(content []byte) (*HeaderPolicyConfig, error) {
+	cfg := &HeaderPolicyConfig{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing header policy config YAML")
+	}
+
+	names := map[string]struct{}{}
+	for i, h := range cfg.Headers {
+		if h.Name == "" {
+			return nil, errors.Errorf("header policy %d has no name", i)
+		}
+		name := http.CanonicalHeaderKey(h.Name)
+		if _, ok := names[name]; ok {
+			return nil, errors.Errorf("duplicate header policy of %q", h.Name)
+		}
+		names[name] = struct{}{}
+
+		switch h.Action {
+		case HeaderForward:
+		case HeaderStrip:
+			// Queriers read the tenant of requests from it.
+			if name == http.CanonicalHeaderKey(tenancy.DefaultTenantHeader) {
+				return nil, errors.Errorf("the tenant header %q cannot be stripped", h.Name)
+			}
+		default:
+			return nil, errors.Errorf("header policy of %q: unknown action %q, expected %q or %q", h.Name, h.Action, HeaderForward, HeaderStrip)
+		}
+	}
+	return cfg, nil
+}
+
+// headers returns the names of the headers with the given action.
+func (cfg *HeaderPolicyConfig) headers(action string) []string {
+	if cfg == nil {
+		return nil
+	}
+	var headers []string
+	for _, h := range cfg.Headers {
+		if h.Action == action {
+			headers = append(headers, h.Name)
+		}
+	}
+	return headers
+}
+
+// newHeaderStripRoundTripper returns a round tripper removing the given headers from the requests sent to the next
+// round tripper.
+func newHeaderStripRoundTripper(headers []string, next http.RoundTripper) http.RoundTripper {
+	return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		stripped := r
+		for _, h := range headers {
+			if _, ok := r.Header[http.CanonicalHeaderKey(h)]; !ok {
+				continue
+			}
+			// Round trippers must not modify the request they are given.
+			if stripped == r {
+				stripped = r.Clone(r.Context())
+			}
+			stripped.Header.Del(h)
+		}
+		return next.RoundTrip(stripped)
+	})
+}
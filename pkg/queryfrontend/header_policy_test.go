@@ -0,0 +1,137 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/internal/cortex/frontend/transport"
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestParseHeaderPolicyConfig(t *testing.T) {
+	cfg, err := ParseHeaderPolicyConfig([]byte(`
+headers:
+  - name: X-Grafana-User
+    action: forward
+  - name: cookie
+    action: strip
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &HeaderPolicyConfig{Headers: []HeaderPolicy{
+		{Name: "X-Grafana-User", Action: HeaderForward},
+		{Name: "cookie", Action: HeaderStrip},
+	}}, cfg)
+	testutil.Equals(t, []string{"X-Grafana-User"}, cfg.headers(HeaderForward))
+	testutil.Equals(t, []string{"cookie"}, cfg.headers(HeaderStrip))
+
+	for _, invalid := range []string{`
+headers:
+  - action: forward
+`, `
+headers:
+  - name: Cookie
+    action: drop
+`, `
+headers:
+  - name: Cookie
+    action: strip
+  - name: cookie
+    action: forward
+`, `
+headers:
+  - name: thanos-tenant
+    action: strip
+`, `
+headers:
+  - name: Cookie
+    action: strip
+    unknown_field: foo
+`} {
+		_, err = ParseHeaderPolicyConfig([]byte(invalid))
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestTripperware_HeaderPolicy(t *testing.T) {
+	policy, err := ParseHeaderPolicyConfig([]byte(`
+headers:
+  - name: X-Grafana-User
+    action: forward
+  - name: Cookie
+    action: strip
+  - name: Authorization
+    action: strip
+`))
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		handler  func(bool) (*int, http.Handler)
+		expected int
+	}{
+		{name: "split range query", path: "/api/v1/query_range?query=foo&start=0&end=7200&step=10", handler: promqlResults, expected: 2},
+		{name: "split labels request", path: "/api/v1/labels?start=0&end=7200", handler: labelsResults, expected: 2},
+		{name: "request forwarded as is", path: "/api/v1/status/buildinfo", handler: labelsResults, expected: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, handler := tc.handler(false)
+			var headers []http.Header
+			downstream := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				headers = append(headers, r.Header.Clone())
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, r)
+				return rec.Result(), nil
+			})
+
+			tw, err := NewTripperware(Config{
+				QueryRangeConfig: QueryRangeConfig{
+					Limits:                 defaultLimits,
+					SplitQueriesByInterval: time.Hour,
+				},
+				LabelsConfig: LabelsConfig{
+					Limits:                 defaultLimits,
+					SplitQueriesByInterval: time.Hour,
+					DefaultTimeRange:       24 * time.Hour,
+				},
+				ForwardHeaders: []string{tenancy.DefaultTenantHeader, "Authorization"},
+				HeaderPolicy:   policy,
+			}, prometheus.NewRegistry(), log.NewNopLogger())
+			testutil.Ok(t, err)
+			fe := transport.NewHandler(transport.HandlerConfig{MaxBodySize: 10 * 1024 * 1024}, tw(downstream), log.NewNopLogger(), nil)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil).WithContext(user.InjectOrgID(context.Background(), "tenant-a"))
+			req.Header.Set(tenancy.DefaultTenantHeader, "tenant-a")
+			req.Header.Set("X-Grafana-User", "alice")
+			req.Header.Set("Cookie", "grafana_session=secret")
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			fe.ServeHTTP(rec, req)
+
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+			testutil.Equals(t, tc.expected, *res)
+			testutil.Equals(t, tc.expected, len(headers))
+			for _, h := range headers {
+				testutil.Equals(t, "tenant-a", h.Get(tenancy.DefaultTenantHeader))
+				testutil.Equals(t, "alice", h.Get("X-Grafana-User"))
+				// Stripped headers are removed even if listed by the forward header flag.
+				testutil.Equals(t, "", h.Get("Cookie"))
+				testutil.Equals(t, "", h.Get("Authorization"))
+			}
+			// The requests of the client are left as they are.
+			testutil.Equals(t, "Bearer secret", req.Header.Get("Authorization"))
+		})
+	}
+}
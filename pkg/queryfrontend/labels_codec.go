@@ -24,6 +24,7 @@ import (
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
 	"github.com/thanos-io/thanos/internal/cortex/util/spanlogger"
+	"github.com/thanos-io/thanos/pkg/api"
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 )
@@ -37,6 +38,7 @@ var (
 type labelsCodec struct {
 	partialResponse          bool
 	defaultMetadataTimeRange time.Duration
+	requestEncoding          RequestEncoding
 }
 
 // NewThanosLabelsCodec initializes a labelsCodec.
@@ -105,8 +107,15 @@ func (c labelsCodec) MergeResponse(_ queryrange.Request, responses ...queryrange
 	}
 }
 
+// WithRequestEncoding sets the encoding of the requests sent downstream, and returns the codec. Label values
+// requests are sent as GET requests.
+func (c *labelsCodec) WithRequestEncoding(enc RequestEncoding) *labelsCodec {
+	c.requestEncoding = enc
+	return c
+}
+
 func (c labelsCodec) DecodeRequest(_ context.Context, r *http.Request, forwardHeaders []string) (queryrange.Request, error) {
-	if err := r.ParseForm(); err != nil {
+	if err := api.ParseForm(r); err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 	}
 
@@ -158,11 +167,10 @@ func (c labelsCodec) EncodeRequest(ctx context.Context, r queryrange.Request) (*
 				Header:     http.Header{},
 			}
 		} else {
-			req, err = http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
+			req, err = newPostRequest(thanosReq.Path, params, c.requestEncoding)
 			if err != nil {
-				return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+				return nil, err
 			}
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		}
 
 		for _, hv := range thanosReq.Headers {
@@ -186,11 +194,10 @@ func (c labelsCodec) EncodeRequest(ctx context.Context, r queryrange.Request) (*
 			params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 		}
 
-		req, err = http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
+		req, err = newPostRequest(thanosReq.Path, params, c.requestEncoding)
 		if err != nil {
-			return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+			return nil, err
 		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		for _, hv := range thanosReq.Headers {
 			for _, v := range hv.Values {
 				req.Header.Add(hv.Name, v)
@@ -0,0 +1,243 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/api"
+)
+
+const (
+	// MaintenanceWindowReject rejects the requests during the maintenance window.
+	MaintenanceWindowReject = "reject"
+	// MaintenanceWindowServeStale serves the requests from the results cache only during the maintenance window,
+	// rejecting the ones without any cached results.
+	MaintenanceWindowServeStale = "serve_stale"
+)
+
+// maintenanceWindowHeader is the response header set to the name of the maintenance window applied to a request.
+const maintenanceWindowHeader = "X-Thanos-Maintenance-Window"
+
+type queryAttributeMaintenanceWindow struct {
+	matcher     *queryAttributeMatcher
+	name        string
+	description string
+	start, end  time.Time
+	mode        string
+}
+
+func (mw QueryAttributeMaintenanceWindow) compile(defaultTenantHeader string) (*queryAttributeMaintenanceWindow, error) {
+	if mw.Name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	if mw.Start.IsZero() || mw.End.IsZero() {
+		return nil, errors.New("start and end have to be set")
+	}
+	if !mw.End.After(mw.Start) {
+		return nil, errors.New("end has to be after start")
+	}
+	mode := mw.Mode
+	switch mode {
+	case "":
+		mode = MaintenanceWindowReject
+	case MaintenanceWindowReject, MaintenanceWindowServeStale:
+	default:
+		return nil, errors.Errorf("unknown mode %q, expected %q or %q", mw.Mode, MaintenanceWindowReject, MaintenanceWindowServeStale)
+	}
+
+	m, err := mw.Match.compile(defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &queryAttributeMaintenanceWindow{
+		matcher:     m,
+		name:        mw.Name,
+		description: mw.Description,
+		start:       mw.Start,
+		end:         mw.End,
+		mode:        mode,
+	}, nil
+}
+
+func compileQueryAttributeMaintenanceWindows(mws []QueryAttributeMaintenanceWindow, defaultTenantHeader string) ([]*queryAttributeMaintenanceWindow, error) {
+	compiled := make([]*queryAttributeMaintenanceWindow, 0, len(mws))
+	for i, mw := range mws {
+		cmw, err := mw.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "maintenance window %d", i)
+		}
+		compiled = append(compiled, cmw)
+	}
+	return compiled, nil
+}
+
+func (w *queryAttributeMaintenanceWindow) active(now time.Time) bool {
+	return !now.Before(w.start) && now.Before(w.end)
+}
+
+// error returns the error of the requests rejected during the window, telling clients to retry after its end.
+func (w *queryAttributeMaintenanceWindow) error(now time.Time) error {
+	msg := fmt.Sprintf("query rejected by the query-frontend: maintenance window %q in progress until %s", w.name, w.end.Format(time.RFC3339))
+	if w.description != "" {
+		msg += ": " + w.description
+	}
+	return httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
+		Code: http.StatusServiceUnavailable,
+		Headers: []*httpgrpc.Header{
+			{Key: "Content-Type", Values: []string{"text/plain; charset=utf-8"}},
+			{Key: "Retry-After", Values: []string{strconv.Itoa(int(math.Ceil(w.end.Sub(now).Seconds())))}},
+			{Key: maintenanceWindowHeader, Values: []string{w.name}},
+		},
+		Body: []byte(msg),
+	})
+}
+
+func activeMaintenanceWindow(windows []*queryAttributeMaintenanceWindow, r *http.Request, query string, now time.Time) *queryAttributeMaintenanceWindow {
+	for _, w := range windows {
+		if w.active(now) && w.matcher.matches(r, query) {
+			return w
+		}
+	}
+	return nil
+}
+
+type maintenanceWindowContextKey struct{}
+
+// newMaintenanceWindowsTripperware returns a Tripperware applying the first active maintenance window matched by the
+// query and metadata requests. Requests are rejected with 503 Service Unavailable, or, in serve_stale mode, served
+// from the results cache only, with a warning. Like the rejection tripperware, it must wrap the tenancy conversion.
+func newMaintenanceWindowsTripperware(windows []*queryAttributeMaintenanceWindow, reg prometheus.Registerer, logger log.Logger) queryrange.Tripperware {
+	requests := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_maintenance_window_requests_total",
+		Help: "Total number of requests matching an active maintenance window, by action taken.",
+	}, []string{"op", "window", "action"})
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			op := getOperation(r)
+			if op == "" {
+				return next.RoundTrip(r)
+			}
+
+			if err := api.ParseForm(r); err != nil {
+				return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+			}
+			now := time.Now()
+			query := r.FormValue("query")
+			w := activeMaintenanceWindow(windows, r, query, now)
+			if w == nil {
+				return next.RoundTrip(r)
+			}
+			if w.mode == MaintenanceWindowReject {
+				requests.WithLabelValues(op, w.name, "rejected").Inc()
+				level.Debug(logger).Log("msg", "request rejected during maintenance window", "window", w.name, "op", op, "query", query, "query_fingerprint", QueryFingerprintFromContext(r.Context()))
+				return nil, w.error(now)
+			}
+
+			// The downstream guard rejects the requests the results cache cannot answer.
+			ctx := context.WithValue(queryrange.InjectCacheOnly(r.Context()), maintenanceWindowContextKey{}, w)
+			resp, err := next.RoundTrip(r.WithContext(ctx))
+			if err != nil {
+				requests.WithLabelValues(op, w.name, "rejected").Inc()
+				return nil, err
+			}
+			requests.WithLabelValues(op, w.name, "served_stale").Inc()
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			resp.Header.Set(maintenanceWindowHeader, w.name)
+			if err := addResponseWarnings(resp, fmt.Sprintf("served from cached results only during the maintenance window %q until %s, results may be incomplete", w.name, w.end.Format(time.RFC3339))); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		})
+	}
+}
+
+// newMaintenanceWindowsDownstreamGuard returns a round tripper rejecting the requests served from cached results
+// only during a maintenance window, which the results cache did not answer, instead of sending them downstream.
+func newMaintenanceWindowsDownstreamGuard(next http.RoundTripper) http.RoundTripper {
+	return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if w, ok := r.Context().Value(maintenanceWindowContextKey{}).(*queryAttributeMaintenanceWindow); ok {
+			return nil, w.error(time.Now())
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// MaintenanceWindow is a maintenance window announced by the MaintenanceWindowsHandler.
+type MaintenanceWindow struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Mode        string    `json:"mode"`
+	Active      bool      `json:"active"`
+}
+
+type maintenanceWindowsResponse struct {
+	Status string                    `json:"status"`
+	Data   *maintenanceWindowsResult `json:"data"`
+}
+
+type maintenanceWindowsResult struct {
+	Windows []MaintenanceWindow `json:"windows"`
+}
+
+// MaintenanceWindowsHandler announces the active and upcoming maintenance windows, optionally only the ones of the
+// tenant given by the tenant parameter.
+type MaintenanceWindowsHandler struct {
+	logger  log.Logger
+	windows []*queryAttributeMaintenanceWindow
+	now     func() time.Time
+}
+
+// NewMaintenanceWindowsHandler returns a handler announcing the given maintenance windows.
+func NewMaintenanceWindowsHandler(logger log.Logger, windows []QueryAttributeMaintenanceWindow, defaultTenantHeader string) (*MaintenanceWindowsHandler, error) {
+	compiled, err := compileQueryAttributeMaintenanceWindows(windows, defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &MaintenanceWindowsHandler{logger: logger, windows: compiled, now: time.Now}, nil
+}
+
+func (h *MaintenanceWindowsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := h.now()
+	tenant := r.FormValue("tenant")
+
+	windows := []MaintenanceWindow{}
+	for _, mw := range h.windows {
+		if !now.Before(mw.end) || (tenant != "" && !mw.matcher.matchesTenant(tenant)) {
+			continue
+		}
+		windows = append(windows, MaintenanceWindow{
+			Name:        mw.name,
+			Description: mw.description,
+			Start:       mw.start,
+			End:         mw.end,
+			Mode:        mw.mode,
+			Active:      mw.active(now),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(maintenanceWindowsResponse{Status: "success", Data: &maintenanceWindowsResult{Windows: windows}}); err != nil {
+		level.Warn(h.logger).Log("msg", "failed to write maintenance windows response", "err", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestMaintenanceWindowsTripperware(t *testing.T) {
+	now := time.Now()
+	mws, err := compileQueryAttributeMaintenanceWindows([]QueryAttributeMaintenanceWindow{
+		{Match: QueryAttributeMatcher{TenantValues: []string{"upcoming"}}, Name: "upcoming", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+		{Match: QueryAttributeMatcher{TenantValues: []string{"migrating"}}, Name: "migration", Description: "Moving to the new bucket.", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+		{Match: QueryAttributeMatcher{TenantValues: []string{"backfilling"}}, Name: "backfill", Start: now.Add(-time.Hour), End: now.Add(time.Hour), Mode: MaintenanceWindowServeStale},
+	}, tenancy.DefaultTenantHeader)
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	var (
+		downstreamCalls int
+		cacheOnly       bool
+	)
+	downstream := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downstreamCalls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"vector","result":[]}}`)),
+		}, nil
+	})
+	// The results cache answers the requests of the backfilling tenant, without sending them downstream.
+	cache := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		cacheOnly = queryrange.ExtractCacheOnly(r.Context())
+		if r.Header.Get(tenancy.DefaultTenantHeader) == "backfilling" && r.FormValue("query") == "cached" {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"vector","result":[]}}`)),
+			}, nil
+		}
+		return newMaintenanceWindowsDownstreamGuard(downstream).RoundTrip(r)
+	})
+	tripper := newMaintenanceWindowsTripperware(mws, reg, log.NewNopLogger())(cache)
+	request := func(tenant, query string) *http.Request {
+		return newQueryAttributesTestRequest(t, query, map[string]string{tenancy.DefaultTenantHeader: tenant})
+	}
+	expectUnavailable := func(t *testing.T, err error, window string) {
+		t.Helper()
+		testutil.NotOk(t, err)
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		testutil.Assert(t, ok, "expected HTTP error, got %v", err)
+		testutil.Equals(t, int32(http.StatusServiceUnavailable), resp.Code)
+		headers := map[string]string{}
+		for _, h := range resp.Headers {
+			headers[h.Key] = h.Values[0]
+		}
+		testutil.Equals(t, window, headers[maintenanceWindowHeader])
+		retryAfter, err := strconv.Atoi(headers["Retry-After"])
+		testutil.Ok(t, err)
+		testutil.Assert(t, retryAfter > 3500 && retryAfter <= 3600, "unexpected Retry-After %d", retryAfter)
+	}
+
+	// Requests of other tenants, or before the window starts, are sent downstream.
+	_, err = tripper.RoundTrip(request("other", "up"))
+	testutil.Ok(t, err)
+	_, err = tripper.RoundTrip(request("upcoming", "up"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, downstreamCalls)
+	testutil.Assert(t, !cacheOnly)
+
+	_, err = tripper.RoundTrip(request("migrating", "up"))
+	expectUnavailable(t, err, "migration")
+	resp, _ := httpgrpc.HTTPResponseFromError(err)
+	testutil.Assert(t, strings.Contains(string(resp.Body), `maintenance window "migration" in progress until`), "unexpected error %s", resp.Body)
+	testutil.Assert(t, strings.HasSuffix(string(resp.Body), ": Moving to the new bucket."), "unexpected error %s", resp.Body)
+
+	// In serve_stale mode, cached results are served with a warning, and the other requests rejected.
+	httpResp, err := tripper.RoundTrip(request("backfilling", "cached"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, cacheOnly)
+	testutil.Equals(t, "backfill", httpResp.Header.Get(maintenanceWindowHeader))
+	var r queryrange.PrometheusResponse
+	testutil.Ok(t, json.NewDecoder(httpResp.Body).Decode(&r))
+	testutil.Equals(t, []string{fmt.Sprintf("served from cached results only during the maintenance window \"backfill\" until %s, results may be incomplete", mws[2].end.Format(time.RFC3339))}, r.Warnings)
+
+	_, err = tripper.RoundTrip(request("backfilling", "up"))
+	expectUnavailable(t, err, "backfill")
+	testutil.Equals(t, 2, downstreamCalls)
+
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_query_frontend_maintenance_window_requests_total Total number of requests matching an active maintenance window, by action taken.
+# TYPE thanos_query_frontend_maintenance_window_requests_total counter
+thanos_query_frontend_maintenance_window_requests_total{action="rejected",op="query",window="backfill"} 1
+thanos_query_frontend_maintenance_window_requests_total{action="rejected",op="query",window="migration"} 1
+thanos_query_frontend_maintenance_window_requests_total{action="served_stale",op="query",window="backfill"} 1
+`), "thanos_query_frontend_maintenance_window_requests_total"))
+}
+
+func TestMaintenanceWindowsHandler(t *testing.T) {
+	now := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+	handler, err := NewMaintenanceWindowsHandler(log.NewNopLogger(), []QueryAttributeMaintenanceWindow{
+		{Match: QueryAttributeMatcher{TenantValues: []string{"team-a"}}, Name: "past", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+		{Match: QueryAttributeMatcher{TenantValues: []string{"team-a"}}, Name: "backfill", Description: "Backfilling March.", Start: now.Add(-time.Hour), End: now.Add(time.Hour), Mode: MaintenanceWindowServeStale},
+		{Match: QueryAttributeMatcher{TenantRegex: "team-.*"}, Name: "migration", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+		{Match: QueryAttributeMatcher{DashboardUID: "heavy"}, Name: "dashboards", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+	}, tenancy.DefaultTenantHeader)
+	testutil.Ok(t, err)
+	handler.now = func() time.Time { return now }
+
+	windows := func(t *testing.T, target string) []string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		testutil.Equals(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var resp struct {
+			Status string                   `json:"status"`
+			Data   maintenanceWindowsResult `json:"data"`
+		}
+		testutil.Ok(t, json.NewDecoder(rec.Body).Decode(&resp))
+		testutil.Equals(t, "success", resp.Status)
+		var names []string
+		for _, w := range resp.Data.Windows {
+			names = append(names, w.Name)
+			if w.Name == "backfill" {
+				testutil.Equals(t, MaintenanceWindow{
+					Name:        "backfill",
+					Description: "Backfilling March.",
+					Start:       now.Add(-time.Hour),
+					End:         now.Add(time.Hour),
+					Mode:        MaintenanceWindowServeStale,
+					Active:      true,
+				}, w)
+			}
+		}
+		return names
+	}
+
+	// Windows which ended are not announced anymore.
+	testutil.Equals(t, []string{"backfill", "migration", "dashboards"}, windows(t, "/api/v1/maintenance_windows"))
+	// Windows without tenant attributes apply to all tenants.
+	testutil.Equals(t, []string{"backfill", "migration", "dashboards"}, windows(t, "/api/v1/maintenance_windows?tenant=team-a"))
+	testutil.Equals(t, []string{"migration", "dashboards"}, windows(t, "/api/v1/maintenance_windows?tenant=team-b"))
+	testutil.Equals(t, []string{"dashboards"}, windows(t, "/api/v1/maintenance_windows?tenant=other"))
+}
@@ -0,0 +1,733 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/weaveworks/common/httpgrpc"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/extannotations"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// dashboardUIDHeader is the header Grafana uses to send the UID of the dashboard a query originates from.
+const dashboardUIDHeader = "X-Dashboard-Uid"
+
+// QueryAttributesConfig holds policies applied to queries matching a set of attributes.
+type QueryAttributesConfig struct {
+	// Reject holds matchers of queries which are rejected by the query-frontend.
+	Reject []QueryAttributeMatcher `yaml:"reject"`
+	// Overrides holds settings overridden for range queries matching a matcher. Only the first
+	// matching override is applied.
+	Overrides []QueryAttributeOverride `yaml:"overrides"`
+	// ResultsCacheBypass holds results cache operations skipped for range queries matching a matcher.
+	ResultsCacheBypass []QueryAttributeCacheBypass `yaml:"results_cache_bypass"`
+	// ResultsCacheStaleWhileRevalidate holds the staleness tolerated by range queries matching a matcher. Only the
+	// first matching tolerance is applied.
+	ResultsCacheStaleWhileRevalidate []QueryAttributeStaleWhileRevalidate `yaml:"results_cache_stale_while_revalidate"`
+	// MinQueryStart holds the minimum start times of queries matching a matcher, e.g. the paid retention of tenants.
+	// Only the first matching minimum start time is applied.
+	MinQueryStart []QueryAttributeMinQueryStart `yaml:"min_query_start"`
+	// MaintenanceWindows holds the scheduled maintenance windows of the queries matching a matcher, e.g. of tenants
+	// whose data is being backfilled. Only the first active matching window is applied.
+	MaintenanceWindows []QueryAttributeMaintenanceWindow `yaml:"maintenance_windows"`
+}
+
+// QueryAttributeOverride overrides the query range settings of queries matching a matcher.
+type QueryAttributeOverride struct {
+	Match QueryAttributeMatcher `yaml:"match"`
+
+	// SplitInterval overrides the interval range queries are split by. Zero keeps the configured splitting.
+	SplitInterval model.Duration `yaml:"split_interval"`
+	// MaxRetries overrides the maximum number of retries of a range query. Zero keeps the configured retries.
+	MaxRetries int `yaml:"max_retries"`
+}
+
+// QueryAttributeMatcher matches queries against a set of request attributes. A request matches
+// only if it matches all the attributes which are set, unset attributes match any request, and
+// none of the exclusions which are set.
+type QueryAttributeMatcher struct {
+	// QueryPatterns are regular expressions, at least one of which must fully match the query.
+	QueryPatterns []string `yaml:"query_patterns"`
+	// UserAgent is a regular expression which must fully match the User-Agent header.
+	UserAgent string `yaml:"user_agent"`
+	// DashboardUID must be equal to the Grafana dashboard UID of the request.
+	DashboardUID string `yaml:"dashboard_uid"`
+
+	// TenantHeader is the HTTP header the tenant is read from. Defaults to the query-frontend tenant header.
+	TenantHeader string `yaml:"tenant_header"`
+	// TenantValues are tenants, one of which must be equal to the tenant of the request.
+	TenantValues []string `yaml:"tenant_values"`
+	// TenantRegex is a regular expression which must fully match the tenant of the request.
+	TenantRegex string `yaml:"tenant_regex"`
+
+	// ExcludeQueryPatterns are regular expressions, none of which may fully match the query.
+	ExcludeQueryPatterns []string `yaml:"exclude_query_patterns"`
+	// ExcludeUserAgent is a regular expression which may not fully match the User-Agent header.
+	ExcludeUserAgent string `yaml:"exclude_user_agent"`
+	// ExcludeDashboardUID may not be equal to the Grafana dashboard UID of the request.
+	ExcludeDashboardUID string `yaml:"exclude_dashboard_uid"`
+}
+
+// QueryAttributeCacheBypass skips results cache operations for queries matching a matcher.
+type QueryAttributeCacheBypass struct {
+	Match QueryAttributeMatcher `yaml:"match"`
+
+	// SkipRead makes matching queries ignore cached results. Their results are still cached.
+	SkipRead bool `yaml:"skip_read"`
+	// SkipWrite prevents results of matching queries from being cached.
+	SkipWrite bool `yaml:"skip_write"`
+}
+
+// QueryAttributeStaleWhileRevalidate makes the results cache serve stale results to queries matching a matcher.
+type QueryAttributeStaleWhileRevalidate struct {
+	Match QueryAttributeMatcher `yaml:"match"`
+
+	// MaxStaleness is the maximum duration at the end of the query range which may be missing from cached results
+	// served to matching queries. The missing data is then fetched asynchronously and cached. As the most recent
+	// results are never cached, it has to be longer than the max cache freshness to have any effect.
+	MaxStaleness model.Duration `yaml:"max_staleness"`
+}
+
+// QueryAttributeMinQueryStart limits how far in the past queries matching a matcher can start.
+type QueryAttributeMinQueryStart struct {
+	Match QueryAttributeMatcher `yaml:"match"`
+
+	// MaxLookback is the maximum duration before now matching queries can start at.
+	MaxLookback model.Duration `yaml:"max_lookback"`
+	// Reject rejects the range queries starting earlier, instead of clamping their start. Instant queries evaluated
+	// earlier are always rejected.
+	Reject bool `yaml:"reject"`
+}
+
+// QueryAttributeMaintenanceWindow is a scheduled maintenance window of the queries matching a matcher, during which
+// they are not sent downstream, to protect the backends during planned backfills or migrations.
+type QueryAttributeMaintenanceWindow struct {
+	Match QueryAttributeMatcher `yaml:"match"`
+
+	// Name identifies the window in the errors, the warnings and the maintenance windows endpoint.
+	Name string `yaml:"name"`
+	// Description is announced along the window, e.g. the reason of the maintenance.
+	Description string `yaml:"description"`
+	// Start and End are the RFC3339 times the window starts at and ends before.
+	Start time.Time `yaml:"start"`
+	End   time.Time `yaml:"end"`
+	// Mode is either reject, the default, to reject the requests during the window, or serve_stale to serve them
+	// from the results cache only.
+	Mode string `yaml:"mode"`
+}
+
+// ParseQueryAttributesConfig parses and validates the query attributes configuration.
+func ParseQueryAttributesConfig(content []byte) (*QueryAttributesConfig, error) {
+	cfg := &QueryAttributesConfig{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing query attributes config YAML")
+	}
+	for i, m := range cfg.Reject {
+		if _, err := m.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "reject matcher %d", i)
+		}
+	}
+	for i, o := range cfg.Overrides {
+		if _, err := o.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "override %d", i)
+		}
+	}
+	for i, b := range cfg.ResultsCacheBypass {
+		if _, err := b.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "results cache bypass %d", i)
+		}
+	}
+	for i, swr := range cfg.ResultsCacheStaleWhileRevalidate {
+		if _, err := swr.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "results cache stale while revalidate %d", i)
+		}
+	}
+	for i, mqs := range cfg.MinQueryStart {
+		if _, err := mqs.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "min query start %d", i)
+		}
+	}
+	for i, mw := range cfg.MaintenanceWindows {
+		if _, err := mw.compile(tenancy.DefaultTenantHeader); err != nil {
+			return nil, errors.Wrapf(err, "maintenance window %d", i)
+		}
+	}
+	return cfg, nil
+}
+
+type queryAttributeMatcher struct {
+	queryPatterns []*regexp.Regexp
+	userAgent     *regexp.Regexp
+	dashboardUID  string
+
+	tenantHeader string
+	tenantValues map[string]struct{}
+	tenantRegex  *regexp.Regexp
+
+	excludeQueryPatterns []*regexp.Regexp
+	excludeUserAgent     *regexp.Regexp
+	excludeDashboardUID  string
+}
+
+// compile returns the matcher with all its regular expressions compiled. The given tenant header
+// is used for tenant attributes if the matcher doesn't specify its own.
+func (m QueryAttributeMatcher) compile(defaultTenantHeader string) (*queryAttributeMatcher, error) {
+	cm := &queryAttributeMatcher{
+		dashboardUID:        m.DashboardUID,
+		tenantHeader:        m.TenantHeader,
+		excludeDashboardUID: m.ExcludeDashboardUID,
+	}
+	if cm.tenantHeader == "" {
+		cm.tenantHeader = defaultTenantHeader
+	}
+
+	for _, p := range m.QueryPatterns {
+		re, err := compileAnchored(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compile query pattern %q", p)
+		}
+		cm.queryPatterns = append(cm.queryPatterns, re)
+	}
+
+	var err error
+	if m.UserAgent != "" {
+		if cm.userAgent, err = compileAnchored(m.UserAgent); err != nil {
+			return nil, errors.Wrapf(err, "compile user agent %q", m.UserAgent)
+		}
+	}
+
+	if len(m.TenantValues) > 0 {
+		cm.tenantValues = make(map[string]struct{}, len(m.TenantValues))
+		for _, v := range m.TenantValues {
+			cm.tenantValues[v] = struct{}{}
+		}
+	}
+	if m.TenantRegex != "" {
+		if cm.tenantRegex, err = compileAnchored(m.TenantRegex); err != nil {
+			return nil, errors.Wrapf(err, "compile tenant regex %q", m.TenantRegex)
+		}
+	}
+
+	for _, p := range m.ExcludeQueryPatterns {
+		re, err := compileAnchored(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compile exclude query pattern %q", p)
+		}
+		cm.excludeQueryPatterns = append(cm.excludeQueryPatterns, re)
+	}
+	if m.ExcludeUserAgent != "" {
+		if cm.excludeUserAgent, err = compileAnchored(m.ExcludeUserAgent); err != nil {
+			return nil, errors.Wrapf(err, "compile exclude user agent %q", m.ExcludeUserAgent)
+		}
+	}
+	return cm, nil
+}
+
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func compileQueryAttributeMatchers(matchers []QueryAttributeMatcher, defaultTenantHeader string) ([]*queryAttributeMatcher, error) {
+	compiled := make([]*queryAttributeMatcher, 0, len(matchers))
+	for i, m := range matchers {
+		cm, err := m.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "matcher %d", i)
+		}
+		compiled = append(compiled, cm)
+	}
+	return compiled, nil
+}
+
+// matches returns true if the given request with the given query matches all the attributes of the matcher
+// and none of its exclusions.
+func (m *queryAttributeMatcher) matches(r *http.Request, query string) bool {
+	if len(m.queryPatterns) > 0 && !matchesAnyRegexp(m.queryPatterns, query) {
+		return false
+	}
+
+	if m.userAgent != nil && !m.userAgent.MatchString(r.UserAgent()) {
+		return false
+	}
+
+	if m.dashboardUID != "" && r.Header.Get(dashboardUIDHeader) != m.dashboardUID {
+		return false
+	}
+
+	if m.tenantValues != nil || m.tenantRegex != nil {
+		tenant := r.Header.Get(m.tenantHeader)
+		if m.tenantValues != nil {
+			if _, ok := m.tenantValues[tenant]; !ok {
+				return false
+			}
+		}
+		if m.tenantRegex != nil && !m.tenantRegex.MatchString(tenant) {
+			return false
+		}
+	}
+
+	if matchesAnyRegexp(m.excludeQueryPatterns, query) {
+		return false
+	}
+	if m.excludeUserAgent != nil && m.excludeUserAgent.MatchString(r.UserAgent()) {
+		return false
+	}
+	if m.excludeDashboardUID != "" && r.Header.Get(dashboardUIDHeader) == m.excludeDashboardUID {
+		return false
+	}
+	return true
+}
+
+// matchesTenant returns true if the given tenant matches the tenant attributes of the matcher, regardless of its
+// other attributes.
+func (m *queryAttributeMatcher) matchesTenant(tenant string) bool {
+	if m.tenantValues != nil {
+		if _, ok := m.tenantValues[tenant]; !ok {
+			return false
+		}
+	}
+	return m.tenantRegex == nil || m.tenantRegex.MatchString(tenant)
+}
+
+func matchesAnyRegexp(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(matchers []*queryAttributeMatcher, r *http.Request, query string) bool {
+	for _, m := range matchers {
+		if m.matches(r, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstMatching returns the first of the given policies whose matcher matches the request and its query.
+func firstMatching[T any](policies []T, matcher func(T) *queryAttributeMatcher, r *http.Request, query string) (T, bool) {
+	for _, p := range policies {
+		if matcher(p).matches(r, query) {
+			return p, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// newQueryAttributesTripperware returns a Tripperware passing the requests of the given operations to roundTrip, along
+// with their operation and query, once their form is parsed. All other requests are passed to the next round tripper.
+func newQueryAttributesTripperware(ops []string, roundTrip func(next http.RoundTripper, r *http.Request, op, query string) (*http.Response, error)) queryrange.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			op := getOperation(r)
+			if !slices.Contains(ops, op) {
+				return next.RoundTrip(r)
+			}
+
+			if err := api.ParseForm(r); err != nil {
+				return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+			}
+			return roundTrip(next, r, op, r.FormValue("query"))
+		})
+	}
+}
+
+// newQueryRejectionTripperware returns a Tripperware which rejects query requests matching any of
+// the given matchers, passing all other requests to the next round tripper. It must wrap the tenancy
+// conversion so that tenant attributes see the headers as sent by the client.
+func newQueryRejectionTripperware(matchers []*queryAttributeMatcher, reg prometheus.Registerer, logger log.Logger) queryrange.Tripperware {
+	rejected := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_rejected_queries_total",
+		Help: "Total number of queries rejected because they matched a reject query attribute matcher.",
+	}, []string{"op"})
+
+	return newQueryAttributesTripperware([]string{instantQueryOp, rangeQueryOp}, func(next http.RoundTripper, r *http.Request, op, query string) (*http.Response, error) {
+		if matchesAny(matchers, r, query) {
+			rejected.WithLabelValues(op).Inc()
+			level.Info(logger).Log("msg", "query rejected", "op", op, "query", query, "query_fingerprint", QueryFingerprintFromContext(r.Context()))
+			return nil, httpgrpc.Errorf(http.StatusUnprocessableEntity, "query rejected by the query-frontend: it matches a configured reject query attribute matcher")
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+type queryAttributeOverride struct {
+	matcher *queryAttributeMatcher
+
+	splitInterval time.Duration
+	maxRetries    int
+}
+
+func (o QueryAttributeOverride) compile(defaultTenantHeader string) (*queryAttributeOverride, error) {
+	if o.SplitInterval < 0 {
+		return nil, errors.New("split interval cannot be negative")
+	}
+	if o.MaxRetries < 0 {
+		return nil, errors.New("max retries cannot be negative")
+	}
+	if o.SplitInterval == 0 && o.MaxRetries == 0 {
+		return nil, errors.New("at least one of split interval and max retries has to be overridden")
+	}
+
+	m, err := o.Match.compile(defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &queryAttributeOverride{
+		matcher:       m,
+		splitInterval: time.Duration(o.SplitInterval),
+		maxRetries:    o.MaxRetries,
+	}, nil
+}
+
+func compileQueryAttributeOverrides(overrides []QueryAttributeOverride, defaultTenantHeader string) ([]*queryAttributeOverride, error) {
+	compiled := make([]*queryAttributeOverride, 0, len(overrides))
+	for i, o := range overrides {
+		co, err := o.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "override %d", i)
+		}
+		compiled = append(compiled, co)
+	}
+	return compiled, nil
+}
+
+func hasSplitIntervalOverride(overrides []*queryAttributeOverride) bool {
+	for _, o := range overrides {
+		if o.splitInterval > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMaxRetriesOverride(overrides []*queryAttributeOverride) bool {
+	for _, o := range overrides {
+		if o.maxRetries > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type queryAttributeOverrideCtxKey struct{}
+
+// queryAttributeOverrideFromContext returns the override matched by the request the context belongs to, if any.
+func queryAttributeOverrideFromContext(ctx context.Context) (*queryAttributeOverride, bool) {
+	o, ok := ctx.Value(queryAttributeOverrideCtxKey{}).(*queryAttributeOverride)
+	return o, ok
+}
+
+// newQueryOverridesTripperware returns a Tripperware which attaches the first override matching
+// a range query to the request context, so that middlewares downstream can apply it. Like the
+// rejection tripperware, it must wrap the tenancy conversion.
+func newQueryOverridesTripperware(overrides []*queryAttributeOverride) queryrange.Tripperware {
+	return newQueryAttributesTripperware([]string{rangeQueryOp}, func(next http.RoundTripper, r *http.Request, _, query string) (*http.Response, error) {
+		if o, ok := firstMatching(overrides, func(o *queryAttributeOverride) *queryAttributeMatcher { return o.matcher }, r, query); ok {
+			return next.RoundTrip(r.WithContext(context.WithValue(r.Context(), queryAttributeOverrideCtxKey{}, o)))
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+type queryAttributeCacheBypass struct {
+	matcher *queryAttributeMatcher
+	bypass  queryrange.CacheBypass
+}
+
+func (b QueryAttributeCacheBypass) compile(defaultTenantHeader string) (*queryAttributeCacheBypass, error) {
+	if !b.SkipRead && !b.SkipWrite {
+		return nil, errors.New("at least one of skip read and skip write has to be set")
+	}
+
+	m, err := b.Match.compile(defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &queryAttributeCacheBypass{
+		matcher: m,
+		bypass:  queryrange.CacheBypass{SkipRead: b.SkipRead, SkipWrite: b.SkipWrite},
+	}, nil
+}
+
+func compileQueryAttributeCacheBypasses(bypasses []QueryAttributeCacheBypass, defaultTenantHeader string) ([]*queryAttributeCacheBypass, error) {
+	compiled := make([]*queryAttributeCacheBypass, 0, len(bypasses))
+	for i, b := range bypasses {
+		cb, err := b.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "results cache bypass %d", i)
+		}
+		compiled = append(compiled, cb)
+	}
+	return compiled, nil
+}
+
+// newResultsCacheBypassTripperware returns a Tripperware which makes the results cache skip the operations
+// of all the bypasses matching a range query. Like the rejection tripperware, it must wrap the tenancy conversion.
+func newResultsCacheBypassTripperware(bypasses []*queryAttributeCacheBypass, reg prometheus.Registerer) queryrange.Tripperware {
+	bypassed := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_results_cache_bypassed_queries_total",
+		Help: "Total number of range queries which matched a results cache bypass query attribute matcher.",
+	})
+
+	return newQueryAttributesTripperware([]string{rangeQueryOp}, func(next http.RoundTripper, r *http.Request, _, query string) (*http.Response, error) {
+		var (
+			bypass  queryrange.CacheBypass
+			matched bool
+		)
+		for _, b := range bypasses {
+			if b.matcher.matches(r, query) {
+				matched = true
+				bypass.SkipRead = bypass.SkipRead || b.bypass.SkipRead
+				bypass.SkipWrite = bypass.SkipWrite || b.bypass.SkipWrite
+			}
+		}
+		if !matched {
+			return next.RoundTrip(r)
+		}
+		bypassed.Inc()
+		return next.RoundTrip(r.WithContext(queryrange.InjectCacheBypass(r.Context(), bypass)))
+	})
+}
+
+type queryAttributeStaleWhileRevalidate struct {
+	matcher      *queryAttributeMatcher
+	maxStaleness time.Duration
+}
+
+func (swr QueryAttributeStaleWhileRevalidate) compile(defaultTenantHeader string) (*queryAttributeStaleWhileRevalidate, error) {
+	if swr.MaxStaleness <= 0 {
+		return nil, errors.New("max staleness has to be positive")
+	}
+
+	m, err := swr.Match.compile(defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &queryAttributeStaleWhileRevalidate{
+		matcher:      m,
+		maxStaleness: time.Duration(swr.MaxStaleness),
+	}, nil
+}
+
+func compileQueryAttributeStaleWhileRevalidates(swrs []QueryAttributeStaleWhileRevalidate, defaultTenantHeader string) ([]*queryAttributeStaleWhileRevalidate, error) {
+	compiled := make([]*queryAttributeStaleWhileRevalidate, 0, len(swrs))
+	for i, swr := range swrs {
+		cswr, err := swr.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "results cache stale while revalidate %d", i)
+		}
+		compiled = append(compiled, cswr)
+	}
+	return compiled, nil
+}
+
+// newResultsCacheStaleWhileRevalidateTripperware returns a Tripperware which makes the results cache serve stale
+// results to range queries, with the staleness tolerated by the first matcher they match. Like the rejection
+// tripperware, it must wrap the tenancy conversion.
+func newResultsCacheStaleWhileRevalidateTripperware(swrs []*queryAttributeStaleWhileRevalidate) queryrange.Tripperware {
+	return newQueryAttributesTripperware([]string{rangeQueryOp}, func(next http.RoundTripper, r *http.Request, _, query string) (*http.Response, error) {
+		if swr, ok := firstMatching(swrs, func(swr *queryAttributeStaleWhileRevalidate) *queryAttributeMatcher { return swr.matcher }, r, query); ok {
+			return next.RoundTrip(r.WithContext(queryrange.InjectStaleWhileRevalidate(r.Context(), swr.maxStaleness)))
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// overridableRetryMiddleware returns a retry middleware which uses the maximum number of retries of the
+// query attribute override matched by the request, if any. Requests are not retried if neither the
+// override nor the given default allow retries.
+func overridableRetryMiddleware(logger log.Logger, maxRetries int, reg prometheus.Registerer) queryrange.Middleware {
+	metrics := queryrange.NewRetryMiddlewareMetrics(reg)
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		retry := queryrange.NewRetryMiddleware(logger, maxRetries, metrics).Wrap(next)
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			if o, ok := queryAttributeOverrideFromContext(ctx); ok && o.maxRetries > 0 {
+				return queryrange.NewRetryMiddleware(logger, o.maxRetries, metrics).Wrap(next).Do(ctx, r)
+			}
+			if maxRetries <= 0 {
+				return next.Do(ctx, r)
+			}
+			return retry.Do(ctx, r)
+		})
+	})
+}
+
+// addResponseWarnings adds warnings to the JSON body of a successful query response, for Grafana to display them
+// along its results. Other responses are left as is.
+func addResponseWarnings(resp *http.Response, warnings ...string) (err error) {
+	if resp.StatusCode/100 != 2 || resp.Header.Get("Content-Encoding") != "" || resp.Body == nil {
+		return nil
+	}
+	defer runutil.CloseWithErrCapture(&err, resp.Body, "close response body")
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response body")
+	}
+	var r map[string]json.RawMessage
+	if json.Unmarshal(body, &r) == nil {
+		var existing []string
+		if w, ok := r["warnings"]; ok {
+			if err := json.Unmarshal(w, &existing); err != nil {
+				return errors.Wrap(err, "decode response warnings")
+			}
+		}
+		if r["warnings"], err = json.Marshal(extannotations.DedupStrings(append(existing, warnings...))); err != nil {
+			return errors.Wrap(err, "encode response warnings")
+		}
+		if body, err = json.Marshal(r); err != nil {
+			return errors.Wrap(err, "encode response")
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
+// queryStartClampedHeader is the response header set to the start time range queries were clamped to.
+const queryStartClampedHeader = "X-Thanos-Query-Start-Clamped"
+
+type queryAttributeMinQueryStart struct {
+	matcher     *queryAttributeMatcher
+	maxLookback time.Duration
+	reject      bool
+}
+
+func (mqs QueryAttributeMinQueryStart) compile(defaultTenantHeader string) (*queryAttributeMinQueryStart, error) {
+	if mqs.MaxLookback <= 0 {
+		return nil, errors.New("max lookback has to be positive")
+	}
+
+	m, err := mqs.Match.compile(defaultTenantHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &queryAttributeMinQueryStart{
+		matcher:     m,
+		maxLookback: time.Duration(mqs.MaxLookback),
+		reject:      mqs.Reject,
+	}, nil
+}
+
+func compileQueryAttributeMinQueryStarts(mqss []QueryAttributeMinQueryStart, defaultTenantHeader string) ([]*queryAttributeMinQueryStart, error) {
+	compiled := make([]*queryAttributeMinQueryStart, 0, len(mqss))
+	for i, mqs := range mqss {
+		cmqs, err := mqs.compile(defaultTenantHeader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "min query start %d", i)
+		}
+		compiled = append(compiled, cmqs)
+	}
+	return compiled, nil
+}
+
+// newMinQueryStartTripperware returns a Tripperware which applies the minimum start time of the first matcher
+// instant and range queries match. Range queries starting earlier get their start clamped to the first step after
+// the minimum start time, reflected in the X-Thanos-Query-Start-Clamped response header, or are rejected. Instant
+// queries evaluated earlier, and range queries ending earlier, are rejected. Like the rejection tripperware, it must
+// wrap the tenancy conversion.
+func newMinQueryStartTripperware(mqss []*queryAttributeMinQueryStart, reg prometheus.Registerer, logger log.Logger) queryrange.Tripperware {
+	limited := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_min_query_start_limited_queries_total",
+		Help: "Total number of queries starting before the minimum start time of the min query start matcher they matched, by action taken.",
+	}, []string{"op", "action"})
+
+	return newQueryAttributesTripperware([]string{instantQueryOp, rangeQueryOp}, func(next http.RoundTripper, r *http.Request, op, query string) (*http.Response, error) {
+		mqs, ok := firstMatching(mqss, func(mqs *queryAttributeMinQueryStart) *queryAttributeMatcher { return mqs.matcher }, r, query)
+		if !ok {
+			return next.RoundTrip(r)
+		}
+
+		minStart := timestamp.FromTime(time.Now().Add(-mqs.maxLookback))
+		reject := func(msg string) (*http.Response, error) {
+			limited.WithLabelValues(op, "rejected").Inc()
+			level.Info(logger).Log("msg", "query rejected", "reason", msg, "op", op, "query", query, "query_fingerprint", QueryFingerprintFromContext(r.Context()))
+			return nil, httpgrpc.Errorf(http.StatusUnprocessableEntity, "query rejected by the query-frontend: %s, the minimum start time is %s", msg, timestamp.Time(minStart).Format(time.RFC3339))
+		}
+
+		if op == instantQueryOp {
+			// Instant queries without time are evaluated now.
+			if r.FormValue("time") == "" {
+				return next.RoundTrip(r)
+			}
+			ts, err := cortexutil.ParseTime(r.FormValue("time"))
+			if err != nil || ts >= minStart {
+				// Invalid parameters are reported by the codecs.
+				return next.RoundTrip(r)
+			}
+			return reject("the query is evaluated before the minimum start time")
+		}
+
+		start, err := cortexutil.ParseTime(r.FormValue("start"))
+		if err != nil || start >= minStart {
+			return next.RoundTrip(r)
+		}
+		end, err := cortexutil.ParseTime(r.FormValue("end"))
+		if err != nil {
+			return next.RoundTrip(r)
+		}
+		step, err := parseDurationMillis(r.FormValue("step"))
+		if err != nil || step <= 0 {
+			return next.RoundTrip(r)
+		}
+		if mqs.reject {
+			return reject("the query starts before the minimum start time")
+		}
+		// Keep the steps of the query aligned with its original start.
+		clampedStart := start + ((minStart-start+step-1)/step)*step
+		if clampedStart > end {
+			return reject("the query ends before the minimum start time")
+		}
+
+		limited.WithLabelValues(op, "clamped").Inc()
+		r.Form.Set("start", strconv.FormatFloat(float64(clampedStart)/1e3, 'f', -1, 64))
+		if r.Method == http.MethodGet {
+			r.URL.RawQuery = r.Form.Encode()
+		}
+		resp, err := next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+		resp.Header.Set(queryStartClampedHeader, timestamp.Time(clampedStart).Format(time.RFC3339Nano))
+		if err := addResponseWarnings(resp, fmt.Sprintf(
+			"the query-frontend moved the start of the query from %s to %s, as the query starts before the minimum start time",
+			timestamp.Time(start).Format(time.RFC3339), timestamp.Time(clampedStart).Format(time.RFC3339),
+		)); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+}
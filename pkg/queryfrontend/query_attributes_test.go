@@ -0,0 +1,465 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func newQueryAttributesTestRequest(t *testing.T, query string, headers map[string]string) *http.Request {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query?"+url.Values{"query": []string{query}}.Encode(), nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestQueryAttributeMatcher(t *testing.T) {
+	for _, tcase := range []struct {
+		name    string
+		matcher QueryAttributeMatcher
+		query   string
+		headers map[string]string
+		matches bool
+	}{
+		{
+			name:    "empty matcher matches everything",
+			query:   "up",
+			matches: true,
+		},
+		{
+			name:    "query pattern is anchored",
+			matcher: QueryAttributeMatcher{QueryPatterns: []string{"up"}},
+			query:   "sum(up)",
+			matches: false,
+		},
+		{
+			name:    "any query pattern matches",
+			matcher: QueryAttributeMatcher{QueryPatterns: []string{"foo", "sum\\(.*\\)"}},
+			query:   "sum(up)",
+			matches: true,
+		},
+		{
+			name:    "user agent and dashboard have to match",
+			matcher: QueryAttributeMatcher{UserAgent: "Grafana/.*", DashboardUID: "abc"},
+			query:   "up",
+			headers: map[string]string{"User-Agent": "Grafana/10.0.0", dashboardUIDHeader: "def"},
+			matches: false,
+		},
+		{
+			name:    "tenant values on default tenant header",
+			matcher: QueryAttributeMatcher{TenantValues: []string{"team-a", "team-b"}},
+			query:   "up",
+			headers: map[string]string{tenancy.DefaultTenantHeader: "team-b"},
+			matches: true,
+		},
+		{
+			name:    "tenant values on default tenant header not matching",
+			matcher: QueryAttributeMatcher{TenantValues: []string{"team-a"}},
+			query:   "up",
+			headers: map[string]string{tenancy.DefaultTenantHeader: "team-b"},
+			matches: false,
+		},
+		{
+			name:    "tenant regex on custom tenant header",
+			matcher: QueryAttributeMatcher{TenantHeader: "X-Scope-OrgID", TenantRegex: "team-.*"},
+			query:   "up",
+			headers: map[string]string{"X-Scope-OrgID": "team-c", tenancy.DefaultTenantHeader: "other"},
+			matches: true,
+		},
+		{
+			name:    "tenant regex with missing custom tenant header",
+			matcher: QueryAttributeMatcher{TenantHeader: "X-Scope-OrgID", TenantRegex: "team-.*"},
+			query:   "up",
+			headers: map[string]string{tenancy.DefaultTenantHeader: "team-c"},
+			matches: false,
+		},
+		{
+			name:    "excluded query pattern",
+			matcher: QueryAttributeMatcher{QueryPatterns: []string{"sum\\(.*\\)"}, ExcludeQueryPatterns: []string{".*by \\(pod\\).*"}},
+			query:   "sum(up) by (pod)",
+			matches: false,
+		},
+		{
+			name:    "not excluded query pattern",
+			matcher: QueryAttributeMatcher{QueryPatterns: []string{"sum\\(.*\\)"}, ExcludeQueryPatterns: []string{".*by \\(pod\\).*"}},
+			query:   "sum(up) by (job)",
+			matches: true,
+		},
+		{
+			name:    "exclusions alone match everything else",
+			matcher: QueryAttributeMatcher{ExcludeUserAgent: "Grafana/.*", ExcludeDashboardUID: "abc"},
+			query:   "up",
+			headers: map[string]string{"User-Agent": "curl/8.0.0", dashboardUIDHeader: "def"},
+			matches: true,
+		},
+		{
+			name:    "excluded user agent",
+			matcher: QueryAttributeMatcher{ExcludeUserAgent: "Grafana/.*"},
+			query:   "up",
+			headers: map[string]string{"User-Agent": "Grafana/10.0.0"},
+			matches: false,
+		},
+		{
+			name:    "excluded dashboard",
+			matcher: QueryAttributeMatcher{TenantValues: []string{"team-a"}, ExcludeDashboardUID: "abc"},
+			query:   "up",
+			headers: map[string]string{tenancy.DefaultTenantHeader: "team-a", dashboardUIDHeader: "abc"},
+			matches: false,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			m, err := tcase.matcher.compile(tenancy.DefaultTenantHeader)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.matches, m.matches(newQueryAttributesTestRequest(t, tcase.query, tcase.headers), tcase.query))
+		})
+	}
+}
+
+func TestParseQueryAttributesConfig(t *testing.T) {
+	cfg, err := ParseQueryAttributesConfig([]byte(`
+reject:
+  - query_patterns: ["count\\(.*\\)"]
+    tenant_header: X-Scope-OrgID
+    tenant_values: [team-a]
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		Reject: []QueryAttributeMatcher{{
+			QueryPatterns: []string{"count\\(.*\\)"},
+			TenantHeader:  "X-Scope-OrgID",
+			TenantValues:  []string{"team-a"},
+		}},
+	}, cfg)
+
+	cfg, err = ParseQueryAttributesConfig([]byte(`
+overrides:
+  - match:
+      dashboard_uid: heavy
+    split_interval: 1h
+    max_retries: 2
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		Overrides: []QueryAttributeOverride{{
+			Match:         QueryAttributeMatcher{DashboardUID: "heavy"},
+			SplitInterval: model.Duration(time.Hour),
+			MaxRetries:    2,
+		}},
+	}, cfg)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+overrides:
+  - match:
+      dashboard_uid: heavy
+`))
+	testutil.NotOk(t, err)
+
+	cfg, err = ParseQueryAttributesConfig([]byte(`
+results_cache_bypass:
+  - match:
+      query_patterns: [".*offset.*"]
+    skip_write: true
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		ResultsCacheBypass: []QueryAttributeCacheBypass{{
+			Match:     QueryAttributeMatcher{QueryPatterns: []string{".*offset.*"}},
+			SkipWrite: true,
+		}},
+	}, cfg)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+results_cache_bypass:
+  - match:
+      query_patterns: [".*offset.*"]
+`))
+	testutil.NotOk(t, err)
+
+	cfg, err = ParseQueryAttributesConfig([]byte(`
+results_cache_stale_while_revalidate:
+  - match:
+      tenant_values: [team-a]
+    max_staleness: 2m
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		ResultsCacheStaleWhileRevalidate: []QueryAttributeStaleWhileRevalidate{{
+			Match:        QueryAttributeMatcher{TenantValues: []string{"team-a"}},
+			MaxStaleness: model.Duration(2 * time.Minute),
+		}},
+	}, cfg)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+results_cache_stale_while_revalidate:
+  - match:
+      tenant_values: [team-a]
+`))
+	testutil.NotOk(t, err)
+
+	cfg, err = ParseQueryAttributesConfig([]byte(`
+min_query_start:
+  - match:
+      tenant_values: [team-a]
+    max_lookback: 30d
+    reject: true
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		MinQueryStart: []QueryAttributeMinQueryStart{{
+			Match:       QueryAttributeMatcher{TenantValues: []string{"team-a"}},
+			MaxLookback: model.Duration(30 * 24 * time.Hour),
+			Reject:      true,
+		}},
+	}, cfg)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+min_query_start:
+  - match:
+      tenant_values: [team-a]
+`))
+	testutil.NotOk(t, err)
+
+	cfg, err = ParseQueryAttributesConfig([]byte(`
+maintenance_windows:
+  - match:
+      tenant_values: [team-a]
+    name: backfill
+    description: Backfilling March.
+    start: 2024-03-01T10:00:00Z
+    end: 2024-03-01T12:00:00Z
+    mode: serve_stale
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, &QueryAttributesConfig{
+		MaintenanceWindows: []QueryAttributeMaintenanceWindow{{
+			Match:       QueryAttributeMatcher{TenantValues: []string{"team-a"}},
+			Name:        "backfill",
+			Description: "Backfilling March.",
+			Start:       time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			End:         time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			Mode:        MaintenanceWindowServeStale,
+		}},
+	}, cfg)
+
+	for _, invalid := range []string{`
+maintenance_windows:
+  - start: 2024-03-01T10:00:00Z
+    end: 2024-03-01T12:00:00Z
+`, `
+maintenance_windows:
+  - name: backfill
+    start: 2024-03-01T12:00:00Z
+    end: 2024-03-01T10:00:00Z
+`, `
+maintenance_windows:
+  - name: backfill
+    start: 2024-03-01T10:00:00Z
+    end: 2024-03-01T12:00:00Z
+    mode: degraded
+`} {
+		_, err = ParseQueryAttributesConfig([]byte(invalid))
+		testutil.NotOk(t, err)
+	}
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+reject:
+  - tenant_regex: "team-("
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+reject:
+  - exclude_user_agent: "Grafana/("
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseQueryAttributesConfig([]byte(`
+reject:
+  - unknown_field: foo
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestQueryRejectionTripperware(t *testing.T) {
+	matchers, err := compileQueryAttributeMatchers([]QueryAttributeMatcher{
+		{QueryPatterns: []string{"count\\(.*\\)"}, TenantHeader: "X-Scope-OrgID", TenantValues: []string{"team-a"}},
+	}, tenancy.DefaultTenantHeader)
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	var downstreamCalls int
+	tripper := newQueryRejectionTripperware(matchers, reg, log.NewNopLogger())(queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downstreamCalls++
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	// Matching query from a different tenant passes.
+	_, err = tripper.RoundTrip(newQueryAttributesTestRequest(t, "count(up)", map[string]string{"X-Scope-OrgID": "team-b"}))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, downstreamCalls)
+
+	// Labels requests are never evaluated.
+	_, err = tripper.RoundTrip(httptest.NewRequest(http.MethodGet, "/api/v1/labels", nil))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, downstreamCalls)
+
+	_, err = tripper.RoundTrip(newQueryAttributesTestRequest(t, "count(up)", map[string]string{"X-Scope-OrgID": "team-a"}))
+	testutil.NotOk(t, err)
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	testutil.Assert(t, ok, "expected HTTP error, got %v", err)
+	testutil.Equals(t, int32(http.StatusUnprocessableEntity), resp.Code)
+	testutil.Equals(t, 2, downstreamCalls)
+
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_query_frontend_rejected_queries_total Total number of queries rejected because they matched a reject query attribute matcher.
+# TYPE thanos_query_frontend_rejected_queries_total counter
+thanos_query_frontend_rejected_queries_total{op="query"} 1
+`), "thanos_query_frontend_rejected_queries_total"))
+}
+
+func TestResultsCacheStaleWhileRevalidateTripperware(t *testing.T) {
+	swrs, err := compileQueryAttributeStaleWhileRevalidates([]QueryAttributeStaleWhileRevalidate{
+		{Match: QueryAttributeMatcher{DashboardUID: "overview"}, MaxStaleness: model.Duration(time.Minute)},
+		{Match: QueryAttributeMatcher{QueryPatterns: []string{"sum\\(.*\\)"}}, MaxStaleness: model.Duration(2 * time.Minute)},
+	}, tenancy.DefaultTenantHeader)
+	testutil.Ok(t, err)
+
+	var staleness time.Duration
+	tripper := newResultsCacheStaleWhileRevalidateTripperware(swrs)(queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		staleness = queryrange.ExtractStaleWhileRevalidate(r.Context())
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	for _, tcase := range []struct {
+		query     string
+		dashboard string
+		expected  time.Duration
+	}{
+		{query: "up", expected: 0},
+		{query: "sum(up)", expected: 2 * time.Minute},
+		// Only the first matching tolerance is applied.
+		{query: "sum(up)", dashboard: "overview", expected: time.Minute},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+url.Values{"query": []string{tcase.query}}.Encode(), nil)
+		if tcase.dashboard != "" {
+			req.Header.Set(dashboardUIDHeader, tcase.dashboard)
+		}
+		_, err := tripper.RoundTrip(req)
+		testutil.Ok(t, err)
+		testutil.Equals(t, tcase.expected, staleness)
+	}
+}
+
+func TestMinQueryStartTripperware(t *testing.T) {
+	mqss, err := compileQueryAttributeMinQueryStarts([]QueryAttributeMinQueryStart{
+		{Match: QueryAttributeMatcher{TenantValues: []string{"basic"}}, MaxLookback: model.Duration(24 * time.Hour)},
+		{Match: QueryAttributeMatcher{TenantValues: []string{"strict"}}, MaxLookback: model.Duration(24 * time.Hour), Reject: true},
+	}, tenancy.DefaultTenantHeader)
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	var start string
+	tripper := newMinQueryStartTripperware(mqss, reg, log.NewNopLogger())(queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		start = r.FormValue("start")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"matrix","result":[]},"warnings":["partial response"]}`)),
+		}, nil
+	}))
+	warnings := func(t *testing.T, resp *http.Response) []string {
+		t.Helper()
+		var r queryrange.PrometheusResponse
+		testutil.Ok(t, json.NewDecoder(resp.Body).Decode(&r))
+		testutil.Equals(t, "success", r.Status)
+		return r.Warnings
+	}
+
+	now := time.Now().Unix()
+	rangeQuery := func(tenant string, start, end int64) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+url.Values{
+			"query": []string{"up"},
+			"start": []string{strconv.FormatInt(start, 10)},
+			"end":   []string{strconv.FormatInt(end, 10)},
+			"step":  []string{"60"},
+		}.Encode(), nil)
+		r.Header.Set(tenancy.DefaultTenantHeader, tenant)
+		return r
+	}
+	expectRejected := func(t *testing.T, err error) {
+		t.Helper()
+		testutil.NotOk(t, err)
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		testutil.Assert(t, ok, "expected HTTP error, got %v", err)
+		testutil.Equals(t, int32(http.StatusUnprocessableEntity), resp.Code)
+	}
+
+	// Queries of other tenants, or within the lookback, are left as they are.
+	twoDaysAgo := now - 2*86400
+	resp, err := tripper.RoundTrip(rangeQuery("premium", twoDaysAgo, now))
+	testutil.Ok(t, err)
+	testutil.Equals(t, strconv.FormatInt(twoDaysAgo, 10), start)
+	testutil.Equals(t, "", resp.Header.Get(queryStartClampedHeader))
+	testutil.Equals(t, []string{"partial response"}, warnings(t, resp))
+	_, err = tripper.RoundTrip(rangeQuery("basic", now-3600, now))
+	testutil.Ok(t, err)
+	testutil.Equals(t, strconv.FormatInt(now-3600, 10), start)
+
+	// Earlier starts are clamped to the first step after the minimum start time.
+	resp, err = tripper.RoundTrip(rangeQuery("basic", twoDaysAgo, now))
+	testutil.Ok(t, err)
+	clamped, err := strconv.ParseInt(start, 10, 64)
+	testutil.Ok(t, err)
+	testutil.Assert(t, clamped >= now-86400 && clamped < now-86400+60+5, "unexpected clamped start %d", clamped)
+	testutil.Equals(t, int64(0), (clamped-twoDaysAgo)%60)
+	testutil.Equals(t, time.Unix(clamped, 0).UTC().Format(time.RFC3339Nano), resp.Header.Get(queryStartClampedHeader))
+	// The clamped start is also reported in the warnings of the response, which Grafana displays.
+	testutil.Equals(t, []string{
+		"partial response",
+		fmt.Sprintf("the query-frontend moved the start of the query from %s to %s, as the query starts before the minimum start time",
+			time.Unix(twoDaysAgo, 0).UTC().Format(time.RFC3339), time.Unix(clamped, 0).UTC().Format(time.RFC3339)),
+	}, warnings(t, resp))
+
+	_, err = tripper.RoundTrip(rangeQuery("basic", twoDaysAgo, twoDaysAgo+3600))
+	expectRejected(t, err)
+	_, err = tripper.RoundTrip(rangeQuery("strict", twoDaysAgo, now))
+	expectRejected(t, err)
+
+	instant := newQueryAttributesTestRequest(t, "up", map[string]string{tenancy.DefaultTenantHeader: "basic"})
+	instant.URL.RawQuery += "&time=" + strconv.FormatInt(twoDaysAgo, 10)
+	_, err = tripper.RoundTrip(instant)
+	expectRejected(t, err)
+	_, err = tripper.RoundTrip(newQueryAttributesTestRequest(t, "up", map[string]string{tenancy.DefaultTenantHeader: "basic"}))
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_query_frontend_min_query_start_limited_queries_total Total number of queries starting before the minimum start time of the min query start matcher they matched, by action taken.
+# TYPE thanos_query_frontend_min_query_start_limited_queries_total counter
+thanos_query_frontend_min_query_start_limited_queries_total{action="clamped",op="query_range"} 1
+thanos_query_frontend_min_query_start_limited_queries_total{action="rejected",op="query"} 1
+thanos_query_frontend_min_query_start_limited_queries_total{action="rejected",op="query_range"} 2
+`), "thanos_query_frontend_min_query_start_limited_queries_total"))
+}
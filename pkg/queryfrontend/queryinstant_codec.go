@@ -24,13 +24,16 @@ import (
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
 	"github.com/thanos-io/thanos/internal/cortex/util/spanlogger"
+	"github.com/thanos-io/thanos/pkg/api"
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
+	"github.com/thanos-io/thanos/pkg/extannotations"
 	"github.com/thanos-io/thanos/pkg/extpromql"
 )
 
 // queryInstantCodec is used to encode/decode Thanos instant query requests and responses.
 type queryInstantCodec struct {
 	partialResponse bool
+	requestEncoding RequestEncoding
 }
 
 // NewThanosQueryInstantCodec initializes a queryInstantCodec.
@@ -55,8 +58,13 @@ func (c queryInstantCodec) MergeResponse(req queryrange.Request, responses ...qu
 		promResponses = append(promResponses, resp.(*queryrange.PrometheusInstantQueryResponse))
 	}
 
-	var analyzes []*queryrange.Analysis
+	var (
+		analyzes []*queryrange.Analysis
+		warnings []string
+	)
 	for i := range promResponses {
+		// Shards of the same query usually return the same warnings, e.g. of partial responses.
+		warnings = append(warnings, promResponses[i].Warnings...)
 		if promResponses[i].Data.GetAnalysis() == nil {
 			continue
 		}
@@ -79,6 +87,7 @@ func (c queryInstantCodec) MergeResponse(req queryrange.Request, responses ...qu
 				Analysis: queryrange.AnalyzesMerge(analyzes...),
 				Stats:    queryrange.StatsMerge(responses),
 			},
+			Warnings: extannotations.DedupStrings(warnings),
 		}
 	default:
 		v, err := vectorMerge(req, promResponses)
@@ -97,17 +106,27 @@ func (c queryInstantCodec) MergeResponse(req queryrange.Request, responses ...qu
 				Analysis: queryrange.AnalyzesMerge(analyzes...),
 				Stats:    queryrange.StatsMerge(responses),
 			},
+			Warnings: extannotations.DedupStrings(warnings),
 		}
 	}
 
 	return res, nil
 }
 
+// WithRequestEncoding sets the encoding of the requests sent downstream, and returns the codec.
+func (c *queryInstantCodec) WithRequestEncoding(enc RequestEncoding) *queryInstantCodec {
+	c.requestEncoding = enc
+	return c
+}
+
 func (c queryInstantCodec) DecodeRequest(_ context.Context, r *http.Request, forwardHeaders []string) (queryrange.Request, error) {
 	var (
 		result ThanosQueryInstantRequest
 		err    error
 	)
+	if err := api.ParseForm(r); err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
 	if len(r.FormValue("time")) > 0 {
 		result.Time, err = cortexutil.ParseTime(r.FormValue("time"))
 		if err != nil {
@@ -161,6 +180,11 @@ func (c queryInstantCodec) DecodeRequest(_ context.Context, r *http.Request, for
 		return nil, err
 	}
 
+	result.StitchWindow, err = parseLookbackDelta(r.Form, queryv1.StitchWindowParam)
+	if err != nil {
+		return nil, err
+	}
+
 	result.Query = r.FormValue("query")
 	result.Path = r.URL.Path
 	result.Engine = r.FormValue("engine")
@@ -218,11 +242,14 @@ func (c queryInstantCodec) EncodeRequest(ctx context.Context, r queryrange.Reque
 		params[queryv1.LookbackDeltaParam] = []string{encodeDurationMillis(thanosReq.LookbackDelta)}
 	}
 
-	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
+	if thanosReq.StitchWindow > 0 {
+		params[queryv1.StitchWindowParam] = []string{encodeDurationMillis(thanosReq.StitchWindow)}
+	}
+
+	req, err := newPostRequest(thanosReq.Path, params, c.requestEncoding)
 	if err != nil {
-		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	for _, hv := range thanosReq.Headers {
 		for _, v := range hv.Values {
 			req.Header.Add(hv.Name, v)
@@ -391,6 +391,43 @@ func TestMergeResponse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "merge warnings of two responses",
+			req:  defaultReq,
+			resps: []queryrange.Response{
+				&queryrange.PrometheusInstantQueryResponse{
+					Status: queryrange.StatusSuccess,
+					Data: queryrange.PrometheusInstantQueryData{
+						ResultType: model.ValVector.String(),
+						Result: queryrange.PrometheusInstantQueryResult{
+							Result: &queryrange.PrometheusInstantQueryResult_Vector{Vector: &queryrange.Vector{}},
+						},
+					},
+					Warnings: []string{"partial response", "store unavailable"},
+				},
+				&queryrange.PrometheusInstantQueryResponse{
+					Status: queryrange.StatusSuccess,
+					Data: queryrange.PrometheusInstantQueryData{
+						ResultType: model.ValVector.String(),
+						Result: queryrange.PrometheusInstantQueryResult{
+							Result: &queryrange.PrometheusInstantQueryResult_Vector{Vector: &queryrange.Vector{}},
+						},
+					},
+					Warnings: []string{"partial response"},
+				},
+			},
+			expectedResp: &queryrange.PrometheusInstantQueryResponse{
+				Status: queryrange.StatusSuccess,
+				Data: queryrange.PrometheusInstantQueryData{
+					ResultType: model.ValVector.String(),
+					Result: queryrange.PrometheusInstantQueryResult{
+						Result: &queryrange.PrometheusInstantQueryResult_Vector{Vector: &queryrange.Vector{Samples: []*queryrange.Sample{}}},
+					},
+					Analysis: &queryrange.Analysis{},
+				},
+				Warnings: []string{"partial response", "store unavailable"},
+			},
+		},
 		{
 			name: "merge two responses with sort",
 			req: &queryrange.PrometheusRequest{
@@ -20,6 +20,7 @@ import (
 
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
+	"github.com/thanos-io/thanos/pkg/api"
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/extpromql"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -40,10 +41,21 @@ var (
 	errCannotParse    = "cannot parse parameter %s"
 )
 
+// RequestEncoding is the encoding of the parameters of the POST requests sent downstream.
+type RequestEncoding string
+
+const (
+	// FormRequestEncoding encodes the parameters as an URL encoded form.
+	FormRequestEncoding RequestEncoding = "form"
+	// JSONRequestEncoding encodes the parameters as a JSON object, see api.EncodeJSONParams.
+	JSONRequestEncoding RequestEncoding = "json"
+)
+
 // queryRangeCodec is used to encode/decode Thanos query range requests and responses.
 type queryRangeCodec struct {
 	queryrange.Codec
 	partialResponse bool
+	requestEncoding RequestEncoding
 }
 
 // NewThanosQueryRangeCodec initializes a queryRangeCodec.
@@ -54,11 +66,20 @@ func NewThanosQueryRangeCodec(partialResponse bool) *queryRangeCodec {
 	}
 }
 
+// WithRequestEncoding sets the encoding of the requests sent downstream, and returns the codec.
+func (c *queryRangeCodec) WithRequestEncoding(enc RequestEncoding) *queryRangeCodec {
+	c.requestEncoding = enc
+	return c
+}
+
 func (c queryRangeCodec) DecodeRequest(_ context.Context, r *http.Request, forwardHeaders []string) (queryrange.Request, error) {
 	var (
 		result ThanosQueryRangeRequest
 		err    error
 	)
+	if err := api.ParseForm(r); err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
 	result.Start, err = cortexutil.ParseTime(r.FormValue("start"))
 	if err != nil {
 		return nil, err
@@ -127,6 +148,11 @@ func (c queryRangeCodec) DecodeRequest(_ context.Context, r *http.Request, forwa
 		return nil, err
 	}
 
+	result.StitchWindow, err = parseLookbackDelta(r.Form, queryv1.StitchWindowParam)
+	if err != nil {
+		return nil, err
+	}
+
 	result.Query = r.FormValue("query")
 	if len(r.FormValue(queryv1.QueryAnalyzeParam)) > 0 {
 		result.Analyze, err = strconv.ParseBool(r.FormValue(queryv1.QueryAnalyzeParam))
@@ -196,11 +222,14 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 		params[queryv1.LookbackDeltaParam] = []string{encodeDurationMillis(thanosReq.LookbackDelta)}
 	}
 
-	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
+	if thanosReq.StitchWindow > 0 {
+		params[queryv1.StitchWindowParam] = []string{encodeDurationMillis(thanosReq.StitchWindow)}
+	}
+
+	req, err := newPostRequest(thanosReq.Path, params, c.requestEncoding)
 	if err != nil {
-		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	for _, hv := range thanosReq.Headers {
 		for _, v := range hv.Values {
 			req.Header.Add(hv.Name, v)
@@ -209,6 +238,25 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 	return req.WithContext(ctx), nil
 }
 
+// newPostRequest returns a POST request to the given path, with the given parameters in its body, encoded as a form
+// unless enc is JSONRequestEncoding.
+func newPostRequest(path string, params url.Values, enc RequestEncoding) (*http.Request, error) {
+	contentType, body := "application/x-www-form-urlencoded", []byte(params.Encode())
+	if enc == JSONRequestEncoding {
+		var err error
+		if body, err = api.EncodeJSONParams(params); err != nil {
+			return nil, httpgrpc.Errorf(http.StatusBadRequest, "error encoding request: %s", err.Error())
+		}
+		contentType = api.JSONContentType
+	}
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
 func parseDurationMillis(s string) (int64, error) {
 	if d, err := strconv.ParseFloat(s, 64); err == nil {
 		ts := d * float64(time.Second/time.Millisecond)
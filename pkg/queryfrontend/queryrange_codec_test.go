@@ -7,6 +7,7 @@ package queryfrontend
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/prometheus/model/labels"
@@ -181,6 +182,20 @@ func TestQueryRangeCodec_DecodeRequest(t *testing.T) {
 				StoreMatchers: [][]*labels.Matcher{},
 			},
 		},
+		{
+			name:            "resolution_stitch_window",
+			url:             `/api/v1/query_range?start=123&end=456&step=1&resolution_stitch_window=1h`,
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StitchWindow:  3600000,
+				StoreMatchers: [][]*labels.Matcher{},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			r, err := http.NewRequest(http.MethodGet, tc.url, nil)
@@ -298,6 +313,21 @@ func TestQueryRangeCodec_EncodeRequest(t *testing.T) {
 					r.FormValue(queryv1.LookbackDeltaParam) == "1"
 			},
 		},
+		{
+			name: "Stitch window",
+			req: &ThanosQueryRangeRequest{
+				Start:        123000,
+				End:          456000,
+				Step:         1000,
+				StitchWindow: 3600000,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.StitchWindowParam) == "3600"
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			// Default partial response value doesn't matter when encoding requests.
@@ -335,3 +365,51 @@ func BenchmarkQueryRangeCodecEncodeAndDecodeRequest(b *testing.B) {
 		testutil.Ok(b, err)
 	}
 }
+
+func TestQueryRangeCodec_JSONRequestEncoding(t *testing.T) {
+	codec := NewThanosQueryRangeCodec(true).WithRequestEncoding(JSONRequestEncoding)
+	req := &ThanosQueryRangeRequest{
+		Path:                "/api/v1/query_range",
+		Start:               123000,
+		End:                 456000,
+		Step:                1000,
+		Query:               "up",
+		Dedup:               true,
+		PartialResponse:     true,
+		MaxSourceResolution: 300000,
+		ReplicaLabels:       []string{"replica", "rule_replica"},
+		StoreMatchers:       [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "cluster", "a")}},
+	}
+	httpReq, err := codec.EncodeRequest(context.Background(), req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "application/json", httpReq.Header.Get("Content-Type"))
+
+	// Requests with a JSON body are decoded like form encoded ones, whatever the encoding of the codec.
+	decoded, err := NewThanosQueryRangeCodec(false).DecodeRequest(context.Background(), httpReq, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, req, decoded)
+
+	body := `{"query": "up", "start": 123, "end": "456", "step": 1, "dedup": true, "replicaLabels[]": ["replica"]}`
+	httpReq, err = http.NewRequest(http.MethodPost, "/api/v1/query_range?partial_response=true", strings.NewReader(body))
+	testutil.Ok(t, err)
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	decoded, err = codec.DecodeRequest(context.Background(), httpReq, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &ThanosQueryRangeRequest{
+		Path:            "/api/v1/query_range",
+		Start:           123000,
+		End:             456000,
+		Step:            1000,
+		Query:           "up",
+		Dedup:           true,
+		PartialResponse: true,
+		ReplicaLabels:   []string{"replica"},
+		StoreMatchers:   [][]*labels.Matcher{},
+	}, decoded)
+
+	httpReq, err = http.NewRequest(http.MethodPost, "/api/v1/query_range", strings.NewReader(`{"query": {"expr": "up"}}`))
+	testutil.Ok(t, err)
+	httpReq.Header.Set("Content-Type", "application/json")
+	_, err = codec.DecodeRequest(context.Background(), httpReq, nil)
+	testutil.NotOk(t, err)
+}
@@ -55,6 +55,7 @@ type ThanosQueryRangeRequest struct {
 	Stats               string
 	ShardInfo           *storepb.ShardInfo
 	LookbackDelta       int64
+	StitchWindow        int64
 	Analyze             bool
 	Engine              string
 }
@@ -156,6 +157,7 @@ type ThanosQueryInstantRequest struct {
 	Stats               string
 	ShardInfo           *storepb.ShardInfo
 	LookbackDelta       int64 // in milliseconds.
+	StitchWindow        int64 // in milliseconds.
 	Analyze             bool
 	Engine              string
 }
@@ -17,9 +17,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
 
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	"github.com/thanos-io/thanos/internal/cortex/util/validation"
+	"github.com/thanos-io/thanos/pkg/api"
 )
 
 const (
@@ -53,15 +55,47 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 		}
 	}
 
-	queryRangeCodec := NewThanosQueryRangeCodec(config.QueryRangeConfig.PartialResponseStrategy)
-	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.DefaultTimeRange)
-	queryInstantCodec := NewThanosQueryInstantCodec(config.QueryRangeConfig.PartialResponseStrategy)
+	if forwarded := config.HeaderPolicy.headers(HeaderForward); len(forwarded) > 0 {
+		config.ForwardHeaders = append(append([]string{}, config.ForwardHeaders...), forwarded...)
+	}
+	stripped := config.HeaderPolicy.headers(HeaderStrip)
+
+	queryRangeCodec := NewThanosQueryRangeCodec(config.QueryRangeConfig.PartialResponseStrategy).WithRequestEncoding(config.DownstreamRequestEncoding)
+	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.DefaultTimeRange).WithRequestEncoding(config.DownstreamRequestEncoding)
+	queryInstantCodec := NewThanosQueryInstantCodec(config.QueryRangeConfig.PartialResponseStrategy).WithRequestEncoding(config.DownstreamRequestEncoding)
+
+	var overrides []*queryAttributeOverride
+	if config.QueryAttributes != nil && len(config.QueryAttributes.Overrides) > 0 {
+		overrides, err = compileQueryAttributeOverrides(config.QueryAttributes.Overrides, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile query attribute overrides")
+		}
+	}
+
+	var resultsCacheBypassTripperware queryrange.Tripperware
+	if config.QueryAttributes != nil && len(config.QueryAttributes.ResultsCacheBypass) > 0 {
+		bypasses, err := compileQueryAttributeCacheBypasses(config.QueryAttributes.ResultsCacheBypass, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile results cache bypass query attribute matchers")
+		}
+		resultsCacheBypassTripperware = newResultsCacheBypassTripperware(bypasses, reg)
+	}
+
+	var resultsCacheStaleWhileRevalidateTripperware queryrange.Tripperware
+	if config.QueryAttributes != nil && len(config.QueryAttributes.ResultsCacheStaleWhileRevalidate) > 0 {
+		swrs, err := compileQueryAttributeStaleWhileRevalidates(config.QueryAttributes.ResultsCacheStaleWhileRevalidate, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile results cache stale while revalidate query attribute matchers")
+		}
+		resultsCacheStaleWhileRevalidateTripperware = newResultsCacheStaleWhileRevalidateTripperware(swrs)
+	}
 
 	queryRangeTripperware, err := newQueryRangeTripperware(
 		config.QueryRangeConfig,
 		queryRangeLimits,
 		queryRangeCodec,
 		config.NumShards,
+		overrides,
 		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_range"}, reg), logger, config.ForwardHeaders)
 	if err != nil {
 		return nil, err
@@ -72,14 +106,56 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 	if err != nil {
 		return nil, err
 	}
-	queryInstantTripperware := newInstantQueryTripperware(
+	queryInstantTripperware, err := newInstantQueryTripperware(
 		config.NumShards,
 		queryRangeLimits,
 		queryInstantCodec,
 		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_instant"}, reg),
+		logger,
 		config.ForwardHeaders,
 	)
+	if err != nil {
+		return nil, err
+	}
+	var queryRejectionTripperware queryrange.Tripperware
+	if config.QueryAttributes != nil && len(config.QueryAttributes.Reject) > 0 {
+		rejectMatchers, err := compileQueryAttributeMatchers(config.QueryAttributes.Reject, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile reject query attribute matchers")
+		}
+		queryRejectionTripperware = newQueryRejectionTripperware(rejectMatchers, reg, logger)
+	}
+
+	var minQueryStartTripperware queryrange.Tripperware
+	if config.QueryAttributes != nil && len(config.QueryAttributes.MinQueryStart) > 0 {
+		mqss, err := compileQueryAttributeMinQueryStarts(config.QueryAttributes.MinQueryStart, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile min query start query attribute matchers")
+		}
+		minQueryStartTripperware = newMinQueryStartTripperware(mqss, reg, logger)
+	}
+
+	var maintenanceWindowsTripperware queryrange.Tripperware
+	if config.QueryAttributes != nil && len(config.QueryAttributes.MaintenanceWindows) > 0 {
+		mws, err := compileQueryAttributeMaintenanceWindows(config.QueryAttributes.MaintenanceWindows, config.TenantHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile maintenance window query attribute matchers")
+		}
+		maintenanceWindowsTripperware = newMaintenanceWindowsTripperware(mws, reg, logger)
+	}
+
+	customTripperwares, err := newCustomTripperwares(prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "frontend"}, reg), logger)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(next http.RoundTripper) http.RoundTripper {
+		if len(stripped) > 0 {
+			next = newHeaderStripRoundTripper(stripped, next)
+		}
+		if maintenanceWindowsTripperware != nil {
+			next = newMaintenanceWindowsDownstreamGuard(next)
+		}
 		tripper := newRoundTripper(
 			next,
 			queryRangeTripperware(next),
@@ -87,10 +163,48 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 			queryInstantTripperware(next),
 			reg,
 		)
-		return tenancy.InternalTenancyConversionTripper(config.TenantHeader, config.TenantCertField, tripper)
+		var rt http.RoundTripper = tenancy.InternalTenancyConversionTripper(config.TenantHeader, config.TenantCertField, tripper)
+		if len(overrides) > 0 {
+			rt = newQueryOverridesTripperware(overrides)(rt)
+		}
+		if resultsCacheBypassTripperware != nil {
+			rt = resultsCacheBypassTripperware(rt)
+		}
+		if resultsCacheStaleWhileRevalidateTripperware != nil {
+			rt = resultsCacheStaleWhileRevalidateTripperware(rt)
+		}
+		if minQueryStartTripperware != nil {
+			rt = minQueryStartTripperware(rt)
+		}
+		if queryRejectionTripperware != nil {
+			rt = queryRejectionTripperware(rt)
+		}
+		if maintenanceWindowsTripperware != nil {
+			rt = maintenanceWindowsTripperware(rt)
+		}
+		rt = newQueryFingerprintTripperware()(rt)
+		for i := len(customTripperwares) - 1; i >= 0; i-- {
+			rt = customTripperwares[i](rt)
+		}
+		return newJSONRequestTripperware()(rt)
 	}, nil
 }
 
+// newJSONRequestTripperware returns a Tripperware parsing the parameters of requests with a JSON body upfront, so
+// that all the tripperwares get them like the ones of form encoded requests. It must wrap all the tripperwares.
+func newJSONRequestTripperware() queryrange.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if api.IsJSONRequest(r) {
+				if err := api.ParseForm(r); err != nil {
+					return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+				}
+			}
+			return next.RoundTrip(r)
+		})
+	}
+}
+
 type roundTripper struct {
 	next, queryInstant, queryRange, labels http.RoundTripper
 
@@ -162,6 +276,7 @@ func newQueryRangeTripperware(
 	limits queryrange.Limits,
 	codec *queryRangeCodec,
 	numShards int,
+	overrides []*queryAttributeOverride,
 	reg prometheus.Registerer,
 	logger log.Logger,
 	forwardHeaders []string,
@@ -169,6 +284,12 @@ func newQueryRangeTripperware(
 	queryRangeMiddleware := []queryrange.Middleware{queryrange.NewLimitsMiddleware(limits)}
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
 
+	custom, err := newCustomMiddlewares(SlotQueryRangeFirst, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	queryRangeMiddleware = append(queryRangeMiddleware, custom...)
+
 	// step align middleware.
 	if config.AlignRangeWithStep {
 		queryRangeMiddleware = append(
@@ -189,6 +310,15 @@ func newQueryRangeTripperware(
 	if config.SplitQueriesByInterval != 0 || config.MinQuerySplitInterval != 0 {
 		queryIntervalFn := dynamicIntervalFn(config)
 
+		queryRangeMiddleware = append(
+			queryRangeMiddleware,
+			queryrange.InstrumentMiddleware("split_by_interval", m),
+			SplitByIntervalMiddleware(queryIntervalFn, limits, codec, reg),
+		)
+	} else if hasSplitIntervalOverride(overrides) {
+		// Only split the queries matching an override.
+		queryIntervalFn := func(_ queryrange.Request) time.Duration { return 0 }
+
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("split_by_interval", m),
@@ -204,6 +334,12 @@ func newQueryRangeTripperware(
 		)
 	}
 
+	custom, err = newCustomMiddlewares(SlotQueryRangeBeforeCache, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	queryRangeMiddleware = append(queryRangeMiddleware, custom...)
+
 	if config.ResultsCacheConfig != nil {
 		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
 			logger,
@@ -227,14 +363,20 @@ func newQueryRangeTripperware(
 		)
 	}
 
-	if config.MaxRetries > 0 {
+	if config.MaxRetries > 0 || hasMaxRetriesOverride(overrides) {
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("retry", m),
-			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+			overridableRetryMiddleware(logger, config.MaxRetries, reg),
 		)
 	}
 
+	custom, err = newCustomMiddlewares(SlotQueryRangeLast, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	queryRangeMiddleware = append(queryRangeMiddleware, custom...)
+
 	return func(next http.RoundTripper) http.RoundTripper {
 		rt := queryrange.NewRoundTripper(next, codec, forwardHeaders, queryRangeMiddleware...)
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
@@ -275,8 +417,11 @@ func newLabelsTripperware(
 	logger log.Logger,
 	forwardHeaders []string,
 ) (queryrange.Tripperware, error) {
-	labelsMiddleware := []queryrange.Middleware{}
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
+	labelsMiddleware, err := newCustomMiddlewares(SlotLabelsFirst, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	queryIntervalFn := func(_ queryrange.Request) time.Duration {
 		return config.SplitQueriesByInterval
@@ -321,6 +466,13 @@ func newLabelsTripperware(
 			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
 		)
 	}
+
+	custom, err := newCustomMiddlewares(SlotLabelsLast, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	labelsMiddleware = append(labelsMiddleware, custom...)
+
 	return func(next http.RoundTripper) http.RoundTripper {
 		rt := queryrange.NewRoundTripper(next, codec, forwardHeaders, labelsMiddleware...)
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
@@ -334,10 +486,14 @@ func newInstantQueryTripperware(
 	limits queryrange.Limits,
 	codec queryrange.Codec,
 	reg prometheus.Registerer,
+	logger log.Logger,
 	forwardHeaders []string,
-) queryrange.Tripperware {
-	instantQueryMiddlewares := []queryrange.Middleware{}
+) (queryrange.Tripperware, error) {
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
+	instantQueryMiddlewares, err := newCustomMiddlewares(SlotQueryInstantFirst, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
 	if numShards > 0 {
 		analyzer := querysharding.NewQueryAnalyzer()
 		instantQueryMiddlewares = append(
@@ -347,12 +503,18 @@ func newInstantQueryTripperware(
 		)
 	}
 
+	custom, err := newCustomMiddlewares(SlotQueryInstantLast, m, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	instantQueryMiddlewares = append(instantQueryMiddlewares, custom...)
+
 	return func(next http.RoundTripper) http.RoundTripper {
 		rt := queryrange.NewRoundTripper(next, codec, forwardHeaders, instantQueryMiddlewares...)
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
 			return rt.RoundTrip(r)
 		})
-	}
+	}, nil
 }
 
 // shouldCache controls what kind of Thanos request should be cached.
@@ -390,6 +390,123 @@ func TestRoundTripSplitIntervalMiddleware(t *testing.T) {
 	}
 }
 
+func TestRoundTripQueryAttributeOverrides(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+		Query: "foo",
+	}
+	otherRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+		Query: "bar",
+	}
+
+	queryRangeCodec := NewThanosQueryRangeCodec(true)
+	overrides := []QueryAttributeOverride{
+		{Match: QueryAttributeMatcher{DashboardUID: "heavy"}, MaxRetries: 3},
+		{Match: QueryAttributeMatcher{QueryPatterns: []string{"foo"}}, SplitInterval: model.Duration(30 * time.Minute)},
+	}
+
+	for _, tc := range []struct {
+		name          string
+		splitInterval time.Duration
+		maxRetries    int
+		req           queryrange.Request
+		headers       map[string]string
+		fail          bool
+		expected      int
+	}{
+		{
+			name:     "matching override splits the query",
+			req:      testRequest,
+			expected: 4,
+		},
+		{
+			name:          "matching override takes precedence over the configured split interval",
+			splitInterval: time.Hour,
+			req:           testRequest,
+			expected:      4,
+		},
+		{
+			name:          "not matching query keeps the configured split interval",
+			splitInterval: time.Hour,
+			req:           otherRequest,
+			expected:      2,
+		},
+		{
+			name:     "not matching query is not split",
+			req:      otherRequest,
+			expected: 1,
+		},
+		{
+			name:     "matching override retries the query",
+			req:      otherRequest,
+			headers:  map[string]string{dashboardUIDHeader: "heavy"},
+			fail:     true,
+			expected: 3,
+		},
+		{
+			name:       "only the first matching override is applied",
+			maxRetries: 1,
+			req:        testRequest,
+			headers:    map[string]string{dashboardUIDHeader: "heavy"},
+			fail:       true,
+			expected:   3,
+		},
+		{
+			name:       "not matching query keeps the configured retries",
+			maxRetries: 1,
+			req:        otherRequest,
+			fail:       true,
+			expected:   1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpw, err := NewTripperware(
+				Config{
+					QueryRangeConfig: QueryRangeConfig{
+						Limits:                 defaultLimits,
+						SplitQueriesByInterval: tc.splitInterval,
+						MaxRetries:             tc.maxRetries,
+					},
+					LabelsConfig: LabelsConfig{
+						Limits: defaultLimits,
+					},
+					QueryAttributes: &QueryAttributesConfig{Overrides: overrides},
+				}, nil, log.NewNopLogger(),
+			)
+			testutil.Ok(t, err)
+
+			rt, err := newFakeRoundTripper()
+			testutil.Ok(t, err)
+			defer rt.Close()
+			res, handler := promqlResults(tc.fail)
+			rt.setHandler(handler)
+
+			ctx := user.InjectOrgID(context.Background(), "1")
+			httpReq, err := queryRangeCodec.EncodeRequest(ctx, tc.req)
+			testutil.Ok(t, err)
+			for k, v := range tc.headers {
+				httpReq.Header.Set(k, v)
+			}
+
+			_, err = tpw(rt).RoundTrip(httpReq)
+			if tc.fail {
+				testutil.NotOk(t, err)
+			} else {
+				testutil.Ok(t, err)
+			}
+
+			testutil.Equals(t, tc.expected, *res)
+		})
+	}
+}
+
 // TestRoundTripQueryRangeCacheMiddleware tests the cache middleware.
 func TestRoundTripQueryRangeCacheMiddleware(t *testing.T) {
 	testRequest := &ThanosQueryRangeRequest{
@@ -528,6 +645,83 @@ func TestRoundTripQueryRangeCacheMiddleware(t *testing.T) {
 	}
 }
 
+func TestRoundTripQueryRangeCacheBypass(t *testing.T) {
+	newRequest := func(query string) *ThanosQueryRangeRequest {
+		return &ThanosQueryRangeRequest{
+			Path:  "/api/v1/query_range",
+			Start: 0,
+			End:   2 * hour,
+			Step:  10 * seconds,
+			Dedup: true,
+			Query: query,
+		}
+	}
+
+	cacheConf := &queryrange.ResultsCacheConfig{
+		CacheConfig: cortexcache.Config{
+			EnableFifoCache: true,
+			Fifocache: cortexcache.FifoCacheConfig{
+				MaxSizeBytes: "1MiB",
+				MaxSizeItems: 1000,
+				Validity:     time.Hour,
+			},
+		},
+	}
+
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				Limits:                 defaultLimits,
+				ResultsCacheConfig:     cacheConf,
+				SplitQueriesByInterval: day,
+			},
+			QueryAttributes: &QueryAttributesConfig{
+				ResultsCacheBypass: []QueryAttributeCacheBypass{
+					{Match: QueryAttributeMatcher{DashboardUID: "fresh"}, SkipRead: true},
+					{Match: QueryAttributeMatcher{DashboardUID: "once"}, SkipWrite: true},
+				},
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := promqlResults(false)
+	rt.setHandler(handler)
+
+	for _, tc := range []struct {
+		name      string
+		req       queryrange.Request
+		dashboard string
+		expected  int
+	}{
+		{name: "skip read request", req: newRequest("foo"), dashboard: "fresh", expected: 1},
+		{name: "skip read request doesn't use cache", req: newRequest("foo"), dashboard: "fresh", expected: 2},
+		{name: "skip read request results were cached", req: newRequest("foo"), expected: 2},
+		{name: "skip write request", req: newRequest("bar"), dashboard: "once", expected: 3},
+		{name: "skip write request results were not cached", req: newRequest("bar"), expected: 4},
+		{name: "skip write request uses cache", req: newRequest("bar"), dashboard: "once", expected: 4},
+	} {
+		if !t.Run(tc.name, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "1")
+			httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, tc.req)
+			testutil.Ok(t, err)
+			if tc.dashboard != "" {
+				httpReq.Header.Set(dashboardUIDHeader, tc.dashboard)
+			}
+
+			_, err = tpw(rt).RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, *res)
+		}) {
+			break
+		}
+	}
+}
+
 func TestRoundTripQueryCacheWithShardingMiddleware(t *testing.T) {
 	testRequest := &ThanosQueryRangeRequest{
 		Path:    "/api/v1/query_range",
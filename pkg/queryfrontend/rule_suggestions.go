@@ -0,0 +1,368 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+
+	"github.com/thanos-io/thanos/pkg/extpromql"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+const (
+	defaultRuleSuggestionsLimit    = 10
+	defaultRuleSuggestionsMinCount = 2
+	defaultRuleSuggestionsInterval = time.Minute
+
+	ruleSuggestionsGroupName = "suggested-recording-rules"
+)
+
+// RuleSuggestionsHandler suggests recording rules covering the heaviest repeated queries of the slow query report.
+// Queries already covered by existing recording rules, according to the rules API of the downstream, are suggested
+// to be substituted by the recorded series.
+type RuleSuggestionsHandler struct {
+	logger     log.Logger
+	report     *SlowQueryReport
+	downstream http.RoundTripper
+}
+
+// NewRuleSuggestionsHandler returns a RuleSuggestionsHandler for the given report, fetching the existing recording
+// rules with the given downstream RoundTripper.
+func NewRuleSuggestionsHandler(logger log.Logger, report *SlowQueryReport, downstream http.RoundTripper) *RuleSuggestionsHandler {
+	return &RuleSuggestionsHandler{logger: logger, report: report, downstream: downstream}
+}
+
+// RuleSuggestion is a suggestion to record a slow query, or to substitute it by an existing recording rule.
+type RuleSuggestion struct {
+	Fingerprint  string  `json:"fingerprint"`
+	Query        string  `json:"query"`
+	Count        int     `json:"count"`
+	TotalSeconds float64 `json:"totalSeconds"`
+	AvgSeconds   float64 `json:"avgSeconds"`
+	// ExistingRule is the name of the existing recording rule with the same fingerprint as the query, if any.
+	ExistingRule string `json:"existingRule,omitempty"`
+	// Record is the suggested name of the recording rule of the query, if there is no existing one.
+	Record string `json:"record,omitempty"`
+	// EstimatedSavedSecondsPerHour is the query time saved per hour by querying the recorded series instead,
+	// minus the cost of evaluating the recording rule at the configured interval.
+	EstimatedSavedSecondsPerHour float64 `json:"estimatedSavedSecondsPerHour"`
+}
+
+type ruleSuggestionsResponse struct {
+	Status    string                 `json:"status"`
+	Data      *ruleSuggestionsResult `json:"data,omitempty"`
+	ErrorType string                 `json:"errorType,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+type ruleSuggestionsResult struct {
+	Interval    string           `json:"interval"`
+	Suggestions []RuleSuggestion `json:"suggestions"`
+}
+
+type suggestedRuleGroups struct {
+	Groups []suggestedRuleGroup `yaml:"groups"`
+}
+
+type suggestedRuleGroup struct {
+	Name     string          `yaml:"name"`
+	Interval model.Duration  `yaml:"interval"`
+	Rules    []suggestedRule `yaml:"rules"`
+}
+
+type suggestedRule struct {
+	Record string `yaml:"record"`
+	Expr   string `yaml:"expr"`
+}
+
+func (h *RuleSuggestionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant, err := tenancy.GetTenantFromHTTP(r, h.report.tenantHeader, h.report.defaultTenant, h.report.tenantCertField)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	limit, minCount := defaultRuleSuggestionsLimit, defaultRuleSuggestionsMinCount
+	if v := r.FormValue("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			h.writeError(w, http.StatusBadRequest, "bad_data", errors.Errorf("invalid limit %q, must be a positive integer", v))
+			return
+		}
+	}
+	if v := r.FormValue("min_count"); v != "" {
+		if minCount, err = strconv.Atoi(v); err != nil || minCount <= 0 {
+			h.writeError(w, http.StatusBadRequest, "bad_data", errors.Errorf("invalid min_count %q, must be a positive integer", v))
+			return
+		}
+	}
+	interval := defaultRuleSuggestionsInterval
+	if v := r.FormValue("interval"); v != "" {
+		d, err := model.ParseDuration(v)
+		if err != nil || d <= 0 {
+			h.writeError(w, http.StatusBadRequest, "bad_data", errors.Errorf("invalid interval %q, must be a positive duration", v))
+			return
+		}
+		interval = time.Duration(d)
+	}
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "yaml" {
+		h.writeError(w, http.StatusBadRequest, "bad_data", errors.Errorf("unsupported format %q, expected \"json\" or \"yaml\"", format))
+		return
+	}
+
+	existing, err := h.recordingRules(r)
+	if err != nil {
+		h.writeError(w, http.StatusServiceUnavailable, "unavailable", errors.Wrap(err, "fetch recording rules"))
+		return
+	}
+
+	suggestions := suggestRecordingRules(h.report.Stats(tenant), existing, h.report.now(), interval, minCount, limit)
+	if format == "yaml" {
+		group := suggestedRuleGroup{Name: ruleSuggestionsGroupName, Interval: model.Duration(interval), Rules: []suggestedRule{}}
+		for _, s := range suggestions {
+			if s.Record != "" {
+				group.Rules = append(group.Rules, suggestedRule{Record: s.Record, Expr: s.Query})
+			}
+		}
+		b, err := yaml.Marshal(suggestedRuleGroups{Groups: []suggestedRuleGroup{group}})
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, "internal", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(b)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, ruleSuggestionsResponse{
+		Status: "success",
+		Data:   &ruleSuggestionsResult{Interval: model.Duration(interval).String(), Suggestions: suggestions},
+	})
+}
+
+func (h *RuleSuggestionsHandler) writeError(w http.ResponseWriter, code int, errorType string, err error) {
+	h.writeJSON(w, code, ruleSuggestionsResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+func (h *RuleSuggestionsHandler) writeJSON(w http.ResponseWriter, code int, resp ruleSuggestionsResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		level.Warn(h.logger).Log("msg", "failed to write rule suggestions response", "err", err)
+	}
+}
+
+// recordingRules returns the expressions of the existing recording rules by their fingerprint, using the rules API of the downstream.
+func (h *RuleSuggestionsHandler) recordingRules(r *http.Request) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, (&url.URL{Path: "/api/v1/rules", RawQuery: "type=record"}).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Forward the headers of the request, e.g. its tenant.
+	req.Header = r.Header.Clone()
+	req.Header.Del("Accept-Encoding")
+
+	resp, err := h.downstream.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(h.logger, resp.Body, "rules response body")
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, errors.Errorf("rules API returned HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var rulesResp struct {
+		Data struct {
+			Groups []struct {
+				Rules []struct {
+					Type  string `json:"type"`
+					Name  string `json:"name"`
+					Query string `json:"query"`
+				} `json:"rules"`
+			} `json:"groups"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rulesResp); err != nil {
+		return nil, errors.Wrap(err, "decode rules response")
+	}
+
+	rules := map[string]string{}
+	for _, g := range rulesResp.Data.Groups {
+		for _, rule := range g.Rules {
+			if rule.Type == "recording" {
+				rules[queryFingerprint(rule.Query)] = rule.Name
+			}
+		}
+	}
+	return rules, nil
+}
+
+// suggestRecordingRules returns the suggestions for the heaviest queries seen at least minCount times, given the
+// names of the existing recording rules by the fingerprint of their expression.
+func suggestRecordingRules(stats []SlowQueryStats, existing map[string]string, now time.Time, interval time.Duration, minCount, limit int) []RuleSuggestion {
+	names := make(map[string]struct{}, len(existing))
+	for _, name := range existing {
+		names[name] = struct{}{}
+	}
+
+	suggestions := []RuleSuggestion{}
+	for _, s := range stats {
+		if len(suggestions) >= limit {
+			break
+		}
+		if s.Count < minCount {
+			continue
+		}
+
+		suggestion := RuleSuggestion{
+			Fingerprint:  s.Fingerprint,
+			Query:        s.Query,
+			Count:        s.Count,
+			TotalSeconds: s.Duration.Seconds(),
+			AvgSeconds:   s.Duration.Seconds() / float64(s.Count),
+		}
+
+		// The hourly rate of the queries is estimated since the first one was seen.
+		hours := max(now.Sub(s.FirstSeen), time.Minute).Hours()
+		observedPerHour := s.Duration.Seconds() / hours
+		if name, ok := existing[s.Fingerprint]; ok {
+			suggestion.ExistingRule = name
+			suggestion.EstimatedSavedSecondsPerHour = observedPerHour
+			suggestions = append(suggestions, suggestion)
+			continue
+		}
+
+		expr, err := extpromql.ParseExpr(s.Query)
+		if err != nil || !recordable(expr) {
+			continue
+		}
+		// Evaluating the rule costs about as much as a single step of the queries.
+		evalPerHour := s.Duration.Seconds() / float64(max(s.Steps, 1)) * time.Hour.Seconds() / interval.Seconds()
+		if observedPerHour <= evalPerHour {
+			continue
+		}
+		suggestion.EstimatedSavedSecondsPerHour = observedPerHour - evalPerHour
+
+		name := suggestedRecordName(expr)
+		if _, ok := names[name]; ok {
+			name = fmt.Sprintf("%s_%.8s", name, s.Fingerprint)
+		}
+		names[name] = struct{}{}
+		suggestion.Record = name
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions
+}
+
+// recordable returns true if recording the expression is worth it, i.e. it is an instant vector expression
+// which isn't a plain selector, and doesn't depend on the evaluation time with the @ modifier.
+func recordable(expr parser.Expr) bool {
+	if expr.Type() != parser.ValueTypeVector {
+		return false
+	}
+	if _, ok := unwrapParens(expr).(*parser.VectorSelector); ok {
+		return false
+	}
+	ok := true
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			ok = ok && n.Timestamp == nil && n.StartOrEnd == 0
+		case *parser.SubqueryExpr:
+			ok = ok && n.Timestamp == nil && n.StartOrEnd == 0
+		}
+		return nil
+	})
+	return ok
+}
+
+func unwrapParens(expr parser.Expr) parser.Expr {
+	for {
+		p, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.Expr
+	}
+}
+
+// suggestedRecordName returns a name for the recording rule of the expression following the level:metric:operations
+// convention of recording rules, e.g. job:http_requests_total:rate5m_sum for sum by (job) (rate(http_requests_total[5m])).
+// The level is omitted for aggregations without grouping labels.
+func suggestedRecordName(expr parser.Expr) string {
+	var (
+		lvl, metric string
+		ops         []string
+	)
+	if agg, ok := unwrapParens(expr).(*parser.AggregateExpr); ok && !agg.Without {
+		lvl = strings.Join(agg.Grouping, "_")
+	}
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.AggregateExpr:
+			ops = append(ops, n.Op.String())
+		case *parser.Call:
+			op := n.Func.Name
+			for _, arg := range n.Args {
+				if ms, ok := unwrapParens(arg).(*parser.MatrixSelector); ok {
+					op += model.Duration(ms.Range).String()
+				}
+			}
+			ops = append(ops, op)
+		case *parser.VectorSelector:
+			if metric == "" {
+				metric = n.Name
+				if metric == "" {
+					for _, m := range n.LabelMatchers {
+						if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+							metric = m.Value
+						}
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if metric == "" {
+		metric = "query"
+	}
+	// Operations are listed from the innermost to the outermost one.
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	if len(ops) == 0 {
+		ops = []string{"expr"}
+	}
+
+	parts := []string{metric, strings.Join(ops, "_")}
+	if lvl != "" {
+		parts = append([]string{lvl}, parts...)
+	}
+	return sanitizeMetricName(strings.Join(parts, ":"))
+}
+
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,203 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/extpromql"
+)
+
+func TestSlowQueryReport(t *testing.T) {
+	now := time.Unix(0, 0)
+	report := NewSlowQueryReport(time.Second, 2, "THANOS-TENANT", "default-tenant", "")
+	report.now = func() time.Time { return now }
+
+	// The downstream takes the duration of the query parameter "took".
+	downstream := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		took, err := time.ParseDuration(r.FormValue("took"))
+		testutil.Ok(t, err)
+		now = now.Add(took)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	rt := report.Tripperware()(newQueryFingerprintTripperware()(downstream))
+
+	query := func(path, tenant, query, took string, extra url.Values) {
+		t.Helper()
+		params := url.Values{"query": {query}, "took": {took}}
+		for k, v := range extra {
+			params[k] = v
+		}
+		req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+		if tenant != "" {
+			req.Header.Set("THANOS-TENANT", tenant)
+		}
+		_, err := rt.RoundTrip(req)
+		testutil.Ok(t, err)
+	}
+
+	query("/api/v1/query", "", `sum(rate(http_requests_total{job="a"}[5m]))`, "2s", nil)
+	query("/api/v1/query_range", "", `sum(rate(http_requests_total{job="b"}[5m]))`, "3s", url.Values{"start": {"0"}, "end": {"3600"}, "step": {"60"}})
+	query("/api/v1/query", "", `sum(rate(http_requests_total{job="a"}[5m]))`, "1s", nil)
+	// Queries faster than the threshold are not reported.
+	query("/api/v1/query", "", `up`, "10ms", nil)
+	query("/api/v1/query", "team-a", `up`, "5s", nil)
+
+	stats := report.Stats("default-tenant")
+	testutil.Equals(t, 1, len(stats))
+	testutil.Equals(t, queryFingerprint(`sum(rate(http_requests_total{job="c"}[5m]))`), stats[0].Fingerprint)
+	testutil.Equals(t, `sum(rate(http_requests_total{job="a"}[5m]))`, stats[0].Query)
+	testutil.Equals(t, 3, stats[0].Count)
+	testutil.Equals(t, 6*time.Second, stats[0].Duration)
+	testutil.Equals(t, int64(1+61+1), stats[0].Steps)
+
+	testutil.Equals(t, 1, len(report.Stats("team-a")))
+
+	// The report is full, the cheapest fingerprint is evicted for more expensive ones only.
+	query("/api/v1/query", "", `count(up)`, "1s", nil)
+	testutil.Equals(t, 1, len(report.Stats("default-tenant")))
+	query("/api/v1/query", "", `count(up)`, "10s", nil)
+	testutil.Equals(t, 0, len(report.Stats("team-a")))
+	stats = report.Stats("default-tenant")
+	testutil.Equals(t, 2, len(stats))
+	testutil.Equals(t, `count(up)`, stats[0].Query)
+}
+
+func TestSuggestedRecordName(t *testing.T) {
+	for _, tcase := range []struct {
+		expr string
+		want string
+	}{
+		{expr: `sum by (job) (rate(http_requests_total{code="500"}[5m]))`, want: "job:http_requests_total:rate5m_sum"},
+		{expr: `sum by (job, instance) (rate(http_requests_total[1h]))`, want: "job_instance:http_requests_total:rate1h_sum"},
+		{expr: `(sum(irate({__name__="node_cpu_seconds_total"}[1m])))`, want: "node_cpu_seconds_total:irate1m_sum"},
+		{expr: `histogram_quantile(0.99, sum by (le) (rate(latency_bucket[5m])))`, want: "latency_bucket:rate5m_sum_histogram_quantile"},
+		{expr: `max without (instance) (up)`, want: "up:max"},
+		{expr: `up == 0`, want: "up:expr"},
+	} {
+		t.Run(tcase.expr, func(t *testing.T) {
+			expr, err := extpromql.ParseExpr(tcase.expr)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.want, suggestedRecordName(expr))
+		})
+	}
+}
+
+func TestRuleSuggestionsHandler(t *testing.T) {
+	now := time.Unix(0, 0)
+	report := NewSlowQueryReport(time.Second, 10, "THANOS-TENANT", "default-tenant", "")
+	report.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		report.observe("default-tenant", queryFingerprint(`sum by (job) (rate(http_requests_total[5m]))`), `sum by (job) (rate(http_requests_total[5m]))`, 5*time.Second, 100)
+		report.observe("default-tenant", queryFingerprint(`sum(rate(errors_total[5m]))`), `sum(rate(errors_total[5m]))`, 4*time.Second, 1)
+		// Instant queries repeated less often than the rule would be evaluated don't pay off.
+		report.observe("default-tenant", queryFingerprint(`count(rate(cheap_total[5m]))`), `count(rate(cheap_total[5m]))`, 3*time.Second, 1)
+		report.observe("default-tenant", queryFingerprint(`up`), `up`, 2*time.Second, 1)
+		report.observe("team-a", queryFingerprint(`avg(up)`), `avg(up)`, 2*time.Second, 1)
+	}
+	report.observe("default-tenant", queryFingerprint(`max(once)`), `max(once)`, time.Minute, 1)
+	now = now.Add(time.Hour)
+
+	var (
+		rulesRequest *http.Request
+		rulesStatus  = http.StatusOK
+	)
+	downstream := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rulesRequest = r
+		body := `{"status":"success","data":{"groups":[{"name":"g","rules":[
+			{"type":"recording","name":"errors:rate5m_sum","query":"sum(rate(errors_total[5m]))"},
+			{"type":"alerting","name":"HighLatency","query":"sum by (job) (rate(http_requests_total[5m])) > 0"}
+		]}]}}`
+		return &http.Response{StatusCode: rulesStatus, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+	handler := NewRuleSuggestionsHandler(log.NewNopLogger(), report, downstream)
+
+	get := func(params string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/rule_suggestions?"+params, nil)
+		req.Header.Set("THANOS-TENANT", "default-tenant")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("json", func(t *testing.T) {
+		w := get("interval=30s")
+		testutil.Equals(t, http.StatusOK, w.Code)
+
+		testutil.Equals(t, "/api/v1/rules", rulesRequest.URL.Path)
+		testutil.Equals(t, "record", rulesRequest.URL.Query().Get("type"))
+		testutil.Equals(t, "default-tenant", rulesRequest.Header.Get("THANOS-TENANT"))
+
+		var resp ruleSuggestionsResponse
+		testutil.Ok(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		testutil.Equals(t, "success", resp.Status)
+		testutil.Equals(t, "30s", resp.Data.Interval)
+		testutil.Equals(t, 2, len(resp.Data.Suggestions))
+
+		s := resp.Data.Suggestions[0]
+		testutil.Equals(t, queryFingerprint(`sum by (job) (rate(http_requests_total[5m]))`), s.Fingerprint)
+		testutil.Equals(t, `sum by (job) (rate(http_requests_total[5m]))`, s.Query)
+		testutil.Equals(t, 10, s.Count)
+		testutil.Equals(t, 50.0, s.TotalSeconds)
+		testutil.Equals(t, 5.0, s.AvgSeconds)
+		testutil.Equals(t, "job:http_requests_total:rate5m_sum", s.Record)
+		testutil.Equals(t, "", s.ExistingRule)
+		// 50s of queries per hour, against 120 evaluations of a single step of 0.05s.
+		testutil.Assert(t, math.Abs(s.EstimatedSavedSecondsPerHour-44) < 1e-9, "unexpected savings %v", s.EstimatedSavedSecondsPerHour)
+
+		s = resp.Data.Suggestions[1]
+		testutil.Equals(t, `sum(rate(errors_total[5m]))`, s.Query)
+		testutil.Equals(t, "errors:rate5m_sum", s.ExistingRule)
+		testutil.Equals(t, "", s.Record)
+		testutil.Equals(t, 40.0, s.EstimatedSavedSecondsPerHour)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		w := get("format=yaml&limit=1&interval=2m")
+		testutil.Equals(t, http.StatusOK, w.Code)
+		testutil.Equals(t, `groups:
+    - name: suggested-recording-rules
+      interval: 2m
+      rules:
+        - record: job:http_requests_total:rate5m_sum
+          expr: sum by (job) (rate(http_requests_total[5m]))
+`, w.Body.String())
+	})
+
+	t.Run("min count", func(t *testing.T) {
+		// Rules evaluated less often pay off for queries seen less often.
+		w := get("min_count=1&interval=2h")
+		testutil.Equals(t, http.StatusOK, w.Code)
+
+		var resp ruleSuggestionsResponse
+		testutil.Ok(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		testutil.Equals(t, 4, len(resp.Data.Suggestions))
+		testutil.Equals(t, "once:max", resp.Data.Suggestions[0].Record)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, params := range []string{"limit=0", "min_count=x", "interval=-1m", "format=xml"} {
+			testutil.Equals(t, http.StatusBadRequest, get(params).Code)
+		}
+	})
+
+	t.Run("rules API failure", func(t *testing.T) {
+		rulesStatus = http.StatusInternalServerError
+		defer func() { rulesStatus = http.StatusOK }()
+		testutil.Equals(t, http.StatusServiceUnavailable, get("").Code)
+	})
+}
@@ -0,0 +1,212 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// maxReportedQueriesPerFingerprint is the maximum number of distinct queries tracked for a fingerprint.
+const maxReportedQueriesPerFingerprint = 10
+
+// SlowQueryReport aggregates the cost of the slow queries of every tenant by their fingerprint.
+// At most a maximum number of fingerprints are tracked, the cheapest ones are evicted first.
+type SlowQueryReport struct {
+	threshold       time.Duration
+	maxFingerprints int
+
+	tenantHeader    string
+	defaultTenant   string
+	tenantCertField string
+
+	now func() time.Time
+
+	mtx     sync.Mutex
+	entries map[slowQueryKey]*slowQueryEntry
+}
+
+type slowQueryKey struct {
+	tenant      string
+	fingerprint string
+}
+
+type slowQueryEntry struct {
+	firstSeen, lastSeen time.Time
+
+	count    int
+	duration time.Duration
+	// steps is the total number of steps of the queries, 1 for instant queries.
+	steps int64
+	// queries counts the distinct queries of the fingerprint.
+	queries map[string]int
+}
+
+// SlowQueryStats are the aggregated statistics of the slow queries with the same fingerprint.
+type SlowQueryStats struct {
+	Fingerprint string
+	// Query is the most frequent query of the fingerprint.
+	Query string
+	// Count is the number of slow queries, Duration their total duration.
+	Count    int
+	Duration time.Duration
+	// Steps is the total number of steps of the queries, 1 for instant queries.
+	Steps               int64
+	FirstSeen, LastSeen time.Time
+}
+
+// NewSlowQueryReport returns a report of the queries slower than the given threshold, tracking at most maxFingerprints fingerprints.
+func NewSlowQueryReport(threshold time.Duration, maxFingerprints int, tenantHeader, defaultTenant, tenantCertField string) *SlowQueryReport {
+	return &SlowQueryReport{
+		threshold:       threshold,
+		maxFingerprints: maxFingerprints,
+		tenantHeader:    tenantHeader,
+		defaultTenant:   defaultTenant,
+		tenantCertField: tenantCertField,
+		now:             time.Now,
+		entries:         map[slowQueryKey]*slowQueryEntry{},
+	}
+}
+
+// Tripperware returns a Tripperware recording the instant and range queries slower than the threshold of the report.
+// It relies on the fingerprint of the queries set by the query frontend Tripperware, which it must wrap.
+func (s *SlowQueryReport) Tripperware() queryrange.Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			op := getOperation(r)
+			if op != instantQueryOp && op != rangeQueryOp {
+				return next.RoundTrip(r)
+			}
+
+			if err := api.ParseForm(r); err != nil {
+				return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+			}
+
+			start := s.now()
+			resp, err := next.RoundTrip(r)
+			if err != nil || resp.StatusCode/100 != 2 {
+				return resp, err
+			}
+			duration := s.now().Sub(start)
+			fp := resp.Header.Get(queryFingerprintHeader)
+			if duration < s.threshold || fp == "" {
+				return resp, nil
+			}
+
+			tenant, terr := tenancy.GetTenantFromHTTP(r, s.tenantHeader, s.defaultTenant, s.tenantCertField)
+			if terr != nil {
+				return resp, nil
+			}
+			steps := int64(1)
+			if op == rangeQueryOp {
+				steps = rangeQuerySteps(r)
+			}
+			s.observe(tenant, fp, r.FormValue("query"), duration, steps)
+			return resp, nil
+		})
+	}
+}
+
+// rangeQuerySteps returns the number of steps of the range query request, 1 if its parameters can't be parsed.
+func rangeQuerySteps(r *http.Request) int64 {
+	start, err := cortexutil.ParseTime(r.FormValue("start"))
+	if err != nil {
+		return 1
+	}
+	end, err := cortexutil.ParseTime(r.FormValue("end"))
+	if err != nil {
+		return 1
+	}
+	step, err := parseDurationMillis(r.FormValue("step"))
+	if err != nil || step <= 0 || end < start {
+		return 1
+	}
+	return (end-start)/step + 1
+}
+
+func (s *SlowQueryReport) observe(tenant, fingerprint, query string, duration time.Duration, steps int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.now()
+	key := slowQueryKey{tenant: tenant, fingerprint: fingerprint}
+	e, ok := s.entries[key]
+	if !ok {
+		if len(s.entries) >= s.maxFingerprints {
+			if !s.evict(duration) {
+				return
+			}
+		}
+		e = &slowQueryEntry{firstSeen: now, queries: map[string]int{}}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	e.count++
+	e.duration += duration
+	e.steps += steps
+	if _, ok := e.queries[query]; ok || len(e.queries) < maxReportedQueriesPerFingerprint {
+		e.queries[query]++
+	}
+}
+
+// evict removes the fingerprint with the lowest total duration, if it is lower than the given one.
+func (s *SlowQueryReport) evict(duration time.Duration) bool {
+	var (
+		cheapest slowQueryKey
+		found    bool
+	)
+	for k, e := range s.entries {
+		if e.duration < duration && (!found || e.duration < s.entries[cheapest].duration) {
+			cheapest, found = k, true
+		}
+	}
+	if found {
+		delete(s.entries, cheapest)
+	}
+	return found
+}
+
+// Stats returns the statistics of the slow queries of the tenant, sorted by decreasing total duration.
+func (s *SlowQueryReport) Stats(tenant string) []SlowQueryStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var res []SlowQueryStats
+	for k, e := range s.entries {
+		if k.tenant != tenant {
+			continue
+		}
+		stats := SlowQueryStats{
+			Fingerprint: k.fingerprint,
+			Count:       e.count,
+			Duration:    e.duration,
+			Steps:       e.steps,
+			FirstSeen:   e.firstSeen,
+			LastSeen:    e.lastSeen,
+		}
+		maxCount := 0
+		for q, c := range e.queries {
+			if c > maxCount || (c == maxCount && q < stats.Query) {
+				stats.Query, maxCount = q, c
+			}
+		}
+		res = append(res, stats)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Duration != res[j].Duration {
+			return res[i].Duration > res[j].Duration
+		}
+		return res[i].Fingerprint < res[j].Fingerprint
+	})
+	return res
+}
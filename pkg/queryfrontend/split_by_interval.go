@@ -46,7 +46,16 @@ type splitByInterval struct {
 func (s splitByInterval) Do(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
 	// First we're going to build new requests, one for each day, taking care
 	// to line up the boundaries with step.
-	reqs, err := splitQuery(r, s.interval(r))
+	interval := s.interval(r)
+	if o, ok := queryAttributeOverrideFromContext(ctx); ok && o.splitInterval > 0 {
+		interval = o.splitInterval
+	}
+	// Splitting might be enabled only for the requests matching a query attribute override.
+	if interval <= 0 {
+		return s.next.Do(ctx, r)
+	}
+
+	reqs, err := splitQuery(r, interval)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,320 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/extpromql"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// AggregatorLabelName is the name of the label identifying the receive instance which computed an aggregated series.
+// Every receive instance aggregates the samples it received, so aggregated series have to be summed across instances.
+const AggregatorLabelName = "receive_aggregator"
+
+const (
+	// AggregationSum sums the last value of every input series.
+	AggregationSum = "sum"
+	// AggregationCount counts the input series.
+	AggregationCount = "count"
+)
+
+const defaultAggregationInterval = model.Duration(time.Minute)
+
+// AggregationConfig configures a streaming aggregation of the series received from clients.
+type AggregationConfig struct {
+	// Tenants are the tenants the aggregation applies to. Empty means all the tenants.
+	Tenants []string `yaml:"tenants"`
+	// Match is the series selector of the input series.
+	Match string `yaml:"match"`
+	// Record is the metric name of the aggregated series.
+	Record string `yaml:"record"`
+	// Op is the aggregation operation, either "sum" or "count".
+	Op string `yaml:"op"`
+	// By are the labels of the input series the aggregated series are grouped by.
+	By []string `yaml:"by"`
+	// Interval is the interval the aggregated series are written at.
+	Interval model.Duration `yaml:"interval"`
+	// DropInput drops the input series, so that only the aggregated ones are written.
+	DropInput bool `yaml:"drop_input"`
+}
+
+// ParseAggregationConfigs parses and validates the streaming aggregation configuration.
+func ParseAggregationConfigs(content []byte) ([]*AggregationConfig, error) {
+	var configs []*AggregationConfig
+	if err := yaml.UnmarshalStrict(content, &configs); err != nil {
+		return nil, errors.Wrap(err, "parsing config YAML file")
+	}
+
+	for i, c := range configs {
+		if _, err := extpromql.ParseMetricSelector(c.Match); err != nil {
+			return nil, errors.Wrapf(err, "aggregation %d: parse match %q", i, c.Match)
+		}
+		if !model.IsValidMetricName(model.LabelValue(c.Record)) {
+			return nil, errors.Errorf("aggregation %d: invalid record metric name %q", i, c.Record)
+		}
+		if c.Op != AggregationSum && c.Op != AggregationCount {
+			return nil, errors.Errorf("aggregation %d: unsupported op %q, expected %q or %q", i, c.Op, AggregationSum, AggregationCount)
+		}
+		for _, l := range c.By {
+			if !model.LabelName(l).IsValid() || l == labels.MetricName || l == AggregatorLabelName {
+				return nil, errors.Errorf("aggregation %d: invalid by label %q", i, l)
+			}
+		}
+		if c.Interval < 0 {
+			return nil, errors.Errorf("aggregation %d: negative interval", i)
+		}
+		if c.Interval == 0 {
+			c.Interval = defaultAggregationInterval
+		}
+	}
+	return configs, nil
+}
+
+// AggregatesWriteFunc writes the aggregated series of a tenant.
+type AggregatesWriteFunc func(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error
+
+// Aggregator computes streaming aggregations of the series received from clients. Aggregated series
+// are written every aggregation interval, with the last value of every input series of the interval.
+type Aggregator struct {
+	logger       log.Logger
+	aggregations []*aggregation
+	// aggregatorLabel identifies this receive instance in the aggregated series, empty if unset.
+	aggregatorLabel string
+
+	inputSamples  *prometheus.CounterVec
+	droppedSeries *prometheus.CounterVec
+	outputSeries  *prometheus.CounterVec
+	writeFailures *prometheus.CounterVec
+}
+
+type aggregation struct {
+	tenants   map[string]struct{}
+	matchers  []*labels.Matcher
+	record    string
+	op        string
+	by        []string
+	interval  time.Duration
+	dropInput bool
+
+	mtx sync.Mutex
+	// groups holds the aggregated series of every tenant, by the hash of their labels.
+	groups map[string]map[uint64]*aggregationGroup
+}
+
+type aggregationGroup struct {
+	lset labels.Labels
+	// values holds the last value of every input series, by the hash of their labels.
+	values map[uint64]float64
+}
+
+// NewAggregator returns an Aggregator computing the given aggregations. The aggregator label is added to
+// the aggregated series, to tell apart the ones computed by different receive instances.
+func NewAggregator(logger log.Logger, reg prometheus.Registerer, configs []*AggregationConfig, aggregatorLabel string) (*Aggregator, error) {
+	a := &Aggregator{
+		logger:          logger,
+		aggregatorLabel: aggregatorLabel,
+		inputSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_aggregation_input_samples_total",
+			Help: "The total number of samples aggregated by streaming aggregations.",
+		}, []string{"tenant"}),
+		droppedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_aggregation_dropped_series_total",
+			Help: "The total number of received series dropped after being aggregated.",
+		}, []string{"tenant"}),
+		outputSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_aggregation_output_series_total",
+			Help: "The total number of aggregated series written by streaming aggregations.",
+		}, []string{"tenant"}),
+		writeFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_aggregation_write_failures_total",
+			Help: "The total number of failed writes of aggregated series.",
+		}, []string{"tenant"}),
+	}
+
+	for i, c := range configs {
+		matchers, err := extpromql.ParseMetricSelector(c.Match)
+		if err != nil {
+			return nil, errors.Wrapf(err, "aggregation %d: parse match %q", i, c.Match)
+		}
+		ag := &aggregation{
+			matchers:  matchers,
+			record:    c.Record,
+			op:        c.Op,
+			by:        c.By,
+			interval:  time.Duration(c.Interval),
+			dropInput: c.DropInput,
+			groups:    map[string]map[uint64]*aggregationGroup{},
+		}
+		if ag.interval <= 0 {
+			ag.interval = time.Duration(defaultAggregationInterval)
+		}
+		if len(c.Tenants) > 0 {
+			ag.tenants = make(map[string]struct{}, len(c.Tenants))
+			for _, t := range c.Tenants {
+				ag.tenants[t] = struct{}{}
+			}
+		}
+		a.aggregations = append(a.aggregations, ag)
+	}
+	return a, nil
+}
+
+// Aggregate adds the float samples of the series in the write request to the aggregations they match.
+// Matching series of aggregations dropping their input are removed from the write request.
+func (a *Aggregator) Aggregate(tenant string, wreq *prompb.WriteRequest) {
+	dropped := 0
+	timeSeries := make([]prompb.TimeSeries, 0, len(wreq.Timeseries))
+	for _, ts := range wreq.Timeseries {
+		if len(ts.Samples) == 0 {
+			timeSeries = append(timeSeries, ts)
+			continue
+		}
+
+		var (
+			lset = labelpb.ZLabelsToPromLabels(ts.Labels)
+			drop bool
+		)
+		for _, ag := range a.aggregations {
+			if !ag.matches(tenant, lset) {
+				continue
+			}
+			// Samples of a series are sorted by time, the last one is the most recent.
+			ag.add(tenant, lset, ts.Samples[len(ts.Samples)-1].Value)
+			a.inputSamples.WithLabelValues(tenant).Add(float64(len(ts.Samples)))
+			drop = drop || ag.dropInput
+		}
+		if drop {
+			dropped++
+			continue
+		}
+		timeSeries = append(timeSeries, ts)
+	}
+	if dropped > 0 {
+		a.droppedSeries.WithLabelValues(tenant).Add(float64(dropped))
+	}
+	wreq.Timeseries = timeSeries
+}
+
+// Run writes the aggregated series with the given function at every aggregation interval, until the context is canceled.
+func (a *Aggregator) Run(ctx context.Context, write AggregatesWriteFunc) error {
+	var wg sync.WaitGroup
+	for _, ag := range a.aggregations {
+		wg.Add(1)
+		go func(ag *aggregation) {
+			defer wg.Done()
+
+			_ = runutil.Repeat(ag.interval, ctx.Done(), func() error {
+				a.flush(ctx, ag, time.Now(), write)
+				return nil
+			})
+		}(ag)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (a *Aggregator) flush(ctx context.Context, ag *aggregation, t time.Time, write AggregatesWriteFunc) {
+	for tenant, series := range ag.flush(t, a.aggregatorLabel) {
+		if err := write(ctx, tenant, &prompb.WriteRequest{Timeseries: series}); err != nil {
+			level.Warn(a.logger).Log("msg", "failed to write aggregated series", "tenant", tenant, "record", ag.record, "err", err)
+			a.writeFailures.WithLabelValues(tenant).Inc()
+			continue
+		}
+		a.outputSeries.WithLabelValues(tenant).Add(float64(len(series)))
+	}
+}
+
+func (ag *aggregation) matches(tenant string, lset labels.Labels) bool {
+	if ag.tenants != nil {
+		if _, ok := ag.tenants[tenant]; !ok {
+			return false
+		}
+	}
+	for _, m := range ag.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ag *aggregation) add(tenant string, lset labels.Labels, v float64) {
+	b := labels.NewScratchBuilder(len(ag.by) + 1)
+	b.Add(labels.MetricName, ag.record)
+	for _, l := range ag.by {
+		if lv := lset.Get(l); lv != "" {
+			// Labels of write requests reference the request buffer, which is reused.
+			b.Add(l, strings.Clone(lv))
+		}
+	}
+	b.Sort()
+	glset := b.Labels()
+
+	ag.mtx.Lock()
+	defer ag.mtx.Unlock()
+
+	groups, ok := ag.groups[tenant]
+	if !ok {
+		groups = map[uint64]*aggregationGroup{}
+		ag.groups[tenant] = groups
+	}
+	h := glset.Hash()
+	g, ok := groups[h]
+	if !ok {
+		g = &aggregationGroup{lset: glset, values: map[uint64]float64{}}
+		groups[h] = g
+	}
+	g.values[lset.Hash()] = v
+}
+
+// flush returns the aggregated series of every tenant at the given time and resets the aggregation.
+func (ag *aggregation) flush(t time.Time, aggregatorLabel string) map[string][]prompb.TimeSeries {
+	ag.mtx.Lock()
+	groups := ag.groups
+	ag.groups = map[string]map[uint64]*aggregationGroup{}
+	ag.mtx.Unlock()
+
+	res := make(map[string][]prompb.TimeSeries, len(groups))
+	for tenant, tgroups := range groups {
+		series := make([]prompb.TimeSeries, 0, len(tgroups))
+		for _, g := range tgroups {
+			var v float64
+			switch ag.op {
+			case AggregationSum:
+				for _, sv := range g.values {
+					v += sv
+				}
+			case AggregationCount:
+				v = float64(len(g.values))
+			}
+
+			lset := g.lset
+			if aggregatorLabel != "" {
+				lset = labels.NewBuilder(lset).Set(AggregatorLabelName, aggregatorLabel).Labels()
+			}
+			series = append(series, prompb.TimeSeries{
+				Labels:  labelpb.ZLabelsFromPromLabels(lset),
+				Samples: []prompb.Sample{{Value: v, Timestamp: t.UnixMilli()}},
+			})
+		}
+		res[tenant] = series
+	}
+	return res
+}
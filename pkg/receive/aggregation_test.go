@@ -0,0 +1,168 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestParseAggregationConfigs(t *testing.T) {
+	for _, tcase := range []struct {
+		name    string
+		content string
+		want    []*AggregationConfig
+		wantErr bool
+	}{
+		{
+			name: "valid config",
+			content: `
+- tenants: [a]
+  match: '{__name__="http_requests_total"}'
+  record: job:http_requests_total:sum
+  op: sum
+  by: [job]
+  interval: 30s
+  drop_input: true
+- match: '{__name__="up"}'
+  record: job:up:count
+  op: count
+  by: [job]
+`,
+			want: []*AggregationConfig{
+				{
+					Tenants:   []string{"a"},
+					Match:     `{__name__="http_requests_total"}`,
+					Record:    "job:http_requests_total:sum",
+					Op:        AggregationSum,
+					By:        []string{"job"},
+					Interval:  model.Duration(30 * time.Second),
+					DropInput: true,
+				},
+				{
+					Match:    `{__name__="up"}`,
+					Record:   "job:up:count",
+					Op:       AggregationCount,
+					By:       []string{"job"},
+					Interval: defaultAggregationInterval,
+				},
+			},
+		},
+		{
+			name:    "unknown field",
+			content: `[{match: '{__name__="up"}', record: up_sum, op: sum, unknown: true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid match",
+			content: `[{match: '{__name__="up"', record: up_sum, op: sum}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid record",
+			content: `[{match: '{__name__="up"}', record: "up-sum", op: sum}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported op",
+			content: `[{match: '{__name__="up"}', record: up_avg, op: avg}]`,
+			wantErr: true,
+		},
+		{
+			name:    "aggregator label in by",
+			content: `[{match: '{__name__="up"}', record: up_sum, op: sum, by: [receive_aggregator]}]`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			configs, err := ParseAggregationConfigs([]byte(tcase.content))
+			if tcase.wantErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.want, configs)
+		})
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	configs, err := ParseAggregationConfigs([]byte(`
+- tenants: [a]
+  match: '{__name__="http_requests_total"}'
+  record: job:http_requests_total:sum
+  op: sum
+  by: [job]
+  drop_input: true
+- match: '{__name__="http_requests_total"}'
+  record: job:http_requests_total:count
+  op: count
+  by: [job]
+`))
+	testutil.Ok(t, err)
+	aggregator, err := NewAggregator(nil, nil, configs, "receive-0")
+	testutil.Ok(t, err)
+
+	series := func(instance string, values ...float64) prompb.TimeSeries {
+		ts := prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(
+			labels.MetricName, "http_requests_total", "job", "api", "instance", instance,
+		))}
+		for i, v := range values {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i), Value: v})
+		}
+		return ts
+	}
+	other := prompb.TimeSeries{
+		Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "job", "api")),
+		Samples: []prompb.Sample{{Timestamp: 1, Value: 1}},
+	}
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("1", 1, 2), series("2", 5), other}}
+	aggregator.Aggregate("a", wreq)
+	// Input series of the sum aggregation are dropped for tenant a.
+	testutil.Equals(t, []prompb.TimeSeries{other}, wreq.Timeseries)
+
+	// The last value of every input series is aggregated.
+	aggregator.Aggregate("a", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("1", 3)}})
+
+	wreq = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("1", 10)}}
+	aggregator.Aggregate("b", wreq)
+	testutil.Equals(t, 1, len(wreq.Timeseries))
+
+	flushed := map[string][]prompb.TimeSeries{}
+	for _, ag := range aggregator.aggregations {
+		for tenant, series := range ag.flush(time.UnixMilli(1000), aggregator.aggregatorLabel) {
+			flushed[tenant] = append(flushed[tenant], series...)
+		}
+	}
+	for _, series := range flushed {
+		sort.Slice(series, func(i, j int) bool {
+			return labels.Compare(labelpb.ZLabelsToPromLabels(series[i].Labels), labelpb.ZLabelsToPromLabels(series[j].Labels)) < 0
+		})
+	}
+
+	aggregated := func(record string, v float64) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, record, "job", "api", AggregatorLabelName, "receive-0")),
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: v}},
+		}
+	}
+	testutil.Equals(t, map[string][]prompb.TimeSeries{
+		"a": {aggregated("job:http_requests_total:count", 2), aggregated("job:http_requests_total:sum", 8)},
+		"b": {aggregated("job:http_requests_total:count", 1)},
+	}, flushed)
+
+	// Aggregations are reset after being flushed.
+	for _, ag := range aggregator.aggregations {
+		testutil.Equals(t, 0, len(ag.flush(time.UnixMilli(2000), aggregator.aggregatorLabel)))
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// ReplicationMode is how a forwarding receiver completes the writes to the replicas of a request once its write quorum
+// is reached and the client acknowledged.
+type ReplicationMode string
+
+const (
+	// ReplicationModeSync lets the writes to the remaining replicas run until the forward timeout, without retrying
+	// the failed ones.
+	ReplicationModeSync ReplicationMode = "sync"
+	// ReplicationModeAsync retries the failed writes to the remaining replicas in the background, from a queue per
+	// endpoint.
+	ReplicationModeAsync ReplicationMode = "async"
+)
+
+const (
+	droppedReasonQueueFull = "queue_full"
+	droppedReasonMaxAge    = "max_age"
+	droppedReasonError     = "non_retryable_error"
+	droppedReasonShutdown  = "shutdown"
+)
+
+// AsyncReplicationOptions configure the retry queues of the async replication mode.
+type AsyncReplicationOptions struct {
+	// QueueSize is the maximum number of writes pending for each endpoint.
+	QueueSize int
+	// MaxAge is how long after the acknowledgment of their request the failed writes are retried.
+	MaxAge time.Duration
+}
+
+// replicationWrite is a write to a replica, failed after or before its request was acknowledged.
+type replicationWrite struct {
+	endpoint string
+	req      *storepb.WriteRequest
+	ackedAt  time.Time
+}
+
+// asyncReplicator retries the failed writes to the replicas of the acknowledged requests, with a queue and a worker
+// per endpoint so that an unavailable endpoint does not delay the writes to the others.
+type asyncReplicator struct {
+	logger  log.Logger
+	write   func(context.Context, string, *storepb.WriteRequest) error
+	opts    AsyncReplicationOptions
+	backoff backoff.Backoff
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mtx    sync.Mutex
+	queues map[string]chan replicationWrite
+	closed bool
+
+	pending prometheus.Gauge
+	lag     prometheus.Histogram
+	retries prometheus.Counter
+	dropped *prometheus.CounterVec
+}
+
+func newAsyncReplicator(
+	logger log.Logger,
+	reg prometheus.Registerer,
+	write func(context.Context, string, *storepb.WriteRequest) error,
+	opts AsyncReplicationOptions,
+	b backoff.Backoff,
+) *asyncReplicator {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &asyncReplicator{
+		logger:  logger,
+		write:   write,
+		opts:    opts,
+		backoff: b,
+		ctx:     ctx,
+		cancel:  cancel,
+		queues:  map[string]chan replicationWrite{},
+		pending: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "async_replication_pending_writes",
+			Help:      "The number of failed writes to replicas queued to be retried after the acknowledgment of their request.",
+		}),
+		lag: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "async_replication_lag_seconds",
+			Help:      "The time between the acknowledgment of a request and the completion of a write to one of its remaining replicas.",
+			Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+		}),
+		retries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "async_replication_retries_total",
+			Help:      "The number of attempts to write the queued failed writes to replicas.",
+		}),
+		dropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "async_replication_dropped_writes_total",
+			Help:      "The number of failed writes to replicas of acknowledged requests given up on.",
+		}, []string{"reason"}),
+	}
+	for _, reason := range []string{droppedReasonQueueFull, droppedReasonMaxAge, droppedReasonError, droppedReasonShutdown} {
+		r.dropped.WithLabelValues(reason)
+	}
+	return r
+}
+
+// enqueue queues the given write to be retried, dropping it if the queue of its endpoint is full.
+func (r *asyncReplicator) enqueue(w replicationWrite) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.closed {
+		r.dropped.WithLabelValues(droppedReasonShutdown).Inc()
+		return
+	}
+	q, ok := r.queues[w.endpoint]
+	if !ok {
+		q = make(chan replicationWrite, r.opts.QueueSize)
+		r.queues[w.endpoint] = q
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.run(q)
+		}()
+	}
+
+	select {
+	case q <- w:
+		r.pending.Inc()
+	default:
+		r.dropped.WithLabelValues(droppedReasonQueueFull).Inc()
+		level.Debug(r.logger).Log("msg", "async replication queue full, dropping write", "endpoint", w.endpoint)
+	}
+}
+
+func (r *asyncReplicator) run(q <-chan replicationWrite) {
+	b := r.backoff
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case w := <-q:
+			r.replicate(&b, w)
+		}
+	}
+}
+
+// replicate retries the given write until it succeeds, fails with an error which is not retryable, or is older than
+// the max age.
+func (r *asyncReplicator) replicate(b *backoff.Backoff, w replicationWrite) {
+	defer r.pending.Dec()
+
+	for {
+		if time.Since(w.ackedAt) > r.opts.MaxAge {
+			r.dropped.WithLabelValues(droppedReasonMaxAge).Inc()
+			level.Warn(r.logger).Log("msg", "giving up on async replication of write older than max age", "endpoint", w.endpoint, "tenant", w.req.Tenant)
+			return
+		}
+
+		r.retries.Inc()
+		err := r.write(r.ctx, w.endpoint, w.req)
+		if err == nil {
+			b.Reset()
+			r.lag.Observe(time.Since(w.ackedAt).Seconds())
+			return
+		}
+		if r.ctx.Err() != nil {
+			r.dropped.WithLabelValues(droppedReasonShutdown).Inc()
+			return
+		}
+		if !isRetryableReplicationErr(err) {
+			r.dropped.WithLabelValues(droppedReasonError).Inc()
+			level.Warn(r.logger).Log("msg", "async replication of write failed", "endpoint", w.endpoint, "tenant", w.req.Tenant, "err", err)
+			return
+		}
+
+		select {
+		case <-r.ctx.Done():
+			r.dropped.WithLabelValues(droppedReasonShutdown).Inc()
+			return
+		case <-time.After(b.Duration()):
+		}
+	}
+}
+
+// close stops the workers, dropping the writes still queued.
+func (r *asyncReplicator) close() {
+	r.mtx.Lock()
+	r.closed = true
+	r.cancel()
+	r.mtx.Unlock()
+
+	r.wg.Wait()
+	for _, q := range r.queues {
+		r.dropped.WithLabelValues(droppedReasonShutdown).Add(float64(len(q)))
+		r.pending.Sub(float64(len(q)))
+	}
+}
+
+// newTracker returns a tracker of the remote writes of a request.
+func (r *asyncReplicator) newTracker() *replicationTracker {
+	return &replicationTracker{r: r}
+}
+
+// replicationTracker tracks the remote writes of a request. The writes failing before the request is acknowledged are
+// queued once it is, and the ones failing after right away. A nil tracker does nothing.
+type replicationTracker struct {
+	r *asyncReplicator
+
+	mtx     sync.Mutex
+	ackedAt time.Time
+	failed  []failedWrite
+}
+
+type failedWrite struct {
+	w   replicationWrite
+	err error
+}
+
+// ack marks the request as acknowledged, queuing its writes which failed so far.
+func (t *replicationTracker) ack() {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.ackedAt = time.Now()
+	for _, f := range t.failed {
+		t.retry(f.w, f.err)
+	}
+	t.failed = nil
+}
+
+// done records the result of the given write to the endpoint.
+func (t *replicationTracker) done(endpoint string, req *storepb.WriteRequest, err error) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if err == nil {
+		if !t.ackedAt.IsZero() {
+			t.r.lag.Observe(time.Since(t.ackedAt).Seconds())
+		}
+		return
+	}
+
+	w := replicationWrite{endpoint: endpoint, req: req}
+	if t.ackedAt.IsZero() {
+		t.failed = append(t.failed, failedWrite{w: w, err: err})
+		return
+	}
+	t.retry(w, err)
+}
+
+// retry queues the given failed write of the acknowledged request if its error is retryable. The tracker mutex must be
+// held.
+func (t *replicationTracker) retry(w replicationWrite, err error) {
+	if !isRetryableReplicationErr(err) {
+		t.r.dropped.WithLabelValues(droppedReasonError).Inc()
+		return
+	}
+	w.ackedAt = t.ackedAt
+	t.r.enqueue(w)
+}
+
+// isRetryableReplicationErr returns whether the given error of a write to a replica is transient.
+func isRetryableReplicationErr(err error) bool {
+	if errors.Is(err, errUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
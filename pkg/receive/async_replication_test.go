@@ -0,0 +1,194 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+var testReplicationBackoff = backoff.Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond}
+
+func TestAsyncReplicator(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		errs   = []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.DeadlineExceeded, "timeout"), nil}
+		writes = make(chan *storepb.WriteRequest, 1)
+	)
+	r := newAsyncReplicator(log.NewNopLogger(), prometheus.NewRegistry(), func(_ context.Context, _ string, req *storepb.WriteRequest) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		err := errs[0]
+		errs = errs[1:]
+		if err == nil {
+			writes <- req
+		}
+		return err
+	}, AsyncReplicationOptions{QueueSize: 10, MaxAge: time.Minute}, testReplicationBackoff)
+	t.Cleanup(r.close)
+
+	tracker := r.newTracker()
+	req := &storepb.WriteRequest{Tenant: "a", Replica: 2}
+	// Writes failing before the acknowledgment are only retried once the request is acknowledged.
+	tracker.done("b", req, errors.Wrap(errUnavailable, "backing off"))
+	tracker.done("c", &storepb.WriteRequest{Tenant: "a", Replica: 3}, status.Error(codes.AlreadyExists, "conflict"))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(r.pending))
+
+	tracker.ack()
+	select {
+	case w := <-writes:
+		testutil.Equals(t, req, w)
+	case <-time.After(10 * time.Second):
+		t.Fatal("write was not replicated")
+	}
+	// Writes completing after the acknowledgment are observed in the lag.
+	tracker.done("c", req, nil)
+
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(r.retries))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(r.dropped.WithLabelValues(droppedReasonError)))
+	m := &dto.Metric{}
+	testutil.Ok(t, r.lag.Write(m))
+	testutil.Equals(t, uint64(2), m.GetHistogram().GetSampleCount())
+}
+
+func TestAsyncReplicator_Drops(t *testing.T) {
+	started := make(chan struct{}, 1)
+	r := newAsyncReplicator(log.NewNopLogger(), prometheus.NewRegistry(), func(ctx context.Context, _ string, _ *storepb.WriteRequest) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, AsyncReplicationOptions{QueueSize: 1, MaxAge: time.Hour}, testReplicationBackoff)
+
+	w := replicationWrite{endpoint: "a", req: &storepb.WriteRequest{}, ackedAt: time.Now()}
+	r.enqueue(w)
+	<-started
+	// The first write is being replicated, the second one is queued.
+	r.enqueue(w)
+	r.enqueue(w)
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(r.dropped.WithLabelValues(droppedReasonQueueFull)))
+
+	r.enqueue(replicationWrite{endpoint: "b", req: &storepb.WriteRequest{}, ackedAt: time.Now().Add(-2 * time.Hour)})
+	for promtestutil.ToFloat64(r.dropped.WithLabelValues(droppedReasonMaxAge)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The write being replicated and the queued one are dropped on close, as well as the ones queued after.
+	r.close()
+	r.enqueue(w)
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(r.dropped.WithLabelValues(droppedReasonShutdown)))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(r.pending))
+}
+
+func TestHandler_ReplicationWriteQuorum(t *testing.T) {
+	appenderErrFn := func() error { return errors.New("failed to get appender") }
+	handlers, _, err := newTestHandlerHashring([]*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil), appenderErr: appenderErrFn},
+		{appender: newFakeAppender(nil, nil, nil), appenderErr: appenderErrFn},
+	}, 3, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	wreq := &prompb.WriteRequest{Timeseries: makeSeriesWithValues(10)}
+
+	rec, err := makeRequest(handlers[0], "tenant", wreq)
+	testutil.Ok(t, err)
+	testutil.Assert(t, rec.Code != http.StatusOK, "expected the majority of the replicas to be required")
+
+	handlers[0].options.ReplicationWriteQuorum = 1
+	rec, err = makeRequest(handlers[0], "tenant", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// The write quorum is capped at the replication factor.
+	handlers[0].options.ReplicationWriteQuorum = 5
+	testutil.Equals(t, 3, handlers[0].replicationQuorum(3))
+}
+
+func TestHandler_AsyncReplication(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _, err := newTestHandlerHashring(appendables, 3, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	h := handlers[0]
+	h.replicator = newAsyncReplicator(log.NewNopLogger(), prometheus.NewRegistry(), h.replicateRemoteWrite, AsyncReplicationOptions{QueueSize: 10, MaxAge: time.Minute}, testReplicationBackoff)
+	t.Cleanup(h.replicator.close)
+
+	// The third replica is unavailable for the first two writes, after the quorum of two replicas is reached.
+	peers := h.peers.(*fakePeersGroup)
+	endpoint := handlers[2].options.Endpoint
+	peers.clients[endpoint] = &unavailableRemoteWriteClient{WriteableStoreAsyncClient: peers.clients[endpoint], failures: 2}
+
+	wreq := &prompb.WriteRequest{Timeseries: makeSeriesWithValues(10)}
+	rec, err := makeRequest(h, "tenant", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	app := appendables[2].appender.(*fakeAppender)
+	deadline := time.Now().Add(10 * time.Second)
+	for _, ts := range wreq.Timeseries {
+		lset := labelpb.ZLabelsToPromLabels(ts.Labels)
+		for len(app.Get(lset)) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("series %v was not replicated", lset)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		testutil.Equals(t, ts.Samples, app.Get(lset))
+	}
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(h.replicator.retries))
+}
+
+// unavailableRemoteWriteClient fails the given number of writes with an unavailable error.
+type unavailableRemoteWriteClient struct {
+	WriteableStoreAsyncClient
+
+	mtx      sync.Mutex
+	failures int
+}
+
+func (c *unavailableRemoteWriteClient) fail() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.failures == 0 {
+		return nil
+	}
+	c.failures--
+	return status.Error(codes.Unavailable, "unavailable")
+}
+
+func (c *unavailableRemoteWriteClient) RemoteWrite(ctx context.Context, in *storepb.WriteRequest, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	if err := c.fail(); err != nil {
+		return nil, err
+	}
+	return c.WriteableStoreAsyncClient.RemoteWrite(ctx, in, opts...)
+}
+
+func (c *unavailableRemoteWriteClient) RemoteWriteAsync(ctx context.Context, in *storepb.WriteRequest, er endpointReplica, seriesIDs []int, responses chan writeResponse, cb func(error)) {
+	if err := c.fail(); err != nil {
+		responses <- newWriteResponse(seriesIDs, err, er)
+		cb(err)
+		return
+	}
+	c.WriteableStoreAsyncClient.RemoteWriteAsync(ctx, in, er, seriesIDs, responses, cb)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+)
+
+// TenantCardinality is the cardinality of the head of the TSDB of a tenant, as served by the cardinality API, to find
+// the series and labels driving it. The stats are sorted by descending count, and limited to the top ones.
+type TenantCardinality struct {
+	Tenant        string `json:"tenant"`
+	NumSeries     uint64 `json:"numSeries"`
+	MinTime       int64  `json:"minTime"`
+	MaxTime       int64  `json:"maxTime"`
+	NumLabelPairs int    `json:"numLabelPairs"`
+
+	SeriesCountByMetricName     []v1.TSDBStat `json:"seriesCountByMetricName"`
+	SeriesCountByLabelName      []v1.TSDBStat `json:"seriesCountByLabelName"`
+	LabelValueCountByLabelName  []v1.TSDBStat `json:"labelValueCountByLabelName"`
+	SeriesCountByLabelValuePair []v1.TSDBStat `json:"seriesCountByLabelValuePair"`
+	// SeriesChurnByMetricName is the number of series of each metric created in the head over the last one to two
+	// churn windows, if tracked.
+	SeriesChurnByMetricName []v1.TSDBStat `json:"seriesChurnByMetricName,omitempty"`
+}
+
+// SeriesChurn counts the series created in the heads of the TSDBs of tenants by metric name, to find the metrics
+// with the highest churn. Series are counted over two consecutive windows, the older one being forgotten as a new
+// one starts.
+// A nil SeriesChurn tracks nothing.
+type SeriesChurn struct {
+	window time.Duration
+	now    func() time.Time
+
+	mtx      sync.Mutex
+	start    time.Time
+	current  map[string]map[string]uint64
+	previous map[string]map[string]uint64
+}
+
+// NewSeriesChurn returns a new SeriesChurn counting series over the given window.
+func NewSeriesChurn(window time.Duration) *SeriesChurn {
+	return &SeriesChurn{
+		window:   window,
+		now:      time.Now,
+		current:  map[string]map[string]uint64{},
+		previous: map[string]map[string]uint64{},
+	}
+}
+
+// observe counts a series of the given metric created in the head of the TSDB of the given tenant.
+func (c *SeriesChurn) observe(tenant, metric string) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.rotate()
+	metrics, ok := c.current[tenant]
+	if !ok {
+		metrics = map[string]uint64{}
+		c.current[tenant] = metrics
+	}
+	metrics[metric]++
+}
+
+// rotate starts a new window once the current one elapsed. The mutex must be held.
+func (c *SeriesChurn) rotate() {
+	now := c.now()
+	switch elapsed := now.Sub(c.start); {
+	case elapsed < c.window:
+		return
+	case elapsed < 2*c.window:
+		c.previous = c.current
+	default:
+		c.previous = map[string]map[string]uint64{}
+	}
+	c.current = map[string]map[string]uint64{}
+	c.start = now
+}
+
+// top returns the given number of metrics of the given tenant with the most series created over the last windows.
+func (c *SeriesChurn) top(tenant string, limit int) []v1.TSDBStat {
+	if c == nil {
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.rotate()
+	counts := map[string]uint64{}
+	for _, metrics := range []map[string]uint64{c.previous[tenant], c.current[tenant]} {
+		for metric, n := range metrics {
+			counts[metric] += n
+		}
+	}
+	return topStats(counts, limit)
+}
+
+// topStats returns the given number of the stats with the highest counts, sorted by descending count.
+func topStats(counts map[string]uint64, limit int) []v1.TSDBStat {
+	stats := make([]v1.TSDBStat, 0, len(counts))
+	for name, n := range counts {
+		stats = append(stats, v1.TSDBStat{Name: name, Value: n})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Value != stats[j].Value {
+			return stats[i].Value > stats[j].Value
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
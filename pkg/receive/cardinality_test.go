@@ -0,0 +1,133 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestSeriesChurn(t *testing.T) {
+	c := NewSeriesChurn(time.Hour)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	c.observe("a", "up")
+	c.observe("a", "http_requests_total")
+	c.observe("a", "http_requests_total")
+	c.observe("b", "up")
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}, {Name: "up", Value: 1}}, c.top("a", 10))
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}}, c.top("a", 1))
+
+	// The series of the previous window are still counted.
+	now = now.Add(time.Hour)
+	c.observe("a", "up")
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}, {Name: "up", Value: 2}}, c.top("a", 10))
+
+	now = now.Add(time.Hour)
+	testutil.Equals(t, []v1.TSDBStat{{Name: "up", Value: 1}}, c.top("a", 10))
+	now = now.Add(2 * time.Hour)
+	testutil.Equals(t, []v1.TSDBStat{}, c.top("a", 10))
+
+	// A nil SeriesChurn tracks nothing.
+	var nilChurn *SeriesChurn
+	nilChurn.observe("a", "up")
+	testutil.Assert(t, nilChurn.top("a", 10) == nil)
+}
+
+func TestHandler_CardinalityAPI(t *testing.T) {
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	t.Cleanup(func() { testutil.Ok(t, m.Close()) })
+	testutil.Ok(t, appendSample(m, "foo", time.Now()))
+
+	churn := NewSeriesChurn(time.Hour)
+	w := NewWriter(log.NewNopLogger(), m, nil, &WriterOptions{SeriesChurn: churn})
+	wreq := &prompb.WriteRequest{}
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "http_requests_total", "path", "/a"),
+		labels.FromStrings("__name__", "http_requests_total", "path", "/b"),
+		labels.FromStrings("__name__", "up", "job", "api"),
+	} {
+		wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+			Labels:  labelpb.ZLabelsFromPromLabels(lset),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+		})
+	}
+	testutil.Ok(t, w.Write(context.Background(), "foo", wreq))
+	// Series already in the head are not counted as churn again.
+	testutil.Ok(t, w.Write(context.Background(), "foo", wreq))
+
+	h := NewHandler(nil, &Options{
+		Writer:          w,
+		TenantHeader:    "THANOS-TENANT",
+		DefaultTenantID: "default-tenant",
+		TSDBStats:       m,
+		SeriesChurn:     churn,
+		Tracer:          opentracing.NoopTracer{},
+	})
+	hashring, err := NewMultiHashring(AlgorithmHashmod, 1, []HashringConfig{{Endpoints: []Endpoint{{Address: "a"}}}})
+	testutil.Ok(t, err)
+	h.Hashring(hashring)
+
+	do := func(tenant, limit string) (*httptest.ResponseRecorder, TenantCardinality) {
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/status/cardinality?limit="+limit, nil)
+		testutil.Ok(t, err)
+		req.Header.Set("THANOS-TENANT", tenant)
+		rec := httptest.NewRecorder()
+		h.router.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data TenantCardinality `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec, resp.Data
+	}
+
+	rec, cardinality := do("foo", "10")
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "foo", cardinality.Tenant)
+	testutil.Equals(t, uint64(4), cardinality.NumSeries)
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}, {Name: "up", Value: 1}}, cardinality.SeriesCountByMetricName)
+	testutil.Equals(t, []v1.TSDBStat{{Name: "__name__", Value: 3}, {Name: "path", Value: 2}, {Name: "foo", Value: 1}, {Name: "job", Value: 1}}, cardinality.SeriesCountByLabelName)
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}, {Name: "up", Value: 1}}, cardinality.SeriesChurnByMetricName)
+
+	rec, cardinality = do("foo", "1")
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, []v1.TSDBStat{{Name: "__name__", Value: 3}}, cardinality.SeriesCountByLabelName)
+	testutil.Equals(t, []v1.TSDBStat{{Name: "http_requests_total", Value: 2}}, cardinality.SeriesChurnByMetricName)
+
+	rec, _ = do("", "10")
+	testutil.Equals(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec, _ = do("foo", "invalid")
+	testutil.Equals(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
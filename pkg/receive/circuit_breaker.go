@@ -0,0 +1,218 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CircuitBreakerOptions configure the circuit breakers of the peers requests are forwarded to.
+type CircuitBreakerOptions struct {
+	// ConsecutiveFailures is the number of consecutive forward requests to a peer which failed or timed out after
+	// which its circuit breaker opens. Zero disables the circuit breakers.
+	ConsecutiveFailures int
+	// OpenDuration is how long the circuit breaker of a peer stays open, failing the requests to the peer right away
+	// instead of waiting for them to time out, before probing the peer.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the maximum number of concurrent requests probing the peer once the open duration elapsed.
+	// The circuit breaker closes once a probe succeeds, and opens again once one fails.
+	HalfOpenProbes int
+}
+
+// circuitState is the state of the circuit breaker of a peer.
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half_open"
+)
+
+type circuitBreaker struct {
+	state     circuitState
+	failures  int
+	openUntil time.Time
+	probes    int
+}
+
+// circuitBreakers are the circuit breakers of the peers requests are forwarded to. A nil circuitBreakers lets all
+// the requests through.
+type circuitBreakers struct {
+	logger log.Logger
+	opts   CircuitBreakerOptions
+	now    func() time.Time
+
+	mtx   sync.Mutex
+	peers map[string]*circuitBreaker
+
+	transitions *prometheus.CounterVec
+	rejected    prometheus.Counter
+}
+
+// newCircuitBreakers returns circuit breakers configured by the given options, or nil if they are disabled.
+func newCircuitBreakers(logger log.Logger, reg prometheus.Registerer, opts CircuitBreakerOptions) *circuitBreakers {
+	if opts.ConsecutiveFailures <= 0 {
+		return nil
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	b := &circuitBreakers{
+		logger: logger,
+		opts:   opts,
+		now:    time.Now,
+		peers:  map[string]*circuitBreaker{},
+		transitions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_forward_circuit_breaker_transitions_total",
+			Help: "The total number of transitions of the circuit breakers of peers to the given state.",
+		}, []string{"state"}),
+		rejected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_forward_circuit_breaker_rejected_requests_total",
+			Help: "The total number of forward requests failed right away because the circuit breaker of their peer is open.",
+		}),
+	}
+	for _, s := range []circuitState{circuitClosed, circuitOpen, circuitHalfOpen} {
+		b.transitions.WithLabelValues(string(s))
+	}
+	return b
+}
+
+// isCircuitBreakerFailure returns whether the given error of a forward request tells that the peer is unhealthy,
+// rather than that the request was rejected.
+func isCircuitBreakerFailure(err error) bool {
+	if errors.Is(err, errUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// allow returns whether a request can be forwarded to the given peer. Once the open duration of its circuit breaker
+// elapsed, the requests let through are probes, which have to be followed by a call to success or failure.
+func (b *circuitBreakers) allow(addr string) bool {
+	if b == nil {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	cb, ok := b.peers[addr]
+	if !ok {
+		return true
+	}
+	switch cb.state {
+	case circuitOpen:
+		if b.now().Before(cb.openUntil) {
+			b.rejected.Inc()
+			return false
+		}
+		b.transition(addr, cb, circuitHalfOpen)
+		cb.probes = 0
+		fallthrough
+	case circuitHalfOpen:
+		if cb.probes >= b.opts.HalfOpenProbes {
+			b.rejected.Inc()
+			return false
+		}
+		cb.probes++
+	}
+	return true
+}
+
+// success records a forward request to the given peer which succeeded, or which was answered by the peer.
+func (b *circuitBreakers) success(addr string) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	cb, ok := b.peers[addr]
+	if !ok {
+		return
+	}
+	if cb.state != circuitClosed {
+		level.Info(b.logger).Log("msg", "closing circuit breaker of peer, forwarding requests again", "peer", addr)
+		b.transitions.WithLabelValues(string(circuitClosed)).Inc()
+	}
+	delete(b.peers, addr)
+}
+
+// failure records a forward request to the given peer which failed or timed out.
+func (b *circuitBreakers) failure(addr string) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	cb, ok := b.peers[addr]
+	if !ok {
+		cb = &circuitBreaker{state: circuitClosed}
+		b.peers[addr] = cb
+	}
+	switch cb.state {
+	case circuitClosed:
+		cb.failures++
+		if cb.failures < b.opts.ConsecutiveFailures {
+			return
+		}
+		level.Warn(b.logger).Log("msg", "opening circuit breaker of peer after consecutive failures", "peer", addr, "failures", cb.failures, "open_duration", b.opts.OpenDuration)
+	case circuitHalfOpen:
+		level.Warn(b.logger).Log("msg", "probe of peer failed, opening its circuit breaker again", "peer", addr, "open_duration", b.opts.OpenDuration)
+	case circuitOpen:
+		// Requests let through before the circuit breaker opened.
+		return
+	}
+	b.transition(addr, cb, circuitOpen)
+	cb.openUntil = b.now().Add(b.opts.OpenDuration)
+}
+
+// transition changes the state of the given circuit breaker. The mutex must be held.
+func (b *circuitBreakers) transition(addr string, cb *circuitBreaker, state circuitState) {
+	level.Debug(b.logger).Log("msg", "circuit breaker of peer changed state", "peer", addr, "from", cb.state, "to", state)
+	cb.state = state
+	b.transitions.WithLabelValues(string(state)).Inc()
+}
+
+// states returns the state of the circuit breakers of the peers which are not closed.
+func (b *circuitBreakers) states() map[string]circuitState {
+	if b == nil {
+		return nil
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	res := make(map[string]circuitState, len(b.peers))
+	for addr, cb := range b.peers {
+		if cb.state != circuitClosed {
+			res[addr] = cb.state
+		}
+	}
+	return res
+}
+
+// reset closes the circuit breakers of all the peers.
+func (b *circuitBreakers) reset() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.peers = map[string]*circuitBreaker{}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsCircuitBreakerFailure(t *testing.T) {
+	for _, tcase := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: status.Error(codes.Unavailable, "connection refused"), expected: true},
+		{err: status.Error(codes.DeadlineExceeded, "context deadline exceeded"), expected: true},
+		{err: errors.Wrap(context.DeadlineExceeded, "forwarding request"), expected: true},
+		{err: errors.Wrap(errUnavailable, "failed to dial peer"), expected: true},
+		{err: status.Error(codes.InvalidArgument, "out of bounds")},
+		{err: status.Error(codes.ResourceExhausted, "tenant limit")},
+		{err: context.Canceled},
+	} {
+		testutil.Equals(t, tcase.expected, isCircuitBreakerFailure(tcase.err), "error %v", tcase.err)
+	}
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	testutil.Assert(t, newCircuitBreakers(log.NewNopLogger(), nil, CircuitBreakerOptions{}) == nil)
+
+	b := newCircuitBreakers(log.NewNopLogger(), prometheus.NewRegistry(), CircuitBreakerOptions{
+		ConsecutiveFailures: 3,
+		OpenDuration:        time.Minute,
+		HalfOpenProbes:      2,
+	})
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	// Successes reset the consecutive failures.
+	b.failure("a")
+	b.failure("a")
+	b.success("a")
+	b.failure("a")
+	b.failure("a")
+	testutil.Assert(t, b.allow("a"))
+	testutil.Equals(t, 0, len(b.states()))
+
+	b.failure("a")
+	testutil.Assert(t, !b.allow("a"))
+	testutil.Assert(t, b.allow("b"))
+	testutil.Equals(t, map[string]circuitState{"a": circuitOpen}, b.states())
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(b.rejected))
+
+	// Once the open duration elapsed, only the probes are let through, until one fails.
+	now = now.Add(time.Minute)
+	testutil.Assert(t, b.allow("a"))
+	testutil.Assert(t, b.allow("a"))
+	testutil.Assert(t, !b.allow("a"))
+	testutil.Equals(t, map[string]circuitState{"a": circuitHalfOpen}, b.states())
+	b.failure("a")
+	testutil.Assert(t, !b.allow("a"))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(b.transitions.WithLabelValues(string(circuitOpen))))
+
+	// The circuit breaker closes once a probe succeeds.
+	now = now.Add(time.Minute)
+	testutil.Assert(t, b.allow("a"))
+	b.success("a")
+	testutil.Assert(t, b.allow("a"))
+	testutil.Assert(t, b.allow("a"))
+	testutil.Assert(t, b.allow("a"))
+	testutil.Equals(t, 0, len(b.states()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(b.transitions.WithLabelValues(string(circuitClosed))))
+
+	b.failure("a")
+	b.failure("a")
+	b.failure("a")
+	b.reset()
+	testutil.Assert(t, b.allow("a"))
+
+	// Nil circuit breakers let all the requests through.
+	var nilBreakers *circuitBreakers
+	nilBreakers.failure("a")
+	testutil.Assert(t, nilBreakers.allow("a"))
+	nilBreakers.success("a")
+	testutil.Equals(t, 0, len(nilBreakers.states()))
+}
+
+func TestPeerGroupCircuitBreaker(t *testing.T) {
+	peers := newPeerGroup(
+		backoff.Backoff{Min: time.Hour, Max: time.Hour},
+		prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_forward_delay_seconds"}),
+		newCircuitBreakers(log.NewNopLogger(), prometheus.NewRegistry(), CircuitBreakerOptions{ConsecutiveFailures: 2, OpenDuration: time.Hour}),
+		1,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	t.Cleanup(func() { testutil.Ok(t, peers.close("a")) })
+
+	_, err := peers.getConnection(context.Background(), "a")
+	testutil.Ok(t, err)
+
+	// Requests answered with an error don't open the circuit breaker.
+	peers.markPeerFailed("a", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+	peers.markPeerFailed("a", status.Error(codes.InvalidArgument, "out of bounds"))
+	peers.markPeerFailed("a", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+	_, err = peers.getConnection(context.Background(), "a")
+	testutil.Ok(t, err)
+
+	peers.markPeerFailed("a", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+	_, err = peers.getConnection(context.Background(), "a")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, errUnavailable), "unexpected error %v", err)
+	testutil.Equals(t, []PeerStatus{{Address: "a", Connected: true, Up: true, CircuitBreaker: circuitOpen}}, peers.status())
+
+	peers.markPeerAvailable("a")
+	_, err = peers.getConnection(context.Background(), "a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []PeerStatus{{Address: "a", Connected: true, Up: true}}, peers.status())
+}
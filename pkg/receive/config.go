@@ -41,6 +41,9 @@ const (
 type Endpoint struct {
 	Address string `json:"address"`
 	AZ      string `json:"az"`
+	// Weight scales the share of the series of Ketama hashrings the endpoint owns, 1 if not set. Increasing the weight
+	// of a new endpoint step by step moves series to it gradually.
+	Weight *float64 `json:"weight,omitempty"`
 }
 
 func (e *Endpoint) UnmarshalJSON(data []byte) error {
@@ -57,6 +60,7 @@ func (e *Endpoint) UnmarshalJSON(data []byte) error {
 	if err == nil {
 		e.Address = configEndpoint.Address
 		e.AZ = configEndpoint.AZ
+		e.Weight = configEndpoint.Weight
 	}
 	return err
 }
@@ -70,6 +74,11 @@ type HashringConfig struct {
 	Endpoints         []Endpoint        `json:"endpoints"`
 	Algorithm         HashringAlgorithm `json:"algorithm,omitempty"`
 	ExternalLabels    labels.Labels     `json:"external_labels,omitempty"`
+	// ReplicationFactor overrides the replication factor of the tenants of the hashring, if not zero.
+	ReplicationFactor uint64 `json:"replication_factor,omitempty"`
+	// LoadFactor bounds the share of the series any endpoint of a hashring using the ketama_bounded_loads algorithm
+	// owns to the given factor of its fair share. Defaults to DefaultLoadFactor.
+	LoadFactor float64 `json:"load_factor,omitempty"`
 }
 
 type tenantMatcher string
@@ -11,6 +11,7 @@ import (
 	"io"
 	stdlog "log"
 	"math"
+	"mime"
 	"net"
 	"net/http"
 	"sort"
@@ -31,6 +32,7 @@ import (
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"go.opentelemetry.io/otel/attribute"
@@ -40,7 +42,9 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/api"
+	qapi "github.com/thanos-io/thanos/pkg/api/query"
 	statusapi "github.com/thanos-io/thanos/pkg/api/status"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
 	"github.com/thanos-io/thanos/pkg/logging"
 
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
@@ -50,6 +54,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
 	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
@@ -85,16 +90,18 @@ type WriteableStoreAsyncClient interface {
 
 // Options for the web Handler.
 type Options struct {
-	Writer                  *Writer
-	ListenAddress           string
-	Registry                *prometheus.Registry
-	TenantHeader            string
-	TenantField             string
-	DefaultTenantID         string
-	ReplicaHeader           string
-	Endpoint                string
-	ReplicationFactor       uint64
-	SplitTenantLabelName    string
+	Writer               *Writer
+	ListenAddress        string
+	Registry             *prometheus.Registry
+	TenantHeader         string
+	TenantField          string
+	DefaultTenantID      string
+	ReplicaHeader        string
+	Endpoint             string
+	ReplicationFactor    uint64
+	SplitTenantLabelName string
+	// TenantLabelName is the label name the tenant of the TSDBs of receivers is announced with.
+	TenantLabelName         string
 	ReceiverMode            ReceiverMode
 	Tracer                  opentracing.Tracer
 	TLSConfig               *tls.Config
@@ -104,7 +111,34 @@ type Options struct {
 	RelabelConfigs          []*relabel.Config
 	TSDBStats               TSDBStats
 	Limiter                 *Limiter
+	MemoryAdmission         *MemoryAdmission
 	AsyncForwardWorkerCount uint
+	Aggregator              *Aggregator
+	WriteFailures           *WriteFailures
+	// NormalizeLabels normalizes the labels of series sent with out of order or duplicate labels, instead of rejecting
+	// these series.
+	NormalizeLabels bool
+	// TenantDeleter rejects the writes of tenants marked for deletion, if set.
+	TenantDeleter TenantDeleter
+	// EnableTenantDeletionAPI serves the admin API to mark tenants for deletion with TenantDeleter.
+	EnableTenantDeletionAPI bool
+	// OTLPPromoteResourceAttributes are the resource attributes of the metrics received over OTLP which are promoted
+	// to labels of their series.
+	OTLPPromoteResourceAttributes []string
+	// ReplicationWriteQuorum is the number of replicas a series has to be written to before acknowledging the request,
+	// capped at the replication factor of the series. Zero means the majority of them.
+	ReplicationWriteQuorum uint64
+	// ReplicationMode is how the writes to the replicas remaining once the write quorum is reached are completed.
+	ReplicationMode ReplicationMode
+	// AsyncReplication configures the retry queues of ReplicationModeAsync.
+	AsyncReplication AsyncReplicationOptions
+	// StorageHealth reports the storage failures the writes of tenants are rejected because of, if set.
+	StorageHealth *StorageHealth
+	// ForwardCircuitBreaker configures the circuit breakers failing the requests forwarded to unhealthy peers right
+	// away, instead of letting them wait for the forward timeout.
+	ForwardCircuitBreaker CircuitBreakerOptions
+	// SeriesChurn reports the metrics of tenants with the most series created in their heads, if set.
+	SeriesChurn *SeriesChurn
 }
 
 // Handler serves a Prometheus remote write receiving HTTP endpoint.
@@ -116,10 +150,13 @@ type Handler struct {
 	splitTenantLabelName string
 	httpSrv              *http.Server
 
-	mtx          sync.RWMutex
-	hashring     Hashring
-	peers        peersContainer
-	receiverMode ReceiverMode
+	mtx               sync.RWMutex
+	hashring          Hashring
+	hashringVersion   uint64
+	hashringUpdatedAt time.Time
+	peers             peersContainer
+	replicator        *asyncReplicator
+	receiverMode      ReceiverMode
 
 	forwardRequests   *prometheus.CounterVec
 	replications      *prometheus.CounterVec
@@ -127,6 +164,7 @@ type Handler struct {
 
 	writeSamplesTotal    *prometheus.HistogramVec
 	writeTimeseriesTotal *prometheus.HistogramVec
+	normalizedSeries     *prometheus.CounterVec
 
 	Limiter *Limiter
 }
@@ -167,6 +205,7 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 					Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
 				},
 			),
+			newCircuitBreakers(log.With(logger, "component", "forward-circuit-breaker"), registerer, o.ForwardCircuitBreaker),
 			workers,
 			o.DialOpts...),
 		receiverMode: o.ReceiverMode,
@@ -207,6 +246,29 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 				Buckets:   []float64{10, 50, 100, 500, 1000, 5000, 10000},
 			}, []string{"code", "tenant"},
 		),
+		normalizedSeries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "thanos",
+				Subsystem: "receive",
+				Name:      "normalized_series_total",
+				Help:      "The number of series received with out of order or duplicate labels, whose labels were normalized.",
+			}, []string{"tenant", "reason"},
+		),
+	}
+
+	if o.ReplicationMode == ReplicationModeAsync {
+		h.replicator = newAsyncReplicator(
+			log.With(logger, "component", "async-replication"),
+			registerer,
+			h.replicateRemoteWrite,
+			o.AsyncReplication,
+			backoff.Backoff{
+				Factor: 2,
+				Min:    100 * time.Millisecond,
+				Max:    o.MaxBackoff,
+				Jitter: true,
+			},
+		)
 	}
 
 	h.forwardRequests.WithLabelValues(labelSuccess)
@@ -261,12 +323,47 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 			),
 		),
 	)
+	h.router.Post(
+		"/api/v1/otlp/v1/metrics",
+		instrf(
+			"otlp",
+			readyf(
+				middleware.RequestID(
+					http.HandlerFunc(h.receiveOTLPHTTP),
+				),
+			),
+		),
+	)
 
 	statusAPI := statusapi.New(statusapi.Options{
 		GetStats: h.getStats,
 		Registry: h.options.Registry,
 	})
 	statusAPI.Register(h.router, o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger))
+	h.router.Get(
+		"/api/v1/status/write_failures",
+		api.GetInstr(o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger), false)("write_failures", h.getWriteFailures),
+	)
+	h.router.Get(
+		"/api/v1/status/storage_health",
+		api.GetInstr(o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger), false)("storage_health", h.getStorageHealth),
+	)
+	h.router.Get(
+		"/api/v1/status/cardinality",
+		api.GetInstr(o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger), false)("cardinality", h.getCardinality),
+	)
+	h.router.Get(
+		"/api/v1/status/hashring",
+		api.GetInstr(o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger), false)("hashring", h.getHashringStatus),
+	)
+	if o.TenantDeleter != nil && o.EnableTenantDeletionAPI {
+		instr := api.GetInstr(o.Tracer, logger, ins, logging.NewHTTPServerMiddleware(logger), false)
+		h.router.Get("/api/v1/admin/tenant_deletions", instr("tenant_deletions", h.getTenantDeletions))
+		h.router.Get("/api/v1/admin/tenants/:tenant/deletion", instr("get_tenant_deletion", h.getTenantDeletion))
+		h.router.Post("/api/v1/admin/tenants/:tenant/deletion", instr("mark_tenant_deletion", h.markTenantDeletion))
+		h.router.Del("/api/v1/admin/tenants/:tenant/deletion", instr("cancel_tenant_deletion", h.cancelTenantDeletion))
+		h.router.Post("/api/v1/admin/tenants/:tenant/delete_series", instr("delete_tenant_series", h.deleteTenantSeries))
+	}
 
 	errlog := stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0)
 
@@ -300,6 +397,8 @@ func (h *Handler) Hashring(hashring Hashring) {
 	}
 
 	h.hashring = hashring
+	h.hashringVersion++
+	h.hashringUpdatedAt = time.Now()
 	h.peers.reset()
 }
 
@@ -397,9 +496,166 @@ func (h *Handler) getStats(r *http.Request, statsByLabelName string) ([]statusap
 	return h.options.TSDBStats.TenantStats(statsLimit, statsByLabelName, tenantID), nil
 }
 
+func (h *Handler) getWriteFailures(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	tenantID := r.Header.Get(h.options.TenantHeader)
+	getAllTenantFailures := r.FormValue(AllTenantsQueryParam) == "true"
+	if getAllTenantFailures && tenantID != "" {
+		err := fmt.Errorf("using both the %s parameter and the %s header is not supported", AllTenantsQueryParam, h.options.TenantHeader)
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+
+	var failures []TenantWriteFailures
+	if getAllTenantFailures {
+		failures = h.options.WriteFailures.TenantFailures()
+	} else {
+		if tenantID == "" {
+			tenantID = h.options.DefaultTenantID
+		}
+		failures = h.options.WriteFailures.TenantFailures(tenantID)
+	}
+	if failures == nil {
+		failures = []TenantWriteFailures{}
+	}
+	return failures, nil, nil, func() {}
+}
+
+func (h *Handler) getCardinality(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	if !h.isReady() {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: fmt.Errorf("service unavailable")}, func() {}
+	}
+
+	tenantID := r.Header.Get(h.options.TenantHeader)
+	if tenantID == "" {
+		tenantID = h.options.DefaultTenantID
+	}
+	limit, err := getStatsLimitParameter(r)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+
+	cardinality, err := h.options.TSDBStats.TenantCardinality(r.Context(), limit, tenantID)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}, func() {}
+	}
+	if cardinality == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.Errorf("no head for tenant %s", tenantID)}, func() {}
+	}
+	cardinality.SeriesChurnByMetricName = h.options.SeriesChurn.top(tenantID, limit)
+	return cardinality, nil, nil, func() {}
+}
+
+func (h *Handler) getStorageHealth(_ *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	return h.options.StorageHealth.Status(), nil, nil, func() {}
+}
+
+func (h *Handler) getTenantDeletions(_ *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	deletions, err := h.options.TenantDeleter.TenantDeletions()
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}, func() {}
+	}
+	return deletions, nil, nil, func() {}
+}
+
+func (h *Handler) getTenantDeletion(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	deletions, err := h.options.TenantDeleter.TenantDeletions(route.Param(r.Context(), "tenant"))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}, func() {}
+	}
+	if len(deletions) == 0 {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: ErrTenantDeletionNotFound}, func() {}
+	}
+	return deletions[0], nil, nil, func() {}
+}
+
+func (h *Handler) markTenantDeletion(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	var opts TenantDeletionOptions
+	for param, v := range map[string]*bool{"serve_reads": &opts.ServeReads, "delete_blocks": &opts.DeleteBlocks} {
+		if r.FormValue(param) == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(r.FormValue(param))
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "parse %s parameter", param)}, func() {}
+		}
+		*v = b
+	}
+
+	deletion, err := h.options.TenantDeleter.MarkTenantForDeletion(route.Param(r.Context(), "tenant"), opts)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	}
+	return deletion, nil, nil, func() {}
+}
+
+func (h *Handler) cancelTenantDeletion(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	switch err := h.options.TenantDeleter.CancelTenantDeletion(route.Param(r.Context(), "tenant")); err {
+	case nil:
+		return nil, nil, nil, func() {}
+	case ErrTenantDeletionNotFound:
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: err}, func() {}
+	case ErrTenantDeletionInProgress:
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+	default:
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}, func() {}
+	}
+}
+
+func (h *Handler) deleteTenantSeries(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "parse form")}, func() {}
+	}
+	if len(r.Form["match[]"]) == 0 {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("no match[] parameter provided")}, func() {}
+	}
+
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+	for param, v := range map[string]*int64{"start": &mint, "end": &maxt} {
+		t, err := qapi.ParseTimeParam(r, param, time.Time{})
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+		}
+		if !t.IsZero() {
+			*v = t.UnixMilli()
+		}
+	}
+
+	tenant := route.Param(r.Context(), "tenant")
+	for _, s := range r.Form["match[]"] {
+		ms, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}, func() {}
+		}
+		switch err := h.options.TenantDeleter.DeleteTenantSeries(r.Context(), tenant, mint, maxt, ms...); err {
+		case nil:
+		case ErrTenantNotFound:
+			return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: err}, func() {}
+		default:
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}, func() {}
+		}
+	}
+	return nil, nil, nil, func() {}
+}
+
+// isTenantMarkedForDeletion returns true if the writes of the given tenant must be rejected, as it is marked for
+// deletion.
+func (h *Handler) isTenantMarkedForDeletion(logger log.Logger, tenant string) bool {
+	if h.options.TenantDeleter == nil {
+		return false
+	}
+	deletions, err := h.options.TenantDeleter.TenantDeletions(tenant)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get tenant deletions", "err", err)
+		return false
+	}
+	return len(deletions) > 0
+}
+
 // Close stops the Handler.
 func (h *Handler) Close() {
 	runutil.CloseWithLogOnErr(h.logger, h.httpSrv, "receive HTTP server")
+	if h.replicator != nil {
+		h.replicator.close()
+	}
 }
 
 // Run serves the HTTP endpoints.
@@ -459,8 +715,22 @@ func newWriteResponse(seriesIDs []int, err error, er endpointReplica) writeRespo
 }
 
 func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
+	h.receiveWrite(w, r, false)
+}
+
+// receiveOTLPHTTP receives OTLP/HTTP metrics export requests, converting their metrics to series the way Prometheus
+// does, before handling them like remote write requests.
+func (h *Handler) receiveOTLPHTTP(w http.ResponseWriter, r *http.Request) {
+	h.receiveWrite(w, r, true)
+}
+
+func (h *Handler) receiveWrite(w http.ResponseWriter, r *http.Request, otlp bool) {
 	var err error
-	span, ctx := tracing.StartSpan(r.Context(), "receive_http")
+	spanName := "receive_http"
+	if otlp {
+		spanName = "receive_otlp_http"
+	}
+	span, ctx := tracing.StartSpan(r.Context(), spanName)
 	span.SetTag("receiver.mode", string(h.receiverMode))
 	defer span.Finish()
 
@@ -474,6 +744,34 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	tLogger := log.With(h.logger, "tenant", tenantHTTP)
 	span.SetTag("tenant", tenantHTTP)
 
+	var (
+		writeV2       bool
+		otlpMediaType string
+	)
+	if otlp {
+		otlpMediaType, err = otlpContentType(r.Header.Get("Content-Type"))
+	} else {
+		writeV2, err = isRemoteWriteV2(r.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if writeV2 {
+		span.SetTag("remote_write.version", "2.0")
+	}
+
+	if h.isTenantMarkedForDeletion(tLogger, tenantHTTP) {
+		http.Error(w, ErrTenantMarkedForDeletion.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Reject requests before reading them, as their bodies are what takes the memory.
+	if !h.options.MemoryAdmission.Admit() {
+		http.Error(w, "receiver is close to its memory limit", http.StatusServiceUnavailable)
+		return
+	}
+
 	writeGate := h.Limiter.WriteGate()
 	tracing.DoInSpan(r.Context(), "receive_write_gate_ismyturn", func(ctx context.Context) {
 		err = writeGate.Start(r.Context())
@@ -492,6 +790,8 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Fail request fully if tenant has exceeded set limit.
 	if !under {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("tenant is above active series limit"))
+		w.Header().Set("Retry-After", strconv.Itoa(int(HeadSeriesLimitsRefreshInterval.Seconds())))
 		http.Error(w, "tenant is above active series limit", http.StatusTooManyRequests)
 		return
 	}
@@ -502,6 +802,7 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	compressed := bytes.Buffer{}
 	if r.ContentLength >= 0 {
 		if !requestLimiter.AllowSizeBytes(tenantHTTP, r.ContentLength) {
+			h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("write request too large"))
 			http.Error(w, "write request too large", http.StatusRequestEntityTooLarge)
 			return
 		}
@@ -514,14 +815,25 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, errors.Wrap(err, "read compressed request body").Error(), http.StatusInternalServerError)
 		return
 	}
-	reqBuf, err := s2.Decode(nil, compressed.Bytes())
-	if err != nil {
-		level.Error(tLogger).Log("msg", "snappy decode error", "err", err)
-		http.Error(w, errors.Wrap(err, "snappy decode error").Error(), http.StatusBadRequest)
-		return
+	var reqBuf []byte
+	if otlp {
+		reqBuf, err = decompressOTLP(r.Header.Get("Content-Encoding"), compressed.Bytes())
+		if err != nil {
+			level.Error(tLogger).Log("msg", "OTLP decompression error", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		reqBuf, err = s2.Decode(nil, compressed.Bytes())
+		if err != nil {
+			level.Error(tLogger).Log("msg", "snappy decode error", "err", err)
+			http.Error(w, errors.Wrap(err, "snappy decode error").Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	if !requestLimiter.AllowSizeBytes(tenantHTTP, int64(len(reqBuf))) {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("write request too large"))
 		http.Error(w, "write request too large", http.StatusRequestEntityTooLarge)
 		return
 	}
@@ -530,7 +842,26 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	// from the whole request. Ensure that we always copy those when we want to
 	// store them for longer time.
 	var wreq prompb.WriteRequest
-	if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
+	if otlp {
+		converted, err := decodeOTLPWriteRequest(tLogger, otlpMediaType, reqBuf, h.options.OTLPPromoteResourceAttributes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wreq = *converted
+	} else if writeV2 {
+		var wreqV2 writev2pb.Request
+		if err := wreqV2.Unmarshal(reqBuf); err != nil {
+			http.Error(w, errors.Wrap(err, "decode remote write 2.0 request").Error(), http.StatusBadRequest)
+			return
+		}
+		converted, err := wreqV2.ToV1()
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "convert remote write 2.0 request").Error(), http.StatusBadRequest)
+			return
+		}
+		wreq = *converted
+	} else if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -551,13 +882,20 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		if len(wreq.Metadata) > 0 {
 			// TODO(bwplotka): Do we need this error message?
 			level.Debug(tLogger).Log("msg", "only metadata from client; metadata ingestion not supported; skipping")
+			if writeV2 {
+				setRemoteWriteV2WrittenHeaders(w, &wreq)
+			}
 			return
 		}
 		level.Debug(tLogger).Log("msg", "empty remote write request; client bug or newer remote write protocol used?; skipping")
+		if writeV2 {
+			setRemoteWriteV2WrittenHeaders(w, &wreq)
+		}
 		return
 	}
 
 	if !requestLimiter.AllowSeries(tenantHTTP, int64(len(wreq.Timeseries))) {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("too many timeseries"))
 		http.Error(w, "too many timeseries", http.StatusRequestEntityTooLarge)
 		return
 	}
@@ -567,17 +905,55 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		totalSamples += len(timeseries.Samples)
 	}
 	if !requestLimiter.AllowSamples(tenantHTTP, int64(totalSamples)) {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("too many samples"))
 		http.Error(w, "too many samples", http.StatusRequestEntityTooLarge)
 		return
 	}
 
+	// Native histograms are accounted for in the ingestion rate of the tenant: they are samples too.
+	rateSamples := totalSamples
+	for _, timeseries := range wreq.Timeseries {
+		rateSamples += len(timeseries.Histograms)
+	}
+	retryAfter, err := h.Limiter.RateLimiter().AllowSamples(tenantHTTP, int64(rateSamples))
+	if err != nil {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, err)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if retryAfter > 0 {
+		h.options.WriteFailures.Add(tenantHTTP, WriteFailureLimitExceeded, errors.New("tenant is above its samples rate limit"))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "tenant is above its samples rate limit", http.StatusTooManyRequests)
+		return
+	}
+
+	if h.options.NormalizeLabels {
+		h.normalizeLabels(tenantHTTP, &wreq)
+	}
+
 	// Apply relabeling configs.
 	h.relabel(&wreq)
 	if len(wreq.Timeseries) == 0 {
 		level.Debug(tLogger).Log("msg", "remote write request dropped due to relabeling.")
+		if writeV2 {
+			setRemoteWriteV2WrittenHeaders(w, &wreq)
+		}
 		return
 	}
 
+	// Apply streaming aggregations. Only requests from clients are aggregated, forwarded ones are received over gRPC.
+	if h.options.Aggregator != nil {
+		h.options.Aggregator.Aggregate(tenantHTTP, &wreq)
+		if len(wreq.Timeseries) == 0 {
+			level.Debug(tLogger).Log("msg", "remote write request dropped due to streaming aggregation.")
+			if writeV2 {
+				setRemoteWriteV2WrittenHeaders(w, &wreq)
+			}
+			return
+		}
+	}
+
 	responseStatusCode := http.StatusOK
 	tenantStats, err := h.handleRequest(ctx, rep, tenantHTTP, &wreq)
 	if err != nil {
@@ -589,6 +965,8 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 			responseStatusCode = http.StatusServiceUnavailable
 		case errConflict:
 			responseStatusCode = http.StatusConflict
+		case errSeriesChurnLimited:
+			responseStatusCode = http.StatusTooManyRequests
 		case errBadReplica:
 			responseStatusCode = http.StatusBadRequest
 		default:
@@ -596,6 +974,8 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 			responseStatusCode = http.StatusInternalServerError
 		}
 		http.Error(w, err.Error(), responseStatusCode)
+	} else if writeV2 {
+		setRemoteWriteV2WrittenHeaders(w, &wreq)
 	}
 
 	for tenant, stats := range tenantStats {
@@ -604,6 +984,43 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// isRemoteWriteV2 returns true if the content type of a remote write request is the one of the Remote Write 2.0
+// protocol, and false if it is the one of the 1.0 protocol, which is assumed when it is not set.
+func isRemoteWriteV2(contentType string) (bool, error) {
+	if contentType == "" {
+		return false, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, errors.Wrapf(err, "parse content type %q", contentType)
+	}
+	if mediaType != "application/x-protobuf" {
+		return false, errors.Errorf("unsupported content type %q, expected application/x-protobuf", contentType)
+	}
+	switch params["proto"] {
+	case "", "prometheus.WriteRequest":
+		return false, nil
+	case writev2pb.ProtoMessage:
+		return true, nil
+	default:
+		return false, errors.Errorf("unsupported remote write protobuf message %q, expected prometheus.WriteRequest or %s", params["proto"], writev2pb.ProtoMessage)
+	}
+}
+
+// setRemoteWriteV2WrittenHeaders sets the headers of the response to a Remote Write 2.0 request telling the number
+// of samples, histograms and exemplars which were written.
+func setRemoteWriteV2WrittenHeaders(w http.ResponseWriter, wreq *prompb.WriteRequest) {
+	var samples, histograms, exemplars int
+	for _, ts := range wreq.Timeseries {
+		samples += len(ts.Samples)
+		histograms += len(ts.Histograms)
+		exemplars += len(ts.Exemplars)
+	}
+	w.Header().Set("X-Prometheus-Remote-Write-Samples-Written", strconv.Itoa(samples))
+	w.Header().Set("X-Prometheus-Remote-Write-Histograms-Written", strconv.Itoa(histograms))
+	w.Header().Set("X-Prometheus-Remote-Write-Exemplars-Written", strconv.Itoa(exemplars))
+}
+
 type requestStats struct {
 	timeseries   int
 	totalSamples int
@@ -623,10 +1040,17 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenantHTTP stri
 		rep = 0
 	}
 
+	h.mtx.RLock()
+	replicationFactor, err := h.tenantReplicationFactor(tenantHTTP)
+	h.mtx.RUnlock()
+	if err != nil {
+		return tenantRequestStats{}, err
+	}
+
 	// The replica value in the header is one-indexed, thus we need >.
-	if rep > h.options.ReplicationFactor {
+	if rep > replicationFactor {
 		level.Error(tLogger).Log("err", errBadReplica, "msg", "write request rejected",
-			"request_replica", rep, "replication_factor", h.options.ReplicationFactor)
+			"request_replica", rep, "replication_factor", replicationFactor)
 		return tenantRequestStats{}, errBadReplica
 	}
 
@@ -643,6 +1067,13 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenantHTTP stri
 	return h.forward(ctx, tenantHTTP, r, wreq)
 }
 
+// WriteAggregates writes the series computed by the streaming aggregations for the given tenant. They are
+// distributed and replicated as the series received from clients.
+func (h *Handler) WriteAggregates(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error {
+	_, err := h.handleRequest(ctx, 0, tenant, wreq)
+	return err
+}
+
 // forward accepts a write request, batches its time series by
 // corresponding endpoint, and forwards them in parallel to the
 // correct endpoint. Requests destined for the local node are written
@@ -655,13 +1086,10 @@ func (h *Handler) forward(ctx context.Context, tenantHTTP string, r replica, wre
 	span, ctx := tracing.StartSpan(ctx, "receive_fanout_forward")
 	defer span.Finish()
 
+	// Unreplicated series are replicated by the replication factor of their tenant.
 	var replicas []uint64
 	if r.replicated {
 		replicas = []uint64{r.n}
-	} else {
-		for rn := uint64(0); rn < h.options.ReplicationFactor; rn++ {
-			replicas = append(replicas, rn)
-		}
 	}
 
 	params := remoteWriteParams{
@@ -675,8 +1103,10 @@ func (h *Handler) forward(ctx context.Context, tenantHTTP string, r replica, wre
 }
 
 type remoteWriteParams struct {
-	tenant            string
-	writeRequest      *prompb.WriteRequest
+	tenant       string
+	writeRequest *prompb.WriteRequest
+	// replicas are the replicas to write the series to, all the replicas of the replication factor of the tenant of
+	// every series if nil.
 	replicas          []uint64
 	alreadyReplicated bool
 }
@@ -730,7 +1160,7 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 	}
 	requestLogger := log.With(h.logger, logTags...)
 
-	localWrites, remoteWrites, err := h.distributeTimeseriesToReplicas(params.tenant, params.replicas, params.writeRequest.Timeseries)
+	localWrites, remoteWrites, quorums, err := h.distributeTimeseriesToReplicas(params.tenant, params.replicas, params.writeRequest.Timeseries)
 	if err != nil {
 		level.Error(requestLogger).Log("msg", "failed to distribute timeseries to replicas", "err", err)
 		return stats, err
@@ -748,7 +1178,11 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 	responses := make(chan writeResponse, maxBufferedResponses)
 	wg := sync.WaitGroup{}
 
-	h.sendWrites(ctx, &wg, params, localWrites, remoteWrites, responses)
+	var tracker *replicationTracker
+	if h.replicator != nil && !params.alreadyReplicated {
+		tracker = h.replicator.newTracker()
+	}
+	h.sendWrites(ctx, &wg, params, localWrites, remoteWrites, tracker, responses)
 
 	go func() {
 		wg.Wait()
@@ -767,12 +1201,13 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 		}()
 	}()
 
-	quorum := h.writeQuorum()
 	if params.alreadyReplicated {
-		quorum = 1
+		for i := range quorums {
+			quorums[i] = 1
+		}
 	}
 	successes := make([]int, len(params.writeRequest.Timeseries))
-	seriesErrs := newReplicationErrors(quorum, len(params.writeRequest.Timeseries))
+	seriesErrs := newReplicationErrors(quorums)
 	for {
 		select {
 		case <-ctx.Done():
@@ -782,6 +1217,9 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 				for _, seriesErr := range seriesErrs {
 					writeErrors.Add(seriesErr)
 				}
+				if writeErrors.ErrOrNil() == nil {
+					tracker.ack()
+				}
 				return stats, writeErrors.ErrOrNil()
 			}
 
@@ -797,7 +1235,8 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 			for _, seriesID := range resp.seriesIDs {
 				successes[seriesID]++
 			}
-			if quorumReached(successes, quorum) {
+			if quorumReached(successes, quorums) {
+				tracker.ack()
 				return stats, nil
 			}
 		}
@@ -805,18 +1244,20 @@ func (h *Handler) fanoutForward(ctx context.Context, params remoteWriteParams) (
 }
 
 // distributeTimeseriesToReplicas distributes the given timeseries from the tenant to different endpoints in a manner
-// that achieves the replication factor indicated by replicas.
+// that achieves the replication factor indicated by replicas, or the one of the tenant of every series if nil.
 // The first return value are the series that should be written to the local node. The second return value are the
-// series that should be written to remote nodes.
+// series that should be written to remote nodes. The third return value is the write quorum of every series.
 func (h *Handler) distributeTimeseriesToReplicas(
 	tenantHTTP string,
 	replicas []uint64,
 	timeseries []prompb.TimeSeries,
-) (map[endpointReplica]map[string]trackedSeries, map[endpointReplica]map[string]trackedSeries, error) {
+) (map[endpointReplica]map[string]trackedSeries, map[endpointReplica]map[string]trackedSeries, []int, error) {
 	h.mtx.RLock()
 	defer h.mtx.RUnlock()
 	remoteWrites := make(map[endpointReplica]map[string]trackedSeries)
 	localWrites := make(map[endpointReplica]map[string]trackedSeries)
+	quorums := make([]int, len(timeseries))
+	tenantReplicas := map[string][]uint64{}
 	for tsIndex, ts := range timeseries {
 		var tenant = tenantHTTP
 
@@ -836,10 +1277,27 @@ func (h *Handler) distributeTimeseriesToReplicas(
 			}
 		}
 
-		for _, rn := range replicas {
+		seriesReplicas := replicas
+		if seriesReplicas == nil {
+			var ok bool
+			if seriesReplicas, ok = tenantReplicas[tenant]; !ok {
+				replicationFactor, err := h.tenantReplicationFactor(tenant)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				seriesReplicas = make([]uint64, 0, replicationFactor)
+				for rn := uint64(0); rn < replicationFactor; rn++ {
+					seriesReplicas = append(seriesReplicas, rn)
+				}
+				tenantReplicas[tenant] = seriesReplicas
+			}
+		}
+		quorums[tsIndex] = h.replicationQuorum(uint64(len(seriesReplicas)))
+
+		for _, rn := range seriesReplicas {
 			endpoint, err := h.hashring.GetN(tenant, &ts, rn)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			endpointReplica := endpointReplica{endpoint: endpoint, replica: rn}
 			var writeDestination = remoteWrites
@@ -863,17 +1321,18 @@ func (h *Handler) distributeTimeseriesToReplicas(
 			writeDestination[endpointReplica][tenant] = tenantSeries
 		}
 	}
-	return localWrites, remoteWrites, nil
+	return localWrites, remoteWrites, quorums, nil
 }
 
 // sendWrites sends the local and remote writes to execute concurrently, controlling them through the provided sync.WaitGroup.
-// The responses from the writes are sent to the responses channel.
+// The responses from the writes are sent to the responses channel, and the results of the remote writes to the tracker.
 func (h *Handler) sendWrites(
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	params remoteWriteParams,
 	localWrites map[endpointReplica]map[string]trackedSeries,
 	remoteWrites map[endpointReplica]map[string]trackedSeries,
+	tracker *replicationTracker,
 	responses chan writeResponse,
 ) {
 	// Do the writes to the local node first. This should be easy and fast.
@@ -890,7 +1349,7 @@ func (h *Handler) sendWrites(
 		for tenant, trackedSeries := range remoteWrites[writeDestination] {
 			wg.Add(1)
 
-			h.sendRemoteWrite(ctx, tenant, writeDestination, trackedSeries, params.alreadyReplicated, responses, wg)
+			h.sendRemoteWrite(ctx, tenant, writeDestination, trackedSeries, params.alreadyReplicated, tracker, responses, wg)
 		}
 	}
 }
@@ -945,29 +1404,34 @@ func (h *Handler) sendRemoteWrite(
 	endpointReplica endpointReplica,
 	trackedSeries trackedSeries,
 	alreadyReplicated bool,
+	tracker *replicationTracker,
 	responses chan writeResponse,
 	wg *sync.WaitGroup,
 ) {
 	endpoint := endpointReplica.endpoint
+	// This is called "real" because it's 1-indexed.
+	realReplicationIndex := int64(endpointReplica.replica + 1)
+	req := &storepb.WriteRequest{
+		Timeseries: trackedSeries.timeSeries,
+		Tenant:     tenant,
+		// Increment replica since on-the-wire format is 1-indexed and 0 indicates un-replicated.
+		Replica: realReplicationIndex,
+	}
+
 	cl, err := h.peers.getConnection(ctx, endpoint)
 	if err != nil {
 		if errors.Is(err, errUnavailable) {
 			err = errors.Wrapf(errUnavailable, "backing off forward request for endpoint %v", endpointReplica)
 		}
+		tracker.done(endpoint, req, err)
 		responses <- newWriteResponse(trackedSeries.seriesIDs, err, endpointReplica)
 		wg.Done()
 		return
 	}
 
-	// This is called "real" because it's 1-indexed.
-	realReplicationIndex := int64(endpointReplica.replica + 1)
 	// Actually make the request against the endpoint we determined should handle these time series.
-	cl.RemoteWriteAsync(ctx, &storepb.WriteRequest{
-		Timeseries: trackedSeries.timeSeries,
-		Tenant:     tenant,
-		// Increment replica since on-the-wire format is 1-indexed and 0 indicates un-replicated.
-		Replica: realReplicationIndex,
-	}, endpointReplica, trackedSeries.seriesIDs, responses, func(err error) {
+	cl.RemoteWriteAsync(ctx, req, endpointReplica, trackedSeries.seriesIDs, responses, func(err error) {
+		tracker.done(endpoint, req, err)
 		if err == nil {
 			h.forwardRequests.WithLabelValues(labelSuccess).Inc()
 			if !alreadyReplicated {
@@ -975,25 +1439,64 @@ func (h *Handler) sendRemoteWrite(
 			}
 			h.peers.markPeerAvailable(endpoint)
 		} else {
-			// Check if peer connection is unavailable, update the peer state to avoid spamming that peer.
-			if st, ok := status.FromError(err); ok {
-				if st.Code() == codes.Unavailable {
-					h.peers.markPeerUnavailable(endpointReplica.endpoint)
-				}
-			}
+			h.peers.markPeerFailed(endpointReplica.endpoint, err)
 		}
 		wg.Done()
 	})
 }
 
+// tenantReplicationFactor returns the replication factor of the given tenant, the one of its hashring if overridden. The
+// handler mutex must be held.
+func (h *Handler) tenantReplicationFactor(tenant string) (uint64, error) {
+	if rf, ok := h.hashring.(tenantReplicationFactorer); ok {
+		n, err := rf.ReplicationFactor(tenant)
+		if err != nil {
+			return 0, err
+		}
+		if n != 0 {
+			return n, nil
+		}
+	}
+	return h.options.ReplicationFactor, nil
+}
+
+// replicationQuorum returns the number of the given replicas of a series that have to confirm write success before
+// claiming replication success: the configured write quorum capped at the replicas, or their majority.
+func (h *Handler) replicationQuorum(replicas uint64) int {
+	if q := h.options.ReplicationWriteQuorum; q > 0 {
+		return int(min(q, replicas))
+	}
+	return writeQuorum(replicas)
+}
+
+// replicateRemoteWrite writes the given request to the endpoint, for the async replication of the failed writes of the
+// acknowledged requests.
+func (h *Handler) replicateRemoteWrite(ctx context.Context, endpoint string, req *storepb.WriteRequest) error {
+	cl, err := h.peers.getConnection(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.options.ForwardTimeout)
+	defer cancel()
+	if _, err := cl.RemoteWrite(ctx, req); err != nil {
+		h.peers.markPeerFailed(endpoint, err)
+		return err
+	}
+	h.forwardRequests.WithLabelValues(labelSuccess).Inc()
+	h.peers.markPeerAvailable(endpoint)
+	return nil
+}
+
 // writeQuorum returns minimum number of replicas that has to confirm write success before claiming replication success.
-func (h *Handler) writeQuorum() int {
-	return int((h.options.ReplicationFactor / 2) + 1)
+func writeQuorum(replicationFactor uint64) int {
+	return int((replicationFactor / 2) + 1)
 }
 
-func quorumReached(successes []int, successThreshold int) bool {
-	for _, success := range successes {
-		if success < successThreshold {
+// quorumReached returns true if every series was written successfully at least as many times as its quorum.
+func quorumReached(successes []int, quorums []int) bool {
+	for i, success := range successes {
+		if success < quorums[i] {
 			return false
 		}
 	}
@@ -1006,6 +1509,10 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 	span, ctx := tracing.StartSpan(ctx, "receive_grpc")
 	defer span.Finish()
 
+	if h.isTenantMarkedForDeletion(h.logger, r.Tenant) {
+		return nil, status.Error(codes.PermissionDenied, ErrTenantMarkedForDeletion.Error())
+	}
+
 	_, err := h.handleRequest(ctx, uint64(r.Replica), r.Tenant, &prompb.WriteRequest{Timeseries: r.Timeseries})
 	if err != nil {
 		level.Debug(h.logger).Log("msg", "failed to handle request", "err", err)
@@ -1019,6 +1526,8 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 		return nil, status.Error(codes.Unavailable, err.Error())
 	case errConflict:
 		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case errSeriesChurnLimited:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
 	case errBadReplica:
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	default:
@@ -1026,6 +1535,25 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 	}
 }
 
+// normalizeLabels normalizes the labels of the series of the given request with out of order or duplicate labels, before
+// they are hashed to distribute them, so that semantically identical series are written to the same series. Series
+// with ambiguous labels are left as they are, to be rejected by the writer.
+func (h *Handler) normalizeLabels(tenant string, wreq *prompb.WriteRequest) {
+	for i := range wreq.Timeseries {
+		ts := &wreq.Timeseries[i]
+		err := labelpb.ValidateLabels(ts.Labels)
+		if err != labelpb.ErrOutOfOrderLabels && err != labelpb.ErrDuplicateLabels {
+			continue
+		}
+		lbls, nerr := labelpb.NormalizeLabels(ts.Labels)
+		if nerr != nil {
+			continue
+		}
+		ts.Labels = lbls
+		h.normalizedSeries.WithLabelValues(tenant, invalidLabelsReason(err)).Inc()
+	}
+}
+
 // relabel relabels the time series labels in the remote write request.
 func (h *Handler) relabel(wreq *prompb.WriteRequest) {
 	if len(h.options.RelabelConfigs) == 0 {
@@ -1062,7 +1590,8 @@ func isSampleConflictErr(err error) bool {
 	return err == storage.ErrDuplicateSampleForTimestamp ||
 		err == storage.ErrOutOfOrderSample ||
 		err == storage.ErrOutOfBounds ||
-		err == storage.ErrTooOldSample
+		err == storage.ErrTooOldSample ||
+		err == storage.ErrNativeHistogramsDisabled
 }
 
 // isExemplarConflictErr returns whether or not the given error represents
@@ -1088,6 +1617,12 @@ func isNotReady(err error) bool {
 		status.Code(err) == codes.Unavailable
 }
 
+// isSeriesChurnLimited returns whether or not the given error represents series refused by the series churn limit.
+func isSeriesChurnLimited(err error) bool {
+	return err == errSeriesChurnLimited ||
+		status.Code(err) == codes.ResourceExhausted
+}
+
 // isUnavailable returns whether or not the given error represents an unavailable error.
 func isUnavailable(err error) bool {
 	return err == errUnavailable ||
@@ -1203,6 +1738,7 @@ func (es *writeErrors) Cause() error {
 	expErrs := expectedErrors{
 		{err: errUnavailable, cause: isUnavailable},
 		{err: errNotReady, cause: isNotReady},
+		{err: errSeriesChurnLimited, cause: isSeriesChurnLimited},
 		{err: errConflict, cause: isConflict},
 	}
 
@@ -1254,6 +1790,7 @@ func (es *replicationErrors) Cause() error {
 		{err: errConflict, cause: isConflict},
 		{err: errNotReady, cause: isNotReady},
 		{err: errUnavailable, cause: isUnavailable},
+		{err: errSeriesChurnLimited, cause: isSeriesChurnLimited},
 	}
 	for _, exp := range expErrs {
 		exp.count = 0
@@ -1277,10 +1814,10 @@ func (es *replicationErrors) Cause() error {
 	return nil
 }
 
-func newReplicationErrors(threshold, numErrors int) []*replicationErrors {
-	errs := make([]*replicationErrors, numErrors)
+func newReplicationErrors(thresholds []int) []*replicationErrors {
+	errs := make([]*replicationErrors, len(thresholds))
 	for i := range errs {
-		errs[i] = &replicationErrors{threshold: threshold}
+		errs[i] = &replicationErrors{threshold: thresholds[i]}
 	}
 	return errs
 }
@@ -1297,6 +1834,10 @@ func (pw *peerWorker) RemoteWrite(ctx context.Context, in *storepb.WriteRequest,
 	return storepb.NewWriteableStoreClient(pw.cc).RemoteWrite(ctx, in)
 }
 
+func (pw *peerWorker) Info(ctx context.Context, in *infopb.InfoRequest, opts ...grpc.CallOption) (*infopb.InfoResponse, error) {
+	return infopb.NewInfoClient(pw.cc).Info(ctx, in, opts...)
+}
+
 type peerWorker struct {
 	cc *grpc.ClientConn
 	wp pool.WorkerPool
@@ -1304,7 +1845,7 @@ type peerWorker struct {
 	forwardDelay prometheus.Histogram
 }
 
-func newPeerGroup(backoff backoff.Backoff, forwardDelay prometheus.Histogram, asyncForwardWorkersCount uint, dialOpts ...grpc.DialOption) peersContainer {
+func newPeerGroup(backoff backoff.Backoff, forwardDelay prometheus.Histogram, breakers *circuitBreakers, asyncForwardWorkersCount uint, dialOpts ...grpc.DialOption) peersContainer {
 	return &peerGroup{
 		dialOpts:                 dialOpts,
 		connections:              map[string]*peerWorker{},
@@ -1313,6 +1854,7 @@ func newPeerGroup(backoff backoff.Backoff, forwardDelay prometheus.Histogram, as
 		peerStates:               make(map[string]*retryState),
 		expBackoff:               backoff,
 		forwardDelay:             forwardDelay,
+		breakers:                 breakers,
 		asyncForwardWorkersCount: asyncForwardWorkersCount,
 	}
 }
@@ -1322,7 +1864,10 @@ type peersContainer interface {
 	getConnection(context.Context, string) (WriteableStoreAsyncClient, error)
 	markPeerUnavailable(string)
 	markPeerAvailable(string)
+	// markPeerFailed records a request to the peer which failed with the given error.
+	markPeerFailed(string, error)
 	reset()
+	status() []PeerStatus
 }
 
 func (p *peerWorker) RemoteWriteAsync(ctx context.Context, req *storepb.WriteRequest, er endpointReplica, seriesIDs []int, responseWriter chan writeResponse, cb func(error)) {
@@ -1356,6 +1901,7 @@ type peerGroup struct {
 	peerStates               map[string]*retryState
 	expBackoff               backoff.Backoff
 	forwardDelay             prometheus.Histogram
+	breakers                 *circuitBreakers
 	asyncForwardWorkersCount uint
 
 	m sync.RWMutex
@@ -1388,6 +1934,9 @@ func (p *peerGroup) getConnection(ctx context.Context, addr string) (WriteableSt
 	if !p.isPeerUp(addr) {
 		return nil, errUnavailable
 	}
+	if !p.breakers.allow(addr) {
+		return nil, errors.Wrap(errUnavailable, "circuit breaker open")
+	}
 
 	// use a RLock first to prevent blocking if we don't need to.
 	p.m.RLock()
@@ -1407,6 +1956,7 @@ func (p *peerGroup) getConnection(ctx context.Context, addr string) (WriteableSt
 	conn, err := p.dialer(addr, p.dialOpts...)
 	if err != nil {
 		p.markPeerUnavailableUnlocked(addr)
+		p.breakers.failure(addr)
 		dialError := errors.Wrap(err, "failed to dial peer")
 		return nil, errors.Wrap(dialError, errUnavailable.Error())
 	}
@@ -1436,6 +1986,23 @@ func (p *peerGroup) markPeerAvailable(addr string) {
 	p.m.Lock()
 	defer p.m.Unlock()
 	delete(p.peerStates, addr)
+	p.breakers.success(addr)
+}
+
+func (p *peerGroup) markPeerFailed(addr string, err error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Check if peer connection is unavailable, update the peer state to avoid spamming that peer.
+	if status.Code(err) == codes.Unavailable {
+		p.markPeerUnavailableUnlocked(addr)
+	}
+	// Requests which were answered with an error tell that the peer is healthy.
+	if isCircuitBreakerFailure(err) {
+		p.breakers.failure(addr)
+	} else {
+		p.breakers.success(addr)
+	}
 }
 
 func (p *peerGroup) isPeerUp(addr string) bool {
@@ -1448,7 +2015,48 @@ func (p *peerGroup) isPeerUp(addr string) bool {
 	return time.Now().After(state.nextAllowed)
 }
 
+// status returns the forwarding health of the peers which have a connection or failed, sorted by address.
+func (p *peerGroup) status() []PeerStatus {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	peers := make(map[string]*PeerStatus, len(p.connections))
+	for addr := range p.connections {
+		peers[addr] = &PeerStatus{Address: addr, Connected: true, Up: true}
+	}
+	now := time.Now()
+	for addr, state := range p.peerStates {
+		s, ok := peers[addr]
+		if !ok {
+			s = &PeerStatus{Address: addr}
+			peers[addr] = s
+		}
+		s.FailedAttempts = int(state.attempt) + 1
+		s.Up = now.After(state.nextAllowed)
+		if !s.Up {
+			nextAllowed := state.nextAllowed
+			s.NextAttemptAt = &nextAllowed
+		}
+	}
+	for addr, state := range p.breakers.states() {
+		s, ok := peers[addr]
+		if !ok {
+			s = &PeerStatus{Address: addr, Up: true}
+			peers[addr] = s
+		}
+		s.CircuitBreaker = state
+	}
+
+	res := make([]PeerStatus, 0, len(peers))
+	for _, s := range peers {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res
+}
+
 func (p *peerGroup) reset() {
 	p.expBackoff.Reset()
 	p.peerStates = make(map[string]*retryState)
+	p.breakers.reset()
 }
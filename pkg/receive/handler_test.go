@@ -31,6 +31,7 @@ import (
 	"github.com/golang/snappy"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/histogram"
@@ -50,6 +51,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
 	"github.com/thanos-io/thanos/pkg/tenancy"
 )
 
@@ -180,9 +182,16 @@ func (g *fakePeersGroup) markPeerUnavailable(s string) {
 func (g *fakePeersGroup) markPeerAvailable(s string) {
 }
 
+func (g *fakePeersGroup) markPeerFailed(s string, err error) {
+}
+
 func (g *fakePeersGroup) reset() {
 }
 
+func (g *fakePeersGroup) status() []PeerStatus {
+	return nil
+}
+
 func (g *fakePeersGroup) close(addr string) error {
 	if g.closeCalled == nil {
 		g.closeCalled = map[string]bool{}
@@ -220,7 +229,7 @@ func newTestHandlerHashring(appendables []*fakeAppendable, replicationFactor uin
 			ReplicaHeader:     DefaultReplicaHeader,
 			ReplicationFactor: replicationFactor,
 			ForwardTimeout:    5 * time.Minute,
-			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i]), wOpts),
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i]), nil, wOpts),
 			Limiter:           limiter,
 		})
 		handlers = append(handlers, h)
@@ -1001,7 +1010,7 @@ func benchmarkHandlerMultiTSDBReceiveRemoteWrite(b testutil.TB) {
 		metadata.NoneFunc,
 	)
 	defer func() { testutil.Ok(b, m.Close()) }()
-	handler.writer = NewWriter(logger, m, &WriterOptions{})
+	handler.writer = NewWriter(logger, m, nil, &WriterOptions{})
 
 	testutil.Ok(b, m.Flush())
 	testutil.Ok(b, m.Open())
@@ -1572,6 +1581,29 @@ func TestRelabel(t *testing.T) {
 	}
 }
 
+func TestNormalizeLabels(t *testing.T) {
+	h := NewHandler(nil, &Options{NormalizeLabels: true, Registry: prometheus.NewRegistry()})
+
+	wreq := prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}}},
+			{Labels: []labelpb.ZLabel{{Name: "job", Value: "a"}, {Name: "__name__", Value: "up"}}},
+			{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}, {Name: "job", Value: "a"}}},
+			// Ambiguous labels are left as they are.
+			{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}, {Name: "job", Value: "b"}}},
+		},
+	}
+	h.normalizeLabels("tenant", &wreq)
+
+	normalized := []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}}
+	for _, ts := range wreq.Timeseries[:3] {
+		testutil.Equals(t, normalized, ts.Labels)
+	}
+	testutil.Equals(t, labelpb.ErrDuplicateLabels, labelpb.ValidateLabels(wreq.Timeseries[3].Labels))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.normalizedSeries.WithLabelValues("tenant", "out_of_order")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.normalizedSeries.WithLabelValues("tenant", "duplicate")))
+}
+
 func TestGetStatsLimitParameter(t *testing.T) {
 	t.Run("invalid limit parameter, not integer", func(t *testing.T) {
 		r, err := http.NewRequest(http.MethodGet, "http://0:0", nil)
@@ -1689,7 +1721,7 @@ func TestDistributeSeries(t *testing.T) {
 	hr := &hashringSeenTenants{Hashring: hashring}
 	h.Hashring(hr)
 
-	_, remote, err := h.distributeTimeseriesToReplicas(
+	_, remote, _, err := h.distributeTimeseriesToReplicas(
 		"foo",
 		[]uint64{0},
 		[]prompb.TimeSeries{
@@ -1711,6 +1743,40 @@ func TestDistributeSeries(t *testing.T) {
 	require.Equal(t, map[string]struct{}{"bar": {}, "boo": {}}, hr.seenTenants)
 }
 
+func TestDistributeSeries_TenantReplicationFactor(t *testing.T) {
+	h := NewHandler(nil, &Options{
+		ReplicationFactor:    3,
+		SplitTenantLabelName: "thanos_tenant_id",
+	})
+
+	endpoints := []Endpoint{{Address: "a"}, {Address: "b"}, {Address: "c"}}
+	hashring, err := NewMultiHashring(AlgorithmHashmod, 3, []HashringConfig{
+		{Hashring: "dev", Tenants: []string{"dev"}, Endpoints: endpoints, ReplicationFactor: 1},
+		{Hashring: "default", Endpoints: endpoints},
+	})
+	require.NoError(t, err)
+	h.Hashring(hashring)
+
+	_, remote, quorums, err := h.distributeTimeseriesToReplicas(
+		"prod",
+		nil,
+		[]prompb.TimeSeries{
+			{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("a", "b", "thanos_tenant_id", "dev"))},
+			{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("a", "b"))},
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, quorums)
+
+	replicas := map[string]int{}
+	for _, tenants := range remote {
+		for tenant, series := range tenants {
+			replicas[tenant] += len(series.timeSeries)
+		}
+	}
+	require.Equal(t, map[string]int{"dev": 1, "prod": 3}, replicas)
+}
+
 func TestHandlerFlippingHashrings(t *testing.T) {
 	h := NewHandler(log.NewLogfmtLogger(os.Stderr), &Options{})
 	t.Cleanup(h.Close)
@@ -1786,3 +1852,61 @@ func TestHandlerFlippingHashrings(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+func TestReceiveRemoteWriteV2(t *testing.T) {
+	appendables := []*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}
+	handlers, _, err := newTestHandlerHashring(appendables, 1, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	handler := handlers[0]
+
+	wreq := &writev2pb.Request{
+		Symbols: []string{"", "__name__", "up", "job", "api"},
+		Timeseries: []writev2pb.TimeSeries{{
+			LabelsRefs: []uint32{1, 2, 3, 4},
+			Samples:    []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 1, Timestamp: 20}},
+			Metadata:   writev2pb.Metadata{Type: prompb.MetricMetadata_GAUGE},
+		}},
+	}
+	buf, err := wreq.Marshal()
+	testutil.Ok(t, err)
+
+	post := func(contentType string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", handler.options.Endpoint, bytes.NewBuffer(snappy.Encode(nil, buf)))
+		testutil.Ok(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(handler.options.TenantHeader, "foo")
+		rec := httptest.NewRecorder()
+		handler.receiveHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("application/x-protobuf;proto=io.prometheus.write.v2.Request")
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "2", rec.Header().Get("X-Prometheus-Remote-Write-Samples-Written"))
+	testutil.Equals(t, "0", rec.Header().Get("X-Prometheus-Remote-Write-Histograms-Written"))
+	testutil.Equals(t, "0", rec.Header().Get("X-Prometheus-Remote-Write-Exemplars-Written"))
+	testutil.Equals(t, 2, len(appendables[0].appender.(*fakeAppender).Get(labels.FromStrings("__name__", "up", "job", "api"))))
+
+	testutil.Equals(t, http.StatusUnsupportedMediaType, post("application/x-protobuf;proto=io.prometheus.write.v3.Request").Code)
+	testutil.Equals(t, http.StatusUnsupportedMediaType, post("application/json").Code)
+}
+
+func TestIsRemoteWriteV2(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		v2          bool
+		err         bool
+	}{
+		{contentType: ""},
+		{contentType: "application/x-protobuf"},
+		{contentType: "application/x-protobuf;proto=prometheus.WriteRequest"},
+		{contentType: "application/x-protobuf; proto=io.prometheus.write.v2.Request", v2: true},
+		{contentType: "application/x-protobuf;proto=foo", err: true},
+		{contentType: "text/plain", err: true},
+		{contentType: ";;", err: true},
+	} {
+		v2, err := isRemoteWriteV2(tc.contentType)
+		testutil.Equals(t, tc.err, err != nil, "%s: %v", tc.contentType, err)
+		testutil.Equals(t, tc.v2, v2, tc.contentType)
+	}
+}
@@ -29,6 +29,12 @@ type HashringAlgorithm string
 const (
 	AlgorithmHashmod HashringAlgorithm = "hashmod"
 	AlgorithmKetama  HashringAlgorithm = "ketama"
+	// AlgorithmKetamaBoundedLoads is the ketama algorithm with bounded loads: no endpoint owns more than the load
+	// factor of its fair share of the series, the sections of the ring above it going to the next endpoints.
+	AlgorithmKetamaBoundedLoads HashringAlgorithm = "ketama_bounded_loads"
+
+	// DefaultLoadFactor is the default load factor of the ketama_bounded_loads algorithm.
+	DefaultLoadFactor = 1.25
 
 	// SectionsPerNode is the number of sections in the ring assigned to each node
 	// in the ketama hashring. A higher number yields a better series distribution,
@@ -61,6 +67,12 @@ type Hashring interface {
 	Nodes() []string
 }
 
+// tenantReplicationFactorer is implemented by hashrings overriding the replication factor of some tenants.
+type tenantReplicationFactorer interface {
+	// ReplicationFactor returns the replication factor of the given tenant, or zero if it is not overridden.
+	ReplicationFactor(tenant string) (uint64, error)
+}
+
 // SingleNodeHashring always returns the same node.
 type SingleNodeHashring string
 
@@ -135,15 +147,31 @@ type ketamaHashring struct {
 	sections     sections
 	numEndpoints uint64
 	nodes        []string
+	// loadFactor bounds the load of the endpoints, if not zero.
+	loadFactor float64
 }
 
 func newKetamaHashring(endpoints []Endpoint, sectionsPerNode int, replicationFactor uint64) (*ketamaHashring, error) {
+	return newBoundedLoadsKetamaHashring(endpoints, sectionsPerNode, replicationFactor, 0)
+}
+
+// newBoundedLoadsKetamaHashring returns a ketama hashring where no endpoint owns more than loadFactor times its fair
+// share of the hash space, given its weight. The loads are not bounded if loadFactor is zero.
+func newBoundedLoadsKetamaHashring(endpoints []Endpoint, sectionsPerNode int, replicationFactor uint64, loadFactor float64) (*ketamaHashring, error) {
 	numSections := len(endpoints) * sectionsPerNode
 
 	if len(endpoints) < int(replicationFactor) {
 		return nil, errors.New("ketama: amount of endpoints needs to be larger than replication factor")
 
 	}
+	if loadFactor != 0 && loadFactor < 1 {
+		return nil, errors.Errorf("ketama: load factor must be at least 1, got %v", loadFactor)
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.Weight != nil && *endpoint.Weight <= 0 {
+			return nil, errors.Errorf("ketama: weight of endpoint %s must be positive, got %v", endpoint.Address, *endpoint.Weight)
+		}
+	}
 	hash := xxhash.New()
 	availabilityZones := make(map[string]struct{})
 	ringSections := make(sections, 0, numSections)
@@ -152,7 +180,9 @@ func newKetamaHashring(endpoints []Endpoint, sectionsPerNode int, replicationFac
 	for endpointIndex, endpoint := range endpoints {
 		availabilityZones[endpoint.AZ] = struct{}{}
 		nodes = append(nodes, endpoint.Address)
-		for i := 1; i <= sectionsPerNode; i++ {
+		// Sections are numbered from 1 whatever the weight, so that changing the weight of an endpoint only adds or
+		// removes its last sections, moving the series of these sections only.
+		for i := 1; i <= endpointSections(endpoint, sectionsPerNode); i++ {
 			_, _ = hash.Write([]byte(endpoint.Address + ":" + strconv.Itoa(i)))
 			n := &section{
 				az:            endpoint.AZ,
@@ -167,6 +197,9 @@ func newKetamaHashring(endpoints []Endpoint, sectionsPerNode int, replicationFac
 	}
 	sort.Sort(ringSections)
 	sort.Strings(nodes)
+	if loadFactor != 0 {
+		boundSectionLoads(ringSections, endpoints, loadFactor)
+	}
 	calculateSectionReplicas(ringSections, replicationFactor, availabilityZones)
 
 	return &ketamaHashring{
@@ -174,9 +207,65 @@ func newKetamaHashring(endpoints []Endpoint, sectionsPerNode int, replicationFac
 		sections:     ringSections,
 		numEndpoints: uint64(len(endpoints)),
 		nodes:        nodes,
+		loadFactor:   loadFactor,
 	}, nil
 }
 
+// endpointWeight returns the weight of the given endpoint, 1 if not set.
+func endpointWeight(endpoint Endpoint) float64 {
+	if endpoint.Weight == nil {
+		return 1
+	}
+	return *endpoint.Weight
+}
+
+// endpointSections returns the number of sections of the given endpoint in the ring, given its weight.
+func endpointSections(endpoint Endpoint, sectionsPerNode int) int {
+	return max(1, int(math.Round(endpointWeight(endpoint)*float64(sectionsPerNode))))
+}
+
+// boundSectionLoads reassigns the sections of the ring so that no endpoint owns more than loadFactor times its fair
+// share of the hash space, following consistent hashing with bounded loads: walking the ring, a section goes to the
+// endpoint it was created for, unless that endpoint is full already, in which case it goes to the endpoint of the next
+// section which isn't. The loads being bounded in the order of the ring, adding or removing an endpoint mostly moves
+// its own sections and the ones next to them. The sections of the ring must be sorted.
+func boundSectionLoads(ringSections sections, endpoints []Endpoint, loadFactor float64) {
+	if len(ringSections) == 0 {
+		return
+	}
+
+	var totalWeight float64
+	for _, endpoint := range endpoints {
+		totalWeight += endpointWeight(endpoint)
+	}
+	const hashSpace = float64(math.MaxUint64)
+	capacity := make([]float64, len(endpoints))
+	for i, endpoint := range endpoints {
+		capacity[i] = loadFactor * hashSpace * endpointWeight(endpoint) / totalWeight
+	}
+
+	owners := make([]uint64, len(ringSections))
+	load := make([]float64, len(endpoints))
+	for i, s := range ringSections {
+		// The first section owns the hashes after the last section too.
+		size := float64(s.hash) + hashSpace - float64(ringSections[len(ringSections)-1].hash)
+		if i > 0 {
+			size = float64(s.hash - ringSections[i-1].hash)
+		}
+
+		owner := s.endpointIndex
+		for j := 1; j < len(ringSections) && load[owner] >= capacity[owner]; j++ {
+			owner = ringSections[(i+j)%len(ringSections)].endpointIndex
+		}
+		owners[i] = owner
+		load[owner] += size
+	}
+	for i, s := range ringSections {
+		s.endpointIndex = owners[i]
+		s.az = endpoints[owners[i]].AZ
+	}
+}
+
 func (k *ketamaHashring) Nodes() []string {
 	return k.nodes
 }
@@ -248,16 +337,19 @@ func (c ketamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 // Which hashring to use for a tenant is determined
 // by the tenants field of the hashring configuration.
 type multiHashring struct {
-	cache      map[string]Hashring
-	hashrings  []Hashring
-	tenantSets []map[string]tenantMatcher
+	cache              map[string]int
+	hashrings          []Hashring
+	replicationFactors []uint64
+	tenantSets         []map[string]tenantMatcher
 
 	// We need a mutex to guard concurrent access
 	// to the cache map, as this is both written to
 	// and read from.
 	mu sync.RWMutex
 
-	nodes []string
+	nodes   []string
+	configs []HashringConfig
+	cfgHash string
 }
 
 // Get returns a target to handle the given tenant and time series.
@@ -267,11 +359,30 @@ func (m *multiHashring) Get(tenant string, ts *prompb.TimeSeries) (string, error
 
 // GetN returns the nth target to handle the given tenant and time series.
 func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (string, error) {
+	i, err := m.hashringIndex(tenant)
+	if err != nil {
+		return "", err
+	}
+	return m.hashrings[i].GetN(tenant, ts, n)
+}
+
+// ReplicationFactor returns the replication factor of the hashring of the given tenant, or zero if it is not
+// overridden.
+func (m *multiHashring) ReplicationFactor(tenant string) (uint64, error) {
+	i, err := m.hashringIndex(tenant)
+	if err != nil {
+		return 0, err
+	}
+	return m.replicationFactors[i], nil
+}
+
+// hashringIndex returns the index of the hashring handling the given tenant.
+func (m *multiHashring) hashringIndex(tenant string) (int, error) {
 	m.mu.RLock()
-	h, ok := m.cache[tenant]
+	i, ok := m.cache[tenant]
 	m.mu.RUnlock()
 	if ok {
-		return h.GetN(tenant, ts, n)
+		return i, nil
 	}
 	var found bool
 
@@ -292,7 +403,7 @@ func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 					case TenantMatcherGlob:
 						matches, err := filepath.Match(tenantPattern, tenant)
 						if err != nil {
-							return "", fmt.Errorf("error matching tenant pattern %s (tenant %s): %w", tenantPattern, tenant, err)
+							return 0, fmt.Errorf("error matching tenant pattern %s (tenant %s): %w", tenantPattern, tenant, err)
 						}
 						found = matches
 					case TenantMatcherTypeExact:
@@ -308,13 +419,13 @@ func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 		}
 		if found {
 			m.mu.Lock()
-			m.cache[tenant] = m.hashrings[i]
+			m.cache[tenant] = i
 			m.mu.Unlock()
 
-			return m.hashrings[i].GetN(tenant, ts, n)
+			return i, nil
 		}
 	}
-	return "", errors.New("no matching hashring to handle tenant")
+	return 0, errors.New("no matching hashring to handle tenant")
 }
 
 func (m *multiHashring) Nodes() []string {
@@ -327,7 +438,9 @@ func (m *multiHashring) Nodes() []string {
 // by the tenants field of the hashring configuration.
 func NewMultiHashring(algorithm HashringAlgorithm, replicationFactor uint64, cfg []HashringConfig) (Hashring, error) {
 	m := &multiHashring{
-		cache: make(map[string]Hashring),
+		cache:   make(map[string]int),
+		configs: cfg,
+		cfgHash: hashringConfigHash(cfg),
 	}
 
 	for _, h := range cfg {
@@ -337,12 +450,20 @@ func NewMultiHashring(algorithm HashringAlgorithm, replicationFactor uint64, cfg
 		if h.Algorithm != "" {
 			activeAlgorithm = h.Algorithm
 		}
-		hashring, err = newHashring(activeAlgorithm, h.Endpoints, replicationFactor, h.Hashring, h.Tenants)
+		activeReplicationFactor := replicationFactor
+		if h.ReplicationFactor != 0 {
+			if h.ReplicationFactor > uint64(len(h.Endpoints)) {
+				return nil, errors.Errorf("replication factor %d of hashring %q is larger than its number of endpoints %d", h.ReplicationFactor, h.Hashring, len(h.Endpoints))
+			}
+			activeReplicationFactor = h.ReplicationFactor
+		}
+		hashring, err = newHashring(activeAlgorithm, h.Endpoints, activeReplicationFactor, h.LoadFactor, h.Hashring, h.Tenants)
 		if err != nil {
 			return nil, err
 		}
 		m.nodes = append(m.nodes, hashring.Nodes()...)
 		m.hashrings = append(m.hashrings, hashring)
+		m.replicationFactors = append(m.replicationFactors, h.ReplicationFactor)
 		var t map[string]tenantMatcher
 		if len(h.Tenants) != 0 {
 			t = make(map[string]tenantMatcher)
@@ -356,12 +477,17 @@ func NewMultiHashring(algorithm HashringAlgorithm, replicationFactor uint64, cfg
 	return m, nil
 }
 
-func newHashring(algorithm HashringAlgorithm, endpoints []Endpoint, replicationFactor uint64, hashring string, tenants []string) (Hashring, error) {
+func newHashring(algorithm HashringAlgorithm, endpoints []Endpoint, replicationFactor uint64, loadFactor float64, hashring string, tenants []string) (Hashring, error) {
 	switch algorithm {
 	case AlgorithmHashmod:
 		return newSimpleHashring(endpoints)
 	case AlgorithmKetama:
 		return newKetamaHashring(endpoints, SectionsPerNode, replicationFactor)
+	case AlgorithmKetamaBoundedLoads:
+		if loadFactor == 0 {
+			loadFactor = DefaultLoadFactor
+		}
+		return newBoundedLoadsKetamaHashring(endpoints, SectionsPerNode, replicationFactor, loadFactor)
 	default:
 		l := log.NewNopLogger()
 		level.Warn(l).Log("msg", "Unrecognizable hashring algorithm. Fall back to hashmod algorithm.",
@@ -0,0 +1,334 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// HashringsStatus is the state of the hashrings of a receiver, as served by the hashring status API.
+type HashringsStatus struct {
+	// ConfigVersion is incremented each time the hashrings are updated.
+	ConfigVersion uint64 `json:"config_version"`
+	// ConfigHash is the hash of the hashrings configuration, to tell whether receivers run the same one.
+	ConfigHash string    `json:"config_hash"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	Hashrings []HashringStatus `json:"hashrings"`
+	// Peers is the forwarding health of the peers this receiver forwarded requests to.
+	Peers []PeerStatus `json:"peers"`
+	// Tenant is set when the status of a given tenant is requested.
+	Tenant *TenantHashringStatus `json:"tenant,omitempty"`
+}
+
+// HashringStatus is the state of a hashring.
+type HashringStatus struct {
+	Name              string            `json:"name"`
+	Algorithm         HashringAlgorithm `json:"algorithm"`
+	Tenants           []string          `json:"tenants,omitempty"`
+	TenantMatcherType tenantMatcher     `json:"tenant_matcher_type,omitempty"`
+	ReplicationFactor uint64            `json:"replication_factor"`
+	Nodes             []NodeOwnership   `json:"nodes"`
+}
+
+// NodeOwnership is the share of the hash space of a hashring owned by one of its nodes.
+type NodeOwnership struct {
+	Address string `json:"address"`
+	AZ      string `json:"az,omitempty"`
+	// Weight is the weight of the node in Ketama hashrings.
+	Weight float64 `json:"weight,omitempty"`
+	// Ownership is the share of the hash space the node is the first replica of.
+	Ownership float64 `json:"ownership"`
+	// ReplicaOwnership is the share of the hash space the node is any of the replicas of.
+	ReplicaOwnership float64 `json:"replica_ownership"`
+	// Ranges are the ranges of the hash space the node is the first replica of. They are only set for the ketama
+	// algorithm, when requested.
+	Ranges []HashRange `json:"ranges,omitempty"`
+}
+
+// HashRange is a range of the hash space, inclusive of both its start and its end. Hashes are encoded as strings in
+// JSON, as they don't fit in the numbers of most JSON decoders.
+type HashRange struct {
+	Start uint64 `json:"start,string"`
+	End   uint64 `json:"end,string"`
+}
+
+// TenantHashringStatus tells the hashring and the nodes of a tenant, and optionally the nodes of one of its series.
+type TenantHashringStatus struct {
+	Tenant            string   `json:"tenant"`
+	Hashring          string   `json:"hashring"`
+	ReplicationFactor uint64   `json:"replication_factor"`
+	Nodes             []string `json:"nodes"`
+	Series            string   `json:"series,omitempty"`
+	// SeriesHash is the hash of the series of the tenant the hashring is looked up with.
+	SeriesHash uint64 `json:"series_hash,omitempty,string"`
+	// SeriesNodes are the nodes the series is written to, from the first replica to the last one.
+	SeriesNodes []string `json:"series_nodes,omitempty"`
+}
+
+// PeerStatus is the forwarding health of a peer.
+type PeerStatus struct {
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+	// Up is false while requests to the peer are not forwarded, after it failed.
+	Up             bool       `json:"up"`
+	FailedAttempts int        `json:"failed_attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	// CircuitBreaker is the state of the circuit breaker of the peer, if it is not closed.
+	CircuitBreaker circuitState `json:"circuit_breaker,omitempty"`
+}
+
+// hashringDescriber is implemented by hashrings able to describe themselves.
+type hashringDescriber interface {
+	// describe returns the state of the hashrings, defaultReplicationFactor being the one of hashrings which don't
+	// override it.
+	describe(defaultReplicationFactor uint64, withRanges bool) []HashringStatus
+	// hashringName returns the name of the hashring handling the given tenant.
+	hashringName(tenant string) (string, error)
+	// configHash returns the hash of the configuration of the hashrings.
+	configHash() string
+}
+
+func (s SingleNodeHashring) describe(uint64, bool) []HashringStatus {
+	return []HashringStatus{{
+		Algorithm:         AlgorithmHashmod,
+		ReplicationFactor: 1,
+		Nodes:             []NodeOwnership{{Address: string(s), Ownership: 1, ReplicaOwnership: 1}},
+	}}
+}
+
+func (s SingleNodeHashring) hashringName(string) (string, error) { return "", nil }
+
+func (s SingleNodeHashring) configHash() string { return "" }
+
+func (m *multiHashring) describe(defaultReplicationFactor uint64, withRanges bool) []HashringStatus {
+	res := make([]HashringStatus, 0, len(m.hashrings))
+	for i, h := range m.hashrings {
+		cfg := m.configs[i]
+		rf := defaultReplicationFactor
+		if m.replicationFactors[i] != 0 {
+			rf = m.replicationFactors[i]
+		}
+
+		status := HashringStatus{
+			Name:              cfg.Hashring,
+			Algorithm:         AlgorithmHashmod,
+			Tenants:           cfg.Tenants,
+			TenantMatcherType: cfg.TenantMatcherType,
+			ReplicationFactor: rf,
+		}
+		switch h := h.(type) {
+		case *ketamaHashring:
+			status.Algorithm = AlgorithmKetama
+			if h.loadFactor != 0 {
+				status.Algorithm = AlgorithmKetamaBoundedLoads
+			}
+			status.Nodes = h.ownership(withRanges)
+		case simpleHashring:
+			status.Nodes = h.ownership(rf)
+		}
+		res = append(res, status)
+	}
+	return res
+}
+
+func (m *multiHashring) hashringName(tenant string) (string, error) {
+	i, err := m.hashringIndex(tenant)
+	if err != nil {
+		return "", err
+	}
+	return m.configs[i].Hashring, nil
+}
+
+func (m *multiHashring) configHash() string {
+	return m.cfgHash
+}
+
+// hashringConfigHash returns the hash of the given hashrings configuration.
+func hashringConfigHash(cfg []HashringConfig) string {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%016x", xxhash.Sum64(b))
+}
+
+// ownership returns the ownership of the nodes of the hashring, series being spread evenly across them.
+func (s simpleHashring) ownership(replicationFactor uint64) []NodeOwnership {
+	if len(s) == 0 {
+		return nil
+	}
+	share := 1 / float64(len(s))
+	replicaShare := math.Min(1, float64(replicationFactor)*share)
+
+	res := make([]NodeOwnership, 0, len(s))
+	for _, addr := range s {
+		res = append(res, NodeOwnership{Address: addr, Ownership: share, ReplicaOwnership: replicaShare})
+	}
+	return res
+}
+
+// ownership returns the ownership of the nodes of the ring, from the sizes of the sections of the ring. A section
+// owns the hashes from the one of the previous section, excluded, to its own, included. The first section owns the
+// hashes after the one of the last section too.
+func (c *ketamaHashring) ownership(withRanges bool) []NodeOwnership {
+	var (
+		owned        = make([]*big.Int, len(c.endpoints))
+		replicaOwned = make([]*big.Int, len(c.endpoints))
+		ranges       = make([][]HashRange, len(c.endpoints))
+	)
+	for i := range c.endpoints {
+		owned[i], replicaOwned[i] = new(big.Int), new(big.Int)
+	}
+
+	addRange := func(s *section, r HashRange) {
+		size := new(big.Int).SetUint64(r.End - r.Start)
+		size.Add(size, big.NewInt(1))
+		owner := s.endpointIndex
+		owned[owner].Add(owned[owner], size)
+		for _, replica := range s.replicas {
+			replicaOwned[replica].Add(replicaOwned[replica], size)
+		}
+		if !withRanges {
+			return
+		}
+		// Merge the range with the previous one of the node when they are contiguous.
+		if n := len(ranges[owner]); n > 0 && ranges[owner][n-1].End+1 == r.Start {
+			ranges[owner][n-1].End = r.End
+			return
+		}
+		ranges[owner] = append(ranges[owner], r)
+	}
+
+	numSections := len(c.sections)
+	if numSections > 0 {
+		first, last := c.sections[0], c.sections[numSections-1]
+		addRange(first, HashRange{Start: 0, End: first.hash})
+		for i := 1; i < numSections; i++ {
+			if c.sections[i].hash == c.sections[i-1].hash {
+				continue
+			}
+			addRange(c.sections[i], HashRange{Start: c.sections[i-1].hash + 1, End: c.sections[i].hash})
+		}
+		if last.hash != math.MaxUint64 {
+			addRange(first, HashRange{Start: last.hash + 1, End: math.MaxUint64})
+		}
+	}
+
+	hashSpace := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 64))
+	share := func(n *big.Int) float64 {
+		f, _ := new(big.Float).Quo(new(big.Float).SetInt(n), hashSpace).Float64()
+		return f
+	}
+
+	res := make([]NodeOwnership, 0, len(c.endpoints))
+	for i, endpoint := range c.endpoints {
+		res = append(res, NodeOwnership{
+			Address:          endpoint.Address,
+			AZ:               endpoint.AZ,
+			Weight:           endpointWeight(endpoint),
+			Ownership:        share(owned[i]),
+			ReplicaOwnership: share(replicaOwned[i]),
+			Ranges:           ranges[i],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res
+}
+
+func (h *Handler) getHashringStatus(r *http.Request) (interface{}, []error, *api.ApiError, func()) {
+	withRanges := r.FormValue("ranges") == "true"
+	tenant := r.FormValue("tenant")
+	series := r.FormValue("series")
+	if series != "" && tenant == "" {
+		tenant = h.options.DefaultTenantID
+	}
+
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if h.hashring == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errNotReady}, func() {}
+	}
+
+	status := &HashringsStatus{
+		ConfigVersion: h.hashringVersion,
+		UpdatedAt:     h.hashringUpdatedAt,
+		Peers:         h.peers.status(),
+	}
+	if d, ok := h.hashring.(hashringDescriber); ok {
+		status.ConfigHash = d.configHash()
+		status.Hashrings = d.describe(h.options.ReplicationFactor, withRanges)
+	}
+
+	if tenant != "" || series != "" {
+		ts, apiErr := h.tenantHashringStatus(tenant, series)
+		if apiErr != nil {
+			return nil, nil, apiErr, func() {}
+		}
+		status.Tenant = ts
+	}
+	return status, nil, nil, func() {}
+}
+
+// tenantHashringStatus returns the hashring status of the given tenant, and of the given series of the tenant if set.
+// The handler mutex must be held.
+func (h *Handler) tenantHashringStatus(tenant, series string) (*TenantHashringStatus, *api.ApiError) {
+	rf, err := h.tenantReplicationFactor(tenant)
+	if err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	status := &TenantHashringStatus{Tenant: tenant, ReplicationFactor: rf, Nodes: h.hashring.Nodes()}
+
+	if d, ok := h.hashring.(hashringDescriber); ok {
+		name, err := d.hashringName(tenant)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		status.Hashring = name
+		for _, hs := range d.describe(h.options.ReplicationFactor, false) {
+			if hs.Name != name {
+				continue
+			}
+			status.Nodes = make([]string, 0, len(hs.Nodes))
+			for _, n := range hs.Nodes {
+				status.Nodes = append(status.Nodes, n.Address)
+			}
+			break
+		}
+	}
+
+	if series == "" {
+		return status, nil
+	}
+	lset, err := parser.ParseMetric(series)
+	if err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "parse series")}
+	}
+	ts := &prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+	status.Series = lset.String()
+	status.SeriesHash = labelpb.HashWithPrefix(tenant, ts.Labels)
+	for n := uint64(0); n < rf; n++ {
+		node, err := h.hashring.GetN(tenant, ts, n)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		status.SeriesNodes = append(status.SeriesNodes, node)
+	}
+	return status, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestKetamaHashringOwnership(t *testing.T) {
+	endpoints := []Endpoint{{Address: "node-1", AZ: "a"}, {Address: "node-2", AZ: "b"}, {Address: "node-3", AZ: "c"}}
+	hashRing, err := newKetamaHashring(endpoints, SectionsPerNode, 2)
+	testutil.Ok(t, err)
+
+	nodes := hashRing.ownership(true)
+	testutil.Equals(t, 3, len(nodes))
+
+	var ownership, replicaOwnership float64
+	for _, n := range nodes {
+		ownership += n.Ownership
+		replicaOwnership += n.ReplicaOwnership
+		testutil.Assert(t, n.Ownership > 0.2 && n.Ownership < 0.45, "unbalanced ownership %v of %s", n.Ownership, n.Address)
+	}
+	testutil.Assert(t, math.Abs(ownership-1) < 1e-9, "total ownership %v", ownership)
+	testutil.Assert(t, math.Abs(replicaOwnership-2) < 1e-9, "total replica ownership %v", replicaOwnership)
+
+	// The ranges of the nodes tell which node is the first replica of a series.
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b"),
+		labels.FromStrings("__name__", "http_requests_total", "code", "200"),
+	} {
+		ts := &prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+		owner, err := hashRing.Get("tenant", ts)
+		testutil.Ok(t, err)
+
+		hash := labelpb.HashWithPrefix("tenant", ts.Labels)
+		var rangeOwner string
+		for _, n := range nodes {
+			for _, r := range n.Ranges {
+				if hash >= r.Start && hash <= r.End {
+					rangeOwner = n.Address
+				}
+			}
+		}
+		testutil.Equals(t, owner, rangeOwner, lset.String())
+	}
+}
+
+func TestHandler_HashringStatusAPI(t *testing.T) {
+	handlers, _, err := newTestHandlerHashring([]*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}, 1, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	handlers[0].options.Tracer = opentracing.NoopTracer{}
+	handlers[0].options.DefaultTenantID = "default-tenant"
+	h := NewHandler(nil, handlers[0].options)
+
+	do := func(query url.Values) (*httptest.ResponseRecorder, HashringsStatus) {
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/status/hashring?"+query.Encode(), nil)
+		testutil.Ok(t, err)
+		rec := httptest.NewRecorder()
+		h.router.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data HashringsStatus `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec, resp.Data
+	}
+
+	// Not ready before the hashring is set.
+	rec, _ := do(nil)
+	testutil.Equals(t, http.StatusInternalServerError, rec.Code)
+
+	cfg := []HashringConfig{
+		{Hashring: "acme", Tenants: []string{"acme"}, Endpoints: []Endpoint{{Address: "a1"}, {Address: "a2"}, {Address: "a3"}}, Algorithm: AlgorithmKetama, ReplicationFactor: 3},
+		{Hashring: "default", Endpoints: []Endpoint{{Address: "d1"}, {Address: "d2"}}},
+	}
+	hashring, err := NewMultiHashring(AlgorithmHashmod, 1, cfg)
+	testutil.Ok(t, err)
+	h.Hashring(hashring)
+	h.peers.markPeerUnavailable("a2")
+
+	rec, status := do(nil)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, uint64(1), status.ConfigVersion)
+	testutil.Equals(t, hashringConfigHash(cfg), status.ConfigHash)
+	testutil.Assert(t, time.Since(status.UpdatedAt) < time.Minute)
+	testutil.Equals(t, 2, len(status.Hashrings))
+	testutil.Equals(t, AlgorithmKetama, status.Hashrings[0].Algorithm)
+	testutil.Equals(t, uint64(3), status.Hashrings[0].ReplicationFactor)
+	testutil.Equals(t, 3, len(status.Hashrings[0].Nodes))
+	testutil.Equals(t, 0, len(status.Hashrings[0].Nodes[0].Ranges))
+	testutil.Assert(t, math.Abs(status.Hashrings[0].Nodes[0].ReplicaOwnership-1) < 1e-9)
+	testutil.Equals(t, AlgorithmHashmod, status.Hashrings[1].Algorithm)
+	testutil.Equals(t, uint64(1), status.Hashrings[1].ReplicationFactor)
+	testutil.Equals(t, []NodeOwnership{{Address: "d1", Ownership: 0.5, ReplicaOwnership: 0.5}, {Address: "d2", Ownership: 0.5, ReplicaOwnership: 0.5}}, status.Hashrings[1].Nodes)
+
+	testutil.Equals(t, 1, len(status.Peers))
+	testutil.Equals(t, "a2", status.Peers[0].Address)
+	testutil.Equals(t, 1, status.Peers[0].FailedAttempts)
+	testutil.Assert(t, !status.Peers[0].Up)
+	testutil.Assert(t, status.Peers[0].NextAttemptAt != nil)
+
+	_, status = do(url.Values{"ranges": []string{"true"}})
+	testutil.Assert(t, len(status.Hashrings[0].Nodes[0].Ranges) > 0)
+
+	_, status = do(url.Values{"tenant": []string{"acme"}, "series": []string{`up{job="api"}`}})
+	testutil.Equals(t, "acme", status.Tenant.Tenant)
+	testutil.Equals(t, "acme", status.Tenant.Hashring)
+	testutil.Equals(t, uint64(3), status.Tenant.ReplicationFactor)
+	testutil.Equals(t, []string{"a1", "a2", "a3"}, status.Tenant.Nodes)
+	testutil.Equals(t, `{__name__="up", job="api"}`, status.Tenant.Series)
+	testutil.Equals(t, 3, len(status.Tenant.SeriesNodes))
+
+	ts := &prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("__name__", "up", "job", "api"))}
+	owner, err := hashring.Get("acme", ts)
+	testutil.Ok(t, err)
+	testutil.Equals(t, owner, status.Tenant.SeriesNodes[0])
+	testutil.Equals(t, labelpb.HashWithPrefix("acme", ts.Labels), status.Tenant.SeriesHash)
+
+	// The default tenant is used when only a series is given.
+	_, status = do(url.Values{"series": []string{`up`}})
+	testutil.Equals(t, h.options.DefaultTenantID, status.Tenant.Tenant)
+	testutil.Equals(t, "default", status.Tenant.Hashring)
+	testutil.Equals(t, []string{"d1", "d2"}, status.Tenant.Nodes)
+	testutil.Equals(t, 1, len(status.Tenant.SeriesNodes))
+
+	rec, _ = do(url.Values{"series": []string{`up{`}})
+	testutil.Equals(t, http.StatusBadRequest, rec.Code)
+}
@@ -592,6 +592,39 @@ func TestInvalidAZHashringCfg(t *testing.T) {
 	}
 }
 
+func TestMultiHashringReplicationFactor(t *testing.T) {
+	endpoints := []Endpoint{{Address: "a"}, {Address: "b"}, {Address: "c"}}
+	cfg := []HashringConfig{
+		{Hashring: "dev", Tenants: []string{"dev"}, Endpoints: endpoints[:1], ReplicationFactor: 1},
+		{Hashring: "default", Endpoints: endpoints},
+	}
+
+	for _, algorithm := range []HashringAlgorithm{AlgorithmHashmod, AlgorithmKetama} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			h, err := NewMultiHashring(algorithm, 3, cfg)
+			testutil.Ok(t, err)
+
+			rf, err := h.(tenantReplicationFactorer).ReplicationFactor("dev")
+			testutil.Ok(t, err)
+			testutil.Equals(t, uint64(1), rf)
+
+			rf, err = h.(tenantReplicationFactorer).ReplicationFactor("prod")
+			testutil.Ok(t, err)
+			testutil.Equals(t, uint64(0), rf)
+
+			ts := &prompb.TimeSeries{Labels: []labelpb.ZLabel{{Name: "pod", Value: "nginx"}}}
+			e, err := h.GetN("dev", ts, 0)
+			testutil.Ok(t, err)
+			testutil.Equals(t, "a", e)
+		})
+	}
+
+	t.Run("larger than number of endpoints", func(t *testing.T) {
+		_, err := NewMultiHashring(AlgorithmHashmod, 1, []HashringConfig{{Hashring: "dev", Endpoints: endpoints[:2], ReplicationFactor: 3}})
+		require.EqualError(t, err, `replication factor 3 of hashring "dev" is larger than its number of endpoints 2`)
+	})
+}
+
 func makeSeries() []prompb.TimeSeries {
 	numSeries := 10000
 	series := make([]prompb.TimeSeries, numSeries)
@@ -643,3 +676,90 @@ func assignReplicatedSeries(series []prompb.TimeSeries, nodes []Endpoint, replic
 
 	return assignments, nil
 }
+
+func TestKetamaHashringBoundedLoads(t *testing.T) {
+	var endpoints []Endpoint
+	for i := 0; i < 10; i++ {
+		endpoints = append(endpoints, Endpoint{Address: fmt.Sprintf("node-%d", i)})
+	}
+	maxOwnership := func(h *ketamaHashring) float64 {
+		var res float64
+		for _, n := range h.ownership(false) {
+			res = math.Max(res, n.Ownership)
+		}
+		return res
+	}
+
+	// Few sections per node give an uneven distribution.
+	unbounded, err := newKetamaHashring(endpoints, 20, 1)
+	testutil.Ok(t, err)
+	bounded, err := newBoundedLoadsKetamaHashring(endpoints, 20, 1, 1.1)
+	testutil.Ok(t, err)
+
+	// A node can go above its capacity by one section at most.
+	testutil.Assert(t, maxOwnership(bounded) < 0.11+0.02, "max ownership %v above the bound", maxOwnership(bounded))
+	testutil.Assert(t, maxOwnership(unbounded) > maxOwnership(bounded), "max ownership %v of the unbounded ring below the bounded one %v", maxOwnership(unbounded), maxOwnership(bounded))
+
+	// Sections are only moved to other nodes when their node is full: most series keep their node.
+	series := makeSeries()
+	var moved int
+	for _, ts := range series {
+		a, err := unbounded.Get("tenant", &ts)
+		testutil.Ok(t, err)
+		b, err := bounded.Get("tenant", &ts)
+		testutil.Ok(t, err)
+		if a != b {
+			moved++
+		}
+	}
+	testutil.Assert(t, moved < len(series)/4, "%d series out of %d moved", moved, len(series))
+
+	_, err = newBoundedLoadsKetamaHashring(endpoints, 20, 1, 0.5)
+	testutil.NotOk(t, err)
+}
+
+func TestKetamaHashringWeights(t *testing.T) {
+	weight := func(w float64) *float64 { return &w }
+	ring := func(newNodeWeight float64) *ketamaHashring {
+		h, err := newKetamaHashring([]Endpoint{{Address: "node-1"}, {Address: "node-2"}, {Address: "node-3"}, {Address: "node-4", Weight: weight(newNodeWeight)}}, SectionsPerNode, 1)
+		testutil.Ok(t, err)
+		return h
+	}
+
+	series := makeSeries()
+	assign := func(h *ketamaHashring) (map[string]string, map[string]int) {
+		nodes, counts := map[string]string{}, map[string]int{}
+		for _, ts := range series {
+			node, err := h.Get("tenant", &ts)
+			testutil.Ok(t, err)
+			nodes[ts.Labels[0].Value] = node
+			counts[node]++
+		}
+		return nodes, counts
+	}
+
+	// Increasing the weight of a new node step by step only moves series to it.
+	before, _ := assign(ring(0.1))
+	for _, w := range []float64{0.25, 0.5, 1} {
+		after, counts := assign(ring(w))
+		for s, node := range after {
+			if node != before[s] {
+				testutil.Equals(t, "node-4", node, "series %s moved from %s", s, before[s])
+			}
+		}
+		share := float64(counts["node-4"]) / float64(len(series))
+		testutil.Assert(t, math.Abs(share-w/(3+w)) < 0.05, "share %v of node-4 with weight %v", share, w)
+		before = after
+	}
+
+	_, err := newKetamaHashring([]Endpoint{{Address: "node-1", Weight: weight(0)}}, SectionsPerNode, 1)
+	testutil.NotOk(t, err)
+
+	cfg, err := ParseConfig([]byte(`[{"endpoints": ["node-1", {"address": "node-2", "weight": 0.5}], "algorithm": "ketama_bounded_loads", "load_factor": 1.5}]`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, weight(0.5), cfg[0].Endpoints[1].Weight)
+	testutil.Equals(t, 1.5, cfg[0].LoadFactor)
+	h, err := NewMultiHashring(AlgorithmHashmod, 1, cfg)
+	testutil.Ok(t, err)
+	testutil.Equals(t, AlgorithmKetamaBoundedLoads, h.(hashringDescriber).describe(1, false)[0].Algorithm)
+}
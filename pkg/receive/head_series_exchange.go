@@ -0,0 +1,98 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// HeadSeriesLimitsRefreshInterval is the interval the current head series of tenants are refreshed at for head series
+// limiting. It is also the delay after which clients are asked to retry requests rejected by the limits.
+const HeadSeriesLimitsRefreshInterval = 15 * time.Second
+
+// UpdateHeadSeriesLimits gathers the head series of all tenants from the receivers of the hashring, through the
+// TSDB infos served by their Info API, and updates the head series limiter with them. Just like with meta-monitoring,
+// the head series of a tenant are summed across all its replicas.
+// It is best-effort: receivers which can't be reached are skipped, and an error is returned for them once the
+// limiter is updated with the head series of the other ones.
+func (h *Handler) UpdateHeadSeriesLimits(ctx context.Context) error {
+	h.mtx.RLock()
+	if h.hashring == nil {
+		h.mtx.RUnlock()
+		return errors.New("hashring is not ready")
+	}
+	nodes := map[string]struct{}{}
+	for _, n := range h.hashring.Nodes() {
+		nodes[n] = struct{}{}
+	}
+	h.mtx.RUnlock()
+
+	tenantLabelName := h.options.TenantLabelName
+	if tenantLabelName == "" {
+		tenantLabelName = tenancy.DefaultTenantLabel
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HeadSeriesLimitsRefreshInterval)
+	defer cancel()
+
+	var (
+		wg     sync.WaitGroup
+		mtx    sync.Mutex
+		merr   errutil.SyncMultiError
+		series = map[string]float64{}
+	)
+	for node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+
+			infos, err := h.peerTSDBInfos(ctx, node)
+			if err != nil {
+				merr.Add(errors.Wrapf(err, "get TSDB infos of %s", node))
+				return
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			for _, info := range infos {
+				tenant := info.Labels.PromLabels().Get(tenantLabelName)
+				if tenant == "" {
+					continue
+				}
+				series[tenant] += float64(info.HeadSeries)
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	h.Limiter.HeadSeriesLimiter().setTenantHeadSeries(series)
+	return merr.Err()
+}
+
+func (h *Handler) peerTSDBInfos(ctx context.Context, node string) ([]infopb.TSDBInfo, error) {
+	cl, err := h.peers.getConnection(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ic, ok := cl.(infopb.InfoClient)
+	if !ok {
+		return nil, errors.New("peer does not serve the Info API")
+	}
+	resp, err := ic.Info(ctx, &infopb.InfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Store == nil {
+		return nil, nil
+	}
+	return resp.Store.TsdbInfos, nil
+}
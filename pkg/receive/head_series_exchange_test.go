@@ -0,0 +1,81 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+type fakeInfoPeer struct {
+	WriteableStoreAsyncClient
+
+	infos []infopb.TSDBInfo
+}
+
+func (f *fakeInfoPeer) Info(_ context.Context, _ *infopb.InfoRequest, _ ...grpc.CallOption) (*infopb.InfoResponse, error) {
+	return &infopb.InfoResponse{Store: &infopb.StoreInfo{TsdbInfos: f.infos}}, nil
+}
+
+func TestHandler_UpdateHeadSeriesLimits(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, hashring, err := newTestHandlerHashring(appendables, 1, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	handler := handlers[0]
+
+	limitsPath := path.Join(t.TempDir(), "limits.yaml")
+	testutil.Ok(t, os.WriteFile(limitsPath, []byte(`write:
+  global:
+    head_series_source: hashring
+  default:
+    head_series_limit: 5
+`), 0666))
+	limitsConfig, err := extkingpin.NewStaticPathContent(limitsPath)
+	testutil.Ok(t, err)
+	handler.Limiter, err = NewLimiter(limitsConfig, nil, RouterIngestor, log.NewNopLogger(), 1*time.Second)
+	testutil.Ok(t, err)
+
+	// The last receiver does not serve the Info API: it is skipped.
+	peers := handler.peers.(*fakePeersGroup)
+	for _, node := range hashring.Nodes()[:2] {
+		peers.clients[node] = &fakeInfoPeer{
+			WriteableStoreAsyncClient: peers.clients[node],
+			infos: []infopb.TSDBInfo{
+				{Labels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(tenancy.DefaultTenantLabel, "acme"))}, HeadSeries: 4},
+				{Labels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(tenancy.DefaultTenantLabel, "ajax"))}, HeadSeries: 1},
+			},
+		}
+	}
+	testutil.NotOk(t, handler.UpdateHeadSeriesLimits(context.Background()))
+
+	wreq := &prompb.WriteRequest{Timeseries: makeSeriesWithValues(1)}
+
+	rec, err := makeRequest(handler, "acme", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+	testutil.Equals(t, "15", rec.Header().Get("Retry-After"))
+
+	rec, err = makeRequest(handler, "ajax", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+}
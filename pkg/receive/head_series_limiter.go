@@ -130,6 +130,14 @@ func (h *headSeriesLimit) QueryMetaMonitoring(ctx context.Context) error {
 	return nil
 }
 
+// setTenantHeadSeries replaces the current active (head) series of all tenants with the given ones, e.g. gathered
+// from the receivers of the hashring.
+func (h *headSeriesLimit) setTenantHeadSeries(series map[string]float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.tenantCurrentSeriesMap = series
+}
+
 // isUnderLimit ensures that the current number of active series for a tenant does not exceed given limit.
 // It does so in a best-effort way, i.e, in case meta-monitoring is unreachable, it does not impose limits.
 func (h *headSeriesLimit) isUnderLimit(tenant string) (bool, error) {
@@ -181,6 +189,8 @@ func (a *nopSeriesLimit) QueryMetaMonitoring(_ context.Context) error {
 	return nil
 }
 
+func (a *nopSeriesLimit) setTenantHeadSeries(_ map[string]float64) {}
+
 func (a *nopSeriesLimit) isUnderLimit(_ string) (bool, error) {
 	return true, nil
 }
@@ -0,0 +1,412 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// serviceNameLabel is the label of EndpointSlices telling the Service they belong to.
+	serviceNameLabel = "kubernetes.io/service-name"
+
+	// watchTimeout is the duration after which watches of EndpointSlices are closed by the API server, and restarted.
+	watchTimeout = 5 * time.Minute
+)
+
+// KubernetesHashringOptions configure the hashring built from the EndpointSlices of a Kubernetes Service.
+type KubernetesHashringOptions struct {
+	// APIServer is the URL of the Kubernetes API server. If empty, the in-cluster configuration of the pod is used.
+	APIServer string
+	// Namespace is the namespace of the Service. If empty, the namespace of the pod is used.
+	Namespace string
+	// Service is the name of the Service whose ready endpoints are the members of the hashring.
+	Service string
+	// Port is the name or number of the port of the gRPC endpoints of the members.
+	Port string
+	// Debounce is how long changes of the endpoints have to settle before the hashring is updated, so that
+	// rollouts and scale events update it once instead of at every pod.
+	Debounce time.Duration
+	// MinMembers is the minimum number of members of the hashring, at least one. Hashrings with fewer members are
+	// not sent, the previous one being kept, so that a partial view of the endpoints does not reshuffle all the
+	// series.
+	MinMembers int
+	// RetryInterval is the interval between failed lists of the EndpointSlices.
+	RetryInterval time.Duration
+}
+
+// endpointSlice is the subset of a discovery.k8s.io/v1 EndpointSlice used to build hashrings.
+type endpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready       *bool `json:"ready"`
+			Terminating *bool `json:"terminating"`
+		} `json:"conditions"`
+		Hostname string `json:"hostname"`
+		Zone     string `json:"zone"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"ports"`
+}
+
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []endpointSlice `json:"items"`
+}
+
+type endpointSliceEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// KubernetesHashringWatcher watches the EndpointSlices of a Kubernetes Service, and builds a hashring of its ready
+// endpoints, so that receivers track scale events without a hashring configuration file generated by a controller.
+type KubernetesHashringWatcher struct {
+	logger log.Logger
+	opts   KubernetesHashringOptions
+	client *http.Client
+	token  func() (string, error)
+
+	mtx    sync.Mutex
+	slices map[string]endpointSlice
+
+	members     prometheus.Gauge
+	updates     prometheus.Counter
+	gated       prometheus.Counter
+	watchErrors prometheus.Counter
+}
+
+// NewKubernetesHashringWatcher returns a watcher of the EndpointSlices of the Service configured by the given options.
+func NewKubernetesHashringWatcher(logger log.Logger, reg prometheus.Registerer, opts KubernetesHashringOptions) (*KubernetesHashringWatcher, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if opts.Service == "" {
+		return nil, errors.New("no service given")
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 5 * time.Second
+	}
+	// Hashrings need at least one member.
+	opts.MinMembers = max(opts.MinMembers, 1)
+
+	w := &KubernetesHashringWatcher{
+		logger: logger,
+		opts:   opts,
+		client: &http.Client{},
+		token:  func() (string, error) { return "", nil },
+		slices: map[string]endpointSlice{},
+		members: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_kubernetes_hashring_members",
+			Help: "The number of ready endpoints of the Kubernetes Service the hashring is built from.",
+		}),
+		updates: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_kubernetes_hashring_updates_total",
+			Help: "The number of updates of the hashring built from the endpoints of the Kubernetes Service.",
+		}),
+		gated: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_kubernetes_hashring_gated_updates_total",
+			Help: "The number of updates of the hashring built from the endpoints of the Kubernetes Service which were not sent, as it had fewer members than the minimum.",
+		}),
+		watchErrors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_kubernetes_hashring_watch_errors_total",
+			Help: "The number of errors listing or watching the EndpointSlices of the Kubernetes Service.",
+		}),
+	}
+	if opts.APIServer != "" && opts.Namespace != "" {
+		return w, nil
+	}
+
+	// Use the in-cluster configuration of the pod.
+	if w.opts.Namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, errors.Wrap(err, "read namespace of the pod")
+		}
+		w.opts.Namespace = strings.TrimSpace(string(ns))
+	}
+	if w.opts.APIServer != "" {
+		return w, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, errors.Wrap(err, "read CA certificate of the API server")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid CA certificate of the API server")
+	}
+	w.opts.APIServer = "https://" + net.JoinHostPort(host, port)
+	w.client = &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}
+	// Service account tokens are rotated, read them at every request.
+	w.token = func() (string, error) {
+		b, err := os.ReadFile(serviceAccountDir + "/token")
+		return strings.TrimSpace(string(b)), err
+	}
+	return w, nil
+}
+
+// Run sends the hashring configurations built from the endpoints of the Service on updates, until the given context
+// is canceled. It closes updates once done.
+func (w *KubernetesHashringWatcher) Run(ctx context.Context, updates chan<- []HashringConfig) error {
+	defer close(updates)
+
+	changes := make(chan struct{}, 1)
+	go w.watch(ctx, changes)
+
+	var (
+		last     []Endpoint
+		sent     bool
+		debounce <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			// Wait for the changes to settle.
+			debounce = time.After(w.opts.Debounce)
+		case <-debounce:
+			debounce = nil
+
+			endpoints := w.endpoints()
+			w.members.Set(float64(len(endpoints)))
+			if len(endpoints) < w.opts.MinMembers {
+				w.gated.Inc()
+				level.Warn(w.logger).Log("msg", "fewer ready endpoints than the minimum members of the hashring, keeping the previous hashring", "service", w.opts.Service, "endpoints", len(endpoints), "min_members", w.opts.MinMembers)
+				continue
+			}
+			if sent && reflect.DeepEqual(endpoints, last) {
+				continue
+			}
+			last, sent = endpoints, true
+			w.updates.Inc()
+			level.Info(w.logger).Log("msg", "endpoints of service changed, updating hashring", "service", w.opts.Service, "endpoints", len(endpoints))
+			select {
+			case updates <- []HashringConfig{{Endpoints: endpoints}}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// watch lists and watches the EndpointSlices of the Service until the given context is canceled, notifying their
+// changes on the given channel.
+func (w *KubernetesHashringWatcher) watch(ctx context.Context, changes chan<- struct{}) {
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+	for ctx.Err() == nil {
+		rv, err := w.list(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.watchErrors.Inc()
+			level.Error(w.logger).Log("msg", "failed to list endpoint slices", "service", w.opts.Service, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.opts.RetryInterval):
+			}
+			continue
+		}
+		notify()
+
+		// Watch the changes since the list until the watch is closed, then list again.
+		if err := w.watchSince(ctx, rv, notify); err != nil && ctx.Err() == nil {
+			w.watchErrors.Inc()
+			level.Warn(w.logger).Log("msg", "watch of endpoint slices failed, listing them again", "service", w.opts.Service, "err", err)
+		}
+	}
+}
+
+// list replaces the known EndpointSlices of the Service by the current ones, and returns their resource version.
+func (w *KubernetesHashringWatcher) list(ctx context.Context) (string, error) {
+	resp, err := w.get(ctx, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list endpointSliceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", errors.Wrap(err, "decode endpoint slices")
+	}
+	slices := make(map[string]endpointSlice, len(list.Items))
+	for _, s := range list.Items {
+		slices[s.Metadata.Name] = s
+	}
+	w.mtx.Lock()
+	w.slices = slices
+	w.mtx.Unlock()
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watchSince applies the changes of the EndpointSlices of the Service since the given resource version, until the
+// watch is closed.
+func (w *KubernetesHashringWatcher) watchSince(ctx context.Context, rv string, notify func()) error {
+	resp, err := w.get(ctx, url.Values{
+		"watch":           {"true"},
+		"resourceVersion": {rv},
+		"timeoutSeconds":  {strconv.Itoa(int(watchTimeout.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev endpointSliceEvent
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "decode watch event")
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+		case "ERROR":
+			// Typically the resource version being too old, the slices have to be listed again.
+			return errors.Errorf("watch error: %s", ev.Object)
+		default:
+			continue
+		}
+		var s endpointSlice
+		if err := json.Unmarshal(ev.Object, &s); err != nil {
+			return errors.Wrap(err, "decode endpoint slice")
+		}
+		w.mtx.Lock()
+		if ev.Type == "DELETED" {
+			delete(w.slices, s.Metadata.Name)
+		} else {
+			w.slices[s.Metadata.Name] = s
+		}
+		w.mtx.Unlock()
+		notify()
+	}
+}
+
+func (w *KubernetesHashringWatcher) get(ctx context.Context, params url.Values) (*http.Response, error) {
+	params.Set("labelSelector", serviceNameLabel+"="+w.opts.Service)
+	u := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s", strings.TrimSuffix(w.opts.APIServer, "/"), url.PathEscape(w.opts.Namespace), params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := w.token()
+	if err != nil {
+		return nil, errors.Wrap(err, "read service account token")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "get endpoint slices")
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("get endpoint slices: unexpected status %s: %s", resp.Status, b)
+	}
+	return resp, nil
+}
+
+// endpoints returns the ready endpoints of the known EndpointSlices, sorted by address. Endpoints with a hostname,
+// e.g. the pods of a StatefulSet behind a headless Service, are addressed by their stable DNS name instead of their
+// IP address, so that restarted pods keep their place in the hashring.
+func (w *KubernetesHashringWatcher) endpoints() []Endpoint {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	seen := map[string]struct{}{}
+	endpoints := []Endpoint{}
+	for _, s := range w.slices {
+		port, ok := w.port(s)
+		if !ok {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if (e.Conditions.Ready != nil && !*e.Conditions.Ready) || (e.Conditions.Terminating != nil && *e.Conditions.Terminating) {
+				continue
+			}
+			host := e.Hostname
+			if host != "" {
+				host = fmt.Sprintf("%s.%s.%s.svc", host, w.opts.Service, w.opts.Namespace)
+			} else if len(e.Addresses) > 0 {
+				host = e.Addresses[0]
+			} else {
+				continue
+			}
+			addr := net.JoinHostPort(host, strconv.Itoa(port))
+			if _, ok := seen[addr]; ok {
+				continue
+			}
+			seen[addr] = struct{}{}
+			endpoints = append(endpoints, Endpoint{Address: addr, AZ: e.Zone})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Address < endpoints[j].Address })
+	return endpoints
+}
+
+// port returns the number of the configured port of the endpoints of the given slice.
+func (w *KubernetesHashringWatcher) port(s endpointSlice) (int, bool) {
+	if n, err := strconv.Atoi(w.opts.Port); err == nil {
+		return n, true
+	}
+	for _, p := range s.Ports {
+		if p.Name == w.opts.Port {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// fakeEndpointSlicesAPI serves the EndpointSlices of a Service like the Kubernetes API server, streaming the events
+// written to its channel to watches.
+type fakeEndpointSlicesAPI struct {
+	list   string
+	events chan string
+}
+
+func (f *fakeEndpointSlicesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/monitoring/endpointslices" || r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=receive" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("watch") != "true" {
+		fmt.Fprint(w, f.list)
+		return
+	}
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-f.events:
+			fmt.Fprintln(w, ev)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestKubernetesHashringWatcher(t *testing.T) {
+	api := &fakeEndpointSlicesAPI{
+		list: `{"metadata": {"resourceVersion": "1"}, "items": [{
+			"metadata": {"name": "receive-a"},
+			"endpoints": [
+				{"addresses": ["10.0.0.1"], "hostname": "receive-0", "zone": "a", "conditions": {"ready": true}},
+				{"addresses": ["10.0.0.2"], "hostname": "receive-1", "zone": "b", "conditions": {"ready": false}}
+			],
+			"ports": [{"name": "grpc", "port": 10901}, {"name": "http", "port": 10902}]
+		}]}`,
+		events: make(chan string),
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	reg := prometheus.NewRegistry()
+	w, err := NewKubernetesHashringWatcher(log.NewNopLogger(), reg, KubernetesHashringOptions{
+		APIServer:  srv.URL,
+		Namespace:  "monitoring",
+		Service:    "receive",
+		Port:       "grpc",
+		Debounce:   100 * time.Millisecond,
+		MinMembers: 2,
+	})
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []HashringConfig)
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, updates) }()
+
+	// The hashring is not sent until it has the minimum number of members.
+	retryCtx, retryCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer retryCancel()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, retryCtx.Done(), func() error {
+		if promtestutil.ToFloat64(w.gated) != 1 {
+			return errors.New("hashring not gated yet")
+		}
+		return nil
+	}))
+
+	api.events <- `{"type": "MODIFIED", "object": {
+		"metadata": {"name": "receive-a"},
+		"endpoints": [
+			{"addresses": ["10.0.0.1"], "hostname": "receive-0", "zone": "a", "conditions": {"ready": true}},
+			{"addresses": ["10.0.0.2"], "hostname": "receive-1", "zone": "b", "conditions": {"ready": true}}
+		],
+		"ports": [{"name": "grpc", "port": 10901}]
+	}}`
+	api.events <- `{"type": "ADDED", "object": {
+		"metadata": {"name": "receive-b"},
+		"endpoints": [
+			{"addresses": ["10.0.0.3"], "conditions": {"ready": true}},
+			{"addresses": ["10.0.0.4"], "conditions": {"ready": true, "terminating": true}}
+		],
+		"ports": [{"name": "grpc", "port": 10901}]
+	}}`
+	// Both changes are sent at once.
+	testutil.Equals(t, []HashringConfig{{Endpoints: []Endpoint{
+		{Address: "10.0.0.3:10901"},
+		{Address: "receive-0.receive.monitoring.svc:10901", AZ: "a"},
+		{Address: "receive-1.receive.monitoring.svc:10901", AZ: "b"},
+	}}}, <-updates)
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(w.members))
+
+	api.events <- `{"type": "DELETED", "object": {"metadata": {"name": "receive-b"}}}`
+	testutil.Equals(t, []HashringConfig{{Endpoints: []Endpoint{
+		{Address: "receive-0.receive.monitoring.svc:10901", AZ: "a"},
+		{Address: "receive-1.receive.monitoring.svc:10901", AZ: "b"},
+	}}}, <-updates)
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(w.updates))
+
+	cancel()
+	testutil.Ok(t, <-done)
+	_, ok := <-updates
+	testutil.Assert(t, !ok, "updates not closed")
+}
@@ -25,6 +25,8 @@ import (
 type Limiter struct {
 	sync.RWMutex
 	requestLimiter            requestLimiter
+	rateLimiter               rateLimiter
+	seriesChurnLimiter        seriesChurnLimiter
 	headSeriesLimiterMtx      sync.Mutex
 	headSeriesLimiter         headSeriesLimiter
 	writeGate                 gate.Gate
@@ -40,6 +42,7 @@ type Limiter struct {
 // headSeriesLimiter encompasses active/head series limiting logic.
 type headSeriesLimiter interface {
 	QueryMetaMonitoring(context.Context) error
+	setTenantHeadSeries(map[string]float64)
 	isUnderLimit(tenant string) (bool, error)
 }
 
@@ -66,12 +69,14 @@ func (l *Limiter) HeadSeriesLimiter() headSeriesLimiter {
 // registerer.
 func NewLimiter(configFile fileContent, reg prometheus.Registerer, r ReceiverMode, logger log.Logger, configReloadTimer time.Duration) (*Limiter, error) {
 	limiter := &Limiter{
-		writeGate:         gate.NewNoop(),
-		requestLimiter:    &noopRequestLimiter{},
-		headSeriesLimiter: NewNopSeriesLimit(),
-		logger:            logger,
-		receiverMode:      r,
-		configReloadTimer: configReloadTimer,
+		writeGate:          gate.NewNoop(),
+		requestLimiter:     &noopRequestLimiter{},
+		rateLimiter:        &noopRateLimiter{},
+		seriesChurnLimiter: &noopSeriesChurnLimiter{},
+		headSeriesLimiter:  NewNopSeriesLimit(),
+		logger:             logger,
+		receiverMode:       r,
+		configReloadTimer:  configReloadTimer,
 	}
 
 	if reg != nil {
@@ -161,6 +166,14 @@ func (l *Limiter) loadConfig() error {
 		l.registerer,
 		&config.WriteLimits,
 	)
+	l.rateLimiter = newConfigRateLimiter(
+		l.registerer,
+		&config.WriteLimits,
+	)
+	l.seriesChurnLimiter = newConfigSeriesChurnLimiter(
+		l.registerer,
+		&config.WriteLimits,
+	)
 	seriesLimitIsActivated := func() bool {
 		if config.WriteLimits.DefaultLimits.HeadSeriesLimit != 0 {
 			return true
@@ -187,6 +200,23 @@ func (l *Limiter) RequestLimiter() requestLimiter {
 	return l.requestLimiter
 }
 
+// RateLimiter is a safe getter for the rate limiter.
+func (l *Limiter) RateLimiter() rateLimiter {
+	l.RLock()
+	defer l.RUnlock()
+	return l.rateLimiter
+}
+
+// SeriesChurnLimiter is a safe getter for the series churn limiter. A nil Limiter does not limit series churn.
+func (l *Limiter) SeriesChurnLimiter() seriesChurnLimiter {
+	if l == nil {
+		return &noopSeriesChurnLimiter{}
+	}
+	l.RLock()
+	defer l.RUnlock()
+	return l.seriesChurnLimiter
+}
+
 // WriteGate is a safe getter for the write gate.
 func (l *Limiter) WriteGate() gate.Gate {
 	l.RLock()
@@ -12,6 +12,14 @@ import (
 	"github.com/thanos-io/thanos/pkg/errors"
 )
 
+const (
+	// HeadSeriesSourceMetaMonitoring gathers the head series of tenants by querying meta-monitoring.
+	HeadSeriesSourceMetaMonitoring = "meta_monitoring"
+	// HeadSeriesSourceHashring gathers the head series of tenants by exchanging the head stats of the receivers of
+	// the hashring through their Info API.
+	HeadSeriesSourceHashring = "hashring"
+)
+
 // RootLimitsConfig is the root configuration for limits.
 type RootLimitsConfig struct {
 	// WriteLimits hold the limits for writing data.
@@ -40,6 +48,24 @@ func ParseRootLimitConfig(content []byte) (*RootLimitsConfig, error) {
 		root.WriteLimits.GlobalLimits.metaMonitoringURL = u
 	}
 
+	switch root.WriteLimits.GlobalLimits.HeadSeriesSource {
+	case "", HeadSeriesSourceMetaMonitoring, HeadSeriesSourceHashring:
+	default:
+		return nil, errors.Newf("unsupported head series source %q", root.WriteLimits.GlobalLimits.HeadSeriesSource)
+	}
+
+	if err := root.WriteLimits.DefaultLimits.RateLimits.validate(); err != nil {
+		return nil, errors.Wrapf(err, "default rate limits")
+	}
+	for tenant, limits := range root.WriteLimits.TenantsLimits {
+		if limits == nil || limits.RateLimits == nil {
+			continue
+		}
+		if err := limits.RateLimits.validate(); err != nil {
+			return nil, errors.Wrapf(err, "rate limits of tenant %s", tenant)
+		}
+	}
+
 	// Set default query if none specified.
 	if root.WriteLimits.GlobalLimits.MetaMonitoringLimitQuery == "" {
 		root.WriteLimits.GlobalLimits.MetaMonitoringLimitQuery = "sum(prometheus_tsdb_head_series) by (tenant)"
@@ -49,7 +75,13 @@ func ParseRootLimitConfig(content []byte) (*RootLimitsConfig, error) {
 }
 
 func (r RootLimitsConfig) AreHeadSeriesLimitsConfigured() bool {
-	return r.WriteLimits.GlobalLimits.MetaMonitoringURL != "" && (len(r.WriteLimits.TenantsLimits) != 0 || r.WriteLimits.DefaultLimits.HeadSeriesLimit != 0)
+	return (r.WriteLimits.GlobalLimits.MetaMonitoringURL != "" || r.IsHeadSeriesSourceHashring()) && (len(r.WriteLimits.TenantsLimits) != 0 || r.WriteLimits.DefaultLimits.HeadSeriesLimit != 0)
+}
+
+// IsHeadSeriesSourceHashring returns true if the head series of tenants are gathered from the receivers of the
+// hashring, instead of meta-monitoring.
+func (r RootLimitsConfig) IsHeadSeriesSourceHashring() bool {
+	return r.WriteLimits.GlobalLimits.HeadSeriesSource == HeadSeriesSourceHashring
 }
 
 type WriteLimitsConfig struct {
@@ -68,6 +100,9 @@ type GlobalLimitsConfig struct {
 	MetaMonitoringURL        string                         `yaml:"meta_monitoring_url"`
 	MetaMonitoringHTTPClient *clientconfig.HTTPClientConfig `yaml:"meta_monitoring_http_client"`
 	MetaMonitoringLimitQuery string                         `yaml:"meta_monitoring_limit_query"`
+	// HeadSeriesSource is where the current head series of tenants are gathered from for head series limiting, either
+	// meta-monitoring (default) or the receivers of the hashring.
+	HeadSeriesSource string `yaml:"head_series_source"`
 
 	metaMonitoringURL *url.URL
 }
@@ -75,6 +110,8 @@ type GlobalLimitsConfig struct {
 type DefaultLimitsConfig struct {
 	// RequestLimits holds the difficult per-request limits.
 	RequestLimits requestLimitsConfig `yaml:"request"`
+	// RateLimits holds the ingestion rate limits of each tenant.
+	RateLimits rateLimitsConfig `yaml:"rate"`
 	// HeadSeriesLimit specifies the maximum number of head series allowed for any tenant.
 	HeadSeriesLimit uint64 `yaml:"head_series_limit"`
 }
@@ -87,6 +124,8 @@ type TenantsWriteLimitsConfig map[string]*WriteLimitConfig
 type WriteLimitConfig struct {
 	// RequestLimits holds the difficult per-request limits.
 	RequestLimits *requestLimitsConfig `yaml:"request"`
+	// RateLimits holds the ingestion rate limits of the tenant.
+	RateLimits *rateLimitsConfig `yaml:"rate"`
 	// HeadSeriesLimit specifies the maximum number of head series allowed for a tenant.
 	HeadSeriesLimit *uint64 `yaml:"head_series_limit"`
 }
@@ -101,6 +140,11 @@ func (w *WriteLimitConfig) SetRequestLimits(rl *requestLimitsConfig) *WriteLimit
 	return w
 }
 
+func (w *WriteLimitConfig) SetRateLimits(rl *rateLimitsConfig) *WriteLimitConfig {
+	w.RateLimits = rl
+	return w
+}
+
 func (w *WriteLimitConfig) SetHeadSeriesLimit(val uint64) *WriteLimitConfig {
 	w.HeadSeriesLimit = &val
 	return w
@@ -146,3 +190,76 @@ func (rl *requestLimitsConfig) OverlayWith(other *requestLimitsConfig) *requestL
 	}
 	return rl
 }
+
+type rateLimitsConfig struct {
+	// SamplesPerSecond is the rate at which a tenant can send samples, native histograms included.
+	SamplesPerSecond *float64 `yaml:"samples_per_second"`
+	// SamplesBurst is the maximum amount of samples a tenant can send at once, above the rate. Defaults to the
+	// amount of samples of one second.
+	SamplesBurst *int64 `yaml:"samples_burst"`
+	// NewSeriesPerSecond is the rate at which a tenant can create new series in the heads of the receivers, i.e. its
+	// series churn, regardless of its active series.
+	NewSeriesPerSecond *float64 `yaml:"new_series_per_second"`
+	// NewSeriesBurst is the maximum amount of series a tenant can create at once, above the rate. Defaults to the
+	// amount of series of one second.
+	NewSeriesBurst *int64 `yaml:"new_series_burst"`
+}
+
+func (rl *rateLimitsConfig) validate() error {
+	if rl.SamplesPerSecond != nil && *rl.SamplesPerSecond < 0 {
+		return errors.Newf("samples_per_second must not be negative, got %v", *rl.SamplesPerSecond)
+	}
+	if rl.SamplesBurst != nil && *rl.SamplesBurst < 0 {
+		return errors.Newf("samples_burst must not be negative, got %d", *rl.SamplesBurst)
+	}
+	if rl.NewSeriesPerSecond != nil && *rl.NewSeriesPerSecond < 0 {
+		return errors.Newf("new_series_per_second must not be negative, got %v", *rl.NewSeriesPerSecond)
+	}
+	if rl.NewSeriesBurst != nil && *rl.NewSeriesBurst < 0 {
+		return errors.Newf("new_series_burst must not be negative, got %d", *rl.NewSeriesBurst)
+	}
+	return nil
+}
+
+func NewEmptyRateLimitsConfig() *rateLimitsConfig {
+	return &rateLimitsConfig{}
+}
+
+func (rl *rateLimitsConfig) SetSamplesPerSecond(value float64) *rateLimitsConfig {
+	rl.SamplesPerSecond = &value
+	return rl
+}
+
+func (rl *rateLimitsConfig) SetSamplesBurst(value int64) *rateLimitsConfig {
+	rl.SamplesBurst = &value
+	return rl
+}
+
+func (rl *rateLimitsConfig) SetNewSeriesPerSecond(value float64) *rateLimitsConfig {
+	rl.NewSeriesPerSecond = &value
+	return rl
+}
+
+func (rl *rateLimitsConfig) SetNewSeriesBurst(value int64) *rateLimitsConfig {
+	rl.NewSeriesBurst = &value
+	return rl
+}
+
+// OverlayWith overlays the current configuration with another one. This means
+// that limit values that are not set (have a nil value) will be overwritten in
+// the caller.
+func (rl *rateLimitsConfig) OverlayWith(other *rateLimitsConfig) *rateLimitsConfig {
+	if rl.SamplesPerSecond == nil {
+		rl.SamplesPerSecond = other.SamplesPerSecond
+	}
+	if rl.SamplesBurst == nil {
+		rl.SamplesBurst = other.SamplesBurst
+	}
+	if rl.NewSeriesPerSecond == nil {
+		rl.NewSeriesPerSecond = other.NewSeriesPerSecond
+	}
+	if rl.NewSeriesBurst == nil {
+		rl.NewSeriesBurst = other.NewSeriesBurst
+	}
+	return rl
+}
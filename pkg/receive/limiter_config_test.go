@@ -75,3 +75,21 @@ func TestParseLimiterConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLimiterConfig_HeadSeriesSource(t *testing.T) {
+	root, err := ParseRootLimitConfig([]byte(`write:
+  global:
+    head_series_source: hashring
+  default:
+    head_series_limit: 1000
+`))
+	testutil.Ok(t, err)
+	testutil.Assert(t, root.IsHeadSeriesSourceHashring())
+	testutil.Assert(t, root.AreHeadSeriesLimitsConfigured())
+
+	_, err = ParseRootLimitConfig([]byte(`write:
+  global:
+    head_series_source: gossip
+`))
+	testutil.NotOk(t, err)
+}
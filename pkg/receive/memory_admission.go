@@ -0,0 +1,141 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+)
+
+const liveHeapMetric = "/gc/heap/live:bytes"
+
+// MemoryAdmission rejects remote write requests while the live heap is close to the Go memory limit (GOMEMLIMIT).
+// Close to the limit, the Go runtime garbage collects more and more often, which slows down writes, which in turn
+// keeps even more requests in memory. Rejecting writes instead lets clients back off and retry until the live heap
+// is back below the resume ratio of the limit.
+type MemoryAdmission struct {
+	logger      log.Logger
+	rejectRatio float64
+	resumeRatio float64
+
+	memoryLimit func() int64
+	liveHeap    func() uint64
+
+	rejecting atomic.Bool
+
+	limitBytes       prometheus.Gauge
+	liveHeapBytes    prometheus.Gauge
+	state            prometheus.Gauge
+	transitions      *prometheus.CounterVec
+	rejectedRequests prometheus.Counter
+}
+
+// NewMemoryAdmission returns a memory admission control rejecting writes once the live heap reaches the reject ratio
+// of the Go memory limit, until it goes back below the resume ratio.
+func NewMemoryAdmission(logger log.Logger, reg prometheus.Registerer, rejectRatio, resumeRatio float64) (*MemoryAdmission, error) {
+	if rejectRatio <= 0 || rejectRatio > 1 {
+		return nil, errors.Errorf("memory admission reject ratio must be greater than 0 and less than or equal to 1, got %v", rejectRatio)
+	}
+	if resumeRatio <= 0 || resumeRatio > rejectRatio {
+		return nil, errors.Errorf("memory admission resume ratio must be greater than 0 and less than or equal to the reject ratio %v, got %v", rejectRatio, resumeRatio)
+	}
+
+	m := &MemoryAdmission{
+		logger:      logger,
+		rejectRatio: rejectRatio,
+		resumeRatio: resumeRatio,
+		memoryLimit: func() int64 { return debug.SetMemoryLimit(-1) },
+		liveHeap:    readLiveHeap,
+		limitBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_memory_admission_limit_bytes",
+			Help: "The Go memory limit memory admission is based on, 0 if no limit is set.",
+		}),
+		liveHeapBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_memory_admission_live_heap_bytes",
+			Help: "The live heap at the end of the last garbage collection, as last checked by memory admission.",
+		}),
+		state: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_memory_admission_rejecting",
+			Help: "Whether memory admission rejects write requests (1) or not (0).",
+		}),
+		transitions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_memory_admission_transitions_total",
+			Help: "The total number of transitions of memory admission to the given state.",
+		}, []string{"state"}),
+		rejectedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_memory_admission_rejected_requests_total",
+			Help: "The total number of remote write requests rejected by memory admission.",
+		}),
+	}
+	m.transitions.WithLabelValues("rejecting")
+	m.transitions.WithLabelValues("admitting")
+
+	if limit := m.memoryLimit(); limit <= 0 || limit == math.MaxInt64 {
+		level.Warn(logger).Log("msg", "memory admission is enabled but no Go memory limit is set, all write requests will be admitted", "hint", "set GOMEMLIMIT or --enable-auto-gomemlimit")
+	}
+	return m, nil
+}
+
+func readLiveHeap() uint64 {
+	sample := []metrics.Sample{{Name: liveHeapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// Check compares the live heap with the Go memory limit, and updates the admission state. It is meant to be called
+// periodically. Writes are always admitted if no memory limit is set.
+func (m *MemoryAdmission) Check() {
+	limit := m.memoryLimit()
+	if limit <= 0 || limit == math.MaxInt64 {
+		m.limitBytes.Set(0)
+		m.setRejecting(false, 0, 0)
+		return
+	}
+	live := m.liveHeap()
+	m.limitBytes.Set(float64(limit))
+	m.liveHeapBytes.Set(float64(live))
+
+	ratio := float64(live) / float64(limit)
+	switch {
+	case !m.rejecting.Load() && ratio >= m.rejectRatio:
+		m.setRejecting(true, live, limit)
+	case m.rejecting.Load() && ratio < m.resumeRatio:
+		m.setRejecting(false, live, limit)
+	}
+}
+
+func (m *MemoryAdmission) setRejecting(rejecting bool, live uint64, limit int64) {
+	if m.rejecting.Swap(rejecting) == rejecting {
+		return
+	}
+	if rejecting {
+		level.Warn(m.logger).Log("msg", "live heap is close to the memory limit, rejecting write requests", "live_heap_bytes", live, "limit_bytes", limit)
+		m.state.Set(1)
+		m.transitions.WithLabelValues("rejecting").Inc()
+		return
+	}
+	level.Info(m.logger).Log("msg", "live heap is back below the resume ratio of the memory limit, admitting write requests", "live_heap_bytes", live, "limit_bytes", limit)
+	m.state.Set(0)
+	m.transitions.WithLabelValues("admitting").Inc()
+}
+
+// Admit returns false if write requests must be rejected. A nil MemoryAdmission admits all requests.
+func (m *MemoryAdmission) Admit() bool {
+	if m == nil || !m.rejecting.Load() {
+		return true
+	}
+	m.rejectedRequests.Inc()
+	return false
+}
@@ -0,0 +1,60 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"math"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemoryAdmission(t *testing.T) {
+	_, err := NewMemoryAdmission(log.NewNopLogger(), nil, 0, 0)
+	testutil.NotOk(t, err)
+	_, err = NewMemoryAdmission(log.NewNopLogger(), nil, 0.8, 0.9)
+	testutil.NotOk(t, err)
+
+	m, err := NewMemoryAdmission(log.NewNopLogger(), prometheus.NewRegistry(), 0.9, 0.8)
+	testutil.Ok(t, err)
+
+	var (
+		limit int64 = 1000
+		live  uint64
+	)
+	m.memoryLimit = func() int64 { return limit }
+	m.liveHeap = func() uint64 { return live }
+
+	for _, tcase := range []struct {
+		live  uint64
+		admit bool
+	}{
+		{live: 500, admit: true},
+		{live: 899, admit: true},
+		{live: 900, admit: false},
+		// Writes are admitted again below the resume ratio only.
+		{live: 850, admit: false},
+		{live: 799, admit: true},
+		{live: 850, admit: true},
+		{live: 1200, admit: false},
+	} {
+		live = tcase.live
+		m.Check()
+		testutil.Equals(t, tcase.admit, m.Admit(), "live heap %d", tcase.live)
+	}
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(m.transitions.WithLabelValues("rejecting")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(m.transitions.WithLabelValues("admitting")))
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(m.rejectedRequests))
+
+	// Without memory limit, all writes are admitted.
+	limit = math.MaxInt64
+	m.Check()
+	testutil.Assert(t, m.Admit())
+
+	var nilAdmission *MemoryAdmission
+	testutil.Assert(t, nilAdmission.Admit())
+}
@@ -26,9 +26,11 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
 
 	"github.com/thanos-io/objstore"
 
@@ -38,6 +40,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/exemplars"
 	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
@@ -48,6 +51,9 @@ type TSDBStats interface {
 	// TenantStats returns TSDB head stats for the given tenants.
 	// If no tenantIDs are provided, stats for all tenants are returned.
 	TenantStats(limit int, statsByLabelName string, tenantIDs ...string) []status.TenantStats
+	// TenantCardinality returns the cardinality of the TSDB head of the given tenant, with the given number of top
+	// stats, or nil if the tenant has no head.
+	TenantCardinality(ctx context.Context, limit int, tenantID string) (*TenantCardinality, error)
 }
 
 type MultiTSDB struct {
@@ -64,6 +70,32 @@ type MultiTSDB struct {
 	allowOutOfOrderUpload bool
 	hashFunc              metadata.HashFunc
 	hashringConfigs       []HashringConfig
+	tenantRetention       TenantRetentionConfig
+
+	tenantDeletionDelay           time.Duration
+	deletionsMtx                  sync.Mutex
+	deletions                     map[string]*TenantDeletion
+	tenantBlocksMarkedForDeletion prometheus.Counter
+
+	storageHealth *StorageHealth
+}
+
+// MultiTSDBOption is a functional option for MultiTSDB.
+type MultiTSDBOption func(mt *MultiTSDB)
+
+// WithTenantRetention overrides the retention of the local TSDB for the given tenants.
+func WithTenantRetention(cfg TenantRetentionConfig) MultiTSDBOption {
+	return func(mt *MultiTSDB) {
+		mt.tenantRetention = cfg
+	}
+}
+
+// WithStorageHealth puts the tenants whose TSDB fails to open because of a storage failure in degraded mode, instead
+// of failing to open all the tenants.
+func WithStorageHealth(h *StorageHealth) MultiTSDBOption {
+	return func(mt *MultiTSDB) {
+		mt.storageHealth = h
+	}
 }
 
 // NewMultiTSDB creates new MultiTSDB.
@@ -78,12 +110,13 @@ func NewMultiTSDB(
 	bucket objstore.Bucket,
 	allowOutOfOrderUpload bool,
 	hashFunc metadata.HashFunc,
+	options ...MultiTSDBOption,
 ) *MultiTSDB {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
 
-	return &MultiTSDB{
+	mt := &MultiTSDB{
 		dataDir:               dataDir,
 		logger:                log.With(l, "component", "multi-tsdb"),
 		reg:                   reg,
@@ -95,7 +128,29 @@ func NewMultiTSDB(
 		bucket:                bucket,
 		allowOutOfOrderUpload: allowOutOfOrderUpload,
 		hashFunc:              hashFunc,
+		tenantBlocksMarkedForDeletion: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_tenant_deletion_marked_blocks_total",
+			Help: "Total number of blocks of deleted tenants marked for deletion in the bucket.",
+		}),
 	}
+	for _, option := range options {
+		option(mt)
+	}
+	return mt
+}
+
+// tenantTSDBOptions returns the TSDB options of the tenant, with its retention overrides.
+func (t *MultiTSDB) tenantTSDBOptions(tenantID string) tsdb.Options {
+	opts := *t.tsdbOpts
+	if r, ok := t.tenantRetention[tenantID]; ok {
+		if r.Retention > 0 {
+			opts.RetentionDuration = int64(time.Duration(r.Retention) / time.Millisecond)
+		}
+		if r.MaxBytes > 0 {
+			opts.MaxBytes = int64(r.MaxBytes)
+		}
+	}
+	return opts
 }
 
 type localClient struct {
@@ -184,19 +239,7 @@ func (l *localClient) TimeRange() (mint int64, maxt int64) {
 }
 
 func (l *localClient) TSDBInfos() []infopb.TSDBInfo {
-	labelsets := l.store.LabelSet()
-	if len(labelsets) == 0 {
-		return []infopb.TSDBInfo{}
-	}
-
-	mint, maxt := l.store.TimeRange()
-	return []infopb.TSDBInfo{
-		{
-			Labels:  labelsets[0],
-			MinTime: mint,
-			MaxTime: maxt,
-		},
-	}
+	return l.store.TSDBInfos()
 }
 
 func (l *localClient) String() string {
@@ -219,6 +262,10 @@ func (l *localClient) SupportsWithoutReplicaLabels() bool {
 	return true
 }
 
+func (l *localClient) SupportsTimeFiltering() bool {
+	return false
+}
+
 type tenant struct {
 	readyS        *ReadyStorage
 	storeTSDB     *store.TSDBStore
@@ -326,9 +373,24 @@ func (t *MultiTSDB) Open() error {
 		if !f.IsDir() {
 			continue
 		}
+		d, err := t.tenantDeletion(f.Name())
+		if err != nil {
+			return err
+		}
+		// The TSDBs of tenants which started to be purged are not served anymore, they are removed by the next purge.
+		if d != nil && d.State != TenantDeletionPending {
+			continue
+		}
 
 		g.Go(func() error {
 			_, err := t.getOrLoadTenant(f.Name(), true)
+			if err != nil && t.storageHealth != nil {
+				if _, ok := storageFailureOf(err); ok {
+					// The tenant is in degraded mode, its TSDB is opened again on its next write once it can be written to.
+					level.Error(t.logger).Log("msg", "failed to open TSDB of tenant", "tenant", f.Name(), "err", err)
+					return nil
+				}
+			}
 			return err
 		})
 	}
@@ -400,7 +462,7 @@ func (t *MultiTSDB) Close() error {
 // any new samples for longer than the TSDB retention period.
 func (t *MultiTSDB) Prune(ctx context.Context) error {
 	// Retention of 0 means infinite retention.
-	if t.tsdbOpts.RetentionDuration == 0 {
+	if t.tsdbOpts.RetentionDuration == 0 && len(t.tenantRetention) == 0 {
 		return nil
 	}
 	level.Info(t.logger).Log("msg", "Running pruning job")
@@ -414,11 +476,15 @@ func (t *MultiTSDB) Prune(ctx context.Context) error {
 	)
 	t.mtx.RLock()
 	for tenantID, tenantInstance := range t.tenants {
+		retention := t.tenantTSDBOptions(tenantID).RetentionDuration
+		if retention == 0 {
+			continue
+		}
 		wg.Add(1)
 		go func(tenantID string, tenantInstance *tenant) {
 			defer wg.Done()
 			tlog := log.With(t.logger, "tenant", tenantID)
-			pruned, err := t.pruneTSDB(ctx, tlog, tenantInstance)
+			pruned, err := t.pruneTSDB(ctx, tlog, tenantInstance, retention)
 			if err != nil {
 				merr.Add(err)
 				return
@@ -449,9 +515,9 @@ func (t *MultiTSDB) Prune(ctx context.Context) error {
 	return merr.Err()
 }
 
-// pruneTSDB removes a TSDB if its past the retention period.
+// pruneTSDB removes a TSDB if its past the given retention period, in milliseconds.
 // It compacts the TSDB head, sends all remaining blocks to S3 and removes the TSDB from disk.
-func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInstance *tenant) (pruned bool, rerr error) {
+func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInstance *tenant, retention int64) (pruned bool, rerr error) {
 	tenantTSDB := tenantInstance.readyStorage()
 	if tenantTSDB == nil {
 		return false, nil
@@ -507,7 +573,7 @@ func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInst
 		return false, err
 	}
 
-	if sinceLastAppendMillis <= t.tsdbOpts.RetentionDuration {
+	if sinceLastAppendMillis <= retention {
 		return false, nil
 	}
 
@@ -604,11 +670,16 @@ func (t *MultiTSDB) RemoveLockFilesIfAny() error {
 }
 
 func (t *MultiTSDB) TSDBLocalClients() []store.Client {
+	withoutReads := t.tenantsWithoutReads()
+
 	t.mtx.RLock()
 	defer t.mtx.RUnlock()
 
 	res := make([]store.Client, 0, len(t.tenants))
-	for _, tenant := range t.tenants {
+	for tenantID, tenant := range t.tenants {
+		if _, ok := withoutReads[tenantID]; ok {
+			continue
+		}
 		client := tenant.client()
 		if client != nil {
 			res = append(res, client)
@@ -619,11 +690,16 @@ func (t *MultiTSDB) TSDBLocalClients() []store.Client {
 }
 
 func (t *MultiTSDB) TSDBExemplars() map[string]*exemplars.TSDB {
+	withoutReads := t.tenantsWithoutReads()
+
 	t.mtx.RLock()
 	defer t.mtx.RUnlock()
 
 	res := make(map[string]*exemplars.TSDB, len(t.tenants))
 	for k, tenant := range t.tenants {
+		if _, ok := withoutReads[k]; ok {
+			continue
+		}
 		e := tenant.exemplars()
 		if e != nil {
 			res[k] = e
@@ -677,6 +753,72 @@ func (t *MultiTSDB) TenantStats(limit int, statsByLabelName string, tenantIDs ..
 	return result
 }
 
+func (t *MultiTSDB) TenantCardinality(ctx context.Context, limit int, tenantID string) (*TenantCardinality, error) {
+	t.mtx.RLock()
+	tenant, ok := t.tenants[tenantID]
+	t.mtx.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	db := tenant.readyS.Get()
+	if db == nil {
+		return nil, nil
+	}
+
+	head := db.Head()
+	stats := head.Stats(labels.MetricName, limit)
+	seriesByLabelName, err := seriesCountByLabelName(ctx, head)
+	if err != nil {
+		return nil, errors.Wrap(err, "count series by label name")
+	}
+	return &TenantCardinality{
+		Tenant:                      tenantID,
+		NumSeries:                   stats.NumSeries,
+		MinTime:                     stats.MinTime,
+		MaxTime:                     stats.MaxTime,
+		NumLabelPairs:               stats.IndexPostingStats.NumLabelPairs,
+		SeriesCountByMetricName:     v1.TSDBStatsFromIndexStats(stats.IndexPostingStats.CardinalityMetricsStats),
+		SeriesCountByLabelName:      topStats(seriesByLabelName, limit),
+		LabelValueCountByLabelName:  v1.TSDBStatsFromIndexStats(stats.IndexPostingStats.CardinalityLabelStats),
+		SeriesCountByLabelValuePair: v1.TSDBStatsFromIndexStats(stats.IndexPostingStats.LabelValuePairsStats),
+	}, nil
+}
+
+// seriesCountByLabelName returns the number of series of the given head with each label name, counting the postings
+// of all their values.
+func seriesCountByLabelName(ctx context.Context, head *tsdb.Head) (_ map[string]uint64, err error) {
+	ir, err := head.Index()
+	if err != nil {
+		return nil, err
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "close head index reader")
+
+	names, err := ir.LabelNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]uint64, len(names))
+	for _, name := range names {
+		values, err := ir.SortedLabelValues(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			p, err := ir.Postings(ctx, name, value)
+			if err != nil {
+				return nil, err
+			}
+			for p.Next() {
+				counts[name]++
+			}
+			if err := p.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return counts, nil
+}
+
 func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant) error {
 	reg := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenantID}, t.reg)
 	reg = NewUnRegisterer(reg)
@@ -686,7 +828,7 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 	dataDir := t.defaultTenantDataDir(tenantID)
 
 	level.Info(logger).Log("msg", "opening TSDB")
-	opts := *t.tsdbOpts
+	opts := t.tenantTSDBOptions(tenantID)
 	opts.BlocksToDelete = tenant.blocksToDelete
 	tenant.blocksToDeleteFn = tsdb.DefaultBlocksToDelete
 
@@ -706,6 +848,7 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 		t.mtx.Lock()
 		delete(t.tenants, tenantID)
 		t.mtx.Unlock()
+		t.storageHealth.observe(tenantID, err)
 		return err
 	}
 	var ship *shipper.Shipper
@@ -768,6 +911,13 @@ func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart bool) (*tenan
 }
 
 func (t *MultiTSDB) TenantAppendable(tenantID string) (Appendable, error) {
+	d, err := t.tenantDeletion(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		return nil, ErrTenantMarkedForDeletion
+	}
 	tenant, err := t.getOrLoadTenant(tenantID, false)
 	if err != nil {
 		return nil, err
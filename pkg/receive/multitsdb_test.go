@@ -506,6 +506,60 @@ func syncTSDBs(ctx context.Context, m *MultiTSDB, interval time.Duration) error
 	}
 }
 
+func TestMultiTSDBTenantRetention(t *testing.T) {
+	cfg, err := ParseTenantRetentionConfig([]byte(`
+long-tenant:
+  retention: 30d
+  max_bytes: 1GB
+short-tenant:
+  retention: 1h
+`))
+	testutil.Ok(t, err)
+	_, err = ParseTenantRetentionConfig([]byte(`{tenant: {retention: 1h, unknown: true}}`))
+	testutil.NotOk(t, err)
+
+	dir := t.TempDir()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+			MaxBytes:          1024,
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantRetention(cfg),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	opts := m.tenantTSDBOptions("long-tenant")
+	testutil.Equals(t, (30 * 24 * time.Hour).Milliseconds(), opts.RetentionDuration)
+	testutil.Equals(t, int64(1<<30), opts.MaxBytes)
+	opts = m.tenantTSDBOptions("short-tenant")
+	testutil.Equals(t, time.Hour.Milliseconds(), opts.RetentionDuration)
+	testutil.Equals(t, int64(1024), opts.MaxBytes)
+	opts = m.tenantTSDBOptions("other-tenant")
+	testutil.Equals(t, (6 * time.Hour).Milliseconds(), opts.RetentionDuration)
+
+	for step := time.Duration(0); step <= 2*time.Hour; step += time.Minute {
+		testutil.Ok(t, appendSample(m, "short-tenant", time.Now().Add(-5*time.Hour+step)))
+		testutil.Ok(t, appendSample(m, "other-tenant", time.Now().Add(-5*time.Hour+step)))
+		testutil.Ok(t, appendSample(m, "long-tenant", time.Now().Add(-9*time.Hour+step)))
+	}
+	testutil.Equals(t, 3, len(m.TSDBLocalClients()))
+
+	// Tenants are pruned once inactive for longer than their own retention.
+	testutil.Ok(t, m.Prune(context.Background()))
+	testutil.Equals(t, 2, len(m.TSDBLocalClients()))
+	m.mtx.RLock()
+	_, ok := m.tenants["short-tenant"]
+	m.mtx.RUnlock()
+	testutil.Assert(t, !ok, "expected short-tenant to be pruned")
+}
+
 func TestMultiTSDBRecreatePrunedTenant(t *testing.T) {
 	dir := t.TempDir()
 
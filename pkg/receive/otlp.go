@@ -0,0 +1,169 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	promprompb "github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote/otlptranslator/prometheusremotewrite"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	otlpProtoContentType = "application/x-protobuf"
+	otlpJSONContentType  = "application/json"
+)
+
+// otlpContentType returns the media type of an OTLP/HTTP request, which is protobuf when it is not set.
+func otlpContentType(contentType string) (string, error) {
+	if contentType == "" {
+		return otlpProtoContentType, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse content type %q", contentType)
+	}
+	switch mediaType {
+	case otlpProtoContentType, otlpJSONContentType:
+		return mediaType, nil
+	default:
+		return "", errors.Errorf("unsupported content type %q, expected %s or %s", contentType, otlpProtoContentType, otlpJSONContentType)
+	}
+}
+
+// decompressOTLP decompresses the body of an OTLP/HTTP request according to its content encoding.
+func decompressOTLP(contentEncoding string, body []byte) ([]byte, error) {
+	switch contentEncoding {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "create gzip reader")
+		}
+		defer gr.Close()
+
+		buf, err := io.ReadAll(gr)
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip decode")
+		}
+		return buf, nil
+	default:
+		return nil, errors.Errorf("unsupported content encoding %q, expected gzip", contentEncoding)
+	}
+}
+
+// decodeOTLPWriteRequest decodes an OTLP metrics export request and converts its metrics to a remote write request.
+// The given resource attributes are promoted to labels of all the series of their resource, in addition to the
+// job and instance labels derived from the service attributes. Metric names are suffixed with their unit and type,
+// the way Prometheus does. Metrics which can't be converted are skipped and logged.
+func decodeOTLPWriteRequest(logger log.Logger, mediaType string, buf []byte, promoteResourceAttributes []string) (*prompb.WriteRequest, error) {
+	req := pmetricotlp.NewExportRequest()
+	var err error
+	if mediaType == otlpJSONContentType {
+		err = req.UnmarshalJSON(buf)
+	} else {
+		err = req.UnmarshalProto(buf)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "decode OTLP request")
+	}
+
+	md := req.Metrics()
+	promoteOTLPResourceAttributes(md, promoteResourceAttributes)
+
+	converter := prometheusremotewrite.NewPrometheusConverter()
+	if err := converter.FromMetrics(md, prometheusremotewrite.Settings{AddMetricSuffixes: true}); err != nil {
+		level.Warn(logger).Log("msg", "failed to convert some OTLP metrics, skipping them", "err", err)
+	}
+
+	// The series of the converter are Prometheus ones, which are wire compatible with ours.
+	converted, err := (&promprompb.WriteRequest{Timeseries: converter.TimeSeries()}).Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal converted series")
+	}
+	var wreq prompb.WriteRequest
+	if err := wreq.Unmarshal(converted); err != nil {
+		return nil, errors.Wrap(err, "unmarshal converted series")
+	}
+	return &wreq, nil
+}
+
+// promoteOTLPResourceAttributes copies the given resource attributes to the attributes of all the data points of
+// their resource, unless a data point has an attribute with the same name already.
+func promoteOTLPResourceAttributes(md pmetric.Metrics, attrs []string) {
+	if len(attrs) == 0 {
+		return
+	}
+
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		promoted := pcommon.NewMap()
+		resourceAttrs := rms.At(i).Resource().Attributes()
+		for _, name := range attrs {
+			if v, ok := resourceAttrs.Get(name); ok {
+				v.CopyTo(promoted.PutEmpty(name))
+			}
+		}
+		if promoted.Len() == 0 {
+			continue
+		}
+
+		sms := rms.At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			metrics := sms.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				forEachOTLPDataPointAttributes(metrics.At(k), func(dpAttrs pcommon.Map) {
+					promoted.Range(func(name string, v pcommon.Value) bool {
+						if _, ok := dpAttrs.Get(name); !ok {
+							v.CopyTo(dpAttrs.PutEmpty(name))
+						}
+						return true
+					})
+				})
+			}
+		}
+	}
+}
+
+func forEachOTLPDataPointAttributes(metric pmetric.Metric, f func(pcommon.Map)) {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			f(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeSum:
+		dps := metric.Sum().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			f(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeHistogram:
+		dps := metric.Histogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			f(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		dps := metric.ExponentialHistogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			f(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeSummary:
+		dps := metric.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			f(dps.At(i).Attributes())
+		}
+	}
+}
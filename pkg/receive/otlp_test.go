@@ -0,0 +1,99 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestReceiveOTLP(t *testing.T) {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "api")
+	rm.Resource().Attributes().PutStr("service.instance.id", "host:80")
+	rm.Resource().Attributes().PutStr("cluster", "eu-1")
+	rm.Resource().Attributes().PutStr("region", "eu")
+
+	m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http.requests")
+	sum := m.SetEmptySum()
+	sum.SetIsMonotonic(true)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := sum.DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	dp.SetDoubleValue(10)
+	dp.Attributes().PutStr("method", "GET")
+	dp.Attributes().PutStr("region", "us")
+
+	req := pmetricotlp.NewExportRequestFromMetrics(md)
+	protoBuf, err := req.MarshalProto()
+	testutil.Ok(t, err)
+	jsonBuf, err := req.MarshalJSON()
+	testutil.Ok(t, err)
+
+	var gzipBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzipBuf)
+	_, err = gw.Write(protoBuf)
+	testutil.Ok(t, err)
+	testutil.Ok(t, gw.Close())
+
+	for _, tc := range []struct {
+		name            string
+		body            []byte
+		contentType     string
+		contentEncoding string
+		code            int
+	}{
+		{name: "protobuf", body: protoBuf, contentType: "application/x-protobuf", code: http.StatusOK},
+		{name: "gzip protobuf", body: gzipBuf.Bytes(), contentType: "application/x-protobuf", contentEncoding: "gzip", code: http.StatusOK},
+		{name: "json", body: jsonBuf, contentType: "application/json", code: http.StatusOK},
+		{name: "unsupported content type", body: protoBuf, contentType: "text/plain", code: http.StatusUnsupportedMediaType},
+		{name: "unsupported content encoding", body: protoBuf, contentType: "application/x-protobuf", contentEncoding: "snappy", code: http.StatusBadRequest},
+		{name: "invalid body", body: []byte("foo"), contentType: "application/x-protobuf", code: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			appendables := []*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}
+			handlers, _, err := newTestHandlerHashring(appendables, 1, AlgorithmHashmod)
+			testutil.Ok(t, err)
+			handler := handlers[0]
+			handler.options.OTLPPromoteResourceAttributes = []string{"cluster", "region", "missing"}
+
+			r, err := http.NewRequest("POST", "/api/v1/otlp/v1/metrics", bytes.NewReader(tc.body))
+			testutil.Ok(t, err)
+			r.Header.Set("Content-Type", tc.contentType)
+			if tc.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", tc.contentEncoding)
+			}
+			r.Header.Set(handler.options.TenantHeader, "foo")
+			rec := httptest.NewRecorder()
+			handler.receiveOTLPHTTP(rec, r)
+			testutil.Equals(t, tc.code, rec.Code, rec.Body.String())
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			samples := appendables[0].appender.(*fakeAppender).Get(labels.FromStrings(
+				"__name__", "http_requests_total",
+				"cluster", "eu-1",
+				"instance", "host:80",
+				"job", "api",
+				"method", "GET",
+				"region", "us",
+			))
+			testutil.Equals(t, 1, len(samples))
+			testutil.Equals(t, 10.0, samples[0].Value)
+		})
+	}
+}
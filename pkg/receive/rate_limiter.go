@@ -0,0 +1,173 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	samplesPerSecondLimitName = "samples_per_second"
+	samplesBurstLimitName     = "samples_burst"
+)
+
+// errSamplesBurstExceeded is returned for requests with more samples than the burst of their tenant, which would never
+// be allowed.
+var errSamplesBurstExceeded = errors.New("write request has more samples than the samples burst of the tenant")
+
+var unlimitedRateLimitsConfig = NewEmptyRateLimitsConfig().
+	SetSamplesPerSecond(0).
+	SetSamplesBurst(0).
+	SetNewSeriesPerSecond(0).
+	SetNewSeriesBurst(0)
+
+// rateLimiter limits the ingestion rate of tenants.
+type rateLimiter interface {
+	// AllowSamples returns zero if the given amount of samples of the tenant can be ingested now, and otherwise how
+	// long to wait before retrying. It returns errSamplesBurstExceeded if the amount is above the burst of the tenant.
+	AllowSamples(tenant string, amount int64) (time.Duration, error)
+}
+
+// configRateLimiter implements the rateLimiter interface with a token bucket per tenant.
+type configRateLimiter struct {
+	tenantLimits        map[string]*rateLimitsConfig
+	cachedDefaultLimits *rateLimitsConfig
+
+	mtx      sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	throttledRequests *prometheus.CounterVec
+	throttledSamples  *prometheus.CounterVec
+	configuredLimits  *prometheus.GaugeVec
+}
+
+func newConfigRateLimiter(reg prometheus.Registerer, writeLimits *WriteLimitsConfig) *configRateLimiter {
+	// Merge the default limits configuration with an unlimited configuration
+	// to ensure the nils are overwritten with zeroes.
+	defaultRateLimits := writeLimits.DefaultLimits.RateLimits.OverlayWith(unlimitedRateLimitsConfig)
+
+	tenantRateLimits := make(map[string]*rateLimitsConfig)
+	for tenant, limitConfig := range writeLimits.TenantsLimits {
+		if limitConfig.RateLimits != nil {
+			tenantRateLimits[tenant] = limitConfig.RateLimits.OverlayWith(defaultRateLimits)
+		}
+	}
+
+	l := &configRateLimiter{
+		tenantLimits:        tenantRateLimits,
+		cachedDefaultLimits: defaultRateLimits,
+		limiters:            map[string]*rate.Limiter{},
+	}
+	l.registerMetrics(reg)
+	return l
+}
+
+func (l *configRateLimiter) registerMetrics(reg prometheus.Registerer) {
+	l.throttledRequests = promauto.With(reg).NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "rate_limited_requests_total",
+			Help:      "The number of remote write requests refused because their tenant was above its ingestion rate limits.",
+		}, []string{"tenant", "limit"},
+	)
+	l.throttledSamples = promauto.With(reg).NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "rate_limited_samples_total",
+			Help:      "The number of samples of the remote write requests refused because their tenant was above its ingestion rate limits.",
+		}, []string{"tenant", "limit"},
+	)
+	l.configuredLimits = promauto.With(reg).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "write_rate_limits",
+			Help:      "The configured write rate limits.",
+		}, []string{"tenant", "limit"},
+	)
+	for tenant, limits := range l.tenantLimits {
+		l.configuredLimits.WithLabelValues(tenant, samplesPerSecondLimitName).Set(*limits.SamplesPerSecond)
+		l.configuredLimits.WithLabelValues(tenant, samplesBurstLimitName).Set(float64(samplesBurst(limits)))
+	}
+	l.configuredLimits.WithLabelValues("", samplesPerSecondLimitName).Set(*l.cachedDefaultLimits.SamplesPerSecond)
+	l.configuredLimits.WithLabelValues("", samplesBurstLimitName).Set(float64(samplesBurst(l.cachedDefaultLimits)))
+}
+
+func (l *configRateLimiter) AllowSamples(tenant string, amount int64) (time.Duration, error) {
+	limiter := l.limiterFor(tenant)
+	if limiter == nil {
+		return 0, nil
+	}
+
+	now := time.Now()
+	r := limiter.ReserveN(now, int(amount))
+	if !r.OK() {
+		l.throttledRequests.WithLabelValues(tenant, samplesBurstLimitName).Inc()
+		l.throttledSamples.WithLabelValues(tenant, samplesBurstLimitName).Add(float64(amount))
+		return 0, errSamplesBurstExceeded
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return 0, nil
+	}
+	// The request is refused rather than delayed: give the tokens back.
+	r.CancelAt(now)
+	l.throttledRequests.WithLabelValues(tenant, samplesPerSecondLimitName).Inc()
+	l.throttledSamples.WithLabelValues(tenant, samplesPerSecondLimitName).Add(float64(amount))
+	return delay, nil
+}
+
+// limiterFor returns the token bucket of the given tenant, or nil if its rate is not limited.
+func (l *configRateLimiter) limiterFor(tenant string) *rate.Limiter {
+	limits := l.limitsFor(tenant)
+	if *limits.SamplesPerSecond <= 0 {
+		return nil
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	limiter, ok := l.limiters[tenant]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(*limits.SamplesPerSecond), int(samplesBurst(limits)))
+		l.limiters[tenant] = limiter
+	}
+	return limiter
+}
+
+func (l *configRateLimiter) limitsFor(tenant string) *rateLimitsConfig {
+	limits, ok := l.tenantLimits[tenant]
+	if !ok {
+		limits = l.cachedDefaultLimits
+	}
+	return limits
+}
+
+// samplesBurst returns the samples burst of the given limits, which defaults to the samples of one second.
+func samplesBurst(limits *rateLimitsConfig) int64 {
+	return burstOrDefault(*limits.SamplesBurst, *limits.SamplesPerSecond)
+}
+
+// burstOrDefault returns the given burst, which defaults to the amount of one second of the given rate.
+func burstOrDefault(burst int64, perSecond float64) int64 {
+	if burst > 0 || perSecond <= 0 {
+		return burst
+	}
+	return int64(math.Max(1, math.Ceil(perSecond)))
+}
+
+type noopRateLimiter struct{}
+
+func (l *noopRateLimiter) AllowSamples(string, int64) (time.Duration, error) {
+	return 0, nil
+}
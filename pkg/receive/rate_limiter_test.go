@@ -0,0 +1,143 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestRateLimiter_AllowSamples(t *testing.T) {
+	limits := WriteLimitsConfig{
+		DefaultLimits: DefaultLimitsConfig{
+			RateLimits: *NewEmptyRateLimitsConfig().SetSamplesPerSecond(10),
+		},
+		TenantsLimits: TenantsWriteLimitsConfig{
+			"bursty": &WriteLimitConfig{
+				RateLimits: NewEmptyRateLimitsConfig().SetSamplesBurst(100),
+			},
+			"unlimited": &WriteLimitConfig{
+				RateLimits: NewEmptyRateLimitsConfig().SetSamplesPerSecond(0),
+			},
+		},
+	}
+	l := newConfigRateLimiter(prometheus.NewRegistry(), &limits)
+
+	// The burst defaults to the samples of one second.
+	retryAfter, err := l.AllowSamples("default", 10)
+	testutil.Ok(t, err)
+	testutil.Equals(t, time.Duration(0), retryAfter)
+	retryAfter, err = l.AllowSamples("default", 5)
+	testutil.Ok(t, err)
+	testutil.Assert(t, retryAfter > 0 && retryAfter <= time.Second, "unexpected retry after %v", retryAfter)
+	_, err = l.AllowSamples("default", 11)
+	testutil.Equals(t, errSamplesBurstExceeded, err)
+
+	// Tenants have their own buckets, their limits inheriting from the default ones.
+	retryAfter, err = l.AllowSamples("bursty", 100)
+	testutil.Ok(t, err)
+	testutil.Equals(t, time.Duration(0), retryAfter)
+	retryAfter, err = l.AllowSamples("bursty", 10)
+	testutil.Ok(t, err)
+	testutil.Assert(t, retryAfter > 0, "unexpected retry after %v", retryAfter)
+
+	for i := 0; i < 10; i++ {
+		retryAfter, err = l.AllowSamples("unlimited", 1000)
+		testutil.Ok(t, err)
+		testutil.Equals(t, time.Duration(0), retryAfter)
+	}
+
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.throttledRequests.WithLabelValues("default", samplesPerSecondLimitName)))
+	testutil.Equals(t, 5.0, promtestutil.ToFloat64(l.throttledSamples.WithLabelValues("default", samplesPerSecondLimitName)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.throttledRequests.WithLabelValues("default", samplesBurstLimitName)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.throttledRequests.WithLabelValues("bursty", samplesPerSecondLimitName)))
+	testutil.Equals(t, 10.0, promtestutil.ToFloat64(l.configuredLimits.WithLabelValues("", samplesBurstLimitName)))
+	testutil.Equals(t, 100.0, promtestutil.ToFloat64(l.configuredLimits.WithLabelValues("bursty", samplesBurstLimitName)))
+}
+
+func TestParseRootLimitConfig_RateLimits(t *testing.T) {
+	root, err := ParseRootLimitConfig([]byte(`write:
+  default:
+    rate:
+      samples_per_second: 1000
+  tenants:
+    acme:
+      rate:
+        samples_burst: 5000
+        new_series_per_second: 100
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, NewEmptyRateLimitsConfig().SetSamplesPerSecond(1000), &root.WriteLimits.DefaultLimits.RateLimits)
+	testutil.Equals(t, NewEmptyRateLimitsConfig().SetSamplesBurst(5000).SetNewSeriesPerSecond(100), root.WriteLimits.TenantsLimits["acme"].RateLimits)
+
+	_, err = ParseRootLimitConfig([]byte(`write:
+  tenants:
+    acme:
+      rate:
+        samples_per_second: -1
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseRootLimitConfig([]byte(`write:
+  default:
+    rate:
+      new_series_burst: -1
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestHandler_RateLimits(t *testing.T) {
+	handlers, _, err := newTestHandlerHashring([]*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}, 1, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	handler := handlers[0]
+
+	limitsPath := path.Join(t.TempDir(), "limits.yaml")
+	testutil.Ok(t, os.WriteFile(limitsPath, []byte(`write:
+  tenants:
+    limited:
+      rate:
+        samples_per_second: 0.001
+        samples_burst: 5
+`), 0666))
+	limitsConfig, err := extkingpin.NewStaticPathContent(limitsPath)
+	testutil.Ok(t, err)
+	handler.Limiter, err = NewLimiter(limitsConfig, nil, RouterIngestor, log.NewNopLogger(), time.Second)
+	testutil.Ok(t, err)
+
+	// Each series has one sample.
+	wreq := &prompb.WriteRequest{Timeseries: makeSeriesWithValues(3)}
+
+	rec, err := makeRequest(handler, "limited", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec, err = makeRequest(handler, "limited", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, retryAfter > 0, "unexpected Retry-After %d", retryAfter)
+
+	rec, err = makeRequest(handler, "limited", &prompb.WriteRequest{Timeseries: makeSeriesWithValues(6)})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+
+	// Other tenants are not limited.
+	for i := 0; i < 3; i++ {
+		rec, err = makeRequest(handler, "other", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	thanosmodel "github.com/thanos-io/thanos/pkg/model"
+)
+
+// TenantRetention is the retention of the local TSDB of a tenant. Unset fields default to the global retention flags.
+type TenantRetention struct {
+	// Retention is how long blocks are retained.
+	Retention model.Duration `yaml:"retention"`
+	// MaxBytes is the maximum size of the blocks, the oldest ones are deleted first.
+	MaxBytes thanosmodel.Bytes `yaml:"max_bytes"`
+}
+
+// TenantRetentionConfig holds the local retention of tenants by their tenant ID.
+type TenantRetentionConfig map[string]TenantRetention
+
+// ParseTenantRetentionConfig parses the per-tenant retention configuration.
+func ParseTenantRetentionConfig(content []byte) (TenantRetentionConfig, error) {
+	var cfg TenantRetentionConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing config YAML file")
+	}
+	for tenant, r := range cfg {
+		if time.Duration(r.Retention) < 0 {
+			return nil, errors.Errorf("tenant %s: negative retention %s", tenant, r.Retention)
+		}
+	}
+	return cfg, nil
+}
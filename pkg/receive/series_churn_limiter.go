@@ -0,0 +1,128 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	newSeriesPerSecondLimitName = "new_series_per_second"
+	newSeriesBurstLimitName     = "new_series_burst"
+)
+
+// errSeriesChurnLimited is returned for the new series refused because their tenant created series above its series
+// churn limit.
+var errSeriesChurnLimited = errors.New("tenant is above its series churn limit")
+
+// seriesChurnLimiter limits the rate at which tenants create new series in the head, independently of the number of
+// their active series.
+type seriesChurnLimiter interface {
+	// AllowNewSeries returns whether the tenant can create a new series now.
+	AllowNewSeries(tenant string) bool
+}
+
+// configSeriesChurnLimiter implements the seriesChurnLimiter interface with a token bucket per tenant.
+type configSeriesChurnLimiter struct {
+	tenantLimits        map[string]*rateLimitsConfig
+	cachedDefaultLimits *rateLimitsConfig
+
+	mtx      sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	limitedSeries    *prometheus.CounterVec
+	configuredLimits *prometheus.GaugeVec
+}
+
+func newConfigSeriesChurnLimiter(reg prometheus.Registerer, writeLimits *WriteLimitsConfig) *configSeriesChurnLimiter {
+	// Merge the default limits configuration with an unlimited configuration
+	// to ensure the nils are overwritten with zeroes.
+	defaultRateLimits := writeLimits.DefaultLimits.RateLimits.OverlayWith(unlimitedRateLimitsConfig)
+
+	tenantRateLimits := make(map[string]*rateLimitsConfig)
+	for tenant, limitConfig := range writeLimits.TenantsLimits {
+		if limitConfig.RateLimits != nil {
+			tenantRateLimits[tenant] = limitConfig.RateLimits.OverlayWith(defaultRateLimits)
+		}
+	}
+
+	l := &configSeriesChurnLimiter{
+		tenantLimits:        tenantRateLimits,
+		cachedDefaultLimits: defaultRateLimits,
+		limiters:            map[string]*rate.Limiter{},
+	}
+	l.registerMetrics(reg)
+	return l
+}
+
+func (l *configSeriesChurnLimiter) registerMetrics(reg prometheus.Registerer) {
+	l.limitedSeries = promauto.With(reg).NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "series_churn_limited_series_total",
+			Help:      "The number of new series refused because their tenant was above its series churn limit.",
+		}, []string{"tenant"},
+	)
+	l.configuredLimits = promauto.With(reg).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "series_churn_limits",
+			Help:      "The configured series churn limits.",
+		}, []string{"tenant", "limit"},
+	)
+	for tenant, limits := range l.tenantLimits {
+		l.configuredLimits.WithLabelValues(tenant, newSeriesPerSecondLimitName).Set(*limits.NewSeriesPerSecond)
+		l.configuredLimits.WithLabelValues(tenant, newSeriesBurstLimitName).Set(float64(newSeriesBurst(limits)))
+	}
+	l.configuredLimits.WithLabelValues("", newSeriesPerSecondLimitName).Set(*l.cachedDefaultLimits.NewSeriesPerSecond)
+	l.configuredLimits.WithLabelValues("", newSeriesBurstLimitName).Set(float64(newSeriesBurst(l.cachedDefaultLimits)))
+}
+
+func (l *configSeriesChurnLimiter) AllowNewSeries(tenant string) bool {
+	limiter := l.limiterFor(tenant)
+	if limiter == nil || limiter.Allow() {
+		return true
+	}
+	l.limitedSeries.WithLabelValues(tenant).Inc()
+	return false
+}
+
+// limiterFor returns the token bucket of the given tenant, or nil if its series churn is not limited.
+func (l *configSeriesChurnLimiter) limiterFor(tenant string) *rate.Limiter {
+	limits, ok := l.tenantLimits[tenant]
+	if !ok {
+		limits = l.cachedDefaultLimits
+	}
+	if *limits.NewSeriesPerSecond <= 0 {
+		return nil
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	limiter, ok := l.limiters[tenant]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(*limits.NewSeriesPerSecond), int(newSeriesBurst(limits)))
+		l.limiters[tenant] = limiter
+	}
+	return limiter
+}
+
+// newSeriesBurst returns the new series burst of the given limits, which defaults to the series of one second.
+func newSeriesBurst(limits *rateLimitsConfig) int64 {
+	return burstOrDefault(*limits.NewSeriesBurst, *limits.NewSeriesPerSecond)
+}
+
+type noopSeriesChurnLimiter struct{}
+
+func (l *noopSeriesChurnLimiter) AllowNewSeries(string) bool {
+	return true
+}
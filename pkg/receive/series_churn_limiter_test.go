@@ -0,0 +1,113 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestSeriesChurnLimiter_AllowNewSeries(t *testing.T) {
+	limits := WriteLimitsConfig{
+		DefaultLimits: DefaultLimitsConfig{
+			RateLimits: *NewEmptyRateLimitsConfig().SetNewSeriesPerSecond(2),
+		},
+		TenantsLimits: TenantsWriteLimitsConfig{
+			"bursty": &WriteLimitConfig{
+				RateLimits: NewEmptyRateLimitsConfig().SetNewSeriesBurst(10),
+			},
+			"unlimited": &WriteLimitConfig{
+				RateLimits: NewEmptyRateLimitsConfig().SetNewSeriesPerSecond(0),
+			},
+		},
+	}
+	l := newConfigSeriesChurnLimiter(prometheus.NewRegistry(), &limits)
+
+	// The burst defaults to the series of one second.
+	testutil.Assert(t, l.AllowNewSeries("default"))
+	testutil.Assert(t, l.AllowNewSeries("default"))
+	testutil.Assert(t, !l.AllowNewSeries("default"))
+
+	// Tenants have their own buckets, their limits inheriting from the default ones.
+	for i := 0; i < 10; i++ {
+		testutil.Assert(t, l.AllowNewSeries("bursty"))
+	}
+	testutil.Assert(t, !l.AllowNewSeries("bursty"))
+
+	for i := 0; i < 100; i++ {
+		testutil.Assert(t, l.AllowNewSeries("unlimited"))
+	}
+
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.limitedSeries.WithLabelValues("default")))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.limitedSeries.WithLabelValues("bursty")))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(l.configuredLimits.WithLabelValues("", newSeriesBurstLimitName)))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(l.configuredLimits.WithLabelValues("bursty", newSeriesPerSecondLimitName)))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(l.configuredLimits.WithLabelValues("unlimited", newSeriesPerSecondLimitName)))
+}
+
+func TestWriter_SeriesChurnLimits(t *testing.T) {
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	t.Cleanup(func() { testutil.Ok(t, m.Close()) })
+	testutil.Ok(t, appendSample(m, "foo", time.Now()))
+
+	limiter := &Limiter{seriesChurnLimiter: newConfigSeriesChurnLimiter(prometheus.NewRegistry(), &WriteLimitsConfig{
+		DefaultLimits: DefaultLimitsConfig{
+			RateLimits: *NewEmptyRateLimitsConfig().SetNewSeriesPerSecond(0.001).SetNewSeriesBurst(2),
+		},
+	})}
+	churn := NewSeriesChurn(time.Hour)
+	w := NewWriter(log.NewNopLogger(), m, nil, &WriterOptions{SeriesChurn: churn, Limiter: limiter})
+
+	wreq := func(ts time.Time, series ...int) *prompb.WriteRequest {
+		wreq := &prompb.WriteRequest{}
+		for _, i := range series {
+			wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+				Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings("__name__", "up", "instance", fmt.Sprint(i))),
+				Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+			})
+		}
+		return wreq
+	}
+
+	// Only the series within the burst are created.
+	now := time.Now()
+	err := w.Write(context.Background(), "foo", wreq(now, 1, 2, 3))
+	testutil.NotOk(t, err)
+	testutil.Equals(t, errSeriesChurnLimited, errors.Cause(err))
+	testutil.Equals(t, []v1.TSDBStat{{Name: "up", Value: 2}}, churn.top("foo", 10))
+
+	// Samples of existing series are still ingested, regardless of the limit.
+	testutil.Ok(t, w.Write(context.Background(), "foo", wreq(now.Add(time.Second), 1, 2)))
+	testutil.Equals(t, errSeriesChurnLimited, errors.Cause(w.Write(context.Background(), "foo", wreq(now.Add(2*time.Second), 1, 4))))
+
+	// A nil limiter does not limit series churn.
+	w = NewWriter(log.NewNopLogger(), m, nil, &WriterOptions{})
+	testutil.Ok(t, w.Write(context.Background(), "foo", wreq(now.Add(3*time.Second), 3, 4)))
+}
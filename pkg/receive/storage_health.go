@@ -0,0 +1,273 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// StorageFailure is a failure of the local storage putting tenants in degraded mode.
+type StorageFailure string
+
+const (
+	// StorageFailureDiskFull is the failure of writes because the disk of the data directory is full. It affects all
+	// the tenants.
+	StorageFailureDiskFull StorageFailure = "disk_full"
+	// StorageFailureWALCorruption is the failure of writes because the WAL of the TSDB of the tenant is corrupted.
+	StorageFailureWALCorruption StorageFailure = "wal_corruption"
+	// StorageFailureHeadChunks is the failure of writes because the memory mapped head chunks of the TSDB of the
+	// tenant are corrupted.
+	StorageFailureHeadChunks StorageFailure = "head_chunks"
+)
+
+var storageFailures = []StorageFailure{StorageFailureDiskFull, StorageFailureWALCorruption, StorageFailureHeadChunks}
+
+// StorageHealthOptions configure the self-check of the local storage.
+type StorageHealthOptions struct {
+	// MinFreeDiskRatio is the ratio of free space of the disk of the data directory below which it is considered
+	// full. Zero only considers it full on write failures.
+	MinFreeDiskRatio float64
+	// RetryInterval is how long the writes of degraded tenants are rejected before being accepted again, to probe
+	// whether their storage recovered.
+	RetryInterval time.Duration
+}
+
+// StorageFault is a storage failure which put a tenant, or all of them, in degraded mode.
+type StorageFault struct {
+	// Tenant is the degraded tenant, empty if the failure affects all the tenants.
+	Tenant  string         `json:"tenant,omitempty"`
+	Failure StorageFailure `json:"failure"`
+	Error   string         `json:"error"`
+	Since   time.Time      `json:"since"`
+}
+
+// StorageHealthStatus reports the storage failures the writes are rejected because of.
+type StorageHealthStatus struct {
+	Degraded bool `json:"degraded"`
+	// DiskFreeRatio is the ratio of free space of the disk of the data directory as of the last check, if known.
+	DiskFreeRatio *float64       `json:"diskFreeRatio,omitempty"`
+	Faults        []StorageFault `json:"faults"`
+}
+
+// StorageHealth keeps track of the failures of the local storage, and puts the affected tenants in degraded mode
+// instead of letting the writes fail, or the receiver crash loop: the writes of degraded tenants are rejected as not
+// ready, so that clients and forwarding receivers retry them later, while their data is still served to queries.
+// A disk full affects all the tenants until the disk has free space again, the corruption of the TSDB of a tenant
+// only this tenant until the retry interval elapsed and its writes succeed again.
+// A nil StorageHealth tracks nothing.
+type StorageHealth struct {
+	logger  log.Logger
+	dataDir string
+	opts    StorageHealthOptions
+
+	now       func() time.Time
+	diskUsage func(path string) (free, total uint64, err error)
+
+	mtx       sync.Mutex
+	diskFull  *StorageFault
+	freeRatio *float64
+	tenants   map[string]*StorageFault
+
+	degraded *prometheus.GaugeVec
+	failures *prometheus.CounterVec
+	diskFree prometheus.Gauge
+}
+
+// NewStorageHealth returns a StorageHealth of the storage of the tenants in the given data directory.
+func NewStorageHealth(logger log.Logger, reg prometheus.Registerer, dataDir string, opts StorageHealthOptions) (*StorageHealth, error) {
+	if opts.MinFreeDiskRatio < 0 || opts.MinFreeDiskRatio >= 1 {
+		return nil, errors.Errorf("storage health min free disk ratio must be greater than or equal to 0 and less than 1, got %v", opts.MinFreeDiskRatio)
+	}
+	if opts.RetryInterval <= 0 {
+		return nil, errors.Errorf("storage health retry interval must be positive, got %v", opts.RetryInterval)
+	}
+
+	h := &StorageHealth{
+		logger:    logger,
+		dataDir:   dataDir,
+		opts:      opts,
+		now:       time.Now,
+		diskUsage: diskUsage,
+		tenants:   map[string]*StorageFault{},
+		degraded: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_storage_degraded_tenants",
+			Help: "The number of tenants whose writes are rejected because of the given storage failure. Failures affecting all the tenants count as one.",
+		}, []string{"failure"}),
+		failures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_storage_failures_total",
+			Help: "The total number of writes to the local storage which failed because of the given storage failure.",
+		}, []string{"failure"}),
+		diskFree: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_storage_disk_free_ratio",
+			Help: "The ratio of free space of the disk of the data directory, as of the last storage health check.",
+		}),
+	}
+	for _, f := range storageFailures {
+		h.degraded.WithLabelValues(string(f))
+		h.failures.WithLabelValues(string(f))
+	}
+	return h, nil
+}
+
+// storageFailureOf returns the storage failure the given error is caused by, if any.
+func storageFailureOf(err error) (StorageFailure, bool) {
+	var (
+		walErr    *wlog.CorruptionErr
+		chunksErr *chunks.CorruptionErr
+	)
+	switch {
+	case err == nil:
+		return "", false
+	case errors.Is(err, syscall.ENOSPC):
+		return StorageFailureDiskFull, true
+	case errors.As(err, &walErr):
+		return StorageFailureWALCorruption, true
+	case errors.As(err, &chunksErr):
+		return StorageFailureHeadChunks, true
+	}
+	return "", false
+}
+
+// observe puts the given tenant, or all of them, in degraded mode if the given error of a write to its storage is
+// caused by a storage failure. It returns whether it is.
+func (h *StorageHealth) observe(tenant string, err error) bool {
+	if h == nil {
+		return false
+	}
+	failure, ok := storageFailureOf(err)
+	if !ok {
+		return false
+	}
+	h.failures.WithLabelValues(string(failure)).Inc()
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	fault := &StorageFault{Failure: failure, Error: err.Error(), Since: h.now()}
+	if failure == StorageFailureDiskFull {
+		if h.diskFull == nil {
+			level.Error(h.logger).Log("msg", "disk of the data directory is full, rejecting writes of all tenants", "err", err)
+			h.diskFull = fault
+		}
+	} else if _, ok := h.tenants[tenant]; !ok {
+		level.Error(h.logger).Log("msg", "storage of tenant failed, rejecting its writes", "tenant", tenant, "failure", failure, "err", err)
+		fault.Tenant = tenant
+		h.tenants[tenant] = fault
+	}
+	h.updateMetrics()
+	return true
+}
+
+// checkWritable returns a not ready error if the writes of the given tenant are rejected because of a storage
+// failure.
+func (h *StorageHealth) checkWritable(tenant string) error {
+	if h == nil {
+		return nil
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	fault := h.diskFull
+	if fault == nil {
+		fault = h.tenants[tenant]
+	}
+	if fault == nil {
+		return nil
+	}
+	return errors.Wrapf(errNotReady, "storage degraded (%s) since %s", fault.Failure, fault.Since.Format(time.RFC3339))
+}
+
+// Check checks the free space of the disk of the data directory, and accepts the writes of the tenants degraded for
+// longer than the retry interval again. It is meant to be called periodically.
+func (h *StorageHealth) Check() {
+	free, total, err := h.diskUsage(h.dataDir)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	now := h.now()
+	switch {
+	case err != nil || total == 0:
+		level.Debug(h.logger).Log("msg", "failed to check free disk space of the data directory", "err", err)
+		h.freeRatio = nil
+		// Without knowing the free disk space, the writes are probed like for the other failures.
+		if h.diskFull != nil && now.Sub(h.diskFull.Since) >= h.opts.RetryInterval {
+			level.Info(h.logger).Log("msg", "accepting writes again after disk full", "since", h.diskFull.Since)
+			h.diskFull = nil
+		}
+	default:
+		ratio := float64(free) / float64(total)
+		h.freeRatio = &ratio
+		h.diskFree.Set(ratio)
+
+		if h.diskFull == nil && ratio < h.opts.MinFreeDiskRatio {
+			level.Error(h.logger).Log("msg", "free disk space of the data directory is below the minimum, rejecting writes of all tenants", "free_ratio", ratio)
+			h.diskFull = &StorageFault{
+				Failure: StorageFailureDiskFull,
+				Error:   errors.Errorf("free disk space ratio %.4f below %v", ratio, h.opts.MinFreeDiskRatio).Error(),
+				Since:   now,
+			}
+		}
+		if h.diskFull != nil && ratio > h.opts.MinFreeDiskRatio {
+			level.Info(h.logger).Log("msg", "disk of the data directory has free space again, accepting writes", "free_ratio", ratio, "since", h.diskFull.Since)
+			h.diskFull = nil
+		}
+	}
+
+	for tenant, fault := range h.tenants {
+		if now.Sub(fault.Since) >= h.opts.RetryInterval {
+			level.Info(h.logger).Log("msg", "accepting writes of degraded tenant again, to probe its storage", "tenant", tenant, "failure", fault.Failure, "since", fault.Since)
+			delete(h.tenants, tenant)
+		}
+	}
+	h.updateMetrics()
+}
+
+// updateMetrics updates the degraded tenants metric. The mutex must be held.
+func (h *StorageHealth) updateMetrics() {
+	counts := map[StorageFailure]int{}
+	if h.diskFull != nil {
+		counts[StorageFailureDiskFull]++
+	}
+	for _, fault := range h.tenants {
+		counts[fault.Failure]++
+	}
+	for _, f := range storageFailures {
+		h.degraded.WithLabelValues(string(f)).Set(float64(counts[f]))
+	}
+}
+
+// Status returns the storage failures the writes are currently rejected because of.
+func (h *StorageHealth) Status() StorageHealthStatus {
+	status := StorageHealthStatus{Faults: []StorageFault{}}
+	if h == nil {
+		return status
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	status.DiskFreeRatio = h.freeRatio
+	if h.diskFull != nil {
+		status.Faults = append(status.Faults, *h.diskFull)
+	}
+	tenants := make([]StorageFault, 0, len(h.tenants))
+	for _, fault := range h.tenants {
+		tenants = append(tenants, *fault)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Tenant < tenants[j].Tenant })
+	status.Faults = append(status.Faults, tenants...)
+	status.Degraded = len(status.Faults) > 0
+	return status
+}
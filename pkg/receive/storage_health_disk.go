@@ -0,0 +1,13 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+//go:build !linux
+// +build !linux
+
+package receive
+
+import "github.com/pkg/errors"
+
+func diskUsage(string) (free, total uint64, err error) {
+	return 0, 0, errors.New("checking the free disk space is only supported on linux")
+}
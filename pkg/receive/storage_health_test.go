@@ -0,0 +1,144 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestStorageFailureOf(t *testing.T) {
+	for _, tcase := range []struct {
+		err      error
+		failure  StorageFailure
+		expected bool
+	}{
+		{err: nil},
+		{err: errors.New("commit samples")},
+		{err: errors.Wrap(syscall.ENOSPC, "write to WAL"), failure: StorageFailureDiskFull, expected: true},
+		{err: errors.Wrap(&wlog.CorruptionErr{Segment: 3, Err: errors.New("unexpected checksum")}, "commit samples"), failure: StorageFailureWALCorruption, expected: true},
+		{err: errors.Wrap(&chunks.CorruptionErr{FileIndex: 2, Err: errors.New("invalid magic number")}, "open head"), failure: StorageFailureHeadChunks, expected: true},
+	} {
+		failure, ok := storageFailureOf(tcase.err)
+		testutil.Equals(t, tcase.expected, ok, "error %v", tcase.err)
+		testutil.Equals(t, tcase.failure, failure, "error %v", tcase.err)
+	}
+}
+
+func TestStorageHealth(t *testing.T) {
+	_, err := NewStorageHealth(log.NewNopLogger(), nil, "", StorageHealthOptions{MinFreeDiskRatio: 1, RetryInterval: time.Minute})
+	testutil.NotOk(t, err)
+	_, err = NewStorageHealth(log.NewNopLogger(), nil, "", StorageHealthOptions{MinFreeDiskRatio: 0.1})
+	testutil.NotOk(t, err)
+
+	h, err := NewStorageHealth(log.NewNopLogger(), prometheus.NewRegistry(), "", StorageHealthOptions{MinFreeDiskRatio: 0.1, RetryInterval: time.Minute})
+	testutil.Ok(t, err)
+
+	var (
+		now         = time.Unix(1000, 0)
+		free uint64 = 50
+	)
+	h.now = func() time.Time { return now }
+	h.diskUsage = func(string) (uint64, uint64, error) { return free, 100, nil }
+
+	writable := func(tenant string) bool {
+		err := h.checkWritable(tenant)
+		testutil.Assert(t, err == nil || errors.Cause(err) == errNotReady, "unexpected error %v", err)
+		return err == nil
+	}
+
+	testutil.Assert(t, !h.observe("a", errors.New("commit samples")))
+	testutil.Assert(t, h.observe("a", &wlog.CorruptionErr{Segment: 1, Err: errors.New("unexpected checksum")}))
+	testutil.Assert(t, !writable("a"))
+	testutil.Assert(t, writable("b"))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.degraded.WithLabelValues(string(StorageFailureWALCorruption))))
+
+	// A full disk degrades all the tenants, until the disk has free space again.
+	free = 5
+	h.Check()
+	testutil.Assert(t, !writable("b"))
+	status := h.Status()
+	testutil.Assert(t, status.Degraded)
+	testutil.Equals(t, 0.05, *status.DiskFreeRatio)
+	testutil.Equals(t, 2, len(status.Faults))
+	testutil.Equals(t, StorageFailureDiskFull, status.Faults[0].Failure)
+	testutil.Equals(t, StorageFault{Tenant: "a", Failure: StorageFailureWALCorruption, Error: "corruption in segment 00000001 at 0: unexpected checksum", Since: now}, status.Faults[1])
+
+	free = 50
+	h.Check()
+	testutil.Assert(t, writable("b"))
+	testutil.Assert(t, !writable("a"))
+
+	// Writes failing on a full disk degrade all the tenants, even above the minimum free disk ratio.
+	testutil.Assert(t, h.observe("b", errors.Wrap(syscall.ENOSPC, "write to WAL")))
+	testutil.Assert(t, !writable("c"))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.failures.WithLabelValues(string(StorageFailureDiskFull))))
+
+	// The writes of the degraded tenants are accepted again after the retry interval.
+	now = now.Add(time.Minute)
+	h.Check()
+	testutil.Assert(t, writable("a"))
+	testutil.Assert(t, writable("c"))
+	status = h.Status()
+	testutil.Assert(t, !status.Degraded)
+	testutil.Equals(t, 0, len(status.Faults))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(h.degraded.WithLabelValues(string(StorageFailureWALCorruption))))
+
+	// Without the free disk space, the writes are accepted again after the retry interval.
+	h.diskUsage = func(string) (uint64, uint64, error) { return 0, 0, errors.New("unsupported") }
+	testutil.Assert(t, h.observe("a", syscall.ENOSPC))
+	h.Check()
+	testutil.Assert(t, !writable("a"))
+	now = now.Add(time.Minute)
+	h.Check()
+	testutil.Assert(t, writable("a"))
+	testutil.Assert(t, h.Status().DiskFreeRatio == nil)
+
+	// A nil StorageHealth tracks nothing.
+	var nilHealth *StorageHealth
+	testutil.Assert(t, !nilHealth.observe("a", syscall.ENOSPC))
+	testutil.Ok(t, nilHealth.checkWritable("a"))
+	testutil.Equals(t, StorageHealthStatus{Faults: []StorageFault{}}, nilHealth.Status())
+}
+
+func TestWriterStorageHealth(t *testing.T) {
+	h, err := NewStorageHealth(log.NewNopLogger(), prometheus.NewRegistry(), "", StorageHealthOptions{RetryInterval: time.Hour})
+	testutil.Ok(t, err)
+
+	commitErr := func() error {
+		return errors.Wrap(&wlog.CorruptionErr{Segment: 1, Err: errors.New("unexpected checksum")}, "write to WAL")
+	}
+	app := &fakeAppendable{appender: newFakeAppender(nil, commitErr, nil)}
+	w := NewWriter(log.NewNopLogger(), newFakeTenantAppendable(app), nil, &WriterOptions{StorageHealth: h})
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "test"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	err = w.Write(context.Background(), "tenant-a", wreq)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Cause(err) != errNotReady)
+
+	// The next writes of the tenant are rejected as not ready, without reaching its storage.
+	app.appender = newFakeAppender(nil, nil, nil)
+	err = w.Write(context.Background(), "tenant-a", wreq)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, errNotReady, errors.Cause(err))
+	testutil.Equals(t, 0, len(app.appender.(*fakeAppender).samples))
+
+	testutil.Ok(t, w.Write(context.Background(), "tenant-b", wreq))
+}
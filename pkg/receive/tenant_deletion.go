@@ -0,0 +1,397 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/errutil"
+)
+
+// TenantDeletionsFilename is the name of the file in the data directory of receivers that tracks the deletions of
+// tenants.
+const TenantDeletionsFilename = "tenant-deletions.json"
+
+var (
+	// ErrTenantMarkedForDeletion is returned when writing to a tenant marked for deletion.
+	ErrTenantMarkedForDeletion = errors.New("tenant is marked for deletion")
+	// ErrTenantDeletionNotFound is returned when the tenant is not marked for deletion.
+	ErrTenantDeletionNotFound = errors.New("tenant is not marked for deletion")
+	// ErrTenantDeletionInProgress is returned when cancelling the deletion of a tenant which is being purged.
+	ErrTenantDeletionInProgress = errors.New("tenant is being purged")
+	// ErrTenantNotFound is returned when deleting the series of a tenant without local TSDB.
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+// TenantDeletionState is the state of the deletion of a tenant.
+type TenantDeletionState string
+
+const (
+	// TenantDeletionPending means the tenant is marked for deletion, and waits for the deletion delay to be purged.
+	// Its deletion can still be cancelled.
+	TenantDeletionPending TenantDeletionState = "pending"
+	// TenantDeletionPurging means the data of the tenant is being purged.
+	TenantDeletionPurging TenantDeletionState = "purging"
+	// TenantDeletionFailed means purging the data of the tenant failed. It is retried on the next purge.
+	TenantDeletionFailed TenantDeletionState = "failed"
+	// TenantDeletionDone means the data of the tenant was purged.
+	TenantDeletionDone TenantDeletionState = "done"
+)
+
+// TenantDeletionOptions are the options of the deletion of a tenant.
+type TenantDeletionOptions struct {
+	// ServeReads keeps serving the data of the tenant until it is purged.
+	ServeReads bool `json:"serve_reads"`
+	// DeleteBlocks marks the blocks of the tenant in the bucket for deletion once its local data is purged.
+	DeleteBlocks bool `json:"delete_blocks"`
+}
+
+// TenantDeletion tracks the deletion of a tenant.
+type TenantDeletion struct {
+	Tenant string              `json:"tenant"`
+	State  TenantDeletionState `json:"state"`
+	TenantDeletionOptions
+	MarkedAt   time.Time  `json:"marked_at"`
+	PurgeAt    time.Time  `json:"purge_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// MarkedBlocks is the number of blocks of the tenant marked for deletion in the bucket.
+	MarkedBlocks int    `json:"marked_blocks"`
+	Error        string `json:"error,omitempty"`
+}
+
+// TenantDeleter manages the deletion of tenants.
+type TenantDeleter interface {
+	// MarkTenantForDeletion marks the given tenant for deletion: its writes are rejected from now on, and its data is
+	// purged once the deletion delay elapsed. Marking a tenant already marked for deletion returns its deletion as is.
+	MarkTenantForDeletion(tenantID string, opts TenantDeletionOptions) (TenantDeletion, error)
+	// CancelTenantDeletion cancels the deletion of the given tenant, which accepts writes again. Cancelling a done
+	// deletion allows the tenant to write again, as a new tenant.
+	CancelTenantDeletion(tenantID string) error
+	// TenantDeletions returns the deletions of the given tenants.
+	// If no tenantIDs are provided, the deletions of all tenants are returned.
+	TenantDeletions(tenantIDs ...string) ([]TenantDeletion, error)
+	// DeleteTenantSeries deletes the samples within [mint, maxt] of the series of the given tenant matching the
+	// matchers, with tombstones: they are not served anymore, and are left out of the blocks cut from the head.
+	DeleteTenantSeries(ctx context.Context, tenantID string, mint, maxt int64, ms ...*labels.Matcher) error
+}
+
+// WithTenantDeletionDelay sets the delay after which the data of tenants marked for deletion is purged.
+func WithTenantDeletionDelay(delay time.Duration) MultiTSDBOption {
+	return func(mt *MultiTSDB) {
+		mt.tenantDeletionDelay = delay
+	}
+}
+
+func (t *MultiTSDB) MarkTenantForDeletion(tenantID string, opts TenantDeletionOptions) (TenantDeletion, error) {
+	if opts.DeleteBlocks && t.bucket == nil {
+		return TenantDeletion{}, errors.New("blocks can't be deleted, no bucket is configured")
+	}
+
+	t.deletionsMtx.Lock()
+	defer t.deletionsMtx.Unlock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		return TenantDeletion{}, err
+	}
+	if d, ok := t.deletions[tenantID]; ok {
+		return *d, nil
+	}
+
+	now := time.Now()
+	d := &TenantDeletion{
+		Tenant:                tenantID,
+		State:                 TenantDeletionPending,
+		TenantDeletionOptions: opts,
+		MarkedAt:              now,
+		PurgeAt:               now.Add(t.tenantDeletionDelay),
+	}
+	t.deletions[tenantID] = d
+	if err := t.saveTenantDeletionsLocked(); err != nil {
+		delete(t.deletions, tenantID)
+		return TenantDeletion{}, err
+	}
+	level.Info(t.logger).Log("msg", "tenant marked for deletion", "tenant", tenantID, "purge_at", d.PurgeAt)
+	return *d, nil
+}
+
+func (t *MultiTSDB) CancelTenantDeletion(tenantID string) error {
+	t.deletionsMtx.Lock()
+	defer t.deletionsMtx.Unlock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		return err
+	}
+	d, ok := t.deletions[tenantID]
+	if !ok {
+		return ErrTenantDeletionNotFound
+	}
+	if d.State == TenantDeletionPurging {
+		return ErrTenantDeletionInProgress
+	}
+
+	delete(t.deletions, tenantID)
+	if err := t.saveTenantDeletionsLocked(); err != nil {
+		t.deletions[tenantID] = d
+		return err
+	}
+	level.Info(t.logger).Log("msg", "tenant deletion cancelled", "tenant", tenantID, "state", d.State)
+	return nil
+}
+
+func (t *MultiTSDB) TenantDeletions(tenantIDs ...string) ([]TenantDeletion, error) {
+	t.deletionsMtx.Lock()
+	defer t.deletionsMtx.Unlock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		return nil, err
+	}
+
+	if len(tenantIDs) == 0 {
+		for tenantID := range t.deletions {
+			tenantIDs = append(tenantIDs, tenantID)
+		}
+	}
+	sort.Strings(tenantIDs)
+
+	res := make([]TenantDeletion, 0, len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		if d, ok := t.deletions[tenantID]; ok {
+			res = append(res, *d)
+		}
+	}
+	return res, nil
+}
+
+func (t *MultiTSDB) DeleteTenantSeries(ctx context.Context, tenantID string, mint, maxt int64, ms ...*labels.Matcher) error {
+	t.mtx.RLock()
+	tenant, ok := t.tenants[tenantID]
+	t.mtx.RUnlock()
+	if !ok {
+		return ErrTenantNotFound
+	}
+	db := tenant.readyStorage().Get()
+	if db == nil {
+		return ErrNotReady
+	}
+
+	if err := db.Delete(ctx, mint, maxt, ms...); err != nil {
+		return errors.Wrap(err, "delete series")
+	}
+	level.Info(t.logger).Log("msg", "deleted tenant series", "tenant", tenantID, "mint", mint, "maxt", maxt, "matchers", fmt.Sprint(ms))
+	return nil
+}
+
+// tenantDeletion returns the deletion of the given tenant, if it is marked for deletion.
+func (t *MultiTSDB) tenantDeletion(tenantID string) (*TenantDeletion, error) {
+	t.deletionsMtx.Lock()
+	defer t.deletionsMtx.Unlock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		return nil, err
+	}
+	return t.deletions[tenantID], nil
+}
+
+// tenantsWithoutReads returns the tenants marked for deletion whose data must not be served anymore.
+func (t *MultiTSDB) tenantsWithoutReads() map[string]struct{} {
+	t.deletionsMtx.Lock()
+	defer t.deletionsMtx.Unlock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		level.Error(t.logger).Log("msg", "failed to load tenant deletions", "err", err)
+		return nil
+	}
+
+	res := map[string]struct{}{}
+	for tenantID, d := range t.deletions {
+		if !d.ServeReads || d.State != TenantDeletionPending {
+			res[tenantID] = struct{}{}
+		}
+	}
+	return res
+}
+
+// PurgeDeletedTenants purges the data of the tenants marked for deletion for longer than the deletion delay: their
+// local TSDB is closed and removed and, if requested, their blocks are marked for deletion in the bucket. Deletions
+// which failed are retried.
+func (t *MultiTSDB) PurgeDeletedTenants(ctx context.Context) error {
+	now := time.Now()
+
+	t.deletionsMtx.Lock()
+	if err := t.loadTenantDeletionsLocked(); err != nil {
+		t.deletionsMtx.Unlock()
+		return err
+	}
+	var toPurge []TenantDeletion
+	for _, d := range t.deletions {
+		if d.State == TenantDeletionDone || (d.State == TenantDeletionPending && now.Before(d.PurgeAt)) {
+			continue
+		}
+		d.State = TenantDeletionPurging
+		toPurge = append(toPurge, *d)
+	}
+	if len(toPurge) == 0 {
+		t.deletionsMtx.Unlock()
+		return nil
+	}
+	err := t.saveTenantDeletionsLocked()
+	t.deletionsMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	merr := errutil.MultiError{}
+	for _, d := range toPurge {
+		logger := log.With(t.logger, "tenant", d.Tenant)
+		level.Info(logger).Log("msg", "purging tenant marked for deletion")
+
+		marked, err := t.purgeTenant(ctx, logger, d)
+
+		t.deletionsMtx.Lock()
+		cur := t.deletions[d.Tenant]
+		cur.MarkedBlocks = marked
+		if err != nil {
+			merr.Add(errors.Wrapf(err, "purge tenant %s", d.Tenant))
+			cur.State = TenantDeletionFailed
+			cur.Error = err.Error()
+		} else {
+			finishedAt := time.Now()
+			cur.State = TenantDeletionDone
+			cur.Error = ""
+			cur.FinishedAt = &finishedAt
+			level.Info(logger).Log("msg", "purged tenant marked for deletion", "marked_blocks", marked)
+		}
+		merr.Add(t.saveTenantDeletionsLocked())
+		t.deletionsMtx.Unlock()
+	}
+	return merr.Err()
+}
+
+// purgeTenant removes the local TSDB of the tenant and, if requested, marks its blocks for deletion in the bucket.
+// It returns the number of blocks of the tenant marked for deletion.
+func (t *MultiTSDB) purgeTenant(ctx context.Context, logger log.Logger, d TenantDeletion) (int, error) {
+	t.mtx.Lock()
+	tenant, ok := t.tenants[d.Tenant]
+	delete(t.tenants, d.Tenant)
+	t.mtx.Unlock()
+
+	if ok {
+		tenant.mtx.Lock()
+		db := tenant.tsdb
+		tenant.readyS.set(nil)
+		tenant.setComponents(nil, nil, nil, nil)
+		tenant.mtx.Unlock()
+
+		if db != nil {
+			if err := db.Close(); err != nil {
+				return 0, errors.Wrap(err, "close TSDB")
+			}
+		}
+	}
+	if err := os.RemoveAll(t.defaultTenantDataDir(d.Tenant)); err != nil {
+		return 0, errors.Wrap(err, "remove TSDB")
+	}
+
+	if !d.DeleteBlocks {
+		return 0, nil
+	}
+	return t.markTenantBlocksForDeletion(ctx, logger, d.Tenant)
+}
+
+// markTenantBlocksForDeletion marks the blocks of the bucket with the label of the given tenant for deletion, and
+// returns their number.
+func (t *MultiTSDB) markTenantBlocksForDeletion(ctx context.Context, logger log.Logger, tenantID string) (int, error) {
+	var ids []ulid.ULID
+	if err := t.bucket.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+		meta, err := block.DownloadMeta(ctx, logger, t.bucket, id)
+		if err != nil {
+			// Partial blocks are not owned by any tenant yet.
+			if t.bucket.IsObjNotFoundErr(errors.Cause(err)) {
+				return nil
+			}
+			return err
+		}
+		if meta.Thanos.Labels[t.tenantLabelName] == tenantID {
+			ids = append(ids, id)
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.Wrap(err, "list blocks")
+	}
+
+	for i, id := range ids {
+		// Blocks of the tenant may have been marked by other receivers already.
+		exists, err := t.bucket.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename))
+		if err != nil {
+			return i, errors.Wrapf(err, "check deletion mark of block %s", id)
+		}
+		if exists {
+			continue
+		}
+		if err := block.MarkForDeletion(ctx, logger, t.bucket, id, "tenant deleted", t.tenantBlocksMarkedForDeletion); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// loadTenantDeletionsLocked loads the deletions of tenants from the data directory, if they are not loaded yet.
+func (t *MultiTSDB) loadTenantDeletionsLocked() error {
+	if t.deletions != nil {
+		return nil
+	}
+
+	deletions := map[string]*TenantDeletion{}
+	b, err := os.ReadFile(filepath.Join(t.dataDir, TenantDeletionsFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "read tenant deletions")
+	}
+	if err == nil {
+		var ds []*TenantDeletion
+		if err := json.Unmarshal(b, &ds); err != nil {
+			return errors.Wrap(err, "unmarshal tenant deletions")
+		}
+		for _, d := range ds {
+			deletions[d.Tenant] = d
+		}
+	}
+	t.deletions = deletions
+	return nil
+}
+
+// saveTenantDeletionsLocked persists the deletions of tenants to the data directory.
+func (t *MultiTSDB) saveTenantDeletionsLocked() error {
+	ds := make([]*TenantDeletion, 0, len(t.deletions))
+	for _, d := range t.deletions {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Tenant < ds[j].Tenant })
+
+	b, err := json.Marshal(ds)
+	if err != nil {
+		return errors.Wrap(err, "marshal tenant deletions")
+	}
+	if err := os.MkdirAll(t.dataDir, 0750); err != nil {
+		return err
+	}
+	file := filepath.Join(t.dataDir, TenantDeletionsFilename)
+	if err := os.WriteFile(file+".tmp", b, 0600); err != nil {
+		return errors.Wrap(err, "write tenant deletions")
+	}
+	return errors.Wrap(os.Rename(file+".tmp", file), "rename tenant deletions")
+}
@@ -0,0 +1,276 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func uploadTenantBlockMeta(t *testing.T, bkt objstore.Bucket, id ulid.ULID, tenant string) {
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: id, Version: metadata.TSDBVersion1},
+		Thanos: metadata.Thanos{
+			Version: metadata.ThanosVersion1,
+			Labels:  map[string]string{"tenant_id": tenant},
+			Source:  metadata.ReceiveSource,
+		},
+	}
+	var buf bytes.Buffer
+	testutil.Ok(t, meta.Write(&buf))
+	testutil.Ok(t, bkt.Upload(context.Background(), path.Join(id.String(), block.MetaFilename), &buf))
+}
+
+func appendTenantSample(t *testing.T, m *MultiTSDB, tenant string) {
+	app, err := m.TenantAppendable(tenant)
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(100*time.Millisecond, ctx.Done(), func() error {
+		a, err := app.Appender(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := a.Append(0, labels.FromStrings("a", "1"), time.Now().UnixMilli(), 1); err != nil {
+			return err
+		}
+		return a.Commit()
+	}))
+}
+
+func TestMultiTSDB_TenantDeletion(t *testing.T) {
+	dir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+	fooBlock, barBlock := ulid.MustNew(1, nil), ulid.MustNew(2, nil)
+	uploadTenantBlockMeta(t, bkt, fooBlock, "foo")
+	uploadTenantBlockMeta(t, bkt, barBlock, "bar")
+
+	newMultiTSDB := func(delay time.Duration) *MultiTSDB {
+		return NewMultiTSDB(
+			dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+				MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+				MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+				RetentionDuration: (6 * time.Hour).Milliseconds(),
+				NoLockfile:        true,
+			},
+			labels.FromStrings("replica", "01"),
+			"tenant_id",
+			bkt,
+			false,
+			metadata.NoneFunc,
+			WithTenantDeletionDelay(delay),
+		)
+	}
+	m := newMultiTSDB(time.Hour)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	appendTenantSample(t, m, "foo")
+	appendTenantSample(t, m, "bar")
+	testutil.Equals(t, 2, len(m.TSDBLocalClients()))
+
+	d, err := m.MarkTenantForDeletion("foo", TenantDeletionOptions{ServeReads: true, DeleteBlocks: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, TenantDeletionPending, d.State)
+
+	_, err = m.TenantAppendable("foo")
+	testutil.Equals(t, ErrTenantMarkedForDeletion, err)
+	testutil.Equals(t, 2, len(m.TSDBLocalClients()))
+
+	// Not purged before the deletion delay elapsed.
+	testutil.Ok(t, m.PurgeDeletedTenants(context.Background()))
+	testutil.Equals(t, 2, len(m.TSDBLocalClients()))
+
+	testutil.Ok(t, m.CancelTenantDeletion("foo"))
+	appendTenantSample(t, m, "foo")
+	testutil.Equals(t, ErrTenantDeletionNotFound, m.CancelTenantDeletion("foo"))
+
+	// Purge right away.
+	m.tenantDeletionDelay = 0
+	_, err = m.MarkTenantForDeletion("foo", TenantDeletionOptions{DeleteBlocks: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(m.TSDBLocalClients()))
+
+	testutil.Ok(t, m.PurgeDeletedTenants(context.Background()))
+	deletions, err := m.TenantDeletions()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(deletions))
+	testutil.Equals(t, TenantDeletionDone, deletions[0].State)
+	testutil.Equals(t, 1, deletions[0].MarkedBlocks)
+	testutil.Assert(t, deletions[0].FinishedAt != nil)
+
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	testutil.Assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "bar"))
+	testutil.Ok(t, err)
+
+	exists, err := bkt.Exists(context.Background(), path.Join(fooBlock.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists)
+	exists, err = bkt.Exists(context.Background(), path.Join(barBlock.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists)
+
+	// Deletions are persisted.
+	deletions, err = newMultiTSDB(time.Hour).TenantDeletions("foo")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(deletions))
+	testutil.Equals(t, TenantDeletionDone, deletions[0].State)
+
+	_, err = m.TenantAppendable("foo")
+	testutil.Equals(t, ErrTenantMarkedForDeletion, err)
+
+	// Cancelling a done deletion lets the tenant write again.
+	testutil.Ok(t, m.CancelTenantDeletion("foo"))
+	appendTenantSample(t, m, "foo")
+}
+
+func TestMultiTSDB_DeleteTenantSeries(t *testing.T) {
+	m := NewMultiTSDB(
+		t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+			NoLockfile:        true,
+		},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	appendTenantSample(t, m, "foo")
+	appendTenantSample(t, m, "bar")
+
+	countSamples := func(tenant string) int {
+		m.mtx.RLock()
+		db := m.tenants[tenant].readyStorage().Get()
+		m.mtx.RUnlock()
+		q, err := db.Querier(math.MinInt64, math.MaxInt64)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+
+		var n int
+		ss := q.Select(context.Background(), false, nil, labels.MustNewMatcher(labels.MatchRegexp, "a", ".+"))
+		for ss.Next() {
+			it := ss.At().Iterator(nil)
+			for it.Next() != chunkenc.ValNone {
+				n++
+			}
+			testutil.Ok(t, it.Err())
+		}
+		testutil.Ok(t, ss.Err())
+		return n
+	}
+
+	ctx := context.Background()
+	testutil.Equals(t, ErrTenantNotFound, m.DeleteTenantSeries(ctx, "unknown", math.MinInt64, math.MaxInt64, labels.MustNewMatcher(labels.MatchEqual, "a", "1")))
+
+	// Deleting the samples of another time range keeps the series.
+	testutil.Ok(t, m.DeleteTenantSeries(ctx, "foo", 0, 1, labels.MustNewMatcher(labels.MatchEqual, "a", "1")))
+	testutil.Equals(t, 1, countSamples("foo"))
+
+	testutil.Ok(t, m.DeleteTenantSeries(ctx, "foo", math.MinInt64, math.MaxInt64, labels.MustNewMatcher(labels.MatchEqual, "a", "1")))
+	testutil.Equals(t, 0, countSamples("foo"))
+	testutil.Equals(t, 1, countSamples("bar"))
+}
+
+func TestHandler_TenantDeletionAPI(t *testing.T) {
+	m := NewMultiTSDB(
+		t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+			NoLockfile:        true,
+		},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantDeletionDelay(time.Hour),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	handlers, hashring, err := newTestHandlerHashring([]*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}, 1, AlgorithmHashmod)
+	testutil.Ok(t, err)
+	// The API is registered when creating the handler.
+	handlers[0].options.TenantDeleter = m
+	handlers[0].options.EnableTenantDeletionAPI = true
+	handlers[0].options.Tracer = opentracing.NoopTracer{}
+	h := NewHandler(nil, handlers[0].options)
+	h.peers = handlers[0].peers
+	h.Hashring(hashring)
+
+	do := func(method, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, http.NoBody)
+		testutil.Ok(t, err)
+		rec := httptest.NewRecorder()
+		h.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testutil.Equals(t, http.StatusNotFound, do(http.MethodGet, "/api/v1/admin/tenants/foo/deletion").Code)
+	testutil.Equals(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/admin/tenants/foo/deletion").Code)
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/admin/tenants/foo/deletion?serve_reads=maybe").Code)
+	// Blocks can't be deleted without a bucket.
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/admin/tenants/foo/deletion?delete_blocks=true").Code)
+
+	rec := do(http.MethodPost, "/api/v1/admin/tenants/foo/deletion?serve_reads=true")
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Assert(t, bytes.Contains(rec.Body.Bytes(), []byte(`"state":"pending"`)), rec.Body.String())
+	testutil.Assert(t, bytes.Contains(rec.Body.Bytes(), []byte(`"serve_reads":true`)), rec.Body.String())
+
+	testutil.Equals(t, http.StatusOK, do(http.MethodGet, "/api/v1/admin/tenants/foo/deletion").Code)
+	rec = do(http.MethodGet, "/api/v1/admin/tenant_deletions")
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Assert(t, bytes.Contains(rec.Body.Bytes(), []byte(`"tenant":"foo"`)), rec.Body.String())
+
+	// Writes of the tenant are rejected.
+	wreq := &prompb.WriteRequest{Timeseries: makeSeriesWithValues(1)}
+	rec, err = makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusForbidden, rec.Code)
+	rec, err = makeRequest(h, "bar", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	testutil.Equals(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/admin/tenants/foo/deletion").Code)
+	rec, err = makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	// Series deletion.
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/admin/tenants/foo/delete_series").Code)
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/admin/tenants/foo/delete_series?match[]=up&start=yesterday").Code)
+	rec = do(http.MethodPost, "/api/v1/admin/tenants/foo/delete_series?match[]=up")
+	testutil.Equals(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	appendTenantSample(t, m, "foo")
+	testutil.Equals(t, http.StatusNoContent, do(http.MethodPost, "/api/v1/admin/tenants/foo/delete_series?match[]={a=\"1\"}&start=0&end=2000000000").Code)
+}
@@ -0,0 +1,207 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWriteFailureExamples is the default number of the latest examples of failures kept per tenant and cause.
+const DefaultWriteFailureExamples = 5
+
+// WriteFailureCause is the cause of remote write failures reported to tenants.
+type WriteFailureCause string
+
+const (
+	// WriteFailureLimitExceeded is the cause of requests rejected by the limits of the tenant.
+	WriteFailureLimitExceeded WriteFailureCause = "limit_exceeded"
+	// WriteFailureLabelValidation is the cause of series dropped because of invalid labels.
+	WriteFailureLabelValidation WriteFailureCause = "label_validation"
+	// WriteFailureOutOfOrder is the cause of samples dropped because they are out of order, or too old.
+	WriteFailureOutOfOrder WriteFailureCause = "out_of_order"
+	// WriteFailureOutOfBounds is the cause of samples dropped because they are out of the bounds of the TSDB.
+	WriteFailureOutOfBounds WriteFailureCause = "out_of_bounds"
+	// WriteFailureConflict is the cause of samples dropped because a different value exists for their timestamp.
+	WriteFailureConflict WriteFailureCause = "conflict"
+	// WriteFailureHistogramsDisabled is the cause of native histograms dropped because they are disabled.
+	WriteFailureHistogramsDisabled WriteFailureCause = "native_histograms_disabled"
+	// WriteFailureSeriesChurnLimited is the cause of new series dropped because the tenant created series above its
+	// series churn limit.
+	WriteFailureSeriesChurnLimited WriteFailureCause = "series_churn_limited"
+)
+
+// WriteFailureExample is an example of a remote write failure.
+type WriteFailureExample struct {
+	// Series is the label set of the failed series, if the failure is specific to a series.
+	Series    string    `json:"series,omitempty"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WriteFailureReport reports the recent remote write failures of a tenant with the same cause.
+type WriteFailureReport struct {
+	Cause WriteFailureCause `json:"cause"`
+	// Requests is the number of write requests which failed with the cause.
+	Requests  int64                 `json:"requests"`
+	FirstSeen time.Time             `json:"firstSeen"`
+	LastSeen  time.Time             `json:"lastSeen"`
+	Examples  []WriteFailureExample `json:"examples"`
+}
+
+// TenantWriteFailures are the recent remote write failures of a tenant, by cause.
+type TenantWriteFailures struct {
+	Tenant   string               `json:"tenant"`
+	Failures []WriteFailureReport `json:"failures"`
+}
+
+// WriteFailures keeps track of the recent remote write failures of tenants, grouped by cause, with a few examples
+// of failed series, so that tenants can diagnose the issues of their clients.
+// Failures of a cause are forgotten once the cause was not seen for the given window.
+// A nil WriteFailures tracks nothing.
+type WriteFailures struct {
+	window      time.Duration
+	maxExamples int
+	now         func() time.Time
+
+	mtx     sync.Mutex
+	tenants map[string]map[WriteFailureCause]*WriteFailureReport
+}
+
+// NewWriteFailures returns a new WriteFailures, keeping failures for the given window and up to the given number
+// of the latest examples per cause.
+func NewWriteFailures(window time.Duration, maxExamples int) *WriteFailures {
+	return &WriteFailures{
+		window:      window,
+		maxExamples: maxExamples,
+		now:         time.Now,
+		tenants:     map[string]map[WriteFailureCause]*WriteFailureReport{},
+	}
+}
+
+// writeFailuresBatch collects the failures of a single write request, so that they are tracked at once.
+type writeFailuresBatch struct {
+	maxExamples int
+	examples    map[WriteFailureCause][]WriteFailureExample
+}
+
+func (f *WriteFailures) newBatch() *writeFailuresBatch {
+	if f == nil {
+		return nil
+	}
+	return &writeFailuresBatch{maxExamples: f.maxExamples, examples: map[WriteFailureCause][]WriteFailureExample{}}
+}
+
+// add adds a failure of the given series to the batch. The series is only stringified if it is kept as an example.
+func (b *writeFailuresBatch) add(cause WriteFailureCause, series interface{ String() string }, err error) {
+	if b == nil {
+		return
+	}
+	examples, ok := b.examples[cause]
+	if !ok {
+		examples = []WriteFailureExample{}
+	}
+	if len(examples) < b.maxExamples {
+		// Consecutive failures of the samples of a series are a single example.
+		if s := series.String(); len(examples) == 0 || examples[len(examples)-1].Series != s {
+			examples = append(examples, WriteFailureExample{Series: s, Error: err.Error()})
+		}
+	}
+	b.examples[cause] = examples
+}
+
+// Add tracks a failed write request of the tenant, not specific to any series.
+func (f *WriteFailures) Add(tenant string, cause WriteFailureCause, err error) {
+	if f == nil {
+		return
+	}
+	f.addBatch(tenant, &writeFailuresBatch{
+		examples: map[WriteFailureCause][]WriteFailureExample{cause: {{Error: err.Error()}}},
+	})
+}
+
+func (f *WriteFailures) addBatch(tenant string, b *writeFailuresBatch) {
+	if f == nil || len(b.examples) == 0 {
+		return
+	}
+	now := f.now()
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.expire(now)
+	causes, ok := f.tenants[tenant]
+	if !ok {
+		causes = map[WriteFailureCause]*WriteFailureReport{}
+		f.tenants[tenant] = causes
+	}
+	for cause, examples := range b.examples {
+		report, ok := causes[cause]
+		if !ok {
+			report = &WriteFailureReport{Cause: cause, FirstSeen: now}
+			causes[cause] = report
+		}
+		report.Requests++
+		report.LastSeen = now
+		for _, e := range examples {
+			e.Timestamp = now
+			report.Examples = append(report.Examples, e)
+		}
+		// Keep the latest examples only.
+		if n := len(report.Examples) - f.maxExamples; n > 0 {
+			report.Examples = append(report.Examples[:0:0], report.Examples[n:]...)
+		}
+	}
+}
+
+// expire forgets the failures which were not seen for the window.
+func (f *WriteFailures) expire(now time.Time) {
+	for tenant, causes := range f.tenants {
+		for cause, report := range causes {
+			if now.Sub(report.LastSeen) > f.window {
+				delete(causes, cause)
+			}
+		}
+		if len(causes) == 0 {
+			delete(f.tenants, tenant)
+		}
+	}
+}
+
+// TenantFailures returns the recent failures of the given tenants, sorted by tenant and cause. If no tenant
+// is given, the failures of all tenants are returned.
+func (f *WriteFailures) TenantFailures(tenants ...string) []TenantWriteFailures {
+	if f == nil {
+		return nil
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.expire(f.now())
+	if len(tenants) == 0 {
+		for tenant := range f.tenants {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+	}
+
+	result := make([]TenantWriteFailures, 0, len(tenants))
+	for _, tenant := range tenants {
+		causes, ok := f.tenants[tenant]
+		if !ok {
+			continue
+		}
+		tf := TenantWriteFailures{Tenant: tenant, Failures: make([]WriteFailureReport, 0, len(causes))}
+		for _, report := range causes {
+			r := *report
+			r.Examples = append([]WriteFailureExample(nil), report.Examples...)
+			tf.Failures = append(tf.Failures, r)
+		}
+		sort.Slice(tf.Failures, func(i, j int) bool { return tf.Failures[i].Cause < tf.Failures[j].Cause })
+		result = append(result, tf)
+	}
+	return result
+}
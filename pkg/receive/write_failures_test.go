@@ -0,0 +1,164 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestWriteFailures(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewWriteFailures(time.Minute, 2)
+	f.now = func() time.Time { return now }
+
+	f.Add("b", WriteFailureLimitExceeded, errors.New("too many samples"))
+	for i, series := range []string{"a", "a", "b", "c"} {
+		b := f.newBatch()
+		b.add(WriteFailureOutOfOrder, labels.FromStrings("series", series), storage.ErrOutOfOrderSample)
+		if i == 0 {
+			// Failures of another cause in the same request.
+			b.add(WriteFailureConflict, labels.FromStrings("series", series), storage.ErrDuplicateSampleForTimestamp)
+		}
+		f.addBatch("a", b)
+		now = now.Add(10 * time.Second)
+	}
+
+	testutil.Equals(t, []TenantWriteFailures{
+		{Tenant: "a", Failures: []WriteFailureReport{
+			{
+				Cause:     WriteFailureConflict,
+				Requests:  1,
+				FirstSeen: time.Unix(1000, 0),
+				LastSeen:  time.Unix(1000, 0),
+				Examples: []WriteFailureExample{
+					{Series: `{series="a"}`, Error: storage.ErrDuplicateSampleForTimestamp.Error(), Timestamp: time.Unix(1000, 0)},
+				},
+			},
+			{
+				Cause:     WriteFailureOutOfOrder,
+				Requests:  4,
+				FirstSeen: time.Unix(1000, 0),
+				LastSeen:  time.Unix(1030, 0),
+				// Only the latest examples are kept.
+				Examples: []WriteFailureExample{
+					{Series: `{series="b"}`, Error: storage.ErrOutOfOrderSample.Error(), Timestamp: time.Unix(1020, 0)},
+					{Series: `{series="c"}`, Error: storage.ErrOutOfOrderSample.Error(), Timestamp: time.Unix(1030, 0)},
+				},
+			},
+		}},
+		{Tenant: "b", Failures: []WriteFailureReport{
+			{
+				Cause:     WriteFailureLimitExceeded,
+				Requests:  1,
+				FirstSeen: time.Unix(1000, 0),
+				LastSeen:  time.Unix(1000, 0),
+				Examples:  []WriteFailureExample{{Error: "too many samples", Timestamp: time.Unix(1000, 0)}},
+			},
+		}},
+	}, f.TenantFailures())
+	testutil.Equals(t, []TenantWriteFailures{}, f.TenantFailures("c"))
+
+	// Causes not seen for the window are forgotten.
+	now = time.Unix(1061, 0)
+	failures := f.TenantFailures()
+	testutil.Equals(t, 1, len(failures))
+	testutil.Equals(t, "a", failures[0].Tenant)
+	testutil.Equals(t, 1, len(failures[0].Failures))
+	testutil.Equals(t, WriteFailureOutOfOrder, failures[0].Failures[0].Cause)
+
+	// A nil WriteFailures tracks nothing.
+	var nilFailures *WriteFailures
+	nilFailures.Add("a", WriteFailureLimitExceeded, errors.New("too many samples"))
+	nilFailures.newBatch().add(WriteFailureOutOfOrder, labels.FromStrings("series", "a"), storage.ErrOutOfOrderSample)
+	nilFailures.addBatch("a", nilFailures.newBatch())
+	testutil.Equals(t, 0, len(nilFailures.TenantFailures()))
+}
+
+func TestWriterWriteFailures(t *testing.T) {
+	failures := NewWriteFailures(time.Hour, DefaultWriteFailureExamples)
+	app := &fakeAppendable{appender: newFakeAppender(func() error { return storage.ErrOutOfOrderSample }, nil, nil)}
+	w := NewWriter(log.NewNopLogger(), newFakeTenantAppendable(app), nil, &WriterOptions{Failures: failures})
+
+	err := w.Write(context.Background(), "tenant-a", &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "test"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}},
+			},
+			{
+				Labels:  []labelpb.ZLabel{{Name: "b", Value: "1"}, {Name: "a", Value: "1"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	})
+	testutil.NotOk(t, err)
+
+	tenantFailures := failures.TenantFailures("tenant-a")
+	testutil.Equals(t, 1, len(tenantFailures))
+	var causes []WriteFailureCause
+	for _, r := range tenantFailures[0].Failures {
+		causes = append(causes, r.Cause)
+		testutil.Equals(t, int64(1), r.Requests)
+		testutil.Equals(t, 1, len(r.Examples))
+	}
+	testutil.Equals(t, []WriteFailureCause{WriteFailureLabelValidation, WriteFailureOutOfOrder}, causes)
+	testutil.Equals(t, `{__name__="test"}`, tenantFailures[0].Failures[1].Examples[0].Series)
+}
+
+func TestHandlerGetWriteFailures(t *testing.T) {
+	failures := NewWriteFailures(time.Hour, DefaultWriteFailureExamples)
+	failures.Add("default-tenant", WriteFailureLimitExceeded, errors.New("too many samples"))
+	failures.Add("tenant-a", WriteFailureLimitExceeded, errors.New("too many samples"))
+	h := &Handler{options: &Options{
+		TenantHeader:    tenancy.DefaultTenantHeader,
+		DefaultTenantID: "default-tenant",
+		WriteFailures:   failures,
+	}}
+
+	get := func(tenant, query string) ([]TenantWriteFailures, error) {
+		r := httptest.NewRequest("GET", "/api/v1/status/write_failures"+query, nil)
+		if tenant != "" {
+			r.Header.Set(tenancy.DefaultTenantHeader, tenant)
+		}
+		data, _, apiErr, _ := h.getWriteFailures(r)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		return data.([]TenantWriteFailures), nil
+	}
+
+	res, err := get("tenant-a", "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(res))
+	testutil.Equals(t, "tenant-a", res[0].Tenant)
+
+	res, err = get("", "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(res))
+	testutil.Equals(t, "default-tenant", res[0].Tenant)
+
+	res, err = get("", "?all_tenants=true")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(res))
+
+	res, err = get("tenant-b", "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []TenantWriteFailures{}, res)
+
+	_, err = get("tenant-a", "?all_tenants=true")
+	testutil.NotOk(t, err)
+}
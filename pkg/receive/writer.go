@@ -10,6 +10,8 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/histogram"
@@ -53,15 +55,70 @@ func (ra *ReceiveAppender) Append(ref storage.SeriesRef, lset labels.Labels, t i
 type WriterOptions struct {
 	Intern                   bool
 	TooFarInFutureTimeWindow int64 // Unit: nanoseconds
+	// DelayedSampleThreshold is the sample age, at ingestion time, above which samples are counted as delayed.
+	// Zero disables counting delayed samples.
+	DelayedSampleThreshold time.Duration
+	// Failures tracks the recent failures of series and samples of tenants. Nil disables tracking.
+	Failures *WriteFailures
+	// StorageHealth rejects the writes of the tenants whose storage failed. Nil disables the degraded mode.
+	StorageHealth *StorageHealth
+	// SeriesChurn counts the series created in the heads of tenants by metric name. Nil disables counting.
+	SeriesChurn *SeriesChurn
+	// Limiter refuses the new series of the tenants above their series churn limit. Nil disables the limit.
+	Limiter *Limiter
+}
+
+type writerMetrics struct {
+	sampleAge      *prometheus.HistogramVec
+	delayedSamples *prometheus.CounterVec
+	rejectedSeries *prometheus.CounterVec
+}
+
+func newWriterMetrics(reg prometheus.Registerer) *writerMetrics {
+	return &writerMetrics{
+		sampleAge: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "sample_age_seconds",
+			Help:      "The difference between ingestion time and timestamp of ingested samples.",
+			Buckets:   []float64{1, 5, 10, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600},
+		}, []string{"tenant"}),
+		delayedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "delayed_samples_total",
+			Help:      "The number of ingested samples older than the delayed sample threshold at ingestion time.",
+		}, []string{"tenant"}),
+		rejectedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "thanos",
+			Subsystem: "receive",
+			Name:      "invalid_labels_series_total",
+			Help:      "The number of series rejected because of their invalid labels.",
+		}, []string{"tenant", "reason"}),
+	}
+}
+
+// invalidLabelsReason returns the reason label of the metrics of the series with labels invalid with the given error.
+func invalidLabelsReason(err error) string {
+	switch err {
+	case labelpb.ErrOutOfOrderLabels:
+		return "out_of_order"
+	case labelpb.ErrDuplicateLabels:
+		return "duplicate"
+	case labelpb.ErrEmptyLabels:
+		return "empty"
+	}
+	return "other"
 }
 
 type Writer struct {
 	logger    log.Logger
 	multiTSDB TenantStorage
 	opts      *WriterOptions
+	metrics   *writerMetrics
 }
 
-func NewWriter(logger log.Logger, multiTSDB TenantStorage, opts *WriterOptions) *Writer {
+func NewWriter(logger log.Logger, multiTSDB TenantStorage, reg prometheus.Registerer, opts *WriterOptions) *Writer {
 	if opts == nil {
 		opts = &WriterOptions{}
 	}
@@ -69,6 +126,46 @@ func NewWriter(logger log.Logger, multiTSDB TenantStorage, opts *WriterOptions)
 		logger:    logger,
 		multiTSDB: multiTSDB,
 		opts:      opts,
+		metrics:   newWriterMetrics(reg),
+	}
+}
+
+// sampleAgeTracker tracks the age of samples ingested for a single tenant at a fixed point in time. Ages are only
+// recorded once the samples were committed.
+type sampleAgeTracker struct {
+	now            int64   // Unit: milliseconds
+	threshold      int64   // Unit: milliseconds
+	ages           []int64 // Unit: milliseconds
+	sampleAge      prometheus.Observer
+	delayedSamples prometheus.Counter
+}
+
+func (r *Writer) newSampleAgeTracker(tenantID string) *sampleAgeTracker {
+	return &sampleAgeTracker{
+		now:            time.Now().UnixMilli(),
+		threshold:      r.opts.DelayedSampleThreshold.Milliseconds(),
+		sampleAge:      r.metrics.sampleAge.WithLabelValues(tenantID),
+		delayedSamples: r.metrics.delayedSamples.WithLabelValues(tenantID),
+	}
+}
+
+// add adds the age of an appended sample with the given timestamp.
+func (t *sampleAgeTracker) add(ts int64) {
+	age := t.now - ts
+	if age < 0 {
+		// Samples from the future, e.g. due to clock skew of the client, are treated as fresh.
+		age = 0
+	}
+	t.ages = append(t.ages, age)
+}
+
+// record records the ages of the appended samples, once they were committed.
+func (t *sampleAgeTracker) record() {
+	for _, age := range t.ages {
+		t.sampleAge.Observe(float64(age) / 1e3)
+		if t.threshold > 0 && age > t.threshold {
+			t.delayedSamples.Inc()
+		}
 	}
 }
 
@@ -80,16 +177,24 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		numLabelsDuplicates = 0
 		numLabelsEmpty      = 0
 
+		numSeriesChurnLimited = 0
+
 		numSamplesOutOfOrder  = 0
 		numSamplesDuplicates  = 0
 		numSamplesOutOfBounds = 0
 		numSamplesTooOld      = 0
 
+		numHistogramsDisabled = 0
+
 		numExemplarsOutOfOrder  = 0
 		numExemplarsDuplicate   = 0
 		numExemplarsLabelLength = 0
 	)
 
+	if err := r.opts.StorageHealth.checkWritable(tenantID); err != nil {
+		return err
+	}
+
 	s, err := r.multiTSDB.TenantAppendable(tenantID)
 	if err != nil {
 		return errors.Wrap(err, "get tenant appendable")
@@ -100,6 +205,7 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		return err
 	}
 	if err != nil {
+		r.opts.StorageHealth.observe(tenantID, err)
 		return errors.Wrap(err, "get appender")
 	}
 	getRef := app.(storage.GetRef)
@@ -112,11 +218,16 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		tooFarInFuture: r.opts.TooFarInFutureTimeWindow,
 		Appender:       app,
 	}
+	ageTracker := r.newSampleAgeTracker(tenantID)
+	churnLimiter := r.opts.Limiter.SeriesChurnLimiter()
+	failures := r.opts.Failures.newBatch()
 	for _, t := range wreq.Timeseries {
 		// Check if time series labels are valid. If not, skip the time series
 		// and report the error.
 		if err := labelpb.ValidateLabels(t.Labels); err != nil {
 			lset := &labelpb.ZLabelSet{Labels: t.Labels}
+			failures.add(WriteFailureLabelValidation, lset, err)
+			r.metrics.rejectedSeries.WithLabelValues(tenantID, invalidLabelsReason(err)).Inc()
 			switch err {
 			case labelpb.ErrOutOfOrderLabels:
 				numLabelsOutOfOrder++
@@ -138,7 +249,14 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 
 		// Check if the TSDB has cached reference for those labels.
 		ref, lset = getRef.GetRef(lset, lset.Hash())
-		if ref == 0 {
+		newSeries := ref == 0
+		if newSeries && !churnLimiter.AllowNewSeries(tenantID) {
+			numSeriesChurnLimited++
+			failures.add(WriteFailureSeriesChurnLimited, lset, errSeriesChurnLimited)
+			level.Debug(tLogger).Log("msg", "New series above the series churn limit", "lset", lset)
+			continue
+		}
+		if newSeries {
 			// If not, copy labels, as TSDB will hold those strings long term. Given no
 			// copy unmarshal we don't want to keep memory for whole protobuf, only for labels.
 			labelpb.ReAllocZLabelsStrings(&t.Labels, r.opts.Intern)
@@ -147,22 +265,34 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 
 		// Append as many valid samples as possible, but keep track of the errors.
 		for _, s := range t.Samples {
-			ref, err = app.Append(ref, lset, s.Timestamp, s.Value)
+			var sref storage.SeriesRef
+			sref, err = app.Append(ref, lset, s.Timestamp, s.Value)
+			// Failed appends return no reference, although the series may exist.
+			if sref != 0 {
+				ref = sref
+			}
 			switch err {
+			case nil:
+				ageTracker.add(s.Timestamp)
 			case storage.ErrOutOfOrderSample:
 				numSamplesOutOfOrder++
+				failures.add(WriteFailureOutOfOrder, lset, err)
 				level.Debug(tLogger).Log("msg", "Out of order sample", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			case storage.ErrDuplicateSampleForTimestamp:
 				numSamplesDuplicates++
+				failures.add(WriteFailureConflict, lset, err)
 				level.Debug(tLogger).Log("msg", "Duplicate sample for timestamp", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			case storage.ErrOutOfBounds:
 				numSamplesOutOfBounds++
+				failures.add(WriteFailureOutOfBounds, lset, err)
 				level.Debug(tLogger).Log("msg", "Out of bounds metric", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			case storage.ErrTooOldSample:
 				numSamplesTooOld++
+				failures.add(WriteFailureOutOfOrder, lset, err)
 				level.Debug(tLogger).Log("msg", "Sample is too old", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			default:
 				if err != nil {
+					r.opts.StorageHealth.observe(tenantID, err)
 					level.Debug(tLogger).Log("msg", "Error ingesting sample", "err", err)
 				}
 			}
@@ -180,29 +310,48 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 				h = prompb.HistogramProtoToHistogram(hp)
 			}
 
-			ref, err = app.AppendHistogram(ref, lset, hp.Timestamp, h, fh)
+			var sref storage.SeriesRef
+			sref, err = app.AppendHistogram(ref, lset, hp.Timestamp, h, fh)
+			if sref != 0 {
+				ref = sref
+			}
 			switch err {
+			case nil:
+				ageTracker.add(hp.Timestamp)
 			case storage.ErrOutOfOrderSample:
 				numSamplesOutOfOrder++
+				failures.add(WriteFailureOutOfOrder, lset, err)
 				level.Debug(tLogger).Log("msg", "Out of order histogram", "lset", lset, "timestamp", hp.Timestamp)
 			case storage.ErrDuplicateSampleForTimestamp:
 				numSamplesDuplicates++
+				failures.add(WriteFailureConflict, lset, err)
 				level.Debug(tLogger).Log("msg", "Duplicate histogram for timestamp", "lset", lset, "timestamp", hp.Timestamp)
 			case storage.ErrOutOfBounds:
 				numSamplesOutOfBounds++
+				failures.add(WriteFailureOutOfBounds, lset, err)
 				level.Debug(tLogger).Log("msg", "Out of bounds metric", "lset", lset, "timestamp", hp.Timestamp)
 			case storage.ErrTooOldSample:
 				numSamplesTooOld++
+				failures.add(WriteFailureOutOfOrder, lset, err)
 				level.Debug(tLogger).Log("msg", "Histogram is too old", "lset", lset, "timestamp", hp.Timestamp)
+			case storage.ErrNativeHistogramsDisabled:
+				numHistogramsDisabled++
+				failures.add(WriteFailureHistogramsDisabled, lset, err)
+				level.Debug(tLogger).Log("msg", "Native histograms are disabled", "lset", lset, "timestamp", hp.Timestamp)
 			default:
 				if err != nil {
+					r.opts.StorageHealth.observe(tenantID, err)
 					level.Debug(tLogger).Log("msg", "Error ingesting histogram", "err", err)
 				}
 			}
 		}
+		if newSeries && ref != 0 {
+			r.opts.SeriesChurn.observe(tenantID, lset.Get(labels.MetricName))
+		}
 
 		// Current implemetation of app.AppendExemplar doesn't create a new series, so it must be already present.
-		// We drop the exemplars in case the series doesn't exist.
+		// We drop the exemplars in case the series doesn't exist. Exemplars sent without samples, like Prometheus
+		// does, or along samples which were all rejected, are ingested as long as their series exists.
 		if ref != 0 && len(t.Exemplars) > 0 {
 			for _, ex := range t.Exemplars {
 				exLset := labelpb.ZLabelsToPromLabels(ex.Labels)
@@ -217,12 +366,15 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 					switch err {
 					case storage.ErrOutOfOrderExemplar:
 						numExemplarsOutOfOrder++
+						failures.add(WriteFailureOutOfOrder, lset, err)
 						level.Debug(exLogger).Log("msg", "Out of order exemplar")
 					case storage.ErrDuplicateExemplar:
 						numExemplarsDuplicate++
+						failures.add(WriteFailureConflict, lset, err)
 						level.Debug(exLogger).Log("msg", "Duplicate exemplar")
 					case storage.ErrExemplarLabelLength:
 						numExemplarsLabelLength++
+						failures.add(WriteFailureLabelValidation, lset, err)
 						level.Debug(exLogger).Log("msg", "Label length for exemplar exceeds max limit", "limit", exemplar.ExemplarMaxLabelSetLength)
 					default:
 						level.Debug(exLogger).Log("msg", "Error ingesting exemplar", "err", err)
@@ -244,6 +396,10 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		level.Info(tLogger).Log("msg", "Error on series with empty label name or value", "numDropped", numLabelsEmpty)
 		errs.Add(errors.Wrapf(labelpb.ErrEmptyLabels, "add %d series", numLabelsEmpty))
 	}
+	if numSeriesChurnLimited > 0 {
+		level.Info(tLogger).Log("msg", "Error on creating new series above the series churn limit", "numDropped", numSeriesChurnLimited)
+		errs.Add(errors.Wrapf(errSeriesChurnLimited, "add %d series", numSeriesChurnLimited))
+	}
 
 	if numSamplesOutOfOrder > 0 {
 		level.Info(tLogger).Log("msg", "Error on ingesting out-of-order samples", "numDropped", numSamplesOutOfOrder)
@@ -262,6 +418,11 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		errs.Add(errors.Wrapf(storage.ErrTooOldSample, "add %d samples", numSamplesTooOld))
 	}
 
+	if numHistogramsDisabled > 0 {
+		level.Info(tLogger).Log("msg", "Error on ingesting native histograms while they are disabled, enable them with --tsdb.enable-native-histograms", "numDropped", numHistogramsDisabled)
+		errs.Add(errors.Wrapf(storage.ErrNativeHistogramsDisabled, "add %d histograms", numHistogramsDisabled))
+	}
+
 	if numExemplarsOutOfOrder > 0 {
 		level.Info(tLogger).Log("msg", "Error on ingesting out-of-order exemplars", "numDropped", numExemplarsOutOfOrder)
 		errs.Add(errors.Wrapf(storage.ErrOutOfOrderExemplar, "add %d exemplars", numExemplarsOutOfOrder))
@@ -274,9 +435,13 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		level.Info(tLogger).Log("msg", "Error on ingesting exemplars with label length exceeding maximum limit", "numDropped", numExemplarsLabelLength)
 		errs.Add(errors.Wrapf(storage.ErrExemplarLabelLength, "add %d exemplars", numExemplarsLabelLength))
 	}
+	r.opts.Failures.addBatch(tenantID, failures)
 
 	if err := app.Commit(); err != nil {
+		r.opts.StorageHealth.observe(tenantID, err)
 		errs.Add(errors.Wrap(err, "commit samples"))
+		return errs.ErrOrNil()
 	}
+	ageTracker.record()
 	return errs.ErrOrNil()
 }
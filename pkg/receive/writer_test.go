@@ -14,6 +14,8 @@ import (
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
@@ -22,6 +24,8 @@ import (
 	"github.com/prometheus/prometheus/tsdb/tsdbutil"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
@@ -37,6 +41,8 @@ func TestWriter(t *testing.T) {
 		expectedIngested []prompb.TimeSeries
 		maxExemplars     int64
 		opts             *WriterOptions
+		// disableNativeHistograms disables the ingestion of native histograms by the TSDB.
+		disableNativeHistograms bool
 	}{
 		"should error out on series with no labels": {
 			reqs: []*prompb.WriteRequest{
@@ -323,6 +329,33 @@ func TestWriter(t *testing.T) {
 				},
 			},
 		},
+		"should error out on histograms when native histograms are disabled": {
+			reqs: []*prompb.WriteRequest{
+				{
+					Timeseries: []prompb.TimeSeries{
+						{
+							Labels:  append(lbls, labelpb.ZLabel{Name: "a", Value: "1"}),
+							Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+						},
+						{
+							Labels: append(lbls, labelpb.ZLabel{Name: "a", Value: "2"}),
+							Histograms: []prompb.Histogram{
+								prompb.HistogramToHistogramProto(10, tsdbutil.GenerateTestHistogram(0)),
+								prompb.FloatHistogramToHistogramProto(20, tsdbutil.GenerateTestFloatHistogram(1)),
+							},
+						},
+					},
+				},
+			},
+			expectedErr: errors.Wrapf(storage.ErrNativeHistogramsDisabled, "add 2 histograms"),
+			expectedIngested: []prompb.TimeSeries{
+				{
+					Labels:  append(lbls, labelpb.ZLabel{Name: "a", Value: "1"}),
+					Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+				},
+			},
+			disableNativeHistograms: true,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -337,7 +370,7 @@ func TestWriter(t *testing.T) {
 				NoLockfile:             true,
 				MaxExemplars:           testData.maxExemplars,
 				EnableExemplarStorage:  true,
-				EnableNativeHistograms: true,
+				EnableNativeHistograms: !testData.disableNativeHistograms,
 			},
 				labels.FromStrings("replica", "01"),
 				"tenant_id",
@@ -361,7 +394,7 @@ func TestWriter(t *testing.T) {
 				return err
 			}))
 
-			w := NewWriter(logger, m, testData.opts)
+			w := NewWriter(logger, m, nil, testData.opts)
 
 			for idx, req := range testData.reqs {
 				err = w.Write(context.Background(), tenancy.DefaultTenant, req)
@@ -390,6 +423,65 @@ func TestWriter(t *testing.T) {
 	}
 }
 
+func TestWriterSampleAgeMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	w := NewWriter(log.NewNopLogger(), newFakeTenantAppendable(app), reg, &WriterOptions{
+		DelayedSampleThreshold: 5 * time.Minute,
+	})
+
+	now := time.Now()
+	testutil.Ok(t, w.Write(context.Background(), "tenant-a", &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []labelpb.ZLabel{{Name: "__name__", Value: "test"}},
+				Samples: []prompb.Sample{
+					{Value: 1, Timestamp: now.Add(-10 * time.Minute).UnixMilli()},
+					{Value: 2, Timestamp: now.Add(-time.Minute).UnixMilli()},
+					// Samples from the future are observed as fresh.
+					{Value: 3, Timestamp: now.Add(time.Minute).UnixMilli()},
+				},
+			},
+		},
+	}))
+
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_receive_delayed_samples_total The number of ingested samples older than the delayed sample threshold at ingestion time.
+# TYPE thanos_receive_delayed_samples_total counter
+thanos_receive_delayed_samples_total{tenant="tenant-a"} 1
+`), "thanos_receive_delayed_samples_total"))
+
+	m := &dto.Metric{}
+	testutil.Ok(t, w.metrics.sampleAge.WithLabelValues("tenant-a").(prometheus.Histogram).Write(m))
+	testutil.Equals(t, uint64(3), m.GetHistogram().GetSampleCount())
+	cumulative := map[float64]uint64{}
+	for _, b := range m.GetHistogram().GetBucket() {
+		cumulative[b.GetUpperBound()] = b.GetCumulativeCount()
+	}
+	testutil.Equals(t, uint64(1), cumulative[1])
+	testutil.Equals(t, uint64(2), cumulative[120])
+	testutil.Equals(t, uint64(3), cumulative[1800])
+
+	// The samples of failed commits are not ingested, their age is not recorded.
+	app.appender = newFakeAppender(nil, func() error { return errors.New("commit failed") }, nil)
+	testutil.NotOk(t, w.Write(context.Background(), "tenant-a", &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "test"}},
+				Samples: []prompb.Sample{{Value: 4, Timestamp: now.Add(-10 * time.Minute).UnixMilli()}},
+			},
+		},
+	}))
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_receive_delayed_samples_total The number of ingested samples older than the delayed sample threshold at ingestion time.
+# TYPE thanos_receive_delayed_samples_total counter
+thanos_receive_delayed_samples_total{tenant="tenant-a"} 1
+`), "thanos_receive_delayed_samples_total"))
+	m = &dto.Metric{}
+	testutil.Ok(t, w.metrics.sampleAge.WithLabelValues("tenant-a").(prometheus.Histogram).Write(m))
+	testutil.Equals(t, uint64(3), m.GetHistogram().GetSampleCount())
+}
+
 func BenchmarkWriterTimeSeriesWithSingleLabel_10(b *testing.B)   { benchmarkWriter(b, 1, 10, false) }
 func BenchmarkWriterTimeSeriesWithSingleLabel_100(b *testing.B)  { benchmarkWriter(b, 1, 100, false) }
 func BenchmarkWriterTimeSeriesWithSingleLabel_1000(b *testing.B) { benchmarkWriter(b, 1, 1000, false) }
@@ -460,7 +552,7 @@ func benchmarkWriter(b *testing.B, labelsNum int, seriesNum int, generateHistogr
 	}
 
 	b.Run("without interning", func(b *testing.B) {
-		w := NewWriter(logger, m, &WriterOptions{Intern: false})
+		w := NewWriter(logger, m, nil, &WriterOptions{Intern: false})
 
 		b.ReportAllocs()
 		b.ResetTimer()
@@ -471,7 +563,7 @@ func benchmarkWriter(b *testing.B, labelsNum int, seriesNum int, generateHistogr
 	})
 
 	b.Run("with interning", func(b *testing.B) {
-		w := NewWriter(logger, m, &WriterOptions{Intern: true})
+		w := NewWriter(logger, m, nil, &WriterOptions{Intern: true})
 
 		b.ReportAllocs()
 		b.ResetTimer()
@@ -512,3 +604,59 @@ func generateLabelsAndSeries(numLabels int, numSeries int, generateHistograms bo
 
 	return ts
 }
+
+func TestWriterExemplars(t *testing.T) {
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:      (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:      (2 * time.Hour).Milliseconds(),
+		RetentionDuration:     (6 * time.Hour).Milliseconds(),
+		NoLockfile:            true,
+		MaxExemplars:          10,
+		EnableExemplarStorage: true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	t.Cleanup(func() { testutil.Ok(t, m.Close()) })
+	testutil.Ok(t, m.Flush())
+	testutil.Ok(t, m.Open())
+
+	w := NewWriter(log.NewNopLogger(), m, nil, &WriterOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lbls := []labelpb.ZLabel{{Name: "__name__", Value: "requests_total"}}
+	exemplarAt := func(ts int64) prompb.Exemplar {
+		return prompb.Exemplar{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: fmt.Sprint(ts)}}, Value: 1, Timestamp: ts}
+	}
+	testutil.Ok(t, runutil.Retry(100*time.Millisecond, ctx.Done(), func() error {
+		// Like Prometheus, the exemplars are sent without samples, after the samples of their series.
+		return w.Write(ctx, "tenant-a", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+			{Labels: lbls, Samples: []prompb.Sample{{Value: 1, Timestamp: 20}}},
+			{Labels: lbls, Exemplars: []prompb.Exemplar{exemplarAt(10)}},
+		}})
+	}))
+	// The exemplars sent along samples which are all rejected are ingested.
+	err := w.Write(ctx, "tenant-a", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{Labels: lbls, Samples: []prompb.Sample{{Value: 1, Timestamp: 5}}, Exemplars: []prompb.Exemplar{exemplarAt(15)}},
+	}})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, storage.ErrOutOfOrderSample, errors.Cause(err.(*writeErrors).errs[0]))
+
+	srv := newExemplarsServer(ctx)
+	testutil.Ok(t, exemplars.NewMultiTSDB(m.TSDBExemplars).Exemplars(&exemplarspb.ExemplarsRequest{
+		Query: `requests_total{tenant_id="tenant-a"}`,
+		Start: 0,
+		End:   100,
+	}, srv))
+	testutil.Equals(t, 1, len(srv.Data))
+	testutil.Equals(t, `{__name__="requests_total", replica="01", tenant_id="tenant-a"}`, srv.Data[0].SeriesLabels.PromLabels().String())
+	var ts []int64
+	for _, e := range srv.Data[0].Exemplars {
+		ts = append(ts, e.Ts)
+	}
+	testutil.Equals(t, []int64{10, 15}, ts)
+}
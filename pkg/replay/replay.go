@@ -0,0 +1,324 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"golang.org/x/time/rate"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// Config configures the replay of blocks into a receive hashring.
+type Config struct {
+	// URL is the remote write endpoint of the receive hashring.
+	URL string
+	// Timeout is the timeout of a single remote write request.
+	Timeout time.Duration
+	// MaxRetries is the number of times a remote write request failing with a recoverable error is retried.
+	MaxRetries int
+
+	// TenantHeader is the HTTP header the tenant of the replayed samples is sent with.
+	TenantHeader string
+	// TenantLabel is the external label holding the tenant of a block.
+	TenantLabel string
+	// DefaultTenant is the tenant of blocks without the tenant label.
+	DefaultTenant string
+	// Tenant, if not empty, is the tenant all the blocks are replayed for, regardless of their external labels.
+	Tenant string
+	// WithExternalLabels adds the external labels of a block, except the tenant label, to its replayed series.
+	WithExternalLabels bool
+
+	// SamplesPerRequest is the maximum number of samples sent in a single remote write request.
+	SamplesPerRequest int
+	// SamplesPerSecond limits the rate of replayed samples of every tenant. 0 means no limit.
+	SamplesPerSecond float64
+	// MinTime and MaxTime are the time range of the replayed samples, in milliseconds.
+	MinTime, MaxTime int64
+}
+
+// Replayer replays the samples of TSDB blocks as remote write requests, e.g. to migrate historical data into a receive hashring.
+type Replayer struct {
+	logger log.Logger
+	cfg    Config
+	client *http.Client
+
+	mtx      sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	samples  *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+}
+
+// NewReplayer returns a Replayer writing to the remote write endpoint of the given configuration.
+func NewReplayer(logger log.Logger, reg prometheus.Registerer, cfg Config) (*Replayer, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("no remote write URL configured")
+	}
+	if cfg.SamplesPerRequest <= 0 {
+		return nil, errors.Errorf("samples per request must be positive, got %d", cfg.SamplesPerRequest)
+	}
+	if cfg.SamplesPerSecond < 0 {
+		return nil, errors.Errorf("samples per second can't be negative, got %v", cfg.SamplesPerSecond)
+	}
+	if cfg.MinTime > cfg.MaxTime {
+		return nil, errors.New("min time can't be greater than max time")
+	}
+
+	return &Replayer{
+		logger:   logger,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		limiters: map[string]*rate.Limiter{},
+		samples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_replay_samples_total",
+			Help: "The total number of samples replayed successfully.",
+		}, []string{"tenant"}),
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_replay_rejected_samples_total",
+			Help: "The total number of replayed samples rejected by the remote write endpoint with a non recoverable error.",
+		}, []string{"tenant"}),
+		retries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_replay_retries_total",
+			Help: "The total number of retried remote write requests.",
+		}, []string{"tenant"}),
+	}, nil
+}
+
+// Tenant returns the tenant the samples of the block with the given meta are replayed for.
+func (r *Replayer) Tenant(meta *metadata.Meta) string {
+	if r.cfg.Tenant != "" {
+		return r.cfg.Tenant
+	}
+	if tenant, ok := meta.Thanos.Labels[r.cfg.TenantLabel]; ok && tenant != "" {
+		return tenant
+	}
+	return r.cfg.DefaultTenant
+}
+
+// ReplayBlock replays the samples of the block in the given directory within the configured time range.
+// Tombstones of the block are applied. Samples rejected by the remote write endpoint with a non recoverable
+// error, e.g. because they are out of bounds of the receiving TSDB, are dropped.
+func (r *Replayer) ReplayBlock(ctx context.Context, dir string) error {
+	meta, err := metadata.ReadFromDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+	if meta.Thanos.Downsample.Resolution != 0 {
+		return errors.Errorf("block %s is downsampled, only raw blocks can be replayed", meta.ULID)
+	}
+
+	mint, maxt := max(r.cfg.MinTime, meta.MinTime), min(r.cfg.MaxTime, meta.MaxTime-1)
+	if mint > maxt {
+		return nil
+	}
+
+	b, err := tsdb.OpenBlock(r.logger, dir, nil)
+	if err != nil {
+		return errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithLogOnErr(r.logger, b, "block")
+
+	q, err := tsdb.NewBlockQuerier(b, mint, maxt)
+	if err != nil {
+		return errors.Wrap(err, "create block querier")
+	}
+	defer runutil.CloseWithLogOnErr(r.logger, q, "block querier")
+
+	var (
+		tenant  = r.Tenant(meta)
+		extLset labels.Labels
+	)
+	if r.cfg.WithExternalLabels {
+		extLset = labels.NewBuilder(labels.FromMap(meta.Thanos.Labels)).Del(r.cfg.TenantLabel).Labels()
+	}
+
+	var (
+		pending []prompb.TimeSeries
+		samples int
+	)
+	flush := func() error {
+		if samples == 0 {
+			return nil
+		}
+		if err := r.write(ctx, tenant, pending, samples); err != nil {
+			return err
+		}
+		pending, samples = pending[:0], 0
+		return nil
+	}
+
+	var (
+		set = q.Select(ctx, false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+		it  chunkenc.Iterator
+	)
+	for set.Next() {
+		s := set.At()
+
+		lset := s.Labels()
+		if !extLset.IsEmpty() {
+			builder := labels.NewBuilder(lset)
+			extLset.Range(func(l labels.Label) { builder.Set(l.Name, l.Value) })
+			lset = builder.Labels()
+		}
+		ts := prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+
+		it = s.Iterator(it)
+		for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+			switch vt {
+			case chunkenc.ValFloat:
+				t, v := it.At()
+				ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t, Value: v})
+			case chunkenc.ValHistogram:
+				t, h := it.AtHistogram(nil)
+				ts.Histograms = append(ts.Histograms, prompb.HistogramToHistogramProto(t, h))
+			case chunkenc.ValFloatHistogram:
+				t, fh := it.AtFloatHistogram(nil)
+				ts.Histograms = append(ts.Histograms, prompb.FloatHistogramToHistogramProto(t, fh))
+			default:
+				return errors.Errorf("series %s: unsupported value type %v", lset, vt)
+			}
+
+			if samples++; samples < r.cfg.SamplesPerRequest {
+				continue
+			}
+			// Series spanning several requests are split, their samples are still sent in order.
+			pending = append(pending, ts)
+			if err := flush(); err != nil {
+				return err
+			}
+			ts = prompb.TimeSeries{Labels: ts.Labels}
+		}
+		if err := it.Err(); err != nil {
+			return errors.Wrapf(err, "iterate series %s", lset)
+		}
+		if len(ts.Samples)+len(ts.Histograms) > 0 {
+			pending = append(pending, ts)
+		}
+	}
+	if err := set.Err(); err != nil {
+		return errors.Wrap(err, "select series")
+	}
+	return flush()
+}
+
+func (r *Replayer) limiter(tenant string) *rate.Limiter {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	l, ok := r.limiters[tenant]
+	if !ok {
+		limit := rate.Inf
+		if r.cfg.SamplesPerSecond > 0 {
+			limit = rate.Limit(r.cfg.SamplesPerSecond)
+		}
+		l = rate.NewLimiter(limit, r.cfg.SamplesPerRequest)
+		r.limiters[tenant] = l
+	}
+	return l
+}
+
+func (r *Replayer) write(ctx context.Context, tenant string, series []prompb.TimeSeries, samples int) error {
+	if err := r.limiter(tenant).WaitN(ctx, samples); err != nil {
+		return err
+	}
+
+	wreq := &prompb.WriteRequest{Timeseries: series}
+	buf, err := wreq.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "marshal write request")
+	}
+	body := snappy.Encode(nil, buf)
+
+	backoff := minBackoff
+	for attempt := 0; ; attempt++ {
+		err := r.send(ctx, tenant, body)
+		if err == nil {
+			r.samples.WithLabelValues(tenant).Add(float64(samples))
+			return nil
+		}
+
+		var serr *statusError
+		if errors.As(err, &serr) && !serr.recoverable() {
+			level.Warn(r.logger).Log("msg", "remote write endpoint rejected samples, dropping them", "tenant", tenant, "samples", samples, "err", err)
+			r.rejected.WithLabelValues(tenant).Add(float64(samples))
+			return nil
+		}
+		if attempt >= r.cfg.MaxRetries {
+			return errors.Wrapf(err, "write %d samples of tenant %s", samples, tenant)
+		}
+
+		level.Debug(r.logger).Log("msg", "remote write failed, retrying", "tenant", tenant, "backoff", backoff, "err", err)
+		r.retries.WithLabelValues(tenant).Inc()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (r *Replayer) send(ctx context.Context, tenant string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set(r.cfg.TenantHeader, tenant)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(r.logger, resp.Body, "response body")
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &statusError{code: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+}
+
+// statusError is the error of a remote write request which got a non 2xx response.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server returned HTTP status %d: %s", e.code, e.msg)
+}
+
+// recoverable returns true if the request is worth retrying, as Prometheus remote write does.
+func (e *statusError) recoverable() bool {
+	return e.code/100 == 5 || e.code == http.StatusTooManyRequests
+}
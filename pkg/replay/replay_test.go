@@ -0,0 +1,168 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package replay
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+type writeRecorder struct {
+	mtx      sync.Mutex
+	status   []int
+	requests []*prompb.WriteRequest
+	tenants  []string
+}
+
+func (w *writeRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if len(w.status) > 0 {
+		status := w.status[0]
+		w.status = w.status[1:]
+		if status != http.StatusOK {
+			http.Error(rw, "failed", status)
+			return
+		}
+	}
+
+	compressed, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wreq := &prompb.WriteRequest{}
+	if err := wreq.Unmarshal(buf); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.requests = append(w.requests, wreq)
+	w.tenants = append(w.tenants, r.Header.Get("THANOS-TENANT"))
+}
+
+// samples returns the number of samples received for every series.
+func (w *writeRecorder) samples() map[string]int {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	res := map[string]int{}
+	for _, wreq := range w.requests {
+		for _, ts := range wreq.Timeseries {
+			res[labelpb.ZLabelsToPromLabels(ts.Labels).String()] += len(ts.Samples)
+		}
+	}
+	return res
+}
+
+func TestReplayer_ReplayBlock(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b"),
+	}
+	id, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 1000, labels.FromStrings("tenant_id", "team-a", "replica", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	blockDir := filepath.Join(dir, id.String())
+
+	defaultConfig := func(url string) Config {
+		return Config{
+			URL:               url,
+			MaxRetries:        2,
+			TenantHeader:      "THANOS-TENANT",
+			TenantLabel:       "tenant_id",
+			DefaultTenant:     "default-tenant",
+			SamplesPerRequest: 30,
+			MinTime:           math.MinInt64,
+			MaxTime:           math.MaxInt64,
+		}
+	}
+
+	t.Run("all samples are replayed in batches for the tenant of the block", func(t *testing.T) {
+		rec := &writeRecorder{}
+		srv := httptest.NewServer(rec)
+		defer srv.Close()
+
+		r, err := NewReplayer(log.NewNopLogger(), nil, defaultConfig(srv.URL))
+		testutil.Ok(t, err)
+		testutil.Ok(t, r.ReplayBlock(ctx, blockDir))
+
+		testutil.Equals(t, map[string]int{`{__name__="up", job="a"}`: 100, `{__name__="up", job="b"}`: 100}, rec.samples())
+		testutil.Equals(t, 7, len(rec.requests))
+		for i, wreq := range rec.requests {
+			n := 0
+			for _, ts := range wreq.Timeseries {
+				n += len(ts.Samples)
+			}
+			testutil.Assert(t, n <= 30, "request %d has %d samples", i, n)
+			testutil.Equals(t, "team-a", rec.tenants[i])
+		}
+	})
+
+	t.Run("time range, tenant override and external labels", func(t *testing.T) {
+		rec := &writeRecorder{}
+		srv := httptest.NewServer(rec)
+		defer srv.Close()
+
+		cfg := defaultConfig(srv.URL)
+		cfg.Tenant = "other"
+		cfg.WithExternalLabels = true
+		// Samples of the block are 9ms apart.
+		cfg.MaxTime = 449
+		r, err := NewReplayer(log.NewNopLogger(), nil, cfg)
+		testutil.Ok(t, err)
+		testutil.Ok(t, r.ReplayBlock(ctx, blockDir))
+
+		testutil.Equals(t, map[string]int{`{__name__="up", job="a", replica="1"}`: 50, `{__name__="up", job="b", replica="1"}`: 50}, rec.samples())
+		for _, tenant := range rec.tenants {
+			testutil.Equals(t, "other", tenant)
+		}
+	})
+
+	t.Run("recoverable errors are retried, non recoverable ones are dropped", func(t *testing.T) {
+		rec := &writeRecorder{status: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK, http.StatusConflict}}
+		srv := httptest.NewServer(rec)
+		defer srv.Close()
+
+		r, err := NewReplayer(log.NewNopLogger(), nil, defaultConfig(srv.URL))
+		testutil.Ok(t, err)
+		testutil.Ok(t, r.ReplayBlock(ctx, blockDir))
+
+		// The second batch is rejected.
+		testutil.Equals(t, map[string]int{`{__name__="up", job="a"}`: 70, `{__name__="up", job="b"}`: 100}, rec.samples())
+	})
+
+	t.Run("replay fails once retries are exhausted", func(t *testing.T) {
+		rec := &writeRecorder{status: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}}
+		srv := httptest.NewServer(rec)
+		defer srv.Close()
+
+		r, err := NewReplayer(log.NewNopLogger(), nil, defaultConfig(srv.URL))
+		testutil.Ok(t, err)
+		testutil.NotOk(t, r.ReplayBlock(ctx, blockDir))
+	})
+}
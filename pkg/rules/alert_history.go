@@ -0,0 +1,246 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// AlertTransitionsMetricName is the name of the series recording the state transitions of alerts.
+	AlertTransitionsMetricName = "ALERTS_TRANSITIONS"
+	// AlertTransitionsPreviousStateLabel is the label of the state alerts transitioned from. The state they
+	// transitioned to is the alertstate label, like for the ALERTS series.
+	AlertTransitionsPreviousStateLabel = "previous_alertstate"
+)
+
+// AlertTransition is a change of the state of an alert, e.g. from pending to firing, or from firing to inactive once
+// resolved.
+type AlertTransition struct {
+	Group     string        `json:"group"`
+	Labels    labels.Labels `json:"labels"`
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// AlertTransitionsFilter selects alert transitions. Empty fields select all the transitions.
+type AlertTransitionsFilter struct {
+	AlertName  string
+	Group      string
+	Start, End time.Time
+}
+
+func (f AlertTransitionsFilter) matches(t AlertTransition) bool {
+	if f.AlertName != "" && t.Labels.Get(labels.AlertName) != f.AlertName {
+		return false
+	}
+	if f.Group != "" && t.Group != f.Group {
+		return false
+	}
+	if !f.Start.IsZero() && t.Timestamp.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && t.Timestamp.After(f.End) {
+		return false
+	}
+	return true
+}
+
+// AlertHistory records the state transitions of the alerts of the rule groups evaluated by a Manager. The most recent
+// transitions are kept in memory, and every transition is appended as a sample of the ALERTS_TRANSITIONS series, so
+// that it is uploaded to object storage or remote written with the other series of the ruler.
+type AlertHistory struct {
+	logger     log.Logger
+	appendable storage.Appendable
+
+	mtx sync.Mutex
+	// states are the last states of the alerts of every rule group, by hash of their labels.
+	states map[string]map[uint64]alertState
+	// transitions is a ring buffer of the most recent transitions, next being the index of the next one.
+	transitions []AlertTransition
+	next        int
+	full        bool
+
+	transitionsTotal *prometheus.CounterVec
+	appendFailures   prometheus.Counter
+}
+
+type alertState struct {
+	labels labels.Labels
+	state  rules.AlertState
+}
+
+// NewAlertHistory returns a new AlertHistory, keeping the given number of most recent transitions in memory. The
+// transitions are appended to the given appendable, unless it is nil.
+func NewAlertHistory(logger log.Logger, reg prometheus.Registerer, appendable storage.Appendable, maxTransitions int) *AlertHistory {
+	return &AlertHistory{
+		logger:      logger,
+		appendable:  appendable,
+		states:      map[string]map[uint64]alertState{},
+		transitions: make([]AlertTransition, maxTransitions),
+		transitionsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_alert_transitions_total",
+			Help: "Total number of alert state transitions, by state the alerts transitioned to.",
+		}, []string{"state"}),
+		appendFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_rule_alert_transitions_append_failures_total",
+			Help: "Total number of failures to append alert state transitions to the ruler storage.",
+		}),
+	}
+}
+
+// observeGroup records the transitions of the alerts of the given rule group, once evaluated at the given timestamp.
+func (h *AlertHistory) observeGroup(ctx context.Context, group string, g *rules.Group, ts time.Time) {
+	var alerts []*rules.Alert
+	for _, r := range g.Rules() {
+		if ar, ok := r.(*rules.AlertingRule); ok {
+			ar.ForEachActiveAlert(func(a *rules.Alert) {
+				anew := *a
+				alerts = append(alerts, &anew)
+			})
+		}
+	}
+	h.observe(ctx, group, ts, alerts)
+}
+
+// observe records the transitions of the alerts of the given rule group, from their states of the previous evaluation
+// to the given alerts. Alerts which are gone, e.g. pending ones which didn't fire, transition to inactive.
+func (h *AlertHistory) observe(ctx context.Context, group string, ts time.Time, alerts []*rules.Alert) {
+	h.mtx.Lock()
+	prev := h.states[group]
+	cur := make(map[uint64]alertState, len(alerts))
+	var transitions []AlertTransition
+	for _, a := range alerts {
+		key := a.Labels.Hash()
+		cur[key] = alertState{labels: a.Labels, state: a.State}
+
+		from := rules.StateInactive
+		if p, ok := prev[key]; ok {
+			from = p.state
+		}
+		if from == a.State {
+			continue
+		}
+		transitions = append(transitions, AlertTransition{
+			Group:     group,
+			Labels:    a.Labels,
+			From:      from.String(),
+			To:        a.State.String(),
+			Timestamp: transitionTime(a, ts),
+		})
+	}
+	for key, p := range prev {
+		if _, ok := cur[key]; ok || p.state == rules.StateInactive {
+			continue
+		}
+		transitions = append(transitions, AlertTransition{
+			Group:     group,
+			Labels:    p.labels,
+			From:      p.state.String(),
+			To:        rules.StateInactive.String(),
+			Timestamp: ts,
+		})
+	}
+	if len(cur) > 0 {
+		h.states[group] = cur
+	} else {
+		delete(h.states, group)
+	}
+	for _, t := range transitions {
+		h.add(t)
+	}
+	h.mtx.Unlock()
+
+	if len(transitions) == 0 || h.appendable == nil {
+		return
+	}
+	if err := h.append(ctx, transitions); err != nil {
+		h.appendFailures.Inc()
+		level.Warn(h.logger).Log("msg", "failed to append alert state transitions", "group", group, "err", err)
+	}
+}
+
+// transitionTime returns the time of the last transition of the given alert, evaluated at the given timestamp.
+func transitionTime(a *rules.Alert, ts time.Time) time.Time {
+	var t time.Time
+	switch {
+	case !a.ResolvedAt.IsZero():
+		t = a.ResolvedAt
+	case a.State == rules.StateFiring:
+		t = a.FiredAt
+	case a.State == rules.StatePending:
+		t = a.ActiveAt
+	}
+	if t.IsZero() {
+		return ts
+	}
+	return t
+}
+
+func (h *AlertHistory) len() int {
+	if h.full {
+		return len(h.transitions)
+	}
+	return h.next
+}
+
+func (h *AlertHistory) add(t AlertTransition) {
+	h.transitionsTotal.WithLabelValues(t.To).Inc()
+	if len(h.transitions) == 0 {
+		return
+	}
+	h.transitions[h.next] = t
+	h.next = (h.next + 1) % len(h.transitions)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *AlertHistory) append(ctx context.Context, transitions []AlertTransition) error {
+	app := h.appendable.Appender(ctx)
+	for _, t := range transitions {
+		b := labels.NewBuilder(t.Labels)
+		b.Set(labels.MetricName, AlertTransitionsMetricName)
+		b.Set("alertstate", t.To)
+		b.Set(AlertTransitionsPreviousStateLabel, t.From)
+		if _, err := app.Append(0, b.Labels(), timestamp.FromTime(t.Timestamp), 1); err != nil {
+			if rerr := app.Rollback(); rerr != nil {
+				level.Warn(h.logger).Log("msg", "failed to rollback appender", "err", rerr)
+			}
+			return errors.Wrap(err, "append alert state transition")
+		}
+	}
+	return errors.Wrap(app.Commit(), "commit alert state transitions")
+}
+
+// Transitions returns the recorded transitions selected by the given filter, oldest first.
+func (h *AlertHistory) Transitions(f AlertTransitionsFilter) []AlertTransition {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	ret := []AlertTransition{}
+	start := 0
+	if h.full {
+		start = h.next
+	}
+	for i := 0; i < h.len(); i++ {
+		if t := h.transitions[(start+i)%len(h.transitions)]; f.matches(t) {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
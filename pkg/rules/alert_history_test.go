@@ -0,0 +1,90 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestAlertHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	h := NewAlertHistory(log.NewNopLogger(), prometheus.NewRegistry(), db, 5)
+
+	lsetA := labels.FromStrings("alertname", "A", "severity", "page")
+	lsetB := labels.FromStrings("alertname", "B")
+	t0 := time.Unix(1000, 0)
+	t1, t2, t3 := t0.Add(time.Minute), t0.Add(2*time.Minute), t0.Add(3*time.Minute)
+
+	h.observe(ctx, "file;group", t0, []*rules.Alert{
+		{Labels: lsetA, State: rules.StatePending, ActiveAt: t0},
+		{Labels: lsetB, State: rules.StatePending, ActiveAt: t0},
+	})
+	// Unchanged states aren't transitions.
+	h.observe(ctx, "file;group", t0.Add(30*time.Second), []*rules.Alert{
+		{Labels: lsetA, State: rules.StatePending, ActiveAt: t0},
+		{Labels: lsetB, State: rules.StatePending, ActiveAt: t0},
+	})
+	// B is gone without firing.
+	h.observe(ctx, "file;group", t1, []*rules.Alert{
+		{Labels: lsetA, State: rules.StateFiring, ActiveAt: t0, FiredAt: t1},
+	})
+	h.observe(ctx, "file;group", t2, []*rules.Alert{
+		{Labels: lsetA, State: rules.StateInactive, ActiveAt: t0, FiredAt: t1, ResolvedAt: t2},
+	})
+	// Resolved alerts are kept for a while, then are gone.
+	h.observe(ctx, "file;group", t3, nil)
+
+	testutil.Equals(t, []AlertTransition{
+		{Group: "file;group", Labels: lsetA, From: "pending", To: "firing", Timestamp: t1},
+		{Group: "file;group", Labels: lsetB, From: "pending", To: "inactive", Timestamp: t1},
+		{Group: "file;group", Labels: lsetA, From: "firing", To: "inactive", Timestamp: t2},
+	}, h.Transitions(AlertTransitionsFilter{Start: t1}))
+	testutil.Equals(t, []AlertTransition{
+		{Group: "file;group", Labels: lsetA, From: "inactive", To: "pending", Timestamp: t0},
+		{Group: "file;group", Labels: lsetA, From: "pending", To: "firing", Timestamp: t1},
+	}, h.Transitions(AlertTransitionsFilter{AlertName: "A", End: t1}))
+	testutil.Equals(t, 0, len(h.Transitions(AlertTransitionsFilter{Group: "other"})))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(h.transitionsTotal.WithLabelValues("inactive")))
+
+	// Only the most recent transitions are kept in memory.
+	h.observe(ctx, "file;group", t3, []*rules.Alert{{Labels: lsetB, State: rules.StatePending, ActiveAt: t3}})
+	testutil.Equals(t, 5, len(h.Transitions(AlertTransitionsFilter{})))
+	testutil.Equals(t, "B", h.Transitions(AlertTransitionsFilter{})[4].Labels.Get("alertname"))
+
+	// All the transitions are stored as samples of the ALERTS_TRANSITIONS series.
+	q, err := db.Querier(math.MinInt64, math.MaxInt64)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	ss := q.Select(ctx, true, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, AlertTransitionsMetricName))
+	var series []labels.Labels
+	var samples int
+	for ss.Next() {
+		series = append(series, ss.At().Labels())
+		it := ss.At().Iterator(nil)
+		for it.Next() != 0 {
+			samples++
+		}
+	}
+	testutil.Ok(t, ss.Err())
+	testutil.Equals(t, 6, samples)
+	testutil.Equals(t, labels.FromStrings(labels.MetricName, AlertTransitionsMetricName, "alertname", "A", "alertstate", "firing", AlertTransitionsPreviousStateLabel, "pending", "severity", "page"), series[0])
+	testutil.Equals(t, 5, len(series))
+}
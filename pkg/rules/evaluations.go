@@ -0,0 +1,154 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/rules"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// Classes of rule evaluation errors.
+const (
+	EvaluationErrorTimeout     = "timeout"
+	EvaluationErrorCanceled    = "canceled"
+	EvaluationErrorUnreachable = "unreachable"
+	EvaluationErrorQuery       = "query"
+	// EvaluationErrorEvaluation is the class of errors of rules whose queries succeeded, e.g. when their results
+	// fail to be stored.
+	EvaluationErrorEvaluation = "evaluation"
+)
+
+type queryEvaluationKey struct {
+	strategy storepb.PartialResponseStrategy
+	query    string
+}
+
+type queryEvaluation struct {
+	ts       time.Time
+	warnings []string
+	err      *rulespb.RuleEvaluationError
+}
+
+// QueryEvaluations records the outcome of the last evaluation of rule queries by query APIs, to tell why rules are
+// unhealthy through the Rules API. Rule queries are evaluated by the query function given to the Manager, which
+// loses the details of the errors of the query APIs it tried.
+type QueryEvaluations struct {
+	mtx  sync.Mutex
+	last map[queryEvaluationKey]queryEvaluation
+}
+
+// NewQueryEvaluations returns new QueryEvaluations.
+func NewQueryEvaluations() *QueryEvaluations {
+	return &QueryEvaluations{last: map[queryEvaluationKey]queryEvaluation{}}
+}
+
+// Observe records the warnings of the successful evaluation of the query at the given evaluation timestamp.
+func (e *QueryEvaluations) Observe(strategy storepb.PartialResponseStrategy, query string, t time.Time, warnings []string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.last[queryEvaluationKey{strategy: strategy, query: query}] = queryEvaluation{ts: t, warnings: warnings}
+}
+
+// ObserveError records the error of the failed evaluation of the query at the given evaluation timestamp, returned
+// by the query API with the given endpoint. The endpoint is empty if no query API could be tried.
+func (e *QueryEvaluations) ObserveError(strategy storepb.PartialResponseStrategy, query string, t time.Time, endpoint string, err error) {
+	class := EvaluationErrorUnreachable
+	if endpoint != "" {
+		class = evaluationErrorClass(err)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.last[queryEvaluationKey{strategy: strategy, query: query}] = queryEvaluation{ts: t, err: &rulespb.RuleEvaluationError{
+		// UTC needed due to https://github.com/gogo/protobuf/issues/519.
+		Timestamp: t.UTC(),
+		Class:     class,
+		Endpoint:  endpoint,
+		Message:   err.Error(),
+	}}
+}
+
+// details returns the warnings and the error details of the last evaluation of the rule, whose query is evaluated
+// at the evaluation timestamp minus the given query offset.
+func (e *QueryEvaluations) details(strategy storepb.PartialResponseStrategy, r rules.Rule, queryOffset time.Duration) ([]string, *rulespb.RuleEvaluationError) {
+	if e == nil {
+		return nil, nil
+	}
+
+	e.mtx.Lock()
+	last, ok := e.last[queryEvaluationKey{strategy: strategy, query: r.Query().String()}]
+	e.mtx.Unlock()
+
+	ts := r.GetEvaluationTimestamp()
+	if !ok || !last.ts.Equal(ts.Add(-queryOffset)) {
+		// The query was not evaluated by the last evaluation of the rule, e.g. the rule is evaluated by another strategy.
+		last = queryEvaluation{}
+	}
+	if r.LastError() == nil {
+		return last.warnings, nil
+	}
+	if last.err != nil {
+		return nil, last.err
+	}
+	return last.warnings, &rulespb.RuleEvaluationError{
+		// UTC needed due to https://github.com/gogo/protobuf/issues/519.
+		Timestamp: ts.UTC(),
+		Class:     EvaluationErrorEvaluation,
+		Message:   r.LastError().Error(),
+	}
+}
+
+// retain removes the evaluations of the queries of the strategy which are not the ones of the given rule groups.
+func (e *QueryEvaluations) retain(strategy storepb.PartialResponseStrategy, groups []*rules.Group) {
+	if e == nil {
+		return
+	}
+
+	queries := map[string]struct{}{}
+	for _, g := range groups {
+		for _, r := range g.Rules() {
+			queries[r.Query().String()] = struct{}{}
+		}
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for k := range e.last {
+		if _, ok := queries[k.query]; k.strategy == strategy && !ok {
+			delete(e.last, k)
+		}
+	}
+}
+
+func evaluationErrorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+		return EvaluationErrorTimeout
+	case errors.Is(err, context.Canceled), status.Code(err) == codes.Canceled:
+		return EvaluationErrorCanceled
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return EvaluationErrorTimeout
+		}
+		return EvaluationErrorUnreachable
+	case status.Code(err) == codes.Unavailable:
+		return EvaluationErrorUnreachable
+	default:
+		return EvaluationErrorQuery
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/extpromql"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+func TestEvaluationErrorClass(t *testing.T) {
+	for _, tcase := range []struct {
+		err  error
+		want string
+	}{
+		{err: errors.Wrap(context.DeadlineExceeded, "read query instant response"), want: EvaluationErrorTimeout},
+		{err: status.Error(codes.DeadlineExceeded, "deadline"), want: EvaluationErrorTimeout},
+		{err: errors.Wrap(context.Canceled, "query"), want: EvaluationErrorCanceled},
+		{err: errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "query"), want: EvaluationErrorUnreachable},
+		{err: status.Error(codes.Unavailable, "unavailable"), want: EvaluationErrorUnreachable},
+		{err: errors.New("error: unknown function, type: bad_data"), want: EvaluationErrorQuery},
+	} {
+		testutil.Equals(t, tcase.want, evaluationErrorClass(tcase.err), "%v", tcase.err)
+	}
+}
+
+func TestQueryEvaluations(t *testing.T) {
+	expr, err := extpromql.ParseExpr(`sum(up)`)
+	testutil.Ok(t, err)
+	rule := rules.NewRecordingRule("r", expr, labels.EmptyLabels())
+
+	ts := time.Unix(100, 0)
+	offset := time.Minute
+	rule.SetEvaluationTimestamp(ts)
+
+	var nilEvaluations *QueryEvaluations
+	warnings, details := nilEvaluations.details(storepb.PartialResponseStrategy_WARN, rule, offset)
+	testutil.Equals(t, 0, len(warnings))
+	testutil.Assert(t, details == nil)
+
+	e := NewQueryEvaluations()
+	e.Observe(storepb.PartialResponseStrategy_WARN, `sum(up)`, ts.Add(-offset), []string{"partial response"})
+	warnings, details = e.details(storepb.PartialResponseStrategy_WARN, rule, offset)
+	testutil.Equals(t, []string{"partial response"}, warnings)
+	testutil.Assert(t, details == nil)
+
+	// The evaluations of other strategies or timestamps are not the ones of the last evaluation of the rule.
+	warnings, _ = e.details(storepb.PartialResponseStrategy_ABORT, rule, offset)
+	testutil.Equals(t, 0, len(warnings))
+	rule.SetEvaluationTimestamp(ts.Add(time.Minute))
+	warnings, _ = e.details(storepb.PartialResponseStrategy_WARN, rule, offset)
+	testutil.Equals(t, 0, len(warnings))
+
+	rule.SetLastError(errors.New("no query API server reachable"))
+	e.ObserveError(storepb.PartialResponseStrategy_WARN, `sum(up)`, ts.Add(time.Minute-offset), "querier:9090", errors.Wrap(context.DeadlineExceeded, "read query instant response"))
+	_, details = e.details(storepb.PartialResponseStrategy_WARN, rule, offset)
+	testutil.Equals(t, &rulespb.RuleEvaluationError{
+		Timestamp: ts.Add(time.Minute - offset).UTC(),
+		Class:     EvaluationErrorTimeout,
+		Endpoint:  "querier:9090",
+		Message:   "read query instant response: context deadline exceeded",
+	}, details)
+
+	// Errors of rules whose query succeeded are evaluation errors.
+	rule.SetEvaluationTimestamp(ts.Add(2 * time.Minute))
+	rule.SetLastError(errors.New("out of bounds"))
+	e.Observe(storepb.PartialResponseStrategy_WARN, `sum(up)`, ts.Add(2*time.Minute-offset), nil)
+	_, details = e.details(storepb.PartialResponseStrategy_WARN, rule, offset)
+	testutil.Equals(t, &rulespb.RuleEvaluationError{
+		Timestamp: ts.Add(2 * time.Minute).UTC(),
+		Class:     EvaluationErrorEvaluation,
+		Message:   "out of bounds",
+	}, details)
+
+	e.ObserveError(storepb.PartialResponseStrategy_ABORT, `sum(up)`, ts, "", errors.New("no query API server reachable"))
+	testutil.Equals(t, EvaluationErrorUnreachable, e.last[queryEvaluationKey{strategy: storepb.PartialResponseStrategy_ABORT, query: `sum(up)`}].err.Class)
+
+	// Evaluations of removed rules are dropped, for the given strategy only.
+	e.retain(storepb.PartialResponseStrategy_WARN, nil)
+	testutil.Equals(t, 1, len(e.last))
+}
@@ -0,0 +1,311 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+	"gopkg.in/yaml.v3"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const managedRuleFileExt = ".yaml"
+
+var (
+	// ErrRuleGroupNotFound is returned when a managed rule group does not exist.
+	ErrRuleGroupNotFound = errors.New("rule group not found")
+
+	namespaceRe = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+)
+
+// ManagedRules stores the rule groups managed through the ruler API. Groups are stored by namespace, every namespace
+// being a rule file of the directory. When a bucket is configured, rule files are persisted to it and the bucket is
+// the source of truth of the directory, e.g. so that rule groups survive the loss of the local disk.
+type ManagedRules struct {
+	logger log.Logger
+	dir    string
+	bkt    objstore.Bucket
+	reload func() error
+
+	mtx sync.Mutex
+}
+
+// NewManagedRules returns the managed rules stored in the given directory, and optional bucket.
+// The given reload function is called on every change, for the rule manager to load the rule files of the directory.
+func NewManagedRules(logger log.Logger, dir string, bkt objstore.Bucket, reload func() error) (*ManagedRules, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "create managed rules directory")
+	}
+	return &ManagedRules{logger: logger, dir: dir, bkt: bkt, reload: reload}, nil
+}
+
+// FilesPattern returns the glob pattern of the rule files of the managed rules.
+func (m *ManagedRules) FilesPattern() string {
+	return filepath.Join(m.dir, "*"+managedRuleFileExt)
+}
+
+// Sync replaces the rule files of the directory with the ones of the bucket, if any.
+func (m *ManagedRules) Sync(ctx context.Context) error {
+	if m.bkt == nil {
+		return nil
+	}
+
+	remote := map[string]struct{}{}
+	if err := m.bkt.Iter(ctx, "", func(name string) error {
+		if !strings.HasSuffix(name, managedRuleFileExt) || !namespaceRe.MatchString(strings.TrimSuffix(name, managedRuleFileExt)) {
+			return nil
+		}
+		content, err := m.download(ctx, name)
+		if err != nil {
+			return err
+		}
+		remote[name] = struct{}{}
+		return writeFileAtomic(filepath.Join(m.dir, name), content)
+	}); err != nil {
+		return errors.Wrap(err, "sync managed rules from bucket")
+	}
+
+	local, err := filepath.Glob(m.FilesPattern())
+	if err != nil {
+		return err
+	}
+	for _, f := range local {
+		if _, ok := remote[filepath.Base(f)]; !ok {
+			if err := os.Remove(f); err != nil {
+				return errors.Wrap(err, "remove deleted managed rule file")
+			}
+		}
+	}
+	return nil
+}
+
+func (m *ManagedRules) download(ctx context.Context, name string) ([]byte, error) {
+	rc, err := m.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(m.logger, rc, "managed rule file reader")
+	return io.ReadAll(rc)
+}
+
+// managedNamespace is the content of the rule file of a namespace. Groups are kept as YAML nodes, to be written back
+// as they were submitted.
+type managedNamespace struct {
+	Groups []yaml.Node `yaml:"groups"`
+}
+
+func groupName(n *yaml.Node) string {
+	var g struct {
+		Name string `yaml:"name"`
+	}
+	_ = n.Decode(&g)
+	return g.Name
+}
+
+func (m *ManagedRules) readNamespace(namespace string) (managedNamespace, []byte, error) {
+	var ns managedNamespace
+	content, err := os.ReadFile(filepath.Join(m.dir, namespace+managedRuleFileExt))
+	if os.IsNotExist(err) {
+		return ns, nil, nil
+	}
+	if err != nil {
+		return ns, nil, errors.Wrapf(err, "read namespace %s", namespace)
+	}
+	if err := yaml.Unmarshal(content, &ns); err != nil {
+		return ns, nil, errors.Wrapf(err, "parse namespace %s", namespace)
+	}
+	return ns, content, nil
+}
+
+// Group returns the rule group of the namespace.
+func (m *ManagedRules) Group(namespace, name string) (interface{}, error) {
+	if err := validateNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ns, _, err := m.readNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ns.Groups {
+		if groupName(&ns.Groups[i]) == name {
+			var res interface{}
+			if err := ns.Groups[i].Decode(&res); err != nil {
+				return nil, err
+			}
+			return res, nil
+		}
+	}
+	return nil, ErrRuleGroupNotFound
+}
+
+// SetGroup creates or replaces the named rule group of the namespace with the given YAML rule group, whose name
+// defaults to the given one. The change is applied once the rules are reloaded successfully, it is reverted otherwise.
+func (m *ManagedRules) SetGroup(ctx context.Context, namespace, name string, group []byte) error {
+	if err := validateNamespace(namespace); err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(group, &node); err != nil {
+		return validationError{errors.Wrap(err, "parse rule group")}
+	}
+	if node.Kind != yaml.DocumentNode || len(node.Content) != 1 || node.Content[0].Kind != yaml.MappingNode {
+		return validationError{errors.New("rule group must be a YAML mapping")}
+	}
+	g := node.Content[0]
+	switch n := groupName(g); n {
+	case "":
+		g.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "name"},
+			{Kind: yaml.ScalarNode, Value: name},
+		}, g.Content...)
+	case name:
+	default:
+		return validationError{errors.Errorf("name %q of the rule group does not match %q", n, name)}
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ns, previous, err := m.readNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range ns.Groups {
+		if groupName(&ns.Groups[i]) == name {
+			ns.Groups[i], replaced = *g, true
+		}
+	}
+	if !replaced {
+		ns.Groups = append(ns.Groups, *g)
+	}
+	return m.apply(ctx, namespace, ns, previous)
+}
+
+// DeleteGroup deletes the named rule group of the namespace, and the namespace if it has no groups left.
+func (m *ManagedRules) DeleteGroup(ctx context.Context, namespace, name string) error {
+	if err := validateNamespace(namespace); err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ns, previous, err := m.readNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	groups := ns.Groups[:0]
+	for _, g := range ns.Groups {
+		if groupName(&g) != name {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == len(ns.Groups) {
+		return ErrRuleGroupNotFound
+	}
+	ns.Groups = groups
+	return m.apply(ctx, namespace, ns, previous)
+}
+
+// apply validates and writes the namespace, restoring the previous content of its rule file if the rules fail to reload.
+func (m *ManagedRules) apply(ctx context.Context, namespace string, ns managedNamespace, previous []byte) error {
+	var content []byte
+	if len(ns.Groups) > 0 {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(ns); err != nil {
+			return errors.Wrap(err, "encode namespace")
+		}
+		if _, errs := ValidateAndCount(bytes.NewReader(buf.Bytes())); errs.Err() != nil {
+			return validationError{errs.Err()}
+		}
+		content = buf.Bytes()
+	}
+
+	if err := m.write(ctx, namespace, content); err != nil {
+		return err
+	}
+	if err := m.reload(); err != nil {
+		if rerr := m.write(ctx, namespace, previous); rerr != nil {
+			level.Error(m.logger).Log("msg", "failed to restore managed rule file", "namespace", namespace, "err", rerr)
+		} else if rerr := m.reload(); rerr != nil {
+			level.Error(m.logger).Log("msg", "failed to reload restored managed rule file", "namespace", namespace, "err", rerr)
+		}
+		return errors.Wrap(err, "reload rules")
+	}
+	return nil
+}
+
+// write writes the rule file of the namespace to the bucket first, as it is the source of truth, then to the directory.
+// Empty content deletes the rule file.
+func (m *ManagedRules) write(ctx context.Context, namespace string, content []byte) error {
+	name := namespace + managedRuleFileExt
+	path := filepath.Join(m.dir, name)
+
+	if len(content) == 0 {
+		if m.bkt != nil {
+			if err := m.bkt.Delete(ctx, name); err != nil && !m.bkt.IsObjNotFoundErr(err) {
+				return errors.Wrapf(err, "delete %s from bucket", name)
+			}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if m.bkt != nil {
+		if err := m.bkt.Upload(ctx, name, bytes.NewReader(content)); err != nil {
+			return errors.Wrapf(err, "upload %s to bucket", name)
+		}
+	}
+	return writeFileAtomic(path, content)
+}
+
+func writeFileAtomic(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func validateNamespace(namespace string) error {
+	if !namespaceRe.MatchString(namespace) {
+		return validationError{errors.Errorf("invalid namespace %q, it must only contain alphanumeric characters, '_', '-' and '.', and must not start with '.'", namespace)}
+	}
+	return nil
+}
+
+// validationError is an error caused by invalid rule groups or namespaces.
+type validationError struct {
+	err error
+}
+
+func (e validationError) Error() string { return e.err.Error() }
+
+// IsValidationError returns true if the error is caused by an invalid rule group or namespace.
+func IsValidationError(err error) bool {
+	_, ok := errors.Cause(err).(validationError)
+	return ok
+}
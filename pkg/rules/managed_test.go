@@ -0,0 +1,129 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+func TestManagedRules(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	var (
+		reloads   int
+		reloadErr error
+	)
+	m, err := NewManagedRules(log.NewNopLogger(), dir, bkt, func() error {
+		reloads++
+		return reloadErr
+	})
+	testutil.Ok(t, err)
+
+	readFile := func(namespace string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, namespace+".yaml"))
+		testutil.Ok(t, err)
+		return string(b)
+	}
+
+	testutil.Ok(t, m.SetGroup(ctx, "team-a", "latency", []byte(`
+interval: 30s
+partial_response_strategy: warn
+rules:
+- record: job:latency_seconds:avg
+  expr: avg by (job) (latency_seconds)
+`)))
+	testutil.Ok(t, m.SetGroup(ctx, "team-a", "errors", []byte(`{"name": "errors", "rules": [{"alert": "Errors", "expr": "errors_total > 0"}]}`)))
+	testutil.Equals(t, 2, reloads)
+
+	const expected = `groups:
+  - name: latency
+    interval: 30s
+    partial_response_strategy: warn
+    rules:
+      - record: job:latency_seconds:avg
+        expr: avg by (job) (latency_seconds)
+  - {"name": "errors", "rules": [{"alert": "Errors", "expr": "errors_total > 0"}]}
+`
+	testutil.Equals(t, expected, readFile("team-a"))
+	testutil.Equals(t, []byte(expected), bkt.Objects()["team-a.yaml"])
+
+	group, err := m.Group("team-a", "errors")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]interface{}{
+		"name":  "errors",
+		"rules": []interface{}{map[string]interface{}{"alert": "Errors", "expr": "errors_total > 0"}},
+	}, group)
+	_, err = m.Group("team-a", "unknown")
+	testutil.Equals(t, ErrRuleGroupNotFound, err)
+
+	t.Run("invalid groups are rejected", func(t *testing.T) {
+		for _, tcase := range []struct {
+			namespace, name, group string
+		}{
+			{namespace: "../etc", name: "g", group: `rules: []`},
+			{namespace: ".hidden", name: "g", group: `rules: []`},
+			{namespace: "team-a", name: "g", group: `[]`},
+			{namespace: "team-a", name: "g", group: `{name: other, rules: []}`},
+			{namespace: "team-a", name: "g", group: `{rules: [{record: "invalid name", expr: up}]}`},
+			{namespace: "team-a", name: "g", group: `{rules: [{record: r, expr: "sum("}]}`},
+			{namespace: "team-a", name: "g", group: `{partial_response_strategy: unknown, rules: []}`},
+		} {
+			err := m.SetGroup(ctx, tcase.namespace, tcase.name, []byte(tcase.group))
+			testutil.NotOk(t, err)
+			testutil.Assert(t, IsValidationError(err), "expected a validation error for %v, got %v", tcase, err)
+		}
+		testutil.Equals(t, 2, reloads)
+		testutil.Equals(t, expected, readFile("team-a"))
+	})
+
+	t.Run("changes are reverted if the rules fail to reload", func(t *testing.T) {
+		reloadErr = errors.New("reload failed")
+		defer func() { reloadErr = nil }()
+
+		testutil.NotOk(t, m.SetGroup(ctx, "team-a", "latency", []byte(`rules: []`)))
+		testutil.Equals(t, expected, readFile("team-a"))
+		testutil.Equals(t, []byte(expected), bkt.Objects()["team-a.yaml"])
+
+		testutil.NotOk(t, m.SetGroup(ctx, "team-b", "g", []byte(`rules: []`)))
+		_, err := os.Stat(filepath.Join(dir, "team-b.yaml"))
+		testutil.Assert(t, os.IsNotExist(err), "expected the new namespace to be removed")
+		testutil.Equals(t, 1, len(bkt.Objects()))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		testutil.Equals(t, ErrRuleGroupNotFound, m.DeleteGroup(ctx, "team-a", "unknown"))
+		testutil.Ok(t, m.DeleteGroup(ctx, "team-a", "errors"))
+		_, err := m.Group("team-a", "errors")
+		testutil.Equals(t, ErrRuleGroupNotFound, err)
+
+		// Namespaces are removed with their last group.
+		testutil.Ok(t, m.DeleteGroup(ctx, "team-a", "latency"))
+		_, err = os.Stat(filepath.Join(dir, "team-a.yaml"))
+		testutil.Assert(t, os.IsNotExist(err), "expected the namespace to be removed")
+		testutil.Equals(t, 0, len(bkt.Objects()))
+	})
+
+	t.Run("sync from bucket", func(t *testing.T) {
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, "stale.yaml"), []byte("groups: []\n"), 0o666))
+		testutil.Ok(t, bkt.Upload(ctx, "team-c.yaml", strings.NewReader("groups: []\n")))
+		testutil.Ok(t, bkt.Upload(ctx, ".ignored.yaml", strings.NewReader("groups: []\n")))
+
+		testutil.Ok(t, m.Sync(ctx))
+		files, err := filepath.Glob(m.FilesPattern())
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{filepath.Join(dir, "team-c.yaml")}, files)
+	})
+}
@@ -17,9 +17,11 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/rules"
+	"golang.org/x/sync/semaphore"
 	"gopkg.in/yaml.v3"
 
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -36,6 +38,8 @@ type Group struct {
 	*rules.Group
 	OriginalFile            string
 	PartialResponseStrategy storepb.PartialResponseStrategy
+
+	evaluations *QueryEvaluations
 }
 
 func (g Group) toProto() *rulespb.RuleGroup {
@@ -55,6 +59,7 @@ func (g Group) toProto() *rulespb.RuleGroup {
 		if r.LastError() != nil {
 			lastError = r.LastError().Error()
 		}
+		lastWarnings, lastErrorDetails := g.evaluations.details(g.PartialResponseStrategy, r, g.QueryOffset())
 
 		switch rule := r.(type) {
 		case *rules.AlertingRule:
@@ -72,7 +77,9 @@ func (g Group) toProto() *rulespb.RuleGroup {
 					LastError:                 lastError,
 					EvaluationDurationSeconds: rule.GetEvaluationDuration().Seconds(),
 					// UTC needed due to https://github.com/gogo/protobuf/issues/519.
-					LastEvaluation: rule.GetEvaluationTimestamp().UTC(),
+					LastEvaluation:   rule.GetEvaluationTimestamp().UTC(),
+					LastErrorDetails: lastErrorDetails,
+					LastWarnings:     lastWarnings,
 				}}})
 		case *rules.RecordingRule:
 			ret.Rules = append(ret.Rules, &rulespb.Rule{
@@ -84,7 +91,9 @@ func (g Group) toProto() *rulespb.RuleGroup {
 					LastError:                 lastError,
 					EvaluationDurationSeconds: rule.GetEvaluationDuration().Seconds(),
 					// UTC needed due to https://github.com/gogo/protobuf/issues/519.
-					LastEvaluation: rule.GetEvaluationTimestamp().UTC(),
+					LastEvaluation:   rule.GetEvaluationTimestamp().UTC(),
+					LastErrorDetails: lastErrorDetails,
+					LastWarnings:     lastWarnings,
 				}}})
 		default:
 			// We cannot do much, let's panic, API will recover.
@@ -122,10 +131,52 @@ type Manager struct {
 	mtx         sync.RWMutex
 	ruleFiles   map[string]string
 	externalURL string
+	// groupKeys are the keys of the rule groups of every strategy, to clean up the metrics of removed groups.
+	groupKeys map[storepb.PartialResponseStrategy]map[string]struct{}
+
+	// evalFiles are the original files of the rule files, for rule groups being evaluated. They are guarded by their own
+	// lock, as the evaluation of rule groups is waited for by updates, while holding mtx.
+	evalFilesMtx sync.RWMutex
+	evalFiles    map[string]string
+
+	groupEvalDuration *prometheus.HistogramVec
+
+	// groupFilter returns true if the rule group of the given rule file must be evaluated, e.g. when it is owned
+	// by the local ruler replica.
+	groupFilter func(file, group string) bool
+
+	evaluations  *QueryEvaluations
+	alertHistory *AlertHistory
+}
+
+// ManagerOption is a functional option for Manager.
+type ManagerOption func(m *Manager)
+
+// WithGroupFilter only loads the rule groups for which the given filter returns true, given their original rule file.
+func WithGroupFilter(filter func(file, group string) bool) ManagerOption {
+	return func(m *Manager) {
+		m.groupFilter = filter
+	}
+}
+
+// WithQueryEvaluations details the last evaluation of rules with the given query evaluations, which must be recorded
+// by the query function of the Manager.
+func WithQueryEvaluations(evaluations *QueryEvaluations) ManagerOption {
+	return func(m *Manager) {
+		m.evaluations = evaluations
+	}
+}
+
+// WithAlertHistory records the state transitions of the alerts of the evaluated rule groups in the given history.
+func WithAlertHistory(history *AlertHistory) ManagerOption {
+	return func(m *Manager) {
+		m.alertHistory = history
+	}
 }
 
 // NewManager creates new Manager.
-// QueryFunc from baseOpts will be rewritten.
+// QueryFunc from baseOpts will be rewritten. If concurrent evaluations are enabled, at most MaxConcurrentEvals
+// independent rules are evaluated concurrently across all the rule groups.
 func NewManager(
 	ctx context.Context,
 	reg prometheus.Registerer,
@@ -134,6 +185,7 @@ func NewManager(
 	queryFuncCreator func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc,
 	extLset labels.Labels,
 	externalURL string,
+	options ...ManagerOption,
 ) *Manager {
 	m := &Manager{
 		workDir:     filepath.Join(dataDir, tmpRuleDir),
@@ -141,6 +193,19 @@ func NewManager(
 		extLset:     extLset,
 		ruleFiles:   make(map[string]string),
 		externalURL: externalURL,
+		groupKeys:   make(map[storepb.PartialResponseStrategy]map[string]struct{}),
+		groupEvalDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_rule_group_evaluation_duration_seconds",
+			Help:    "The duration of rule group evaluations.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"strategy", "rule_group"}),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	// Prometheus managers bound the concurrency of their own groups only, the limit is shared by all the strategies.
+	if baseOpts.ConcurrentEvalsEnabled && baseOpts.RuleConcurrencyController == nil {
+		baseOpts.RuleConcurrencyController = newConcurrencyController(baseOpts.MaxConcurrentEvals)
 	}
 	for _, strategy := range storepb.PartialResponseStrategy_value {
 		s := storepb.PartialResponseStrategy(strategy)
@@ -188,6 +253,7 @@ func (m *Manager) RuleGroups() []Group {
 				Group:                   group,
 				OriginalFile:            m.ruleFiles[group.File()],
 				PartialResponseStrategy: s,
+				evaluations:             m.evaluations,
 			})
 		}
 	}
@@ -351,6 +417,9 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 		// which is not supported, to be able to reuse rules.Manager. The problem is that it uses yaml.UnmarshalStrict.
 		groupsByStrategy := map[storepb.PartialResponseStrategy][]configRuleAdapter{}
 		for _, rg := range rg.Groups {
+			if m.groupFilter != nil && !m.groupFilter(fn, rg.group.Name) {
+				continue
+			}
 			groupsByStrategy[*rg.PartialResponseStrategy] = append(groupsByStrategy[*rg.PartialResponseStrategy], rg)
 		}
 		for s, rg := range groupsByStrategy {
@@ -376,6 +445,10 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 		}
 	}
 
+	m.evalFilesMtx.Lock()
+	m.evalFiles = ruleFiles
+	m.evalFilesMtx.Unlock()
+
 	m.mtx.Lock()
 	for s, fs := range filesByStrategy {
 		mgr, ok := m.mgrs[s]
@@ -384,11 +457,13 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 			continue
 		}
 		// We add external labels in `pkg/alert.Queue`.
-		if err := mgr.Update(evalInterval, fs, m.extLset, m.externalURL, nil); err != nil {
+		if err := mgr.Update(evalInterval, fs, m.extLset, m.externalURL, m.evalIterationFunc(s)); err != nil {
 			// TODO(bwplotka): Prometheus logs all error details. Fix it upstream to have consistent error handling.
 			errs.Add(errors.Wrapf(err, "strategy %s, update rules", s))
 			continue
 		}
+		m.cleanupGroupMetrics(s, mgr.RuleGroups())
+		m.evaluations.retain(s, mgr.RuleGroups())
 	}
 	m.ruleFiles = ruleFiles
 	m.mtx.Unlock()
@@ -396,6 +471,64 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 	return errs.Err()
 }
 
+// evalIterationFunc returns the evaluation function of the rule groups of the given strategy, recording their evaluation
+// duration and the state transitions of their alerts.
+func (m *Manager) evalIterationFunc(s storepb.PartialResponseStrategy) rules.GroupEvalIterationFunc {
+	strategy := strings.ToLower(s.String())
+	return func(ctx context.Context, g *rules.Group, evalTimestamp time.Time) {
+		rules.DefaultEvalIterationFunc(ctx, g, evalTimestamp)
+		groupKey := m.groupKey(g)
+		m.groupEvalDuration.WithLabelValues(strategy, groupKey).Observe(g.GetEvaluationTime().Seconds())
+		if m.alertHistory != nil {
+			m.alertHistory.observeGroup(ctx, groupKey, g, evalTimestamp)
+		}
+	}
+}
+
+// groupKey returns the key of the group, with the file it was originally loaded from.
+func (m *Manager) groupKey(g *rules.Group) string {
+	m.evalFilesMtx.RLock()
+	defer m.evalFilesMtx.RUnlock()
+
+	file, ok := m.evalFiles[g.File()]
+	if !ok {
+		file = g.File()
+	}
+	return rules.GroupKey(file, g.Name())
+}
+
+// cleanupGroupMetrics deletes the metrics of the rule groups of the strategy which are not part of the given groups anymore.
+func (m *Manager) cleanupGroupMetrics(s storepb.PartialResponseStrategy, groups []*rules.Group) {
+	strategy := strings.ToLower(s.String())
+	keys := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		keys[m.groupKey(g)] = struct{}{}
+	}
+	for key := range m.groupKeys[s] {
+		if _, ok := keys[key]; !ok {
+			m.groupEvalDuration.DeleteLabelValues(strategy, key)
+		}
+	}
+	m.groupKeys[s] = keys
+}
+
+// concurrencyController bounds the number of rules evaluated concurrently by a weighted semaphore.
+type concurrencyController struct {
+	sema *semaphore.Weighted
+}
+
+func newConcurrencyController(maxConcurrency int64) *concurrencyController {
+	return &concurrencyController{sema: semaphore.NewWeighted(maxConcurrency)}
+}
+
+func (c *concurrencyController) Allow() bool {
+	return c.sema.TryAcquire(1)
+}
+
+func (c *concurrencyController) Done() {
+	c.sema.Release(1)
+}
+
 // Rules returns specified rules from manager. This is used by gRPC and locally for HTTP and UI purposes.
 func (m *Manager) Rules(r *rulespb.RulesRequest, s rulespb.Rules_RulesServer) (err error) {
 	groups := m.protoRuleGroups()
@@ -425,6 +558,11 @@ func (m *Manager) Rules(r *rulespb.RulesRequest, s rulespb.Rules_RulesServer) (e
 
 	enrichRulesWithExtLabels(pgs, m.extLset)
 
+	pgs, err = selectGroups(pgs, r)
+	if err != nil {
+		return err
+	}
+
 	for _, pg := range pgs {
 		tracing.DoInSpan(s.Context(), "send_rule_group_response", func(_ context.Context) {
 			err = s.Send(&rulespb.RulesResponse{Result: &rulespb.RulesResponse_Group{Group: pg}})
@@ -11,12 +11,14 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
@@ -121,6 +123,177 @@ groups:
 	testutil.Equals(t, "rate(some_metric[1h:5m] offset 1d)", query)
 }
 
+func TestRun_ConcurrentEvals(t *testing.T) {
+	dir := t.TempDir()
+
+	ruleFile := filepath.Join(dir, "rule.yaml")
+	testutil.Ok(t, os.WriteFile(ruleFile, []byte(`
+groups:
+- name: "independent rules"
+  partial_response_strategy: "warn"
+  rules:
+  - record: "a"
+    expr: "up"
+  - record: "b"
+    expr: "vector(1)"
+`), os.ModePerm))
+
+	var (
+		// Every query waits for the other one, which only completes if both rules are evaluated concurrently.
+		inflight sync.WaitGroup
+		evalDone = make(chan struct{})
+		evalOnce sync.Once
+		timedOut atomic.Bool
+	)
+	inflight.Add(2)
+	reg := prometheus.NewRegistry()
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		reg,
+		dir,
+		rules.ManagerOptions{
+			Logger:                 log.NewLogfmtLogger(os.Stderr),
+			Context:                context.Background(),
+			Appendable:             nopAppendable{},
+			Queryable:              nopQueryable{},
+			ConcurrentEvalsEnabled: true,
+			MaxConcurrentEvals:     1,
+		},
+		func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+				evalOnce.Do(func() {
+					go func() {
+						inflight.Wait()
+						close(evalDone)
+					}()
+				})
+				inflight.Done()
+				select {
+				case <-evalDone:
+				case <-time.After(5 * time.Second):
+					timedOut.Store(true)
+				}
+				return promql.Vector{}, nil
+			}
+		},
+		labels.FromStrings("replica", "1"),
+		"http://localhost",
+	)
+	testutil.Ok(t, thanosRuleMgr.Update(1*time.Second, []string{ruleFile}))
+
+	thanosRuleMgr.Run()
+	defer thanosRuleMgr.Stop()
+
+	select {
+	case <-time.After(1 * time.Minute):
+		t.Fatal("timeout while waiting on concurrent rule evaluations")
+	case <-evalDone:
+	}
+	testutil.Assert(t, !timedOut.Load(), "expected rules to be evaluated concurrently")
+
+	// The evaluation duration of the group, with its original file, is recorded once its evaluation completes.
+	testutil.Ok(t, runutil.Retry(100*time.Millisecond, nil, func() error {
+		if c := promtestutil.CollectAndCount(thanosRuleMgr.groupEvalDuration); c != 1 {
+			return errors.Errorf("expected one group evaluation duration series, got %d", c)
+		}
+		return nil
+	}))
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "thanos_rule_group_evaluation_duration_seconds" {
+			continue
+		}
+		m := mf.GetMetric()[0]
+		testutil.Equals(t, "rule_group", m.GetLabel()[0].GetName())
+		testutil.Equals(t, rules.GroupKey(ruleFile, "independent rules"), m.GetLabel()[0].GetValue())
+		testutil.Equals(t, "warn", m.GetLabel()[1].GetValue())
+		testutil.Assert(t, m.GetHistogram().GetSampleCount() > 0)
+		found = true
+	}
+	testutil.Assert(t, found, "expected the group evaluation duration metric")
+
+	// The metrics of removed groups are deleted.
+	testutil.Ok(t, thanosRuleMgr.Update(1*time.Second, nil))
+	testutil.Equals(t, 0, promtestutil.CollectAndCount(thanosRuleMgr.groupEvalDuration))
+}
+
+func TestRun_QueryOffset(t *testing.T) {
+	dir := t.TempDir()
+
+	ruleFile := filepath.Join(dir, "rule.yaml")
+	testutil.Ok(t, os.WriteFile(ruleFile, []byte(`
+groups:
+- name: "with query offset"
+  partial_response_strategy: "warn"
+  query_offset: 5m
+  rules:
+  - record: "a"
+    expr: "up"
+- name: "with default query offset"
+  partial_response_strategy: "abort"
+  rules:
+  - record: "b"
+    expr: "vector(1)"
+`), os.ModePerm))
+
+	var (
+		mtx     sync.Mutex
+		queries = map[string]time.Time{}
+	)
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		nil,
+		dir,
+		rules.ManagerOptions{
+			Logger:                 log.NewLogfmtLogger(os.Stderr),
+			Context:                context.Background(),
+			Appendable:             nopAppendable{},
+			Queryable:              nopQueryable{},
+			DefaultRuleQueryOffset: func() time.Duration { return time.Minute },
+		},
+		func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				queries[q] = t
+				return promql.Vector{}, nil
+			}
+		},
+		labels.FromStrings("replica", "1"),
+		"http://localhost",
+	)
+	testutil.Ok(t, thanosRuleMgr.Update(1*time.Second, []string{ruleFile}))
+
+	offsets := map[string]time.Duration{}
+	for _, g := range thanosRuleMgr.RuleGroups() {
+		offsets[g.Name()] = g.QueryOffset()
+	}
+	testutil.Equals(t, map[string]time.Duration{"with query offset": 5 * time.Minute, "with default query offset": time.Minute}, offsets)
+
+	thanosRuleMgr.Run()
+
+	// Rule queries are evaluated at the evaluation timestamp of their group minus its query offset.
+	testutil.Ok(t, runutil.Retry(100*time.Millisecond, nil, func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(queries) != 2 {
+			return errors.Errorf("expected queries of both rules, got %v", queries)
+		}
+		return nil
+	}))
+	// Stop evaluations, so that the last queries are the ones of the last evaluations of the rules.
+	thanosRuleMgr.Stop()
+	for _, g := range thanosRuleMgr.RuleGroups() {
+		r := g.Rules()[0]
+		ts := queries[r.Query().String()]
+		// The evaluation timestamp of rules is the time they are evaluated, after the one of their group.
+		lag := r.GetEvaluationTimestamp().Sub(ts) - offsets[g.Name()]
+		testutil.Assert(t, lag >= 0 && lag < time.Second, "unexpected query timestamp %v of group %q evaluated at %v", ts, g.Name(), r.GetEvaluationTimestamp())
+	}
+}
+
 func TestUpdate_Error_UpdatePartial(t *testing.T) {
 	dir := t.TempDir()
 	dataDir := t.TempDir()
@@ -4,8 +4,11 @@
 package rules
 
 import (
+	"container/heap"
 	"context"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -22,8 +25,29 @@ import (
 
 // Proxy implements rulespb.Rules gRPC that fanouts requests to given rulespb.Rules and deduplication on the way.
 type Proxy struct {
-	logger log.Logger
-	rules  func() []rulespb.RulesClient
+	logger          log.Logger
+	rules           func() []rulespb.RulesClient
+	endpointTimeout time.Duration
+	tenantLabel     string
+}
+
+// ProxyOption configures the rules Proxy.
+type ProxyOption func(*Proxy)
+
+// WithEndpointTimeout sets the maximum time spent receiving the rule groups of every rules client. Time spent waiting
+// for other rules clients, e.g. to merge sorted rule groups, is not counted. Rules clients exceeding it are handled
+// as failed ones, according to the partial response strategy of the request. 0 disables it.
+func WithEndpointTimeout(timeout time.Duration) ProxyOption {
+	return func(p *Proxy) {
+		p.endpointTimeout = timeout
+	}
+}
+
+// WithTenantLabel sets the name of the external label the tenants of the sources of rule groups are read from.
+func WithTenantLabel(name string) ProxyOption {
+	return func(p *Proxy) {
+		p.tenantLabel = name
+	}
 }
 
 func RegisterRulesServer(rulesSrv rulespb.RulesServer) func(*grpc.Server) {
@@ -33,17 +57,25 @@ func RegisterRulesServer(rulesSrv rulespb.RulesServer) func(*grpc.Server) {
 }
 
 // NewProxy returns new rules.Proxy.
-func NewProxy(logger log.Logger, rules func() []rulespb.RulesClient) *Proxy {
-	return &Proxy{
+func NewProxy(logger log.Logger, rules func() []rulespb.RulesClient, opts ...ProxyOption) *Proxy {
+	p := &Proxy{
 		logger: logger,
 		rules:  rules,
 	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
 }
 
 func (s *Proxy) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer) error {
 	span, ctx := tracing.StartSpan(srv.Context(), "proxy_rules")
 	defer span.Finish()
 
+	if req.SortedGroups {
+		return s.mergeRules(ctx, req, srv)
+	}
+
 	var (
 		g, gctx  = errgroup.WithContext(ctx)
 		respChan = make(chan *rulespb.RuleGroup, 10)
@@ -53,10 +85,12 @@ func (s *Proxy) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer)
 
 	for _, rulesClient := range s.rules() {
 		rs := &rulesStream{
-			client:  rulesClient,
-			request: req,
-			channel: respChan,
-			server:  srv,
+			client:      rulesClient,
+			request:     req,
+			channel:     respChan,
+			server:      srv,
+			timeout:     s.endpointTimeout,
+			tenantLabel: s.tenantLabel,
 		}
 		g.Go(func() error { return rs.receive(gctx) })
 	}
@@ -75,6 +109,11 @@ func (s *Proxy) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer)
 		return err
 	}
 
+	groups, err = selectGroups(groups, req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	for _, g := range groups {
 		tracing.DoInSpan(srv.Context(), "send_rules_response", func(_ context.Context) {
 			err = srv.Send(rulespb.NewRuleGroupRulesResponse(g))
@@ -87,11 +126,189 @@ func (s *Proxy) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer)
 	return nil
 }
 
+// mergeRules sends the rule groups of all the rules clients sorted by key, merging the sorted streams of the
+// rules clients as they are received instead of buffering all of them.
+func (s *Proxy) mergeRules(ctx context.Context, req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer) error {
+	matcherSets, err := parseMatcherSets(req.MatcherString)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		g, gctx = errgroup.WithContext(ctx)
+		// Warnings are sent by the streams while groups are being merged.
+		lsrv    = &lockedRulesServer{Rules_RulesServer: srv}
+		streams = make(groupStreams, 0, len(s.rules()))
+	)
+	for _, rulesClient := range s.rules() {
+		ch := make(chan *rulespb.RuleGroup, 10)
+		rs := &rulesStream{
+			client:      rulesClient,
+			request:     req,
+			channel:     ch,
+			server:      lsrv,
+			timeout:     s.endpointTimeout,
+			tenantLabel: s.tenantLabel,
+		}
+		g.Go(func() error {
+			defer close(ch)
+			return rs.receive(gctx)
+		})
+		streams = append(streams, &groupStream{ch: ch})
+	}
+
+	h := streams[:0]
+	for _, st := range streams {
+		if st.next() {
+			h = append(h, st)
+		}
+	}
+	heap.Init(&h)
+
+	var (
+		keys    int64
+		lastKey string
+	)
+	for h.Len() > 0 {
+		group := h[0].head
+		if h[0].next() {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+
+		// Groups are selected as in selectGroups, one at a time. Servers already cut their page, the
+		// remaining groups are drained so that streams are not canceled.
+		if group.Key() < req.GroupNextToken || len(filterRules(filterGroups([]*rulespb.RuleGroup{group}, req), matcherSets)) == 0 {
+			continue
+		}
+		if group.Key() != lastKey {
+			keys++
+			lastKey = group.Key()
+		}
+		if req.GroupLimit > 0 && keys > req.GroupLimit+1 {
+			continue
+		}
+
+		tracing.DoInSpan(ctx, "send_rules_response", func(_ context.Context) {
+			err = lsrv.Send(rulespb.NewRuleGroupRulesResponse(group))
+		})
+		if err != nil {
+			cancel()
+			_ = g.Wait()
+			return status.Error(codes.Unknown, errors.Wrap(err, "send rules response").Error())
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		level.Error(s.logger).Log("err", err)
+		return err
+	}
+	return nil
+}
+
+// lockedRulesServer allows to send responses concurrently.
+type lockedRulesServer struct {
+	rulespb.Rules_RulesServer
+	mu sync.Mutex
+}
+
+func (srv *lockedRulesServer) Send(res *rulespb.RulesResponse) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.Rules_RulesServer.Send(res)
+}
+
+// groupStream is the sorted stream of rule groups of a rules client.
+type groupStream struct {
+	ch   <-chan *rulespb.RuleGroup
+	head *rulespb.RuleGroup
+}
+
+// next receives the next group of the stream, it returns false once the stream is over.
+func (st *groupStream) next() bool {
+	var ok bool
+	st.head, ok = <-st.ch
+	return ok
+}
+
+// groupStreams is a heap of streams, ordered by the key of their next group.
+type groupStreams []*groupStream
+
+func (h groupStreams) Len() int           { return len(h) }
+func (h groupStreams) Less(i, j int) bool { return h[i].head.Compare(h[j].head) < 0 }
+func (h groupStreams) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *groupStreams) Push(x interface{}) { *h = append(*h, x.(*groupStream)) }
+
+func (h *groupStreams) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
 type rulesStream struct {
 	client  rulespb.RulesClient
 	request *rulespb.RulesRequest
 	channel chan<- *rulespb.RuleGroup
 	server  rulespb.Rules_RulesServer
+	timeout time.Duration
+	// tenantLabel is the name of the external label of the tenant of the rules client.
+	tenantLabel string
+}
+
+// groupSource returns the source of the given rule group received from the endpoint with the given source.
+func groupSource(endpoint *rulespb.RuleGroupSource, group *rulespb.RuleGroup, tenantLabel string) *rulespb.RuleGroupSource {
+	src := *endpoint
+	src.File = group.File
+	if tenantLabel == "" {
+		return &src
+	}
+	for _, ls := range src.LabelSets {
+		if tenant := ls.PromLabels().Get(tenantLabel); tenant != "" {
+			src.Tenant = tenant
+			break
+		}
+	}
+	return &src
+}
+
+// streamBudget cancels a stream once it spent its timeout receiving, not counting the time it is paused.
+type streamBudget struct {
+	remaining time.Duration
+	resumed   time.Time
+	timer     *time.Timer
+}
+
+func newStreamBudget(timeout time.Duration, cancel func()) *streamBudget {
+	if timeout <= 0 {
+		return nil
+	}
+	return &streamBudget{remaining: timeout, resumed: time.Now(), timer: time.AfterFunc(timeout, cancel)}
+}
+
+func (b *streamBudget) pause() {
+	if b != nil && b.timer.Stop() {
+		b.remaining -= time.Since(b.resumed)
+	}
+}
+
+func (b *streamBudget) resume() {
+	if b != nil {
+		b.resumed = time.Now()
+		b.timer.Reset(b.remaining)
+	}
+}
+
+func (b *streamBudget) stop() {
+	if b != nil {
+		b.timer.Stop()
+	}
 }
 
 func (stream *rulesStream) receive(ctx context.Context) error {
@@ -100,12 +317,25 @@ func (stream *rulesStream) receive(ctx context.Context) error {
 		rules rulespb.Rules_RulesClient
 	)
 
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	errTimeout := errors.Errorf("timeout of %v exceeded", stream.timeout)
+	budget := newStreamBudget(stream.timeout, func() { cancel(errTimeout) })
+	defer budget.stop()
+	// timedOut replaces errors caused by the cancellation of the stream once its budget is spent.
+	timedOut := func(err error) error {
+		if context.Cause(ctx) == errTimeout {
+			return errTimeout
+		}
+		return err
+	}
+
 	tracing.DoInSpan(ctx, "receive_stream_request", func(ctx context.Context) {
 		rules, err = stream.client.Rules(ctx, stream.request)
 	})
 
 	if err != nil {
-		err = errors.Wrapf(err, "fetching rules from rules client %v", stream.client)
+		err = errors.Wrapf(timedOut(err), "fetching rules from rules client %v", stream.client)
 
 		if stream.request.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT {
 			return err
@@ -118,17 +348,24 @@ func (stream *rulesStream) receive(ctx context.Context) error {
 		return nil
 	}
 
+	var lastKey string
 	for {
 		rule, err := rules.Recv()
 		if err == io.EOF {
 			return nil
 		}
+		if err == nil && stream.request.SortedGroups && rule.GetGroup() != nil {
+			if rule.GetGroup().Key() < lastKey {
+				err = errors.Errorf("rule group %s received after %s, rule groups are not sorted", rule.GetGroup().Key(), lastKey)
+			}
+			lastKey = rule.GetGroup().Key()
+		}
 
 		if err != nil {
 			// An error happened in Recv(), hence the underlying stream is aborted
 			// as per https://github.com/grpc/grpc-go/blob/7f2581f910fc21497091c4109b56d310276fc943/stream.go#L117-L125.
 			// We must not continue receiving additional data from it and must return.
-			err = errors.Wrapf(err, "receiving rules from rules client %v", stream.client)
+			err = errors.Wrapf(timedOut(err), "receiving rules from rules client %v", stream.client)
 
 			if stream.request.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT {
 				return err
@@ -150,10 +387,21 @@ func (stream *rulesStream) receive(ctx context.Context) error {
 			continue
 		}
 
+		group := rule.GetGroup()
+		// Groups proxied by other queriers are already annotated with the endpoints they come from.
+		if c, ok := stream.client.(*rulespb.EndpointRulesClient); ok && group != nil && len(group.Sources) == 0 {
+			group.Sources = []*rulespb.RuleGroupSource{groupSource(c.Source, group, stream.tenantLabel)}
+		}
+
+		// Time spent waiting for the rule groups to be consumed is not counted in the budget of the stream.
+		budget.pause()
 		select {
-		case stream.channel <- rule.GetGroup():
+		case stream.channel <- group:
 		case <-ctx.Done():
-			return ctx.Err()
+			if context.Cause(ctx) != errTimeout {
+				return ctx.Err()
+			}
 		}
+		budget.resume()
 	}
 }
@@ -5,16 +5,22 @@ package rules
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/efficientgo/core/testutil"
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -276,3 +282,174 @@ func TestProxyDataRace(t *testing.T) {
 	}
 	_ = p.Rules(req, s)
 }
+
+// groupsRulesClient streams the rule groups selected by requests, as rules servers do. If unsorted,
+// it ignores requests asking for sorted groups.
+type groupsRulesClient struct {
+	groups   []*rulespb.RuleGroup
+	unsorted bool
+}
+
+func (c *groupsRulesClient) Rules(_ context.Context, in *rulespb.RulesRequest, _ ...grpc.CallOption) (rulespb.Rules_RulesClient, error) {
+	groups := make([]*rulespb.RuleGroup, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, proto.Clone(g).(*rulespb.RuleGroup))
+	}
+	req := *in
+	if c.unsorted {
+		req.SortedGroups = false
+	}
+	groups, err := selectGroups(groups, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &groupsRulesStream{groups: groups}, nil
+}
+
+type groupsRulesStream struct {
+	grpc.ClientStream
+	groups []*rulespb.RuleGroup
+}
+
+func (s *groupsRulesStream) Recv() (*rulespb.RulesResponse, error) {
+	if len(s.groups) == 0 {
+		return nil, io.EOF
+	}
+	g := s.groups[0]
+	s.groups = s.groups[1:]
+	return rulespb.NewRuleGroupRulesResponse(g), nil
+}
+
+// hangingRulesClient never sends rule groups, until its stream is canceled.
+type hangingRulesClient struct{}
+
+func (c *hangingRulesClient) Rules(ctx context.Context, _ *rulespb.RulesRequest, _ ...grpc.CallOption) (rulespb.Rules_RulesClient, error) {
+	return &hangingRulesStream{ctx: ctx}, nil
+}
+
+type hangingRulesStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s *hangingRulesStream) Recv() (*rulespb.RulesResponse, error) {
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func TestProxyEndpointTimeout(t *testing.T) {
+	// More groups than buffered by the proxy, so that the stream waits for the hanging one while groups are merged.
+	var groups []*rulespb.RuleGroup
+	for i := 0; i < 30; i++ {
+		groups = append(groups, &rulespb.RuleGroup{Name: fmt.Sprintf("group-%02d", i)})
+	}
+	proxy := NewProxy(log.NewNopLogger(), func() []rulespb.RulesClient {
+		return []rulespb.RulesClient{&groupsRulesClient{groups: groups}, &hangingRulesClient{}}
+	}, WithEndpointTimeout(100*time.Millisecond))
+
+	for _, client := range []*GRPCClient{NewGRPCClientWithDedup(proxy, nil), NewGRPCClientWithSortedDedup(proxy, nil)} {
+		_, _, err := client.Rules(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT})
+		testutil.NotOk(t, err)
+
+		res, warnings, err := client.Rules(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_WARN})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(warnings))
+		for w := range warnings {
+			testutil.Assert(t, strings.Contains(w, "timeout of 100ms exceeded"), "unexpected warning %s", w)
+		}
+		testutil.Equals(t, len(groups), len(res.Groups))
+	}
+}
+
+func TestProxySortedDedup(t *testing.T) {
+	group := func(name, replica string) *rulespb.RuleGroup {
+		return &rulespb.RuleGroup{
+			Name: name,
+			Rules: []*rulespb.Rule{
+				rulespb.NewRecordingRule(&rulespb.RecordingRule{
+					Name: "r" + name, Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+						{Name: "job", Value: name},
+						{Name: "replica", Value: replica},
+					}},
+				}),
+			},
+		}
+	}
+	proxy := NewProxy(log.NewNopLogger(), func() []rulespb.RulesClient {
+		return []rulespb.RulesClient{
+			&groupsRulesClient{groups: []*rulespb.RuleGroup{group("d", "1"), group("a", "1"), group("b", "1"), group("c", "1")}},
+			&groupsRulesClient{groups: []*rulespb.RuleGroup{group("b", "2"), group("e", "2"), group("c", "2"), group("d", "2")}},
+			&groupsRulesClient{groups: []*rulespb.RuleGroup{group("e", "3"), group("a", "3")}},
+		}
+	})
+	buffered := NewGRPCClientWithDedup(proxy, []string{"replica"})
+	sorted := NewGRPCClientWithSortedDedup(proxy, []string{"replica"})
+
+	// Groups deduplicated as they are received are the same as the ones deduplicated once all of them are received.
+	for _, req := range []*rulespb.RulesRequest{
+		{},
+		{GroupLimit: 2},
+		{GroupLimit: 2, GroupNextToken: ";c"},
+		{GroupLimit: 2, GroupNextToken: ";e"},
+		{GroupLimit: 1, MatcherString: []string{`{job=~"b|d|e"}`}},
+		{RuleGroup: []string{"c", "e"}},
+	} {
+		want, _, err := buffered.Rules(context.Background(), req)
+		testutil.Ok(t, err)
+		got, _, err := sorted.Rules(context.Background(), req)
+		testutil.Ok(t, err)
+		testutil.Equals(t, want, got)
+	}
+
+	unsorted := NewGRPCClientWithSortedDedup(NewProxy(log.NewNopLogger(), func() []rulespb.RulesClient {
+		return []rulespb.RulesClient{&groupsRulesClient{groups: []*rulespb.RuleGroup{group("b", "1"), group("a", "1")}, unsorted: true}}
+	}), nil)
+	_, _, err := unsorted.Rules(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT})
+	testutil.NotOk(t, err)
+
+	groups, warnings, err := unsorted.Rules(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_WARN})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(warnings))
+	testutil.Equals(t, 1, len(groups.Groups))
+	testutil.Equals(t, "b", groups.Groups[0].Name)
+}
+
+func TestProxyRuleGroupSources(t *testing.T) {
+	source := func(endpoint, cluster string) *rulespb.RuleGroupSource {
+		return &rulespb.RuleGroupSource{
+			Endpoint: endpoint,
+			LabelSets: []labelpb.ZLabelSet{
+				{Labels: []labelpb.ZLabel{{Name: "cluster", Value: cluster}}},
+				{Labels: []labelpb.ZLabel{{Name: "cluster", Value: cluster}, {Name: "tenant_id", Value: "team-" + cluster}}},
+			},
+		}
+	}
+	groupSource := func(endpoint, cluster, file string) *rulespb.RuleGroupSource {
+		src := source(endpoint, cluster)
+		src.File = file
+		src.Tenant = "team-" + cluster
+		return src
+	}
+	endpoint := func(src *rulespb.RuleGroupSource, groups ...*rulespb.RuleGroup) rulespb.RulesClient {
+		return &rulespb.EndpointRulesClient{RulesClient: &groupsRulesClient{groups: groups}, Source: src}
+	}
+	proxy := NewProxy(log.NewNopLogger(), func() []rulespb.RulesClient {
+		return []rulespb.RulesClient{
+			endpoint(source("ruler-2:10901", "eu"), &rulespb.RuleGroup{Name: "a", File: "a.yaml"}),
+			endpoint(source("ruler-1:10901", "eu"), &rulespb.RuleGroup{Name: "a", File: "a.yaml"}, &rulespb.RuleGroup{Name: "b", File: "b.yaml"}),
+			// Groups of nested queriers keep the endpoints they come from.
+			endpoint(source("querier:10901", "us"), &rulespb.RuleGroup{Name: "c", File: "c.yaml", Sources: []*rulespb.RuleGroupSource{groupSource("ruler-3:10901", "us", "c.yaml")}}),
+		}
+	}, WithTenantLabel("tenant_id"))
+
+	want := []*rulespb.RuleGroup{
+		{Name: "a", File: "a.yaml", Sources: []*rulespb.RuleGroupSource{groupSource("ruler-1:10901", "eu", "a.yaml"), groupSource("ruler-2:10901", "eu", "a.yaml")}},
+		{Name: "b", File: "b.yaml", Sources: []*rulespb.RuleGroupSource{groupSource("ruler-1:10901", "eu", "b.yaml")}},
+		{Name: "c", File: "c.yaml", Sources: []*rulespb.RuleGroupSource{groupSource("ruler-3:10901", "us", "c.yaml")}},
+	}
+	for _, client := range []*GRPCClient{NewGRPCClientWithDedup(proxy, nil), NewGRPCClientWithSortedDedup(proxy, nil)} {
+		groups, _, err := client.Rules(context.Background(), &rulespb.RulesRequest{})
+		testutil.Ok(t, err)
+		testutil.Equals(t, want, groups.Groups)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package remotewrite implements the Remote Write 2.0 sending of the stateless ruler, for which the vendored
+// Prometheus remote storage only supports Remote Write 1.0.
+package remotewrite
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/config"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+)
+
+// ProtoMessageV1 is the name of the Remote Write 1.0 message, sent if remote write configs set no protobuf message.
+const ProtoMessageV1 = "prometheus.WriteRequest"
+
+// Config is a remote write config of the stateless ruler: the Prometheus one, with the protobuf message of the
+// protocol to send series with.
+type Config struct {
+	config.RemoteWriteConfig
+
+	// ProtobufMessage is either prometheus.WriteRequest, for Remote Write 1.0, or io.prometheus.write.v2.Request,
+	// for Remote Write 2.0.
+	ProtobufMessage string
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.RemoteWriteConfig); err != nil {
+		return err
+	}
+	var msg struct {
+		ProtobufMessage string `yaml:"protobuf_message"`
+	}
+	if err := unmarshal(&msg); err != nil {
+		return err
+	}
+	switch msg.ProtobufMessage {
+	case "":
+		c.ProtobufMessage = ProtoMessageV1
+	case ProtoMessageV1, writev2pb.ProtoMessage:
+		c.ProtobufMessage = msg.ProtobufMessage
+	default:
+		return errors.Errorf("unknown protobuf_message %q, expected %q (Remote Write 1.0) or %q (Remote Write 2.0)", msg.ProtobufMessage, ProtoMessageV1, writev2pb.ProtoMessage)
+	}
+	return nil
+}
+
+// IsV2 returns true if series are sent with Remote Write 2.0.
+func (c *Config) IsV2() bool {
+	return c.ProtobufMessage == writev2pb.ProtoMessage
+}
+
+// LoadConfigs parses the remote write configs of the given YAML remote write config.
+func LoadConfigs(content []byte) ([]*Config, error) {
+	var cfg struct {
+		RemoteWriteConfigs []*Config `yaml:"remote_write,omitempty"`
+	}
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing remote write config YAML")
+	}
+	return cfg.RemoteWriteConfigs, nil
+}
@@ -0,0 +1,492 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+
+	"github.com/thanos-io/thanos/pkg/clientconfig"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+)
+
+const (
+	// ContentTypeV2 is the content type of Remote Write 2.0 requests.
+	ContentTypeV2 = "application/x-protobuf;proto=" + writev2pb.ProtoMessage
+	// VersionV2 is the version of the protocol sent in the X-Prometheus-Remote-Write-Version header.
+	VersionV2 = "2.0.0"
+)
+
+// WriteV2Storage sends the series appended to the WAL of the stateless ruler to the Remote Write 2.0 endpoints,
+// like the Prometheus remote storage does for the Remote Write 1.0 ones. Each endpoint tails the WAL, so that series
+// are buffered in it while the endpoint is unavailable, and retries failed requests with the backoff of its queue
+// config.
+type WriteV2Storage struct {
+	writers []*writerV2
+}
+
+// NewWriteV2Storage returns a storage sending the series of the WAL of dir to the endpoints of the given configs,
+// which must all be Remote Write 2.0 ones. External labels are added to the series which do not have them.
+func NewWriteV2Storage(logger log.Logger, reg prometheus.Registerer, dir string, externalLabels labels.Labels, cfgs []*Config) (*WriteV2Storage, error) {
+	m := newWriterV2Metrics(reg)
+	// The WAL watcher metrics are registered by the Prometheus remote storage already.
+	watcherMetrics := wlog.NewWatcherMetrics(nil)
+	readerMetrics := wlog.NewLiveReaderMetrics(nil)
+
+	s := &WriteV2Storage{}
+	for _, cfg := range cfgs {
+		if !cfg.IsV2() {
+			return nil, errors.Errorf("remote write config %q: unexpected protobuf_message %q", cfg.Name, cfg.ProtobufMessage)
+		}
+		if cfg.SigV4Config != nil || cfg.AzureADConfig != nil {
+			return nil, errors.Errorf("remote write config %q: sigv4 and azuread are not supported with Remote Write 2.0", cfg.Name)
+		}
+		client, err := config_util.NewClientFromConfig(cfg.HTTPClientConfig, "remote_write_v2")
+		if err != nil {
+			return nil, errors.Wrapf(err, "remote write config %q: creating HTTP client", cfg.Name)
+		}
+
+		url := cfg.URL.Redacted()
+		w := &writerV2{
+			logger:          log.With(logger, "remote_name", cfg.Name, "url", url),
+			cfg:             cfg,
+			client:          client,
+			externalLabels:  externalLabels,
+			samplesSent:     m.samplesSent.WithLabelValues(cfg.Name, url),
+			histogramsSent:  m.histogramsSent.WithLabelValues(cfg.Name, url),
+			samplesFailed:   m.samplesFailed.WithLabelValues(cfg.Name, url),
+			requestsRetried: m.requestsRetried.WithLabelValues(cfg.Name, url),
+			series:          map[chunks.HeadSeriesRef]seriesV2{},
+			seriesSegment:   map[chunks.HeadSeriesRef]int{},
+			quit:            make(chan struct{}),
+			done:            make(chan struct{}),
+		}
+		// Like the Prometheus remote storage, native histograms are only read from the WAL if they are sent.
+		w.watcher = wlog.NewWatcher(watcherMetrics, readerMetrics, w.logger, "remote-write-v2-"+cfg.Name, w, dir, false, cfg.SendNativeHistograms)
+		s.writers = append(s.writers, w)
+	}
+	return s, nil
+}
+
+// Start starts tailing the WAL. Only the samples appended from then on are sent.
+func (s *WriteV2Storage) Start() {
+	for _, w := range s.writers {
+		w.watcher.Start()
+		go w.run()
+	}
+}
+
+// Notify notifies the endpoints that series were appended to the WAL, implementing wlog.WriteNotified.
+func (s *WriteV2Storage) Notify() {
+	for _, w := range s.writers {
+		w.watcher.Notify()
+	}
+}
+
+// Stop stops tailing the WAL, once the pending samples were sent, without retrying.
+func (s *WriteV2Storage) Stop() {
+	for _, w := range s.writers {
+		close(w.quit)
+		w.watcher.Stop()
+		<-w.done
+	}
+}
+
+// WALTruncationStorage returns the remote storage the agent truncating the WAL of dir is opened with. The agent only
+// keeps the samples newer than the lowest timestamp sent by the queues of the given remote storage, which sends the
+// Remote Write 1.0 configs, and would drop the samples not sent to the Remote Write 2.0 endpoints yet. If any of cfgs
+// is a Remote Write 2.0 one, a remote storage without queues is returned instead, so that the WAL is only truncated
+// past the max WAL time of the agent, as when all the endpoints are unavailable.
+func WALTruncationStorage(logger log.Logger, remoteStore *remote.Storage, dir string, cfgs []*Config) *remote.Storage {
+	for _, cfg := range cfgs {
+		if cfg.IsV2() {
+			return remote.NewStorage(logger, nil, func() (int64, error) { return 0, nil }, dir, time.Minute, nil)
+		}
+	}
+	return remoteStore
+}
+
+// WriteNotifiers notifies all of its notifiers of each write to the WAL.
+type WriteNotifiers []wlog.WriteNotified
+
+// Notify implements wlog.WriteNotified.
+func (ns WriteNotifiers) Notify() {
+	for _, n := range ns {
+		n.Notify()
+	}
+}
+
+type writerV2Metrics struct {
+	samplesSent     *prometheus.CounterVec
+	histogramsSent  *prometheus.CounterVec
+	samplesFailed   *prometheus.CounterVec
+	requestsRetried *prometheus.CounterVec
+}
+
+func newWriterV2Metrics(reg prometheus.Registerer) *writerV2Metrics {
+	labelNames := []string{"remote_name", "url"}
+	return &writerV2Metrics{
+		samplesSent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_remote_write_v2_samples_sent_total",
+			Help: "Total number of float samples sent with Remote Write 2.0.",
+		}, labelNames),
+		histogramsSent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_remote_write_v2_histograms_sent_total",
+			Help: "Total number of native histogram samples sent with Remote Write 2.0.",
+		}, labelNames),
+		samplesFailed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_remote_write_v2_samples_failed_total",
+			Help: "Total number of float and native histogram samples which could not be sent with Remote Write 2.0 because of non-recoverable errors, or pending at shutdown.",
+		}, labelNames),
+		requestsRetried: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_remote_write_v2_requests_retried_total",
+			Help: "Total number of Remote Write 2.0 requests retried because of recoverable errors.",
+		}, labelNames),
+	}
+}
+
+// seriesV2 is a series read from the WAL, with the external labels and write relabeling applied.
+type seriesV2 struct {
+	lset       labels.Labels
+	metricType prompb.MetricMetadata_MetricType
+}
+
+// pendingSample is a float or native histogram sample waiting to be sent.
+type pendingSample struct {
+	ref       chunks.HeadSeriesRef
+	sample    prompb.Sample
+	histogram *prompb.Histogram
+}
+
+// writerV2 sends the series read from the WAL by its watcher to a Remote Write 2.0 endpoint. Samples are sent in
+// batches of the max samples per send of its queue config, or every batch send deadline. The watcher is blocked while
+// requests are retried, leaving the samples in the WAL.
+type writerV2 struct {
+	logger         log.Logger
+	cfg            *Config
+	client         *http.Client
+	externalLabels labels.Labels
+	watcher        *wlog.Watcher
+
+	samplesSent     prometheus.Counter
+	histogramsSent  prometheus.Counter
+	samplesFailed   prometheus.Counter
+	requestsRetried prometheus.Counter
+
+	mtx           sync.Mutex
+	series        map[chunks.HeadSeriesRef]seriesV2
+	seriesSegment map[chunks.HeadSeriesRef]int
+	pending       []pendingSample
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+func (w *writerV2) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(time.Duration(w.cfg.QueueConfig.BatchSendDeadline))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.quit:
+			w.mtx.Lock()
+			w.flushLocked()
+			w.mtx.Unlock()
+			return
+		case <-ticker.C:
+			w.mtx.Lock()
+			w.flushLocked()
+			w.mtx.Unlock()
+		}
+	}
+}
+
+// Append implements wlog.WriteTo.
+func (w *writerV2) Append(samples []record.RefSample) bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, s := range samples {
+		if !w.appendLocked(pendingSample{ref: s.Ref, sample: prompb.Sample{Timestamp: s.T, Value: s.V}}) {
+			return false
+		}
+	}
+	return true
+}
+
+// AppendExemplars implements wlog.WriteTo. Rules produce no exemplars.
+func (w *writerV2) AppendExemplars([]record.RefExemplar) bool { return true }
+
+// AppendHistograms implements wlog.WriteTo.
+func (w *writerV2) AppendHistograms(samples []record.RefHistogramSample) bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, s := range samples {
+		w.setHistogramTypeLocked(s.Ref, s.H.CounterResetHint)
+		h := prompb.HistogramToHistogramProto(s.T, s.H)
+		if !w.appendLocked(pendingSample{ref: s.Ref, histogram: &h}) {
+			return false
+		}
+	}
+	return true
+}
+
+// AppendFloatHistograms implements wlog.WriteTo.
+func (w *writerV2) AppendFloatHistograms(samples []record.RefFloatHistogramSample) bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, s := range samples {
+		w.setHistogramTypeLocked(s.Ref, s.FH.CounterResetHint)
+		h := prompb.FloatHistogramToHistogramProto(s.T, s.FH)
+		if !w.appendLocked(pendingSample{ref: s.Ref, histogram: &h}) {
+			return false
+		}
+	}
+	return true
+}
+
+// StoreSeries implements wlog.WriteTo.
+func (w *writerV2) StoreSeries(series []record.RefSeries, index int) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, s := range series {
+		w.seriesSegment[s.Ref] = index
+
+		lb := labels.NewBuilder(s.Labels)
+		w.externalLabels.Range(func(l labels.Label) {
+			if !s.Labels.Has(l.Name) {
+				lb.Set(l.Name, l.Value)
+			}
+		})
+		lset, keep := relabel.Process(lb.Labels(), w.cfg.WriteRelabelConfigs...)
+		if !keep {
+			// Samples of series which are not known are dropped.
+			delete(w.series, s.Ref)
+			continue
+		}
+		w.series[s.Ref] = seriesV2{lset: lset, metricType: metricType(lset.Get(labels.MetricName))}
+	}
+}
+
+// UpdateSeriesSegment implements wlog.WriteTo.
+func (w *writerV2) UpdateSeriesSegment(series []record.RefSeries, index int) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, s := range series {
+		w.seriesSegment[s.Ref] = index
+	}
+}
+
+// SeriesReset implements wlog.WriteTo.
+func (w *writerV2) SeriesReset(index int) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for ref, segment := range w.seriesSegment {
+		if segment < index {
+			delete(w.seriesSegment, ref)
+			delete(w.series, ref)
+		}
+	}
+}
+
+// metricType returns the type of the series with the given metric name produced by the rules: native histograms are
+// typed by their samples, and the types of recording rules are not known.
+func metricType(name string) prompb.MetricMetadata_MetricType {
+	switch name {
+	case "ALERTS", "ALERTS_FOR_STATE":
+		return prompb.MetricMetadata_GAUGE
+	default:
+		return prompb.MetricMetadata_UNKNOWN
+	}
+}
+
+func (w *writerV2) setHistogramTypeLocked(ref chunks.HeadSeriesRef, hint histogram.CounterResetHint) {
+	s, ok := w.series[ref]
+	if !ok {
+		return
+	}
+	s.metricType = prompb.MetricMetadata_HISTOGRAM
+	if hint == histogram.GaugeType {
+		s.metricType = prompb.MetricMetadata_GAUGEHISTOGRAM
+	}
+	w.series[ref] = s
+}
+
+// appendLocked adds the sample to the pending ones, sending them once they fill a batch. It returns false if the
+// writer was stopped meanwhile.
+func (w *writerV2) appendLocked(s pendingSample) bool {
+	if _, ok := w.series[s.ref]; !ok {
+		return true
+	}
+	w.pending = append(w.pending, s)
+	if len(w.pending) < w.cfg.QueueConfig.MaxSamplesPerSend {
+		return true
+	}
+	return w.flushLocked()
+}
+
+// flushLocked sends the pending samples, retrying on recoverable errors until the writer is stopped. It returns false
+// if the writer was stopped.
+func (w *writerV2) flushLocked() bool {
+	if len(w.pending) == 0 {
+		return true
+	}
+	req, samples, histograms := w.buildRequestLocked()
+	w.pending = w.pending[:0]
+
+	stopped, err := w.send(req)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to send Remote Write 2.0 request, dropping samples", "samples", samples, "histograms", histograms, "err", err)
+		w.samplesFailed.Add(float64(samples + histograms))
+		return !stopped
+	}
+	w.samplesSent.Add(float64(samples))
+	w.histogramsSent.Add(float64(histograms))
+	return true
+}
+
+// buildRequestLocked returns the request of the pending samples, and the number of float and histogram samples in it.
+func (w *writerV2) buildRequestLocked() (_ *writev2pb.Request, samples, histograms int) {
+	var (
+		req     = &writev2pb.Request{}
+		symbols = map[string]uint32{}
+		indexes = map[chunks.HeadSeriesRef]int{}
+	)
+	symbol := func(s string) uint32 {
+		ref, ok := symbols[s]
+		if !ok {
+			ref = uint32(len(req.Symbols))
+			symbols[s] = ref
+			req.Symbols = append(req.Symbols, s)
+		}
+		return ref
+	}
+	// The first symbol is always the empty string.
+	symbol("")
+
+	for _, p := range w.pending {
+		s, ok := w.series[p.ref]
+		if !ok {
+			// Series of the samples were garbage collected meanwhile, and the samples with them.
+			continue
+		}
+		i, ok := indexes[p.ref]
+		if !ok {
+			i = len(req.Timeseries)
+			indexes[p.ref] = i
+
+			ts := writev2pb.TimeSeries{Metadata: writev2pb.Metadata{Type: s.metricType}}
+			s.lset.Range(func(l labels.Label) {
+				ts.LabelsRefs = append(ts.LabelsRefs, symbol(l.Name), symbol(l.Value))
+			})
+			req.Timeseries = append(req.Timeseries, ts)
+		}
+		if p.histogram != nil {
+			req.Timeseries[i].Histograms = append(req.Timeseries[i].Histograms, *p.histogram)
+			histograms++
+			continue
+		}
+		req.Timeseries[i].Samples = append(req.Timeseries[i].Samples, p.sample)
+		samples++
+	}
+	return req, samples, histograms
+}
+
+// recoverableError is an error of a request which can be retried.
+type recoverableError struct {
+	error
+}
+
+// send sends the request, retrying with backoff on recoverable errors until the writer is stopped. It returns true
+// if the writer was stopped before the request could be sent.
+func (w *writerV2) send(req *writev2pb.Request) (stopped bool, _ error) {
+	b, err := req.Marshal()
+	if err != nil {
+		return false, errors.Wrap(err, "marshal request")
+	}
+	b = snappy.Encode(nil, b)
+
+	backoff := time.Duration(w.cfg.QueueConfig.MinBackoff)
+	for {
+		err := w.store(b)
+		if err == nil {
+			return false, nil
+		}
+		if !errors.As(err, &recoverableError{}) {
+			return false, err
+		}
+
+		level.Warn(w.logger).Log("msg", "failed to send Remote Write 2.0 request, retrying", "backoff", backoff, "err", err)
+		select {
+		case <-w.quit:
+			return true, err
+		case <-time.After(backoff):
+		}
+		w.requestsRetried.Inc()
+		backoff = min(2*backoff, time.Duration(w.cfg.QueueConfig.MaxBackoff))
+	}
+}
+
+// store sends the snappy compressed request.
+func (w *writerV2) store(b []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.cfg.RemoteTimeout))
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", ContentTypeV2)
+	httpReq.Header.Set("User-Agent", clientconfig.ThanosUserAgent)
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", VersionV2)
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = errors.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
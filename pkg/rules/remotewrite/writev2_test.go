@@ -0,0 +1,287 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb/agent"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+)
+
+func TestLoadConfigs(t *testing.T) {
+	cfgs, err := LoadConfigs([]byte(`
+remote_write:
+- url: http://localhost/api/v1/receive
+  name: v1
+- url: http://localhost/api/v1/receive
+  name: explicit-v1
+  protobuf_message: prometheus.WriteRequest
+- url: http://localhost/api/v1/receive
+  name: v2
+  protobuf_message: io.prometheus.write.v2.Request
+  queue_config:
+    max_samples_per_send: 100
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(cfgs))
+	testutil.Equals(t, []string{ProtoMessageV1, ProtoMessageV1, writev2pb.ProtoMessage}, []string{cfgs[0].ProtobufMessage, cfgs[1].ProtobufMessage, cfgs[2].ProtobufMessage})
+	testutil.Equals(t, []bool{false, false, true}, []bool{cfgs[0].IsV2(), cfgs[1].IsV2(), cfgs[2].IsV2()})
+	// The Prometheus config is parsed with its defaults.
+	testutil.Equals(t, "v2", cfgs[2].Name)
+	testutil.Equals(t, 100, cfgs[2].QueueConfig.MaxSamplesPerSend)
+	testutil.Equals(t, config.DefaultQueueConfig.MaxBackoff, cfgs[2].QueueConfig.MaxBackoff)
+
+	_, err = LoadConfigs([]byte(`
+remote_write:
+- url: http://localhost/api/v1/receive
+  protobuf_message: io.prometheus.write.v3.Request
+`))
+	testutil.NotOk(t, err)
+	_, err = LoadConfigs([]byte(`
+remote_write:
+- protobuf_message: io.prometheus.write.v2.Request
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestWriteV2Storage(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests int
+		received = map[string]prompb.TimeSeries{}
+		metadata = map[string]prompb.MetricMetadata_MetricType{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		requests++
+		// The first request fails, and is retried.
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		testutil.Equals(t, ContentTypeV2, r.Header.Get("Content-Type"))
+		testutil.Equals(t, "snappy", r.Header.Get("Content-Encoding"))
+		testutil.Equals(t, VersionV2, r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		testutil.Equals(t, "secret", r.Header.Get("X-Custom"))
+
+		compressed, err := io.ReadAll(r.Body)
+		testutil.Ok(t, err)
+		b, err := snappy.Decode(nil, compressed)
+		testutil.Ok(t, err)
+		var req writev2pb.Request
+		testutil.Ok(t, req.Unmarshal(b))
+		testutil.Equals(t, "", req.Symbols[0])
+		wreq, err := req.ToV1()
+		testutil.Ok(t, err)
+
+		for _, ts := range wreq.Timeseries {
+			key := labelpb.ZLabelsToPromLabels(ts.Labels).String()
+			s := received[key]
+			s.Labels = ts.Labels
+			s.Samples = append(s.Samples, ts.Samples...)
+			s.Histograms = append(s.Histograms, ts.Histograms...)
+			received[key] = s
+		}
+		for _, m := range wreq.Metadata {
+			metadata[m.MetricFamilyName] = m.Type
+		}
+	}))
+	defer srv.Close()
+
+	cfgs, err := LoadConfigs([]byte(`
+remote_write:
+- url: ` + srv.URL + `
+  name: receive
+  protobuf_message: io.prometheus.write.v2.Request
+  send_native_histograms: true
+  headers:
+    X-Custom: secret
+  write_relabel_configs:
+  - source_labels: [__name__]
+    regex: dropped
+    action: drop
+  queue_config:
+    batch_send_deadline: 50ms
+    min_backoff: 10ms
+`))
+	testutil.Ok(t, err)
+
+	dir := t.TempDir()
+	logger := log.NewNopLogger()
+	reg := prometheus.NewRegistry()
+	remoteStore := remote.NewStorage(logger, reg, func() (int64, error) { return 0, nil }, dir, time.Minute, nil)
+	testutil.Ok(t, remoteStore.ApplyConfig(&config.Config{}))
+	db, err := agent.Open(logger, reg, remoteStore, dir, agent.DefaultOptions())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	s, err := NewWriteV2Storage(logger, reg, dir, labels.FromStrings("replica", "a", "job", "rule"), cfgs)
+	testutil.Ok(t, err)
+	db.SetWriteNotified(WriteNotifiers{remoteStore, s})
+	s.Start()
+	defer s.Stop()
+
+	ts := timestamp.FromTime(time.Now().Add(time.Minute))
+	app := db.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "job:up:sum", "job", "api"), ts, 1)
+	testutil.Ok(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "job:up:sum", "job", "api"), ts+1000, 2)
+	testutil.Ok(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "ALERTS", "alertname", "Down", "alertstate", "firing"), ts, 1)
+	testutil.Ok(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "dropped"), ts, 1)
+	testutil.Ok(t, err)
+	h := tsdbutil.GenerateTestHistogram(1)
+	_, err = app.AppendHistogram(0, labels.FromStrings("__name__", "job:latency:sum"), ts, h, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, ctx.Done(), func() error {
+		// Notifications are skipped while the watcher is not tailing the WAL yet, as for later writes.
+		s.Notify()
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(received) != 3 || len(received[`{__name__="job:up:sum", job="api", replica="a"}`].Samples) != 2 {
+			return errors.Errorf("received %d series", len(received))
+		}
+		return nil
+	}))
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Assert(t, requests >= 2, "expected the failed request to be retried")
+	// Series labels take precedence over external labels.
+	testutil.Equals(t, []prompb.Sample{{Value: 1, Timestamp: ts}, {Value: 2, Timestamp: ts + 1000}}, received[`{__name__="job:up:sum", job="api", replica="a"}`].Samples)
+	testutil.Equals(t, []prompb.Sample{{Value: 1, Timestamp: ts}}, received[`{__name__="ALERTS", alertname="Down", alertstate="firing", job="rule", replica="a"}`].Samples)
+	testutil.Equals(t, []prompb.Histogram{prompb.HistogramToHistogramProto(ts, h)}, received[`{__name__="job:latency:sum", job="rule", replica="a"}`].Histograms)
+	testutil.Equals(t, map[string]prompb.MetricMetadata_MetricType{
+		"ALERTS":          prompb.MetricMetadata_GAUGE,
+		"job:latency:sum": prompb.MetricMetadata_HISTOGRAM,
+	}, metadata)
+}
+
+func TestWALTruncationStorage(t *testing.T) {
+	cfgs, err := LoadConfigs([]byte(`
+remote_write:
+- url: http://localhost/api/v1/receive
+  name: v1
+- url: http://localhost/api/v1/receive
+  name: v2
+  protobuf_message: io.prometheus.write.v2.Request
+`))
+	testutil.Ok(t, err)
+
+	dir := t.TempDir()
+	logger := log.NewNopLogger()
+	remoteStore := remote.NewStorage(logger, nil, func() (int64, error) { return 0, nil }, dir, time.Minute, nil)
+	testutil.Ok(t, remoteStore.ApplyConfig(&config.Config{RemoteWriteConfigs: []*config.RemoteWriteConfig{&cfgs[0].RemoteWriteConfig}}))
+	defer func() { testutil.Ok(t, remoteStore.Close()) }()
+
+	// The WAL is truncated after the samples sent with Remote Write 1.0 if there are no Remote Write 2.0 endpoints.
+	testutil.Equals(t, remoteStore, WALTruncationStorage(logger, remoteStore, dir, cfgs[:1]))
+
+	// Otherwise it is only truncated past the max WAL time, whatever the Remote Write 1.0 queues sent.
+	s := WALTruncationStorage(logger, remoteStore, dir, cfgs)
+	defer func() { testutil.Ok(t, s.Close()) }()
+	testutil.Assert(t, s != remoteStore, "expected a remote storage without the Remote Write 1.0 queues")
+	testutil.Equals(t, int64(0), s.LowestSentTimestamp())
+}
+
+func TestWriteV2Storage_NoNativeHistograms(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		received []writev2pb.TimeSeries
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		testutil.Ok(t, err)
+		b, err := snappy.Decode(nil, compressed)
+		testutil.Ok(t, err)
+		var req writev2pb.Request
+		testutil.Ok(t, req.Unmarshal(b))
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, req.Timeseries...)
+	}))
+	defer srv.Close()
+
+	cfgs, err := LoadConfigs([]byte(`
+remote_write:
+- url: ` + srv.URL + `
+  protobuf_message: io.prometheus.write.v2.Request
+  queue_config:
+    batch_send_deadline: 50ms
+`))
+	testutil.Ok(t, err)
+
+	dir := t.TempDir()
+	logger := log.NewNopLogger()
+	reg := prometheus.NewRegistry()
+	remoteStore := remote.NewStorage(logger, reg, func() (int64, error) { return 0, nil }, dir, time.Minute, nil)
+	testutil.Ok(t, remoteStore.ApplyConfig(&config.Config{}))
+	db, err := agent.Open(logger, reg, remoteStore, dir, agent.DefaultOptions())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	s, err := NewWriteV2Storage(logger, reg, dir, labels.EmptyLabels(), cfgs)
+	testutil.Ok(t, err)
+	db.SetWriteNotified(WriteNotifiers{remoteStore, s})
+	s.Start()
+	defer s.Stop()
+
+	ts := timestamp.FromTime(time.Now().Add(time.Minute))
+	app := db.Appender(context.Background())
+	_, err = app.AppendHistogram(0, labels.FromStrings("__name__", "job:latency:sum"), ts, tsdbutil.GenerateTestHistogram(1), nil)
+	testutil.Ok(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "job:up:sum"), ts, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, ctx.Done(), func() error {
+		s.Notify()
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(received) == 0 {
+			return errors.New("no series received")
+		}
+		return nil
+	}))
+
+	// Native histograms are dropped if send_native_histograms is not set, as with Remote Write 1.0.
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Equals(t, 1, len(received))
+	testutil.Equals(t, []prompb.Sample{{Value: 1, Timestamp: ts}}, received[0].Samples)
+	testutil.Equals(t, 0, len(received[0].Histograms))
+}
@@ -4,8 +4,10 @@
 package rules
 
 import (
+	"cmp"
 	"context"
 	"sort"
+	"strings"
 	"sync"
 	"text/template"
 	"text/template/parse"
@@ -13,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/util/annotations"
+	"golang.org/x/exp/slices"
 
 	"github.com/thanos-io/thanos/pkg/extpromql"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
@@ -33,8 +36,47 @@ type GRPCClient struct {
 	proxy rulespb.RulesServer
 
 	replicaLabels map[string]struct{}
+	// sortedDedup requests rule groups sorted by key, to deduplicate them as they are received.
+	sortedDedup   bool
+	dedupStrategy DedupStrategy
+	mergeStrategy GroupMergeStrategy
 }
 
+// DedupStrategy determines which replica of a rule is kept when deduplicating rules. Whatever the strategy,
+// the replica with the lowest replica labels is kept among equally preferred ones, so that the result is deterministic.
+type DedupStrategy string
+
+const (
+	// DedupPreferFiring prefers firing, then pending alerts, then the most recently evaluated rules.
+	DedupPreferFiring DedupStrategy = "prefer-firing"
+	// DedupPreferMostRecent prefers the most recently evaluated rules, then firing, then pending alerts.
+	DedupPreferMostRecent DedupStrategy = "prefer-most-recent"
+	// DedupPreferLowestReplica prefers the rules of the replica with the lowest replica labels, so that the state
+	// of the rules comes from the same replica as long as it is available.
+	DedupPreferLowestReplica DedupStrategy = "prefer-lowest-replica"
+)
+
+// DedupStrategies are the supported deduplication strategies.
+var DedupStrategies = []string{string(DedupPreferFiring), string(DedupPreferMostRecent), string(DedupPreferLowestReplica)}
+
+// GroupMergeStrategy determines which of the rule groups with the same file and name received from different
+// endpoints are merged into one group, their rules being deduplicated, and which are kept apart.
+type GroupMergeStrategy string
+
+const (
+	// GroupMergeByFile merges all the rule groups with the same file and name.
+	GroupMergeByFile GroupMergeStrategy = "file"
+	// GroupMergeBySource only merges the rule groups with the same file and name received from endpoints with the
+	// same external labels once the replica labels are removed, i.e. from replicas of the same ruler. The groups of
+	// distinct rulers sharing a file and group name, e.g. of different tenants or shards, are kept apart.
+	GroupMergeBySource GroupMergeStrategy = "source"
+	// GroupMergeByEndpoint only merges the rule groups with the same file and name received from the same endpoint.
+	GroupMergeByEndpoint GroupMergeStrategy = "endpoint"
+)
+
+// GroupMergeStrategies are the supported rule group merge strategies.
+var GroupMergeStrategies = []string{string(GroupMergeByFile), string(GroupMergeBySource), string(GroupMergeByEndpoint)}
+
 func NewGRPCClient(rs rulespb.RulesServer) *GRPCClient {
 	return NewGRPCClientWithDedup(rs, nil)
 }
@@ -43,6 +85,8 @@ func NewGRPCClientWithDedup(rs rulespb.RulesServer, replicaLabels []string) *GRP
 	c := &GRPCClient{
 		proxy:         rs,
 		replicaLabels: map[string]struct{}{},
+		dedupStrategy: DedupPreferFiring,
+		mergeStrategy: GroupMergeByFile,
 	}
 
 	for _, label := range replicaLabels {
@@ -51,33 +95,246 @@ func NewGRPCClientWithDedup(rs rulespb.RulesServer, replicaLabels []string) *GRP
 	return c
 }
 
+// NewGRPCClientWithSortedDedup returns a GRPCClient which requests rule groups sorted by key and deduplicates
+// them as they are received, instead of buffering all of them first. All the servers rule groups come from
+// have to support sorting rule groups.
+func NewGRPCClientWithSortedDedup(rs rulespb.RulesServer, replicaLabels []string) *GRPCClient {
+	c := NewGRPCClientWithDedup(rs, replicaLabels)
+	c.sortedDedup = true
+	return c
+}
+
+// WithDedupStrategy sets the strategy choosing the replica of the rules kept when deduplicating them.
+func (rr *GRPCClient) WithDedupStrategy(s DedupStrategy) *GRPCClient {
+	rr.dedupStrategy = s
+	return rr
+}
+
+// WithGroupMergeStrategy sets the strategy choosing the rule groups with the same file and name which are merged.
+func (rr *GRPCClient) WithGroupMergeStrategy(s GroupMergeStrategy) *GRPCClient {
+	rr.mergeStrategy = s
+	return rr
+}
+
+func (rr *GRPCClient) groupMerger() groupMerger {
+	return groupMerger{strategy: rr.mergeStrategy, replicaLabels: rr.replicaLabels}
+}
+
 func (rr *GRPCClient) Rules(ctx context.Context, req *rulespb.RulesRequest) (*rulespb.RuleGroups, annotations.Annotations, error) {
 	span, ctx := tracing.StartSpan(ctx, "rules_request")
 	defer span.Finish()
 
+	if rr.sortedDedup {
+		return rr.sortedRules(ctx, req)
+	}
+
 	resp := &rulesServer{ctx: ctx}
 
 	if err := rr.proxy.Rules(req, resp); err != nil {
 		return nil, nil, errors.Wrap(err, "proxy Rules")
 	}
 
+	matcherSets, err := parseMatcherSets(req.MatcherString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Servers might not support filtering by name and file.
+	resp.groups = filterRules(filterGroups(resp.groups, req), matcherSets)
+	// TODO(bwplotka): Move to SortInterface with equal method and heap.
+	resp.groups = dedupGroups(resp.groups, rr.groupMerger())
+	for _, g := range resp.groups {
+		g.Rules = dedupRules(g.Rules, rr.replicaLabels, rr.dedupStrategy)
+	}
+
+	// The page is cut after deduplication, so that replicas of the same group count once.
+	// Groups are sorted by key at this point.
+	res := &rulespb.RuleGroups{Groups: resp.groups}
+	if req.GroupNextToken != "" {
+		res.Groups = res.Groups[sort.Search(len(res.Groups), func(i int) bool {
+			return res.Groups[i].Key() >= req.GroupNextToken
+		}):]
+	}
+	res.Groups, res.GroupNextToken = cutGroupsPage(res.Groups, req.GroupLimit)
+	return res, resp.warnings, nil
+}
+
+func (rr *GRPCClient) sortedRules(ctx context.Context, req *rulespb.RulesRequest) (*rulespb.RuleGroups, annotations.Annotations, error) {
+	matcherSets, err := parseMatcherSets(req.MatcherString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sortedReq := *req
+	sortedReq.SortedGroups = true
+	resp := &dedupRulesServer{ctx: ctx, req: req, matcherSets: matcherSets, replicaLabels: rr.replicaLabels, strategy: rr.dedupStrategy, merger: rr.groupMerger()}
+	if err := rr.proxy.Rules(&sortedReq, resp); err != nil {
+		return nil, nil, errors.Wrap(err, "proxy Rules")
+	}
+	resp.flush()
+
+	res := &rulespb.RuleGroups{}
+	res.Groups, res.GroupNextToken = cutGroupsPage(resp.groups, req.GroupLimit)
+	return res, resp.warnings, nil
+}
+
+// cutGroupsPage returns up to the given number of the given groups sorted by key, groups with the same key counting
+// once, and the key of the group the next page starts at, if any. A limit of zero returns all the groups.
+func cutGroupsPage(groups []*rulespb.RuleGroup, limit int64) ([]*rulespb.RuleGroup, string) {
+	if limit <= 0 {
+		return groups, ""
+	}
+	var keys int64
+	for i := range groups {
+		if i == 0 || groups[i].Key() != groups[i-1].Key() {
+			keys++
+			if keys > limit {
+				return groups[:i], groups[i].Key()
+			}
+		}
+	}
+	return groups, ""
+}
+
+func parseMatcherSets(matchers []string) ([][]*labels.Matcher, error) {
 	var err error
-	matcherSets := make([][]*labels.Matcher, len(req.MatcherString))
-	for i, s := range req.MatcherString {
+	matcherSets := make([][]*labels.Matcher, len(matchers))
+	for i, s := range matchers {
 		matcherSets[i], err = extpromql.ParseMetricSelector(s)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "parser ParseMetricSelector")
+			return nil, errors.Wrap(err, "parser ParseMetricSelector")
 		}
 	}
+	return matcherSets, nil
+}
 
-	resp.groups = filterRules(resp.groups, matcherSets)
-	// TODO(bwplotka): Move to SortInterface with equal method and heap.
-	resp.groups = dedupGroups(resp.groups)
-	for _, g := range resp.groups {
-		g.Rules = dedupRules(g.Rules, rr.replicaLabels)
+// selectGroups returns the rule groups selected by req. It is used by servers, so that clients don't have
+// to receive all the rule groups to filter or paginate over them. If the request is paginated, it returns the
+// groups matching the request matchers with a key not lower than the request next token, sorted by key, with
+// up to req.GroupLimit + 1 distinct keys: the extra group tells clients merging pages from several servers
+// where the next page starts. Groups are sorted by key as well if the request asks for sorted groups.
+func selectGroups(groups []*rulespb.RuleGroup, req *rulespb.RulesRequest) ([]*rulespb.RuleGroup, error) {
+	groups = filterGroups(groups, req)
+	if req.GroupLimit <= 0 && req.GroupNextToken == "" {
+		if req.SortedGroups {
+			sort.Slice(groups, func(i, j int) bool { return groups[i].Compare(groups[j]) < 0 })
+		}
+		return groups, nil
+	}
+
+	// Matchers have to be applied before the page is cut, as groups without matching rules are dropped.
+	matcherSets, err := parseMatcherSets(req.MatcherString)
+	if err != nil {
+		return nil, err
+	}
+	groups = filterRules(groups, matcherSets)
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Compare(groups[j]) < 0 })
+	groups = groups[sort.Search(len(groups), func(i int) bool {
+		return groups[i].Key() >= req.GroupNextToken
+	}):]
+	if req.GroupLimit <= 0 {
+		return groups, nil
+	}
+
+	// Groups with the same key, e.g. coming from replicas, count once.
+	var keys int64
+	for i := range groups {
+		if i == 0 || groups[i].Key() != groups[i-1].Key() {
+			keys++
+		}
+		if keys > req.GroupLimit+1 {
+			return groups[:i], nil
+		}
+	}
+	return groups, nil
+}
+
+// filterGroups filters rule groups according to the rule names, group names, files, rule health and alert states
+// of the request. Groups without any of the requested rules are dropped.
+func filterGroups(ruleGroups []*rulespb.RuleGroup, req *rulespb.RulesRequest) []*rulespb.RuleGroup {
+	if len(req.RuleName) == 0 && len(req.RuleGroup) == 0 && len(req.File) == 0 && len(req.Health) == 0 && len(req.State) == 0 {
+		return ruleGroups
+	}
+
+	var (
+		groupNames, files = newStringSet(req.RuleGroup), newStringSet(req.File)
+		rf                = ruleFilter{names: newStringSet(req.RuleName), health: newStringSet(req.Health), states: newStringSet(req.State)}
+	)
+	groupCount := 0
+	for _, g := range ruleGroups {
+		if !groupNames.contains(g.Name) || !files.contains(g.File) {
+			continue
+		}
+		if !rf.empty() {
+			ruleCount := 0
+			for _, r := range g.Rules {
+				if rf.keep(r) {
+					g.Rules[ruleCount] = r
+					ruleCount++
+				}
+			}
+			g.Rules = g.Rules[:ruleCount]
+			if ruleCount == 0 {
+				continue
+			}
+		}
+		ruleGroups[groupCount] = g
+		groupCount++
+	}
+	return ruleGroups[:groupCount]
+}
+
+type ruleFilter struct {
+	names, health, states stringSet
+}
+
+func (f ruleFilter) empty() bool {
+	return len(f.names) == 0 && len(f.health) == 0 && len(f.states) == 0
+}
+
+// keep returns whether the rule is selected by the filter. With alert states, only alerting rules
+// are selected, and their alerts are filtered as well.
+func (f ruleFilter) keep(r *rulespb.Rule) bool {
+	if !f.names.contains(r.GetName()) || !f.health.contains(r.GetHealth()) {
+		return false
+	}
+	if len(f.states) == 0 {
+		return true
+	}
+
+	a := r.GetAlert()
+	if a == nil || !f.states.contains(strings.ToLower(a.State.String())) {
+		return false
+	}
+	alertCount := 0
+	for _, ai := range a.Alerts {
+		if f.states.contains(strings.ToLower(ai.State.String())) {
+			a.Alerts[alertCount] = ai
+			alertCount++
+		}
+	}
+	a.Alerts = a.Alerts[:alertCount]
+	return true
+}
+
+type stringSet map[string]struct{}
+
+func newStringSet(values []string) stringSet {
+	s := make(stringSet, len(values))
+	for _, v := range values {
+		s[v] = struct{}{}
 	}
+	return s
+}
 
-	return &rulespb.RuleGroups{Groups: resp.groups}, resp.warnings, nil
+// contains returns whether the value is in the set. An empty set contains all the values.
+func (s stringSet) contains(v string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	_, ok := s[v]
+	return ok
 }
 
 // filterRules filters rules in a group according to given matcherSets.
@@ -138,72 +395,103 @@ func matches(matcherSets [][]*labels.Matcher, l labels.Labels) bool {
 }
 
 // dedupRules re-sorts the set so that the same series with different replica
-// labels are coming right after each other.
-func dedupRules(rules []*rulespb.Rule, replicaLabels map[string]struct{}) []*rulespb.Rule {
+// labels are coming right after each other, and keeps the replica preferred by the strategy.
+func dedupRules(rules []*rulespb.Rule, replicaLabels map[string]struct{}, strategy DedupStrategy) []*rulespb.Rule {
 	if len(rules) == 0 {
 		return rules
 	}
 
-	// Remove replica labels
-	for _, r := range rules {
-		removeReplicaLabels(r, replicaLabels)
+	// Remove replica labels, keeping them to order replicas.
+	replicas := make([]replicaRule, len(rules))
+	for i, r := range rules {
+		replicas[i] = replicaRule{rule: r, replica: removeReplicaLabels(r, replicaLabels)}
 	}
 
-	// Sort rules globally.
-	sort.Slice(rules, func(i, j int) bool {
-		return rules[i].Compare(rules[j]) < 0
+	// Sort rules globally, the preferred replica of a rule first.
+	sort.Slice(replicas, func(i, j int) bool {
+		if d := replicas[i].rule.Compare(replicas[j].rule); d != 0 {
+			return d < 0
+		}
+		return compareReplicas(replicas[i], replicas[j], strategy) < 0
 	})
 
 	// Remove rules based on synthesized deduplication labels.
-	i := 0
-	for j := 1; j < len(rules); j++ {
-		if rules[i].Compare(rules[j]) != 0 {
-			// Effectively retain rules[j] in the resulting slice.
-			i++
-			rules[i] = rules[j]
-			continue
+	rules = rules[:0]
+	for i, r := range replicas {
+		if i == 0 || r.rule.Compare(replicas[i-1].rule) != 0 {
+			rules = append(rules, r.rule)
 		}
+	}
+	return rules
+}
 
-		// If rules are the same, ordering is still determined depending on type.
-		switch {
-		case rules[i].GetRecording() != nil && rules[j].GetRecording() != nil:
-			if rules[i].GetRecording().Compare(rules[j].GetRecording()) <= 0 {
-				continue
-			}
-		case rules[i].GetAlert() != nil && rules[j].GetAlert() != nil:
-			if rules[i].GetAlert().Compare(rules[j].GetAlert()) <= 0 {
-				continue
-			}
-		default:
-			continue
+// replicaRule is a rule along with the replica labels it was removed.
+type replicaRule struct {
+	rule    *rulespb.Rule
+	replica labels.Labels
+}
+
+// compareReplicas compares equal rules r1 and r2 as per Rule#Compare, and returns < 0 if r1 is preferred to r2 by the strategy.
+func compareReplicas(r1, r2 replicaRule, strategy DedupStrategy) int {
+	state := func() int {
+		if r1.rule.GetAlert() != nil && r2.rule.GetAlert() != nil {
+			return r1.rule.GetAlert().State.Compare(r2.rule.GetAlert().State)
 		}
+		return 0
+	}
+	recent := func() int {
+		return r2.rule.GetLastEvaluation().Compare(r1.rule.GetLastEvaluation())
+	}
+	replica := func() int {
+		return labels.Compare(r1.replica, r2.replica)
+	}
 
-		// Swap if we found a younger recording rule or a younger firing alerting rule.
-		rules[i] = rules[j]
+	var order []func() int
+	switch strategy {
+	case DedupPreferMostRecent:
+		order = []func() int{recent, state, replica}
+	case DedupPreferLowestReplica:
+		order = []func() int{replica, state, recent}
+	default:
+		order = []func() int{state, recent, replica}
 	}
-	return rules[:i+1]
+	for _, cmp := range order {
+		if d := cmp(); d != 0 {
+			return d
+		}
+	}
+	return 0
 }
 
-func removeReplicaLabels(r *rulespb.Rule, replicaLabels map[string]struct{}) {
-	b := labels.NewBuilder(r.GetLabels())
-	for k := range replicaLabels {
-		b.Del(k)
-	}
+// removeReplicaLabels removes the replica labels of the rule, and returns them.
+func removeReplicaLabels(r *rulespb.Rule, replicaLabels map[string]struct{}) labels.Labels {
+	lset := r.GetLabels()
+	b := labels.NewBuilder(lset)
+	rb := labels.NewScratchBuilder(len(replicaLabels))
+	lset.Range(func(l labels.Label) {
+		if _, ok := replicaLabels[l.Name]; ok {
+			b.Del(l.Name)
+			rb.Add(l.Name, l.Value)
+		}
+	})
 	r.SetLabels(b.Labels())
+	return rb.Labels()
 }
 
-func dedupGroups(groups []*rulespb.RuleGroup) []*rulespb.RuleGroup {
+// dedupGroups merges the groups with the same key which are merged by the given merger, sorting them by key.
+func dedupGroups(groups []*rulespb.RuleGroup, m groupMerger) []*rulespb.RuleGroup {
 	if len(groups) == 0 {
 		return nil
 	}
 
 	// Sort groups such that they appear next to each other.
-	sort.Slice(groups, func(i, j int) bool { return groups[i].Compare(groups[j]) < 0 })
+	sort.Slice(groups, func(i, j int) bool { return m.compare(groups[i], groups[j]) < 0 })
 
 	i := 0
 	for _, g := range groups[1:] {
-		if g.Compare(groups[i]) == 0 {
+		if m.compare(g, groups[i]) == 0 {
 			groups[i].Rules = append(groups[i].Rules, g.Rules...)
+			groups[i].Sources = mergeSources(groups[i].Sources, g.Sources)
 		} else {
 			i++
 			groups[i] = g
@@ -212,6 +500,60 @@ func dedupGroups(groups []*rulespb.RuleGroup) []*rulespb.RuleGroup {
 	return groups[:i+1]
 }
 
+// groupMerger tells which of the rule groups with the same key are merged, according to a GroupMergeStrategy.
+type groupMerger struct {
+	strategy      GroupMergeStrategy
+	replicaLabels map[string]struct{}
+}
+
+// sourceKey returns the key of the sources of the given group, groups with the same key, limit and source key being merged.
+func (m groupMerger) sourceKey(g *rulespb.RuleGroup) string {
+	var keys []string
+	switch m.strategy {
+	case GroupMergeBySource:
+		for _, src := range g.Sources {
+			for _, ls := range src.LabelSets {
+				b := labels.NewBuilder(ls.PromLabels())
+				for l := range m.replicaLabels {
+					b.Del(l)
+				}
+				keys = append(keys, b.Labels().String())
+			}
+		}
+	case GroupMergeByEndpoint:
+		for _, src := range g.Sources {
+			keys = append(keys, src.Endpoint)
+		}
+	default:
+		return ""
+	}
+	sort.Strings(keys)
+	return strings.Join(slices.Compact(keys), ",")
+}
+
+// compare orders groups by key, then by limit and by source key. Groups with the same key but distinct limits are
+// evaluated differently, and are not merged.
+func (m groupMerger) compare(a, b *rulespb.RuleGroup) int {
+	if d := a.Compare(b); d != 0 {
+		return d
+	}
+	if d := cmp.Compare(a.Limit, b.Limit); d != 0 {
+		return d
+	}
+	return strings.Compare(m.sourceKey(a), m.sourceKey(b))
+}
+
+// mergeSources adds the sources of b missing from a, sorted by endpoint.
+func mergeSources(a, b []*rulespb.RuleGroupSource) []*rulespb.RuleGroupSource {
+	for _, src := range b {
+		if !slices.ContainsFunc(a, func(s *rulespb.RuleGroupSource) bool { return s.Endpoint == src.Endpoint }) {
+			a = append(a, src)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Endpoint < a[j].Endpoint })
+	return a
+}
+
 type rulesServer struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
 	rulespb.Rules_RulesServer
@@ -243,3 +585,76 @@ func (srv *rulesServer) Send(res *rulespb.RulesResponse) error {
 func (srv *rulesServer) Context() context.Context {
 	return srv.ctx
 }
+
+// dedupRulesServer deduplicates rule groups received sorted by key as they are received, so that
+// only the replicas of a single group are buffered at a time.
+type dedupRulesServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	rulespb.Rules_RulesServer
+	ctx context.Context
+
+	req           *rulespb.RulesRequest
+	matcherSets   [][]*labels.Matcher
+	replicaLabels map[string]struct{}
+	strategy      DedupStrategy
+	merger        groupMerger
+
+	warnings annotations.Annotations
+	groups   []*rulespb.RuleGroup
+	// current are the groups with the same key whose replicas are being received, one per source key.
+	current []*rulespb.RuleGroup
+	mu      sync.Mutex
+}
+
+func (srv *dedupRulesServer) Send(res *rulespb.RulesResponse) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if res.GetWarning() != "" {
+		srv.warnings.Add(errors.New(res.GetWarning()))
+		return nil
+	}
+
+	g := res.GetGroup()
+	if g == nil {
+		return errors.New("no group")
+	}
+	// Servers might not support filtering by name and file.
+	if g.Key() < srv.req.GroupNextToken || len(filterRules(filterGroups([]*rulespb.RuleGroup{g}, srv.req), srv.matcherSets)) == 0 {
+		return nil
+	}
+
+	if len(srv.current) > 0 {
+		switch d := g.Compare(srv.current[0]); {
+		case d == 0:
+			for _, c := range srv.current {
+				if srv.merger.compare(g, c) == 0 {
+					c.Rules = append(c.Rules, g.Rules...)
+					c.Sources = mergeSources(c.Sources, g.Sources)
+					return nil
+				}
+			}
+			srv.current = append(srv.current, g)
+			return nil
+		case d < 0:
+			return errors.Errorf("rule group %s received after %s, rule groups are not sorted", g.Key(), srv.current[0].Key())
+		}
+	}
+	srv.flush()
+	srv.current = append(srv.current, g)
+	return nil
+}
+
+// flush deduplicates the rules of the current groups and adds them to the received groups.
+func (srv *dedupRulesServer) flush() {
+	sort.Slice(srv.current, func(i, j int) bool { return srv.merger.compare(srv.current[i], srv.current[j]) < 0 })
+	for _, g := range srv.current {
+		g.Rules = dedupRules(g.Rules, srv.replicaLabels, srv.strategy)
+		srv.groups = append(srv.groups, g)
+	}
+	srv.current = nil
+}
+
+func (srv *dedupRulesServer) Context() context.Context {
+	return srv.ctx
+}
@@ -5,6 +5,7 @@ package rules
 
 import (
 	"context"
+	"fmt"
 	"path"
 	"path/filepath"
 	"testing"
@@ -426,6 +427,18 @@ func TestDedupRules(t *testing.T) {
 					}}}),
 			},
 		},
+		{
+			name: "alert keep firing for",
+			rules: []*rulespb.Rule{
+				rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Query: "up", DurationSeconds: 1.0, KeepFiringForSeconds: 2.0}),
+				rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Query: "up", DurationSeconds: 1.0}),
+				rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Query: "up", DurationSeconds: 1.0, KeepFiringForSeconds: 2.0}),
+			},
+			want: []*rulespb.Rule{
+				rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Query: "up", DurationSeconds: 1.0}),
+				rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Query: "up", DurationSeconds: 1.0, KeepFiringForSeconds: 2.0}),
+			},
+		},
 		{
 			name: "alert duration with replicas",
 			rules: []*rulespb.Rule{
@@ -733,7 +746,69 @@ func TestDedupRules(t *testing.T) {
 			for _, lbl := range tc.replicaLabels {
 				replicaLabels[lbl] = struct{}{}
 			}
-			testutil.Equals(t, tc.want, dedupRules(tc.rules, replicaLabels))
+			testutil.Equals(t, tc.want, dedupRules(tc.rules, replicaLabels, DedupPreferFiring))
+		})
+	}
+}
+
+func TestDedupRulesStrategies(t *testing.T) {
+	alert := func(replica string, state rulespb.AlertState, lastEvaluation int64) *rulespb.Rule {
+		return rulespb.NewAlertingRule(&rulespb.Alert{
+			Name:           "a1",
+			State:          state,
+			Labels:         labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "replica", Value: replica}}},
+			LastEvaluation: time.Unix(lastEvaluation, 0),
+		})
+	}
+	deduped := func(replica string, state rulespb.AlertState, lastEvaluation int64) []*rulespb.Rule {
+		r := alert(replica, state, lastEvaluation)
+		r.SetLabels(labels.EmptyLabels())
+		return []*rulespb.Rule{r}
+	}
+
+	for _, tc := range []struct {
+		strategy DedupStrategy
+		rules    func() []*rulespb.Rule
+		want     []*rulespb.Rule
+	}{
+		{
+			strategy: DedupPreferFiring,
+			rules: func() []*rulespb.Rule {
+				return []*rulespb.Rule{alert("r0", rulespb.AlertState_PENDING, 3), alert("r1", rulespb.AlertState_FIRING, 1), alert("r2", rulespb.AlertState_FIRING, 2)}
+			},
+			want: deduped("r2", rulespb.AlertState_FIRING, 2),
+		},
+		{
+			strategy: DedupPreferFiring,
+			rules: func() []*rulespb.Rule {
+				return []*rulespb.Rule{alert("r2", rulespb.AlertState_FIRING, 1), alert("r1", rulespb.AlertState_FIRING, 1)}
+			},
+			want: deduped("r1", rulespb.AlertState_FIRING, 1),
+		},
+		{
+			strategy: DedupPreferMostRecent,
+			rules: func() []*rulespb.Rule {
+				return []*rulespb.Rule{alert("r0", rulespb.AlertState_PENDING, 3), alert("r1", rulespb.AlertState_FIRING, 1), alert("r2", rulespb.AlertState_FIRING, 2)}
+			},
+			want: deduped("r0", rulespb.AlertState_PENDING, 3),
+		},
+		{
+			strategy: DedupPreferLowestReplica,
+			rules: func() []*rulespb.Rule {
+				return []*rulespb.Rule{alert("r2", rulespb.AlertState_FIRING, 2), alert("r1", rulespb.AlertState_INACTIVE, 1), alert("r3", rulespb.AlertState_FIRING, 3)}
+			},
+			want: deduped("r1", rulespb.AlertState_INACTIVE, 1),
+		},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			// The result doesn't depend on the order rules are received.
+			rules := tc.rules()
+			testutil.Equals(t, tc.want, dedupRules(rules, map[string]struct{}{"replica": {}}, tc.strategy))
+			rules = tc.rules()
+			for i, j := 0, len(rules)-1; i < j; i, j = i+1, j-1 {
+				rules[i], rules[j] = rules[j], rules[i]
+			}
+			testutil.Equals(t, tc.want, dedupRules(rules, map[string]struct{}{"replica": {}}, tc.strategy))
 		})
 	}
 }
@@ -947,10 +1022,51 @@ func TestDedupGroups(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "distinct limits",
+			groups: []*rulespb.RuleGroup{
+				{
+					Name:  "a",
+					Limit: 10,
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a1"}),
+					},
+				},
+				{
+					Name: "a",
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a1"}),
+					},
+				},
+				{
+					Name:  "a",
+					Limit: 10,
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a2"}),
+					},
+				},
+			},
+			want: []*rulespb.RuleGroup{
+				{
+					Name: "a",
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a1"}),
+					},
+				},
+				{
+					Name:  "a",
+					Limit: 10,
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a1"}),
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "a2"}),
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
-				testutil.Equals(t, tc.want, dedupGroups(tc.groups))
+				testutil.Equals(t, tc.want, dedupGroups(tc.groups, groupMerger{}))
 			})
 		})
 	}
@@ -1389,3 +1505,327 @@ func TestFilterRules(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterGroups(t *testing.T) {
+	groups := func() []*rulespb.RuleGroup {
+		return []*rulespb.RuleGroup{
+			{
+				Name: "a", File: "f1",
+				Rules: []*rulespb.Rule{
+					rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "r1", Health: "ok"}),
+					rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Health: "err"}),
+				},
+			},
+			{
+				Name: "b", File: "f1",
+				Rules: []*rulespb.Rule{
+					rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "r2", Health: "unknown"}),
+					rulespb.NewAlertingRule(&rulespb.Alert{
+						Name:  "a2",
+						State: rulespb.AlertState_FIRING,
+						Alerts: []*rulespb.AlertInstance{
+							{State: rulespb.AlertState_FIRING, Value: "1"},
+							{State: rulespb.AlertState_PENDING, Value: "2"},
+						},
+						Health: "ok",
+					}),
+				},
+			},
+			{Name: "a", File: "f2"},
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *rulespb.RulesRequest
+		want []*rulespb.RuleGroup
+	}{
+		{
+			name: "no filters",
+			req:  &rulespb.RulesRequest{},
+			want: groups(),
+		},
+		{
+			name: "group names",
+			req:  &rulespb.RulesRequest{RuleGroup: []string{"a"}},
+			want: []*rulespb.RuleGroup{groups()[0], groups()[2]},
+		},
+		{
+			name: "files",
+			req:  &rulespb.RulesRequest{File: []string{"f1", "f3"}},
+			want: groups()[:2],
+		},
+		{
+			name: "group names and files",
+			req:  &rulespb.RulesRequest{RuleGroup: []string{"a"}, File: []string{"f2"}},
+			want: groups()[2:],
+		},
+		{
+			name: "rule names drop groups without the rules",
+			req:  &rulespb.RulesRequest{RuleName: []string{"a1", "r3"}},
+			want: []*rulespb.RuleGroup{
+				{
+					Name: "a", File: "f1",
+					Rules: []*rulespb.Rule{
+						rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Health: "err"}),
+					},
+				},
+			},
+		},
+		{
+			name: "health",
+			req:  &rulespb.RulesRequest{Health: []string{"ok"}},
+			want: []*rulespb.RuleGroup{
+				{
+					Name: "a", File: "f1",
+					Rules: []*rulespb.Rule{
+						rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "r1", Health: "ok"}),
+					},
+				},
+				{
+					Name: "b", File: "f1",
+					Rules: []*rulespb.Rule{groups()[1].Rules[1]},
+				},
+			},
+		},
+		{
+			name: "alert states filter alerts as well",
+			req:  &rulespb.RulesRequest{State: []string{"firing"}},
+			want: []*rulespb.RuleGroup{
+				{
+					Name: "b", File: "f1",
+					Rules: []*rulespb.Rule{
+						rulespb.NewAlertingRule(&rulespb.Alert{
+							Name:   "a2",
+							State:  rulespb.AlertState_FIRING,
+							Alerts: []*rulespb.AlertInstance{{State: rulespb.AlertState_FIRING, Value: "1"}},
+							Health: "ok",
+						}),
+					},
+				},
+			},
+		},
+		{
+			name: "inactive alert state",
+			req:  &rulespb.RulesRequest{State: []string{"inactive"}},
+			want: []*rulespb.RuleGroup{
+				{
+					Name: "a", File: "f1",
+					Rules: []*rulespb.Rule{
+						rulespb.NewAlertingRule(&rulespb.Alert{Name: "a1", Health: "err"}),
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Equals(t, tc.want, filterGroups(groups(), tc.req))
+		})
+	}
+}
+
+// replicatedRulesServer sends the page of rule groups of every replica, as the rules proxy
+// does with the pages of its rules clients.
+type replicatedRulesServer struct {
+	replicas [][]*rulespb.RuleGroup
+}
+
+func (s *replicatedRulesServer) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer) error {
+	for _, replica := range s.replicas {
+		groups := make([]*rulespb.RuleGroup, 0, len(replica))
+		for _, g := range replica {
+			groups = append(groups, proto.Clone(g).(*rulespb.RuleGroup))
+		}
+		groups, err := selectGroups(groups, req)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if err := srv.Send(rulespb.NewRuleGroupRulesResponse(g)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestGRPCClientRulesPagination(t *testing.T) {
+	group := func(name, replica string) *rulespb.RuleGroup {
+		return &rulespb.RuleGroup{
+			Name: name,
+			Rules: []*rulespb.Rule{
+				rulespb.NewRecordingRule(&rulespb.RecordingRule{
+					Name: "r" + name, Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+						{Name: "job", Value: name},
+						{Name: "replica", Value: replica},
+					}},
+				}),
+			},
+		}
+	}
+	client := NewGRPCClientWithDedup(&replicatedRulesServer{replicas: [][]*rulespb.RuleGroup{
+		{group("d", "1"), group("a", "1"), group("b", "1"), group("c", "1")},
+		{group("b", "2"), group("e", "2"), group("c", "2"), group("d", "2")},
+	}}, []string{"replica"})
+
+	for _, tcase := range []struct {
+		name      string
+		req       *rulespb.RulesRequest
+		expected  []string
+		nextToken string
+	}{
+		{
+			name:     "no limit",
+			req:      &rulespb.RulesRequest{},
+			expected: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:      "first page",
+			req:       &rulespb.RulesRequest{GroupLimit: 2},
+			expected:  []string{"a", "b"},
+			nextToken: ";c",
+		},
+		{
+			name:      "second page",
+			req:       &rulespb.RulesRequest{GroupLimit: 2, GroupNextToken: ";c"},
+			expected:  []string{"c", "d"},
+			nextToken: ";e",
+		},
+		{
+			name:     "last page",
+			req:      &rulespb.RulesRequest{GroupLimit: 2, GroupNextToken: ";e"},
+			expected: []string{"e"},
+		},
+		{
+			name:     "limit covering all groups",
+			req:      &rulespb.RulesRequest{GroupLimit: 5},
+			expected: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:      "matchers are applied before the page is cut",
+			req:       &rulespb.RulesRequest{GroupLimit: 1, MatcherString: []string{`{job=~"b|d|e"}`}},
+			expected:  []string{"b"},
+			nextToken: ";d",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			groups, _, err := client.Rules(context.Background(), tcase.req)
+			testutil.Ok(t, err)
+
+			var names []string
+			for _, g := range groups.Groups {
+				names = append(names, g.Name)
+				// Replicas of the same group are deduplicated.
+				testutil.Equals(t, 1, len(g.Rules))
+			}
+			testutil.Equals(t, tcase.expected, names)
+			testutil.Equals(t, tcase.nextToken, groups.GroupNextToken)
+		})
+	}
+}
+
+func TestGRPCClientGroupMergeStrategies(t *testing.T) {
+	group := func(name, endpoint, tenant, replica string) *rulespb.RuleGroup {
+		lset := labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "replica", Value: replica}, {Name: "tenant", Value: tenant}}}
+		return &rulespb.RuleGroup{
+			Name: name,
+			File: "rules.yaml",
+			Rules: []*rulespb.Rule{
+				rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "r" + name, Labels: lset}),
+			},
+			Sources: []*rulespb.RuleGroupSource{{Endpoint: endpoint, LabelSets: []labelpb.ZLabelSet{lset}, File: "rules.yaml"}},
+		}
+	}
+	replicas := [][]*rulespb.RuleGroup{
+		{group("g", "a-1", "a", "1"), group("h", "a-1", "a", "1")},
+		{group("g", "a-2", "a", "2"), group("h", "a-2", "a", "2")},
+		{group("g", "b-1", "b", "1")},
+	}
+	// Sorted groups are sent as merged by the rules proxy.
+	var merged []*rulespb.RuleGroup
+	for _, groups := range replicas {
+		merged = append(merged, groups...)
+	}
+
+	for _, tcase := range []struct {
+		strategy GroupMergeStrategy
+		req      *rulespb.RulesRequest
+		// expected are the endpoints of the sources of each returned group.
+		expected  [][]string
+		nextToken string
+	}{
+		{strategy: GroupMergeByFile, req: &rulespb.RulesRequest{}, expected: [][]string{{"a-1", "a-2", "b-1"}, {"a-1", "a-2"}}},
+		{strategy: GroupMergeBySource, req: &rulespb.RulesRequest{}, expected: [][]string{{"a-1", "a-2"}, {"b-1"}, {"a-1", "a-2"}}},
+		{strategy: GroupMergeByEndpoint, req: &rulespb.RulesRequest{}, expected: [][]string{{"a-1"}, {"a-2"}, {"b-1"}, {"a-1"}, {"a-2"}}},
+		// Groups with the same file and name kept apart count as one group.
+		{strategy: GroupMergeBySource, req: &rulespb.RulesRequest{GroupLimit: 1}, expected: [][]string{{"a-1", "a-2"}, {"b-1"}}, nextToken: "rules.yaml;h"},
+	} {
+		for _, sorted := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/limit=%d/sorted=%v", tcase.strategy, tcase.req.GroupLimit, sorted), func(t *testing.T) {
+				client := NewGRPCClientWithDedup(&replicatedRulesServer{replicas: replicas}, []string{"replica"})
+				if sorted {
+					client = NewGRPCClientWithSortedDedup(&replicatedRulesServer{replicas: [][]*rulespb.RuleGroup{merged}}, []string{"replica"})
+				}
+				client.WithGroupMergeStrategy(tcase.strategy)
+
+				groups, _, err := client.Rules(context.Background(), tcase.req)
+				testutil.Ok(t, err)
+
+				var endpoints [][]string
+				for _, g := range groups.Groups {
+					var eps []string
+					for _, src := range g.Sources {
+						eps = append(eps, src.Endpoint)
+					}
+					endpoints = append(endpoints, eps)
+					// The rules of the replicas of a ruler are deduplicated, those of distinct rulers are kept.
+					testutil.Equals(t, len(uniqueTenants(g.Sources)), len(g.Rules))
+				}
+				testutil.Equals(t, tcase.expected, endpoints)
+				testutil.Equals(t, tcase.nextToken, groups.GroupNextToken)
+			})
+		}
+	}
+}
+
+func TestGRPCClientGroupLimits(t *testing.T) {
+	group := func(limit int64, endpoint string) *rulespb.RuleGroup {
+		lset := labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "replica", Value: endpoint}}}
+		return &rulespb.RuleGroup{
+			Name:    "g",
+			File:    "rules.yaml",
+			Limit:   limit,
+			Rules:   []*rulespb.Rule{rulespb.NewRecordingRule(&rulespb.RecordingRule{Name: "r", Labels: lset})},
+			Sources: []*rulespb.RuleGroupSource{{Endpoint: endpoint, LabelSets: []labelpb.ZLabelSet{lset}, File: "rules.yaml"}},
+		}
+	}
+
+	for _, sorted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sorted=%v", sorted), func(t *testing.T) {
+			replicas := [][]*rulespb.RuleGroup{{group(10, "a")}, {group(0, "b")}, {group(10, "c")}}
+			client := NewGRPCClientWithDedup(&replicatedRulesServer{replicas: replicas}, []string{"replica"})
+			if sorted {
+				client = NewGRPCClientWithSortedDedup(&replicatedRulesServer{replicas: [][]*rulespb.RuleGroup{{replicas[0][0], replicas[1][0], replicas[2][0]}}}, []string{"replica"})
+			}
+
+			groups, _, err := client.Rules(context.Background(), &rulespb.RulesRequest{})
+			testutil.Ok(t, err)
+
+			// Groups with distinct limits are kept apart, the replicas of the others are deduplicated.
+			testutil.Equals(t, 2, len(groups.Groups))
+			testutil.Equals(t, int64(0), groups.Groups[0].Limit)
+			testutil.Equals(t, 1, len(groups.Groups[0].Sources))
+			testutil.Equals(t, int64(10), groups.Groups[1].Limit)
+			testutil.Equals(t, 2, len(groups.Groups[1].Sources))
+			testutil.Equals(t, 1, len(groups.Groups[1].Rules))
+		})
+	}
+}
+
+func uniqueTenants(sources []*rulespb.RuleGroupSource) map[string]struct{} {
+	tenants := map[string]struct{}{}
+	for _, src := range sources {
+		tenants[src.LabelSets[0].PromLabels().Get("tenant")] = struct{}{}
+	}
+	return tenants
+}
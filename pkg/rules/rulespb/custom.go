@@ -21,6 +21,16 @@ const (
 	RuleAlertingType  = "alerting"
 )
 
+// EndpointRulesClient is a RulesClient of an endpoint, along with the source the rule groups of the endpoint are annotated with.
+type EndpointRulesClient struct {
+	RulesClient
+	Source *RuleGroupSource
+}
+
+func (c *EndpointRulesClient) String() string {
+	return c.Source.Endpoint
+}
+
 func NewRuleGroupRulesResponse(rg *RuleGroup) *RulesResponse {
 	return &RulesResponse{
 		Result: &RulesResponse_Group{
@@ -109,6 +119,17 @@ func (r *Rule) GetName() string {
 	}
 }
 
+func (r *Rule) GetHealth() string {
+	switch {
+	case r.GetRecording() != nil:
+		return r.GetRecording().Health
+	case r.GetAlert() != nil:
+		return r.GetAlert().Health
+	default:
+		return ""
+	}
+}
+
 func (r *Rule) GetQuery() string {
 	switch {
 	case r.GetRecording() != nil:
@@ -144,6 +165,7 @@ func (r *Rule) GetLastEvaluation() time.Time {
 // 3. rule labels
 // 4. rule query
 // 5. for alerting rules: duration
+// 6. for alerting rules: keep firing for duration
 //
 // Note: this can still leave ordering undetermined for equal rules (x == y).
 // For determining ordering of equal rules, use Alert#Compare or RecordingRule#Compare.
@@ -172,6 +194,10 @@ func (r1 *Rule) Compare(r2 *Rule) int {
 		if d := big.NewFloat(r1.GetAlert().DurationSeconds).Cmp(big.NewFloat(r2.GetAlert().DurationSeconds)); d != 0 {
 			return d
 		}
+
+		if d := big.NewFloat(r1.GetAlert().KeepFiringForSeconds).Cmp(big.NewFloat(r2.GetAlert().KeepFiringForSeconds)); d != 0 {
+			return d
+		}
 	}
 
 	return 0
@@ -109,6 +109,27 @@ type RulesRequest struct {
 	Type                    RulesRequest_Type               `protobuf:"varint,1,opt,name=type,proto3,enum=thanos.RulesRequest_Type" json:"type,omitempty"`
 	PartialResponseStrategy storepb.PartialResponseStrategy `protobuf:"varint,2,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
 	MatcherString           []string                        `protobuf:"bytes,3,rep,name=matcher_string,json=matcherString,proto3" json:"matcher_string,omitempty"`
+	/// group_limit is the maximum number of rule groups to return, ordered by their key. 0 means no limit.
+	/// Servers return up to group_limit + 1 groups, so that clients merging groups from several servers
+	/// know where the next page starts.
+	GroupLimit int64 `protobuf:"varint,4,opt,name=group_limit,json=groupLimit,proto3" json:"group_limit,omitempty"`
+	/// group_next_token is the key of the first rule group to return. Groups with a lower key are skipped.
+	GroupNextToken string `protobuf:"bytes,5,opt,name=group_next_token,json=groupNextToken,proto3" json:"group_next_token,omitempty"`
+	/// rule_name, if not empty, only returns the rules with one of the given names.
+	/// Groups without any of the given rules are not returned.
+	RuleName []string `protobuf:"bytes,6,rep,name=rule_name,json=ruleName,proto3" json:"rule_name,omitempty"`
+	/// rule_group, if not empty, only returns the groups with one of the given names.
+	RuleGroup []string `protobuf:"bytes,7,rep,name=rule_group,json=ruleGroup,proto3" json:"rule_group,omitempty"`
+	/// file, if not empty, only returns the groups defined in one of the given files.
+	File []string `protobuf:"bytes,8,rep,name=file,proto3" json:"file,omitempty"`
+	/// health, if not empty, only returns the rules with one of the given health values: "ok", "err" or "unknown".
+	Health []string `protobuf:"bytes,9,rep,name=health,proto3" json:"health,omitempty"`
+	/// state, if not empty, only returns the alerting rules and alerts with one of the given states:
+	/// "firing", "pending" or "inactive".
+	State []string `protobuf:"bytes,10,rep,name=state,proto3" json:"state,omitempty"`
+	/// sorted_groups, if true, makes servers send rule groups sorted by key, i.e. by file and name, so that
+	/// clients can merge and deduplicate the groups of several servers without buffering all of them.
+	SortedGroups bool `protobuf:"varint,11,opt,name=sorted_groups,json=sortedGroups,proto3" json:"sorted_groups,omitempty"`
 }
 
 func (m *RulesRequest) Reset()         { *m = RulesRequest{} }
@@ -237,6 +258,8 @@ func (*RulesResponse) XXX_OneofWrappers() []interface{} {
 // / For rule parsing from YAML configuration other struct is used: https://github.com/prometheus/prometheus/blob/20b1f596f6fb16107ef0c244d240b0ad6da36829/pkg/rulefmt/rulefmt.go#L105
 type RuleGroups struct {
 	Groups []*RuleGroup `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups"`
+	/// group_next_token is the token to request the next page of rule groups with. Empty if this is the last page.
+	GroupNextToken string `protobuf:"bytes,2,opt,name=group_next_token,json=groupNextToken,proto3" json:"groupNextToken,omitempty"`
 }
 
 func (m *RuleGroups) Reset()         { *m = RuleGroups{} }
@@ -283,6 +306,9 @@ type RuleGroup struct {
 	Limit                     int64     `protobuf:"varint,9,opt,name=limit,proto3" json:"limit"`
 	// Thanos specific.
 	PartialResponseStrategy storepb.PartialResponseStrategy `protobuf:"varint,8,opt,name=PartialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partialResponseStrategy"`
+	/// sources are the endpoints the group was received from. Set by the querier,
+	/// a group deduplicated across rulers has many sources.
+	Sources []*RuleGroupSource `protobuf:"bytes,10,rep,name=sources,proto3" json:"sources,omitempty"`
 }
 
 func (m *RuleGroup) Reset()         { *m = RuleGroup{} }
@@ -318,6 +344,51 @@ func (m *RuleGroup) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_RuleGroup proto.InternalMessageInfo
 
+// / RuleGroupSource identifies the endpoint serving a rule group.
+type RuleGroupSource struct {
+	/// endpoint is the address of the endpoint.
+	Endpoint string `protobuf:"bytes,1,opt,name=endpoint,proto3" json:"endpoint"`
+	/// label_sets are the external label sets of the endpoint.
+	LabelSets []labelpb.ZLabelSet `protobuf:"bytes,2,rep,name=label_sets,json=labelSets,proto3" json:"labelSets"`
+	/// file is the file of the rule group on the endpoint.
+	File string `protobuf:"bytes,3,opt,name=file,proto3" json:"file"`
+	/// tenant is the tenant of the endpoint, as set by its external labels. Empty if the endpoint has none.
+	Tenant string `protobuf:"bytes,4,opt,name=tenant,proto3" json:"tenant,omitempty"`
+}
+
+func (m *RuleGroupSource) Reset()         { *m = RuleGroupSource{} }
+func (m *RuleGroupSource) String() string { return proto.CompactTextString(m) }
+func (*RuleGroupSource) ProtoMessage()    {}
+func (*RuleGroupSource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_91b1d28f30eb5efb, []int{4}
+}
+func (m *RuleGroupSource) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RuleGroupSource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RuleGroupSource.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RuleGroupSource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RuleGroupSource.Merge(m, src)
+}
+func (m *RuleGroupSource) XXX_Size() int {
+	return m.Size()
+}
+func (m *RuleGroupSource) XXX_DiscardUnknown() {
+	xxx_messageInfo_RuleGroupSource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RuleGroupSource proto.InternalMessageInfo
+
 type Rule struct {
 	// Types that are valid to be assigned to Result:
 	//	*Rule_Recording
@@ -329,7 +400,7 @@ func (m *Rule) Reset()         { *m = Rule{} }
 func (m *Rule) String() string { return proto.CompactTextString(m) }
 func (*Rule) ProtoMessage()    {}
 func (*Rule) Descriptor() ([]byte, []int) {
-	return fileDescriptor_91b1d28f30eb5efb, []int{4}
+	return fileDescriptor_91b1d28f30eb5efb, []int{5}
 }
 func (m *Rule) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -417,7 +488,7 @@ func (m *AlertInstance) Reset()         { *m = AlertInstance{} }
 func (m *AlertInstance) String() string { return proto.CompactTextString(m) }
 func (*AlertInstance) ProtoMessage()    {}
 func (*AlertInstance) Descriptor() ([]byte, []int) {
-	return fileDescriptor_91b1d28f30eb5efb, []int{5}
+	return fileDescriptor_91b1d28f30eb5efb, []int{6}
 }
 func (m *AlertInstance) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -460,13 +531,16 @@ type Alert struct {
 	EvaluationDurationSeconds float64           `protobuf:"fixed64,10,opt,name=evaluation_duration_seconds,json=evaluationDurationSeconds,proto3" json:"evaluationTime"`
 	LastEvaluation            time.Time         `protobuf:"bytes,11,opt,name=last_evaluation,json=lastEvaluation,proto3,stdtime" json:"lastEvaluation"`
 	KeepFiringForSeconds      float64           `protobuf:"fixed64,12,opt,name=keep_firing_for_seconds,json=keepFiringForSeconds,proto3" json:"keepFiringFor"`
+	// Thanos specific.
+	LastErrorDetails *RuleEvaluationError `protobuf:"bytes,13,opt,name=last_error_details,json=lastErrorDetails,proto3" json:"lastErrorDetails,omitempty"`
+	LastWarnings     []string             `protobuf:"bytes,14,rep,name=last_warnings,json=lastWarnings,proto3" json:"lastWarnings,omitempty"`
 }
 
 func (m *Alert) Reset()         { *m = Alert{} }
 func (m *Alert) String() string { return proto.CompactTextString(m) }
 func (*Alert) ProtoMessage()    {}
 func (*Alert) Descriptor() ([]byte, []int) {
-	return fileDescriptor_91b1d28f30eb5efb, []int{6}
+	return fileDescriptor_91b1d28f30eb5efb, []int{7}
 }
 func (m *Alert) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -503,13 +577,16 @@ type RecordingRule struct {
 	LastError                 string            `protobuf:"bytes,5,opt,name=last_error,json=lastError,proto3" json:"lastError,omitempty"`
 	EvaluationDurationSeconds float64           `protobuf:"fixed64,6,opt,name=evaluation_duration_seconds,json=evaluationDurationSeconds,proto3" json:"evaluationTime"`
 	LastEvaluation            time.Time         `protobuf:"bytes,7,opt,name=last_evaluation,json=lastEvaluation,proto3,stdtime" json:"lastEvaluation"`
+	// Thanos specific.
+	LastErrorDetails *RuleEvaluationError `protobuf:"bytes,8,opt,name=last_error_details,json=lastErrorDetails,proto3" json:"lastErrorDetails,omitempty"`
+	LastWarnings     []string             `protobuf:"bytes,9,rep,name=last_warnings,json=lastWarnings,proto3" json:"lastWarnings,omitempty"`
 }
 
 func (m *RecordingRule) Reset()         { *m = RecordingRule{} }
 func (m *RecordingRule) String() string { return proto.CompactTextString(m) }
 func (*RecordingRule) ProtoMessage()    {}
 func (*RecordingRule) Descriptor() ([]byte, []int) {
-	return fileDescriptor_91b1d28f30eb5efb, []int{7}
+	return fileDescriptor_91b1d28f30eb5efb, []int{8}
 }
 func (m *RecordingRule) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -538,6 +615,50 @@ func (m *RecordingRule) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_RecordingRule proto.InternalMessageInfo
 
+// / RuleEvaluationError details the last failed evaluation of a rule.
+type RuleEvaluationError struct {
+	Timestamp time.Time `protobuf:"bytes,1,opt,name=timestamp,proto3,stdtime" json:"timestamp"`
+	/// class is the class of the error: timeout, canceled, unreachable, query or evaluation.
+	Class string `protobuf:"bytes,2,opt,name=class,proto3" json:"class"`
+	/// endpoint is the address of the query API the error comes from, if any.
+	Endpoint string `protobuf:"bytes,3,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	/// message is the error returned by the endpoint, which can be more specific than the last error of the rule.
+	Message string `protobuf:"bytes,4,opt,name=message,proto3" json:"message"`
+}
+
+func (m *RuleEvaluationError) Reset()         { *m = RuleEvaluationError{} }
+func (m *RuleEvaluationError) String() string { return proto.CompactTextString(m) }
+func (*RuleEvaluationError) ProtoMessage()    {}
+func (*RuleEvaluationError) Descriptor() ([]byte, []int) {
+	return fileDescriptor_91b1d28f30eb5efb, []int{9}
+}
+func (m *RuleEvaluationError) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RuleEvaluationError) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RuleEvaluationError.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RuleEvaluationError) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RuleEvaluationError.Merge(m, src)
+}
+func (m *RuleEvaluationError) XXX_Size() int {
+	return m.Size()
+}
+func (m *RuleEvaluationError) XXX_DiscardUnknown() {
+	xxx_messageInfo_RuleEvaluationError.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RuleEvaluationError proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterEnum("thanos.AlertState", AlertState_name, AlertState_value)
 	proto.RegisterEnum("thanos.RulesRequest_Type", RulesRequest_Type_name, RulesRequest_Type_value)
@@ -545,83 +666,108 @@ func init() {
 	proto.RegisterType((*RulesResponse)(nil), "thanos.RulesResponse")
 	proto.RegisterType((*RuleGroups)(nil), "thanos.RuleGroups")
 	proto.RegisterType((*RuleGroup)(nil), "thanos.RuleGroup")
+	proto.RegisterType((*RuleGroupSource)(nil), "thanos.RuleGroupSource")
 	proto.RegisterType((*Rule)(nil), "thanos.Rule")
 	proto.RegisterType((*AlertInstance)(nil), "thanos.AlertInstance")
 	proto.RegisterType((*Alert)(nil), "thanos.Alert")
 	proto.RegisterType((*RecordingRule)(nil), "thanos.RecordingRule")
+	proto.RegisterType((*RuleEvaluationError)(nil), "thanos.RuleEvaluationError")
 }
 
 func init() { proto.RegisterFile("rules/rulespb/rpc.proto", fileDescriptor_91b1d28f30eb5efb) }
 
 var fileDescriptor_91b1d28f30eb5efb = []byte{
-	// 1058 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x56, 0xcd, 0x4e, 0x23, 0xc7,
-	0x13, 0xf7, 0x60, 0xcf, 0xd8, 0x53, 0xc6, 0x2c, 0xdb, 0x0b, 0x62, 0x60, 0xff, 0xf2, 0x20, 0x4b,
-	0xfc, 0x45, 0xa2, 0xac, 0x1d, 0x81, 0x76, 0xa3, 0x3d, 0x45, 0x98, 0x8f, 0x05, 0x09, 0x91, 0x55,
-	0x1b, 0xe5, 0xb0, 0x39, 0x38, 0x8d, 0x69, 0xcc, 0x28, 0xe3, 0x99, 0xd9, 0xee, 0x36, 0x11, 0x6f,
-	0xb1, 0xe7, 0xbc, 0x48, 0x5e, 0x81, 0x5b, 0xf6, 0x98, 0x93, 0x93, 0xc0, 0x29, 0x3e, 0xe4, 0x19,
-	0xa2, 0xae, 0x9e, 0xb1, 0x0d, 0x81, 0xb0, 0x9b, 0x90, 0xcb, 0x54, 0x77, 0xd5, 0xaf, 0x7a, 0xea,
-	0xe3, 0xd7, 0x35, 0x03, 0x0b, 0xa2, 0x1f, 0x72, 0xd9, 0xc0, 0x67, 0x72, 0xd4, 0x10, 0x49, 0xa7,
-	0x9e, 0x88, 0x58, 0xc5, 0xc4, 0x51, 0xa7, 0x2c, 0x8a, 0xe5, 0xd2, 0xa2, 0x54, 0xb1, 0xe0, 0x0d,
-	0x7c, 0x26, 0x47, 0x0d, 0x75, 0x9e, 0x70, 0x69, 0x20, 0x99, 0x29, 0x64, 0x47, 0x3c, 0xbc, 0x61,
-	0x9a, 0xeb, 0xc6, 0xdd, 0x18, 0x97, 0x0d, 0xbd, 0x4a, 0xb5, 0x7e, 0x37, 0x8e, 0xbb, 0x21, 0x6f,
-	0xe0, 0xee, 0xa8, 0x7f, 0xd2, 0x50, 0x41, 0x8f, 0x4b, 0xc5, 0x7a, 0x89, 0x01, 0xd4, 0x7e, 0xb7,
-	0x60, 0x9a, 0xea, 0x50, 0x28, 0x7f, 0xdb, 0xe7, 0x52, 0x91, 0x67, 0x50, 0xd0, 0xc7, 0x7a, 0xd6,
-	0xb2, 0xb5, 0x3a, 0xb3, 0xb6, 0x58, 0x37, 0x41, 0xd5, 0x27, 0x31, 0xf5, 0xc3, 0xf3, 0x84, 0x53,
-	0x84, 0x91, 0x6f, 0x60, 0x31, 0x61, 0x42, 0x05, 0x2c, 0x6c, 0x0b, 0x2e, 0x93, 0x38, 0x92, 0xbc,
-	0x2d, 0x95, 0x60, 0x8a, 0x77, 0xcf, 0xbd, 0x29, 0x3c, 0xc3, 0xcf, 0xce, 0x78, 0x6d, 0x80, 0x34,
-	0xc5, 0xb5, 0x52, 0x18, 0x5d, 0x48, 0x6e, 0x37, 0x90, 0x15, 0x98, 0xe9, 0x31, 0xd5, 0x39, 0xe5,
-	0x42, 0x9f, 0x19, 0x44, 0x5d, 0x2f, 0xbf, 0x9c, 0x5f, 0x75, 0x69, 0x25, 0xd5, 0xb6, 0x50, 0x59,
-	0xfb, 0x3f, 0x14, 0x74, 0x44, 0xa4, 0x08, 0xf9, 0x8d, 0xfd, 0xfd, 0xd9, 0x1c, 0x71, 0xc1, 0xde,
-	0xd8, 0xdf, 0xa6, 0x87, 0xb3, 0x16, 0x01, 0x70, 0xe8, 0xf6, 0xe6, 0x57, 0x74, 0x6b, 0x76, 0xaa,
-	0xf6, 0x2d, 0x54, 0xd2, 0x34, 0xcc, 0x7b, 0xc8, 0x27, 0x60, 0x77, 0x45, 0xdc, 0x4f, 0x30, 0xd9,
-	0xf2, 0xda, 0xe3, 0xc9, 0x64, 0x5f, 0x69, 0xc3, 0x6e, 0x8e, 0x1a, 0x04, 0x59, 0x82, 0xe2, 0xf7,
-	0x4c, 0x44, 0x3a, 0x06, 0x9d, 0x95, 0xbb, 0x9b, 0xa3, 0x99, 0xa2, 0x59, 0x02, 0x47, 0x70, 0xd9,
-	0x0f, 0x55, 0x6d, 0x13, 0x60, 0xe4, 0x2b, 0xc9, 0x73, 0x70, 0xd0, 0x59, 0x7a, 0xd6, 0x72, 0xfe,
-	0xd6, 0xf3, 0x9b, 0x30, 0x1c, 0xf8, 0x29, 0x88, 0xa6, 0xb2, 0xf6, 0x47, 0x1e, 0xdc, 0x11, 0x82,
-	0xfc, 0x0f, 0x0a, 0x11, 0xeb, 0x99, 0x7e, 0xb8, 0xcd, 0xd2, 0x70, 0xe0, 0xe3, 0x9e, 0xe2, 0x53,
-	0x5b, 0x4f, 0x82, 0x90, 0x9b, 0x98, 0x8c, 0x55, 0xef, 0x29, 0x3e, 0xc9, 0x33, 0xb0, 0x91, 0x66,
-	0x58, 0xb6, 0xf2, 0xda, 0xf4, 0xe4, 0xfb, 0x9b, 0xee, 0x70, 0xe0, 0x1b, 0x33, 0x35, 0x82, 0xac,
-	0x42, 0x29, 0x88, 0x14, 0x17, 0x67, 0x2c, 0xf4, 0x0a, 0xcb, 0xd6, 0xaa, 0xd5, 0x9c, 0x1e, 0x0e,
-	0xfc, 0x91, 0x8e, 0x8e, 0x56, 0x84, 0xc2, 0x53, 0x7e, 0xc6, 0xc2, 0x3e, 0x53, 0x41, 0x1c, 0xb5,
-	0x8f, 0xfb, 0xc2, 0x2c, 0x24, 0xef, 0xc4, 0xd1, 0xb1, 0xf4, 0x6c, 0x74, 0x26, 0xc3, 0x81, 0x3f,
-	0x33, 0x86, 0x1d, 0x06, 0x3d, 0x4e, 0x17, 0xc7, 0xfb, 0xad, 0xd4, 0xab, 0x65, 0x9c, 0x48, 0x1b,
-	0x1e, 0x85, 0x4c, 0xaa, 0xf6, 0x18, 0xe1, 0x39, 0xd8, 0x96, 0xa5, 0xba, 0x21, 0x71, 0x3d, 0x23,
-	0x71, 0xfd, 0x30, 0x23, 0x71, 0x73, 0xe9, 0x62, 0xe0, 0xe7, 0xf4, 0x7b, 0xb4, 0xeb, 0xf6, 0xc8,
-	0xf3, 0xdd, 0x2f, 0xbe, 0x45, 0x6f, 0xe8, 0x88, 0x0f, 0x76, 0x18, 0xf4, 0x02, 0xe5, 0xb9, 0xcb,
-	0xd6, 0x6a, 0xde, 0xe4, 0x8f, 0x0a, 0x6a, 0x04, 0x39, 0x83, 0x85, 0x3b, 0x28, 0xea, 0x95, 0x3e,
-	0x88, 0xc9, 0xcd, 0xa7, 0xc3, 0x81, 0x7f, 0x17, 0x9b, 0xe9, 0x5d, 0x87, 0xd7, 0x22, 0x28, 0xe8,
-	0x8e, 0x90, 0xe7, 0xe0, 0x0a, 0xde, 0x89, 0xc5, 0xb1, 0x66, 0x99, 0xa1, 0xe4, 0xfc, 0xa8, 0x65,
-	0x99, 0x41, 0x23, 0x77, 0x73, 0x74, 0x8c, 0x24, 0x2b, 0x60, 0xb3, 0x90, 0x0b, 0x85, 0x24, 0x28,
-	0xaf, 0x55, 0x32, 0x97, 0x0d, 0xad, 0xd4, 0x0c, 0x46, 0xeb, 0x04, 0x4b, 0x7f, 0xcc, 0x43, 0x05,
-	0x8d, 0x7b, 0x91, 0x54, 0x2c, 0xea, 0x70, 0xf2, 0x12, 0x1c, 0x9c, 0x29, 0xf2, 0xe6, 0x4d, 0x78,
-	0xb3, 0xaf, 0xd5, 0x2d, 0xae, 0x9a, 0x33, 0x69, 0xa5, 0x53, 0x20, 0x4d, 0x25, 0xd9, 0x85, 0x32,
-	0x8b, 0xa2, 0x58, 0x61, 0x8d, 0x65, 0x1a, 0xc3, 0x2d, 0xfe, 0x4f, 0x52, 0xff, 0x49, 0x34, 0x9d,
-	0xdc, 0x90, 0x75, 0xb0, 0xa5, 0x62, 0x8a, 0x7b, 0x79, 0x2c, 0x36, 0xb9, 0x96, 0x47, 0x4b, 0x5b,
-	0x4c, 0xcf, 0x10, 0x44, 0x8d, 0x20, 0x2d, 0x70, 0x59, 0x47, 0x05, 0x67, 0xbc, 0xcd, 0x14, 0x92,
-	0xf6, 0x1e, 0xbe, 0x0c, 0x07, 0x3e, 0x31, 0x0e, 0x1b, 0xea, 0xb3, 0xb8, 0x17, 0x28, 0xde, 0x4b,
-	0xd4, 0x39, 0xf2, 0xa5, 0x94, 0xe9, 0x35, 0x53, 0x34, 0x6d, 0x38, 0x12, 0xd9, 0x35, 0x6f, 0x45,
-	0x05, 0x35, 0xe2, 0xef, 0x98, 0xe2, 0xfc, 0x97, 0x4c, 0xf9, 0xc9, 0x06, 0x1b, 0xcb, 0x31, 0x2e,
-	0x96, 0xf5, 0x11, 0xc5, 0xca, 0x66, 0xc9, 0xd4, 0xad, 0xb3, 0xc4, 0x07, 0xfb, 0x6d, 0x9f, 0x8b,
-	0x73, 0xac, 0x7f, 0x9a, 0x35, 0x2a, 0xa8, 0x11, 0xe4, 0x0b, 0x98, 0xfd, 0xcb, 0x55, 0x9f, 0x98,
-	0x13, 0x99, 0x8d, 0x3e, 0x3a, 0xbe, 0x71, 0xb5, 0xc7, 0xf4, 0xb2, 0xff, 0x25, 0xbd, 0x9c, 0x7f,
-	0x4e, 0xaf, 0x97, 0xe0, 0xe0, 0x45, 0x90, 0x5e, 0x11, 0xa7, 0xe1, 0xfc, 0xb5, 0x92, 0x65, 0x57,
-	0xc1, 0x4c, 0x64, 0x03, 0xa4, 0xa9, 0x24, 0x35, 0x70, 0x4e, 0x39, 0x0b, 0xd5, 0x29, 0xce, 0x01,
-	0xd7, 0x60, 0x8c, 0x86, 0xa6, 0x92, 0xbc, 0x00, 0x30, 0xe3, 0x4b, 0x88, 0x58, 0xe0, 0x88, 0x71,
-	0x9b, 0x0b, 0xc3, 0x81, 0xff, 0x04, 0xa7, 0x90, 0x56, 0x8e, 0xe9, 0x46, 0xdd, 0x91, 0xf2, 0xbe,
-	0x51, 0x0a, 0x0f, 0x34, 0x4a, 0xcb, 0x0f, 0x3a, 0x4a, 0x77, 0x61, 0xe1, 0x3b, 0xce, 0x93, 0xf6,
-	0x49, 0xa0, 0x3f, 0xc0, 0xed, 0x93, 0x58, 0x8c, 0x02, 0x9e, 0xc6, 0x80, 0x1f, 0x0f, 0x07, 0x7e,
-	0x45, 0x43, 0x76, 0x10, 0xb1, 0x13, 0x0b, 0x3a, 0x77, 0x6d, 0x9b, 0x86, 0x5a, 0xfb, 0x21, 0x0f,
-	0x95, 0x6b, 0xb3, 0xed, 0x9e, 0x0f, 0xde, 0x88, 0xa4, 0x53, 0x77, 0x90, 0x74, 0xcc, 0xb5, 0xfc,
-	0xc7, 0x72, 0x6d, 0xdc, 0xe6, 0xc2, 0x07, 0xb6, 0xd9, 0x7e, 0xa8, 0x36, 0x3b, 0x0f, 0xd4, 0xe6,
-	0xe2, 0x43, 0xb6, 0xf9, 0xd3, 0x75, 0x80, 0xf1, 0x3c, 0x21, 0xd3, 0x50, 0xda, 0x3b, 0xd8, 0xd8,
-	0x3c, 0xdc, 0xfb, 0x7a, 0x7b, 0x36, 0x47, 0xca, 0x50, 0x7c, 0xbd, 0x7d, 0xb0, 0xb5, 0x77, 0xf0,
-	0xca, 0xfc, 0x65, 0xed, 0xec, 0x51, 0xbd, 0x9e, 0x5a, 0xfb, 0x12, 0x6c, 0xfc, 0xcb, 0x22, 0x2f,
-	0xb2, 0xc5, 0xdc, 0x6d, 0x3f, 0x91, 0x4b, 0xf3, 0x37, 0xb4, 0x66, 0xd4, 0x7d, 0x6e, 0x35, 0x57,
-	0x2e, 0x7e, 0xab, 0xe6, 0x2e, 0x2e, 0xab, 0xd6, 0xfb, 0xcb, 0xaa, 0xf5, 0xeb, 0x65, 0xd5, 0x7a,
-	0x77, 0x55, 0xcd, 0xbd, 0xbf, 0xaa, 0xe6, 0x7e, 0xbe, 0xaa, 0xe6, 0xde, 0x14, 0xd3, 0x1f, 0xe7,
-	0x23, 0x07, 0x93, 0x5b, 0xff, 0x33, 0x00, 0x00, 0xff, 0xff, 0xeb, 0xed, 0x6d, 0x27, 0x50, 0x0b,
-	0x00, 0x00,
+	// 1434 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x57, 0xcd, 0x52, 0x1b, 0xc7,
+	0x13, 0xd7, 0xea, 0x63, 0xa5, 0x6d, 0x21, 0x2c, 0xc6, 0x60, 0x16, 0xf0, 0x5f, 0x4b, 0xe9, 0x5f,
+	0xa4, 0x48, 0xca, 0x86, 0x14, 0x2e, 0x3b, 0xe5, 0x93, 0x0b, 0x19, 0x30, 0x54, 0x51, 0xd8, 0x35,
+	0x50, 0x49, 0x95, 0x73, 0x50, 0x16, 0x31, 0x88, 0x2d, 0xaf, 0x76, 0xe5, 0x9d, 0x11, 0x31, 0xcf,
+	0x90, 0x8b, 0xdf, 0x26, 0x79, 0x82, 0x94, 0x0f, 0x39, 0xf8, 0x96, 0x9c, 0x36, 0x09, 0xbe, 0xe9,
+	0x15, 0x72, 0x49, 0x4d, 0xcf, 0x7e, 0x21, 0x8b, 0x60, 0x27, 0x24, 0x97, 0x9d, 0x99, 0x5f, 0x77,
+	0xcf, 0x47, 0xf7, 0xaf, 0x7b, 0x66, 0x61, 0x36, 0x18, 0xb8, 0x8c, 0xaf, 0xe2, 0xb7, 0x7f, 0xb8,
+	0x1a, 0xf4, 0x3b, 0x2b, 0xfd, 0xc0, 0x17, 0x3e, 0xd1, 0xc5, 0x89, 0xed, 0xf9, 0x7c, 0x7e, 0x8e,
+	0x0b, 0x3f, 0x60, 0xab, 0xf8, 0xed, 0x1f, 0xae, 0x8a, 0xb3, 0x3e, 0xe3, 0x4a, 0x25, 0x16, 0xb9,
+	0xf6, 0x21, 0x73, 0x47, 0x44, 0xd3, 0x5d, 0xbf, 0xeb, 0x63, 0x77, 0x55, 0xf6, 0x22, 0xd4, 0xea,
+	0xfa, 0x7e, 0xd7, 0x65, 0xab, 0x38, 0x3a, 0x1c, 0x1c, 0xaf, 0x0a, 0xa7, 0xc7, 0xb8, 0xb0, 0x7b,
+	0x7d, 0xa5, 0xd0, 0xfc, 0xb9, 0x00, 0x13, 0x54, 0x6e, 0x85, 0xb2, 0x97, 0x03, 0xc6, 0x05, 0xb9,
+	0x0b, 0x45, 0x39, 0xad, 0xa9, 0x2d, 0x6a, 0xcb, 0x93, 0x6b, 0x73, 0x2b, 0x6a, 0x53, 0x2b, 0x59,
+	0x9d, 0x95, 0x83, 0xb3, 0x3e, 0xa3, 0xa8, 0x46, 0xbe, 0x86, 0xb9, 0xbe, 0x1d, 0x08, 0xc7, 0x76,
+	0xdb, 0x01, 0xe3, 0x7d, 0xdf, 0xe3, 0xac, 0xcd, 0x45, 0x60, 0x0b, 0xd6, 0x3d, 0x33, 0xf3, 0x38,
+	0x87, 0x15, 0xcf, 0xf1, 0x4c, 0x29, 0xd2, 0x48, 0x6f, 0x3f, 0x52, 0xa3, 0xb3, 0xfd, 0xf1, 0x02,
+	0xb2, 0x04, 0x93, 0x3d, 0x5b, 0x74, 0x4e, 0x58, 0x20, 0xe7, 0x74, 0xbc, 0xae, 0x59, 0x58, 0x2c,
+	0x2c, 0x1b, 0xb4, 0x16, 0xa1, 0xfb, 0x08, 0x12, 0x0b, 0xaa, 0xdd, 0xc0, 0x1f, 0xf4, 0xdb, 0xae,
+	0xd3, 0x73, 0x84, 0x59, 0x5c, 0xd4, 0x96, 0x0b, 0x14, 0x10, 0xda, 0x95, 0x08, 0x59, 0x86, 0xba,
+	0x52, 0xf0, 0xd8, 0x2b, 0xd1, 0x16, 0xfe, 0x0b, 0xe6, 0x99, 0xa5, 0x45, 0x6d, 0xd9, 0xa0, 0x93,
+	0x88, 0xef, 0xb1, 0x57, 0xe2, 0x40, 0xa2, 0x64, 0x01, 0x0c, 0x19, 0x98, 0xb6, 0x67, 0xf7, 0x98,
+	0xa9, 0xe3, 0x62, 0x15, 0x09, 0xec, 0xd9, 0x3d, 0x46, 0xfe, 0x07, 0x80, 0x42, 0xb4, 0x31, 0xcb,
+	0x28, 0x45, 0xf5, 0x27, 0x12, 0x20, 0x04, 0x8a, 0xc7, 0x8e, 0xcb, 0xcc, 0x0a, 0x0a, 0xb0, 0x4f,
+	0x6e, 0x81, 0x7e, 0xc2, 0x6c, 0x57, 0x9c, 0x98, 0x06, 0xa2, 0xd1, 0x88, 0x4c, 0x43, 0x89, 0x0b,
+	0x5b, 0x30, 0x13, 0x10, 0x56, 0x03, 0xf2, 0x7f, 0xa8, 0x71, 0x3f, 0x10, 0xec, 0x48, 0x2d, 0xc1,
+	0xcd, 0xea, 0xa2, 0xb6, 0x5c, 0xa1, 0x13, 0x0a, 0xc4, 0x55, 0x78, 0xf3, 0x13, 0x28, 0x4a, 0xff,
+	0x93, 0x32, 0x14, 0xd6, 0x77, 0x77, 0xeb, 0x39, 0x62, 0x40, 0x69, 0x7d, 0x77, 0x93, 0x1e, 0xd4,
+	0x35, 0x02, 0xa0, 0xd3, 0xcd, 0xc7, 0x4f, 0xe9, 0x46, 0x3d, 0xdf, 0xfc, 0x06, 0x6a, 0x51, 0xd0,
+	0x94, 0x57, 0xc9, 0xa7, 0x50, 0x52, 0x3b, 0x97, 0xa1, 0xad, 0xae, 0x4d, 0x65, 0x43, 0x8b, 0x73,
+	0x6f, 0xe7, 0xa8, 0xd2, 0x20, 0xf3, 0x50, 0xfe, 0xd6, 0x0e, 0x3c, 0xe9, 0x71, 0x19, 0x43, 0x63,
+	0x3b, 0x47, 0x63, 0xa0, 0x55, 0x01, 0x3d, 0x60, 0x7c, 0xe0, 0x8a, 0xe6, 0x77, 0x1a, 0x40, 0x62,
+	0xcc, 0xc9, 0x7d, 0xd0, 0xa3, 0x6d, 0x6b, 0x8b, 0x85, 0xb1, 0x0b, 0xb4, 0x60, 0x18, 0x5a, 0x91,
+	0x12, 0x8d, 0x5a, 0xb2, 0x35, 0x26, 0x38, 0xb8, 0x68, 0xeb, 0xf6, 0x30, 0xb4, 0xcc, 0x8b, 0x01,
+	0xba, 0xe3, 0xf7, 0x1c, 0xc1, 0x7a, 0x7d, 0x71, 0x36, 0x1a, 0xba, 0xe6, 0x0f, 0x45, 0x30, 0x92,
+	0x95, 0xc8, 0x6d, 0x28, 0x62, 0x0c, 0x35, 0x9c, 0xa9, 0x32, 0x0c, 0x2d, 0x1c, 0x53, 0xfc, 0x4a,
+	0x29, 0x86, 0x2a, 0x9f, 0x4a, 0xe5, 0x38, 0x0a, 0xda, 0x5d, 0x28, 0x61, 0x76, 0x22, 0xdb, 0xaa,
+	0x6b, 0x13, 0xd9, 0x73, 0xb4, 0x8c, 0x61, 0x68, 0x29, 0x31, 0x55, 0x0d, 0x59, 0x86, 0x8a, 0xe3,
+	0x09, 0x16, 0x9c, 0xda, 0x2e, 0x72, 0x4f, 0x6b, 0x4d, 0x0c, 0x43, 0x2b, 0xc1, 0x68, 0xd2, 0x23,
+	0x14, 0x16, 0xd8, 0xa9, 0xed, 0x0e, 0x6c, 0xe1, 0xf8, 0x5e, 0xfb, 0x68, 0x10, 0xa8, 0x0e, 0x67,
+	0x1d, 0xdf, 0x3b, 0xe2, 0x48, 0x49, 0xad, 0x45, 0x86, 0xa1, 0x35, 0x99, 0xaa, 0x1d, 0x38, 0x3d,
+	0x46, 0xe7, 0xd2, 0xf1, 0x46, 0x64, 0xb5, 0xaf, 0x8c, 0x48, 0x1b, 0x6e, 0xb8, 0x36, 0x17, 0xed,
+	0x54, 0xc3, 0xd4, 0x31, 0xbe, 0xf3, 0x2b, 0x2a, 0xf7, 0x57, 0xe2, 0xdc, 0x5f, 0x39, 0x88, 0x73,
+	0xbf, 0x35, 0xff, 0x26, 0xb4, 0x72, 0x72, 0x1d, 0x69, 0xba, 0x99, 0x58, 0xbe, 0xfe, 0xd5, 0xd2,
+	0xe8, 0x08, 0x46, 0x2c, 0x28, 0xa9, 0xbc, 0x32, 0x64, 0x5e, 0xa9, 0xf3, 0x23, 0x40, 0x55, 0x43,
+	0x4e, 0x61, 0xf6, 0x92, 0xcc, 0x36, 0x2b, 0x1f, 0x54, 0x00, 0x5a, 0x0b, 0xc3, 0xd0, 0xba, 0xac,
+	0x08, 0xd0, 0xcb, 0x26, 0x27, 0xdb, 0x50, 0xe6, 0xfe, 0x20, 0xe8, 0x30, 0x8e, 0x59, 0x54, 0x5d,
+	0x9b, 0x7d, 0x8f, 0x70, 0xfb, 0x28, 0x6f, 0xcd, 0x0c, 0x43, 0x6b, 0x2a, 0xd2, 0xcd, 0x30, 0x28,
+	0x36, 0x6f, 0xfe, 0xa4, 0xc1, 0x8d, 0x11, 0x1b, 0x19, 0x55, 0xe6, 0x1d, 0xf5, 0x7d, 0xc7, 0x13,
+	0x11, 0x89, 0x30, 0xaa, 0x31, 0x46, 0x93, 0x1e, 0x79, 0x0c, 0x80, 0x05, 0xb9, 0xcd, 0x99, 0xe0,
+	0x66, 0xfe, 0x22, 0xf7, 0x9f, 0xef, 0x4a, 0xd1, 0x3e, 0x13, 0xad, 0xa9, 0xc8, 0xe7, 0x86, 0x1b,
+	0x21, 0x9c, 0xa6, 0xdd, 0x84, 0x91, 0x85, 0xb1, 0x8c, 0xbc, 0x03, 0xba, 0x60, 0x9e, 0xed, 0xa9,
+	0xe2, 0x66, 0xb4, 0xa6, 0x87, 0xa1, 0x55, 0x57, 0x48, 0xe6, 0x3c, 0x91, 0x4e, 0xd3, 0x83, 0xa2,
+	0x3c, 0x0d, 0xb9, 0x0f, 0x46, 0xc0, 0x3a, 0x7e, 0x70, 0x24, 0xf3, 0x58, 0x25, 0xfd, 0x4c, 0xe2,
+	0xa2, 0x58, 0x20, 0x35, 0xb7, 0x73, 0x34, 0xd5, 0x24, 0x4b, 0x50, 0xb2, 0x5d, 0x16, 0x08, 0xcc,
+	0x8e, 0xea, 0x5a, 0x2d, 0x36, 0x59, 0x97, 0xa0, 0xac, 0x11, 0x28, 0xcd, 0xd4, 0x81, 0xef, 0x0b,
+	0x50, 0x43, 0xe1, 0x8e, 0xc7, 0x85, 0xed, 0x75, 0x18, 0x79, 0x08, 0x3a, 0x1e, 0x8d, 0x8f, 0xd6,
+	0x9a, 0xd4, 0x1d, 0x93, 0x91, 0x3b, 0x22, 0x45, 0x1a, 0xb5, 0x64, 0x1b, 0xaa, 0xb6, 0xe7, 0xf9,
+	0x02, 0xc9, 0xc7, 0xcd, 0xfc, 0x65, 0xf6, 0x37, 0x23, 0xfb, 0xac, 0x36, 0xcd, 0x0e, 0xc8, 0xbd,
+	0xb8, 0xc6, 0x16, 0x90, 0x85, 0xe4, 0xc2, 0x39, 0xf6, 0xa5, 0x44, 0x91, 0x19, 0x95, 0xe2, 0x12,
+	0xbc, 0x0f, 0x86, 0xdd, 0x11, 0xce, 0x29, 0x6b, 0xdb, 0xca, 0xd9, 0x57, 0x24, 0xd2, 0x30, 0xb4,
+	0x88, 0x32, 0x58, 0xcf, 0x84, 0x02, 0x13, 0xa9, 0x12, 0xe3, 0x32, 0x85, 0x64, 0x3e, 0x31, 0x75,
+	0xe9, 0xa8, 0x55, 0x11, 0xa0, 0xaa, 0xf9, 0xab, 0x14, 0xd2, 0xff, 0xc5, 0x14, 0x6a, 0xfe, 0xa1,
+	0x43, 0x09, 0xdd, 0x91, 0x3a, 0x4b, 0xfb, 0x08, 0x67, 0xc5, 0x45, 0x36, 0x3f, 0xb6, 0xc8, 0x5a,
+	0x50, 0x7a, 0x39, 0x60, 0xc1, 0x59, 0xc4, 0x69, 0x34, 0x47, 0x80, 0xaa, 0x86, 0x7c, 0x01, 0xf5,
+	0xf7, 0x6a, 0x60, 0xa6, 0x80, 0xc6, 0x32, 0x7a, 0xe3, 0x68, 0xa4, 0xe6, 0xa5, 0xf4, 0x2a, 0xfd,
+	0x43, 0x7a, 0xe9, 0x7f, 0x9f, 0x5e, 0x0f, 0x41, 0xc7, 0x44, 0xe0, 0xf8, 0x12, 0xc8, 0xa4, 0xd6,
+	0x85, 0x54, 0x50, 0x57, 0x9e, 0x52, 0xa4, 0x51, 0x4b, 0x9a, 0xc9, 0xab, 0xa0, 0x82, 0xae, 0x41,
+	0x1d, 0x85, 0x24, 0x2f, 0x84, 0x07, 0x00, 0xaa, 0xae, 0x07, 0x81, 0x1f, 0x60, 0xed, 0x35, 0x5a,
+	0xb3, 0xc3, 0xd0, 0xba, 0x89, 0xe5, 0x59, 0x82, 0x99, 0xcc, 0x37, 0x12, 0xf0, 0xaa, 0x3b, 0x06,
+	0xae, 0xe9, 0x8e, 0xa9, 0x5e, 0xeb, 0x1d, 0xb3, 0x0d, 0xb3, 0x2f, 0x18, 0xeb, 0xb7, 0x8f, 0x1d,
+	0xf9, 0xa0, 0x6b, 0x1f, 0xfb, 0x41, 0xb2, 0xe1, 0x09, 0xdc, 0xf0, 0xd4, 0x30, 0xb4, 0x6a, 0x52,
+	0x65, 0x0b, 0x35, 0xb6, 0xfc, 0x80, 0x4e, 0x5f, 0x18, 0xc6, 0x5b, 0x75, 0x80, 0xa4, 0x6e, 0x6b,
+	0x1f, 0x31, 0x61, 0x3b, 0x2e, 0x37, 0x6b, 0xb8, 0xdb, 0x85, 0xec, 0xfd, 0x90, 0xae, 0x8e, 0x7e,
+	0x6b, 0x35, 0x86, 0xa1, 0x35, 0x9f, 0xb8, 0x71, 0x43, 0x19, 0x66, 0x5c, 0x5c, 0x1f, 0x95, 0x91,
+	0x47, 0x50, 0xc3, 0xa5, 0xa2, 0x87, 0x11, 0x37, 0x27, 0xe5, 0x5b, 0x0e, 0x4b, 0xc2, 0x2d, 0x29,
+	0xf8, 0x2a, 0xc2, 0x33, 0x93, 0x4c, 0x64, 0xf1, 0xe6, 0x8f, 0x45, 0xa8, 0x5d, 0xa8, 0xc3, 0x57,
+	0xbc, 0x5a, 0x92, 0x84, 0xca, 0x5f, 0x92, 0x50, 0x69, 0x5e, 0x14, 0x3e, 0x36, 0x2f, 0x52, 0x4a,
+	0x16, 0x3f, 0x90, 0x92, 0xa5, 0xeb, 0xa2, 0xa4, 0x7e, 0x4d, 0x94, 0x2c, 0x5f, 0x2b, 0x25, 0xc7,
+	0x13, 0xa9, 0xf2, 0x9f, 0x10, 0xc9, 0xf8, 0x48, 0x22, 0x9d, 0x6b, 0x70, 0x73, 0xcc, 0x56, 0xc8,
+	0x53, 0x30, 0x92, 0xff, 0x3d, 0x53, 0xbb, 0xd2, 0x3d, 0x33, 0xf1, 0x0b, 0x25, 0x31, 0x42, 0xcf,
+	0xa4, 0x43, 0xc9, 0xc0, 0x8e, 0x6b, 0x73, 0x9e, 0x65, 0x20, 0x02, 0x54, 0x35, 0x64, 0x2d, 0xf3,
+	0x6a, 0x52, 0x65, 0xff, 0x96, 0xbc, 0x21, 0x63, 0x2c, 0x73, 0x82, 0x44, 0x8f, 0x2c, 0x41, 0xb9,
+	0xc7, 0x38, 0xb7, 0xbb, 0x2c, 0xe2, 0x5e, 0x75, 0x18, 0x5a, 0x31, 0x44, 0xe3, 0xce, 0x67, 0xf7,
+	0x00, 0xd2, 0xcb, 0x88, 0x4c, 0x40, 0x65, 0x67, 0x6f, 0xfd, 0xf1, 0xc1, 0xce, 0x97, 0x9b, 0xf5,
+	0x1c, 0xa9, 0x42, 0xf9, 0xd9, 0xe6, 0xde, 0xc6, 0xce, 0xde, 0x13, 0xf5, 0x13, 0xb4, 0xb5, 0x43,
+	0x65, 0x3f, 0xbf, 0xf6, 0x08, 0x4a, 0xf8, 0x13, 0x44, 0x1e, 0xc4, 0x9d, 0xe9, 0x71, 0x7f, 0xb4,
+	0xf3, 0x33, 0x23, 0xa8, 0xba, 0x27, 0x3f, 0xd7, 0x5a, 0x4b, 0x6f, 0x7e, 0x6f, 0xe4, 0xde, 0x9c,
+	0x37, 0xb4, 0xb7, 0xe7, 0x0d, 0xed, 0xb7, 0xf3, 0x86, 0xf6, 0xfa, 0x5d, 0x23, 0xf7, 0xf6, 0x5d,
+	0x23, 0xf7, 0xcb, 0xbb, 0x46, 0xee, 0x79, 0x39, 0xfa, 0x8b, 0x3f, 0xd4, 0xd1, 0x9d, 0xf7, 0xfe,
+	0x1c, 0x00, 0x17, 0x4e, 0x87, 0x09, 0xdd, 0x0f, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -755,6 +901,73 @@ func (m *RulesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SortedGroups {
+		i--
+		if m.SortedGroups {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x58
+	}
+	if len(m.State) > 0 {
+		for iNdEx := len(m.State) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.State[iNdEx])
+			copy(dAtA[i:], m.State[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.State[iNdEx])))
+			i--
+			dAtA[i] = 0x52
+		}
+	}
+	if len(m.Health) > 0 {
+		for iNdEx := len(m.Health) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Health[iNdEx])
+			copy(dAtA[i:], m.Health[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.Health[iNdEx])))
+			i--
+			dAtA[i] = 0x4a
+		}
+	}
+	if len(m.File) > 0 {
+		for iNdEx := len(m.File) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.File[iNdEx])
+			copy(dAtA[i:], m.File[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.File[iNdEx])))
+			i--
+			dAtA[i] = 0x42
+		}
+	}
+	if len(m.RuleGroup) > 0 {
+		for iNdEx := len(m.RuleGroup) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.RuleGroup[iNdEx])
+			copy(dAtA[i:], m.RuleGroup[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.RuleGroup[iNdEx])))
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if len(m.RuleName) > 0 {
+		for iNdEx := len(m.RuleName) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.RuleName[iNdEx])
+			copy(dAtA[i:], m.RuleName[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.RuleName[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if len(m.GroupNextToken) > 0 {
+		i -= len(m.GroupNextToken)
+		copy(dAtA[i:], m.GroupNextToken)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.GroupNextToken)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if m.GroupLimit != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.GroupLimit))
+		i--
+		dAtA[i] = 0x20
+	}
 	if len(m.MatcherString) > 0 {
 		for iNdEx := len(m.MatcherString) - 1; iNdEx >= 0; iNdEx-- {
 			i -= len(m.MatcherString[iNdEx])
@@ -864,6 +1077,13 @@ func (m *RuleGroups) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.GroupNextToken) > 0 {
+		i -= len(m.GroupNextToken)
+		copy(dAtA[i:], m.GroupNextToken)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.GroupNextToken)))
+		i--
+		dAtA[i] = 0x12
+	}
 	if len(m.Groups) > 0 {
 		for iNdEx := len(m.Groups) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -901,6 +1121,20 @@ func (m *RuleGroup) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Sources) > 0 {
+		for iNdEx := len(m.Sources) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Sources[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x52
+		}
+	}
 	if m.Limit != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.Limit))
 		i--
@@ -962,6 +1196,64 @@ func (m *RuleGroup) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *RuleGroupSource) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RuleGroupSource) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RuleGroupSource) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Tenant) > 0 {
+		i -= len(m.Tenant)
+		copy(dAtA[i:], m.Tenant)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Tenant)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.File) > 0 {
+		i -= len(m.File)
+		copy(dAtA[i:], m.File)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.File)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.LabelSets) > 0 {
+		for iNdEx := len(m.LabelSets) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.LabelSets[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Endpoint) > 0 {
+		i -= len(m.Endpoint)
+		copy(dAtA[i:], m.Endpoint)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Endpoint)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *Rule) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1126,6 +1418,27 @@ func (m *Alert) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.LastWarnings) > 0 {
+		for iNdEx := len(m.LastWarnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.LastWarnings[iNdEx])
+			copy(dAtA[i:], m.LastWarnings[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.LastWarnings[iNdEx])))
+			i--
+			dAtA[i] = 0x72
+		}
+	}
+	if m.LastErrorDetails != nil {
+		{
+			size, err := m.LastErrorDetails.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x6a
+	}
 	if m.KeepFiringForSeconds != 0 {
 		i -= 8
 		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.KeepFiringForSeconds))))
@@ -1242,6 +1555,27 @@ func (m *RecordingRule) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.LastWarnings) > 0 {
+		for iNdEx := len(m.LastWarnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.LastWarnings[iNdEx])
+			copy(dAtA[i:], m.LastWarnings[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.LastWarnings[iNdEx])))
+			i--
+			dAtA[i] = 0x4a
+		}
+	}
+	if m.LastErrorDetails != nil {
+		{
+			size, err := m.LastErrorDetails.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x42
+	}
 	n11, err11 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastEvaluation, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastEvaluation):])
 	if err11 != nil {
 		return 0, err11
@@ -1297,6 +1631,58 @@ func (m *RecordingRule) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *RuleEvaluationError) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RuleEvaluationError) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RuleEvaluationError) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Message) > 0 {
+		i -= len(m.Message)
+		copy(dAtA[i:], m.Message)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Message)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Endpoint) > 0 {
+		i -= len(m.Endpoint)
+		copy(dAtA[i:], m.Endpoint)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Endpoint)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Class) > 0 {
+		i -= len(m.Class)
+		copy(dAtA[i:], m.Class)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Class)))
+		i--
+		dAtA[i] = 0x12
+	}
+	n12, err12 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.Timestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.Timestamp):])
+	if err12 != nil {
+		return 0, err12
+	}
+	i -= n12
+	i = encodeVarintRpc(dAtA, i, uint64(n12))
+	i--
+	dAtA[i] = 0xa
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintRpc(dAtA []byte, offset int, v uint64) int {
 	offset -= sovRpc(v)
 	base := offset
@@ -1326,6 +1712,46 @@ func (m *RulesRequest) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.GroupLimit != 0 {
+		n += 1 + sovRpc(uint64(m.GroupLimit))
+	}
+	l = len(m.GroupNextToken)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.RuleName) > 0 {
+		for _, s := range m.RuleName {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if len(m.RuleGroup) > 0 {
+		for _, s := range m.RuleGroup {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if len(m.File) > 0 {
+		for _, s := range m.File {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if len(m.Health) > 0 {
+		for _, s := range m.Health {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if len(m.State) > 0 {
+		for _, s := range m.State {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.SortedGroups {
+		n += 2
+	}
 	return n
 }
 
@@ -1375,6 +1801,10 @@ func (m *RuleGroups) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	l = len(m.GroupNextToken)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -1412,6 +1842,39 @@ func (m *RuleGroup) Size() (n int) {
 	if m.Limit != 0 {
 		n += 1 + sovRpc(uint64(m.Limit))
 	}
+	if len(m.Sources) > 0 {
+		for _, e := range m.Sources {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *RuleGroupSource) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Endpoint)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.LabelSets) > 0 {
+		for _, e := range m.LabelSets {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	l = len(m.File)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	l = len(m.Tenant)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -1524,6 +1987,16 @@ func (m *Alert) Size() (n int) {
 	if m.KeepFiringForSeconds != 0 {
 		n += 9
 	}
+	if m.LastErrorDetails != nil {
+		l = m.LastErrorDetails.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.LastWarnings) > 0 {
+		for _, s := range m.LastWarnings {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1556,8 +2029,41 @@ func (m *RecordingRule) Size() (n int) {
 	}
 	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.LastEvaluation)
 	n += 1 + l + sovRpc(uint64(l))
-	return n
-}
+	if m.LastErrorDetails != nil {
+		l = m.LastErrorDetails.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.LastWarnings) > 0 {
+		for _, s := range m.LastWarnings {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *RuleEvaluationError) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.Timestamp)
+	n += 1 + l + sovRpc(uint64(l))
+	l = len(m.Class)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	l = len(m.Endpoint)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	l = len(m.Message)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	return n
+}
 
 func sovRpc(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
@@ -1664,6 +2170,237 @@ func (m *RulesRequest) Unmarshal(dAtA []byte) error {
 			}
 			m.MatcherString = append(m.MatcherString, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field GroupLimit", wireType)
+			}
+			m.GroupLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.GroupLimit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field GroupNextToken", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.GroupNextToken = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RuleName", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RuleName = append(m.RuleName, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RuleGroup", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RuleGroup = append(m.RuleGroup, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field File", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.File = append(m.File, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Health = append(m.Health, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.State = append(m.State, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SortedGroups", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SortedGroups = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -1865,20 +2602,52 @@ func (m *RuleGroups) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipRpc(dAtA[iNdEx:])
-			if err != nil {
-				return err
-			}
-			if (skippy < 0) || (iNdEx+skippy) < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if (iNdEx + skippy) > l {
-				return io.ErrUnexpectedEOF
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field GroupNextToken", wireType)
 			}
-			iNdEx += skippy
-		}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.GroupNextToken = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
 	}
 
 	if iNdEx > l {
@@ -2106,6 +2875,220 @@ func (m *RuleGroup) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Sources", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Sources = append(m.Sources, &RuleGroupSource{})
+			if err := m.Sources[len(m.Sources)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RuleGroupSource) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RuleGroupSource: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RuleGroupSource: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Endpoint", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Endpoint = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LabelSets", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LabelSets = append(m.LabelSets, labelpb.ZLabelSet{})
+			if err := m.LabelSets[len(m.LabelSets)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field File", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.File = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Tenant", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Tenant = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2469,7 +3452,438 @@ func (m *AlertInstance) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *Alert) Unmarshal(dAtA []byte) error {
+func (m *Alert) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Alert: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Alert: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			m.State = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.State |= AlertState(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Query = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DurationSeconds", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.DurationSeconds = float64(math.Float64frombits(v))
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Labels.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Annotations", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Annotations.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Alerts", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Alerts = append(m.Alerts, &AlertInstance{})
+			if err := m.Alerts[len(m.Alerts)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Health = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastError = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 10:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EvaluationDurationSeconds", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.EvaluationDurationSeconds = float64(math.Float64frombits(v))
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluation", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastEvaluation, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 12:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KeepFiringForSeconds", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.KeepFiringForSeconds = float64(math.Float64frombits(v))
+		case 13:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastErrorDetails", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.LastErrorDetails == nil {
+				m.LastErrorDetails = &RuleEvaluationError{}
+			}
+			if err := m.LastErrorDetails.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastWarnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastWarnings = append(m.LastWarnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -2492,32 +3906,13 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Alert: wiretype end group for non-group")
+			return fmt.Errorf("proto: RecordingRule: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Alert: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: RecordingRule: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
-			}
-			m.State = 0
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowRpc
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				m.State |= AlertState(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
 			}
@@ -2549,7 +3944,7 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 			}
 			m.Name = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 3:
+		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
 			}
@@ -2581,18 +3976,7 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 			}
 			m.Query = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 4:
-			if wireType != 1 {
-				return fmt.Errorf("proto: wrong wireType = %d for field DurationSeconds", wireType)
-			}
-			var v uint64
-			if (iNdEx + 8) > l {
-				return io.ErrUnexpectedEOF
-			}
-			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
-			iNdEx += 8
-			m.DurationSeconds = float64(math.Float64frombits(v))
-		case 5:
+		case 3:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
 			}
@@ -2625,11 +4009,11 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		case 6:
+		case 4:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Annotations", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2639,30 +4023,29 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if err := m.Annotations.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Health = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 7:
+		case 5:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Alerts", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2672,31 +4055,40 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Alerts = append(m.Alerts, &AlertInstance{})
-			if err := m.Alerts[len(m.Alerts)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.LastError = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 8:
+		case 6:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EvaluationDurationSeconds", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.EvaluationDurationSeconds = float64(math.Float64frombits(v))
+		case 7:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluation", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2706,29 +4098,30 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Health = string(dAtA[iNdEx:postIndex])
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastEvaluation, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
 			iNdEx = postIndex
-		case 9:
+		case 8:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field LastErrorDetails", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2738,40 +4131,33 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.LastError = string(dAtA[iNdEx:postIndex])
-			iNdEx = postIndex
-		case 10:
-			if wireType != 1 {
-				return fmt.Errorf("proto: wrong wireType = %d for field EvaluationDurationSeconds", wireType)
+			if m.LastErrorDetails == nil {
+				m.LastErrorDetails = &RuleEvaluationError{}
 			}
-			var v uint64
-			if (iNdEx + 8) > l {
-				return io.ErrUnexpectedEOF
+			if err := m.LastErrorDetails.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
 			}
-			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
-			iNdEx += 8
-			m.EvaluationDurationSeconds = float64(math.Float64frombits(v))
-		case 11:
+			iNdEx = postIndex
+		case 9:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluation", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field LastWarnings", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2781,36 +4167,24 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastEvaluation, dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.LastWarnings = append(m.LastWarnings, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
-		case 12:
-			if wireType != 1 {
-				return fmt.Errorf("proto: wrong wireType = %d for field KeepFiringForSeconds", wireType)
-			}
-			var v uint64
-			if (iNdEx + 8) > l {
-				return io.ErrUnexpectedEOF
-			}
-			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
-			iNdEx += 8
-			m.KeepFiringForSeconds = float64(math.Float64frombits(v))
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2832,7 +4206,7 @@ func (m *Alert) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *RecordingRule) Unmarshal(dAtA []byte) error {
+func (m *RuleEvaluationError) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -2855,17 +4229,17 @@ func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: RecordingRule: wiretype end group for non-group")
+			return fmt.Errorf("proto: RuleEvaluationError: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: RecordingRule: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: RuleEvaluationError: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -2875,27 +4249,28 @@ func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Name = string(dAtA[iNdEx:postIndex])
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.Timestamp, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Class", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -2923,44 +4298,11 @@ func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Query = string(dAtA[iNdEx:postIndex])
+			m.Class = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
 		case 3:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
-			}
-			var msglen int
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowRpc
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				msglen |= int(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-			if msglen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			if err := m.Labels.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
-		case 4:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Endpoint", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -2988,11 +4330,11 @@ func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Health = string(dAtA[iNdEx:postIndex])
+			m.Endpoint = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
-		case 5:
+		case 4:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Message", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -3020,51 +4362,7 @@ func (m *RecordingRule) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.LastError = string(dAtA[iNdEx:postIndex])
-			iNdEx = postIndex
-		case 6:
-			if wireType != 1 {
-				return fmt.Errorf("proto: wrong wireType = %d for field EvaluationDurationSeconds", wireType)
-			}
-			var v uint64
-			if (iNdEx + 8) > l {
-				return io.ErrUnexpectedEOF
-			}
-			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
-			iNdEx += 8
-			m.EvaluationDurationSeconds = float64(math.Float64frombits(v))
-		case 7:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluation", wireType)
-			}
-			var msglen int
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowRpc
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				msglen |= int(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-			if msglen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastEvaluation, dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Message = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -0,0 +1,143 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// Sharder shards rule groups across a static set of ruler replicas, the peers. Every rule group is owned by a single
+// healthy peer, chosen by rendezvous hashing, so that only the groups of a peer are re-assigned when it becomes
+// unhealthy, and assigned back to it once it recovers.
+type Sharder struct {
+	logger log.Logger
+	self   string
+	peers  []string
+	client *http.Client
+
+	mtx     sync.RWMutex
+	healthy []string
+
+	healthyPeers prometheus.Gauge
+}
+
+// NewSharder returns a sharder of rule groups across the given peers, which are the base HTTP URLs of the ruler replicas.
+// Self is the URL of the local replica, it must be one of the peers. All the peers are considered healthy initially.
+func NewSharder(logger log.Logger, reg prometheus.Registerer, self string, peers []string, client *http.Client) (*Sharder, error) {
+	peers = append([]string{}, peers...)
+	sort.Strings(peers)
+	found := false
+	for i, p := range peers {
+		if i > 0 && p == peers[i-1] {
+			return nil, errors.Errorf("duplicated peer %s", p)
+		}
+		found = found || p == self
+	}
+	if !found {
+		return nil, errors.Errorf("self %s is not one of the peers", self)
+	}
+
+	s := &Sharder{
+		logger:  logger,
+		self:    self,
+		peers:   peers,
+		client:  client,
+		healthy: peers,
+		healthyPeers: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_rule_sharding_healthy_peers",
+			Help: "The number of healthy ruler peers rule groups are sharded across.",
+		}),
+	}
+	s.healthyPeers.Set(float64(len(peers)))
+	return s, nil
+}
+
+// Owns returns true if the local replica owns the rule group of the given rule file. Groups are identified by the base
+// name of their file, so that peers may load the same rule files from different paths.
+func (s *Sharder) Owns(file, group string) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	key := filepath.Base(file) + "\xff" + group
+	var (
+		owner    string
+		maxScore uint64
+	)
+	for _, p := range s.healthy {
+		if score := xxhash.Sum64String(p + "\xff" + key); owner == "" || score > maxScore {
+			owner, maxScore = p, score
+		}
+	}
+	return owner == s.self
+}
+
+// CheckPeers checks the readiness of the peers, and returns true if the set of healthy peers changed.
+// The local replica is always healthy.
+func (s *Sharder) CheckPeers(ctx context.Context) bool {
+	healthy := make([]bool, len(s.peers))
+	var wg sync.WaitGroup
+	for i, p := range s.peers {
+		if p == s.self {
+			healthy[i] = true
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			if err := s.checkPeer(ctx, p); err != nil {
+				level.Debug(s.logger).Log("msg", "ruler peer is unhealthy", "peer", p, "err", err)
+				return
+			}
+			healthy[i] = true
+		}(i, p)
+	}
+	wg.Wait()
+
+	var peers []string
+	for i, p := range s.peers {
+		if healthy[i] {
+			peers = append(peers, p)
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if strings.Join(peers, ",") == strings.Join(s.healthy, ",") {
+		return false
+	}
+	level.Info(s.logger).Log("msg", "healthy ruler peers changed", "peers", strings.Join(peers, ","))
+	s.healthy = peers
+	s.healthyPeers.Set(float64(len(peers)))
+	return true
+}
+
+func (s *Sharder) checkPeer(ctx context.Context, peer string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer, "/")+"/-/ready", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(s.logger, resp.Body, "peer readiness response body")
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("readiness check returned HTTP status %d", resp.StatusCode)
+	}
+	return nil
+}
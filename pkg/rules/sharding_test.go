@@ -0,0 +1,146 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+func TestSharder(t *testing.T) {
+	var ready [3]atomic.Bool
+	peers := make([]string, len(ready))
+	for i := range ready {
+		i := i
+		ready[i].Store(true)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/-/ready" || !ready[i].Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+		peers[i] = srv.URL
+	}
+
+	_, err := NewSharder(log.NewNopLogger(), nil, "http://unknown", peers, http.DefaultClient)
+	testutil.NotOk(t, err)
+	_, err = NewSharder(log.NewNopLogger(), nil, peers[0], append(peers, peers[0]), http.DefaultClient)
+	testutil.NotOk(t, err)
+
+	sharders := make([]*Sharder, len(peers))
+	for i, p := range peers {
+		sharders[i], err = NewSharder(log.NewNopLogger(), prometheus.NewRegistry(), p, peers, http.DefaultClient)
+		testutil.Ok(t, err)
+	}
+
+	owners := func() map[string]int {
+		res := map[string]int{}
+		for g := 0; g < 100; g++ {
+			group := fmt.Sprintf("group-%d", g)
+			owner := -1
+			for i, s := range sharders {
+				if !ready[i].Load() || !s.Owns("/etc/rules/rules.yaml", group) {
+					continue
+				}
+				testutil.Assert(t, owner == -1, "group %s is owned by replicas %d and %d", group, owner, i)
+				owner = i
+			}
+			testutil.Assert(t, owner != -1, "group %s is not owned by any replica", group)
+			res[group] = owner
+		}
+		return res
+	}
+
+	before := owners()
+	for i := range peers {
+		n := 0
+		for _, owner := range before {
+			if owner == i {
+				n++
+			}
+		}
+		testutil.Assert(t, n > 0, "replica %d owns no groups", i)
+	}
+	for _, s := range sharders {
+		testutil.Assert(t, !s.CheckPeers(context.Background()), "expected no change of healthy peers")
+	}
+	// Groups are identified by the base name of their file.
+	testutil.Equals(t, sharders[0].Owns("/etc/rules/rules.yaml", "group-0"), sharders[0].Owns("/other/rules.yaml", "group-0"))
+
+	// Groups of unhealthy replicas are re-assigned, the other ones are kept.
+	ready[1].Store(false)
+	testutil.Assert(t, sharders[0].CheckPeers(context.Background()), "expected a change of healthy peers")
+	testutil.Assert(t, sharders[2].CheckPeers(context.Background()), "expected a change of healthy peers")
+	for group, owner := range owners() {
+		if before[group] != 1 {
+			testutil.Equals(t, before[group], owner)
+		}
+	}
+
+	ready[1].Store(true)
+	for _, s := range sharders {
+		s.CheckPeers(context.Background())
+	}
+	testutil.Equals(t, before, owners())
+}
+
+func TestManager_GroupFilter(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "rules.yaml")
+	testutil.Ok(t, os.WriteFile(ruleFile, []byte(`
+groups:
+- name: owned
+  rules:
+  - record: owned
+    expr: vector(1)
+- name: not-owned
+  rules:
+  - record: not_owned
+    expr: vector(1)
+`), 0o666))
+
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		nil,
+		dir,
+		rules.ManagerOptions{
+			Logger:     log.NewNopLogger(),
+			Appendable: nopAppendable{},
+			Queryable:  nopQueryable{},
+		},
+		func(storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(context.Context, string, time.Time) (promql.Vector, error) { return nil, nil }
+		},
+		labels.EmptyLabels(),
+		"http://localhost",
+		WithGroupFilter(func(file, group string) bool {
+			testutil.Equals(t, ruleFile, file)
+			return group == "owned"
+		}),
+	)
+	testutil.Ok(t, thanosRuleMgr.Update(time.Minute, []string{ruleFile}))
+
+	thanosRuleMgr.Run()
+	defer thanosRuleMgr.Stop()
+
+	groups := thanosRuleMgr.RuleGroups()
+	testutil.Equals(t, 1, len(groups))
+	testutil.Equals(t, "owned", groups[0].Name())
+}
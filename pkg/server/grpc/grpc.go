@@ -145,8 +145,16 @@ func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer
 	met.InitializeMetrics(s)
 	reg.MustRegister(met)
 
-	grpc_health.RegisterHealthServer(s, probe.HealthServer())
-	reflection.Register(s)
+	if !options.disableHealthService {
+		// Report the health of the services registered so far, i.e. the Thanos APIs.
+		for name := range s.GetServiceInfo() {
+			probe.AddServices(name)
+		}
+		grpc_health.RegisterHealthServer(s, probe.HealthServer())
+	}
+	if !options.disableReflection {
+		reflection.Register(s)
+	}
 
 	return &Server{
 		logger: logger,
@@ -20,6 +20,9 @@ type options struct {
 
 	tlsConfig *tls.Config
 
+	disableReflection    bool
+	disableHealthService bool
+
 	grpcOpts []grpc.ServerOption
 }
 
@@ -82,6 +85,22 @@ func WithTLSConfig(cfg *tls.Config) Option {
 	})
 }
 
+// WithReflection enables or disables the gRPC server reflection service, which allows clients like grpcurl to
+// discover the served services. It is enabled by default.
+func WithReflection(enabled bool) Option {
+	return optionFunc(func(o *options) {
+		o.disableReflection = !enabled
+	})
+}
+
+// WithHealthService enables or disables the standard gRPC health checking service, which reports the status of
+// the component and of each served service. It is enabled by default.
+func WithHealthService(enabled bool) Option {
+	return optionFunc(func(o *options) {
+		o.disableHealthService = !enabled
+	})
+}
+
 // WithMaxConnAge sets the maximum connection age for gRPC server.
 func WithMaxConnAge(t time.Duration) Option {
 	return optionFunc(func(o *options) {
@@ -0,0 +1,314 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// maxAggregatedChunkSamples is the maximum number of samples of the chunks of aggregated series.
+const maxAggregatedChunkSamples = 120
+
+// aggregationHintSupported returns true if the aggregation of the given hint can be evaluated by stores.
+func aggregationHintSupported(h *storepb.AggregationHint) bool {
+	if h == nil {
+		return false
+	}
+	switch h.Func {
+	case storepb.Aggr_COUNT, storepb.Aggr_SUM, storepb.Aggr_MIN, storepb.Aggr_MAX:
+		return true
+	}
+	return false
+}
+
+// aggregatesForAggregationHint returns the aggregates of downsampled series needed to evaluate the given aggregation.
+func aggregatesForAggregationHint(f storepb.Aggr) []storepb.Aggr {
+	if f == storepb.Aggr_SUM {
+		return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}
+	}
+	return []storepb.Aggr{f}
+}
+
+type aggregatedSample struct {
+	t int64
+	v float64
+}
+
+type aggregationGroup struct {
+	lset    labels.Labels
+	windows map[int64]*aggregatedSample
+}
+
+// aggregationServer is a storepb.Store_SeriesServer aggregating the downsampled series sent to it by the labels and
+// function of an aggregation hint, over windows of the given size. Aggregated series are sent upon calling
+// sendAggregated. Other responses are forwarded to the upstream server.
+//
+// Series are first aggregated over time within every window, e.g. the sum of a series over a window is its average
+// over it, so that series split across blocks or replicas are accounted for once. Windows are then aggregated across
+// the series of every group, with the timestamp of their latest sample.
+type aggregationServer struct {
+	storepb.Store_SeriesServer
+
+	f          storepb.Aggr
+	by         []string
+	window     int64
+	mint, maxt int64
+
+	groups map[string]*aggregationGroup
+	it     chunkenc.Iterator
+}
+
+func newAggregationServer(upstream storepb.Store_SeriesServer, f storepb.Aggr, by []string, window, mint, maxt int64) *aggregationServer {
+	return &aggregationServer{
+		Store_SeriesServer: upstream,
+		f:                  f,
+		by:                 by,
+		window:             window,
+		mint:               mint,
+		maxt:               maxt,
+		groups:             map[string]*aggregationGroup{},
+	}
+}
+
+func (s *aggregationServer) Send(r *storepb.SeriesResponse) error {
+	series := r.GetSeries()
+	if series == nil {
+		return s.Store_SeriesServer.Send(r)
+	}
+
+	windows, err := s.aggregateSeries(series)
+	if err != nil {
+		return status.Error(codes.Internal, errors.Wrapf(err, "aggregate series %s", labelpb.ZLabelsToPromLabels(series.Labels).String()).Error())
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+
+	lset := labels.NewBuilder(labelpb.ZLabelsToPromLabels(series.Labels)).Keep(s.by...).Labels()
+	key := lset.String()
+	g, ok := s.groups[key]
+	if !ok {
+		g = &aggregationGroup{lset: lset, windows: make(map[int64]*aggregatedSample, len(windows))}
+		s.groups[key] = g
+	}
+	for w, smpl := range windows {
+		acc, ok := g.windows[w]
+		if !ok {
+			if s.f == storepb.Aggr_COUNT {
+				smpl.v = 1
+			}
+			g.windows[w] = smpl
+			continue
+		}
+		acc.t = max(acc.t, smpl.t)
+		switch s.f {
+		case storepb.Aggr_COUNT:
+			acc.v++
+		case storepb.Aggr_SUM:
+			acc.v += smpl.v
+		case storepb.Aggr_MIN:
+			acc.v = math.Min(acc.v, smpl.v)
+		case storepb.Aggr_MAX:
+			acc.v = math.Max(acc.v, smpl.v)
+		}
+	}
+	return nil
+}
+
+// aggregateSeries aggregates the samples of the given series over time within every window, by window.
+func (s *aggregationServer) aggregateSeries(series *storepb.Series) (map[int64]*aggregatedSample, error) {
+	type window struct {
+		aggregatedSample
+		count float64
+	}
+	windows := map[int64]*window{}
+	for _, c := range series.Chunks {
+		var chk, counts *storepb.Chunk
+		switch s.f {
+		case storepb.Aggr_COUNT:
+			chk = c.Count
+		case storepb.Aggr_SUM:
+			chk, counts = c.Sum, c.Count
+			if counts == nil {
+				return nil, errors.New("missing count aggregate")
+			}
+		case storepb.Aggr_MIN:
+			chk = c.Min
+		case storepb.Aggr_MAX:
+			chk = c.Max
+		}
+		if chk == nil {
+			return nil, errors.Errorf("missing %s aggregate", s.f)
+		}
+
+		samples, err := s.samples(chk)
+		if err != nil {
+			return nil, err
+		}
+		var countSamples []aggregatedSample
+		if counts != nil {
+			if countSamples, err = s.samples(counts); err != nil {
+				return nil, err
+			}
+			if len(countSamples) != len(samples) {
+				return nil, errors.New("count and sum aggregates have different number of samples")
+			}
+		}
+
+		for i, smpl := range samples {
+			if smpl.t < s.mint || smpl.t > s.maxt {
+				continue
+			}
+			count := 1.0
+			if countSamples != nil {
+				count = countSamples[i].v
+			}
+			wi := smpl.t / s.window
+			w, ok := windows[wi]
+			if !ok {
+				windows[wi] = &window{aggregatedSample: smpl, count: count}
+				continue
+			}
+			w.t = max(w.t, smpl.t)
+			w.count += count
+			switch s.f {
+			case storepb.Aggr_SUM:
+				w.v += smpl.v
+			case storepb.Aggr_MIN:
+				w.v = math.Min(w.v, smpl.v)
+			case storepb.Aggr_MAX:
+				w.v = math.Max(w.v, smpl.v)
+			}
+		}
+	}
+
+	res := make(map[int64]*aggregatedSample, len(windows))
+	for wi, w := range windows {
+		if s.f == storepb.Aggr_SUM {
+			// Sum of the averages of the series.
+			w.v /= w.count
+		}
+		res[wi] = &aggregatedSample{t: w.t, v: w.v}
+	}
+	return res, nil
+}
+
+func (s *aggregationServer) samples(c *storepb.Chunk) ([]aggregatedSample, error) {
+	if c.Type != storepb.Chunk_XOR {
+		return nil, errors.Errorf("unsupported chunk encoding %s", c.Type)
+	}
+	chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode chunk")
+	}
+	samples := make([]aggregatedSample, 0, chk.NumSamples())
+	s.it = chk.Iterator(s.it)
+	for s.it.Next() != chunkenc.ValNone {
+		t, v := s.it.At()
+		samples = append(samples, aggregatedSample{t: t, v: v})
+	}
+	return samples, errors.Wrap(s.it.Err(), "iterate chunk")
+}
+
+// sendAggregated sends the aggregated series, sorted by labels.
+func (s *aggregationServer) sendAggregated() error {
+	groups := make([]*aggregationGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return labels.Compare(groups[i].lset, groups[j].lset) < 0 })
+
+	for _, g := range groups {
+		samples := make([]aggregatedSample, 0, len(g.windows))
+		for _, smpl := range g.windows {
+			samples = append(samples, *smpl)
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].t < samples[j].t })
+
+		chks, err := s.encode(samples)
+		if err != nil {
+			return status.Error(codes.Internal, errors.Wrap(err, "encode aggregated series").Error())
+		}
+		if err := s.Store_SeriesServer.Send(storepb.NewSeriesResponse(&storepb.Series{
+			Labels: labelpb.ZLabelsFromPromLabels(g.lset),
+			Chunks: chks,
+		})); err != nil {
+			return status.Error(codes.Unknown, errors.Wrap(err, "send aggregated series response").Error())
+		}
+	}
+	return nil
+}
+
+// encode encodes the given aggregated samples into the aggregate of the aggregation. Sums come with a count of 1 for
+// every sample, so that clients computing averages of downsampled series get the sums.
+func (s *aggregationServer) encode(samples []aggregatedSample) ([]storepb.AggrChunk, error) {
+	var chks []storepb.AggrChunk
+	for len(samples) > 0 {
+		n := min(len(samples), maxAggregatedChunkSamples)
+		chk := storepb.AggrChunk{MinTime: samples[0].t, MaxTime: samples[n-1].t}
+
+		values, err := encodeXORChunk(samples[:n], func(smpl aggregatedSample) float64 { return smpl.v })
+		if err != nil {
+			return nil, err
+		}
+		switch s.f {
+		case storepb.Aggr_COUNT:
+			chk.Count = values
+		case storepb.Aggr_SUM:
+			chk.Sum = values
+			if chk.Count, err = encodeXORChunk(samples[:n], func(aggregatedSample) float64 { return 1 }); err != nil {
+				return nil, err
+			}
+		case storepb.Aggr_MIN:
+			chk.Min = values
+		case storepb.Aggr_MAX:
+			chk.Max = values
+		}
+		chks = append(chks, chk)
+		samples = samples[n:]
+	}
+	return chks, nil
+}
+
+func encodeXORChunk(samples []aggregatedSample, value func(aggregatedSample) float64) (*storepb.Chunk, error) {
+	c := chunkenc.NewXORChunk()
+	app, err := c.Appender()
+	if err != nil {
+		return nil, err
+	}
+	for _, smpl := range samples {
+		app.Append(smpl.t, value(smpl))
+	}
+	return &storepb.Chunk{Type: storepb.Chunk_XOR, Data: c.Bytes()}, nil
+}
+
+// serveAggregation serves a request with an aggregation hint by aggregating the downsampled series returned by the
+// given Series implementation over windows of the given size, grouped by the given labels.
+func serveAggregation(
+	r *storepb.SeriesRequest,
+	srv storepb.Store_SeriesServer,
+	window int64,
+	by []string,
+	series func(*storepb.SeriesRequest, storepb.Store_SeriesServer) error,
+) error {
+	req := *r
+	req.AggregationHint = nil
+	req.Aggregates = aggregatesForAggregationHint(r.AggregationHint.Func)
+
+	aggrSrv := newAggregationServer(srv, r.AggregationHint.Func, by, window, r.MinTime, r.MaxTime)
+	if err := series(&req, aggrSrv); err != nil {
+		return err
+	}
+	return aggrSrv.sendAggregated()
+}
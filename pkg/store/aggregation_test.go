@@ -0,0 +1,248 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+)
+
+type aggrSample struct {
+	t                   int64
+	count, sum, min, mx float64
+}
+
+func aggrSeriesResponse(t *testing.T, lset labels.Labels, smplChunks ...[]aggrSample) *storepb.SeriesResponse {
+	s := &storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+	for _, smpls := range smplChunks {
+		chks := [4]*chunkenc.XORChunk{chunkenc.NewXORChunk(), chunkenc.NewXORChunk(), chunkenc.NewXORChunk(), chunkenc.NewXORChunk()}
+		var apps [4]chunkenc.Appender
+		for i, c := range chks {
+			app, err := c.Appender()
+			testutil.Ok(t, err)
+			apps[i] = app
+		}
+		for _, smpl := range smpls {
+			for i, v := range []float64{smpl.count, smpl.sum, smpl.min, smpl.mx} {
+				apps[i].Append(smpl.t, v)
+			}
+		}
+		s.Chunks = append(s.Chunks, storepb.AggrChunk{
+			MinTime: smpls[0].t,
+			MaxTime: smpls[len(smpls)-1].t,
+			Count:   &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chks[0].Bytes()},
+			Sum:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chks[1].Bytes()},
+			Min:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chks[2].Bytes()},
+			Max:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chks[3].Bytes()},
+		})
+	}
+	return storepb.NewSeriesResponse(s)
+}
+
+func chunkSamples(t *testing.T, c *storepb.Chunk) []sample {
+	chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+	testutil.Ok(t, err)
+	var res []sample
+	it := chk.Iterator(nil)
+	for it.Next() != chunkenc.ValNone {
+		ts, v := it.At()
+		res = append(res, sample{ts, v})
+	}
+	testutil.Ok(t, it.Err())
+	return res
+}
+
+func TestServeAggregation(t *testing.T) {
+	series := []*storepb.SeriesResponse{
+		aggrSeriesResponse(t, labels.FromStrings("cluster", "a", "ext", "1", "pod", "1"),
+			[]aggrSample{{t: 100000, count: 2, sum: 4, min: 1, mx: 3}, {t: 400000, count: 1, sum: 5, min: 5, mx: 5}},
+			// Overlapping chunk, e.g. of another replica.
+			[]aggrSample{{t: 150000, count: 2, sum: 2, min: 0.5, mx: 2}},
+		),
+		aggrSeriesResponse(t, labels.FromStrings("cluster", "a", "ext", "1", "pod", "2"),
+			[]aggrSample{{t: 200000, count: 1, sum: 1, min: 1, mx: 1}, {t: 600000, count: 1, sum: 1, min: 1, mx: 1}},
+		),
+		aggrSeriesResponse(t, labels.FromStrings("cluster", "b", "ext", "1", "pod", "1"),
+			[]aggrSample{{t: 250000, count: 4, sum: 8, min: 0, mx: 4}},
+		),
+		storepb.NewWarnSeriesResponse(context.Canceled),
+	}
+
+	for _, tc := range []struct {
+		f        storepb.Aggr
+		expected map[string][]sample
+	}{
+		{
+			f: storepb.Aggr_SUM,
+			expected: map[string][]sample{
+				`{cluster="a", ext="1"}`: {{200000, 2.5}, {400000, 5}},
+				`{cluster="b", ext="1"}`: {{250000, 2}},
+			},
+		},
+		{
+			f: storepb.Aggr_MIN,
+			expected: map[string][]sample{
+				`{cluster="a", ext="1"}`: {{200000, 0.5}, {400000, 5}},
+				`{cluster="b", ext="1"}`: {{250000, 0}},
+			},
+		},
+		{
+			f: storepb.Aggr_MAX,
+			expected: map[string][]sample{
+				`{cluster="a", ext="1"}`: {{200000, 3}, {400000, 5}},
+				`{cluster="b", ext="1"}`: {{250000, 4}},
+			},
+		},
+		{
+			f: storepb.Aggr_COUNT,
+			expected: map[string][]sample{
+				`{cluster="a", ext="1"}`: {{200000, 2}, {400000, 1}},
+				`{cluster="b", ext="1"}`: {{250000, 1}},
+			},
+		},
+	} {
+		t.Run(tc.f.String(), func(t *testing.T) {
+			req := &storepb.SeriesRequest{
+				MinTime:         0,
+				MaxTime:         500000,
+				Aggregates:      []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM},
+				AggregationHint: &storepb.AggregationHint{Func: tc.f, By: []string{"cluster"}},
+			}
+			srv := storetestutil.NewSeriesServer(context.Background())
+			testutil.Ok(t, serveAggregation(req, srv, 300000, []string{"cluster", "ext"}, func(r *storepb.SeriesRequest, s storepb.Store_SeriesServer) error {
+				testutil.Assert(t, r.AggregationHint == nil)
+				testutil.Equals(t, aggregatesForAggregationHint(tc.f), r.Aggregates)
+				for _, resp := range series {
+					testutil.Ok(t, s.Send(resp))
+				}
+				return nil
+			}))
+			testutil.Equals(t, 1, len(srv.Warnings))
+			testutil.Equals(t, len(tc.expected), len(srv.SeriesSet))
+
+			for i, s := range srv.SeriesSet {
+				lset := labelpb.ZLabelsToPromLabels(s.Labels)
+				if i > 0 {
+					testutil.Assert(t, labels.Compare(labelpb.ZLabelsToPromLabels(srv.SeriesSet[i-1].Labels), lset) < 0, "series not sorted")
+				}
+				testutil.Equals(t, 1, len(s.Chunks))
+
+				c := s.Chunks[0]
+				var values *storepb.Chunk
+				switch tc.f {
+				case storepb.Aggr_SUM:
+					values = c.Sum
+					for _, smpl := range chunkSamples(t, c.Count) {
+						testutil.Equals(t, 1.0, smpl.v)
+					}
+				case storepb.Aggr_MIN:
+					values = c.Min
+				case storepb.Aggr_MAX:
+					values = c.Max
+				case storepb.Aggr_COUNT:
+					values = c.Count
+				}
+				testutil.Equals(t, tc.expected[lset.String()], chunkSamples(t, values), "%s", lset)
+			}
+		})
+	}
+}
+
+func TestAggregationServer_SplitsChunks(t *testing.T) {
+	smpls := make([]aggrSample, 0, 2*maxAggregatedChunkSamples+1)
+	for i := 0; i < cap(smpls); i++ {
+		smpls = append(smpls, aggrSample{t: int64(i) * 300000, count: 1, sum: float64(i), min: float64(i), mx: float64(i)})
+	}
+
+	srv := storetestutil.NewSeriesServer(context.Background())
+	aggrSrv := newAggregationServer(srv, storepb.Aggr_MAX, []string{"a"}, 300000, 0, smpls[len(smpls)-1].t)
+	testutil.Ok(t, aggrSrv.Send(aggrSeriesResponse(t, labels.FromStrings("a", "1", "b", "1"), smpls)))
+	testutil.Ok(t, aggrSrv.sendAggregated())
+
+	testutil.Equals(t, 1, len(srv.SeriesSet))
+	testutil.Equals(t, labels.FromStrings("a", "1"), labelpb.ZLabelsToPromLabels(srv.SeriesSet[0].Labels))
+	chks := srv.SeriesSet[0].Chunks
+	testutil.Equals(t, 3, len(chks))
+	testutil.Equals(t, maxAggregatedChunkSamples, len(chunkSamples(t, chks[0].Max)))
+	testutil.Equals(t, 1, len(chunkSamples(t, chks[2].Max)))
+	testutil.Equals(t, smpls[len(smpls)-1].t, chks[2].MaxTime)
+}
+
+func TestBucketStore_AggregationPushdown(t *testing.T) {
+	type block struct{ mint, maxt, res int64 }
+	newSet := func(lset labels.Labels, blocks ...block) *bucketBlockSet {
+		set := newBucketBlockSet(lset)
+		for _, b := range blocks {
+			var m metadata.Meta
+			m.MinTime, m.MaxTime = b.mint, b.maxt
+			m.Thanos.Labels = lset.Map()
+			m.Thanos.Downsample.Resolution = b.res
+			testutil.Ok(t, set.add(&bucketBlock{meta: &m}))
+		}
+		return set
+	}
+
+	s := &BucketStore{
+		enableAggregationPushdown: true,
+		blockSets: map[uint64]*bucketBlockSet{
+			1: newSet(labels.FromStrings("cluster", "a", "replica", "1"), block{0, 1000, downsample.ResLevel0}, block{1000, 2000, downsample.ResLevel1}, block{2000, 3000, downsample.ResLevel2}),
+			2: newSet(labels.FromStrings("region", "eu"), block{1000, 2000, downsample.ResLevel1}),
+		},
+	}
+	hint := &storepb.AggregationHint{Func: storepb.Aggr_SUM, By: []string{"job"}}
+	matchers := []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}
+
+	for _, tc := range []struct {
+		name string
+		req  *storepb.SeriesRequest
+
+		expectedWindow int64
+		expectedBy     []string
+		expectedOk     bool
+	}{
+		{
+			name: "raw blocks",
+			req:  &storepb.SeriesRequest{MinTime: 0, MaxTime: 3000, MaxResolutionWindow: downsample.ResLevel2, Matchers: matchers, AggregationHint: hint},
+		},
+		{
+			name:           "downsampled blocks",
+			req:            &storepb.SeriesRequest{MinTime: 1000, MaxTime: 3000, MaxResolutionWindow: downsample.ResLevel2, Matchers: matchers, AggregationHint: hint},
+			expectedWindow: downsample.ResLevel2,
+			expectedBy:     []string{"cluster", "job", "region", "replica"},
+			expectedOk:     true,
+		},
+		{
+			name:           "without replica labels and unselected blocks",
+			req:            &storepb.SeriesRequest{MinTime: 2000, MaxTime: 3000, MaxResolutionWindow: downsample.ResLevel2, Matchers: matchers, AggregationHint: hint, WithoutReplicaLabels: []string{"replica"}},
+			expectedWindow: downsample.ResLevel2,
+			expectedBy:     []string{"cluster", "job"},
+			expectedOk:     true,
+		},
+		{
+			name: "unsupported aggregation",
+			req:  &storepb.SeriesRequest{MinTime: 1000, MaxTime: 3000, MaxResolutionWindow: downsample.ResLevel2, Matchers: matchers, AggregationHint: &storepb.AggregationHint{Func: storepb.Aggr_COUNTER}},
+		},
+		{
+			name: "no hint",
+			req:  &storepb.SeriesRequest{MinTime: 1000, MaxTime: 3000, MaxResolutionWindow: downsample.ResLevel2, Matchers: matchers},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			window, by, ok := s.aggregationPushdown(context.Background(), tc.req)
+			testutil.Equals(t, tc.expectedOk, ok)
+			testutil.Equals(t, tc.expectedWindow, window)
+			testutil.Equals(t, tc.expectedBy, by)
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"math"
 	"os"
 	"path"
+	"regexp/syntax"
 	"sort"
 	"strings"
 	"sync"
@@ -24,7 +25,9 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/gogo/protobuf/types"
+	"github.com/golang/groupcache/singleflight"
 	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -126,6 +129,7 @@ var (
 
 type bucketStoreMetrics struct {
 	blocksLoaded          prometheus.Gauge
+	blocksSyncPending     prometheus.Gauge
 	blockLoads            prometheus.Counter
 	blockLoadFailures     prometheus.Counter
 	lastLoadedBlock       prometheus.Gauge
@@ -151,6 +155,17 @@ type bucketStoreMetrics struct {
 	lazyExpandedPostingSizeBytes                  prometheus.Counter
 	lazyExpandedPostingSeriesOverfetchedSizeBytes prometheus.Counter
 
+	postingsForMatchersCacheRequests *prometheus.CounterVec
+	postingsForMatchersCacheHits     *prometheus.CounterVec
+
+	aggregationPushdowns prometheus.Counter
+
+	verticallyMergedSeries *prometheus.CounterVec
+
+	timeFilteredSeries *prometheus.CounterVec
+
+	releasedSeriesResponses *prometheus.CounterVec
+
 	cachedPostingsCompressions           *prometheus.CounterVec
 	cachedPostingsCompressionErrors      *prometheus.CounterVec
 	cachedPostingsCompressionTimeSeconds *prometheus.CounterVec
@@ -166,6 +181,9 @@ type bucketStoreMetrics struct {
 	chunkFetchDuration *prometheus.HistogramVec
 	// Actual absolute total time for loading chunks.
 	chunkFetchDurationSum *prometheus.HistogramVec
+
+	blockReadDuration *prometheus.HistogramVec
+	blockReadErrors   *prometheus.CounterVec
 }
 
 func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
@@ -191,6 +209,10 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_blocks_loaded",
 		Help: "Number of currently loaded blocks.",
 	})
+	m.blocksSyncPending = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_bucket_store_blocks_sync_pending",
+		Help: "Number of new blocks discovered by the current blocks synchronization which are still to be loaded.",
+	})
 	m.lastLoadedBlock = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 		Name: "thanos_bucket_store_blocks_last_loaded_timestamp_seconds",
 		Help: "Timestamp when last block got loaded.",
@@ -352,9 +374,71 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Help: "Total number of series size in bytes overfetched due to posting lazy expansion.",
 	})
 
+	m.postingsForMatchersCacheRequests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_postings_for_matchers_cache_requests_total",
+		Help: "Total number of requests to the postings for matchers cache, by resolution of the blocks.",
+	}, []string{"resolution"})
+	m.postingsForMatchersCacheHits = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_postings_for_matchers_cache_hits_total",
+		Help: "Total number of requests to the postings for matchers cache that were a hit, by resolution of the blocks.",
+	}, []string{"resolution"})
+
+	m.aggregationPushdowns = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_series_aggregation_pushdowns_total",
+		Help: "Total number of Series requests whose aggregation hint was evaluated by the store.",
+	})
+
+	m.verticallyMergedSeries = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_series_vertically_merged_total",
+		Help: "Total number of series whose overlapping chunks, from vertically overlapping blocks, were merged.",
+	}, []string{tenancy.MetricLabel})
+
+	m.timeFilteredSeries = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_series_time_filtered_total",
+		Help: "Total number of series whose chunks were sliced to the time range of Series requests.",
+	}, []string{tenancy.MetricLabel})
+
+	m.releasedSeriesResponses = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_series_responses_released_total",
+		Help: "Total number of series responses whose memory was released back to the pools as soon as they were sent, if series response pooling is enabled.",
+	}, []string{tenancy.MetricLabel})
+
+	m.blockReadDuration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "thanos_bucket_store_block_read_duration_seconds",
+		Help:    "Duration of the object storage operations reading blocks for Series requests, by stage of the request and operation. get_range is the time to get a range reader, read the time to read it. Exemplars hold the trace ID of the request.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+	}, []string{"stage", "operation", tenancy.MetricLabel})
+	m.blockReadErrors = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_block_read_errors_total",
+		Help: "Total number of failed object storage operations reading blocks for Series requests, by stage of the request and operation.",
+	}, []string{"stage", "operation", tenancy.MetricLabel})
+
 	return &m
 }
 
+// Stages of Series requests reading blocks from object storage, and operations of the reads.
+const (
+	blockReadStagePostings = "postings"
+	blockReadStageSeries   = "series"
+	blockReadStageChunks   = "chunks"
+
+	blockReadOpGetRange = "get_range"
+	blockReadOpRead     = "read"
+)
+
+// observeBlockRead observes an object storage operation reading a block, with the given trace ID as exemplar.
+func (m *bucketStoreMetrics) observeBlockRead(stage, op, tenant, traceID string, d time.Duration, err error) {
+	if err != nil {
+		m.blockReadErrors.WithLabelValues(stage, op, tenant).Inc()
+	}
+	observer := m.blockReadDuration.WithLabelValues(stage, op, tenant)
+	if traceID == "" {
+		observer.Observe(d.Seconds())
+		return
+	}
+	observer.(prometheus.ExemplarObserver).ObserveWithExemplar(d.Seconds(), prometheus.Labels{"traceID": traceID})
+}
+
 // FilterConfig is a configuration, which Store uses for filtering metrics based on time.
 type FilterConfig struct {
 	MinTime, MaxTime model.TimeOrDurationValue
@@ -376,11 +460,19 @@ type BucketStore struct {
 	fetcher         block.MetadataFetcher
 	dir             string
 	indexCache      storecache.IndexCache
+	chunksCache     storecache.ChunksCache
 	indexReaderPool *indexheader.ReaderPool
 	buffers         sync.Pool
 	chunkPool       pool.Bytes
 	seriesBatchSize int
 
+	// Archive bucket blocks are also loaded from, if any. Blocks present in both buckets are loaded from bkt.
+	archiveBkt     objstore.InstrumentedBucketReader
+	archiveFetcher block.MetadataFetcher
+
+	// tenantBlockSelectors restrict the blocks the requests of every tenant can touch, if not nil.
+	tenantBlockSelectors *TenantBlockSelectors
+
 	// Sets of blocks that have the same labels. They are indexed by a hash over their label set.
 	mtx       sync.RWMutex
 	blocks    map[ulid.ULID]*bucketBlock
@@ -424,8 +516,28 @@ type BucketStore struct {
 	blockEstimatedMaxChunkFunc  BlockEstimator
 
 	indexHeaderLazyDownloadStrategy indexheader.LazyDownloadIndexHeaderFunc
+	indexHeaderEvictionPolicies     []indexheader.EvictionPolicy
 
 	requestLoggerFunc RequestLoggerFunc
+
+	blockHeatmapTopN int
+
+	// seriesMemoryQuota is the maximum number of bytes each Series request holds out of the chunk and series pools.
+	seriesMemoryQuota uint64
+
+	// postingsForMatchersCacheTTL is the TTL of the expanded postings cached by every block by set of matchers. They
+	// aren't cached if it's 0.
+	postingsForMatchersCacheTTL        time.Duration
+	postingsForMatchersCacheMaxEntries int
+
+	enableAggregationPushdown bool
+
+	enableSeriesResponsePooling bool
+
+	// verticalMergeFunc merges the overlapping chunks of series, if not nil.
+	verticalMergeFunc storage.VerticalChunkSeriesMergeFunc
+
+	enableTimeFiltering bool
 }
 
 func (s *BucketStore) validate() error {
@@ -490,6 +602,13 @@ func WithIndexCache(cache storecache.IndexCache) BucketStoreOption {
 	}
 }
 
+// WithChunksCache sets a chunksCache to cache the chunks fetched from the bucket. Without it, chunks aren't cached.
+func WithChunksCache(cache storecache.ChunksCache) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.chunksCache = cache
+	}
+}
+
 // WithQueryGate sets a queryGate to use instead of a noopGate.
 func WithQueryGate(queryGate gate.Gate) BucketStoreOption {
 	return func(s *BucketStore) {
@@ -504,6 +623,22 @@ func WithChunkPool(chunkPool pool.Bytes) BucketStoreOption {
 	}
 }
 
+// WithArchiveBucket sets an archive bucket, discovered with the given fetcher, to also load blocks from.
+func WithArchiveBucket(bkt objstore.InstrumentedBucketReader, fetcher block.MetadataFetcher) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.archiveBkt = bkt
+		s.archiveFetcher = fetcher
+	}
+}
+
+// WithTenantBlockSelectors restricts the blocks the Series, LabelNames and LabelValues requests of every tenant can
+// touch with the given selectors.
+func WithTenantBlockSelectors(selectors *TenantBlockSelectors) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.tenantBlockSelectors = selectors
+	}
+}
+
 // WithFilterConfig sets a filter which Store uses for filtering metrics based on time.
 func WithFilterConfig(filter *FilterConfig) BucketStoreOption {
 	return func(s *BucketStore) {
@@ -558,6 +693,63 @@ func WithDontResort(true bool) BucketStoreOption {
 	}
 }
 
+// WithBlockHeatmapMetrics exports the query heat of the topN most queried blocks as metrics.
+func WithBlockHeatmapMetrics(topN int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.blockHeatmapTopN = topN
+	}
+}
+
+// WithSeriesMemoryQuota fails the Series requests holding more than the given number of bytes at once out of the
+// chunk and series pools with a resource exhausted error. 0 disables the quota.
+func WithSeriesMemoryQuota(bytes uint64) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.seriesMemoryQuota = bytes
+	}
+}
+
+// WithPostingsForMatchersCache caches the expanded postings of every block by set of matchers for the given TTL, up to
+// maxEntries sets of matchers per block, or without limit if it's 0.
+func WithPostingsForMatchersCache(ttl time.Duration, maxEntries int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.postingsForMatchersCacheTTL = ttl
+		s.postingsForMatchersCacheMaxEntries = maxEntries
+	}
+}
+
+// WithAggregationPushdown enables the evaluation of the aggregation hints of Series requests selecting only
+// downsampled blocks.
+func WithAggregationPushdown(enabled bool) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.enableAggregationPushdown = enabled
+	}
+}
+
+// WithSeriesResponsePooling allocates the labels and chunks of series responses out of pools, which they are
+// released to as soon as they are sent. It is only safe if the server the responses are sent to does not retain them
+// after Send returns, like gRPC streams marshaling them.
+func WithSeriesResponsePooling(enabled bool) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.enableSeriesResponsePooling = enabled
+	}
+}
+
+// WithVerticalMerge merges the overlapping raw chunks of series from vertically overlapping blocks with the given
+// function, instead of returning them as is, e.g. for buckets that are not vertically compacted.
+func WithVerticalMerge(mergeFunc storage.VerticalChunkSeriesMergeFunc) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.verticalMergeFunc = mergeFunc
+	}
+}
+
+// WithTimeFiltering slices the chunks of series overlapping the start or the end of the time range of Series
+// requests, so that only samples within the range are returned.
+func WithTimeFiltering(enabled bool) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.enableTimeFiltering = enabled
+	}
+}
+
 // WithIndexHeaderLazyDownloadStrategy specifies what block to lazy download its index header.
 // Only used when lazy mmap is enabled at the same time.
 func WithIndexHeaderLazyDownloadStrategy(strategy indexheader.LazyDownloadIndexHeaderFunc) BucketStoreOption {
@@ -566,6 +758,14 @@ func WithIndexHeaderLazyDownloadStrategy(strategy indexheader.LazyDownloadIndexH
 	}
 }
 
+// WithIndexHeaderEvictionPolicies adds policies unloading lazy loaded index headers, on top of the idle timeout.
+// Only used when lazy mmap is enabled at the same time.
+func WithIndexHeaderEvictionPolicies(policies ...indexheader.EvictionPolicy) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.indexHeaderEvictionPolicies = append(s.indexHeaderEvictionPolicies, policies...)
+	}
+}
+
 // NewBucketStore creates a new bucket backed store that implements the store API against
 // an object store bucket. It is optimized to work against high latency backends.
 func NewBucketStore(
@@ -619,8 +819,11 @@ func NewBucketStore(
 
 	// Depend on the options
 	indexReaderPoolMetrics := indexheader.NewReaderPoolMetrics(extprom.WrapRegistererWithPrefix("thanos_bucket_store_", s.reg))
-	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, indexReaderPoolMetrics, s.indexHeaderLazyDownloadStrategy)
+	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, indexReaderPoolMetrics, s.indexHeaderLazyDownloadStrategy, indexheader.WithEvictionPolicies(s.indexHeaderEvictionPolicies...))
 	s.metrics = newBucketStoreMetrics(s.reg) // TODO(metalmatze): Might be possible via Option too
+	if s.blockHeatmapTopN > 0 && s.reg != nil {
+		s.reg.MustRegister(newBlockHeatmapCollector(s, s.blockHeatmapTopN))
+	}
 
 	if err := s.validate(); err != nil {
 		return nil, errors.Wrap(err, "validate config")
@@ -659,6 +862,24 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		return metaFetchErr
 	}
 
+	archived := map[ulid.ULID]struct{}{}
+	if s.archiveFetcher != nil {
+		archiveMetas, _, err := s.archiveFetcher.Fetch(ctx)
+		if err != nil && archiveMetas == nil {
+			return errors.Wrap(err, "fetch metas of archive bucket")
+		}
+		if err != nil && metaFetchErr == nil {
+			metaFetchErr = errors.Wrap(err, "fetch metas of archive bucket")
+		}
+		for id, meta := range archiveMetas {
+			if _, ok := metas[id]; ok {
+				continue
+			}
+			metas[id] = meta
+			archived[id] = struct{}{}
+		}
+	}
+
 	var wg sync.WaitGroup
 	blockc := make(chan *metadata.Meta)
 
@@ -666,18 +887,28 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		wg.Add(1)
 		go func() {
 			for meta := range blockc {
-				if err := s.addBlock(ctx, meta); err != nil {
-					continue
+				bkt := s.bkt
+				if _, ok := archived[meta.ULID]; ok {
+					bkt = s.archiveBkt
 				}
+				// Failures are logged and counted by addBlock.
+				_ = s.addBlock(ctx, bkt, meta)
+				s.metrics.blocksSyncPending.Dec()
 			}
 			wg.Done()
 		}()
 	}
 
+	newMetas := make([]*metadata.Meta, 0, len(metas))
 	for id, meta := range metas {
 		if b := s.getBlock(id); b != nil {
 			continue
 		}
+		newMetas = append(newMetas, meta)
+	}
+	s.metrics.blocksSyncPending.Set(float64(len(newMetas)))
+
+	for _, meta := range newMetas {
 		select {
 		case <-ctx.Done():
 		case blockc <- meta:
@@ -686,6 +917,7 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 
 	close(blockc)
 	wg.Wait()
+	s.metrics.blocksSyncPending.Set(0)
 
 	if metaFetchErr != nil {
 		return metaFetchErr
@@ -760,7 +992,7 @@ func (s *BucketStore) getBlock(id ulid.ULID) *bucketBlock {
 	return s.blocks[id]
 }
 
-func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err error) {
+func (s *BucketStore) addBlock(ctx context.Context, bkt objstore.InstrumentedBucketReader, meta *metadata.Meta) (err error) {
 	var dir string
 	if s.dir != "" {
 		dir = path.Join(s.dir, meta.ULID.String())
@@ -790,7 +1022,7 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 	indexHeaderReader, err := s.indexReaderPool.NewBinaryReader(
 		ctx,
 		s.logger,
-		s.bkt,
+		bkt,
 		s.dir,
 		meta.ULID,
 		s.postingOffsetsInMemSampling,
@@ -809,7 +1041,7 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		ctx,
 		s.metrics,
 		meta,
-		s.bkt,
+		bkt,
 		dir,
 		s.indexCache,
 		s.chunkPool,
@@ -821,6 +1053,16 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 	if err != nil {
 		return errors.Wrap(err, "new bucket block")
 	}
+	b.chunksCache = s.chunksCache
+	if s.postingsForMatchersCacheTTL > 0 {
+		res := time.Duration(meta.Thanos.Downsample.Resolution * int64(time.Millisecond)).String()
+		b.postingsForMatchersCache = newPostingsForMatchersCache(
+			s.postingsForMatchersCacheTTL,
+			s.postingsForMatchersCacheMaxEntries,
+			s.metrics.postingsForMatchersCacheRequests.WithLabelValues(res),
+			s.metrics.postingsForMatchersCacheHits.WithLabelValues(res),
+		)
+	}
 	defer func() {
 		if err != nil {
 			runutil.CloseWithErrCapture(&err, b, "index-header")
@@ -895,6 +1137,11 @@ func (s *BucketStore) TimeRange() (mint, maxt int64) {
 	return mint, maxt
 }
 
+// SupportsTimeFiltering returns true if the store only returns samples within the time range of Series requests.
+func (s *BucketStore) SupportsTimeFiltering() bool {
+	return s.enableTimeFiltering
+}
+
 // TSDBInfos returns a list of infopb.TSDBInfos for blocks in the bucket store.
 func (s *BucketStore) TSDBInfos() []infopb.TSDBInfo {
 	s.mtx.RLock()
@@ -1026,6 +1273,9 @@ type blockSeriesClient struct {
 	chunkFetchDuration     *prometheus.HistogramVec
 	chunkFetchDurationSum  *prometheus.HistogramVec
 	tenant                 string
+	chunkPool              pool.Bytes
+	responseArenas         *seriesResponseArenas
+	memoryQuota            *seriesMemoryQuota
 
 	// Internal state.
 	i                uint64
@@ -1038,6 +1288,8 @@ type blockSeriesClient struct {
 	entries          []seriesEntry
 	hasMorePostings  bool
 	batchSize        int
+	arena            *seriesArena
+	arenas           []*seriesArena
 }
 
 func newBlockSeriesClient(
@@ -1061,10 +1313,13 @@ func newBlockSeriesClient(
 	lazyExpandedPostingSizeBytes prometheus.Counter,
 	lazyExpandedPostingSeriesOverfetchedSizeBytes prometheus.Counter,
 	tenant string,
+	responseArenas *seriesResponseArenas,
+	memoryQuota *seriesMemoryQuota,
 ) *blockSeriesClient {
 	var chunkr *bucketChunkReader
 	if !req.SkipChunks {
 		chunkr = b.chunkReader(logger)
+		chunkr.quota = memoryQuota
 	}
 
 	extLset := b.extLset
@@ -1102,6 +1357,9 @@ func newBlockSeriesClient(
 		hasMorePostings:    true,
 		batchSize:          batchSize,
 		tenant:             tenant,
+		chunkPool:          b.chunkPool,
+		responseArenas:     responseArenas,
+		memoryQuota:        memoryQuota,
 
 		b: labels.NewBuilder(labels.EmptyLabels()),
 	}
@@ -1113,6 +1371,10 @@ func (b *blockSeriesClient) Close() {
 	}
 
 	runutil.CloseWithLogOnErr(b.logger, b.indexr, "series block")
+
+	for _, a := range b.arenas {
+		a.free()
+	}
 }
 
 func (b *blockSeriesClient) MergeStats(stats *queryStats) *queryStats {
@@ -1192,10 +1454,12 @@ func (b *blockSeriesClient) Recv() (*storepb.SeriesResponse, error) {
 	next := b.entries[0]
 	b.entries = b.entries[1:]
 
-	return storepb.NewSeriesResponse(&storepb.Series{
+	resp := storepb.NewSeriesResponse(&storepb.Series{
 		Labels: labelpb.ZLabelsFromPromLabels(next.lset),
 		Chunks: next.chks,
-	}), nil
+	})
+	b.responseArenas.track(resp, b.arena)
+	return resp, nil
 }
 
 func (b *blockSeriesClient) nextBatch(tenant string) error {
@@ -1206,6 +1470,12 @@ func (b *blockSeriesClient) nextBatch(tenant string) error {
 	}
 	b.i = end
 
+	if b.arena != nil && b.responseArenas != nil {
+		// All the series of the previous batch were handed out, each of their responses retaining the arena.
+		b.arena.release()
+	}
+	b.arena = nil
+
 	lazyExpandedPosting := b.lazyPostings.lazyExpanded()
 	postingsBatch := b.lazyPostings.postings[start:end]
 	if len(postingsBatch) == 0 {
@@ -1228,9 +1498,12 @@ func (b *blockSeriesClient) nextBatch(tenant string) error {
 		return nil
 	}
 
+	b.arena = newSeriesArena(b.chunkPool, b.responseArenas != nil, b.memoryQuota)
+	b.arenas = append(b.arenas, b.arena)
+
 	b.indexr.reset(len(postingsBatch))
 	if !b.skipChunks {
-		b.chunkr.reset()
+		b.chunkr.reset(b.arena)
 	}
 
 	if err := b.indexr.PreloadSeries(b.ctx, postingsBatch, b.bytesLimiter, b.tenant); err != nil {
@@ -1278,7 +1551,10 @@ OUTER:
 			continue
 		}
 
-		completeLabelset := labelpb.ExtendSortedLabels(b.lset, b.extLset)
+		completeLabelset, err := b.arena.extendSortedLabels(b.lset, b.extLset)
+		if err != nil {
+			return err
+		}
 		if b.extLsetToRemove != nil {
 			completeLabelset = rmLabels(completeLabelset, b.extLsetToRemove)
 		}
@@ -1295,8 +1571,10 @@ OUTER:
 		}
 
 		// Schedule loading chunks.
-		s.refs = make([]chunks.ChunkRef, 0, len(b.chkMetas))
-		s.chks = make([]storepb.AggrChunk, 0, len(b.chkMetas))
+		s.refs, s.chks, err = b.arena.chunkSlices(len(b.chkMetas))
+		if err != nil {
+			return err
+		}
 
 		for j, meta := range b.chkMetas {
 			if err := b.chunkr.addLoad(meta.Ref, len(b.entries), j); err != nil {
@@ -1333,21 +1611,21 @@ OUTER:
 	return nil
 }
 
-func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr, save func([]byte) ([]byte, error), calculateChecksum bool) error {
+func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr, a *seriesArena, calculateChecksum bool) error {
 	hasher := hashPool.Get().(hash.Hash64)
 	defer hashPool.Put(hasher)
 
 	if in.Encoding() == chunkenc.EncXOR || in.Encoding() == chunkenc.EncHistogram || in.Encoding() == chunkenc.EncFloatHistogram {
-		b, err := save(in.Bytes())
+		b, err := a.save(in.Bytes())
 		if err != nil {
 			return err
 		}
-		out.Raw = &storepb.Chunk{
+		out.Raw, err = a.chunk(storepb.Chunk{
 			Data: b,
 			Type: storepb.Chunk_Encoding(in.Encoding() - 1),
 			Hash: hashChunk(hasher, b, calculateChecksum),
-		}
-		return nil
+		})
+		return err
 	}
 
 	if in.Encoding() != downsample.ChunkEncAggr {
@@ -1363,51 +1641,61 @@ func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Ag
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrCount)
 			}
-			b, err := save(x.Bytes())
+			b, err := a.save(x.Bytes())
 			if err != nil {
 				return err
 			}
-			out.Count = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			if out.Count, err = a.chunk(storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}); err != nil {
+				return err
+			}
 		case storepb.Aggr_SUM:
 			x, err := ac.Get(downsample.AggrSum)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrSum)
 			}
-			b, err := save(x.Bytes())
+			b, err := a.save(x.Bytes())
 			if err != nil {
 				return err
 			}
-			out.Sum = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			if out.Sum, err = a.chunk(storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}); err != nil {
+				return err
+			}
 		case storepb.Aggr_MIN:
 			x, err := ac.Get(downsample.AggrMin)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrMin)
 			}
-			b, err := save(x.Bytes())
+			b, err := a.save(x.Bytes())
 			if err != nil {
 				return err
 			}
-			out.Min = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			if out.Min, err = a.chunk(storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}); err != nil {
+				return err
+			}
 		case storepb.Aggr_MAX:
 			x, err := ac.Get(downsample.AggrMax)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrMax)
 			}
-			b, err := save(x.Bytes())
+			b, err := a.save(x.Bytes())
 			if err != nil {
 				return err
 			}
-			out.Max = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			if out.Max, err = a.chunk(storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}); err != nil {
+				return err
+			}
 		case storepb.Aggr_COUNTER:
 			x, err := ac.Get(downsample.AggrCounter)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrCounter)
 			}
-			b, err := save(x.Bytes())
+			b, err := a.save(x.Bytes())
 			if err != nil {
 				return err
 			}
-			out.Counter = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			if out.Counter, err = a.chunk(storepb.Chunk{Type: storepb.Chunk_XOR, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -1459,7 +1747,77 @@ func debugFoundBlockSetOverview(logger log.Logger, mint, maxt, maxResolutionMill
 }
 
 // Series implements the storepb.StoreServer interface.
+// aggregationPushdown returns the window to aggregate the series of the given request over and the names of the labels
+// to group them by, if its aggregation hint can be evaluated by the store, i.e. if all the blocks it selects are
+// downsampled. The window is the largest resolution of the blocks. Series are grouped by the labels of the hint and
+// the external labels of the blocks, so that the aggregated series of different sources stay apart as they would be
+// without aggregation, except for the replica labels to remove.
+func (s *BucketStore) aggregationPushdown(ctx context.Context, req *storepb.SeriesRequest) (int64, []string, bool) {
+	if !s.enableAggregationPushdown || req.SkipChunks || !aggregationHintSupported(req.AggregationHint) {
+		return 0, nil, false
+	}
+	matchers, err := storepb.MatchersToPromMatchers(req.Matchers...)
+	if err != nil {
+		// Let Series return the error.
+		return 0, nil, false
+	}
+	tenant, _ := tenancy.GetTenantFromGRPCMetadata(ctx)
+
+	var (
+		window int64
+		names  = map[string]struct{}{}
+	)
+	for _, n := range req.AggregationHint.By {
+		names[n] = struct{}{}
+	}
+
+	s.mtx.RLock()
+	for _, bs := range s.blockSets {
+		if _, ok := bs.labelMatchers(matchers...); !ok {
+			continue
+		}
+		selected := false
+		for _, b := range bs.getFor(s.limitMinTime(req.MinTime), s.limitMaxTime(req.MaxTime), req.MaxResolutionWindow, nil) {
+			if !s.tenantBlockSelectors.selects(tenant, b.relabelLabels) {
+				continue
+			}
+			if b.meta.Thanos.Downsample.Resolution == 0 {
+				s.mtx.RUnlock()
+				return 0, nil, false
+			}
+			window = max(window, b.meta.Thanos.Downsample.Resolution)
+			selected = true
+		}
+		if selected {
+			bs.labels.Range(func(l labels.Label) {
+				names[l.Name] = struct{}{}
+			})
+		}
+	}
+	s.mtx.RUnlock()
+
+	if window == 0 {
+		return 0, nil, false
+	}
+	for _, n := range req.WithoutReplicaLabels {
+		delete(names, n)
+	}
+	by := make([]string, 0, len(names))
+	for n := range names {
+		by = append(by, n)
+	}
+	sort.Strings(by)
+	return window, by, true
+}
+
 func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store_SeriesServer) (err error) {
+	if req.SeriesStatsOnly {
+		return serveSeriesStats(req, seriesSrv, s.Series)
+	}
+	if window, by, ok := s.aggregationPushdown(seriesSrv.Context(), req); ok {
+		s.metrics.aggregationPushdowns.Inc()
+		return serveAggregation(req, seriesSrv, window, by, s.Series)
+	}
 	srv := newFlushableServer(seriesSrv, sortingStrategyNone)
 
 	if s.queryGate != nil {
@@ -1498,7 +1856,14 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 		queryStatsEnabled = false
 
 		logger = s.requestLoggerFunc(ctx, s.logger)
+
+		// responseArenas is nil if pooling is disabled, the memory of the responses being released once the call is done.
+		responseArenas *seriesResponseArenas
+		memoryQuota    = newSeriesMemoryQuota(s.seriesMemoryQuota, req, s.metrics.queriesDropped.WithLabelValues("memory", tenant))
 	)
+	if s.enableSeriesResponsePooling {
+		responseArenas = newSeriesResponseArenas(s.metrics.releasedSeriesResponses.WithLabelValues(tenant))
+	}
 
 	if req.Hints != nil {
 		reqHints := &hintspb.SeriesRequestHints{}
@@ -1541,6 +1906,9 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 			blk := b
 			gctx := gctx
 
+			if !s.tenantBlockSelectors.selects(tenant, blk.relabelLabels) {
+				continue
+			}
 			if s.enableSeriesResponseHints {
 				// Keep track of queried blocks.
 				resHints.AddQueriedBlock(blk.meta.ULID)
@@ -1569,6 +1937,8 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 				s.metrics.lazyExpandedPostingSizeBytes,
 				s.metrics.lazyExpandedPostingSeriesOverfetchedSizeBytes,
 				tenant,
+				responseArenas,
+				memoryQuota,
 			)
 
 			defer blockClient.Close()
@@ -1583,8 +1953,10 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 				})
 
 				onClose := func() {
+					blockStats := blockClient.MergeStats(&queryStats{})
+					blk.heat.observe(blockStats, time.Now())
 					mtx.Lock()
-					stats = blockClient.MergeStats(stats)
+					stats.merge(blockStats)
 					mtx.Unlock()
 				}
 
@@ -1701,6 +2073,35 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 			}
 
 			series := at.GetSeries()
+			if series != nil && s.verticalMergeFunc != nil && !req.SkipChunks {
+				merged, ok, mergeErr := mergeOverlappingChunks(series, s.verticalMergeFunc, s.enableChunkHashCalculation)
+				if mergeErr != nil {
+					err = status.Error(codes.Internal, errors.Wrapf(mergeErr, "merge series %s", labelpb.ZLabelsToPromLabels(series.Labels)).Error())
+					return
+				}
+				if ok {
+					s.metrics.verticallyMergedSeries.WithLabelValues(tenant).Inc()
+					series = merged
+					at = storepb.NewSeriesResponse(series)
+				}
+			}
+			if series != nil && s.enableTimeFiltering && !req.SkipChunks {
+				filtered, ok, filterErr := filterChunksByTime(series, req.MinTime, req.MaxTime, s.enableChunkHashCalculation)
+				if filterErr != nil {
+					err = status.Error(codes.Internal, errors.Wrapf(filterErr, "filter series %s", labelpb.ZLabelsToPromLabels(series.Labels)).Error())
+					return
+				}
+				if ok {
+					s.metrics.timeFilteredSeries.WithLabelValues(tenant).Inc()
+					if len(filtered.Chunks) == 0 {
+						// None of the samples of the series are within the requested time range.
+						responseArenas.release(set.Sources()...)
+						continue
+					}
+					series = filtered
+					at = storepb.NewSeriesResponse(series)
+				}
+			}
 			if series != nil {
 				stats.mergedSeriesCount++
 				if !req.SkipChunks {
@@ -1712,6 +2113,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, seriesSrv storepb.Store
 				err = status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
 				return
 			}
+			responseArenas.release(set.Sources()...)
 		}
 		stats.MergeDuration = time.Since(begin)
 		s.metrics.seriesMergeDuration.WithLabelValues(tenant).Observe(stats.MergeDuration.Seconds())
@@ -1758,6 +2160,12 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request labels matchers").Error())
 	}
+	req.Start = s.limitMinTime(req.Start)
+	req.End = s.limitMaxTime(req.End)
+	if req.Start > req.End {
+		// The requested time range is outside of the time range served by the store.
+		return &storepb.LabelNamesResponse{}, nil
+	}
 
 	tenant, _ := tenancy.GetTenantFromGRPCMetadata(ctx)
 
@@ -1803,6 +2211,9 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 		if len(reqBlockMatchers) > 0 && !b.matchRelabelLabels(reqBlockMatchers) {
 			continue
 		}
+		if !s.tenantBlockSelectors.selects(tenant, b.relabelLabels) {
+			continue
+		}
 		// Filter external labels from matchers.
 		reqSeriesMatchersNoExtLabels, ok := b.FilterExtLabelsMatchers(reqSeriesMatchers)
 		if !ok {
@@ -1874,6 +2285,8 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 					s.metrics.lazyExpandedPostingSizeBytes,
 					s.metrics.lazyExpandedPostingSeriesOverfetchedSizeBytes,
 					tenant,
+					nil,
+					nil,
 				)
 				defer blockClient.Close()
 
@@ -1975,6 +2388,11 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 			return &storepb.LabelValuesResponse{}, nil
 		}
 	}
+	req.Start = s.limitMinTime(req.Start)
+	req.End = s.limitMaxTime(req.End)
+	if req.Start > req.End {
+		return &storepb.LabelValuesResponse{}, nil
+	}
 
 	tenant, _ := tenancy.GetTenantFromGRPCMetadata(ctx)
 
@@ -2013,6 +2431,9 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 		if len(reqBlockMatchers) > 0 && !b.matchRelabelLabels(reqBlockMatchers) {
 			continue
 		}
+		if !s.tenantBlockSelectors.selects(tenant, b.relabelLabels) {
+			continue
+		}
 		// Filter external labels from matchers.
 		reqSeriesMatchersNoExtLabels, ok := b.FilterExtLabelsMatchers(reqSeriesMatchers)
 		if !ok {
@@ -2088,6 +2509,8 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 					s.metrics.lazyExpandedPostingSizeBytes,
 					s.metrics.lazyExpandedPostingSeriesOverfetchedSizeBytes,
 					tenant,
+					nil,
+					nil,
 				)
 				defer blockClient.Close()
 
@@ -2311,6 +2734,14 @@ type bucketBlock struct {
 
 	chunkObjs []string
 
+	// chunksCache caches the chunks of the block, if not nil. Concurrent fetches of the same chunk ranges are then
+	// deduplicated with chunkRangesFlight.
+	chunksCache       storecache.ChunksCache
+	chunkRangesFlight singleflight.Group
+
+	// postingsForMatchersCache caches the expanded postings of the block by set of matchers, if not nil.
+	postingsForMatchersCache *postingsForMatchersCache
+
 	pendingReaders sync.WaitGroup
 
 	partitioner Partitioner
@@ -2321,6 +2752,8 @@ type bucketBlock struct {
 
 	estimatedMaxChunkSize  int
 	estimatedMaxSeriesSize int
+
+	heat blockHeat
 }
 
 func newBucketBlock(
@@ -2387,8 +2820,62 @@ func (b *bucketBlock) indexFilename() string {
 	return path.Join(b.meta.ULID.String(), block.IndexFilename)
 }
 
-func (b *bucketBlock) readIndexRange(ctx context.Context, off, length int64, logger log.Logger) ([]byte, error) {
-	r, err := b.bkt.GetRange(ctx, b.indexFilename(), off, length)
+// getRange returns a reader of the given range of the given object of the block, read by the given stage of a Series
+// request. Getting the reader and reading it until it is closed are observed separately, and traced in a span
+// tagged with the block.
+func (b *bucketBlock) getRange(ctx context.Context, stage, tenant, name string, off, length int64) (io.ReadCloser, error) {
+	span, ctx := tracing.StartSpan(ctx, "bucket_store_block_get_range", tracing.Tags{
+		"block.id": b.meta.ULID,
+		"stage":    stage,
+		"object":   name,
+		"offset":   off,
+		"length":   length,
+	})
+	traceID, _ := tracing.TraceIDFromContext(ctx)
+
+	begin := time.Now()
+	r, err := b.bkt.GetRange(ctx, name, off, length)
+	b.metrics.observeBlockRead(stage, blockReadOpGetRange, tenant, traceID, time.Since(begin), err)
+	if err != nil {
+		ext.LogError(span, err)
+		span.Finish()
+		return nil, err
+	}
+	return &blockRangeReader{ReadCloser: r, block: b, span: span, stage: stage, tenant: tenant, traceID: traceID, begin: time.Now()}, nil
+}
+
+// blockRangeReader observes the read of a range reader of a block once closed.
+type blockRangeReader struct {
+	io.ReadCloser
+
+	block         *bucketBlock
+	span          tracing.Span
+	stage, tenant string
+	traceID       string
+	begin         time.Time
+	err           error
+}
+
+func (r *blockRangeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *blockRangeReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.block.metrics.observeBlockRead(r.stage, blockReadOpRead, r.tenant, r.traceID, time.Since(r.begin), r.err)
+	if r.err != nil {
+		ext.LogError(r.span, r.err)
+	}
+	r.span.Finish()
+	return err
+}
+
+func (b *bucketBlock) readIndexRange(ctx context.Context, tenant string, off, length int64, logger log.Logger) ([]byte, error) {
+	r, err := b.getRange(ctx, blockReadStageSeries, tenant, b.indexFilename(), off, length)
 	if err != nil {
 		return nil, errors.Wrap(err, "get range reader")
 	}
@@ -2405,13 +2892,13 @@ func (b *bucketBlock) readIndexRange(ctx context.Context, off, length int64, log
 	return buf.Bytes(), nil
 }
 
-func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length int64, chunkRanges byteRanges, logger log.Logger) (*[]byte, error) {
+func (b *bucketBlock) readChunkRange(ctx context.Context, tenant string, seq int, off, length int64, chunkRanges byteRanges, logger log.Logger) (*[]byte, error) {
 	if seq < 0 || seq >= len(b.chunkObjs) {
 		return nil, errors.Errorf("unknown segment file for index %d", seq)
 	}
 
 	// Get a reader for the required range.
-	reader, err := b.bkt.GetRange(ctx, b.chunkObjs[seq], off, length)
+	reader, err := b.getRange(ctx, blockReadStageChunks, tenant, b.chunkObjs[seq], off, length)
 	if err != nil {
 		return nil, errors.Wrap(err, "get range reader")
 	}
@@ -2431,12 +2918,34 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 	return chunkBuffer, nil
 }
 
-func (b *bucketBlock) chunkRangeReader(ctx context.Context, seq int, off, length int64) (io.ReadCloser, error) {
+func (b *bucketBlock) chunkRangeReader(ctx context.Context, tenant string, seq int, off, length int64) (io.ReadCloser, error) {
 	if seq < 0 || seq >= len(b.chunkObjs) {
 		return nil, errors.Errorf("unknown segment file for index %d", seq)
 	}
 
-	return b.bkt.GetRange(ctx, b.chunkObjs[seq], off, length)
+	return b.getRange(ctx, blockReadStageChunks, tenant, b.chunkObjs[seq], off, length)
+}
+
+// sharedChunkRangeReader returns a reader of the given range of the segment file with sequence number seq. The range
+// is read once for all the concurrent calls for the same range, e.g. by queries of dashboards refreshed together.
+func (b *bucketBlock) sharedChunkRangeReader(ctx context.Context, tenant string, seq int, off, length int64, logger log.Logger) (io.ReadCloser, error) {
+	v, err := b.chunkRangesFlight.Do(fmt.Sprintf("%d:%d:%d", seq, off, length), func() (interface{}, error) {
+		r, err := b.chunkRangeReader(ctx, tenant, seq, off, length)
+		if err != nil {
+			return nil, err
+		}
+		defer runutil.CloseWithLogOnErr(logger, r, "sharedChunkRangeReader close range reader")
+
+		buf := bytes.NewBuffer(make([]byte, 0, length+bytes.MinRead))
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, errors.Wrap(err, "read range")
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(v.([]byte))), nil
 }
 
 func (b *bucketBlock) indexReader(logger log.Logger) *bucketIndexReader {
@@ -2532,11 +3041,16 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms sortedMatch
 		return nil, nil
 	}
 
+	if postings, ok := r.block.postingsForMatchersCache.fetch(ms); ok {
+		return newLazyExpandedPostings(postings), nil
+	}
+
 	hit, postings, err := r.fetchExpandedPostingsFromCache(ctx, ms, bytesLimiter, tenant)
 	if err != nil {
 		return nil, err
 	}
 	if hit {
+		r.block.postingsForMatchersCache.store(ms, postings)
 		return newLazyExpandedPostings(postings), nil
 	}
 	var (
@@ -2550,6 +3064,7 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms sortedMatch
 	}
 	if postingGroups == nil {
 		r.storeExpandedPostingsToCache(ms, index.EmptyPostings(), 0, tenant)
+		r.block.postingsForMatchersCache.store(ms, nil)
 		return nil, nil
 	}
 	i := 0
@@ -2599,6 +3114,9 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms sortedMatch
 			}
 		}
 	}
+	if !ps.lazyExpanded() {
+		r.block.postingsForMatchersCache.store(ms, ps.postings)
+	}
 	return ps, nil
 }
 
@@ -2812,8 +3330,7 @@ func toPostingGroup(ctx context.Context, lvalsFn func(name string) ([]string, er
 		// Inverse of a MatchNotRegexp is MatchRegexp (double negation).
 		// Fast-path for set matching.
 		if m.Type == labels.MatchNotRegexp {
-			if vals := m.SetMatches(); len(vals) > 0 {
-				sort.Strings(vals)
+			if vals := regexSetMatches(m); len(vals) > 0 {
 				return newPostingGroup(true, m.Name, nil, vals), nil, nil
 			}
 		}
@@ -2841,8 +3358,7 @@ func toPostingGroup(ctx context.Context, lvalsFn func(name string) ([]string, er
 		return newPostingGroup(true, m.Name, nil, toRemove), vals, nil
 	}
 	if m.Type == labels.MatchRegexp {
-		if vals := m.SetMatches(); len(vals) > 0 {
-			sort.Strings(vals)
+		if vals := regexSetMatches(m); len(vals) > 0 {
 			return newPostingGroup(false, m.Name, vals, nil), nil, nil
 		}
 	}
@@ -2870,6 +3386,115 @@ func toPostingGroup(ctx context.Context, lvalsFn func(name string) ([]string, er
 	return newPostingGroup(false, m.Name, toAdd, nil), vals, nil
 }
 
+// maxRegexSetMatches is the maximum number of values of a regex matcher the postings of which are looked up by value,
+// instead of matching the regex against all the values of the label. It is higher than the limit of
+// labels.Matcher.SetMatches, as looking up thousands of values in the index header is still much cheaper than scanning
+// the values of high cardinality labels, e.g. for the alternations of the values of dashboard variables.
+const maxRegexSetMatches = 10000
+
+// regexSetMatches returns the sorted values matched by the given regex matcher, if it only matches a set of literal
+// values, e.g. a|b|c, nil otherwise.
+func regexSetMatches(m *labels.Matcher) []string {
+	if vals := m.SetMatches(); len(vals) > 0 {
+		sort.Strings(vals)
+		return slices.Compact(vals)
+	}
+	if !isLiteralAlternation(m.Value) {
+		return nil
+	}
+	re, err := syntax.Parse(m.Value, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	vals, ok := expandLiteralRegex(re.Simplify(), []string{""})
+	if !ok || len(vals) == 0 {
+		return nil
+	}
+	sort.Strings(vals)
+	return slices.Compact(vals)
+}
+
+// isLiteralAlternation returns true if the given regex is an alternation without metacharacters other than groups
+// and escapes, a cheap check before parsing it.
+func isLiteralAlternation(re string) bool {
+	if !strings.Contains(re, "|") {
+		return false
+	}
+	for i := 0; i < len(re); i++ {
+		switch re[i] {
+		case '\\':
+			i++
+		case '(':
+			if strings.HasPrefix(re[i+1:], "?:") {
+				i += 2
+			}
+		case '.', '+', '*', '?', '[', ']', '{', '}', '^', '$':
+			return false
+		}
+	}
+	return true
+}
+
+// expandLiteralRegex returns the given prefixes concatenated with every value matched by the given regex, if it
+// matches a set of at most maxRegexSetMatches values. The given prefixes are not modified.
+func expandLiteralRegex(re *syntax.Regexp, prefixes []string) ([]string, bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return prefixes, true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, false
+		}
+		res := make([]string, 0, len(prefixes))
+		for _, p := range prefixes {
+			res = append(res, p+string(re.Rune))
+		}
+		return res, true
+	case syntax.OpCharClass:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, false
+		}
+		n := 0
+		for i := 0; i < len(re.Rune); i += 2 {
+			n += int(re.Rune[i+1]-re.Rune[i]) + 1
+		}
+		if n*len(prefixes) > maxRegexSetMatches {
+			return nil, false
+		}
+		res := make([]string, 0, n*len(prefixes))
+		for _, p := range prefixes {
+			for i := 0; i < len(re.Rune); i += 2 {
+				for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+					res = append(res, p+string(r))
+				}
+			}
+		}
+		return res, true
+	case syntax.OpCapture:
+		return expandLiteralRegex(re.Sub[0], prefixes)
+	case syntax.OpConcat:
+		res := prefixes
+		for _, sub := range re.Sub {
+			var ok bool
+			if res, ok = expandLiteralRegex(sub, res); !ok {
+				return nil, false
+			}
+		}
+		return res, true
+	case syntax.OpAlternate:
+		var res []string
+		for _, sub := range re.Sub {
+			vals, ok := expandLiteralRegex(sub, prefixes)
+			if !ok || len(res)+len(vals) > maxRegexSetMatches {
+				return nil, false
+			}
+			res = append(res, vals...)
+		}
+		return res, true
+	}
+	return nil, false
+}
+
 type postingPtr struct {
 	keyID int
 	ptr   index.Range
@@ -3032,7 +3657,7 @@ func (r *bucketIndexReader) fetchPostings(ctx context.Context, keys []labels.Lab
 			brdr := bufioReaderPool.Get().(*bufio.Reader)
 			defer bufioReaderPool.Put(brdr)
 
-			partReader, err := r.block.bkt.GetRange(ctx, r.block.indexFilename(), start, length)
+			partReader, err := r.block.getRange(ctx, blockReadStagePostings, tenant, r.block.indexFilename(), start, length)
 			if err != nil {
 				return errors.Wrap(err, "read postings range")
 			}
@@ -3215,7 +3840,7 @@ func (r *bucketIndexReader) loadSeries(ctx context.Context, ids []storage.Series
 		return httpgrpc.Errorf(int(codes.ResourceExhausted), "exceeded bytes limit while fetching series: %s", err)
 	}
 
-	b, err := r.block.readIndexRange(ctx, int64(start), int64(end-start), r.logger)
+	b, err := r.block.readIndexRange(ctx, tenant, int64(start), int64(end-start), r.logger)
 	if err != nil {
 		return errors.Wrap(err, "read series range")
 	}
@@ -3422,12 +4047,10 @@ type bucketChunkReader struct {
 
 	toLoad [][]loadIdx
 
-	// chunkBytesMtx protects access to chunkBytes, when updated from chunks-loading goroutines.
-	// After chunks are loaded, mutex is no longer used.
-	chunkBytesMtx sync.Mutex
-	stats         *queryStats
-	chunkBytes    []*[]byte // Byte slice to return to the chunk pool on close.
-	logger        log.Logger
+	stats  *queryStats
+	arena  *seriesArena       // Arena chunks are saved to.
+	quota  *seriesMemoryQuota // Quota the buffers chunks are read to are reserved from.
+	logger log.Logger
 
 	loadingChunksMtx  sync.Mutex
 	loadingChunks     bool
@@ -3443,7 +4066,9 @@ func newBucketChunkReader(block *bucketBlock, logger log.Logger) *bucketChunkRea
 	}
 }
 
-func (r *bucketChunkReader) reset() {
+// reset prepares the reader to load a new batch of chunks, saving them to the given arena.
+func (r *bucketChunkReader) reset(arena *seriesArena) {
+	r.arena = arena
 	for i := range r.toLoad {
 		r.toLoad[i] = r.toLoad[i][:0]
 	}
@@ -3455,7 +4080,7 @@ func (r *bucketChunkReader) reset() {
 
 func (r *bucketChunkReader) Close() error {
 	// NOTE(GiedriusS): we need to wait until loading chunks because loading
-	// chunks modifies r.block.chunkPool.
+	// chunks modifies r.block.chunkPool. Arenas must not be freed before either.
 	r.loadingChunksMtx.Lock()
 	loadingChks := r.loadingChunks
 	r.loadingChunksMtx.Unlock()
@@ -3464,10 +4089,6 @@ func (r *bucketChunkReader) Close() error {
 		<-r.finishLoadingChks
 	}
 	r.block.pendingReaders.Done()
-
-	for _, b := range r.chunkBytes {
-		r.block.chunkPool.Put(b)
-	}
 	return nil
 }
 
@@ -3502,6 +4123,12 @@ func (r *bucketChunkReader) load(ctx context.Context, res []seriesEntry, aggrs [
 		close(r.finishLoadingChks)
 	}()
 
+	if r.block.chunksCache != nil {
+		if err := r.loadCachedChunks(ctx, res, aggrs, calculateChunkChecksum, tenant); err != nil {
+			return err
+		}
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	for seq, pIdxs := range r.toLoad {
@@ -3530,6 +4157,54 @@ func (r *bucketChunkReader) load(ctx context.Context, res []seriesEntry, aggrs [
 	return g.Wait()
 }
 
+// chunkRef returns the reference of the chunk at the given offset of the segment file with sequence number seq.
+func chunkRef(seq int, offset uint32) chunks.ChunkRef {
+	return chunks.ChunkRef(uint64(seq)<<32 | uint64(offset))
+}
+
+// loadCachedChunks populates the added chunks found in the chunks cache, and removes them from the chunks to fetch.
+func (r *bucketChunkReader) loadCachedChunks(ctx context.Context, res []seriesEntry, aggrs []storepb.Aggr, calculateChunkChecksum bool, tenant string) error {
+	var refs []chunks.ChunkRef
+	for seq, pIdxs := range r.toLoad {
+		for _, pIdx := range pIdxs {
+			refs = append(refs, chunkRef(seq, pIdx.offset))
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	hits, _ := r.block.chunksCache.FetchMultiChunks(ctx, r.block.meta.ULID, refs, tenant)
+	if len(hits) == 0 {
+		return nil
+	}
+	for seq, pIdxs := range r.toLoad {
+		misses := pIdxs[:0]
+		for _, pIdx := range pIdxs {
+			v, ok := hits[chunkRef(seq, pIdx.offset)]
+			if !ok || len(v) == 0 {
+				misses = append(misses, pIdx)
+				continue
+			}
+			c := rawChunk(v)
+			if err := populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), &c, aggrs, r.arena, calculateChunkChecksum); err != nil {
+				return errors.Wrap(err, "populate cached chunk")
+			}
+			r.stats.add(ChunksTouched, 1, len(v)-1)
+		}
+		r.toLoad[seq] = misses
+	}
+	return nil
+}
+
+// storeChunk stores a copy of the given chunk, its encoding followed by its data, to the chunks cache, if any.
+func (r *bucketChunkReader) storeChunk(seq int, offset uint32, c []byte, tenant string) {
+	if r.block.chunksCache == nil {
+		return
+	}
+	r.block.chunksCache.StoreChunk(r.block.meta.ULID, chunkRef(seq, offset), append([]byte(nil), c...), tenant)
+}
+
 // loadChunks will read range [start, end] from the segment file with sequence number seq.
 // This data range covers chunks starting at supplied offsets.
 func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, aggrs []storepb.Aggr, seq int, part Part, pIdxs []loadIdx, calculateChunkChecksum bool, bytesLimiter BytesLimiter, tenant string) error {
@@ -3541,7 +4216,13 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 	}()
 
 	// Get a reader for the required range.
-	reader, err := r.block.chunkRangeReader(ctx, seq, int64(part.Start), int64(part.End-part.Start))
+	var reader io.ReadCloser
+	var err error
+	if r.block.chunksCache != nil {
+		reader, err = r.block.sharedChunkRangeReader(ctx, tenant, seq, int64(part.Start), int64(part.End-part.Start), r.logger)
+	} else {
+		reader, err = r.block.chunkRangeReader(ctx, tenant, seq, int64(part.Start), int64(part.End-part.Start))
+	}
 	if err != nil {
 		return errors.Wrap(err, "get range reader")
 	}
@@ -3569,6 +4250,10 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		buf = make([]byte, r.block.estimatedMaxChunkSize)
 	}
 	defer r.block.chunkPool.Put(&buf)
+	if err := r.quota.reserve(cap(buf)); err != nil {
+		return err
+	}
+	defer r.quota.release(cap(buf))
 
 	for i, pIdx := range pIdxs {
 		// Fast forward range reader to the next chunk start in case of sparse (for our purposes) byte range.
@@ -3606,10 +4291,11 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		chunkLen = n + 1 + int(chunkDataLen)
 		if chunkLen <= len(cb) {
 			c := rawChunk(cb[n:chunkLen])
-			err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), &c, aggrs, r.save, calculateChunkChecksum)
+			err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), &c, aggrs, r.arena, calculateChunkChecksum)
 			if err != nil {
 				return errors.Wrap(err, "populate chunk")
 			}
+			r.storeChunk(seq, pIdx.offset, c, tenant)
 			stats.add(ChunksTouched, 1, int(chunkDataLen))
 			continue
 		}
@@ -3623,21 +4309,27 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 			return httpgrpc.Errorf(int(codes.ResourceExhausted), "exceeded bytes limit while fetching chunks: %s", err)
 		}
 
-		nb, err := r.block.readChunkRange(ctx, seq, int64(pIdx.offset), int64(chunkLen), []byteRange{{offset: 0, length: chunkLen}}, r.logger)
+		nb, err := r.block.readChunkRange(ctx, tenant, seq, int64(pIdx.offset), int64(chunkLen), []byteRange{{offset: 0, length: chunkLen}}, r.logger)
 		if err != nil {
 			return errors.Wrapf(err, "preloaded chunk too small, expecting %d, and failed to fetch full chunk", chunkLen)
 		}
 		if len(*nb) != chunkLen {
 			return errors.Errorf("preloaded chunk too small, expecting %d", chunkLen)
 		}
+		if err := r.quota.reserve(cap(*nb)); err != nil {
+			r.block.chunkPool.Put(nb)
+			return err
+		}
 
 		stats.add(ChunksFetched, 1, len(*nb))
 		c := rawChunk((*nb)[n:])
-		err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), &c, aggrs, r.save, calculateChunkChecksum)
+		err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), &c, aggrs, r.arena, calculateChunkChecksum)
+		r.quota.release(cap(*nb))
 		if err != nil {
 			r.block.chunkPool.Put(nb)
 			return errors.Wrap(err, "populate chunk")
 		}
+		r.storeChunk(seq, pIdx.offset, c, tenant)
 
 		stats.add(ChunksTouched, 1, int(chunkDataLen))
 
@@ -3646,25 +4338,6 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 	return nil
 }
 
-// save saves a copy of b's payload to a memory pool of its own and returns a new byte slice referencing said copy.
-// Returned slice becomes invalid once r.block.chunkPool.Put() is called.
-func (r *bucketChunkReader) save(b []byte) ([]byte, error) {
-	r.chunkBytesMtx.Lock()
-	defer r.chunkBytesMtx.Unlock()
-	// Ensure we never grow slab beyond original capacity.
-	if len(r.chunkBytes) == 0 ||
-		cap(*r.chunkBytes[len(r.chunkBytes)-1])-len(*r.chunkBytes[len(r.chunkBytes)-1]) < len(b) {
-		s, err := r.block.chunkPool.Get(len(b))
-		if err != nil {
-			return nil, errors.Wrap(err, "allocate chunk bytes")
-		}
-		r.chunkBytes = append(r.chunkBytes, s)
-	}
-	slab := r.chunkBytes[len(r.chunkBytes)-1]
-	*slab = append(*slab, b...)
-	return (*slab)[len(*slab)-len(b):], nil
-}
-
 // rawChunk is a helper type that wraps a chunk's raw bytes and implements the chunkenc.Chunk
 // interface over it.
 // It is used to Store API responses which don't need to introspect and validate the chunk's contents.
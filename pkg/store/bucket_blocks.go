@@ -0,0 +1,96 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+)
+
+const (
+	// IndexHeaderLoaded is the state of index-headers loaded in memory.
+	IndexHeaderLoaded = "loaded"
+	// IndexHeaderUnloaded is the state of lazy index-headers which are loaded upon the next query of their block.
+	IndexHeaderUnloaded = "unloaded"
+)
+
+// LoadedBlock describes a block loaded by a BucketStore.
+type LoadedBlock struct {
+	ULID       ulid.ULID         `json:"ulid"`
+	MinTime    int64             `json:"minTime"`
+	MaxTime    int64             `json:"maxTime"`
+	Resolution int64             `json:"resolution"`
+	Labels     map[string]string `json:"labels"`
+	// Size is the size of the files of the block in object storage, in bytes, 0 if its meta.json does not list them.
+	Size int64 `json:"size"`
+
+	// IndexHeader is the state of the index-header of the block, IndexHeaderLoaded or IndexHeaderUnloaded.
+	IndexHeader string `json:"indexHeader"`
+	// IndexHeaderSize is the size of the index-header loaded in memory, in bytes, 0 if it is unloaded or not lazy.
+	IndexHeaderSize int64 `json:"indexHeaderSize"`
+}
+
+// LoadedBlocks returns the loaded blocks overlapping the time range [mint, maxt] whose external labels, and block ID
+// label, match any of the given sets of matchers, or all of them if there is none, sorted by min time.
+func (s *BucketStore) LoadedBlocks(mint, maxt int64, matcherSets ...[]*labels.Matcher) []LoadedBlock {
+	s.mtx.RLock()
+	res := make([]LoadedBlock, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		if b.meta.MaxTime < mint || b.meta.MinTime > maxt || !matchesAnySet(b.relabelLabels, matcherSets) {
+			continue
+		}
+
+		lb := LoadedBlock{
+			ULID:        b.meta.ULID,
+			MinTime:     b.meta.MinTime,
+			MaxTime:     b.meta.MaxTime,
+			Resolution:  b.meta.Thanos.Downsample.Resolution,
+			Labels:      b.meta.Thanos.Labels,
+			IndexHeader: IndexHeaderLoaded,
+		}
+		for _, f := range b.meta.Thanos.Files {
+			lb.Size += f.SizeBytes
+		}
+		if r, ok := b.indexHeaderReader.(*indexheader.LazyBinaryReader); ok {
+			if loaded, ok := r.Loaded(); ok {
+				lb.IndexHeaderSize = loaded.Size
+			} else {
+				lb.IndexHeader = IndexHeaderUnloaded
+			}
+		}
+		res = append(res, lb)
+	}
+	s.mtx.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].MinTime == res[j].MinTime {
+			return res[i].ULID.Compare(res[j].ULID) < 0
+		}
+		return res[i].MinTime < res[j].MinTime
+	})
+	return res
+}
+
+func matchesAnySet(lset labels.Labels, matcherSets [][]*labels.Matcher) bool {
+	if len(matcherSets) == 0 {
+		return true
+	}
+	for _, ms := range matcherSets {
+		matches := true
+		for _, m := range ms {
+			if !m.Matches(lset.Get(m.Name)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
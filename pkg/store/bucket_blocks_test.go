@@ -0,0 +1,66 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"math"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestLoadedBlocks(t *testing.T) {
+	s := &BucketStore{blocks: map[ulid.ULID]*bucketBlock{}}
+	ids := make([]ulid.ULID, 3)
+	for i, tenant := range []string{"a", "b", "a"} {
+		ids[i] = ulid.MustNew(uint64(i), nil)
+		meta := &metadata.Meta{Thanos: metadata.Thanos{
+			Labels: map[string]string{"tenant": tenant},
+			Files:  []metadata.File{{RelPath: "index", SizeBytes: 10}, {RelPath: "chunks/000001", SizeBytes: 100}},
+		}}
+		meta.ULID = ids[i]
+		// Blocks are loaded in reverse order of time.
+		meta.MinTime, meta.MaxTime = int64(2-i)*100, int64(3-i)*100
+		s.blocks[ids[i]] = &bucketBlock{
+			meta:          meta,
+			relabelLabels: labels.FromStrings("tenant", tenant, block.BlockIDLabel, ids[i].String()),
+		}
+	}
+	order := func(blocks []LoadedBlock) []ulid.ULID {
+		var res []ulid.ULID
+		for _, b := range blocks {
+			res = append(res, b.ULID)
+		}
+		return res
+	}
+
+	all := s.LoadedBlocks(math.MinInt64, math.MaxInt64)
+	testutil.Equals(t, []ulid.ULID{ids[2], ids[1], ids[0]}, order(all))
+	testutil.Equals(t, LoadedBlock{
+		ULID:        ids[0],
+		MinTime:     200,
+		MaxTime:     300,
+		Labels:      map[string]string{"tenant": "a"},
+		Size:        110,
+		IndexHeader: IndexHeaderLoaded,
+	}, all[2])
+
+	testutil.Equals(t, []ulid.ULID{ids[1], ids[0]}, order(s.LoadedBlocks(150, 250)))
+	testutil.Equals(t, []ulid.ULID{ids[2], ids[0]}, order(s.LoadedBlocks(math.MinInt64, math.MaxInt64,
+		[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")},
+	)))
+	// Blocks matching any of the sets of matchers are returned.
+	testutil.Equals(t, []ulid.ULID{ids[1], ids[0]}, order(s.LoadedBlocks(math.MinInt64, math.MaxInt64,
+		[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "b")},
+		[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, block.BlockIDLabel, ids[0].String())},
+	)))
+	testutil.Equals(t, 0, len(s.LoadedBlocks(math.MinInt64, math.MaxInt64,
+		[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "a"), labels.MustNewMatcher(labels.MatchEqual, "tenant", "b")},
+	)))
+}
@@ -0,0 +1,155 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+// BucketReadConcurrencyConfig holds the config of the adaptive concurrency limit of object storage reads.
+type BucketReadConcurrencyConfig struct {
+	// MinConcurrency is the lowest concurrency limit.
+	MinConcurrency int
+	// MaxConcurrency is the highest, and initial, concurrency limit. 0 disables adaptive concurrency.
+	MaxConcurrency int
+	// LatencyThreshold is the time to first byte above which reads are considered overloaded. 0 disables it.
+	LatencyThreshold time.Duration
+}
+
+// Enabled returns true if adaptive concurrency of object storage reads is configured.
+func (cfg BucketReadConcurrencyConfig) Enabled() bool {
+	return cfg.MaxConcurrency > 0
+}
+
+// Validate validates the adaptive concurrency config of object storage reads.
+func (cfg BucketReadConcurrencyConfig) Validate() error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.MinConcurrency < 1 || cfg.MinConcurrency > cfg.MaxConcurrency {
+		return errors.Errorf("minimum bucket read concurrency must be between 1 and the maximum bucket read concurrency %d, got %d", cfg.MaxConcurrency, cfg.MinConcurrency)
+	}
+	if cfg.LatencyThreshold < 0 {
+		return errors.Errorf("bucket read latency threshold must not be negative, got %v", cfg.LatencyThreshold)
+	}
+	return nil
+}
+
+// AdaptiveConcurrencyBucket limits the number of concurrent Get and GetRange calls to the object storage with a
+// gate.Adaptive limit, so that the concurrency of reads tunes itself to what the backend can sustain. The limit is
+// decreased by reads which failed, or whose time to first byte was above the latency threshold. A read holds its slot
+// until its reader is closed.
+type AdaptiveConcurrencyBucket struct {
+	objstore.InstrumentedBucket
+
+	cfg   BucketReadConcurrencyConfig
+	limit *gate.Adaptive
+}
+
+// NewAdaptiveConcurrencyBucket returns a new AdaptiveConcurrencyBucket reading from bkt, starting with the maximum
+// concurrency limit.
+func NewAdaptiveConcurrencyBucket(bkt objstore.InstrumentedBucket, cfg BucketReadConcurrencyConfig, reg prometheus.Registerer) *AdaptiveConcurrencyBucket {
+	return &AdaptiveConcurrencyBucket{
+		InstrumentedBucket: bkt,
+		cfg:                cfg,
+		limit:              gate.NewAdaptive(reg, "thanos_bucket_store_bucket_read", "object storage reads", cfg.MinConcurrency, cfg.MaxConcurrency),
+	}
+}
+
+// WithExpectedErrs returns a copy of the bucket sharing its concurrency limit.
+func (b *AdaptiveConcurrencyBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	res := *b
+	res.InstrumentedBucket = b.asInstrumented(b.InstrumentedBucket.WithExpectedErrs(fn))
+	return &res
+}
+
+// ReaderWithExpectedErrs returns a copy of the bucket sharing its concurrency limit.
+func (b *AdaptiveConcurrencyBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+func (b *AdaptiveConcurrencyBucket) asInstrumented(bkt objstore.Bucket) objstore.InstrumentedBucket {
+	if ib, ok := bkt.(objstore.InstrumentedBucket); ok {
+		return ib
+	}
+	return b.InstrumentedBucket
+}
+
+// Get returns a reader for the given object within the concurrency limit.
+func (b *AdaptiveConcurrencyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.read(ctx, func() (io.ReadCloser, error) { return b.InstrumentedBucket.Get(ctx, name) })
+}
+
+// GetRange returns a reader for the given range of the object within the concurrency limit.
+func (b *AdaptiveConcurrencyBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.read(ctx, func() (io.ReadCloser, error) { return b.InstrumentedBucket.GetRange(ctx, name, off, length) })
+}
+
+func (b *AdaptiveConcurrencyBucket) read(ctx context.Context, get func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	done, err := b.limit.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rc, err := get()
+	if err != nil {
+		done(b.overloaded(err, 0))
+		return nil, err
+	}
+	return &adaptiveConcurrencyReader{
+		ReadCloser: rc,
+		bkt:        b,
+		done:       done,
+		slow:       b.overloaded(nil, time.Since(start)),
+	}, nil
+}
+
+// overloaded returns true if the outcome of a read tells that the object storage is overloaded.
+func (b *AdaptiveConcurrencyBucket) overloaded(err error, ttfb time.Duration) bool {
+	if err != nil {
+		// Canceled reads and missing objects don't tell anything about the object storage.
+		return !errors.Is(err, context.Canceled) && !b.IsObjNotFoundErr(err)
+	}
+	return b.cfg.LatencyThreshold > 0 && ttfb > b.cfg.LatencyThreshold
+}
+
+// Limit returns the current concurrency limit.
+func (b *AdaptiveConcurrencyBucket) Limit() int {
+	return b.limit.Limit()
+}
+
+// adaptiveConcurrencyReader releases the slot of its read once closed, recording whether reading failed.
+type adaptiveConcurrencyReader struct {
+	io.ReadCloser
+
+	bkt  *AdaptiveConcurrencyBucket
+	done func(overloaded bool)
+	slow bool
+
+	once    sync.Once
+	readErr error
+}
+
+func (r *adaptiveConcurrencyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && r.readErr == nil {
+		r.readErr = err
+	}
+	return n, err
+}
+
+func (r *adaptiveConcurrencyReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() { r.done(r.slow || (r.readErr != nil && r.bkt.overloaded(r.readErr, 0))) })
+	return err
+}
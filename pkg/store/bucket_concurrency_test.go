@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+)
+
+// slowBucket delays the first byte of reads, and fails the reads of objects named "fail".
+type slowBucket struct {
+	objstore.Bucket
+
+	delay time.Duration
+}
+
+func (b *slowBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if name == "fail" {
+		return nil, errors.New("internal error")
+	}
+	time.Sleep(b.delay)
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *slowBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	time.Sleep(b.delay)
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func TestBucketReadConcurrencyConfig_Validate(t *testing.T) {
+	testutil.Ok(t, BucketReadConcurrencyConfig{}.Validate())
+	testutil.Ok(t, BucketReadConcurrencyConfig{MinConcurrency: 1, MaxConcurrency: 10, LatencyThreshold: time.Second}.Validate())
+	testutil.NotOk(t, BucketReadConcurrencyConfig{MinConcurrency: 0, MaxConcurrency: 10}.Validate())
+	testutil.NotOk(t, BucketReadConcurrencyConfig{MinConcurrency: 11, MaxConcurrency: 10}.Validate())
+	testutil.NotOk(t, BucketReadConcurrencyConfig{MinConcurrency: 1, MaxConcurrency: 10, LatencyThreshold: -time.Second}.Validate())
+}
+
+func TestAdaptiveConcurrencyBucket(t *testing.T) {
+	ctx := context.Background()
+	inmem := objstore.NewInMemBucket()
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader([]byte("content"))))
+
+	slow := &slowBucket{Bucket: inmem}
+	reg := prometheus.NewRegistry()
+	bkt := NewAdaptiveConcurrencyBucket(objstore.WithNoopInstr(slow), BucketReadConcurrencyConfig{
+		MinConcurrency:   1,
+		MaxConcurrency:   8,
+		LatencyThreshold: 50 * time.Millisecond,
+	}, reg)
+	testutil.Equals(t, 8, bkt.Limit())
+	inflight := func() float64 {
+		mfs, err := reg.Gather()
+		testutil.Ok(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() == "thanos_bucket_store_bucket_read_inflight_requests" {
+				return mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+
+	// Reads hold their slot until their reader is closed.
+	rc, err := bkt.GetRange(ctx, "obj", 1, 3)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1.0, inflight())
+	b, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "ont", string(b))
+	testutil.Ok(t, rc.Close())
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 0.0, inflight())
+	testutil.Equals(t, 8, bkt.Limit())
+
+	// Missing objects don't decrease the limit.
+	_, err = bkt.Get(ctx, "missing")
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+	testutil.Equals(t, 8, bkt.Limit())
+
+	// Failed reads do.
+	_, err = bkt.Get(ctx, "fail")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 4, bkt.Limit())
+
+	// And so do slow ones, once closed.
+	slow.delay = 100 * time.Millisecond
+	rc, err = bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 4, bkt.Limit())
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 2, bkt.Limit())
+
+	// Copies with expected errors share the limit.
+	rc, err = bkt.ReaderWithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 1, bkt.Limit())
+
+	testutil.Ok(t, promtestutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP thanos_bucket_store_bucket_read_concurrency_limit_decreases_total The total number of decreases of the concurrency limit of object storage reads, because they found their backend overloaded.
+# TYPE thanos_bucket_store_bucket_read_concurrency_limit_decreases_total counter
+thanos_bucket_store_bucket_read_concurrency_limit_decreases_total 3
+`), "thanos_bucket_store_bucket_read_concurrency_limit_decreases_total"))
+}
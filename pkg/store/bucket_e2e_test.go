@@ -37,6 +37,7 @@ import (
 	storecache "github.com/thanos-io/thanos/pkg/store/cache"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
@@ -605,6 +606,21 @@ func TestBucketStore_TimePartitioning_e2e(t *testing.T) {
 		// we should only get 1, as we are filtering by time.
 		testutil.Equals(t, 1, len(s.Chunks))
 	}
+
+	// Labels of the blocks overlapping the time range limit are not served for the time after it.
+	labelNamesResp, err := s.store.LabelNames(ctx, &storepb.LabelNamesRequest{Start: mint, End: maxt})
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(labelNamesResp.Names) > 0, "expected label names before the time range limit")
+	labelNamesResp, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{Start: maxt + 1, End: s.maxTime})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(labelNamesResp.Names))
+
+	labelValuesResp, err := s.store.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a", Start: mint, End: maxt})
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(labelValuesResp.Values) > 0, "expected label values before the time range limit")
+	labelValuesResp, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a", Start: maxt + 1, End: s.maxTime})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(labelValuesResp.Values))
 }
 
 func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
@@ -677,6 +693,69 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_BlockHeatmap_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := prepareStoreWithTestBlocks(t, t.TempDir(), objstore.NewInMemBucket(), false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), NewBytesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	testutil.Ok(t, s.store.SyncBlocks(ctx))
+	s.cache.SwapWith(noopCache{})
+
+	heatmap := s.store.BlockHeatmap(0, false)
+	testutil.Equals(t, 6, len(heatmap))
+	for _, h := range heatmap {
+		testutil.Equals(t, int64(0), h.Queries)
+		testutil.Assert(t, h.LastQueried == nil, "block %s was never queried", h.ULID)
+	}
+
+	// Only the two blocks of the last time slot are queried.
+	for i := 0; i < 2; i++ {
+		testutil.Ok(t, s.store.Series(&storepb.SeriesRequest{
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+			MinTime:  s.maxTime - int64(time.Hour/time.Millisecond),
+			MaxTime:  s.maxTime,
+		}, newStoreSeriesServer(ctx)))
+	}
+
+	hottest := s.store.BlockHeatmap(2, false)
+	testutil.Equals(t, 2, len(hottest))
+	for _, h := range hottest {
+		testutil.Equals(t, int64(2), h.Queries)
+		testutil.Equals(t, s.maxTime, h.MaxTime)
+		testutil.Assert(t, h.BytesTouched > 0, "expected bytes touched for block %s", h.ULID)
+		testutil.Assert(t, h.BytesFetched > 0, "expected bytes fetched for block %s", h.ULID)
+		testutil.Assert(t, h.LastQueried != nil, "expected last query time for block %s", h.ULID)
+	}
+
+	coldest := s.store.BlockHeatmap(0, true)
+	testutil.Equals(t, 6, len(coldest))
+	for _, h := range coldest[:4] {
+		testutil.Equals(t, int64(0), h.Queries)
+	}
+}
+
+func TestBucketStore_SeriesStatsOnly_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := prepareStoreWithTestBlocks(t, t.TempDir(), objstore.NewInMemBucket(), false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), NewBytesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	testutil.Ok(t, s.store.SyncBlocks(ctx))
+	s.cache.SwapWith(noopCache{})
+
+	srv := storetestutil.NewSeriesServer(ctx)
+	testutil.Ok(t, s.store.Series(&storepb.SeriesRequest{
+		Matchers:        []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+		MinTime:         s.minTime,
+		MaxTime:         s.maxTime,
+		SeriesStatsOnly: true,
+	}, srv))
+	testutil.Equals(t, 0, len(srv.SeriesSet))
+	// Series of all blocks are deduplicated before being counted.
+	testutil.Equals(t, []*storepb.SeriesStats{
+		{Series: 4, LabelNames: []string{"a", "b", "c", "ext1", "ext2"}},
+	}, srv.StatsSet)
+}
+
 func TestBucketStore_Series_CustomBytesLimiters_e2e(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -0,0 +1,136 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// blockHeat holds the counters of the Series calls a block was queried by.
+type blockHeat struct {
+	queries      atomic.Int64
+	bytesTouched atomic.Int64
+	bytesFetched atomic.Int64
+	// lastQueried is the Unix time in milliseconds of the last query, 0 if the block was never queried.
+	lastQueried atomic.Int64
+}
+
+func (h *blockHeat) observe(stats *queryStats, now time.Time) {
+	h.queries.Inc()
+	h.bytesTouched.Add(int64(stats.PostingsTouchedSizeSum + stats.SeriesTouchedSizeSum + stats.ChunksTouchedSizeSum))
+	h.bytesFetched.Add(int64(stats.PostingsFetchedSizeSum + stats.SeriesFetchedSizeSum + stats.ChunksFetchedSizeSum))
+	h.lastQueried.Store(now.UnixMilli())
+}
+
+// BlockHeat is the query heat of a loaded block, since it was loaded.
+type BlockHeat struct {
+	ULID       ulid.ULID         `json:"ulid"`
+	MinTime    int64             `json:"minTime"`
+	MaxTime    int64             `json:"maxTime"`
+	Resolution int64             `json:"resolution"`
+	Labels     map[string]string `json:"labels"`
+
+	// Queries is the number of Series calls the block was queried by.
+	Queries int64 `json:"queries"`
+	// BytesTouched is the size of the postings, series and chunks of the block touched by queries, cached or not.
+	BytesTouched int64 `json:"bytesTouched"`
+	// BytesFetched is the size of the postings, series and chunks of the block fetched from object storage.
+	BytesFetched int64      `json:"bytesFetched"`
+	LastQueried  *time.Time `json:"lastQueried,omitempty"`
+}
+
+// BlockHeatmap returns the query heat of at most limit loaded blocks, or all of them if limit is 0. Blocks are ranked
+// by the number of queries, then the bytes touched, the hottest first, or the coldest first if coldest is true.
+func (s *BucketStore) BlockHeatmap(limit int, coldest bool) []BlockHeat {
+	s.mtx.RLock()
+	res := make([]BlockHeat, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		h := BlockHeat{
+			ULID:         b.meta.ULID,
+			MinTime:      b.meta.MinTime,
+			MaxTime:      b.meta.MaxTime,
+			Resolution:   b.meta.Thanos.Downsample.Resolution,
+			Labels:       b.meta.Thanos.Labels,
+			Queries:      b.heat.queries.Load(),
+			BytesTouched: b.heat.bytesTouched.Load(),
+			BytesFetched: b.heat.bytesFetched.Load(),
+		}
+		if t := b.heat.lastQueried.Load(); t > 0 {
+			lastQueried := time.UnixMilli(t)
+			h.LastQueried = &lastQueried
+		}
+		res = append(res, h)
+	}
+	s.mtx.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		hotter := res[i].Queries > res[j].Queries
+		if res[i].Queries == res[j].Queries {
+			if res[i].BytesTouched == res[j].BytesTouched {
+				return res[i].ULID.Compare(res[j].ULID) < 0
+			}
+			hotter = res[i].BytesTouched > res[j].BytesTouched
+		}
+		return hotter != coldest
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// blockHeatmapCollector exports the query heat of the topN hottest blocks, to bound the cardinality of the metrics.
+type blockHeatmapCollector struct {
+	store *BucketStore
+	topN  int
+
+	queries      *prometheus.Desc
+	bytesTouched *prometheus.Desc
+	bytesFetched *prometheus.Desc
+}
+
+func newBlockHeatmapCollector(store *BucketStore, topN int) *blockHeatmapCollector {
+	return &blockHeatmapCollector{
+		store: store,
+		topN:  topN,
+		queries: prometheus.NewDesc(
+			"thanos_bucket_store_block_queries_total",
+			"Number of Series calls the most queried blocks were queried by, since they were loaded.",
+			[]string{"block", "resolution"}, nil,
+		),
+		bytesTouched: prometheus.NewDesc(
+			"thanos_bucket_store_block_touched_bytes_total",
+			"Size of the postings, series and chunks of the most queried blocks touched by queries, since they were loaded.",
+			[]string{"block", "resolution"}, nil,
+		),
+		bytesFetched: prometheus.NewDesc(
+			"thanos_bucket_store_block_fetched_bytes_total",
+			"Size of the postings, series and chunks of the most queried blocks fetched from object storage, since they were loaded.",
+			[]string{"block", "resolution"}, nil,
+		),
+	}
+}
+
+func (c *blockHeatmapCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queries
+	ch <- c.bytesTouched
+	ch <- c.bytesFetched
+}
+
+func (c *blockHeatmapCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, h := range c.store.BlockHeatmap(c.topN, false) {
+		if h.Queries == 0 {
+			break
+		}
+		id, res := h.ULID.String(), time.Duration(h.Resolution*int64(time.Millisecond)).String()
+		ch <- prometheus.MustNewConstMetric(c.queries, prometheus.CounterValue, float64(h.Queries), id, res)
+		ch <- prometheus.MustNewConstMetric(c.bytesTouched, prometheus.CounterValue, float64(h.BytesTouched), id, res)
+		ch <- prometheus.MustNewConstMetric(c.bytesFetched, prometheus.CounterValue, float64(h.BytesFetched), id, res)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/efficientgo/core/testutil"
+	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBlockHeatmap(t *testing.T) {
+	s := &BucketStore{blocks: map[ulid.ULID]*bucketBlock{}}
+	ids := make([]ulid.ULID, 4)
+	for i := range ids {
+		ids[i] = ulid.MustNew(uint64(i), nil)
+		s.blocks[ids[i]] = &bucketBlock{meta: &metadata.Meta{Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: 300000}}}}
+		s.blocks[ids[i]].meta.ULID = ids[i]
+	}
+	now := time.Unix(100, 0)
+	observe := func(id ulid.ULID, touched int) {
+		s.blocks[id].heat.observe(&queryStats{PostingsTouchedSizeSum: 1, SeriesTouchedSizeSum: 1, ChunksTouchedSizeSum: units.Base2Bytes(touched), ChunksFetchedSizeSum: 10}, now)
+	}
+	observe(ids[1], 5)
+	observe(ids[1], 5)
+	observe(ids[2], 1)
+	observe(ids[3], 100)
+
+	order := func(heatmap []BlockHeat) []ulid.ULID {
+		var res []ulid.ULID
+		for _, h := range heatmap {
+			res = append(res, h.ULID)
+		}
+		return res
+	}
+	// Blocks are ranked by queries, then bytes touched.
+	testutil.Equals(t, []ulid.ULID{ids[1], ids[3], ids[2], ids[0]}, order(s.BlockHeatmap(0, false)))
+	testutil.Equals(t, []ulid.ULID{ids[0], ids[2]}, order(s.BlockHeatmap(2, true)))
+
+	h := s.BlockHeatmap(1, false)[0]
+	testutil.Equals(t, int64(2), h.Queries)
+	testutil.Equals(t, int64(14), h.BytesTouched)
+	testutil.Equals(t, int64(20), h.BytesFetched)
+	testutil.Equals(t, now, *h.LastQueried)
+
+	// Only the top N queried blocks are exported.
+	testutil.Ok(t, promtest.CollectAndCompare(newBlockHeatmapCollector(s, 3), strings.NewReader(`
+# HELP thanos_bucket_store_block_queries_total Number of Series calls the most queried blocks were queried by, since they were loaded.
+# TYPE thanos_bucket_store_block_queries_total counter
+thanos_bucket_store_block_queries_total{block="`+ids[1].String()+`",resolution="5m0s"} 2
+thanos_bucket_store_block_queries_total{block="`+ids[2].String()+`",resolution="5m0s"} 1
+thanos_bucket_store_block_queries_total{block="`+ids[3].String()+`",resolution="5m0s"} 1
+`), "thanos_bucket_store_block_queries_total"))
+}
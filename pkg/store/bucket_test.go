@@ -32,6 +32,7 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
@@ -41,8 +42,11 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/prometheus/prometheus/tsdb/index"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/atomic"
 	"golang.org/x/exp/slices"
 
@@ -64,6 +68,8 @@ import (
 	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/testutil/custom"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 var emptyRelabelConfig = make([]*relabel.Config, 0)
@@ -723,6 +729,171 @@ func TestBucketStore_TSDBInfo(t *testing.T) {
 	})
 }
 
+func TestBucketStore_ArchiveBucket(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	archiveBkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	series := []labels.Labels{labels.FromStrings("a", "1", "b", "1")}
+
+	var ids []ulid.ULID
+	for i, bkts := range [][]objstore.Bucket{{bkt}, {archiveBkt}, {bkt, archiveBkt}} {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 10, int64(i)*1000, int64(i+1)*1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		for _, b := range bkts {
+			testutil.Ok(t, block.Upload(ctx, logger, b, filepath.Join(dir, id.String()), metadata.NoneFunc))
+		}
+		ids = append(ids, id)
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, block.NewConcurrentLister(logger, bkt), "", nil, nil)
+	testutil.Ok(t, err)
+	archiveMetaFetcher, err := block.NewMetaFetcher(logger, 20, archiveBkt, block.NewConcurrentLister(logger, archiveBkt), "", nil, nil)
+	testutil.Ok(t, err)
+
+	bucketStore, err := NewBucketStore(
+		bkt,
+		metaFetcher,
+		t.TempDir(),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewBytesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithFilterConfig(allowAllFilterConf),
+		WithArchiveBucket(archiveBkt, archiveMetaFetcher),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bucketStore.Close()) }()
+
+	testutil.Ok(t, bucketStore.SyncBlocks(ctx))
+	testutil.Equals(t, 3, len(bucketStore.blocks))
+	// Blocks present in both buckets are loaded from the main bucket.
+	testutil.Equals(t, objstore.BucketReader(bkt), bucketStore.blocks[ids[0]].bkt)
+	testutil.Equals(t, objstore.BucketReader(archiveBkt), bucketStore.blocks[ids[1]].bkt)
+	testutil.Equals(t, objstore.BucketReader(bkt), bucketStore.blocks[ids[2]].bkt)
+
+	srv := storetestutil.NewSeriesServer(ctx)
+	testutil.Ok(t, bucketStore.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  3000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, srv))
+	testutil.Equals(t, 1, len(srv.SeriesSet))
+	var samples int
+	for _, c := range srv.SeriesSet[0].Chunks {
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+		testutil.Ok(t, err)
+		samples += chk.NumSamples()
+	}
+	testutil.Equals(t, 30, samples)
+
+	// Blocks deleted from the archive bucket are dropped.
+	testutil.Ok(t, block.Delete(ctx, logger, archiveBkt, ids[1]))
+	testutil.Ok(t, bucketStore.SyncBlocks(ctx))
+	testutil.Equals(t, 2, len(bucketStore.blocks))
+}
+
+type mockedChunksCache struct {
+	mtx    sync.Mutex
+	chunks map[string][]byte
+}
+
+func (c *mockedChunksCache) StoreChunk(blockID ulid.ULID, ref chunks.ChunkRef, v []byte, _ string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.chunks[fmt.Sprintf("%s:%d", blockID, ref)] = v
+}
+
+func (c *mockedChunksCache) FetchMultiChunks(_ context.Context, blockID ulid.ULID, refs []chunks.ChunkRef, _ string) (map[chunks.ChunkRef][]byte, []chunks.ChunkRef) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	hits := map[chunks.ChunkRef][]byte{}
+	var misses []chunks.ChunkRef
+	for _, ref := range refs {
+		if v, ok := c.chunks[fmt.Sprintf("%s:%d", blockID, ref)]; ok {
+			hits[ref] = v
+			continue
+		}
+		misses = append(misses, ref)
+	}
+	return hits, misses
+}
+
+func TestBucketStore_ChunksCache(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	id, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{
+		labels.FromStrings("a", "1", "b", "1"),
+		labels.FromStrings("a", "1", "b", "2"),
+	}, 500, 0, 1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, block.NewConcurrentLister(logger, bkt), "", nil, nil)
+	testutil.Ok(t, err)
+
+	chunksCache := &mockedChunksCache{chunks: map[string][]byte{}}
+	bucketStore, err := NewBucketStore(
+		bkt,
+		metaFetcher,
+		t.TempDir(),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewBytesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithFilterConfig(allowAllFilterConf),
+		WithChunksCache(chunksCache),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bucketStore.Close()) }()
+	testutil.Ok(t, bucketStore.SyncBlocks(ctx))
+
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  1000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}
+	srv := storetestutil.NewSeriesServer(ctx)
+	testutil.Ok(t, bucketStore.Series(req, srv))
+	testutil.Equals(t, 2, len(srv.SeriesSet))
+	var numChunks int
+	for _, s := range srv.SeriesSet {
+		numChunks += len(s.Chunks)
+	}
+	testutil.Equals(t, numChunks, len(chunksCache.chunks))
+
+	// Chunks are then served from the cache, without fetching them from the bucket.
+	testutil.Ok(t, bkt.Delete(ctx, path.Join(id.String(), block.ChunksDirname, "000001")))
+	cachedSrv := storetestutil.NewSeriesServer(ctx)
+	testutil.Ok(t, bucketStore.Series(req, cachedSrv))
+	testutil.Equals(t, srv.SeriesSet, cachedSrv.SeriesSet)
+}
+
 func TestBucketStore_Info(t *testing.T) {
 	defer custom.TolerantVerifyLeak(t)
 
@@ -1147,6 +1318,70 @@ func TestReadIndexCache_LoadSeries(t *testing.T) {
 	testutil.NotOk(t, r.loadSeries(ctx, []storage.SeriesRef{2, 13, 24}, false, 1, 15, NewBytesLimiterFactory(0)(nil), tenancy.DefaultTenant))
 }
 
+func TestBucketBlock_GetRange(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewRegistry()
+	b := &bucketBlock{
+		meta: &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID: ulid.MustNew(1, nil),
+			},
+		},
+		bkt:     bkt,
+		metrics: newBucketStoreMetrics(reg),
+	}
+	testutil.Ok(t, bkt.Upload(context.Background(), b.indexFilename(), bytes.NewReader([]byte("abcdef"))))
+
+	exp := tracetest.NewInMemoryExporter()
+	tracer, _ := migration.Bridge(tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(tracesdk.NewSimpleSpanProcessor(exp)), tracesdk.WithSampler(tracesdk.AlwaysSample())), log.NewNopLogger())
+	root, ctx := tracing.StartSpan(tracing.ContextWithTracer(context.Background(), tracer), "series")
+	defer root.Finish()
+	traceID, ok := tracing.TraceIDFromContext(ctx)
+	testutil.Assert(t, ok)
+
+	r, err := b.getRange(ctx, blockReadStagePostings, tenancy.DefaultTenant, b.indexFilename(), 1, 3)
+	testutil.Ok(t, err)
+	data, err := io.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "bcd", string(data))
+	testutil.Ok(t, r.Close())
+
+	_, err = b.getRange(ctx, blockReadStageChunks, tenancy.DefaultTenant, "missing", 0, 1)
+	testutil.NotOk(t, err)
+
+	testutil.Equals(t, 2, len(exp.GetSpans()))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(b.metrics.blockReadErrors.WithLabelValues(blockReadStagePostings, blockReadOpGetRange, tenancy.DefaultTenant)))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(b.metrics.blockReadErrors.WithLabelValues(blockReadStagePostings, blockReadOpRead, tenancy.DefaultTenant)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(b.metrics.blockReadErrors.WithLabelValues(blockReadStageChunks, blockReadOpGetRange, tenancy.DefaultTenant)))
+
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+	observed := map[string]uint64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "thanos_bucket_store_block_read_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var stage, op string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "stage":
+					stage = l.GetValue()
+				case "operation":
+					op = l.GetValue()
+				}
+			}
+			observed[stage+"/"+op] = m.GetHistogram().GetSampleCount()
+			for _, bkt := range m.GetHistogram().GetBucket() {
+				if e := bkt.GetExemplar(); e != nil {
+					testutil.Equals(t, traceID, e.GetLabel()[0].GetValue())
+				}
+			}
+		}
+	}
+	testutil.Equals(t, map[string]uint64{"postings/get_range": 1, "postings/read": 1, "chunks/get_range": 1}, observed)
+}
+
 func TestBucketIndexReader_ExpandedPostings(t *testing.T) {
 	tb := testutil.NewTB(t)
 
@@ -2757,7 +2992,7 @@ func BenchmarkBucketBlock_readChunkRange(b *testing.B) {
 		offset := int64(0)
 		length := readLengths[n%len(readLengths)]
 
-		_, err := blk.readChunkRange(ctx, 0, offset, length, byteRanges{{offset: 0, length: int(length)}}, logger)
+		_, err := blk.readChunkRange(ctx, tenancy.DefaultTenant, 0, offset, length, byteRanges{{offset: 0, length: int(length)}}, logger)
 		if err != nil {
 			b.Fatal(err.Error())
 		}
@@ -2904,6 +3139,8 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 					dummyCounter,
 					dummyCounter,
 					tenancy.DefaultTenant,
+					nil,
+					nil,
 				)
 				testutil.Ok(b, blockClient.ExpandPostings(sortedMatchers, seriesLimiter))
 				defer blockClient.Close()
@@ -3314,6 +3551,51 @@ func TestMatchersToPostingGroup(t *testing.T) {
 	}
 }
 
+func TestRegexSetMatches(t *testing.T) {
+	manyValues := make([]string, 0, 1000)
+	for i := 0; i < cap(manyValues); i++ {
+		manyValues = append(manyValues, fmt.Sprintf("pod-%d.example", i))
+	}
+	sortedManyValues := slices.Clone(manyValues)
+	sort.Strings(sortedManyValues)
+	quoted := make([]string, 0, len(manyValues))
+	for _, v := range manyValues {
+		quoted = append(quoted, regexp.QuoteMeta(v))
+	}
+
+	tooManyValues := make([]string, 0, maxRegexSetMatches+1)
+	for i := 0; i < cap(tooManyValues); i++ {
+		tooManyValues = append(tooManyValues, fmt.Sprintf("v%d", i))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		regex    string
+		expected []string
+	}{
+		{name: "small alternation", regex: "b|a|c", expected: []string{"a", "b", "c"}},
+		{name: "alternation larger than labels.Matcher set matches", regex: strings.Join(quoted, "|"), expected: sortedManyValues},
+		{name: "grouped alternation with common prefixes", regex: "(?:api|web)-(1|2|10)", expected: []string{"api-1", "api-10", "api-2", "web-1", "web-10", "web-2"}},
+		{name: "duplicated values", regex: "a|b|a", expected: []string{"a", "b"}},
+		{name: "too many values", regex: strings.Join(tooManyValues, "|")},
+		{name: "regex metacharacters", regex: strings.Join(append(quoted, "pod-.*"), "|")},
+		{name: "case insensitive", regex: "(?i)" + strings.Join(quoted, "|")},
+		{name: "no alternation", regex: "foo.+"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Equals(t, tc.expected, regexSetMatches(labels.MustNewMatcher(labels.MatchRegexp, "name", tc.regex)))
+		})
+	}
+
+	// Large alternations do not need the values of the label.
+	actual, err := matchersToPostingGroups(context.Background(), func(string) ([]string, error) {
+		return nil, errors.New("unexpected label values lookup")
+	}, []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "name", strings.Join(quoted, "|"))})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(actual))
+	testutil.Equals(t, sortedManyValues, actual[0].addKeys)
+}
+
 func TestPostingGroupMerge(t *testing.T) {
 	for _, tc := range []struct {
 		name     string
@@ -0,0 +1,169 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/cacheutil"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+// ChunksCache is the interface exported by chunks cache backends. Chunks are identified by the ID of their block and
+// their reference in the block, and their value is their encoding followed by their data.
+// Like for IndexCache, store operations do not support context.Context.
+type ChunksCache interface {
+	// StoreChunk stores a single chunk. The value must not be modified once stored.
+	StoreChunk(blockID ulid.ULID, ref chunks.ChunkRef, v []byte, tenant string)
+
+	// FetchMultiChunks fetches multiple chunks - each identified by reference - from the cache
+	// and returns a map containing cache hits, along with a list of missing references.
+	FetchMultiChunks(ctx context.Context, blockID ulid.ULID, refs []chunks.ChunkRef, tenant string) (hits map[chunks.ChunkRef][]byte, misses []chunks.ChunkRef)
+}
+
+// ChunksCacheConfig specifies the chunks cache config.
+type ChunksCacheConfig struct {
+	Type   IndexCacheProvider `yaml:"type"`
+	Config interface{}        `yaml:"config"`
+
+	// TTL for storing chunks in remote cache. Default value is 24h.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// NewChunksCache initializes and returns new chunks cache, backed by memcached or redis.
+func NewChunksCache(logger log.Logger, confContentYaml []byte, reg prometheus.Registerer) (ChunksCache, error) {
+	level.Info(logger).Log("msg", "loading chunks cache configuration")
+	cacheConfig := &ChunksCacheConfig{}
+	if err := yaml.UnmarshalStrict(confContentYaml, cacheConfig); err != nil {
+		return nil, errors.Wrap(err, "parsing config YAML file")
+	}
+
+	backendConfig, err := yaml.Marshal(cacheConfig.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal content of cache backend configuration")
+	}
+
+	if cacheConfig.TTL == 0 {
+		cacheConfig.TTL = memcachedDefaultTTL
+	}
+
+	var client cacheutil.RemoteCacheClient
+	switch strings.ToUpper(string(cacheConfig.Type)) {
+	case string(MEMCACHED):
+		client, err = cacheutil.NewMemcachedClient(logger, "chunks-cache", backendConfig, reg)
+	case string(REDIS):
+		client, err = cacheutil.NewRedisClient(logger, "chunks-cache", backendConfig, reg)
+	default:
+		return nil, errors.Errorf("chunks cache with type %s is not supported", cacheConfig.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("create %s chunks cache", cacheConfig.Type))
+	}
+	return NewRemoteChunksCache(logger, client, reg, cacheConfig.TTL), nil
+}
+
+// RemoteChunksCache is a chunks cache backed by a remote cache, e.g. memcached or redis.
+type RemoteChunksCache struct {
+	logger log.Logger
+	client cacheutil.RemoteCacheClient
+	ttl    time.Duration
+
+	// Metrics.
+	requestTotal  *prometheus.CounterVec
+	hitsTotal     *prometheus.CounterVec
+	dataSizeBytes *prometheus.HistogramVec
+	fetchLatency  *prometheus.HistogramVec
+}
+
+// NewRemoteChunksCache makes a new RemoteChunksCache.
+func NewRemoteChunksCache(logger log.Logger, client cacheutil.RemoteCacheClient, reg prometheus.Registerer, ttl time.Duration) *RemoteChunksCache {
+	c := &RemoteChunksCache{
+		logger: logger,
+		client: client,
+		ttl:    ttl,
+		requestTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_store_chunks_cache_requests_total",
+			Help: "Total number of chunks requests to the chunks cache.",
+		}, []string{tenancy.MetricLabel}),
+		hitsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_store_chunks_cache_hits_total",
+			Help: "Total number of chunks requests to the chunks cache that were a hit.",
+		}, []string{tenancy.MetricLabel}),
+		dataSizeBytes: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_store_chunks_cache_stored_data_size_bytes",
+			Help:    "Histogram to track the size of the chunks stored in the chunks cache.",
+			Buckets: []float64{32, 64, 128, 256, 512, 1024, 4 * 1024, 16 * 1024, 64 * 1024},
+		}, []string{tenancy.MetricLabel}),
+		fetchLatency: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_store_chunks_cache_fetch_duration_seconds",
+			Help:    "Histogram to track latency to fetch chunks from the chunks cache.",
+			Buckets: []float64{0.01, 0.1, 0.3, 0.6, 1, 3, 6, 10, 15, 20, 30, 45, 60, 90, 120},
+		}, []string{tenancy.MetricLabel}),
+	}
+	c.requestTotal.WithLabelValues(tenancy.DefaultTenant)
+	c.hitsTotal.WithLabelValues(tenancy.DefaultTenant)
+
+	level.Info(logger).Log("msg", "created chunks cache")
+	return c
+}
+
+func chunkCacheKey(blockID string, ref chunks.ChunkRef) string {
+	return "C:" + blockID + ":" + strconv.FormatUint(uint64(ref), 10)
+}
+
+// StoreChunk sets the chunk identified by the ulid and reference to the value v.
+// The function enqueues the request and returns immediately: the entry will be
+// asynchronously stored in the cache.
+func (c *RemoteChunksCache) StoreChunk(blockID ulid.ULID, ref chunks.ChunkRef, v []byte, tenant string) {
+	c.dataSizeBytes.WithLabelValues(tenant).Observe(float64(len(v)))
+	if err := c.client.SetAsync(chunkCacheKey(blockID.String(), ref), v, c.ttl); err != nil {
+		level.Error(c.logger).Log("msg", "failed to cache chunk", "err", err)
+	}
+}
+
+// FetchMultiChunks fetches multiple chunks - each identified by reference - from the cache
+// and returns a map containing cache hits, along with a list of missing references.
+// In case of error, it logs and return an empty cache hits map.
+func (c *RemoteChunksCache) FetchMultiChunks(ctx context.Context, blockID ulid.ULID, refs []chunks.ChunkRef, tenant string) (hits map[chunks.ChunkRef][]byte, misses []chunks.ChunkRef) {
+	timer := prometheus.NewTimer(c.fetchLatency.WithLabelValues(tenant))
+	defer timer.ObserveDuration()
+
+	keys := make([]string, 0, len(refs))
+	blockIDKey := blockID.String()
+	for _, ref := range refs {
+		keys = append(keys, chunkCacheKey(blockIDKey, ref))
+	}
+
+	// Fetch the keys from the remote cache in a single request.
+	c.requestTotal.WithLabelValues(tenant).Add(float64(len(refs)))
+	results := c.client.GetMulti(ctx, keys)
+	if len(results) == 0 {
+		return nil, refs
+	}
+
+	hits = make(map[chunks.ChunkRef][]byte, len(results))
+	for i, ref := range refs {
+		value, ok := results[keys[i]]
+		if !ok {
+			misses = append(misses, ref)
+			continue
+		}
+		hits[ref] = value
+	}
+	c.hitsTotal.WithLabelValues(tenant).Add(float64(len(hits)))
+	return hits, misses
+}
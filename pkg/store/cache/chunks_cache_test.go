@@ -0,0 +1,59 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestRemoteChunksCache_FetchMultiChunks(t *testing.T) {
+	t.Parallel()
+
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+
+	client := newMockedMemcachedClient(nil)
+	c := NewRemoteChunksCache(log.NewNopLogger(), client, prometheus.NewRegistry(), time.Hour)
+	c.StoreChunk(block1, 1, []byte{1}, tenancy.DefaultTenant)
+	c.StoreChunk(block1, 1<<32|2, []byte{2}, tenancy.DefaultTenant)
+	c.StoreChunk(block2, 3, []byte{3}, tenancy.DefaultTenant)
+
+	hits, misses := c.FetchMultiChunks(context.Background(), block1, []chunks.ChunkRef{1, 1<<32 | 2, 3}, tenancy.DefaultTenant)
+	testutil.Equals(t, map[chunks.ChunkRef][]byte{1: {1}, 1<<32 | 2: {2}}, hits)
+	testutil.Equals(t, []chunks.ChunkRef{3}, misses)
+	testutil.Equals(t, 3.0, prom_testutil.ToFloat64(c.requestTotal.WithLabelValues(tenancy.DefaultTenant)))
+	testutil.Equals(t, 2.0, prom_testutil.ToFloat64(c.hitsTotal.WithLabelValues(tenancy.DefaultTenant)))
+
+	// Chunks are missed on errors of the remote cache.
+	c = NewRemoteChunksCache(log.NewNopLogger(), newMockedMemcachedClient(errors.New("mocked error")), prometheus.NewRegistry(), time.Hour)
+	hits, misses = c.FetchMultiChunks(context.Background(), block2, []chunks.ChunkRef{3}, tenancy.DefaultTenant)
+	testutil.Equals(t, 0, len(hits))
+	testutil.Equals(t, []chunks.ChunkRef{3}, misses)
+}
+
+func TestNewChunksCache(t *testing.T) {
+	_, err := NewChunksCache(log.NewNopLogger(), []byte(`type: IN-MEMORY`), nil)
+	testutil.NotOk(t, err)
+
+	_, err = NewChunksCache(log.NewNopLogger(), []byte(`type: MEMCACHED
+config:
+  addresses: []`), nil)
+	testutil.NotOk(t, err)
+
+	_, err = NewChunksCache(log.NewNopLogger(), []byte(`type: MEMCACHED
+unknown: true`), nil)
+	testutil.NotOk(t, err)
+}
@@ -401,6 +401,28 @@ func ValidateLabels(lbls []ZLabel) error {
 	return nil
 }
 
+// NormalizeLabels sorts the given labels by name and removes the duplicate labels with the same name and value, so
+// that semantically identical label sets sent with differently ordered or repeated labels are the same. Labels of a
+// name repeated with different values are ambiguous, ErrDuplicateLabels is returned for them. The given labels are
+// sorted in place, and reused for the returned labels.
+func NormalizeLabels(lbls []ZLabel) ([]ZLabel, error) {
+	sort.SliceStable(lbls, func(i, j int) bool { return lbls[i].Name < lbls[j].Name })
+	for i := 1; i < len(lbls); i++ {
+		if lbls[i].Name == lbls[i-1].Name && lbls[i].Value != lbls[i-1].Value {
+			return lbls, ErrDuplicateLabels
+		}
+	}
+
+	ret := lbls[:0]
+	for i, l := range lbls {
+		if i > 0 && l.Name == ret[len(ret)-1].Name {
+			continue
+		}
+		ret = append(ret, l)
+	}
+	return ret, nil
+}
+
 // ZLabelSets is a sortable list of ZLabelSet. It assumes the label pairs in each ZLabelSet element are already sorted.
 type ZLabelSets []ZLabelSet
 
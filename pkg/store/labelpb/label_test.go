@@ -37,6 +37,16 @@ func TestExtendLabels(t *testing.T) {
 	testInjectExtLabels(testutil.NewTB(t))
 }
 
+func TestNormalizeLabels(t *testing.T) {
+	lbls, err := NormalizeLabels([]ZLabel{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ZLabel{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}}, lbls)
+	testutil.Ok(t, ValidateLabels(lbls))
+
+	_, err = NormalizeLabels([]ZLabel{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}, {Name: "b", Value: "3"}})
+	testutil.Equals(t, ErrDuplicateLabels, err)
+}
+
 func BenchmarkExtendLabels(b *testing.B) {
 	testInjectExtLabels(testutil.NewTB(b))
 }
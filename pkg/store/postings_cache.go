@@ -0,0 +1,106 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// postingsForMatchersCache caches the expanded postings of a single block by set of matchers for a TTL, so that
+// repeated selectors, e.g. the ones of dashboards refreshed by many users, skip the index lookups entirely. Unlike the
+// index cache, cached postings are ready to be used, i.e. decoded and padded to series offsets.
+// The cache is owned by its block, so that its entries are dropped with the block once it's unloaded or reloaded.
+type postingsForMatchersCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mtx     sync.Mutex
+	entries map[string]postingsForMatchersCacheEntry
+
+	requests prometheus.Counter
+	hits     prometheus.Counter
+}
+
+type postingsForMatchersCacheEntry struct {
+	postings []storage.SeriesRef
+	expires  time.Time
+}
+
+func newPostingsForMatchersCache(ttl time.Duration, maxEntries int, requests, hits prometheus.Counter) *postingsForMatchersCache {
+	return &postingsForMatchersCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]postingsForMatchersCacheEntry{},
+		requests:   requests,
+		hits:       hits,
+	}
+}
+
+func postingsForMatchersCacheKey(ms []*labels.Matcher) string {
+	var sb strings.Builder
+	for i, m := range ms {
+		if i > 0 {
+			sb.WriteByte(0xff)
+		}
+		sb.WriteString(m.String())
+	}
+	return sb.String()
+}
+
+// fetch returns the cached postings of the given matchers, if they haven't expired yet.
+// The returned postings must not be modified.
+func (c *postingsForMatchersCache) fetch(ms []*labels.Matcher) ([]storage.SeriesRef, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.requests.Inc()
+
+	key := postingsForMatchersCacheKey(ms)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.hits.Inc()
+	return e.postings, true
+}
+
+// store caches the given postings of the given matchers. The postings must not be modified once stored. They aren't
+// stored if the cache is full of entries which haven't expired yet.
+func (c *postingsForMatchersCache) store(ms []*labels.Matcher, ps []storage.SeriesRef) {
+	if c == nil {
+		return
+	}
+
+	key := postingsForMatchersCacheKey(ms)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[key] = postingsForMatchersCacheEntry{postings: ps, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/custom"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestPostingsForMatchersCache(t *testing.T) {
+	requests, hits := prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})
+	c := newPostingsForMatchersCache(time.Minute, 2, requests, hits)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	msA := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")}
+	msB := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1"), labels.MustNewMatcher(labels.MatchEqual, "b", "1")}
+	msC := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "a", "1")}
+
+	_, ok := c.fetch(msA)
+	testutil.Assert(t, !ok)
+
+	c.store(msA, []storage.SeriesRef{16, 32})
+	c.store(msB, nil)
+	ps, ok := c.fetch(msA)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, []storage.SeriesRef{16, 32}, ps)
+	ps, ok = c.fetch(msB)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, 0, len(ps))
+
+	// The cache is full of entries which haven't expired yet.
+	c.store(msC, []storage.SeriesRef{48})
+	_, ok = c.fetch(msC)
+	testutil.Assert(t, !ok)
+
+	// Expired entries are evicted to make room for new ones.
+	now = now.Add(time.Minute)
+	c.store(msC, []storage.SeriesRef{48})
+	_, ok = c.fetch(msA)
+	testutil.Assert(t, !ok)
+	ps, ok = c.fetch(msC)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, []storage.SeriesRef{48}, ps)
+
+	testutil.Equals(t, 6.0, promtestutil.ToFloat64(requests))
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(hits))
+
+	// Blocks without cache don't cache anything.
+	var nilCache *postingsForMatchersCache
+	nilCache.store(msA, []storage.SeriesRef{16})
+	_, ok = nilCache.fetch(msA)
+	testutil.Assert(t, !ok)
+}
+
+func TestBucketStore_PostingsForMatchersCache(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	series := []labels.Labels{labels.FromStrings("a", "1", "b", "1"), labels.FromStrings("a", "1", "b", "2"), labels.FromStrings("a", "2", "b", "1")}
+	id, err := e2eutil.CreateBlock(ctx, dir, series, 10, 0, 1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, block.NewConcurrentLister(logger, bkt), "", nil, nil)
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	bucketStore, err := NewBucketStore(
+		bkt,
+		metaFetcher,
+		t.TempDir(),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewBytesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithFilterConfig(allowAllFilterConf),
+		WithRegistry(reg),
+		WithPostingsForMatchersCache(time.Hour, 10),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bucketStore.Close()) }()
+	testutil.Ok(t, bucketStore.SyncBlocks(ctx))
+
+	for i := 0; i < 3; i++ {
+		srv := storetestutil.NewSeriesServer(ctx)
+		testutil.Ok(t, bucketStore.Series(&storepb.SeriesRequest{
+			MinTime:  0,
+			MaxTime:  1000,
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+		}, srv))
+		testutil.Equals(t, 2, len(srv.SeriesSet))
+	}
+	testutil.Equals(t, 3.0, promtestutil.ToFloat64(bucketStore.metrics.postingsForMatchersCacheRequests.WithLabelValues("0s")))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(bucketStore.metrics.postingsForMatchersCacheHits.WithLabelValues("0s")))
+}
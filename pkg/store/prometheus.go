@@ -145,6 +145,9 @@ func (p *PrometheusStore) putBuffer(b *[]byte) {
 
 // Series returns all series for a requested time range and label matcher.
 func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Store_SeriesServer) error {
+	if r.SeriesStatsOnly {
+		return serveSeriesStats(r, seriesSrv, p.Series)
+	}
 	s := newFlushableServer(seriesSrv, sortingStrategyStore)
 
 	extLset := p.externalLabelsFn()
@@ -171,6 +174,10 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Sto
 		extLsetToRemove[lbl] = struct{}{}
 	}
 
+	// Series are filtered by shard here, as the sidecar advertises sharding support.
+	shardMatcher := r.ShardInfo.Matcher(&p.buffers)
+	defer shardMatcher.Close()
+
 	if r.SkipChunks {
 		finalExtLset := rmLabels(extLset.Copy(), extLsetToRemove)
 		labelMaps, err := p.client.SeriesInGRPC(s.Context(), p.base, matchers, r.MinTime, r.MaxTime)
@@ -187,7 +194,11 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Sto
 			finalExtLset.Range(func(l labels.Label) {
 				b.Set(l.Name, l.Value)
 			})
-			lset := labelpb.ZLabelsFromPromLabels(b.Labels())
+			completeLabelset := b.Labels()
+			if !shardMatcher.MatchesLabels(completeLabelset) {
+				continue
+			}
+			lset := labelpb.ZLabelsFromPromLabels(completeLabelset)
 			if err = s.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: lset})); err != nil {
 				return err
 			}
@@ -195,9 +206,6 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Sto
 		return s.Flush()
 	}
 
-	shardMatcher := r.ShardInfo.Matcher(&p.buffers)
-	defer shardMatcher.Close()
-
 	q := &prompb.Query{StartTimestampMs: r.MinTime, EndTimestampMs: r.MaxTime}
 	for _, m := range matchers {
 		pm := &prompb.LabelMatcher{Name: m.Name, Value: m.Value}
@@ -230,7 +238,7 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Sto
 	// remote read.
 	contentType := httpResp.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/x-protobuf") {
-		return p.handleSampledPrometheusResponse(s, httpResp, queryPrometheusSpan, extLset, enableChunkHashCalculation, extLsetToRemove)
+		return p.handleSampledPrometheusResponse(s, shardMatcher, httpResp, queryPrometheusSpan, extLset, enableChunkHashCalculation, extLsetToRemove)
 	}
 
 	if !strings.HasPrefix(contentType, "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse") {
@@ -241,6 +249,7 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Sto
 
 func (p *PrometheusStore) handleSampledPrometheusResponse(
 	s flushableServer,
+	shardMatcher *storepb.ShardMatcher,
 	httpResp *http.Response,
 	querySpan tracing.Span,
 	extLset labels.Labels,
@@ -276,6 +285,9 @@ func (p *PrometheusStore) handleSampledPrometheusResponse(
 			)
 			continue
 		}
+		if !shardMatcher.MatchesLabels(lset) {
+			continue
+		}
 
 		aggregatedChunks, err := p.chunkSamples(e, MaxSamplesPerChunk, calculateChecksums)
 		if err != nil {
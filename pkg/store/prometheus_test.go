@@ -5,8 +5,11 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -14,6 +17,8 @@ import (
 
 	"github.com/cespare/xxhash"
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
@@ -26,6 +31,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/promclient"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 	"github.com/thanos-io/thanos/pkg/testutil/custom"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
@@ -405,6 +411,72 @@ func TestPrometheusStore_Series_MatchExternalLabel(t *testing.T) {
 	testutil.Equals(t, 0, len(srv.SeriesSet))
 }
 
+// TestPrometheusStore_Series_ShardInfo checks that the sidecar, which advertises sharding support, only sends the
+// series of the requested shard, whatever the type of the remote read response.
+func TestPrometheusStore_Series_ShardInfo(t *testing.T) {
+	var series []map[string]string
+	readResp := &prompb.ReadResponse{Results: []*prompb.QueryResult{{}}}
+	for i := 0; i < 20; i++ {
+		lbls := map[string]string{"__name__": "up", "instance": fmt.Sprintf("%d", i)}
+		series = append(series, lbls)
+		readResp.Results[0].Timeseries = append(readResp.Results[0].Timeseries, &prompb.TimeSeries{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromMap(lbls)),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/series":
+			w.Header().Set("Content-Type", "application/json")
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "data": series}))
+		case "/api/v1/read":
+			b, err := proto.Marshal(readResp)
+			testutil.Ok(t, err)
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			_, err = w.Write(snappy.Encode(nil, b))
+			testutil.Ok(t, err)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar,
+		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
+		func() (int64, int64) { return 0, math.MaxInt64 },
+		nil)
+	testutil.Ok(t, err)
+
+	for _, skipChunks := range []bool{false, true} {
+		t.Run(fmt.Sprintf("skipChunks=%v", skipChunks), func(t *testing.T) {
+			seen := map[string]struct{}{}
+			for shard := int64(0); shard < 3; shard++ {
+				shardInfo := &storepb.ShardInfo{ShardIndex: shard, TotalShards: 3, By: true, Labels: []string{"instance"}}
+				s := newStoreSeriesServer(context.Background())
+				testutil.Ok(t, proxy.Series(&storepb.SeriesRequest{
+					MinTime:    0,
+					MaxTime:    100,
+					Matchers:   []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+					SkipChunks: skipChunks,
+					ShardInfo:  shardInfo,
+				}, s))
+
+				matcher := shardInfo.Matcher(&proxy.buffers)
+				for _, series := range s.SeriesSet {
+					lset := labelpb.ZLabelsToPromLabels(series.Labels)
+					testutil.Assert(t, matcher.MatchesLabels(lset), "series %v not of shard %d", lset, shard)
+					seen[lset.String()] = struct{}{}
+				}
+				matcher.Close()
+			}
+			// All the series are sent, by exactly one shard.
+			testutil.Equals(t, 20, len(seen))
+		})
+	}
+}
+
 func TestPrometheusStore_Series_ChunkHashCalculation_Integration(t *testing.T) {
 	defer custom.TolerantVerifyLeak(t)
 
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -27,7 +28,6 @@ import (
 	"github.com/thanos-io/thanos/pkg/info/infopb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
-	"github.com/thanos-io/thanos/pkg/strutil"
 	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
@@ -65,6 +65,10 @@ type Client interface {
 	// and sorted response is supported by the underlying store.
 	SupportsWithoutReplicaLabels() bool
 
+	// SupportsTimeFiltering returns true if the underlying store only returns
+	// samples within the requested time range.
+	SupportsTimeFiltering() bool
+
 	// String returns the string representation of the store client.
 	String() string
 
@@ -86,10 +90,14 @@ type ProxyStore struct {
 	retrievalStrategy RetrievalStrategy
 	debugLogging      bool
 	tsdbSelector      *TSDBSelector
+
+	responseValidationMode ResponseValidationMode
+	labelsLimit            int
 }
 
 type proxyStoreMetrics struct {
 	emptyStreamResponses prometheus.Counter
+	invalidSeries        *prometheus.CounterVec
 }
 
 func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
@@ -99,6 +107,10 @@ func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
 		Name: "thanos_proxy_store_empty_stream_responses_total",
 		Help: "Total number of empty responses received.",
 	})
+	m.invalidSeries = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_invalid_series_total",
+		Help: "Total number of invalid series the stores responded with, by store and reason, when validating responses.",
+	}, []string{"store", "reason"})
 
 	return &m
 }
@@ -126,6 +138,24 @@ func WithTSDBSelector(selector *TSDBSelector) ProxyStoreOption {
 	}
 }
 
+// WithResponseValidation sets the mode of validation of the series the stores respond with. Series with chunks that
+// can't be decoded, with duplicate timestamps or out of order samples, and counters with negative or NaN samples, are
+// either dropped or fail the requests. Series aren't validated by default.
+func WithResponseValidation(mode ResponseValidationMode) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.responseValidationMode = mode
+	}
+}
+
+// WithLabelsLimit sets the maximum number of label names or values returned for a single LabelNames or LabelValues
+// request. Once the limit is reached, the stores which didn't respond yet are canceled and the truncated result is
+// returned with a warning. Zero or a negative limit disables it.
+func WithLabelsLimit(limit int) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.labelsLimit = limit
+	}
+}
+
 // NewProxyStore returns a new ProxyStore that uses the given clients that implements storeAPI to fan-in all series to the client.
 // Note that there is no deduplication support. Deduplication should be done on the highest level (just before PromQL).
 func NewProxyStore(
@@ -284,6 +314,19 @@ func (s *ProxyStore) TSDBInfos() []infopb.TSDBInfo {
 	return infos
 }
 
+// SupportsTimeFiltering returns true if all the stores selected by the proxy only return samples
+// within the requested time range, so that the proxy gives the same guarantee.
+func (s *ProxyStore) SupportsTimeFiltering() bool {
+	stores := s.stores()
+	for _, st := range stores {
+		matches, _ := s.tsdbSelector.MatchLabelSets(st.LabelSets()...)
+		if matches && !st.SupportsTimeFiltering() {
+			return false
+		}
+	}
+	return len(stores) > 0
+}
+
 func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
 	// TODO(bwplotka): This should be part of request logger, otherwise it does not make much sense. Also, could be
 	// tiggered by tracing span to reduce cognitive load.
@@ -304,6 +347,14 @@ func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.
 		return status.Error(codes.InvalidArgument, errors.New("no matchers specified (excluding selector labels)").Error())
 	}
 
+	// Stats of the stores are aggregated. Stores not supporting series_stats_only send series without chunks,
+	// which are counted instead.
+	var statsSrv *seriesStatsServer
+	if originalRequest.SeriesStatsOnly {
+		statsSrv = newSeriesStatsServer(srv)
+		srv = statsSrv
+	}
+
 	// We may arrive here either via the promql engine
 	// or as a result of a grpc call in layered queries
 	ctx := srv.Context()
@@ -330,14 +381,22 @@ func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.
 		Matchers:                append(storeMatchers, MatchersForLabelSets(storeLabelSets)...),
 		Aggregates:              originalRequest.Aggregates,
 		MaxResolutionWindow:     originalRequest.MaxResolutionWindow,
-		SkipChunks:              originalRequest.SkipChunks,
+		SkipChunks:              originalRequest.SkipChunks || originalRequest.SeriesStatsOnly,
 		QueryHints:              originalRequest.QueryHints,
 		PartialResponseDisabled: originalRequest.PartialResponseDisabled,
 		PartialResponseStrategy: originalRequest.PartialResponseStrategy,
 		ShardInfo:               originalRequest.ShardInfo,
 		WithoutReplicaLabels:    originalRequest.WithoutReplicaLabels,
+		SeriesStatsOnly:         originalRequest.SeriesStatsOnly,
+		AggregationHint:         originalRequest.AggregationHint,
 	}
 
+	validation := &responseValidation{
+		logger:  reqLogger,
+		mode:    s.responseValidationMode,
+		warn:    !r.PartialResponseDisabled && r.PartialResponseStrategy != storepb.PartialResponseStrategy_ABORT,
+		metrics: s.metrics,
+	}
 	storeResponses := make([]respSet, 0, len(stores))
 	for _, st := range stores {
 		st := st
@@ -356,7 +415,11 @@ func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.
 			}
 		}
 
-		storeResponses = append(storeResponses, respSet)
+		storeID, storeAddr, isLocalStore := storeInfo(st)
+		if isLocalStore {
+			storeAddr = storeID
+		}
+		storeResponses = append(storeResponses, newValidatingRespSet(respSet, validation, storeAddr))
 		defer respSet.Close()
 	}
 
@@ -364,6 +427,9 @@ func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.
 
 	respHeap := NewResponseDeduplicator(NewProxyResponseLoserTree(storeResponses...))
 	for respHeap.Next() {
+		if err := validation.Err(); err != nil {
+			return status.Error(codes.Aborted, err.Error())
+		}
 		resp := respHeap.At()
 
 		if resp.GetWarning() != "" && (r.PartialResponseDisabled || r.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT) {
@@ -374,7 +440,13 @@ func (s *ProxyStore) Series(originalRequest *storepb.SeriesRequest, srv storepb.
 			return status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
 		}
 	}
+	if err := validation.Err(); err != nil {
+		return status.Error(codes.Aborted, err.Error())
+	}
 
+	if statsSrv != nil {
+		return statsSrv.sendStats()
+	}
 	return nil
 }
 
@@ -421,52 +493,22 @@ func (s *ProxyStore) LabelNames(ctx context.Context, originalRequest *storepb.La
 		WithoutReplicaLabels:    originalRequest.WithoutReplicaLabels,
 	}
 
-	var (
-		warnings []string
-		names    [][]string
-		mtx      sync.Mutex
-		g, gctx  = errgroup.WithContext(ctx)
-	)
-	for _, st := range stores {
-		st := st
-
-		storeID, storeAddr, isLocalStore := storeInfo(st)
-		g.Go(func() error {
-			span, spanCtx := tracing.StartSpan(gctx, "proxy.label_names", tracing.Tags{
-				"store.id":       storeID,
-				"store.addr":     storeAddr,
-				"store.is_local": isLocalStore,
-			})
-			defer span.Finish()
-			resp, err := st.LabelNames(spanCtx, r)
+	level.Debug(reqLogger).Log("msg", "LabelNames: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
+	names, warnings, err := s.labelsFanout(ctx, stores, r.PartialResponseDisabled, "proxy.label_names", "label names",
+		func(ctx context.Context, st Client) ([]string, []string, error) {
+			resp, err := st.LabelNames(ctx, r)
 			if err != nil {
-				err = errors.Wrapf(err, "fetch label names from store %s", st)
-				if r.PartialResponseDisabled {
-					return err
-				}
-
-				mtx.Lock()
-				warnings = append(warnings, err.Error())
-				mtx.Unlock()
-				return nil
+				return nil, nil, err
 			}
-
-			mtx.Lock()
-			warnings = append(warnings, resp.Warnings...)
-			names = append(names, resp.Names)
-			mtx.Unlock()
-
-			return nil
-		})
-	}
-	level.Debug(reqLogger).Log("msg", "LabelNames: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
-
-	if err := g.Wait(); err != nil {
+			return resp.Names, resp.Warnings, nil
+		},
+	)
+	if err != nil {
 		return nil, err
 	}
 
 	return &storepb.LabelNamesResponse{
-		Names:    strutil.MergeUnsortedSlices(names...),
+		Names:    names,
 		Warnings: warnings,
 	}, nil
 }
@@ -522,10 +564,48 @@ func (s *ProxyStore) LabelValues(ctx context.Context, originalRequest *storepb.L
 		WithoutReplicaLabels:    originalRequest.WithoutReplicaLabels,
 	}
 
+	level.Debug(reqLogger).Log("msg", "LabelValues: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
+	values, warnings, err := s.labelsFanout(ctx, stores, r.PartialResponseDisabled, "proxy.label_values", "label values",
+		func(ctx context.Context, st Client) ([]string, []string, error) {
+			resp, err := st.LabelValues(ctx, r)
+			if err != nil {
+				return nil, nil, err
+			}
+			return resp.Values, resp.Warnings, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storepb.LabelValuesResponse{
+		Values:   values,
+		Warnings: warnings,
+	}, nil
+}
+
+// labelsFanout fetches label names or values from all the given stores concurrently and merges them as the stores
+// respond. Every store is given the response timeout of the proxy, if any.
+// With partial response enabled the failure of a store is isolated: it is turned into a warning and the responses
+// of the other stores are still merged. Otherwise the first failure cancels the other stores and is returned.
+// Once the labels limit is reached, the stores which didn't respond yet are canceled and the sorted result is
+// truncated to the limit, with a warning.
+func (s *ProxyStore) labelsFanout(
+	ctx context.Context,
+	stores []Client,
+	partialResponseDisabled bool,
+	spanName, what string,
+	fetch func(ctx context.Context, st Client) (values []string, warnings []string, err error),
+) ([]string, []string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var (
-		warnings []string
-		all      [][]string
 		mtx      sync.Mutex
+		warnings []string
+		merged   = map[string]struct{}{}
+		limited  bool
+		pending  = len(stores)
 		g, gctx  = errgroup.WithContext(ctx)
 	)
 	for _, st := range stores {
@@ -533,44 +613,73 @@ func (s *ProxyStore) LabelValues(ctx context.Context, originalRequest *storepb.L
 
 		storeID, storeAddr, isLocalStore := storeInfo(st)
 		g.Go(func() error {
-			span, spanCtx := tracing.StartSpan(gctx, "proxy.label_values", tracing.Tags{
+			span, spanCtx := tracing.StartSpan(gctx, spanName, tracing.Tags{
 				"store.id":       storeID,
 				"store.addr":     storeAddr,
 				"store.is_local": isLocalStore,
 			})
 			defer span.Finish()
 
-			resp, err := st.LabelValues(spanCtx, r)
+			if s.responseTimeout > 0 {
+				var cancel context.CancelFunc
+				spanCtx, cancel = context.WithTimeout(spanCtx, s.responseTimeout)
+				defer cancel()
+			}
+
+			values, warns, err := fetch(spanCtx, st)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			pending--
+			if limited {
+				// The store was canceled, or responded too late, after the limit was reached.
+				return nil
+			}
 			if err != nil {
-				err = errors.Wrapf(err, "fetch label values from store %s", st)
-				if r.PartialResponseDisabled {
+				if errors.Is(spanCtx.Err(), context.DeadlineExceeded) && gctx.Err() == nil {
+					err = errors.Wrapf(err, "failed to receive any data in %s from %s", s.responseTimeout, st)
+				}
+				err = errors.Wrapf(err, "fetch %s from store %s", what, st)
+				if partialResponseDisabled {
 					return err
 				}
-
-				mtx.Lock()
 				warnings = append(warnings, err.Error())
-				mtx.Unlock()
 				return nil
 			}
 
-			mtx.Lock()
-			warnings = append(warnings, resp.Warnings...)
-			all = append(all, resp.Values)
-			mtx.Unlock()
-
+			warnings = append(warnings, warns...)
+			for _, v := range values {
+				merged[v] = struct{}{}
+			}
+			if s.labelsLimit > 0 && (len(merged) > s.labelsLimit || len(merged) == s.labelsLimit && pending > 0) {
+				limited = true
+				cancel()
+			}
 			return nil
 		})
 	}
-	level.Debug(reqLogger).Log("msg", "LabelValues: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
 
 	if err := g.Wait(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return &storepb.LabelValuesResponse{
-		Values:   strutil.MergeUnsortedSlices(all...),
-		Warnings: warnings,
-	}, nil
+	if len(merged) == 0 {
+		return nil, warnings, nil
+	}
+	result := make([]string, 0, len(merged))
+	for v := range merged {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+
+	if limited {
+		if len(result) > s.labelsLimit {
+			result = result[:s.labelsLimit]
+		}
+		warnings = append(warnings, fmt.Sprintf("%s truncated to the limit of %d", what, s.labelsLimit))
+	}
+	return result, warnings, nil
 }
 
 func storeInfo(st Client) (storeID string, storeAddr string, isLocalStore bool) {
@@ -157,6 +157,16 @@ func (d *responseDeduplicator) At() *storepb.SeriesResponse {
 	return d.bufferedResp[d.buffRespI]
 }
 
+// Sources returns the responses the current response was merged from, or the current response itself if it is not a
+// series.
+func (d *responseDeduplicator) Sources() []*storepb.SeriesResponse {
+	at := d.At()
+	if at.GetSeries() == nil {
+		return []*storepb.SeriesResponse{at}
+	}
+	return d.bufferedSameSeries
+}
+
 // NewProxyResponseLoserTree returns heap that k-way merge series together.
 // It's agnostic to duplicates and overlaps, it forwards all duplicated series in random order.
 func NewProxyResponseLoserTree(seriesSets ...respSet) *losertree.Tree[*storepb.SeriesResponse, respSet] {
@@ -11,6 +11,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -108,6 +109,24 @@ func TestProxyStore_TSDBInfos(t *testing.T) {
 	testutil.Equals(t, expected, q.TSDBInfos())
 }
 
+func TestProxyStore_SupportsTimeFiltering(t *testing.T) {
+	var stores []Client
+	q := NewProxyStore(nil, nil,
+		func() []Client { return stores },
+		component.Query, labels.EmptyLabels(), 0*time.Second, EagerRetrieval,
+	)
+	testutil.Assert(t, !q.SupportsTimeFiltering())
+
+	stores = []Client{
+		&storetestutil.TestClient{TimeFilteringEnabled: true},
+		&storetestutil.TestClient{TimeFilteringEnabled: true},
+	}
+	testutil.Assert(t, q.SupportsTimeFiltering())
+
+	stores = append(stores, &storetestutil.TestClient{})
+	testutil.Assert(t, !q.SupportsTimeFiltering())
+}
+
 func TestProxyStore_Series(t *testing.T) {
 	defer custom.TolerantVerifyLeak(t)
 
@@ -1682,6 +1701,97 @@ func TestProxyStore_LabelNames(t *testing.T) {
 	}
 }
 
+func TestProxyStore_LabelsFanout(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	newStores := func() []Client {
+		return []Client{
+			&storetestutil.TestClient{
+				StoreClient: &mockedStoreAPI{
+					RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"c", "a"}},
+					RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"3", "1"}},
+				},
+				Name: "fast",
+			},
+			&storetestutil.TestClient{
+				StoreClient: &mockedStoreAPI{
+					RespError: errors.New("error!"),
+				},
+				Name: "failing",
+			},
+			&storetestutil.TestClient{
+				StoreClient: &mockedStoreAPI{
+					RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"b"}},
+					RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"2"}},
+					RespDuration:    10 * time.Second,
+				},
+				Name: "slow",
+			},
+		}
+	}
+	namesReq := func(partialResponseDisabled bool) *storepb.LabelNamesRequest {
+		return &storepb.LabelNamesRequest{
+			Start:                   timestamp.FromTime(minTime),
+			End:                     timestamp.FromTime(maxTime),
+			PartialResponseDisabled: partialResponseDisabled,
+		}
+	}
+	valuesReq := &storepb.LabelValuesRequest{
+		Label: "a",
+		Start: timestamp.FromTime(minTime),
+		End:   timestamp.FromTime(maxTime),
+	}
+
+	t.Run("failures isolated with partial response", func(t *testing.T) {
+		stores := newStores()
+		q := NewProxyStore(nil, nil, func() []Client { return stores }, component.Query, labels.EmptyLabels(), 100*time.Millisecond, EagerRetrieval)
+
+		resp, err := q.LabelNames(context.Background(), namesReq(false))
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "c"}, resp.Names)
+		sort.Strings(resp.Warnings)
+		testutil.Equals(t, []string{
+			"fetch label names from store failing: error!",
+			"fetch label names from store slow: failed to receive any data in 100ms from slow: context deadline exceeded",
+		}, resp.Warnings)
+
+		vresp, err := q.LabelValues(context.Background(), valuesReq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"1", "3"}, vresp.Values)
+		testutil.Equals(t, 2, len(vresp.Warnings))
+	})
+	t.Run("timeout fails the request without partial response", func(t *testing.T) {
+		stores := newStores()
+		stores = append(stores[:1], stores[2])
+		q := NewProxyStore(nil, nil, func() []Client { return stores }, component.Query, labels.EmptyLabels(), 100*time.Millisecond, EagerRetrieval)
+
+		_, err := q.LabelNames(context.Background(), namesReq(true))
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "fetch label names from store slow: failed to receive any data in 100ms from slow: context deadline exceeded", err.Error())
+	})
+	t.Run("limit reached", func(t *testing.T) {
+		stores := newStores()
+		q := NewProxyStore(nil, nil, func() []Client { return stores }, component.Query, labels.EmptyLabels(), 0, EagerRetrieval, WithLabelsLimit(1))
+
+		// The slow store is not waited for once the limit is reached.
+		start := time.Now()
+		resp, err := q.LabelNames(context.Background(), namesReq(false))
+		testutil.Ok(t, err)
+		testutil.Assert(t, time.Since(start) < 5*time.Second, "slow store was waited for")
+		testutil.Equals(t, []string{"a"}, resp.Names)
+		testutil.Assert(t, len(resp.Warnings) > 0 && resp.Warnings[len(resp.Warnings)-1] == "label names truncated to the limit of 1", "got %v", resp.Warnings)
+	})
+	t.Run("limit not reached", func(t *testing.T) {
+		stores := newStores()[:1]
+		q := NewProxyStore(nil, nil, func() []Client { return stores }, component.Query, labels.EmptyLabels(), 0, EagerRetrieval, WithLabelsLimit(2))
+
+		resp, err := q.LabelValues(context.Background(), valuesReq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"1", "3"}, resp.Values)
+		testutil.Equals(t, 0, len(resp.Warnings))
+	})
+}
+
 type rawSeries struct {
 	lset   labels.Labels
 	chunks [][]sample
@@ -1922,18 +2032,36 @@ func (s *mockedStoreAPI) Series(ctx context.Context, req *storepb.SeriesRequest,
 	return &storetestutil.StoreSeriesClient{InjectedErrorIndex: s.injectedErrorIndex, InjectedError: s.injectedError, Ctx: ctx, RespSet: s.RespSeries, RespDur: s.RespDuration, SlowSeriesIndex: s.SlowSeriesIndex}, s.RespError
 }
 
-func (s *mockedStoreAPI) LabelNames(_ context.Context, req *storepb.LabelNamesRequest, _ ...grpc.CallOption) (*storepb.LabelNamesResponse, error) {
+func (s *mockedStoreAPI) LabelNames(ctx context.Context, req *storepb.LabelNamesRequest, _ ...grpc.CallOption) (*storepb.LabelNamesResponse, error) {
 	s.LastLabelNamesReq = req
+	if err := s.waitRespDuration(ctx); err != nil {
+		return nil, err
+	}
 
 	return s.RespLabelNames, s.RespError
 }
 
-func (s *mockedStoreAPI) LabelValues(_ context.Context, req *storepb.LabelValuesRequest, _ ...grpc.CallOption) (*storepb.LabelValuesResponse, error) {
+func (s *mockedStoreAPI) LabelValues(ctx context.Context, req *storepb.LabelValuesRequest, _ ...grpc.CallOption) (*storepb.LabelValuesResponse, error) {
 	s.LastLabelValuesReq = req
+	if err := s.waitRespDuration(ctx); err != nil {
+		return nil, err
+	}
 
 	return s.RespLabelValues, s.RespError
 }
 
+func (s *mockedStoreAPI) waitRespDuration(ctx context.Context) error {
+	if s.RespDuration <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.RespDuration):
+		return nil
+	}
+}
+
 // storeSeriesResponse creates test storepb.SeriesResponse that includes series with single chunk that stores all the given samples.
 func storeSeriesResponse(t testing.TB, lset labels.Labels, smplChunks ...[]sample) *storepb.SeriesResponse {
 	var s storepb.Series
@@ -0,0 +1,171 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"math"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// ResponseValidationMode is the mode of validation of the series the stores proxied by a ProxyStore respond with.
+type ResponseValidationMode string
+
+const (
+	// NoResponseValidation doesn't validate the series of the stores.
+	NoResponseValidation ResponseValidationMode = "none"
+	// DropResponseValidation drops the invalid series of the stores, with a warning if partial responses are enabled.
+	DropResponseValidation ResponseValidationMode = "drop"
+	// StrictResponseValidation fails the requests for which stores respond with invalid series.
+	StrictResponseValidation ResponseValidationMode = "strict"
+)
+
+const (
+	invalidSeriesCorruptedChunk      = "corrupted_chunk"
+	invalidSeriesDuplicateTimestamps = "duplicate_timestamp"
+	invalidSeriesOutOfOrderSamples   = "out_of_order"
+	invalidSeriesNegativeCounter     = "negative_counter"
+	invalidSeriesNaNCounter          = "nan_counter"
+)
+
+// validateSeries returns the reason why the given series is invalid, or an empty string if it's valid. Series are
+// invalid if their chunks can't be decoded, or if their chunks have duplicate timestamps or out of order samples.
+// Counters, i.e. series whose name ends with _total, are invalid if they have negative or NaN samples, except for
+// staleness markers.
+func validateSeries(s *storepb.Series) string {
+	isCounter := strings.HasSuffix(labelpb.ZLabelsToPromLabels(s.Labels).Get(labels.MetricName), "_total")
+	var it chunkenc.Iterator
+	for _, c := range s.Chunks {
+		for i, chk := range []*storepb.Chunk{c.Raw, c.Count, c.Sum, c.Min, c.Max, c.Counter} {
+			if chk == nil {
+				continue
+			}
+			if reason := validateChunk(chk, isCounter && i == 0, &it); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+func validateChunk(c *storepb.Chunk, isCounter bool, it *chunkenc.Iterator) string {
+	enc, ok := chunkEncodings[c.Type]
+	// Chunks start with their number of samples on 2 bytes.
+	if !ok || len(c.Data) < 2 {
+		return invalidSeriesCorruptedChunk
+	}
+	chk, err := chunkenc.FromData(enc, c.Data)
+	if err != nil {
+		return invalidSeriesCorruptedChunk
+	}
+	*it = chk.Iterator(*it)
+
+	prevT := int64(math.MinInt64)
+	for vt := (*it).Next(); vt != chunkenc.ValNone; vt = (*it).Next() {
+		t := (*it).AtT()
+		if t == prevT {
+			return invalidSeriesDuplicateTimestamps
+		}
+		if t < prevT {
+			return invalidSeriesOutOfOrderSamples
+		}
+		prevT = t
+
+		if !isCounter || vt != chunkenc.ValFloat {
+			continue
+		}
+		_, v := (*it).At()
+		if v < 0 {
+			return invalidSeriesNegativeCounter
+		}
+		if math.IsNaN(v) && !value.IsStaleNaN(v) {
+			return invalidSeriesNaNCounter
+		}
+	}
+	if (*it).Err() != nil {
+		return invalidSeriesCorruptedChunk
+	}
+	return ""
+}
+
+var chunkEncodings = map[storepb.Chunk_Encoding]chunkenc.Encoding{
+	storepb.Chunk_XOR:             chunkenc.EncXOR,
+	storepb.Chunk_HISTOGRAM:       chunkenc.EncHistogram,
+	storepb.Chunk_FLOAT_HISTOGRAM: chunkenc.EncFloatHistogram,
+}
+
+// responseValidation holds the state of the validation of the series of all the stores of a single Series request.
+type responseValidation struct {
+	logger log.Logger
+	mode   ResponseValidationMode
+	warn   bool
+
+	metrics *proxyStoreMetrics
+	err     error
+}
+
+// Err returns the error of the first invalid series in strict mode, if any.
+func (v *responseValidation) Err() error {
+	return v.err
+}
+
+// validatingRespSet is a respSet validating the series of a single store.
+type validatingRespSet struct {
+	respSet
+
+	v     *responseValidation
+	store string
+	cur   *storepb.SeriesResponse
+}
+
+func newValidatingRespSet(set respSet, v *responseValidation, store string) respSet {
+	if v.mode == NoResponseValidation || v.mode == "" {
+		return set
+	}
+	return &validatingRespSet{respSet: set, v: v, store: store}
+}
+
+func (l *validatingRespSet) Next() bool {
+	for l.v.err == nil && l.respSet.Next() {
+		resp := l.respSet.At()
+		s := resp.GetSeries()
+		if s == nil {
+			l.cur = resp
+			return true
+		}
+		reason := validateSeries(s)
+		if reason == "" {
+			l.cur = resp
+			return true
+		}
+
+		lset := labelpb.ZLabelsToPromLabels(s.Labels)
+		l.v.metrics.invalidSeries.WithLabelValues(l.store, reason).Inc()
+		level.Warn(l.v.logger).Log("msg", "store responded with invalid series", "store", l.store, "series", lset.String(), "reason", reason)
+		err := errors.Errorf("store %s responded with invalid series %s: %s", l.store, lset.String(), reason)
+		if l.v.mode == StrictResponseValidation {
+			l.v.err = err
+			break
+		}
+		if l.v.warn {
+			l.cur = storepb.NewWarnSeriesResponse(errors.Wrap(err, "dropped series"))
+			return true
+		}
+	}
+	l.cur = nil
+	return false
+}
+
+func (l *validatingRespSet) At() *storepb.SeriesResponse {
+	return l.cur
+}
@@ -0,0 +1,110 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/custom"
+)
+
+func TestValidateSeries(t *testing.T) {
+	staleNaN := math.Float64frombits(value.StaleNaN)
+	for _, tc := range []struct {
+		lset     labels.Labels
+		samples  [][]sample
+		expected string
+	}{
+		{lset: labels.FromStrings("__name__", "up"), samples: [][]sample{{{0, 1}, {1, -1}, {2, math.NaN()}}, {{0, 0}}}},
+		{lset: labels.FromStrings("__name__", "up"), samples: [][]sample{{{0, 1}, {1, 1}, {1, 1}}}, expected: invalidSeriesDuplicateTimestamps},
+		{lset: labels.FromStrings("__name__", "up"), samples: [][]sample{{{0, 1}}, {{2, 1}, {1, 1}}}, expected: invalidSeriesOutOfOrderSamples},
+		{lset: labels.FromStrings("__name__", "requests_total"), samples: [][]sample{{{0, 1}, {1, 0}, {2, staleNaN}}}},
+		{lset: labels.FromStrings("__name__", "requests_total"), samples: [][]sample{{{0, 1}, {1, -1}}}, expected: invalidSeriesNegativeCounter},
+		{lset: labels.FromStrings("__name__", "requests_total"), samples: [][]sample{{{0, 1}, {1, math.NaN()}}}, expected: invalidSeriesNaNCounter},
+	} {
+		testutil.Equals(t, tc.expected, validateSeries(storeSeriesResponse(t, tc.lset, tc.samples...).GetSeries()), "%v", tc.lset)
+	}
+
+	s := storeSeriesResponse(t, labels.FromStrings("__name__", "up"), []sample{{0, 1}}).GetSeries()
+	s.Chunks[0].Raw.Data = []byte{0xff}
+	testutil.Equals(t, invalidSeriesCorruptedChunk, validateSeries(s))
+}
+
+func TestProxyStore_Series_ResponseValidation(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	cls := []Client{
+		&storetestutil.TestClient{
+			Name: "store-1",
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {1, 1}, {2, 2}}),
+					storeSeriesResponse(t, labels.FromStrings("a", "2"), []sample{{0, 0}, {2, 1}, {1, 2}}),
+					storeSeriesResponse(t, labels.FromStrings("a", "3"), []sample{{0, 0}, {1, 1}}),
+				},
+			},
+			MinTime: 0,
+			MaxTime: 300,
+		},
+	}
+
+	for _, tc := range []struct {
+		mode                   ResponseValidationMode
+		partialResponseEnabled bool
+
+		expectedSeries   int
+		expectedWarnings int
+		expectedErr      bool
+	}{
+		{mode: NoResponseValidation, expectedSeries: 3},
+		{mode: DropResponseValidation, partialResponseEnabled: true, expectedSeries: 2, expectedWarnings: 1},
+		{mode: DropResponseValidation, expectedSeries: 2},
+		{mode: StrictResponseValidation, partialResponseEnabled: true, expectedErr: true},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			q := NewProxyStore(log.NewNopLogger(), reg,
+				func() []Client { return cls },
+				component.Query,
+				labels.EmptyLabels(),
+				1*time.Second, EagerRetrieval,
+				WithResponseValidation(tc.mode),
+			)
+
+			s := newStoreSeriesServer(context.Background())
+			err := q.Series(&storepb.SeriesRequest{
+				MinTime:                 0,
+				MaxTime:                 300,
+				Matchers:                []storepb.LabelMatcher{{Name: "a", Value: ".+", Type: storepb.LabelMatcher_RE}},
+				PartialResponseDisabled: !tc.partialResponseEnabled,
+			}, s)
+			if tc.expectedErr {
+				testutil.NotOk(t, err)
+			} else {
+				testutil.Ok(t, err)
+				testutil.Equals(t, tc.expectedSeries, len(s.SeriesSet))
+				testutil.Equals(t, tc.expectedWarnings, len(s.Warnings))
+			}
+
+			expectedInvalid := 1.0
+			if tc.mode == NoResponseValidation {
+				expectedInvalid = 0
+			}
+			testutil.Equals(t, expectedInvalid, promtestutil.ToFloat64(q.metrics.invalidSeries.WithLabelValues("store-1", invalidSeriesOutOfOrderSamples)))
+		})
+	}
+}
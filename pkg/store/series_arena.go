@@ -0,0 +1,290 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/thanos-io/thanos/pkg/pool"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	labelsSlabSize     = 4096
+	aggrChunksSlabSize = 4096
+	chunkRefsSlabSize  = 4096
+	chunksSlabSize     = 4096
+)
+
+var (
+	labelsSlabPool     = sync.Pool{New: func() interface{} { s := make([]labels.Label, 0, labelsSlabSize); return &s }}
+	aggrChunksSlabPool = sync.Pool{New: func() interface{} { s := make([]storepb.AggrChunk, 0, aggrChunksSlabSize); return &s }}
+	chunkRefsSlabPool  = sync.Pool{New: func() interface{} { s := make([]chunks.ChunkRef, 0, chunkRefsSlabSize); return &s }}
+	chunksSlabPool     = sync.Pool{New: func() interface{} { s := make([]storepb.Chunk, 0, chunksSlabSize); return &s }}
+)
+
+// slabs allocates slices out of pooled slabs of fixed size, instead of doing an allocation per slice.
+// Slices are allocated on the heap if the pool is nil or if they are larger than a slab. The memory of both is
+// reserved from the quota until the slabs are released.
+type slabs[T any] struct {
+	pool     *sync.Pool
+	size     int
+	used     []*[]T
+	quota    *seriesMemoryQuota
+	reserved int
+}
+
+// alloc returns a slice of length and capacity n. Appending to it never overwrites other slices of the slabs.
+func (s *slabs[T]) alloc(n int) ([]T, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	var zero T
+	if s.pool == nil || n > s.size {
+		if err := s.reserve(n * int(unsafe.Sizeof(zero))); err != nil {
+			return nil, err
+		}
+		return make([]T, n), nil
+	}
+	if len(s.used) == 0 || cap(*s.used[len(s.used)-1])-len(*s.used[len(s.used)-1]) < n {
+		if err := s.reserve(s.size * int(unsafe.Sizeof(zero))); err != nil {
+			return nil, err
+		}
+		s.used = append(s.used, s.pool.Get().(*[]T))
+	}
+	slab := s.used[len(s.used)-1]
+	l := len(*slab)
+	*slab = (*slab)[:l+n]
+	return (*slab)[l : l+n : l+n], nil
+}
+
+func (s *slabs[T]) reserve(n int) error {
+	if err := s.quota.reserve(n); err != nil {
+		return err
+	}
+	s.reserved += n
+	return nil
+}
+
+// release hands the slabs back to the pool, and their memory back to the quota. Slices allocated from them must not
+// be used afterwards.
+func (s *slabs[T]) release() {
+	for _, slab := range s.used {
+		// Drop the references held by the slab, so that its elements are garbage collected while it sits in the pool.
+		clear(*slab)
+		*slab = (*slab)[:0]
+		s.pool.Put(slab)
+	}
+	s.used = nil
+	s.quota.release(s.reserved)
+	s.reserved = 0
+}
+
+// seriesArena holds the memory of a batch of series of a block: their label sets, chunk metadata and chunk payloads.
+// It is referenced by the batch until all its series were handed out, and by every series response tracked by
+// seriesResponseArenas, and hands its memory back to the pools once all of them released it or once it is freed.
+type seriesArena struct {
+	chunkPool pool.Bytes
+	quota     *seriesMemoryQuota
+
+	mtx        sync.Mutex
+	refs       int
+	labels     slabs[labels.Label]
+	aggrChunks slabs[storepb.AggrChunk]
+	chunkRefs  slabs[chunks.ChunkRef]
+	chunks     slabs[storepb.Chunk]
+	chunkBytes []*[]byte // Byte slices to return to the chunk pool.
+	// chunkBytesReserved is the capacity of chunkBytes, reserved from the quota.
+	chunkBytesReserved int
+}
+
+// newSeriesArena returns an arena with one reference, allocating chunk payloads out of chunkPool. If pooled is false,
+// label sets and chunk metadata are allocated on the heap, as they may outlive the arena. The memory of the arena is
+// reserved from the given quota, which may be nil, until it is freed.
+func newSeriesArena(chunkPool pool.Bytes, pooled bool, quota *seriesMemoryQuota) *seriesArena {
+	a := &seriesArena{
+		chunkPool:  chunkPool,
+		quota:      quota,
+		refs:       1,
+		labels:     slabs[labels.Label]{size: labelsSlabSize, quota: quota},
+		aggrChunks: slabs[storepb.AggrChunk]{size: aggrChunksSlabSize, quota: quota},
+		chunkRefs:  slabs[chunks.ChunkRef]{size: chunkRefsSlabSize, quota: quota},
+		chunks:     slabs[storepb.Chunk]{size: chunksSlabSize, quota: quota},
+	}
+	if pooled {
+		a.labels.pool = &labelsSlabPool
+		a.aggrChunks.pool = &aggrChunksSlabPool
+		a.chunkRefs.pool = &chunkRefsSlabPool
+		a.chunks.pool = &chunksSlabPool
+	}
+	return a
+}
+
+func (a *seriesArena) retain() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.refs++
+}
+
+// release releases a reference to the arena, freeing it once no reference is left.
+func (a *seriesArena) release() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.refs--
+	if a.refs == 0 {
+		a.freeLocked()
+	}
+}
+
+// free hands the memory of the arena back to the pools, regardless of its references. It is a no-op if the arena was
+// already freed.
+func (a *seriesArena) free() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.freeLocked()
+}
+
+func (a *seriesArena) freeLocked() {
+	a.labels.release()
+	a.aggrChunks.release()
+	a.chunkRefs.release()
+	a.chunks.release()
+	for _, b := range a.chunkBytes {
+		a.chunkPool.Put(b)
+	}
+	a.chunkBytes = nil
+	a.quota.release(a.chunkBytesReserved)
+	a.chunkBytesReserved = 0
+}
+
+// extendSortedLabels returns the sorted label set with the labels of extend added to lset, replacing the ones of
+// lset with the same name, like labelpb.ExtendSortedLabels.
+func (a *seriesArena) extendSortedLabels(lset, extend labels.Labels) (labels.Labels, error) {
+	a.mtx.Lock()
+	out, err := a.labels.alloc(len(lset) + len(extend))
+	a.mtx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out = out[:0]
+
+	i, j := 0, 0
+	for i < len(lset) && j < len(extend) {
+		switch {
+		case lset[i].Name < extend[j].Name:
+			out = append(out, lset[i])
+			i++
+		case lset[i].Name > extend[j].Name:
+			out = append(out, extend[j])
+			j++
+		default:
+			out = append(out, extend[j])
+			i++
+			j++
+		}
+	}
+	out = append(out, lset[i:]...)
+	out = append(out, extend[j:]...)
+	return out, nil
+}
+
+// chunkSlices returns empty chunk references and chunk metadata slices with capacity n.
+func (a *seriesArena) chunkSlices(n int) ([]chunks.ChunkRef, []storepb.AggrChunk, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	refs, err := a.chunkRefs.alloc(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	chks, err := a.aggrChunks.alloc(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return refs[:0], chks[:0], nil
+}
+
+// chunk returns a copy of c allocated in the arena.
+func (a *seriesArena) chunk(c storepb.Chunk) (*storepb.Chunk, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	s, err := a.chunks.alloc(1)
+	if err != nil {
+		return nil, err
+	}
+	s[0] = c
+	return &s[0], nil
+}
+
+// save copies b to a slab of the chunk pool, and returns the copy.
+func (a *seriesArena) save(b []byte) ([]byte, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	// Ensure we never grow slab beyond original capacity.
+	if len(a.chunkBytes) == 0 ||
+		cap(*a.chunkBytes[len(a.chunkBytes)-1])-len(*a.chunkBytes[len(a.chunkBytes)-1]) < len(b) {
+		s, err := a.chunkPool.Get(len(b))
+		if err != nil {
+			return nil, errors.Wrap(err, "allocate chunk bytes")
+		}
+		if err := a.quota.reserve(cap(*s)); err != nil {
+			a.chunkPool.Put(s)
+			return nil, err
+		}
+		a.chunkBytesReserved += cap(*s)
+		a.chunkBytes = append(a.chunkBytes, s)
+	}
+	slab := a.chunkBytes[len(a.chunkBytes)-1]
+	*slab = append(*slab, b...)
+	return (*slab)[len(*slab)-len(b):], nil
+}
+
+// seriesResponseArenas tracks the arenas the series responses of a Series call are allocated from, so that their
+// memory is released as soon as they are sent, instead of once the call is done.
+type seriesResponseArenas struct {
+	mtx    sync.Mutex
+	arenas map[*storepb.SeriesResponse]*seriesArena
+
+	released prometheus.Counter
+}
+
+// newSeriesResponseArenas returns a new seriesResponseArenas, counting the released responses with the given counter.
+func newSeriesResponseArenas(released prometheus.Counter) *seriesResponseArenas {
+	return &seriesResponseArenas{arenas: map[*storepb.SeriesResponse]*seriesArena{}, released: released}
+}
+
+// track records that resp is allocated from a, retaining a until resp is released. It is a no-op on a nil
+// seriesResponseArenas.
+func (r *seriesResponseArenas) track(resp *storepb.SeriesResponse, a *seriesArena) {
+	if r == nil {
+		return
+	}
+	a.retain()
+	r.mtx.Lock()
+	r.arenas[resp] = a
+	r.mtx.Unlock()
+}
+
+// release releases the arenas of the given responses, which must not be used afterwards. It is a no-op on a nil
+// seriesResponseArenas.
+func (r *seriesResponseArenas) release(resps ...*storepb.SeriesResponse) {
+	if r == nil {
+		return
+	}
+	for _, resp := range resps {
+		r.mtx.Lock()
+		a, ok := r.arenas[resp]
+		delete(r.arenas, resp)
+		r.mtx.Unlock()
+		if ok {
+			a.release()
+			r.released.Inc()
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/pool"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+func TestSeriesArena(t *testing.T) {
+	chunkPool := &mockedPool{parent: pool.NoopBytes{}}
+	a := newSeriesArena(chunkPool, true, nil)
+
+	lset, err := a.extendSortedLabels(labels.FromStrings("a", "1", "b", "2", "c", "3"), labels.FromStrings("b", "ext", "d", "ext"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, labels.FromStrings("a", "1", "b", "ext", "c", "3", "d", "ext"), lset)
+	lset, err = a.extendSortedLabels(labels.FromStrings("a", "1"), labels.EmptyLabels())
+	testutil.Ok(t, err)
+	testutil.Equals(t, labels.FromStrings("a", "1"), lset)
+
+	refs, chks, err := a.chunkSlices(2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(refs))
+	testutil.Equals(t, 2, cap(chks))
+	chks = append(chks, storepb.AggrChunk{MinTime: 1}, storepb.AggrChunk{MinTime: 2})
+	next, _, err := a.chunkSlices(1)
+	testutil.Ok(t, err)
+	next = append(next, 1)
+	testutil.Equals(t, int64(2), chks[1].MinTime, "allocations overlap")
+	testutil.Equals(t, 1, len(next))
+
+	b, err := a.save([]byte("chunk"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []byte("chunk"), b)
+	testutil.Assert(t, chunkPool.balance.Load() > 0)
+
+	released := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_released_total"})
+	responses := newSeriesResponseArenas(released)
+	r1, r2 := storepb.NewSeriesResponse(&storepb.Series{}), storepb.NewSeriesResponse(&storepb.Series{})
+	responses.track(r1, a)
+	responses.track(r2, a)
+	a.release()
+
+	responses.release(r1)
+	testutil.Assert(t, chunkPool.balance.Load() > 0, "arena freed before all its responses were released")
+	responses.release(r2)
+	testutil.Equals(t, uint64(0), chunkPool.balance.Load())
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(released))
+
+	// Releasing an untracked response, or freeing twice, is a no-op.
+	responses.release(r1)
+	a.free()
+	testutil.Equals(t, uint64(0), chunkPool.balance.Load())
+}
+
+// marshalingSeriesServer marshals the responses it is sent, like gRPC streams, without retaining them.
+type marshalingSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	ctx       context.Context
+	keep      bool
+	responses [][]byte
+}
+
+func (s *marshalingSeriesServer) Send(r *storepb.SeriesResponse) error {
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	if s.keep {
+		s.responses = append(s.responses, b)
+	}
+	return nil
+}
+
+func (s *marshalingSeriesServer) Context() context.Context {
+	return s.ctx
+}
+
+func newSeriesResponsePoolingTestStore(t testing.TB, blocks, series int, opts ...BucketStoreOption) *BucketStore {
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+	for i := 0; i < blocks; i++ {
+		// Blocks with the same data and external labels, whose series are merged.
+		uploadTestBlock(t, filepath.Join(tmpDir, fmt.Sprintf("%d", i)), bkt, series)
+	}
+
+	logger := log.NewNopLogger()
+	instrBkt := objstore.WithNoopInstr(bkt)
+	fetcher, err := block.NewRawMetaFetcher(logger, instrBkt, block.NewConcurrentLister(logger, instrBkt))
+	testutil.Ok(t, err)
+
+	chunkPool, err := pool.NewBucketedBytes(chunkBytesPoolMinSize, chunkBytesPoolMaxSize, 2, 1e9)
+	testutil.Ok(t, err)
+
+	store, err := NewBucketStore(
+		instrBkt,
+		fetcher,
+		tmpDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewBytesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		append([]BucketStoreOption{WithLogger(logger), WithChunkPool(chunkPool)}, opts...)...,
+	)
+	testutil.Ok(t, err)
+	testutil.Ok(t, store.SyncBlocks(context.Background()))
+	t.Cleanup(func() { testutil.Ok(t, store.Close()) })
+	return store
+}
+
+func TestBucketStore_SeriesResponsePooling(t *testing.T) {
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  1000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "j", Value: "foo"}},
+	}
+
+	for _, dontResort := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dontResort=%v", dontResort), func(t *testing.T) {
+			var expected [][]byte
+			for _, pooling := range []bool{false, true} {
+				store := newSeriesResponsePoolingTestStore(t, 2, 500,
+					WithSeriesBatchSize(10),
+					WithDontResort(dontResort),
+					WithSeriesResponsePooling(pooling),
+				)
+				chunkPool := &mockedPool{parent: store.chunkPool}
+				for _, b := range store.blocks {
+					b.chunkPool = chunkPool
+				}
+
+				srv := &marshalingSeriesServer{ctx: context.Background(), keep: true}
+				testutil.Ok(t, store.Series(req, srv))
+				testutil.Equals(t, uint64(0), chunkPool.balance.Load())
+				testutil.Assert(t, chunkPool.gets.Load() > 0)
+
+				if !pooling {
+					expected = srv.responses
+					continue
+				}
+				testutil.Equals(t, len(expected), len(srv.responses))
+				for i := range expected {
+					testutil.Equals(t, expected[i], srv.responses[i], "response %d", i)
+				}
+			}
+			testutil.Equals(t, 200, len(expected))
+		})
+	}
+}
+
+func TestSeriesArena_MemoryQuota(t *testing.T) {
+	exceeded := prometheus.NewCounter(prometheus.CounterOpts{})
+	quota := newSeriesMemoryQuota(1024, &storepb.SeriesRequest{
+		MinTime:  10,
+		MaxTime:  20,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, exceeded)
+	// Arenas which are not pooled reserve the memory of each slice allocated on the heap.
+	a := newSeriesArena(&mockedPool{parent: pool.NoopBytes{}}, false, quota)
+
+	_, _, err := a.chunkSlices(4)
+	testutil.Ok(t, err)
+	testutil.Assert(t, quota.used.Load() > 0)
+
+	_, _, err = a.chunkSlices(1024)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), `exceeded memory quota of 1024 bytes of the Series request {a="1"} from 10 to 20`), "unexpected error %v", err)
+	_, _, err = a.chunkSlices(1024)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(exceeded))
+
+	a.free()
+	testutil.Equals(t, uint64(0), quota.used.Load())
+
+	// A nil quota is unlimited.
+	a = newSeriesArena(&mockedPool{parent: pool.NoopBytes{}}, false, nil)
+	_, _, err = a.chunkSlices(1024)
+	testutil.Ok(t, err)
+	a.free()
+}
+
+func BenchmarkBucketStore_SeriesResponsePooling(b *testing.B) {
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  1000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "j", Value: "foo|bar"}},
+	}
+
+	for _, pooling := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooling=%v", pooling), func(b *testing.B) {
+			store := newSeriesResponsePoolingTestStore(b, 1, 10000, WithSeriesResponsePooling(pooling))
+			srv := &marshalingSeriesServer{ctx: context.Background()}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				testutil.Ok(b, store.Series(req, srv))
+			}
+		})
+	}
+}
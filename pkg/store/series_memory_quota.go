@@ -0,0 +1,66 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/httpgrpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// seriesMemoryQuota limits the memory a Series request holds at once out of the chunk and series pools, so that a
+// single heavy query fails instead of evicting the memory of all the other queries. Unlike the bytes limiter, which
+// counts the bytes fetched over the whole request, memory is given back to the quota once it is released to the
+// pools. All methods are safe to call on a nil seriesMemoryQuota, which is unlimited.
+type seriesMemoryQuota struct {
+	limit uint64
+	used  atomic.Uint64
+
+	matchers   string
+	mint, maxt int64
+
+	exceeded     prometheus.Counter
+	exceededOnce sync.Once
+}
+
+// newSeriesMemoryQuota returns the memory quota of the given Series request, or nil if limit is 0.
+func newSeriesMemoryQuota(limit uint64, req *storepb.SeriesRequest, exceeded prometheus.Counter) *seriesMemoryQuota {
+	if limit == 0 {
+		return nil
+	}
+	return &seriesMemoryQuota{
+		limit:    limit,
+		matchers: storepb.MatchersToString(req.Matchers...),
+		mint:     req.MinTime,
+		maxt:     req.MaxTime,
+		exceeded: exceeded,
+	}
+}
+
+// reserve reserves n bytes of the quota, failing with a resource exhausted error naming the query if the request
+// would hold more memory than its quota.
+func (q *seriesMemoryQuota) reserve(n int) error {
+	if q == nil || n <= 0 {
+		return nil
+	}
+	if used := q.used.Add(uint64(n)); used > q.limit {
+		q.used.Add(^uint64(n - 1))
+		q.exceededOnce.Do(q.exceeded.Inc)
+		return httpgrpc.Errorf(int(codes.ResourceExhausted), "exceeded memory quota of %d bytes of the Series request %s from %d to %d, holding %d bytes and needing %d more", q.limit, q.matchers, q.mint, q.maxt, used-uint64(n), n)
+	}
+	return nil
+}
+
+// release gives n bytes reserved earlier back to the quota.
+func (q *seriesMemoryQuota) release(n int) {
+	if q == nil || n <= 0 {
+		return
+	}
+	q.used.Add(^uint64(n - 1))
+}
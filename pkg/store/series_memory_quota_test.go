@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+func TestSeriesMemoryQuota(t *testing.T) {
+	exceeded := prometheus.NewCounter(prometheus.CounterOpts{})
+	quota := newSeriesMemoryQuota(1024, &storepb.SeriesRequest{
+		MinTime:  10,
+		MaxTime:  20,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, exceeded)
+
+	testutil.Ok(t, quota.reserve(1000))
+	err := quota.reserve(100)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), `exceeded memory quota of 1024 bytes of the Series request {a="1"} from 10 to 20, holding 1000 bytes and needing 100 more`), "unexpected error %v", err)
+	testutil.NotOk(t, quota.reserve(100))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(exceeded))
+
+	quota.release(1000)
+	testutil.Equals(t, uint64(0), quota.used.Load())
+	testutil.Ok(t, quota.reserve(100))
+
+	// A nil quota is unlimited.
+	testutil.Equals(t, (*seriesMemoryQuota)(nil), newSeriesMemoryQuota(0, &storepb.SeriesRequest{}, exceeded))
+	var unlimited *seriesMemoryQuota
+	testutil.Ok(t, unlimited.reserve(1<<30))
+	unlimited.release(1 << 30)
+}
+
+func TestBucketStore_SeriesMemoryQuota(t *testing.T) {
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  1000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "j", Value: "foo"}},
+	}
+
+	for _, pooling := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pooling=%v", pooling), func(t *testing.T) {
+			for _, tc := range []struct {
+				quota    uint64
+				exceeded bool
+			}{
+				{quota: 16 * 1024, exceeded: true},
+				{quota: 1 << 30},
+			} {
+				store := newSeriesResponsePoolingTestStore(t, 2, 500,
+					WithSeriesBatchSize(10),
+					WithSeriesResponsePooling(pooling),
+					WithSeriesMemoryQuota(tc.quota),
+				)
+				chunkPool := &mockedPool{parent: store.chunkPool}
+				for _, b := range store.blocks {
+					b.chunkPool = chunkPool
+				}
+
+				srv := &marshalingSeriesServer{ctx: context.Background(), keep: true}
+				err := store.Series(req, srv)
+				// The memory held by failed requests is given back to the pools too.
+				testutil.Equals(t, uint64(0), chunkPool.balance.Load())
+				dropped := promtestutil.ToFloat64(store.metrics.queriesDropped.WithLabelValues("memory", tenancy.DefaultTenant))
+				if !tc.exceeded {
+					testutil.Ok(t, err)
+					testutil.Equals(t, 200, len(srv.responses))
+					testutil.Equals(t, 0.0, dropped)
+					continue
+				}
+				testutil.NotOk(t, err)
+				testutil.Assert(t, strings.Contains(err.Error(), `exceeded memory quota of 16384 bytes of the Series request {j="foo"} from 0 to 1000`), "unexpected error %v", err)
+				s, ok := status.FromError(err)
+				testutil.Assert(t, ok)
+				testutil.Equals(t, codes.ResourceExhausted, s.Code())
+				testutil.Equals(t, 1.0, dropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// seriesStatsServer is a storepb.Store_SeriesServer aggregating the series and stats responses sent to it into a
+// single stats response, sent upon calling sendStats. Other responses are forwarded to the upstream server.
+type seriesStatsServer struct {
+	storepb.Store_SeriesServer
+
+	series        int64
+	estimated     bool
+	sources       int
+	countedSeries bool
+	labelNames    map[string]struct{}
+}
+
+func newSeriesStatsServer(upstream storepb.Store_SeriesServer) *seriesStatsServer {
+	return &seriesStatsServer{Store_SeriesServer: upstream, labelNames: map[string]struct{}{}}
+}
+
+func (s *seriesStatsServer) Send(r *storepb.SeriesResponse) error {
+	if series := r.GetSeries(); series != nil {
+		// Series are sent by stores not supporting series_stats_only, or by the store itself, deduplicated.
+		if !s.countedSeries {
+			s.countedSeries = true
+			s.sources++
+		}
+		s.series++
+		for _, l := range series.Labels {
+			s.labelNames[l.Name] = struct{}{}
+		}
+		return nil
+	}
+	if stats := r.GetStats(); stats != nil {
+		if stats.Series > 0 {
+			s.sources++
+		}
+		s.series += stats.Series
+		s.estimated = s.estimated || stats.Estimated
+		for _, n := range stats.LabelNames {
+			s.labelNames[n] = struct{}{}
+		}
+		return nil
+	}
+	return s.Store_SeriesServer.Send(r)
+}
+
+// sendStats sends the aggregated stats response. The number of series is an estimate if it aggregates the series
+// of more than one source, as they may overlap.
+func (s *seriesStatsServer) sendStats() error {
+	stats := &storepb.SeriesStats{
+		Series:     s.series,
+		Estimated:  s.estimated || s.sources > 1,
+		LabelNames: make([]string, 0, len(s.labelNames)),
+	}
+	for n := range s.labelNames {
+		stats.LabelNames = append(stats.LabelNames, n)
+	}
+	sort.Strings(stats.LabelNames)
+
+	if err := s.Store_SeriesServer.Send(storepb.NewStatsSeriesResponse(stats)); err != nil {
+		return status.Error(codes.Unknown, errors.Wrap(err, "send series stats response").Error())
+	}
+	return nil
+}
+
+// serveSeriesStats serves a request with series_stats_only by counting the series, without chunks, returned by the
+// given Series implementation.
+func serveSeriesStats(
+	r *storepb.SeriesRequest,
+	srv storepb.Store_SeriesServer,
+	series func(*storepb.SeriesRequest, storepb.Store_SeriesServer) error,
+) error {
+	req := *r
+	req.SeriesStatsOnly = false
+	req.SkipChunks = true
+
+	statsSrv := newSeriesStatsServer(srv)
+	if err := series(&req, statsSrv); err != nil {
+		return err
+	}
+	return statsSrv.sendStats()
+}
@@ -0,0 +1,79 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/custom"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestSeriesStatsOnly(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	ctx := context.Background()
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(ctx)
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b", "instance", "1"),
+		labels.FromStrings("__name__", "down", "job", "a"),
+	} {
+		_, err := app.Append(0, lset, 1, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	tsdbStore := NewTSDBStore(nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+	req := &storepb.SeriesRequest{
+		MinTime:         0,
+		MaxTime:         10,
+		Matchers:        []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+		SeriesStatsOnly: true,
+	}
+
+	srv := storetestutil.NewSeriesServer(ctx)
+	testutil.Ok(t, tsdbStore.Series(req, srv))
+	testutil.Equals(t, 0, len(srv.SeriesSet))
+	testutil.Equals(t, []*storepb.SeriesStats{
+		{Series: 2, LabelNames: []string{"__name__", "instance", "job", "region"}},
+	}, srv.StatsSet)
+
+	t.Run("proxy", func(t *testing.T) {
+		// A store not supporting series_stats_only responds with the series without chunks.
+		legacyStore := &mockedStoreAPI{
+			RespSeries: []*storepb.SeriesResponse{
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "c", "zone", "1")),
+			},
+		}
+		proxy := NewProxyStore(nil, nil, func() []Client {
+			return []Client{
+				&storetestutil.TestClient{StoreClient: storepb.ServerAsClient(tsdbStore), MinTime: math.MinInt64, MaxTime: math.MaxInt64},
+				&storetestutil.TestClient{StoreClient: legacyStore, MinTime: math.MinInt64, MaxTime: math.MaxInt64},
+			}
+		}, component.Query, labels.EmptyLabels(), 0*time.Second, EagerRetrieval)
+
+		srv := storetestutil.NewSeriesServer(ctx)
+		testutil.Ok(t, proxy.Series(req, srv))
+		testutil.Equals(t, 0, len(srv.SeriesSet))
+		testutil.Equals(t, []*storepb.SeriesStats{
+			{Series: 3, Estimated: true, LabelNames: []string{"__name__", "instance", "job", "region", "zone"}},
+		}, srv.StatsSet)
+		testutil.Assert(t, legacyStore.LastSeriesReq.SkipChunks)
+		testutil.Assert(t, legacyStore.LastSeriesReq.SeriesStatsOnly)
+	})
+}
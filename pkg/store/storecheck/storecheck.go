@@ -0,0 +1,539 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package storecheck implements a conformance suite for StoreAPI implementations, checking that they behave like
+// the Thanos components Queriers expect them to.
+package storecheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusFail Status = "FAIL"
+	StatusSkip Status = "SKIP"
+)
+
+// maxCheckedLabelNames is the maximum number of label names whose values are checked.
+const maxCheckedLabelNames = 10
+
+// Result is the outcome of a check of the suite.
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the outcome of all the checks of the suite, in the order they ran.
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Failed returns the number of failed checks.
+func (r Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// Config holds the requests the suite sends.
+type Config struct {
+	// MinTime and MaxTime are the time range of the requests.
+	MinTime, MaxTime int64
+	// Matchers select the series the suite checks. If empty, the series of the first metric name are checked.
+	Matchers []*labels.Matcher
+	// ReplicaLabels are the labels removed from the series of Series requests with without replica labels. If empty,
+	// the first external label is used.
+	ReplicaLabels []string
+}
+
+// Checker runs the conformance suite against a StoreAPI.
+type Checker struct {
+	store storepb.StoreClient
+	info  infopb.InfoClient
+	cfg   Config
+
+	// State gathered by the checks, for the next ones.
+	supportsWithoutReplicaLabels *bool
+	labelSets                    []labels.Labels
+	matchers                     []*labels.Matcher
+	series                       []labels.Labels
+}
+
+// NewChecker returns a Checker of the given StoreAPI. info may be nil, in which case the Info method of the StoreAPI
+// is used, and the checks depending on the capabilities of the store are skipped.
+func NewChecker(store storepb.StoreClient, info infopb.InfoClient, cfg Config) *Checker {
+	return &Checker{store: store, info: info, cfg: cfg}
+}
+
+type skipError struct {
+	msg string
+}
+
+func (e skipError) Error() string { return e.msg }
+
+func skipf(format string, args ...interface{}) error {
+	return skipError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Run runs all the checks of the suite, and returns their report.
+func (c *Checker) Run(ctx context.Context) Report {
+	var report Report
+	for _, check := range []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{name: "info", run: c.checkInfo},
+		{name: "label-names", run: c.checkLabelNames},
+		{name: "label-values", run: c.checkLabelValues},
+		{name: "series", run: c.checkSeries},
+		{name: "series-skip-chunks", run: c.checkSkipChunks},
+		{name: "matchers", run: c.checkMatchers},
+		{name: "label-apis-matchers", run: c.checkLabelAPIsMatchers},
+		{name: "without-replica-labels", run: c.checkWithoutReplicaLabels},
+	} {
+		msg, err := check.run(ctx)
+		res := Result{Check: check.name, Status: StatusPass, Message: msg}
+		var skip skipError
+		switch {
+		case errors.As(err, &skip):
+			res.Status, res.Message = StatusSkip, skip.msg
+		case err != nil:
+			res.Status, res.Message = StatusFail, err.Error()
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func (c *Checker) checkInfo(ctx context.Context) (string, error) {
+	var (
+		minTime, maxTime int64
+		labelSets        []labelpb.ZLabelSet
+		componentType    string
+	)
+	resp, err := c.infoResponse(ctx)
+	if err != nil {
+		return "", err
+	}
+	if resp != nil {
+		if resp.Store == nil {
+			return "", errors.New("the info response of the component has no store info")
+		}
+		supports := resp.Store.SupportsWithoutReplicaLabels
+		c.supportsWithoutReplicaLabels = &supports
+		minTime, maxTime, labelSets, componentType = resp.Store.MinTime, resp.Store.MaxTime, resp.LabelSets, resp.ComponentType
+	} else {
+		storeResp, err := c.store.Info(ctx, &storepb.InfoRequest{})
+		if err != nil {
+			return "", errors.Wrap(err, "info")
+		}
+		minTime, maxTime, labelSets, componentType = storeResp.MinTime, storeResp.MaxTime, storeResp.LabelSets, storeResp.StoreType.String()
+	}
+
+	if minTime > maxTime {
+		return "", errors.Errorf("min time %d is after max time %d", minTime, maxTime)
+	}
+	for _, ls := range labelSets {
+		lset := ls.PromLabels()
+		if err := validateLabels(lset); err != nil {
+			return "", errors.Wrapf(err, "external labels %s", lset)
+		}
+		c.labelSets = append(c.labelSets, lset)
+	}
+	return fmt.Sprintf("component %s, time range [%d, %d], %d external label sets", componentType, minTime, maxTime, len(labelSets)), nil
+}
+
+// infoResponse returns the response of the Info service, or nil if the component doesn't implement it.
+func (c *Checker) infoResponse(ctx context.Context) (*infopb.InfoResponse, error) {
+	if c.info == nil {
+		return nil, nil
+	}
+	resp, err := c.info.Info(ctx, &infopb.InfoRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "info")
+	}
+	return resp, nil
+}
+
+func (c *Checker) checkLabelNames(ctx context.Context) (string, error) {
+	names, err := c.labelNames(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := validateSortedStrings(names); err != nil {
+		return "", errors.Wrap(err, "label names")
+	}
+	return fmt.Sprintf("%d label names", len(names)), nil
+}
+
+func (c *Checker) checkLabelValues(ctx context.Context) (string, error) {
+	names, err := c.labelNames(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(names) > maxCheckedLabelNames {
+		names = names[:maxCheckedLabelNames]
+	}
+	for _, name := range names {
+		values, err := c.labelValues(ctx, name, nil)
+		if err != nil {
+			return "", err
+		}
+		if err := validateSortedStrings(values); err != nil {
+			return "", errors.Wrapf(err, "values of label %s", name)
+		}
+	}
+	return fmt.Sprintf("values of %d label names", len(names)), nil
+}
+
+func (c *Checker) checkSeries(ctx context.Context) (string, error) {
+	c.matchers = c.cfg.Matchers
+	if len(c.matchers) == 0 {
+		names, err := c.labelValues(ctx, labels.MetricName, nil)
+		if err != nil {
+			return "", err
+		}
+		if len(names) == 0 {
+			return "", skipf("no metric names to select series with")
+		}
+		c.matchers = []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, names[0])}
+	}
+
+	series, err := c.seriesRequest(ctx, &storepb.SeriesRequest{}, c.matchers)
+	if err != nil {
+		return "", err
+	}
+	if len(series) == 0 {
+		return "", skipf("no series selected by %s", matchersString(c.matchers))
+	}
+	var (
+		chunks int
+		lsets  = make([]labels.Labels, 0, len(series))
+	)
+	for i, s := range series {
+		if i > 0 && labels.Compare(series[i-1].lset, s.lset) > 0 {
+			return "", errors.Errorf("series are not sorted: %s is sent after %s", s.lset, series[i-1].lset)
+		}
+		for j, chk := range s.chunks {
+			if chk.MinTime > chk.MaxTime {
+				return "", errors.Errorf("series %s: chunk %d has min time %d after its max time %d", s.lset, j, chk.MinTime, chk.MaxTime)
+			}
+			if j > 0 && s.chunks[j-1].MinTime > chk.MinTime {
+				return "", errors.Errorf("series %s: chunks are not sorted by min time", s.lset)
+			}
+			if chk.MaxTime < c.cfg.MinTime || chk.MinTime > c.cfg.MaxTime {
+				return "", errors.Errorf("series %s: chunk [%d, %d] is outside of the requested time range [%d, %d]", s.lset, chk.MinTime, chk.MaxTime, c.cfg.MinTime, c.cfg.MaxTime)
+			}
+		}
+		chunks += len(s.chunks)
+		lsets = append(lsets, s.lset)
+	}
+	// Only check the other APIs against the series if they are valid.
+	c.series = lsets
+	return fmt.Sprintf("%d series with %d chunks selected by %s", len(series), chunks, matchersString(c.matchers)), nil
+}
+
+func (c *Checker) checkSkipChunks(ctx context.Context) (string, error) {
+	if len(c.series) == 0 {
+		return "", skipf("no series to check")
+	}
+	series, err := c.seriesRequest(ctx, &storepb.SeriesRequest{SkipChunks: true}, c.matchers)
+	if err != nil {
+		return "", err
+	}
+	if len(series) != len(c.series) {
+		return "", errors.Errorf("got %d series without chunks, but %d series with chunks", len(series), len(c.series))
+	}
+	for i, s := range series {
+		if len(s.chunks) > 0 {
+			return "", errors.Errorf("series %s has chunks", s.lset)
+		}
+		if !labels.Equal(s.lset, c.series[i]) {
+			return "", errors.Errorf("got series %s without chunks, but %s with chunks", s.lset, c.series[i])
+		}
+	}
+	return "", nil
+}
+
+func (c *Checker) checkMatchers(ctx context.Context) (string, error) {
+	if len(c.series) == 0 {
+		return "", skipf("no series to check")
+	}
+	// Split the series by a label the series matchers don't select on.
+	var l labels.Label
+	for _, candidate := range c.series[0] {
+		if !hasMatcherOn(c.matchers, candidate.Name) {
+			l = candidate
+			break
+		}
+	}
+	if l.Name == "" {
+		return "", skipf("no label to split the series of %s by", matchersString(c.matchers))
+	}
+
+	counts := map[labels.MatchType]int{}
+	for _, t := range []labels.MatchType{labels.MatchEqual, labels.MatchNotEqual, labels.MatchRegexp, labels.MatchNotRegexp} {
+		v := l.Value
+		if t == labels.MatchRegexp || t == labels.MatchNotRegexp {
+			v = regexp.QuoteMeta(v)
+		}
+		m := labels.MustNewMatcher(t, l.Name, v)
+		ms := append(append([]*labels.Matcher{}, c.matchers...), m)
+		series, err := c.seriesRequest(ctx, &storepb.SeriesRequest{SkipChunks: true}, ms)
+		if err != nil {
+			return "", err
+		}
+		counts[t] = len(series)
+	}
+	if counts[labels.MatchEqual] == 0 {
+		return "", errors.Errorf("no series selected by %s=%q, while series %s has it", l.Name, l.Value, c.series[0])
+	}
+	if counts[labels.MatchEqual]+counts[labels.MatchNotEqual] != len(c.series) {
+		return "", errors.Errorf("%s=%q and %s!=%q select %d and %d series, but there are %d series", l.Name, l.Value, l.Name, l.Value, counts[labels.MatchEqual], counts[labels.MatchNotEqual], len(c.series))
+	}
+	if counts[labels.MatchRegexp] != counts[labels.MatchEqual] || counts[labels.MatchNotRegexp] != counts[labels.MatchNotEqual] {
+		return "", errors.Errorf("regexp matchers on %s select %d and %d series, but equality matchers %d and %d", l.Name, counts[labels.MatchRegexp], counts[labels.MatchNotRegexp], counts[labels.MatchEqual], counts[labels.MatchNotEqual])
+	}
+	return fmt.Sprintf("series split by label %s", l.Name), nil
+}
+
+func (c *Checker) checkLabelAPIsMatchers(ctx context.Context) (string, error) {
+	if len(c.series) == 0 {
+		return "", skipf("no series to check")
+	}
+	names, err := c.labelNames(ctx, c.matchers)
+	if err != nil {
+		return "", err
+	}
+	if err := validateSortedStrings(names); err != nil {
+		return "", errors.Wrap(err, "label names")
+	}
+	values := map[string]map[string]struct{}{}
+	for _, lset := range c.series {
+		for _, l := range lset {
+			if values[l.Name] == nil {
+				values[l.Name] = map[string]struct{}{}
+			}
+			values[l.Name][l.Value] = struct{}{}
+		}
+	}
+	for name := range values {
+		if i := sort.SearchStrings(names, name); i == len(names) || names[i] != name {
+			return "", errors.Errorf("label names of the series selected by %s miss %s", matchersString(c.matchers), name)
+		}
+	}
+
+	checked := 0
+	for _, l := range c.series[0] {
+		if checked == maxCheckedLabelNames {
+			break
+		}
+		checked++
+		got, err := c.labelValues(ctx, l.Name, c.matchers)
+		if err != nil {
+			return "", err
+		}
+		if err := validateSortedStrings(got); err != nil {
+			return "", errors.Wrapf(err, "values of label %s", l.Name)
+		}
+		for v := range values[l.Name] {
+			if i := sort.SearchStrings(got, v); i == len(got) || got[i] != v {
+				return "", errors.Errorf("values of label %s of the series selected by %s miss %q", l.Name, matchersString(c.matchers), v)
+			}
+		}
+	}
+	return fmt.Sprintf("%d label names, values of %d label names", len(names), checked), nil
+}
+
+func (c *Checker) checkWithoutReplicaLabels(ctx context.Context) (string, error) {
+	if c.supportsWithoutReplicaLabels == nil {
+		return "", skipf("the component doesn't implement the Info service")
+	}
+	if !*c.supportsWithoutReplicaLabels {
+		return "", skipf("the component doesn't support without replica labels")
+	}
+	if len(c.series) == 0 {
+		return "", skipf("no series to check")
+	}
+	replicaLabels := c.cfg.ReplicaLabels
+	if len(replicaLabels) == 0 {
+		if len(c.labelSets) == 0 || len(c.labelSets[0]) == 0 {
+			return "", skipf("no external labels to use as replica labels")
+		}
+		replicaLabels = []string{c.labelSets[0][0].Name}
+	}
+
+	series, err := c.seriesRequest(ctx, &storepb.SeriesRequest{SkipChunks: true, WithoutReplicaLabels: replicaLabels}, c.matchers)
+	if err != nil {
+		return "", err
+	}
+	if len(series) == 0 {
+		return "", errors.Errorf("no series selected by %s without replica labels %s", matchersString(c.matchers), strings.Join(replicaLabels, ","))
+	}
+	for i, s := range series {
+		for _, name := range replicaLabels {
+			if s.lset.Has(name) {
+				return "", errors.Errorf("series %s has replica label %s", s.lset, name)
+			}
+		}
+		if i > 0 && labels.Compare(series[i-1].lset, s.lset) > 0 {
+			return "", errors.Errorf("series without replica labels are not sorted: %s is sent after %s", s.lset, series[i-1].lset)
+		}
+	}
+	return fmt.Sprintf("%d series without replica labels %s", len(series), strings.Join(replicaLabels, ",")), nil
+}
+
+func (c *Checker) labelNames(ctx context.Context, matchers []*labels.Matcher) ([]string, error) {
+	ms, err := storepb.PromMatchersToMatchers(matchers...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.store.LabelNames(ctx, &storepb.LabelNamesRequest{
+		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
+		Start:                   c.cfg.MinTime,
+		End:                     c.cfg.MaxTime,
+		Matchers:                ms,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "label names")
+	}
+	return resp.Names, nil
+}
+
+func (c *Checker) labelValues(ctx context.Context, name string, matchers []*labels.Matcher) ([]string, error) {
+	ms, err := storepb.PromMatchersToMatchers(matchers...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:                   name,
+		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
+		Start:                   c.cfg.MinTime,
+		End:                     c.cfg.MaxTime,
+		Matchers:                ms,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "label values of %s", name)
+	}
+	return resp.Values, nil
+}
+
+type checkedSeries struct {
+	lset   labels.Labels
+	chunks []storepb.AggrChunk
+}
+
+// seriesRequest sends the given Series request with the suite time range and matchers, and returns the series it
+// received, after checking their labels and that they match the matchers.
+func (c *Checker) seriesRequest(ctx context.Context, req *storepb.SeriesRequest, matchers []*labels.Matcher) ([]checkedSeries, error) {
+	ms, err := storepb.PromMatchersToMatchers(matchers...)
+	if err != nil {
+		return nil, err
+	}
+	req.MinTime, req.MaxTime, req.Matchers = c.cfg.MinTime, c.cfg.MaxTime, ms
+	req.PartialResponseStrategy = storepb.PartialResponseStrategy_ABORT
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cl, err := c.store.Series(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "series")
+	}
+	var res []checkedSeries
+	for {
+		resp, err := cl.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "receive series")
+		}
+		s := resp.GetSeries()
+		if s == nil {
+			continue
+		}
+		lset := s.PromLabels()
+		if err := validateLabels(lset); err != nil {
+			return nil, errors.Wrapf(err, "series %s", lset)
+		}
+		for _, m := range matchers {
+			if !m.Matches(lset.Get(m.Name)) {
+				return nil, errors.Errorf("series %s doesn't match %s", lset, m)
+			}
+		}
+		res = append(res, checkedSeries{lset: lset, chunks: s.Chunks})
+	}
+	return res, nil
+}
+
+// validateLabels returns an error if the given label set is empty, not sorted, or has duplicated names or empty values.
+func validateLabels(lset labels.Labels) error {
+	if len(lset) == 0 {
+		return errors.New("empty label set")
+	}
+	for i, l := range lset {
+		if l.Name == "" || l.Value == "" {
+			return errors.Errorf("label %s has an empty name or value", l)
+		}
+		if i > 0 && lset[i-1].Name >= l.Name {
+			return errors.Errorf("labels are not sorted or have duplicated names: %s is before %s", lset[i-1].Name, l.Name)
+		}
+	}
+	return nil
+}
+
+// validateSortedStrings returns an error if the given strings are not sorted, unique and non-empty.
+func validateSortedStrings(s []string) error {
+	for i, v := range s {
+		if v == "" {
+			return errors.New("empty string")
+		}
+		if i > 0 && s[i-1] >= v {
+			return errors.Errorf("not sorted or duplicated: %q is before %q", s[i-1], v)
+		}
+	}
+	return nil
+}
+
+func hasMatcherOn(matchers []*labels.Matcher, name string) bool {
+	for _, m := range matchers {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func matchersString(matchers []*labels.Matcher) string {
+	s := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		s = append(s, m.String())
+	}
+	return "{" + strings.Join(s, ",") + "}"
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecheck
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+type staticInfoClient struct {
+	resp *infopb.InfoResponse
+}
+
+func (c staticInfoClient) Info(context.Context, *infopb.InfoRequest, ...grpc.CallOption) (*infopb.InfoResponse, error) {
+	return c.resp, nil
+}
+
+// unsortedStore sends the series of its StoreServer in reverse order.
+type unsortedStore struct {
+	storepb.StoreServer
+}
+
+type collectingSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	series []*storepb.SeriesResponse
+}
+
+func (s *collectingSeriesServer) Send(r *storepb.SeriesResponse) error {
+	s.series = append(s.series, r)
+	return nil
+}
+
+func (s unsortedStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	c := &collectingSeriesServer{Store_SeriesServer: srv}
+	if err := s.StoreServer.Series(r, c); err != nil {
+		return err
+	}
+	for i := len(c.series) - 1; i >= 0; i-- {
+		if err := srv.Send(c.series[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestChecker(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, db.Close()) })
+
+	app := db.Appender(context.Background())
+	for i := 0; i < 10; i++ {
+		for ts := int64(0); ts < 100; ts += 10 {
+			_, err := app.Append(0, labels.FromStrings("__name__", "up", "instance", fmt.Sprintf("instance-%d", i), "job", fmt.Sprintf("job-%d", i%2)), ts, 1)
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	extLset := labels.FromStrings("replica", "a")
+	tsdbStore := store.NewTSDBStore(nil, db, component.Rule, extLset)
+	info := staticInfoClient{resp: &infopb.InfoResponse{
+		ComponentType: component.Rule.String(),
+		LabelSets:     labelpb.ZLabelSetsFromPromLabels(extLset),
+		Store:         &infopb.StoreInfo{MinTime: 0, MaxTime: math.MaxInt64, SupportsWithoutReplicaLabels: true},
+	}}
+	cfg := Config{MinTime: 0, MaxTime: 100}
+
+	statuses := func(r Report) map[string]Status {
+		res := map[string]Status{}
+		for _, r := range r.Results {
+			res[r.Check] = r.Status
+		}
+		return res
+	}
+
+	t.Run("conformant", func(t *testing.T) {
+		report := NewChecker(storepb.ServerAsClient(tsdbStore), info, cfg).Run(context.Background())
+		testutil.Equals(t, 0, report.Failed(), "%+v", report)
+		for _, r := range report.Results {
+			testutil.Equals(t, StatusPass, r.Status, "%+v", r)
+		}
+	})
+	t.Run("without info service", func(t *testing.T) {
+		report := NewChecker(storepb.ServerAsClient(tsdbStore), nil, cfg).Run(context.Background())
+		testutil.Equals(t, 0, report.Failed(), "%+v", report)
+		testutil.Equals(t, StatusSkip, statuses(report)["without-replica-labels"])
+	})
+	t.Run("matchers", func(t *testing.T) {
+		report := NewChecker(storepb.ServerAsClient(tsdbStore), info, Config{
+			MinTime:  0,
+			MaxTime:  100,
+			Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "job-1")},
+		}).Run(context.Background())
+		testutil.Equals(t, 0, report.Failed(), "%+v", report)
+		testutil.Equals(t, "5 series with 5 chunks selected by {job=\"job-1\"}", report.Results[3].Message)
+	})
+	t.Run("unsorted series", func(t *testing.T) {
+		report := NewChecker(storepb.ServerAsClient(unsortedStore{StoreServer: tsdbStore}), info, cfg).Run(context.Background())
+		testutil.Equals(t, 1, report.Failed(), "%+v", report)
+		testutil.Equals(t, StatusFail, statuses(report)["series"])
+		testutil.Equals(t, StatusSkip, statuses(report)["matchers"])
+	})
+}
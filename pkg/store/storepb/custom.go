@@ -52,6 +52,14 @@ func NewHintsSeriesResponse(hints *types.Any) *SeriesResponse {
 	}
 }
 
+func NewStatsSeriesResponse(stats *SeriesStats) *SeriesResponse {
+	return &SeriesResponse{
+		Result: &SeriesResponse_Stats{
+			Stats: stats,
+		},
+	}
+}
+
 func GRPCCodeFromWarn(warn string) codes.Code {
 	if strings.Contains(warn, "rpc error: code = ResourceExhausted") {
 		return codes.ResourceExhausted
@@ -305,6 +305,15 @@ type SeriesRequest struct {
 	// NOTE(bwplotka): thanos.info.store.supports_without_replica_labels field has to return true to let client knows
 	// server supports it.
 	WithoutReplicaLabels []string `protobuf:"bytes,14,rep,name=without_replica_labels,json=withoutReplicaLabels,proto3" json:"without_replica_labels,omitempty"`
+	// series_stats_only requests a single stats response with the number of matching series and their label names,
+	// instead of the series themselves. It implies skip_chunks, and allows stores to skip most of the work of
+	// fetching and sending series, e.g. to estimate the cardinality of a query before running it.
+	// Stores not supporting it respond with the series without chunks, which clients have to count.
+	SeriesStatsOnly bool `protobuf:"varint,15,opt,name=series_stats_only,json=seriesStatsOnly,proto3" json:"series_stats_only,omitempty"`
+	// aggregation_hint optionally asks stores to aggregate the matching series over the requested range, instead of
+	// sending them one by one. Stores may ignore it, e.g. for raw data, so clients have to aggregate the series they
+	// receive anyway, as if the hint wasn't set.
+	AggregationHint *AggregationHint `protobuf:"bytes,16,opt,name=aggregation_hint,json=aggregationHint,proto3" json:"aggregation_hint,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
@@ -548,11 +557,53 @@ func (m *Range) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_Range proto.InternalMessageInfo
 
+// AggregationHint describes the aggregation of the matching series of a Series request, e.g. sum by (cluster).
+type AggregationHint struct {
+	// The aggregation of the series. Only COUNT, SUM, MIN and MAX are supported.
+	Func Aggr `protobuf:"varint,1,opt,name=func,proto3,enum=thanos.Aggr" json:"func,omitempty"`
+	// Names of the labels to group the series by.
+	By []string `protobuf:"bytes,2,rep,name=by,proto3" json:"by,omitempty"`
+}
+
+func (m *AggregationHint) Reset()         { *m = AggregationHint{} }
+func (m *AggregationHint) String() string { return proto.CompactTextString(m) }
+func (*AggregationHint) ProtoMessage()    {}
+func (*AggregationHint) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{10}
+}
+func (m *AggregationHint) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *AggregationHint) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_AggregationHint.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *AggregationHint) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AggregationHint.Merge(m, src)
+}
+func (m *AggregationHint) XXX_Size() int {
+	return m.Size()
+}
+func (m *AggregationHint) XXX_DiscardUnknown() {
+	xxx_messageInfo_AggregationHint.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AggregationHint proto.InternalMessageInfo
+
 type SeriesResponse struct {
 	// Types that are valid to be assigned to Result:
 	//	*SeriesResponse_Series
 	//	*SeriesResponse_Warning
 	//	*SeriesResponse_Hints
+	//	*SeriesResponse_Stats
 	Result isSeriesResponse_Result `protobuf_oneof:"result"`
 }
 
@@ -560,7 +611,7 @@ func (m *SeriesResponse) Reset()         { *m = SeriesResponse{} }
 func (m *SeriesResponse) String() string { return proto.CompactTextString(m) }
 func (*SeriesResponse) ProtoMessage()    {}
 func (*SeriesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{10}
+	return fileDescriptor_a938d55a388af629, []int{11}
 }
 func (m *SeriesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -604,10 +655,14 @@ type SeriesResponse_Warning struct {
 type SeriesResponse_Hints struct {
 	Hints *types.Any `protobuf:"bytes,3,opt,name=hints,proto3,oneof" json:"hints,omitempty"`
 }
+type SeriesResponse_Stats struct {
+	Stats *SeriesStats `protobuf:"bytes,4,opt,name=stats,proto3,oneof" json:"stats,omitempty"`
+}
 
 func (*SeriesResponse_Series) isSeriesResponse_Result()  {}
 func (*SeriesResponse_Warning) isSeriesResponse_Result() {}
 func (*SeriesResponse_Hints) isSeriesResponse_Result()   {}
+func (*SeriesResponse_Stats) isSeriesResponse_Result()   {}
 
 func (m *SeriesResponse) GetResult() isSeriesResponse_Result {
 	if m != nil {
@@ -637,14 +692,65 @@ func (m *SeriesResponse) GetHints() *types.Any {
 	return nil
 }
 
+func (m *SeriesResponse) GetStats() *SeriesStats {
+	if x, ok := m.GetResult().(*SeriesResponse_Stats); ok {
+		return x.Stats
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*SeriesResponse) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*SeriesResponse_Series)(nil),
 		(*SeriesResponse_Warning)(nil),
 		(*SeriesResponse_Hints)(nil),
+		(*SeriesResponse_Stats)(nil),
+	}
+}
+
+type SeriesStats struct {
+	/// series is the number of series matching the request.
+	Series int64 `protobuf:"varint,1,opt,name=series,proto3" json:"series,omitempty"`
+	/// estimated is true if series is an estimate, e.g. because the series of several blocks were counted without
+	/// deduplicating them.
+	Estimated bool `protobuf:"varint,2,opt,name=estimated,proto3" json:"estimated,omitempty"`
+	/// label_names are the sorted label names of the matching series, if known.
+	LabelNames []string `protobuf:"bytes,3,rep,name=label_names,json=labelNames,proto3" json:"label_names,omitempty"`
+}
+
+func (m *SeriesStats) Reset()         { *m = SeriesStats{} }
+func (m *SeriesStats) String() string { return proto.CompactTextString(m) }
+func (*SeriesStats) ProtoMessage()    {}
+func (*SeriesStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{12}
+}
+func (m *SeriesStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SeriesStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SeriesStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
 }
+func (m *SeriesStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SeriesStats.Merge(m, src)
+}
+func (m *SeriesStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *SeriesStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_SeriesStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SeriesStats proto.InternalMessageInfo
 
 type LabelNamesRequest struct {
 	PartialResponseDisabled bool `protobuf:"varint,1,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3" json:"partial_response_disabled,omitempty"`
@@ -665,7 +771,7 @@ func (m *LabelNamesRequest) Reset()         { *m = LabelNamesRequest{} }
 func (m *LabelNamesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesRequest) ProtoMessage()    {}
 func (*LabelNamesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{11}
+	return fileDescriptor_a938d55a388af629, []int{13}
 }
 func (m *LabelNamesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -707,7 +813,7 @@ func (m *LabelNamesResponse) Reset()         { *m = LabelNamesResponse{} }
 func (m *LabelNamesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesResponse) ProtoMessage()    {}
 func (*LabelNamesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{12}
+	return fileDescriptor_a938d55a388af629, []int{14}
 }
 func (m *LabelNamesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -756,7 +862,7 @@ func (m *LabelValuesRequest) Reset()         { *m = LabelValuesRequest{} }
 func (m *LabelValuesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesRequest) ProtoMessage()    {}
 func (*LabelValuesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{13}
+	return fileDescriptor_a938d55a388af629, []int{15}
 }
 func (m *LabelValuesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -798,7 +904,7 @@ func (m *LabelValuesResponse) Reset()         { *m = LabelValuesResponse{} }
 func (m *LabelValuesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesResponse) ProtoMessage()    {}
 func (*LabelValuesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{14}
+	return fileDescriptor_a938d55a388af629, []int{16}
 }
 func (m *LabelValuesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -840,7 +946,9 @@ func init() {
 	proto.RegisterType((*Func)(nil), "thanos.Func")
 	proto.RegisterType((*Grouping)(nil), "thanos.Grouping")
 	proto.RegisterType((*Range)(nil), "thanos.Range")
+	proto.RegisterType((*AggregationHint)(nil), "thanos.AggregationHint")
 	proto.RegisterType((*SeriesResponse)(nil), "thanos.SeriesResponse")
+	proto.RegisterType((*SeriesStats)(nil), "thanos.SeriesStats")
 	proto.RegisterType((*LabelNamesRequest)(nil), "thanos.LabelNamesRequest")
 	proto.RegisterType((*LabelNamesResponse)(nil), "thanos.LabelNamesResponse")
 	proto.RegisterType((*LabelValuesRequest)(nil), "thanos.LabelValuesRequest")
@@ -850,91 +958,99 @@ func init() {
 func init() { proto.RegisterFile("store/storepb/rpc.proto", fileDescriptor_a938d55a388af629) }
 
 var fileDescriptor_a938d55a388af629 = []byte{
-	// 1331 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0x4f, 0x6f, 0x13, 0x47,
-	0x14, 0xf7, 0x7a, 0xbd, 0xfe, 0xf3, 0x9c, 0xb8, 0x66, 0x30, 0x61, 0x63, 0x24, 0xc7, 0x75, 0x55,
-	0xc9, 0x42, 0xd4, 0xa6, 0x06, 0x21, 0xb5, 0xe2, 0x92, 0x04, 0x43, 0xa2, 0x12, 0x53, 0xc6, 0x09,
-	0x69, 0xa9, 0x2a, 0x6b, 0x6d, 0x4f, 0xd6, 0x2b, 0xec, 0xdd, 0x65, 0x67, 0xb6, 0x89, 0xaf, 0xad,
-	0x7a, 0xab, 0xaa, 0xaa, 0x1f, 0xa1, 0x9f, 0x86, 0x23, 0xc7, 0xaa, 0x07, 0xd4, 0xc2, 0xbd, 0x9f,
-	0xa1, 0x9a, 0x3f, 0xbb, 0xf6, 0xa6, 0x21, 0x08, 0x91, 0x4b, 0x34, 0xef, 0xf7, 0x7b, 0xf3, 0xe6,
-	0xfd, 0xcf, 0x1a, 0xae, 0x52, 0xe6, 0x05, 0xa4, 0x2d, 0xfe, 0xfa, 0xc3, 0x76, 0xe0, 0x8f, 0x5a,
-	0x7e, 0xe0, 0x31, 0x0f, 0x65, 0xd9, 0xc4, 0x72, 0x3d, 0x5a, 0x5d, 0x4f, 0x2a, 0xb0, 0xb9, 0x4f,
-	0xa8, 0x54, 0xa9, 0x56, 0x6c, 0xcf, 0xf6, 0xc4, 0xb1, 0xcd, 0x4f, 0x0a, 0xad, 0x27, 0x2f, 0xf8,
-	0x81, 0x37, 0x3b, 0x75, 0x4f, 0x99, 0x9c, 0x5a, 0x43, 0x32, 0x3d, 0x4d, 0xd9, 0x9e, 0x67, 0x4f,
-	0x49, 0x5b, 0x48, 0xc3, 0xf0, 0xa8, 0x6d, 0xb9, 0x73, 0x49, 0x35, 0x3e, 0x82, 0xd5, 0xc3, 0xc0,
-	0x61, 0x04, 0x13, 0xea, 0x7b, 0x2e, 0x25, 0x8d, 0x9f, 0x34, 0x58, 0x51, 0xc8, 0xf3, 0x90, 0x50,
-	0x86, 0x36, 0x01, 0x98, 0x33, 0x23, 0x94, 0x04, 0x0e, 0xa1, 0xa6, 0x56, 0xd7, 0x9b, 0xc5, 0xce,
-	0x35, 0x7e, 0x7b, 0x46, 0xd8, 0x84, 0x84, 0x74, 0x30, 0xf2, 0xfc, 0x79, 0x6b, 0xdf, 0x99, 0x91,
-	0xbe, 0x50, 0xd9, 0xca, 0xbc, 0x78, 0xb5, 0x91, 0xc2, 0x4b, 0x97, 0xd0, 0x1a, 0x64, 0x19, 0x71,
-	0x2d, 0x97, 0x99, 0xe9, 0xba, 0xd6, 0x2c, 0x60, 0x25, 0x21, 0x13, 0x72, 0x01, 0xf1, 0xa7, 0xce,
-	0xc8, 0x32, 0xf5, 0xba, 0xd6, 0xd4, 0x71, 0x24, 0x36, 0x56, 0xa1, 0xb8, 0xeb, 0x1e, 0x79, 0xca,
-	0x87, 0xc6, 0xef, 0x69, 0x58, 0x91, 0xb2, 0xf4, 0x12, 0x8d, 0x20, 0x2b, 0x02, 0x8d, 0x1c, 0x5a,
-	0x6d, 0xc9, 0xc4, 0xb6, 0x1e, 0x72, 0x74, 0xeb, 0x2e, 0x77, 0xe1, 0xaf, 0x57, 0x1b, 0xb7, 0x6d,
-	0x87, 0x4d, 0xc2, 0x61, 0x6b, 0xe4, 0xcd, 0xda, 0x52, 0xe1, 0x33, 0xc7, 0x53, 0xa7, 0xb6, 0xff,
-	0xcc, 0x6e, 0x27, 0x72, 0xd6, 0x7a, 0x2a, 0x6e, 0x63, 0x65, 0x1a, 0xad, 0x43, 0x7e, 0xe6, 0xb8,
-	0x03, 0x1e, 0x88, 0x70, 0x5c, 0xc7, 0xb9, 0x99, 0xe3, 0xf2, 0x48, 0x05, 0x65, 0x9d, 0x48, 0x4a,
-	0xb9, 0x3e, 0xb3, 0x4e, 0x04, 0xd5, 0x86, 0x82, 0xb0, 0xba, 0x3f, 0xf7, 0x89, 0x99, 0xa9, 0x6b,
-	0xcd, 0x52, 0xe7, 0x52, 0xe4, 0x5d, 0x3f, 0x22, 0xf0, 0x42, 0x07, 0xdd, 0x01, 0x10, 0x0f, 0x0e,
-	0x28, 0x61, 0xd4, 0x34, 0x44, 0x3c, 0xf1, 0x0d, 0xe9, 0x52, 0x9f, 0x30, 0x95, 0xd6, 0xc2, 0x54,
-	0xc9, 0xb4, 0xf1, 0x8b, 0x01, 0xab, 0x32, 0xe5, 0x51, 0xa9, 0x96, 0x1d, 0xd6, 0xde, 0xee, 0x70,
-	0x3a, 0xe9, 0xf0, 0x1d, 0x4e, 0xb1, 0xd1, 0x84, 0x04, 0xd4, 0xd4, 0xc5, 0xeb, 0x95, 0x44, 0x36,
-	0xf7, 0x24, 0xa9, 0x1c, 0x88, 0x75, 0x51, 0x07, 0xae, 0x70, 0x93, 0x01, 0xa1, 0xde, 0x34, 0x64,
-	0x8e, 0xe7, 0x0e, 0x8e, 0x1d, 0x77, 0xec, 0x1d, 0x8b, 0xa0, 0x75, 0x7c, 0x79, 0x66, 0x9d, 0xe0,
-	0x98, 0x3b, 0x14, 0x14, 0xba, 0x01, 0x60, 0xd9, 0x76, 0x40, 0x6c, 0x8b, 0x11, 0x19, 0x6b, 0xa9,
-	0xb3, 0x12, 0xbd, 0xb6, 0x69, 0xdb, 0x01, 0x5e, 0xe2, 0xd1, 0x97, 0xb0, 0xee, 0x5b, 0x01, 0x73,
-	0xac, 0x29, 0x7f, 0x45, 0x54, 0x7e, 0x30, 0x76, 0xa8, 0x35, 0x9c, 0x92, 0xb1, 0x99, 0xad, 0x6b,
-	0xcd, 0x3c, 0xbe, 0xaa, 0x14, 0xa2, 0xce, 0xb8, 0xa7, 0x68, 0xf4, 0xdd, 0x19, 0x77, 0x29, 0x0b,
-	0x2c, 0x46, 0xec, 0xb9, 0x99, 0x13, 0x65, 0xd9, 0x88, 0x1e, 0xfe, 0x3a, 0x69, 0xa3, 0xaf, 0xd4,
-	0xfe, 0x67, 0x3c, 0x22, 0xd0, 0x06, 0x14, 0xe9, 0x33, 0xc7, 0x1f, 0x8c, 0x26, 0xa1, 0xfb, 0x8c,
-	0x9a, 0x79, 0xe1, 0x0a, 0x70, 0x68, 0x5b, 0x20, 0xe8, 0x3a, 0x18, 0x13, 0xc7, 0x65, 0xd4, 0x2c,
-	0xd4, 0x35, 0x91, 0x50, 0x39, 0x81, 0xad, 0x68, 0x02, 0x5b, 0x9b, 0xee, 0x1c, 0x4b, 0x15, 0x84,
-	0x20, 0x43, 0x19, 0xf1, 0x4d, 0x10, 0x69, 0x13, 0x67, 0x54, 0x01, 0x23, 0xb0, 0x5c, 0x9b, 0x98,
-	0x45, 0x01, 0x4a, 0x01, 0xdd, 0x82, 0xe2, 0xf3, 0x90, 0x04, 0xf3, 0x81, 0xb4, 0xbd, 0x22, 0x6c,
-	0xa3, 0x28, 0x8a, 0xc7, 0x9c, 0xda, 0xe1, 0x0c, 0x86, 0xe7, 0xf1, 0x19, 0xdd, 0x04, 0xa0, 0x13,
-	0x2b, 0x18, 0x0f, 0x1c, 0xf7, 0xc8, 0x33, 0x57, 0xc5, 0x9d, 0x45, 0x43, 0x72, 0x46, 0x4c, 0x56,
-	0x81, 0x46, 0x47, 0x74, 0x1b, 0xd6, 0x8e, 0x1d, 0x36, 0xf1, 0x42, 0x36, 0x50, 0xf3, 0x38, 0x50,
-	0xc3, 0x56, 0xaa, 0xeb, 0xcd, 0x02, 0xae, 0x28, 0x16, 0x4b, 0x52, 0x34, 0x09, 0x6d, 0xfc, 0xa1,
-	0x01, 0x2c, 0x5c, 0x10, 0x29, 0x62, 0xc4, 0x1f, 0xcc, 0x9c, 0xe9, 0xd4, 0xa1, 0xaa, 0x1d, 0x81,
-	0x43, 0x7b, 0x02, 0x41, 0x75, 0xc8, 0x1c, 0x85, 0xee, 0x48, 0x74, 0x63, 0x71, 0xd1, 0x04, 0xf7,
-	0x43, 0x77, 0x84, 0x05, 0x83, 0x6e, 0x40, 0xde, 0x0e, 0xbc, 0xd0, 0x77, 0x5c, 0x5b, 0xf4, 0x54,
-	0xb1, 0x53, 0x8e, 0xb4, 0x1e, 0x28, 0x1c, 0xc7, 0x1a, 0xe8, 0x93, 0x28, 0x65, 0x86, 0x50, 0x8d,
-	0x37, 0x02, 0xe6, 0xa0, 0xca, 0x60, 0xe3, 0x18, 0x0a, 0x71, 0xc8, 0xc2, 0x45, 0x95, 0x99, 0x31,
-	0x39, 0x89, 0x5d, 0x94, 0xfc, 0x98, 0x9c, 0xa0, 0x8f, 0x61, 0x85, 0x79, 0xcc, 0x9a, 0x0e, 0x04,
-	0x46, 0xd5, 0xe0, 0x14, 0x05, 0x26, 0xcc, 0x50, 0x54, 0x82, 0xf4, 0x70, 0x2e, 0x56, 0x40, 0x1e,
-	0xa7, 0x87, 0x73, 0xbe, 0xea, 0x54, 0xae, 0x32, 0x22, 0x57, 0x4a, 0x6a, 0x54, 0x21, 0xc3, 0x23,
-	0xe3, 0xc5, 0x76, 0x2d, 0x35, 0x9e, 0x05, 0x2c, 0xce, 0x8d, 0x0e, 0xe4, 0xa3, 0x78, 0x94, 0x3d,
-	0xed, 0x0c, 0x7b, 0x7a, 0xc2, 0xde, 0x06, 0x18, 0x22, 0x30, 0xae, 0x90, 0x48, 0xb1, 0x92, 0x1a,
-	0xbf, 0x6a, 0x50, 0x8a, 0xb6, 0x83, 0x5a, 0x9a, 0x4d, 0xc8, 0xc6, 0x5b, 0x9c, 0xa7, 0xa8, 0x14,
-	0x77, 0x81, 0x40, 0x77, 0x52, 0x58, 0xf1, 0xa8, 0x0a, 0xb9, 0x63, 0x2b, 0x70, 0x79, 0xe2, 0xc5,
-	0xc6, 0xde, 0x49, 0xe1, 0x08, 0x40, 0x37, 0xa2, 0xd6, 0xd6, 0xdf, 0xde, 0xda, 0x3b, 0x29, 0xd5,
-	0xdc, 0x5b, 0x79, 0xc8, 0x06, 0x84, 0x86, 0x53, 0xd6, 0xf8, 0x37, 0x0d, 0x97, 0x44, 0xab, 0xf4,
-	0xac, 0xd9, 0x62, 0x65, 0x9d, 0x3b, 0xe2, 0xda, 0x07, 0x8c, 0x78, 0xfa, 0x03, 0x47, 0xbc, 0x02,
-	0x06, 0x65, 0x56, 0xc0, 0xd4, 0x7a, 0x97, 0x02, 0x2a, 0x83, 0x4e, 0xdc, 0xb1, 0xda, 0x70, 0xfc,
-	0xb8, 0x98, 0x74, 0xe3, 0xdd, 0x93, 0xbe, 0xbc, 0x69, 0xb3, 0xef, 0xb1, 0x69, 0xdf, 0x3e, 0x90,
-	0xb9, 0x73, 0x06, 0x32, 0x00, 0xb4, 0x9c, 0x6f, 0xd5, 0x04, 0x15, 0x30, 0x78, 0xd3, 0xc9, 0x7f,
-	0x9c, 0x05, 0x2c, 0x05, 0x54, 0x85, 0xbc, 0xaa, 0x2f, 0xef, 0x72, 0x4e, 0xc4, 0xf2, 0x22, 0x42,
-	0xfd, 0x9d, 0x11, 0x36, 0x7e, 0xd6, 0xd5, 0xa3, 0x4f, 0xac, 0x69, 0xb8, 0xa8, 0x72, 0x05, 0x0c,
-	0xe1, 0xb0, 0x6a, 0x7b, 0x29, 0x9c, 0x5f, 0xfb, 0xf4, 0x07, 0xd4, 0x5e, 0xbf, 0xa8, 0xda, 0x67,
-	0xce, 0xa8, 0xbd, 0x71, 0x46, 0xed, 0xb3, 0xef, 0x57, 0xfb, 0xdc, 0x85, 0xd4, 0x3e, 0x7f, 0x4e,
-	0xed, 0x43, 0xb8, 0x9c, 0x28, 0x83, 0x2a, 0xfe, 0x1a, 0x64, 0x7f, 0x10, 0x88, 0xaa, 0xbe, 0x92,
-	0x2e, 0xaa, 0xfc, 0xd7, 0xbf, 0x87, 0x42, 0xfc, 0x89, 0x83, 0x8a, 0x90, 0x3b, 0xe8, 0x7d, 0xd5,
-	0x7b, 0x74, 0xd8, 0x2b, 0xa7, 0x50, 0x01, 0x8c, 0xc7, 0x07, 0x5d, 0xfc, 0x6d, 0x59, 0x43, 0x79,
-	0xc8, 0xe0, 0x83, 0x87, 0xdd, 0x72, 0x9a, 0x6b, 0xf4, 0x77, 0xef, 0x75, 0xb7, 0x37, 0x71, 0x59,
-	0xe7, 0x1a, 0xfd, 0xfd, 0x47, 0xb8, 0x5b, 0xce, 0x70, 0x1c, 0x77, 0xb7, 0xbb, 0xbb, 0x4f, 0xba,
-	0x65, 0x83, 0xe3, 0xf7, 0xba, 0x5b, 0x07, 0x0f, 0xca, 0xd9, 0xeb, 0x5b, 0x90, 0xe1, 0xdf, 0x08,
-	0x28, 0x07, 0x3a, 0xde, 0x3c, 0x94, 0x56, 0xb7, 0x1f, 0x1d, 0xf4, 0xf6, 0xcb, 0x1a, 0xc7, 0xfa,
-	0x07, 0x7b, 0xe5, 0x34, 0x3f, 0xec, 0xed, 0xf6, 0xca, 0xba, 0x38, 0x6c, 0x7e, 0x23, 0xcd, 0x09,
-	0xad, 0x2e, 0x2e, 0x1b, 0x9d, 0x1f, 0xd3, 0x60, 0x08, 0x1f, 0xd1, 0xe7, 0x90, 0x11, 0xff, 0x06,
-	0x2e, 0x47, 0x75, 0x58, 0xfa, 0xe2, 0xac, 0x56, 0x92, 0xa0, 0xca, 0xdf, 0x17, 0x90, 0x95, 0xbb,
-	0x12, 0x5d, 0x49, 0xee, 0xce, 0xe8, 0xda, 0xda, 0x69, 0x58, 0x5e, 0xbc, 0xa9, 0xa1, 0x6d, 0x80,
-	0xc5, 0x34, 0xa2, 0xf5, 0x44, 0xed, 0x97, 0x37, 0x62, 0xb5, 0x7a, 0x16, 0xa5, 0xde, 0xbf, 0x0f,
-	0xc5, 0xa5, 0xb2, 0xa2, 0xa4, 0x6a, 0x62, 0xe4, 0xaa, 0xd7, 0xce, 0xe4, 0xa4, 0x9d, 0x4e, 0x0f,
-	0x4a, 0xe2, 0x1b, 0x9f, 0xcf, 0x92, 0x4c, 0xc6, 0x5d, 0x28, 0x62, 0x32, 0xf3, 0x18, 0x11, 0x38,
-	0x8a, 0xc3, 0x5f, 0xfe, 0x29, 0x50, 0xbd, 0x72, 0x0a, 0x55, 0x3f, 0x19, 0x52, 0x5b, 0x9f, 0xbe,
-	0xf8, 0xa7, 0x96, 0x7a, 0xf1, 0xba, 0xa6, 0xbd, 0x7c, 0x5d, 0xd3, 0xfe, 0x7e, 0x5d, 0xd3, 0x7e,
-	0x7b, 0x53, 0x4b, 0xbd, 0x7c, 0x53, 0x4b, 0xfd, 0xf9, 0xa6, 0x96, 0x7a, 0x9a, 0x53, 0xbf, 0x5a,
-	0x86, 0x59, 0xd1, 0x33, 0xb7, 0xfe, 0x0b, 0x00, 0x00, 0xff, 0xff, 0xa0, 0x14, 0xa2, 0x0f, 0x1f,
-	0x0d, 0x00, 0x00,
+	// 1458 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0x5f, 0x6f, 0xdb, 0x46,
+	0x12, 0x17, 0x45, 0xfd, 0x1d, 0xf9, 0x0f, 0xb3, 0x51, 0x1c, 0x5a, 0x39, 0xd8, 0x3a, 0x1e, 0x0e,
+	0x30, 0x72, 0x39, 0x29, 0xa7, 0x04, 0x01, 0xee, 0x90, 0x17, 0xdb, 0x51, 0x62, 0xe3, 0x62, 0xbb,
+	0x59, 0xd9, 0x71, 0x9b, 0xa2, 0x20, 0x28, 0x69, 0x4d, 0x11, 0xa1, 0x48, 0x86, 0xbb, 0xaa, 0xad,
+	0xd7, 0x16, 0x7d, 0x2f, 0xfa, 0x11, 0xfa, 0x35, 0xfa, 0x05, 0xf2, 0x98, 0xc7, 0xa2, 0x0f, 0x41,
+	0x9b, 0xbc, 0xf7, 0x13, 0xf4, 0xa1, 0xd8, 0x3f, 0xa4, 0x44, 0xd7, 0x4e, 0x10, 0x24, 0x2f, 0xc2,
+	0xee, 0x6f, 0x66, 0x67, 0x67, 0xe6, 0x37, 0x33, 0x2b, 0xc2, 0x75, 0xca, 0xc2, 0x98, 0xb4, 0xc5,
+	0x6f, 0xd4, 0x6f, 0xc7, 0xd1, 0xa0, 0x15, 0xc5, 0x21, 0x0b, 0x51, 0x89, 0x8d, 0x9c, 0x20, 0xa4,
+	0x8d, 0xd5, 0xac, 0x02, 0x9b, 0x46, 0x84, 0x4a, 0x95, 0x46, 0xdd, 0x0d, 0xdd, 0x50, 0x2c, 0xdb,
+	0x7c, 0xa5, 0xd0, 0x66, 0xf6, 0x40, 0x14, 0x87, 0xe3, 0x73, 0xe7, 0x94, 0x49, 0xdf, 0xe9, 0x13,
+	0xff, 0xbc, 0xc8, 0x0d, 0x43, 0xd7, 0x27, 0x6d, 0xb1, 0xeb, 0x4f, 0x4e, 0xda, 0x4e, 0x30, 0x95,
+	0x22, 0x6b, 0x19, 0x16, 0x8f, 0x63, 0x8f, 0x11, 0x4c, 0x68, 0x14, 0x06, 0x94, 0x58, 0xdf, 0x6a,
+	0xb0, 0xa0, 0x90, 0x17, 0x13, 0x42, 0x19, 0xda, 0x04, 0x60, 0xde, 0x98, 0x50, 0x12, 0x7b, 0x84,
+	0x9a, 0x5a, 0x53, 0xdf, 0xa8, 0x75, 0x6e, 0xf0, 0xd3, 0x63, 0xc2, 0x46, 0x64, 0x42, 0xed, 0x41,
+	0x18, 0x4d, 0x5b, 0x87, 0xde, 0x98, 0xf4, 0x84, 0xca, 0x56, 0xe1, 0xe5, 0xeb, 0xf5, 0x1c, 0x9e,
+	0x3b, 0x84, 0x56, 0xa0, 0xc4, 0x48, 0xe0, 0x04, 0xcc, 0xcc, 0x37, 0xb5, 0x8d, 0x2a, 0x56, 0x3b,
+	0x64, 0x42, 0x39, 0x26, 0x91, 0xef, 0x0d, 0x1c, 0x53, 0x6f, 0x6a, 0x1b, 0x3a, 0x4e, 0xb6, 0xd6,
+	0x22, 0xd4, 0x76, 0x83, 0x93, 0x50, 0xf9, 0x60, 0xfd, 0x90, 0x87, 0x05, 0xb9, 0x97, 0x5e, 0xa2,
+	0x01, 0x94, 0x44, 0xa0, 0x89, 0x43, 0x8b, 0x2d, 0x99, 0xd8, 0xd6, 0x63, 0x8e, 0x6e, 0xdd, 0xe7,
+	0x2e, 0xfc, 0xf2, 0x7a, 0xfd, 0xae, 0xeb, 0xb1, 0xd1, 0xa4, 0xdf, 0x1a, 0x84, 0xe3, 0xb6, 0x54,
+	0xf8, 0xb7, 0x17, 0xaa, 0x55, 0x3b, 0x7a, 0xee, 0xb6, 0x33, 0x39, 0x6b, 0x3d, 0x13, 0xa7, 0xb1,
+	0x32, 0x8d, 0x56, 0xa1, 0x32, 0xf6, 0x02, 0x9b, 0x07, 0x22, 0x1c, 0xd7, 0x71, 0x79, 0xec, 0x05,
+	0x3c, 0x52, 0x21, 0x72, 0xce, 0xa4, 0x48, 0xb9, 0x3e, 0x76, 0xce, 0x84, 0xa8, 0x0d, 0x55, 0x61,
+	0xf5, 0x70, 0x1a, 0x11, 0xb3, 0xd0, 0xd4, 0x36, 0x96, 0x3a, 0x57, 0x12, 0xef, 0x7a, 0x89, 0x00,
+	0xcf, 0x74, 0xd0, 0x3d, 0x00, 0x71, 0xa1, 0x4d, 0x09, 0xa3, 0x66, 0x51, 0xc4, 0x93, 0x9e, 0x90,
+	0x2e, 0xf5, 0x08, 0x53, 0x69, 0xad, 0xfa, 0x6a, 0x4f, 0xad, 0x3f, 0x8a, 0xb0, 0x28, 0x53, 0x9e,
+	0x50, 0x35, 0xef, 0xb0, 0x76, 0xb9, 0xc3, 0xf9, 0xac, 0xc3, 0xf7, 0xb8, 0x88, 0x0d, 0x46, 0x24,
+	0xa6, 0xa6, 0x2e, 0x6e, 0xaf, 0x67, 0xb2, 0xb9, 0x27, 0x85, 0xca, 0x81, 0x54, 0x17, 0x75, 0xe0,
+	0x1a, 0x37, 0x19, 0x13, 0x1a, 0xfa, 0x13, 0xe6, 0x85, 0x81, 0x7d, 0xea, 0x05, 0xc3, 0xf0, 0x54,
+	0x04, 0xad, 0xe3, 0xab, 0x63, 0xe7, 0x0c, 0xa7, 0xb2, 0x63, 0x21, 0x42, 0xb7, 0x00, 0x1c, 0xd7,
+	0x8d, 0x89, 0xeb, 0x30, 0x22, 0x63, 0x5d, 0xea, 0x2c, 0x24, 0xb7, 0x6d, 0xba, 0x6e, 0x8c, 0xe7,
+	0xe4, 0xe8, 0x7f, 0xb0, 0x1a, 0x39, 0x31, 0xf3, 0x1c, 0xdf, 0x8e, 0x15, 0xf3, 0xf6, 0xd0, 0xa3,
+	0x4e, 0xdf, 0x27, 0x43, 0xb3, 0xd4, 0xd4, 0x36, 0x2a, 0xf8, 0xba, 0x52, 0x48, 0x2a, 0xe3, 0x81,
+	0x12, 0xa3, 0x2f, 0x2f, 0x38, 0x4b, 0x59, 0xec, 0x30, 0xe2, 0x4e, 0xcd, 0xb2, 0xa0, 0x65, 0x3d,
+	0xb9, 0xf8, 0xb3, 0xac, 0x8d, 0x9e, 0x52, 0xfb, 0x8b, 0xf1, 0x44, 0x80, 0xd6, 0xa1, 0x46, 0x9f,
+	0x7b, 0x91, 0x3d, 0x18, 0x4d, 0x82, 0xe7, 0xd4, 0xac, 0x08, 0x57, 0x80, 0x43, 0xdb, 0x02, 0x41,
+	0x37, 0xa1, 0x38, 0xf2, 0x02, 0x46, 0xcd, 0x6a, 0x53, 0x13, 0x09, 0x95, 0x1d, 0xd8, 0x4a, 0x3a,
+	0xb0, 0xb5, 0x19, 0x4c, 0xb1, 0x54, 0x41, 0x08, 0x0a, 0x94, 0x91, 0xc8, 0x04, 0x91, 0x36, 0xb1,
+	0x46, 0x75, 0x28, 0xc6, 0x4e, 0xe0, 0x12, 0xb3, 0x26, 0x40, 0xb9, 0x41, 0x77, 0xa0, 0xf6, 0x62,
+	0x42, 0xe2, 0xa9, 0x2d, 0x6d, 0x2f, 0x08, 0xdb, 0x28, 0x89, 0xe2, 0x09, 0x17, 0xed, 0x70, 0x09,
+	0x86, 0x17, 0xe9, 0x1a, 0xdd, 0x06, 0xa0, 0x23, 0x27, 0x1e, 0xda, 0x5e, 0x70, 0x12, 0x9a, 0x8b,
+	0x4d, 0x6d, 0xbe, 0xbc, 0x7a, 0x5c, 0x22, 0x3a, 0xab, 0x4a, 0x93, 0x25, 0xba, 0x0b, 0x2b, 0xa7,
+	0x1e, 0x1b, 0x85, 0x13, 0x66, 0xab, 0x7e, 0xb4, 0x55, 0xb3, 0x2d, 0x35, 0xf5, 0x8d, 0x2a, 0xae,
+	0x2b, 0x29, 0x96, 0x42, 0x51, 0x24, 0x3c, 0xe4, 0x2b, 0xb2, 0xdd, 0x6d, 0xca, 0x1c, 0x46, 0xed,
+	0x30, 0xf0, 0xa7, 0xe6, 0xb2, 0xc8, 0xcc, 0xb2, 0x14, 0xf4, 0x38, 0x7e, 0x10, 0xf8, 0x53, 0xb4,
+	0x05, 0x46, 0x42, 0x33, 0xaf, 0x1b, 0x1e, 0x8e, 0x69, 0x08, 0xcf, 0xae, 0xcf, 0x17, 0x83, 0x92,
+	0xf3, 0x38, 0xf0, 0xb2, 0x93, 0x05, 0xac, 0x1f, 0x35, 0x80, 0x59, 0xc8, 0x82, 0x12, 0x46, 0x22,
+	0x7b, 0xec, 0xf9, 0xbe, 0x47, 0x55, 0xf9, 0x03, 0x87, 0xf6, 0x04, 0x82, 0x9a, 0x50, 0x38, 0x99,
+	0x04, 0x03, 0x51, 0xfd, 0xb5, 0x59, 0xd1, 0x3d, 0x9c, 0x04, 0x03, 0x2c, 0x24, 0xe8, 0x16, 0x54,
+	0xdc, 0x38, 0x9c, 0x44, 0x5e, 0xe0, 0x8a, 0x1a, 0xae, 0x75, 0x8c, 0x44, 0xeb, 0x91, 0xc2, 0x71,
+	0xaa, 0x81, 0xfe, 0x91, 0x50, 0x54, 0x6c, 0x6a, 0xf3, 0x13, 0x08, 0x73, 0x50, 0x31, 0x66, 0x9d,
+	0x42, 0x35, 0x4d, 0xb1, 0x70, 0x51, 0x31, 0x31, 0x24, 0x67, 0xa9, 0x8b, 0x52, 0x3e, 0x24, 0x67,
+	0xe8, 0xef, 0xb0, 0xc0, 0x42, 0xe6, 0xf8, 0xb6, 0xc0, 0xa8, 0x6a, 0xd4, 0x9a, 0xc0, 0x84, 0x19,
+	0x8a, 0x96, 0x20, 0xdf, 0x9f, 0x8a, 0x91, 0x53, 0xc1, 0xf9, 0xfe, 0x94, 0x8f, 0x56, 0xc5, 0x4d,
+	0x41, 0x70, 0xa3, 0x76, 0x56, 0x03, 0x0a, 0x3c, 0x32, 0x5e, 0x5c, 0x81, 0xa3, 0xc6, 0x41, 0x15,
+	0x8b, 0xb5, 0xd5, 0x81, 0x4a, 0x12, 0x8f, 0xb2, 0xa7, 0x5d, 0x60, 0x4f, 0xcf, 0xd8, 0x5b, 0x87,
+	0xa2, 0x08, 0x8c, 0x2b, 0x64, 0x52, 0xac, 0x76, 0xd6, 0x36, 0x2c, 0x9f, 0xa3, 0x2c, 0xcd, 0xb8,
+	0x26, 0xba, 0x2d, 0xdb, 0xe6, 0x32, 0xe3, 0xf2, 0xf6, 0xbc, 0xb8, 0x29, 0xdf, 0x9f, 0x5a, 0x3f,
+	0x69, 0xb0, 0x94, 0x8c, 0x34, 0x35, 0xe9, 0x37, 0xa0, 0x94, 0x3e, 0x3d, 0x3c, 0xcf, 0x4b, 0x69,
+	0xe9, 0x0a, 0x74, 0x27, 0x87, 0x95, 0x1c, 0x35, 0xa0, 0x7c, 0xea, 0xc4, 0x01, 0x67, 0x4f, 0x3c,
+	0x33, 0x3b, 0x39, 0x9c, 0x00, 0xe8, 0x56, 0xd2, 0x8f, 0xfa, 0xe5, 0xfd, 0xb8, 0x93, 0x4b, 0x3a,
+	0xf2, 0x5f, 0x50, 0x14, 0x35, 0xac, 0xaa, 0xe0, 0x6a, 0xf6, 0x4a, 0x51, 0xc6, 0x5c, 0x59, 0xe8,
+	0x6c, 0x55, 0xa0, 0x14, 0x13, 0x3a, 0xf1, 0x99, 0x35, 0x84, 0xda, 0x9c, 0x06, 0xcf, 0xd4, 0x9c,
+	0xe7, 0x7a, 0xea, 0xe7, 0xdf, 0xa0, 0x4a, 0x28, 0xf3, 0xc6, 0x0e, 0x23, 0x43, 0xe1, 0x69, 0x05,
+	0xcf, 0x00, 0x5e, 0x24, 0xf2, 0x35, 0xe0, 0x54, 0x25, 0x2c, 0xc8, 0x07, 0x62, 0x9f, 0x23, 0xd6,
+	0xef, 0x79, 0xb8, 0xf2, 0x38, 0xdd, 0x26, 0xa3, 0xff, 0x9d, 0xa3, 0x52, 0xfb, 0x88, 0x51, 0x99,
+	0xff, 0xc8, 0x51, 0x59, 0x17, 0xb9, 0x8c, 0x99, 0x7a, 0x26, 0xe5, 0x06, 0x19, 0xa0, 0x93, 0x60,
+	0xa8, 0x5e, 0x0a, 0xbe, 0x9c, 0x4d, 0xcc, 0xe2, 0xfb, 0x27, 0xe6, 0xfc, 0x8b, 0x55, 0xfa, 0x80,
+	0x17, 0xeb, 0xf2, 0xc1, 0x56, 0xbe, 0x7c, 0xb0, 0x59, 0x31, 0xa0, 0xf9, 0x7c, 0xab, 0xba, 0xac,
+	0x43, 0x51, 0x32, 0xa4, 0x89, 0xa3, 0x72, 0x83, 0x1a, 0x50, 0x51, 0x25, 0x47, 0x55, 0x59, 0xa7,
+	0xfb, 0x59, 0x84, 0xfa, 0x7b, 0x23, 0xb4, 0xbe, 0xd3, 0xd5, 0xa5, 0x4f, 0x1d, 0x7f, 0x32, 0x63,
+	0xb9, 0x0e, 0x45, 0xe1, 0xb0, 0x6a, 0x67, 0xb9, 0x79, 0x37, 0xf7, 0xf9, 0x8f, 0xe0, 0x5e, 0xff,
+	0x54, 0xdc, 0x17, 0x2e, 0xe0, 0xbe, 0x78, 0x01, 0xf7, 0xa5, 0x0f, 0xe3, 0xbe, 0xfc, 0x49, 0xb8,
+	0xaf, 0xbc, 0x83, 0xfb, 0x09, 0x5c, 0xcd, 0xd0, 0xa0, 0xc8, 0x5f, 0x81, 0xd2, 0xd7, 0x02, 0x51,
+	0xec, 0xab, 0xdd, 0xa7, 0xa2, 0xff, 0xe6, 0x57, 0x50, 0x4d, 0xff, 0x2a, 0xa2, 0x1a, 0x94, 0x8f,
+	0xf6, 0xff, 0xbf, 0x7f, 0x70, 0xbc, 0x6f, 0xe4, 0x50, 0x15, 0x8a, 0x4f, 0x8e, 0xba, 0xf8, 0x0b,
+	0x43, 0x43, 0x15, 0x28, 0xe0, 0xa3, 0xc7, 0x5d, 0x23, 0xcf, 0x35, 0x7a, 0xbb, 0x0f, 0xba, 0xdb,
+	0x9b, 0xd8, 0xd0, 0xb9, 0x46, 0xef, 0xf0, 0x00, 0x77, 0x8d, 0x02, 0xc7, 0x71, 0x77, 0xbb, 0xbb,
+	0xfb, 0xb4, 0x6b, 0x14, 0x39, 0xfe, 0xa0, 0xbb, 0x75, 0xf4, 0xc8, 0x28, 0xdd, 0xdc, 0x82, 0x02,
+	0x1f, 0xc2, 0xa8, 0x0c, 0x3a, 0xde, 0x3c, 0x96, 0x56, 0xb7, 0x0f, 0x8e, 0xf6, 0x0f, 0x0d, 0x8d,
+	0x63, 0xbd, 0xa3, 0x3d, 0x23, 0xcf, 0x17, 0x7b, 0xbb, 0xfb, 0x86, 0x2e, 0x16, 0x9b, 0x9f, 0x4b,
+	0x73, 0x42, 0xab, 0x8b, 0x8d, 0x62, 0xe7, 0x9b, 0x3c, 0x14, 0x85, 0x8f, 0xe8, 0x3f, 0x50, 0x10,
+	0xcf, 0x5b, 0x3a, 0x26, 0xe7, 0xfe, 0xb9, 0x37, 0xea, 0x59, 0x50, 0xe5, 0xef, 0xbf, 0x50, 0x92,
+	0x93, 0x12, 0x5d, 0xcb, 0xce, 0xd6, 0xe4, 0xd8, 0xca, 0x79, 0x58, 0x1e, 0xbc, 0xad, 0xa1, 0x6d,
+	0x80, 0x59, 0x37, 0xa2, 0xd5, 0x0c, 0xf7, 0xf3, 0x13, 0xb1, 0xd1, 0xb8, 0x48, 0xa4, 0xee, 0x7f,
+	0x08, 0xb5, 0x39, 0x5a, 0x51, 0x56, 0x35, 0xd3, 0x72, 0x8d, 0x1b, 0x17, 0xca, 0xa4, 0x9d, 0xce,
+	0x3e, 0x2c, 0x89, 0x6f, 0x25, 0xde, 0x4b, 0x32, 0x19, 0xf7, 0xa1, 0x86, 0xc9, 0x38, 0x64, 0x44,
+	0xe0, 0x28, 0x0d, 0x7f, 0xfe, 0x93, 0xaa, 0x71, 0xed, 0x1c, 0xaa, 0x3e, 0xbd, 0x72, 0x5b, 0xff,
+	0x7c, 0xf9, 0xdb, 0x5a, 0xee, 0xe5, 0x9b, 0x35, 0xed, 0xd5, 0x9b, 0x35, 0xed, 0xd7, 0x37, 0x6b,
+	0xda, 0xf7, 0x6f, 0xd7, 0x72, 0xaf, 0xde, 0xae, 0xe5, 0x7e, 0x7e, 0xbb, 0x96, 0x7b, 0x56, 0x56,
+	0x5f, 0x7f, 0xfd, 0x92, 0xa8, 0x99, 0x3b, 0x7f, 0x0e, 0x00, 0xee, 0x49, 0x9c, 0xf9, 0x67, 0x0e,
+	0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1436,6 +1552,30 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.AggregationHint != nil {
+		{
+			size, err := m.AggregationHint.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x82
+	}
+	if m.SeriesStatsOnly {
+		i--
+		if m.SeriesStatsOnly {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x78
+	}
 	if len(m.WithoutReplicaLabels) > 0 {
 		for iNdEx := len(m.WithoutReplicaLabels) - 1; iNdEx >= 0; iNdEx-- {
 			i -= len(m.WithoutReplicaLabels[iNdEx])
@@ -1782,6 +1922,43 @@ func (m *Range) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *AggregationHint) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *AggregationHint) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *AggregationHint) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.By) > 0 {
+		for iNdEx := len(m.By) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.By[iNdEx])
+			copy(dAtA[i:], m.By[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.By[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if m.Func != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Func))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *SeriesResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1870,6 +2047,74 @@ func (m *SeriesResponse_Hints) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	}
 	return len(dAtA) - i, nil
 }
+func (m *SeriesResponse_Stats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SeriesResponse_Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	if m.Stats != nil {
+		{
+			size, err := m.Stats.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x22
+	}
+	return len(dAtA) - i, nil
+}
+func (m *SeriesStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SeriesStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SeriesStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.LabelNames) > 0 {
+		for iNdEx := len(m.LabelNames) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.LabelNames[iNdEx])
+			copy(dAtA[i:], m.LabelNames[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.LabelNames[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.Estimated {
+		i--
+		if m.Estimated {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Series != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Series))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *LabelNamesRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -2291,6 +2536,13 @@ func (m *SeriesRequest) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.SeriesStatsOnly {
+		n += 2
+	}
+	if m.AggregationHint != nil {
+		l = m.AggregationHint.Size()
+		n += 2 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -2385,6 +2637,24 @@ func (m *Range) Size() (n int) {
 	return n
 }
 
+func (m *AggregationHint) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Func != 0 {
+		n += 1 + sovRpc(uint64(m.Func))
+	}
+	if len(m.By) > 0 {
+		for _, s := range m.By {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
 func (m *SeriesResponse) Size() (n int) {
 	if m == nil {
 		return 0
@@ -2431,6 +2701,39 @@ func (m *SeriesResponse_Hints) Size() (n int) {
 	}
 	return n
 }
+func (m *SeriesResponse_Stats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Stats != nil {
+		l = m.Stats.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	return n
+}
+func (m *SeriesStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Series != 0 {
+		n += 1 + sovRpc(uint64(m.Series))
+	}
+	if m.Estimated {
+		n += 2
+	}
+	if len(m.LabelNames) > 0 {
+		for _, s := range m.LabelNames {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
 func (m *LabelNamesRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -3401,6 +3704,62 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 			}
 			m.WithoutReplicaLabels = append(m.WithoutReplicaLabels, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 15:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesStatsOnly", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SeriesStatsOnly = bool(v != 0)
+		case 16:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AggregationHint", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.AggregationHint == nil {
+				m.AggregationHint = &AggregationHint{}
+			}
+			if err := m.AggregationHint.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -3992,6 +4351,107 @@ func (m *Range) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *AggregationHint) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: AggregationHint: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: AggregationHint: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Func", wireType)
+			}
+			m.Func = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Func |= Aggr(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field By", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.By = append(m.By, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *SeriesResponse) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -4123,6 +4583,162 @@ func (m *SeriesResponse) Unmarshal(dAtA []byte) error {
 			}
 			m.Result = &SeriesResponse_Hints{v}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Stats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &SeriesStats{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Result = &SeriesResponse_Stats{v}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SeriesStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SeriesStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SeriesStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Series", wireType)
+			}
+			m.Series = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Series |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Estimated", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Estimated = bool(v != 0)
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LabelNames", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LabelNames = append(m.LabelNames, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -33,6 +33,8 @@ func (s *ShardMatcher) Close() {
 		return
 	}
 	if s.buffers != nil {
+		// The pool is shared with other users expecting empty buffers.
+		*s.buf = (*s.buf)[:0]
 		s.buffers.Put(s.buf)
 	}
 }
@@ -19,6 +19,7 @@ type TestClient struct {
 	MinTime, MaxTime            int64
 	Shardable                   bool
 	WithoutReplicaLabelsEnabled bool
+	TimeFilteringEnabled        bool
 	IsLocalStore                bool
 	StoreTSDBInfos              []infopb.TSDBInfo
 }
@@ -28,5 +29,6 @@ func (c TestClient) TimeRange() (mint, maxt int64)      { return c.MinTime, c.Ma
 func (c TestClient) TSDBInfos() []infopb.TSDBInfo       { return c.StoreTSDBInfos }
 func (c TestClient) SupportsSharding() bool             { return c.Shardable }
 func (c TestClient) SupportsWithoutReplicaLabels() bool { return c.WithoutReplicaLabelsEnabled }
+func (c TestClient) SupportsTimeFiltering() bool        { return c.TimeFilteringEnabled }
 func (c TestClient) String() string                     { return c.Name }
 func (c TestClient) Addr() (string, bool)               { return c.Name, c.IsLocalStore }
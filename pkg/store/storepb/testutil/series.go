@@ -269,6 +269,7 @@ type SeriesServer struct {
 	SeriesSet []*storepb.Series
 	Warnings  []string
 	HintsSet  []*types.Any
+	StatsSet  []*storepb.SeriesStats
 
 	Size int64
 }
@@ -294,6 +295,11 @@ func (s *SeriesServer) Send(r *storepb.SeriesResponse) error {
 		s.HintsSet = append(s.HintsSet, r.GetHints())
 		return nil
 	}
+
+	if r.GetStats() != nil {
+		s.StatsSet = append(s.StatsSet, r.GetStats())
+		return nil
+	}
 	// Unsupported field, skip.
 	return nil
 }
@@ -0,0 +1,392 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package writev2pb implements the io.prometheus.write.v2.Request message of the Prometheus Remote Write 2.0
+// protocol, and its conversion to the Remote Write 1.0 prompb.WriteRequest the receivers handle internally.
+//
+// The messages are encoded and decoded by hand, as the protocol is not part of the vendored Prometheus version.
+// Samples and native histograms have the same wire format in both versions of the protocol, they are decoded
+// into their prompb equivalent directly.
+package writev2pb
+
+import (
+	"math"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// ProtoMessage is the name of the Remote Write 2.0 message, as set in the proto parameter of the content type of
+// the requests.
+const ProtoMessage = "io.prometheus.write.v2.Request"
+
+// Request is a Remote Write 2.0 request. Label names and values, help texts and units are references to its
+// symbols table.
+type Request struct {
+	Symbols    []string
+	Timeseries []TimeSeries
+}
+
+// TimeSeries is a series of a Remote Write 2.0 request.
+type TimeSeries struct {
+	// LabelsRefs are pairs of references to the symbols of the name and value of each label.
+	LabelsRefs       []uint32
+	Samples          []prompb.Sample
+	Histograms       []prompb.Histogram
+	Exemplars        []Exemplar
+	Metadata         Metadata
+	CreatedTimestamp int64
+}
+
+// Exemplar is an exemplar of a Remote Write 2.0 series.
+type Exemplar struct {
+	LabelsRefs []uint32
+	Value      float64
+	Timestamp  int64
+}
+
+// Metadata is the metadata of a Remote Write 2.0 series. Its types have the same values as the Remote Write 1.0
+// metric types.
+type Metadata struct {
+	Type    prompb.MetricMetadata_MetricType
+	HelpRef uint32
+	UnitRef uint32
+}
+
+// Unmarshal decodes the protobuf encoded request.
+func (r *Request) Unmarshal(b []byte) error {
+	*r = Request{}
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 4:
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of symbols", typ)
+			}
+			r.Symbols = append(r.Symbols, string(v))
+		case 5:
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of timeseries", typ)
+			}
+			var ts TimeSeries
+			if err := ts.unmarshal(v); err != nil {
+				return errors.Wrapf(err, "timeseries %d", len(r.Timeseries))
+			}
+			r.Timeseries = append(r.Timeseries, ts)
+		}
+		return nil
+	})
+}
+
+func (ts *TimeSeries) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		var err error
+		switch num {
+		case 1:
+			ts.LabelsRefs, err = appendUint32s(ts.LabelsRefs, typ, v, n)
+			return errors.Wrap(err, "labels refs")
+		case 2:
+			var s prompb.Sample
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of samples", typ)
+			}
+			if err := proto.Unmarshal(v, &s); err != nil {
+				return errors.Wrap(err, "sample")
+			}
+			ts.Samples = append(ts.Samples, s)
+		case 3:
+			var h prompb.Histogram
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of histograms", typ)
+			}
+			if err := proto.Unmarshal(v, &h); err != nil {
+				return errors.Wrap(err, "histogram")
+			}
+			ts.Histograms = append(ts.Histograms, h)
+		case 4:
+			var e Exemplar
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of exemplars", typ)
+			}
+			if err := e.unmarshal(v); err != nil {
+				return errors.Wrap(err, "exemplar")
+			}
+			ts.Exemplars = append(ts.Exemplars, e)
+		case 5:
+			if typ != protowire.BytesType {
+				return errors.Errorf("invalid wire type %d of metadata", typ)
+			}
+			return errors.Wrap(ts.Metadata.unmarshal(v), "metadata")
+		case 6:
+			if typ != protowire.VarintType {
+				return errors.Errorf("invalid wire type %d of created timestamp", typ)
+			}
+			ts.CreatedTimestamp = int64(n)
+		}
+		return nil
+	})
+}
+
+func (e *Exemplar) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		var err error
+		switch num {
+		case 1:
+			e.LabelsRefs, err = appendUint32s(e.LabelsRefs, typ, v, n)
+			return errors.Wrap(err, "labels refs")
+		case 2:
+			if typ != protowire.Fixed64Type {
+				return errors.Errorf("invalid wire type %d of value", typ)
+			}
+			e.Value = math.Float64frombits(n)
+		case 3:
+			if typ != protowire.VarintType {
+				return errors.Errorf("invalid wire type %d of timestamp", typ)
+			}
+			e.Timestamp = int64(n)
+		}
+		return nil
+	})
+}
+
+func (m *Metadata) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) error {
+		if num != 1 && num != 3 && num != 4 {
+			return nil
+		}
+		if typ != protowire.VarintType {
+			return errors.Errorf("invalid wire type %d of field %d", typ, num)
+		}
+		switch num {
+		case 1:
+			m.Type = prompb.MetricMetadata_MetricType(n)
+		case 3:
+			m.HelpRef = uint32(n)
+		case 4:
+			m.UnitRef = uint32(n)
+		}
+		return nil
+	})
+}
+
+// forEachField calls f with each field of the protobuf message b. Length-delimited fields are passed as v,
+// varint, fixed32 and fixed64 ones as n. Groups are not supported.
+func forEachField(b []byte, f func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		var (
+			v []byte
+			n uint64
+		)
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, l = protowire.ConsumeFixed32(b)
+			n = uint64(n32)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			return errors.Errorf("unsupported wire type %d of field %d", typ, num)
+		}
+		if l < 0 {
+			return errors.Wrapf(protowire.ParseError(l), "field %d", num)
+		}
+		b = b[l:]
+
+		if err := f(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUint32s appends a repeated uint32 field, packed or not, to refs.
+func appendUint32s(refs []uint32, typ protowire.Type, v []byte, n uint64) ([]uint32, error) {
+	switch typ {
+	case protowire.VarintType:
+		return append(refs, uint32(n)), nil
+	case protowire.BytesType:
+		for len(v) > 0 {
+			n, l := protowire.ConsumeVarint(v)
+			if l < 0 {
+				return nil, protowire.ParseError(l)
+			}
+			refs = append(refs, uint32(n))
+			v = v[l:]
+		}
+		return refs, nil
+	default:
+		return nil, errors.Errorf("invalid wire type %d", typ)
+	}
+}
+
+// Marshal encodes the request in protobuf.
+func (r *Request) Marshal() ([]byte, error) {
+	var b []byte
+	for _, s := range r.Symbols {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	for _, ts := range r.Timeseries {
+		tsb, err := ts.marshal()
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, tsb)
+	}
+	return b, nil
+}
+
+func (ts *TimeSeries) marshal() ([]byte, error) {
+	b := appendPackedUint32s(nil, 1, ts.LabelsRefs)
+	for i := range ts.Samples {
+		sb, err := proto.Marshal(&ts.Samples[i])
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	for i := range ts.Histograms {
+		hb, err := proto.Marshal(&ts.Histograms[i])
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, hb)
+	}
+	for _, e := range ts.Exemplars {
+		eb := appendPackedUint32s(nil, 1, e.LabelsRefs)
+		eb = protowire.AppendTag(eb, 2, protowire.Fixed64Type)
+		eb = protowire.AppendFixed64(eb, math.Float64bits(e.Value))
+		eb = protowire.AppendTag(eb, 3, protowire.VarintType)
+		eb = protowire.AppendVarint(eb, uint64(e.Timestamp))
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, eb)
+	}
+
+	var mb []byte
+	for _, f := range []struct {
+		num protowire.Number
+		v   uint64
+	}{{1, uint64(ts.Metadata.Type)}, {3, uint64(ts.Metadata.HelpRef)}, {4, uint64(ts.Metadata.UnitRef)}} {
+		if f.v != 0 {
+			mb = protowire.AppendTag(mb, f.num, protowire.VarintType)
+			mb = protowire.AppendVarint(mb, f.v)
+		}
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, mb)
+
+	if ts.CreatedTimestamp != 0 {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(ts.CreatedTimestamp))
+	}
+	return b, nil
+}
+
+func appendPackedUint32s(b []byte, num protowire.Number, refs []uint32) []byte {
+	if len(refs) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, ref := range refs {
+		packed = protowire.AppendVarint(packed, uint64(ref))
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+// ToV1 converts the request to a Remote Write 1.0 request, resolving the references to its symbols. The metadata
+// of the series is converted to the metadata of their metric family. Created timestamps are not supported by the
+// 1.0 protocol: they are dropped.
+func (r *Request) ToV1() (*prompb.WriteRequest, error) {
+	wreq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(r.Timeseries))}
+	metadata := map[string]struct{}{}
+	for i, ts := range r.Timeseries {
+		lbls, err := r.labels(ts.LabelsRefs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "labels of timeseries %d", i)
+		}
+		v1 := prompb.TimeSeries{
+			Labels:     lbls,
+			Samples:    ts.Samples,
+			Histograms: ts.Histograms,
+		}
+		for j, e := range ts.Exemplars {
+			elbls, err := r.labels(e.LabelsRefs)
+			if err != nil {
+				return nil, errors.Wrapf(err, "labels of exemplar %d of timeseries %d", j, i)
+			}
+			v1.Exemplars = append(v1.Exemplars, prompb.Exemplar{Labels: elbls, Value: e.Value, Timestamp: e.Timestamp})
+		}
+		wreq.Timeseries = append(wreq.Timeseries, v1)
+
+		if ts.Metadata == (Metadata{}) {
+			continue
+		}
+		help, err := r.symbol(ts.Metadata.HelpRef)
+		if err != nil {
+			return nil, errors.Wrapf(err, "help of timeseries %d", i)
+		}
+		unit, err := r.symbol(ts.Metadata.UnitRef)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unit of timeseries %d", i)
+		}
+		name := labelpb.ZLabelsToPromLabels(lbls).Get("__name__")
+		if _, ok := metadata[name]; ok || name == "" {
+			continue
+		}
+		metadata[name] = struct{}{}
+		wreq.Metadata = append(wreq.Metadata, prompb.MetricMetadata{
+			Type:             ts.Metadata.Type,
+			MetricFamilyName: name,
+			Help:             help,
+			Unit:             unit,
+		})
+	}
+	return wreq, nil
+}
+
+func (r *Request) labels(refs []uint32) ([]labelpb.ZLabel, error) {
+	if len(refs)%2 != 0 {
+		return nil, errors.Errorf("odd number of labels refs %d", len(refs))
+	}
+	lbls := make([]labelpb.ZLabel, 0, len(refs)/2)
+	for i := 0; i < len(refs); i += 2 {
+		name, err := r.symbol(refs[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.symbol(refs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		lbls = append(lbls, labelpb.ZLabel{Name: name, Value: value})
+	}
+	return lbls, nil
+}
+
+func (r *Request) symbol(ref uint32) (string, error) {
+	if ref == 0 && len(r.Symbols) == 0 {
+		// The first symbol is always the empty string.
+		return "", nil
+	}
+	if int(ref) >= len(r.Symbols) {
+		return "", errors.Errorf("symbol reference %d out of the %d symbols", ref, len(r.Symbols))
+	}
+	return r.Symbols[ref], nil
+}
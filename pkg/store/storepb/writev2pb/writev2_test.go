@@ -0,0 +1,107 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package writev2pb
+
+import (
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+func TestRequest_MarshalUnmarshal(t *testing.T) {
+	req := &Request{
+		Symbols: []string{"", "__name__", "http_requests_total", "job", "api", "trace_id", "abc", "Total requests.", "requests"},
+		Timeseries: []TimeSeries{
+			{
+				LabelsRefs: []uint32{1, 2, 3, 4},
+				Samples:    []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 2, Timestamp: 20}},
+				Exemplars:  []Exemplar{{LabelsRefs: []uint32{5, 6}, Value: 1, Timestamp: 10}},
+				Metadata: Metadata{
+					Type:    prompb.MetricMetadata_COUNTER,
+					HelpRef: 7,
+					UnitRef: 8,
+				},
+				CreatedTimestamp: 5,
+			},
+			{
+				LabelsRefs: []uint32{3, 4},
+				Histograms: []prompb.Histogram{{
+					Count:          &prompb.Histogram_CountInt{CountInt: 3},
+					ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+					Sum:            4,
+					Schema:         1,
+					PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}},
+					PositiveDeltas: []int64{1, 0},
+					Timestamp:      30,
+				}},
+			},
+		},
+	}
+
+	b, err := req.Marshal()
+	testutil.Ok(t, err)
+
+	var got Request
+	testutil.Ok(t, got.Unmarshal(b))
+	testutil.Equals(t, req.Symbols, got.Symbols)
+	testutil.Equals(t, len(req.Timeseries), len(got.Timeseries))
+	testutil.Equals(t, req.Timeseries[0], got.Timeseries[0])
+	testutil.Equals(t, req.Timeseries[1].LabelsRefs, got.Timeseries[1].LabelsRefs)
+	testutil.Equals(t, req.Timeseries[1].Histograms[0].String(), got.Timeseries[1].Histograms[0].String())
+
+	v1, err := got.ToV1()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(v1.Timeseries))
+	testutil.Equals(t, []labelpb.ZLabel{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}}, v1.Timeseries[0].Labels)
+	testutil.Equals(t, req.Timeseries[0].Samples, v1.Timeseries[0].Samples)
+	testutil.Equals(t, []prompb.Exemplar{{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "abc"}}, Value: 1, Timestamp: 10}}, v1.Timeseries[0].Exemplars)
+	testutil.Equals(t, []prompb.MetricMetadata{{
+		Type:             prompb.MetricMetadata_COUNTER,
+		MetricFamilyName: "http_requests_total",
+		Help:             "Total requests.",
+		Unit:             "requests",
+	}}, v1.Metadata)
+	testutil.Equals(t, []labelpb.ZLabel{{Name: "job", Value: "api"}}, v1.Timeseries[1].Labels)
+	testutil.Equals(t, 1, len(v1.Timeseries[1].Histograms))
+}
+
+func TestRequest_UnpackedLabelsRefs(t *testing.T) {
+	var ts []byte
+	for _, ref := range []uint32{1, 2} {
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(ref))
+	}
+	var b []byte
+	for _, s := range []string{"", "a", "b"} {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, ts)
+
+	var req Request
+	testutil.Ok(t, req.Unmarshal(b))
+	v1, err := req.ToV1()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []labelpb.ZLabel{{Name: "a", Value: "b"}}, v1.Timeseries[0].Labels)
+}
+
+func TestRequest_Invalid(t *testing.T) {
+	var req Request
+	testutil.NotOk(t, req.Unmarshal([]byte{0xff}))
+
+	for _, req := range []*Request{
+		{Symbols: []string{"", "a"}, Timeseries: []TimeSeries{{LabelsRefs: []uint32{1}}}},
+		{Symbols: []string{"", "a"}, Timeseries: []TimeSeries{{LabelsRefs: []uint32{1, 2}}}},
+		{Symbols: []string{"", "a", "b"}, Timeseries: []TimeSeries{{LabelsRefs: []uint32{1, 2}, Exemplars: []Exemplar{{LabelsRefs: []uint32{1, 3}}}}}},
+		{Symbols: []string{"", "a", "b"}, Timeseries: []TimeSeries{{LabelsRefs: []uint32{1, 2}, Metadata: Metadata{HelpRef: 3}}}},
+	} {
+		_, err := req.ToV1()
+		testutil.NotOk(t, err)
+	}
+}
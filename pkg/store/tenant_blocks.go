@@ -0,0 +1,69 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/block"
+)
+
+// TenantBlockSelectorsConfig is the configuration of the blocks the requests of every tenant can touch.
+type TenantBlockSelectorsConfig struct {
+	// Tenants are the relabel configs selecting the blocks of every tenant, applied to the external labels of the
+	// blocks and to their ID as the __block_id label. Blocks whose labels are dropped are not selected.
+	Tenants map[string][]*relabel.Config `yaml:"tenants"`
+	// Default are the relabel configs of the tenants without relabel configs. All blocks are selected for these tenants
+	// if it isn't set.
+	Default []*relabel.Config `yaml:"default"`
+}
+
+// TenantBlockSelectors select the blocks the requests of every tenant, as set in the gRPC metadata, can touch, e.g. to
+// isolate the data of tenants sharing a store gateway.
+type TenantBlockSelectors struct {
+	tenants  map[string][]*relabel.Config
+	defaults []*relabel.Config
+}
+
+// ParseTenantBlockSelectors parses the given YAML TenantBlockSelectorsConfig.
+func ParseTenantBlockSelectors(content []byte) (*TenantBlockSelectors, error) {
+	var conf TenantBlockSelectorsConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing tenant block selectors configuration")
+	}
+	for tenant, cfgs := range conf.Tenants {
+		if err := validateSelectorActions(cfgs); err != nil {
+			return nil, errors.Wrapf(err, "tenant %s", tenant)
+		}
+	}
+	if err := validateSelectorActions(conf.Default); err != nil {
+		return nil, errors.Wrap(err, "default")
+	}
+	return &TenantBlockSelectors{tenants: conf.Tenants, defaults: conf.Default}, nil
+}
+
+func validateSelectorActions(cfgs []*relabel.Config) error {
+	for _, cfg := range cfgs {
+		if _, ok := block.SelectorSupportedRelabelActions[cfg.Action]; !ok {
+			return errors.Errorf("unsupported relabel action: %v", cfg.Action)
+		}
+	}
+	return nil
+}
+
+// selects returns true if the given tenant can touch the block with the given relabel labels.
+func (s *TenantBlockSelectors) selects(tenant string, relabelLabels labels.Labels) bool {
+	if s == nil {
+		return true
+	}
+	cfgs, ok := s.tenants[tenant]
+	if !ok {
+		cfgs = s.defaults
+	}
+	processed, _ := relabel.Process(relabelLabels, cfgs...)
+	return !processed.IsEmpty()
+}
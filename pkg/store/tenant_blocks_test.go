@@ -0,0 +1,151 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+	gmetadata "google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+	"github.com/thanos-io/thanos/pkg/testutil/custom"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestParseTenantBlockSelectors(t *testing.T) {
+	_, err := ParseTenantBlockSelectors([]byte(`
+tenants:
+  a:
+    - action: replace
+      target_label: tenant_id
+      replacement: b
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseTenantBlockSelectors([]byte(`tenant: {}`))
+	testutil.NotOk(t, err)
+
+	selectors, err := ParseTenantBlockSelectors([]byte(`
+tenants:
+  a:
+    - action: keep
+      source_labels: [tenant_id]
+      regex: a
+`))
+	testutil.Ok(t, err)
+
+	lsetA := labels.FromStrings("tenant_id", "a", block.BlockIDLabel, "01")
+	lsetB := labels.FromStrings("tenant_id", "b", block.BlockIDLabel, "02")
+	testutil.Assert(t, selectors.selects("a", lsetA))
+	testutil.Assert(t, !selectors.selects("a", lsetB))
+	// All blocks are selected for the tenants which aren't listed, without default relabel configs.
+	testutil.Assert(t, selectors.selects("b", lsetA))
+
+	var nilSelectors *TenantBlockSelectors
+	testutil.Assert(t, nilSelectors.selects("a", lsetB))
+}
+
+func TestBucketStore_TenantBlockSelectors(t *testing.T) {
+	defer custom.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	for _, tenant := range []string{"a", "b"} {
+		id, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", tenant)}, 10, 0, 1000, labels.FromStrings("tenant_id", tenant), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+	}
+
+	selectors, err := ParseTenantBlockSelectors([]byte(`
+tenants:
+  a:
+    - action: keep
+      source_labels: [tenant_id]
+      regex: a
+  admin: []
+default:
+  - action: drop
+    source_labels: [__block_id]
+    regex: .*
+`))
+	testutil.Ok(t, err)
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, block.NewConcurrentLister(logger, bkt), "", nil, nil)
+	testutil.Ok(t, err)
+
+	bucketStore, err := NewBucketStore(
+		bkt,
+		metaFetcher,
+		t.TempDir(),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewBytesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithFilterConfig(allowAllFilterConf),
+		WithTenantBlockSelectors(selectors),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bucketStore.Close()) }()
+	testutil.Ok(t, bucketStore.SyncBlocks(ctx))
+
+	for _, tcase := range []struct {
+		tenant string
+		values []string
+	}{
+		{tenant: "a", values: []string{"a"}},
+		{tenant: "admin", values: []string{"a", "b"}},
+		{tenant: "b", values: nil},
+		// Requests without tenant are the default tenant's.
+		{tenant: "", values: nil},
+	} {
+		t.Run(tcase.tenant, func(t *testing.T) {
+			tctx := ctx
+			if tcase.tenant != "" {
+				tctx = gmetadata.NewIncomingContext(ctx, gmetadata.Pairs(tenancy.DefaultTenantHeader, tcase.tenant))
+			}
+
+			srv := storetestutil.NewSeriesServer(tctx)
+			testutil.Ok(t, bucketStore.Series(&storepb.SeriesRequest{
+				MinTime:  0,
+				MaxTime:  1000,
+				Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: ".+"}},
+			}, srv))
+			var values []string
+			for _, s := range srv.SeriesSet {
+				values = append(values, labelpb.ZLabelsToPromLabels(s.Labels).Get("a"))
+			}
+			testutil.Equals(t, tcase.values, values)
+
+			names, err := bucketStore.LabelNames(tctx, &storepb.LabelNamesRequest{Start: 0, End: 1000})
+			testutil.Ok(t, err)
+			testutil.Equals(t, len(tcase.values) > 0, len(names.Names) > 0)
+
+			vals, err := bucketStore.LabelValues(tctx, &storepb.LabelValuesRequest{Label: "a", Start: 0, End: 1000})
+			testutil.Ok(t, err)
+			testutil.Equals(t, len(tcase.values), len(vals.Values))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"hash"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// filterChunksByTime slices the chunks of the given series overlapping the start or the end of the [mint, maxt]
+// range, re-encoding only their samples within the range, and drops the chunks without any. The series is returned
+// as is if all its chunks are within the range.
+func filterChunksByTime(s *storepb.Series, mint, maxt int64, calculateChecksum bool) (*storepb.Series, bool, error) {
+	if chunksWithinTimeRange(s.Chunks, mint, maxt) {
+		return s, false, nil
+	}
+
+	hasher := hashPool.Get().(hash.Hash64)
+	defer hashPool.Put(hasher)
+
+	filtered := &storepb.Series{Labels: s.Labels, Chunks: make([]storepb.AggrChunk, 0, len(s.Chunks))}
+	for _, c := range s.Chunks {
+		if c.MinTime >= mint && c.MaxTime <= maxt {
+			filtered.Chunks = append(filtered.Chunks, c)
+			continue
+		}
+		if c.MaxTime < mint || c.MinTime > maxt {
+			continue
+		}
+
+		var (
+			out    = storepb.AggrChunk{MinTime: c.MinTime, MaxTime: c.MaxTime}
+			hasAny bool
+		)
+		for _, f := range []struct {
+			in      *storepb.Chunk
+			out     **storepb.Chunk
+			counter bool
+		}{
+			{in: c.Raw, out: &out.Raw},
+			{in: c.Count, out: &out.Count},
+			{in: c.Sum, out: &out.Sum},
+			{in: c.Min, out: &out.Min},
+			{in: c.Max, out: &out.Max},
+			{in: c.Counter, out: &out.Counter, counter: true},
+		} {
+			if f.in == nil {
+				continue
+			}
+			chk, first, last, err := sliceChunk(f.in, mint, maxt, f.counter)
+			if err != nil {
+				return nil, false, err
+			}
+			if chk == nil {
+				continue
+			}
+			b := chk.Bytes()
+			*f.out = &storepb.Chunk{Type: f.in.Type, Data: b, Hash: hashChunk(hasher, b, calculateChecksum)}
+			// All the aggregates of a downsampled chunk have the same timestamps.
+			if !hasAny {
+				out.MinTime, out.MaxTime = first, last
+				hasAny = true
+			}
+		}
+		if hasAny {
+			filtered.Chunks = append(filtered.Chunks, out)
+		}
+	}
+	return filtered, true, nil
+}
+
+// chunksWithinTimeRange returns true if all the given chunks only hold samples within the [mint, maxt] range.
+func chunksWithinTimeRange(chks []storepb.AggrChunk, mint, maxt int64) bool {
+	for _, c := range chks {
+		if c.MinTime < mint || c.MaxTime > maxt {
+			return false
+		}
+	}
+	return true
+}
+
+// sliceChunk returns a chunk of the same encoding as the given one with its samples within the [mint, maxt] range,
+// and the timestamps of the first and last of them, or a nil chunk if there are none. The last sample of counter
+// aggregates is duplicated when the chunk is cut before its end, as the last sample of downsampled counter chunks
+// holds the last raw value.
+func sliceChunk(in *storepb.Chunk, mint, maxt int64, counter bool) (chunkenc.Chunk, int64, int64, error) {
+	chk, err := chunkenc.FromData(chunkenc.Encoding(in.Type+1), in.Data)
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "decode chunk")
+	}
+	out, err := chunkenc.NewEmptyChunk(chk.Encoding())
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "create chunk")
+	}
+	app, err := out.Appender()
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "get appender")
+	}
+
+	var (
+		n           int
+		first, last int64
+		lastV       float64
+		cut         bool
+	)
+	it := chk.Iterator(nil)
+	for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+		t := it.AtT()
+		if t < mint {
+			continue
+		}
+		if t > maxt {
+			cut = true
+			break
+		}
+
+		var (
+			newChk    chunkenc.Chunk
+			isRecoded bool
+		)
+		switch vt {
+		case chunkenc.ValFloat:
+			_, lastV = it.At()
+			app.Append(t, lastV)
+		case chunkenc.ValHistogram:
+			_, h := it.AtHistogram(nil)
+			newChk, isRecoded, app, err = app.AppendHistogram(nil, t, h, false)
+		case chunkenc.ValFloatHistogram:
+			_, fh := it.AtFloatHistogram(nil)
+			newChk, isRecoded, app, err = app.AppendFloatHistogram(nil, t, fh, false)
+		default:
+			return nil, 0, 0, errors.Errorf("unsupported value type %v", vt)
+		}
+		if err != nil {
+			return nil, 0, 0, errors.Wrap(err, "append sample")
+		}
+		if newChk != nil {
+			// The samples of a single chunk may need it to be recoded, but never need another chunk.
+			if !isRecoded {
+				return nil, 0, 0, errors.New("unexpected new chunk while slicing chunk")
+			}
+			out = newChk
+		}
+
+		if n == 0 {
+			first = t
+		}
+		last = t
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "iterate chunk")
+	}
+	if n == 0 {
+		return nil, 0, 0, nil
+	}
+	if counter && cut {
+		app.Append(last, lastV)
+	}
+	return out, first, last, nil
+}
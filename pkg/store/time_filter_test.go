@@ -0,0 +1,192 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+)
+
+func TestFilterChunksByTime(t *testing.T) {
+	lset := labelpb.ZLabelsFromPromLabels(labels.FromStrings("a", "1"))
+
+	t.Run("within range", func(t *testing.T) {
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{
+			xorAggrChunk(t, sample{10, 1}, sample{20, 1}),
+			xorAggrChunk(t, sample{30, 1}, sample{40, 1}),
+		}}
+		filtered, ok, err := filterChunksByTime(s, 10, 40, false)
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok)
+		testutil.Assert(t, filtered == s)
+	})
+	t.Run("raw", func(t *testing.T) {
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{
+			xorAggrChunk(t, sample{0, 1}, sample{10, 2}, sample{20, 3}),
+			xorAggrChunk(t, sample{30, 4}, sample{40, 5}),
+			xorAggrChunk(t, sample{50, 6}, sample{60, 7}, sample{70, 8}),
+			// No samples within the range, despite its time range overlapping it.
+			xorAggrChunk(t, sample{0, 1}, sample{100, 1}),
+		}}
+		filtered, ok, err := filterChunksByTime(s, 5, 55, true)
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, lset, filtered.Labels)
+		testutil.Equals(t, 3, len(filtered.Chunks))
+
+		testutil.Equals(t, []sample{{10, 2}, {20, 3}}, chunkSamples(t, filtered.Chunks[0].Raw))
+		testutil.Equals(t, int64(10), filtered.Chunks[0].MinTime)
+		testutil.Equals(t, int64(20), filtered.Chunks[0].MaxTime)
+		testutil.Assert(t, filtered.Chunks[0].Raw.Hash != 0)
+		testutil.Equals(t, s.Chunks[1], filtered.Chunks[1])
+		testutil.Equals(t, []sample{{50, 6}}, chunkSamples(t, filtered.Chunks[2].Raw))
+		testutil.Equals(t, int64(50), filtered.Chunks[2].MinTime)
+		testutil.Equals(t, int64(50), filtered.Chunks[2].MaxTime)
+	})
+	t.Run("downsampled", func(t *testing.T) {
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{{
+			MinTime: 0,
+			MaxTime: 30,
+			Count:   xorAggrChunk(t, sample{0, 1}, sample{10, 2}, sample{20, 3}, sample{30, 4}).Raw,
+			// The last sample of counter chunks holds the last raw value.
+			Counter: xorAggrChunk(t, sample{0, 1}, sample{10, 2}, sample{20, 3}, sample{30, 4}, sample{30, 5}).Raw,
+		}}}
+		filtered, ok, err := filterChunksByTime(s, 5, 25, false)
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 1, len(filtered.Chunks))
+		testutil.Equals(t, int64(10), filtered.Chunks[0].MinTime)
+		testutil.Equals(t, int64(20), filtered.Chunks[0].MaxTime)
+		testutil.Equals(t, []sample{{10, 2}, {20, 3}}, chunkSamples(t, filtered.Chunks[0].Count))
+		testutil.Equals(t, []sample{{10, 2}, {20, 3}, {20, 3}}, chunkSamples(t, filtered.Chunks[0].Counter))
+		testutil.Assert(t, filtered.Chunks[0].Sum == nil)
+	})
+	t.Run("histograms", func(t *testing.T) {
+		c := chunkenc.NewHistogramChunk()
+		app, err := c.Appender()
+		testutil.Ok(t, err)
+		for i, h := range tsdbutil.GenerateTestHistograms(5) {
+			_, _, app, err = app.AppendHistogram(nil, int64(i*10), h, false)
+			testutil.Ok(t, err)
+		}
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{{
+			MinTime: 0,
+			MaxTime: 40,
+			Raw:     &storepb.Chunk{Type: storepb.Chunk_HISTOGRAM, Data: c.Bytes()},
+		}}}
+
+		filtered, ok, err := filterChunksByTime(s, 10, 30, false)
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok)
+		testutil.Equals(t, 1, len(filtered.Chunks))
+		testutil.Equals(t, storepb.Chunk_HISTOGRAM, filtered.Chunks[0].Raw.Type)
+
+		chk, err := chunkenc.FromData(chunkenc.EncHistogram, filtered.Chunks[0].Raw.Data)
+		testutil.Ok(t, err)
+		var ts []int64
+		it := chk.Iterator(nil)
+		for it.Next() != chunkenc.ValNone {
+			ts = append(ts, it.AtT())
+		}
+		testutil.Ok(t, it.Err())
+		testutil.Equals(t, []int64{10, 20, 30}, ts)
+	})
+}
+
+func TestBucketStore_TimeFiltering(t *testing.T) {
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	headOpts := tsdb.DefaultHeadOptions()
+	headOpts.ChunkDirRoot = filepath.Join(tmpDir, "head")
+	h, err := tsdb.NewHead(nil, nil, nil, nil, headOpts, nil)
+	testutil.Ok(t, err)
+	app := h.Appender(ctx)
+	for ts := int64(0); ts < 3600000; ts += 15000 {
+		_, err := app.Append(0, labels.FromStrings("__name__", "up"), ts, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	dir := filepath.Join(tmpDir, "block")
+	id := storetestutil.CreateBlockFromHead(t, dir, h)
+	testutil.Ok(t, h.Close())
+	_, err = metadata.InjectThanos(logger, filepath.Join(dir, id.String()), metadata.Thanos{
+		Labels:     labels.FromStrings("ext1", "1").Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.TestSource,
+	}, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+
+	req := &storepb.SeriesRequest{
+		MinTime:  100000,
+		MaxTime:  200000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}
+	for _, tc := range []struct {
+		enabled         bool
+		expectedSamples int
+	}{
+		// The 240 samples are in two chunks of 120 samples.
+		{enabled: false, expectedSamples: 120},
+		{enabled: true, expectedSamples: 7},
+	} {
+		instrBkt := objstore.WithNoopInstr(bkt)
+		fetcher, err := block.NewRawMetaFetcher(logger, instrBkt, block.NewConcurrentLister(logger, instrBkt))
+		testutil.Ok(t, err)
+		store, err := NewBucketStore(
+			instrBkt,
+			fetcher,
+			t.TempDir(),
+			NewChunksLimiterFactory(0),
+			NewSeriesLimiterFactory(0),
+			NewBytesLimiterFactory(0),
+			NewGapBasedPartitioner(PartitionerMaxGapSize),
+			1,
+			false,
+			DefaultPostingOffsetInMemorySampling,
+			false,
+			false,
+			0,
+			WithLogger(logger),
+			WithTimeFiltering(tc.enabled),
+		)
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, store.Close()) })
+		testutil.Ok(t, store.SyncBlocks(ctx))
+		testutil.Equals(t, tc.enabled, store.SupportsTimeFiltering())
+
+		srv := newStoreSeriesServer(ctx)
+		testutil.Ok(t, store.Series(req, srv))
+		testutil.Equals(t, 1, len(srv.SeriesSet))
+
+		var smpls []sample
+		for _, c := range srv.SeriesSet[0].Chunks {
+			smpls = append(smpls, chunkSamples(t, c.Raw)...)
+		}
+		testutil.Equals(t, tc.expectedSamples, len(smpls))
+		if tc.enabled {
+			testutil.Equals(t, int64(105000), smpls[0].t)
+			testutil.Equals(t, int64(195000), smpls[len(smpls)-1].t)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -142,12 +143,21 @@ func (p *TSDBStore) TSDBInfos() []infopb.TSDBInfo {
 			Labels: labelpb.ZLabelSet{
 				Labels: labels[0].Labels,
 			},
-			MinTime: mint,
-			MaxTime: maxt,
+			MinTime:    mint,
+			MaxTime:    maxt,
+			HeadSeries: p.headSeries(),
 		},
 	}
 }
 
+// headSeries returns the number of series in the head of the TSDB, or zero if the TSDB has no head.
+func (s *TSDBStore) headSeries() uint64 {
+	if db, ok := s.db.(interface{ Head() *tsdb.Head }); ok {
+		return db.Head().NumSeries()
+	}
+	return 0
+}
+
 func (s *TSDBStore) TimeRange() (int64, int64) {
 	var minTime int64 = math.MinInt64
 	startTime, err := s.db.StartTime()
@@ -189,6 +199,9 @@ func (s *TSDBStore) SeriesLocal(ctx context.Context, r *storepb.SeriesRequest) (
 // Series returns all series for a requested time range and label matcher. The returned data may
 // exceed the requested time bounds.
 func (s *TSDBStore) Series(r *storepb.SeriesRequest, seriesSrv storepb.Store_SeriesServer) error {
+	if r.SeriesStatsOnly {
+		return serveSeriesStats(r, seriesSrv, s.Series)
+	}
 	var srv flushableServer
 	if fs, ok := seriesSrv.(flushableServer); !ok {
 		srv = newFlushableServer(seriesSrv, sortingStrategyStore)
@@ -61,6 +61,10 @@ func TestTSDBStore_Info(t *testing.T) {
 	testutil.Equals(t, storepb.StoreType_RULE, resp.StoreType)
 	testutil.Equals(t, int64(12), resp.MinTime)
 	testutil.Equals(t, int64(math.MaxInt64), resp.MaxTime)
+
+	infos := tsdbStore.TSDBInfos()
+	testutil.Equals(t, 1, len(infos))
+	testutil.Equals(t, uint64(1), infos[0].HeadSeries)
 }
 
 func TestTSDBStore_Series_ChunkChecksum(t *testing.T) {
@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"hash"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/thanos-io/thanos/pkg/dedup"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	// VerticalMergeChain merges overlapping samples 1:1, keeping one sample per timestamp, like vertical compaction.
+	VerticalMergeChain = "chain"
+	// VerticalMergePenalty merges overlapping samples with the penalty based deduplication algorithm of Querier.
+	VerticalMergePenalty = "penalty"
+)
+
+// NewVerticalChunkSeriesMergeFunc returns the merge function of the given vertical merge algorithm, or nil if the
+// algorithm is empty.
+func NewVerticalChunkSeriesMergeFunc(algorithm string) (storage.VerticalChunkSeriesMergeFunc, error) {
+	switch algorithm {
+	case "":
+		return nil, nil
+	case VerticalMergeChain:
+		return storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge), nil
+	case VerticalMergePenalty:
+		return dedup.NewChunkSeriesMerger(), nil
+	default:
+		return nil, errors.Errorf("unsupported vertical merge algorithm %q", algorithm)
+	}
+}
+
+// mergeOverlappingChunks merges the raw chunks of the given series that overlap in time, e.g. because they come from
+// vertically overlapping blocks, using mergeFunc. Chunks must be sorted by min time, like the ones of the series
+// merged by responseDeduplicator. The series is returned as is if none of its chunks overlap, or if its chunks are
+// downsampled.
+func mergeOverlappingChunks(s *storepb.Series, mergeFunc storage.VerticalChunkSeriesMergeFunc, calculateChecksum bool) (*storepb.Series, bool, error) {
+	if !hasOverlappingRawChunks(s.Chunks) {
+		return s, false, nil
+	}
+
+	// Split the chunks in series of non-overlapping chunks, as expected by merge functions.
+	var lanes [][]chunks.Meta
+	for _, c := range s.Chunks {
+		chk, err := chunkenc.FromData(chunkenc.Encoding(c.Raw.Type+1), c.Raw.Data)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "decode chunk")
+		}
+		meta := chunks.Meta{MinTime: c.MinTime, MaxTime: c.MaxTime, Chunk: chk}
+
+		i := 0
+		for ; i < len(lanes); i++ {
+			if lanes[i][len(lanes[i])-1].MaxTime < c.MinTime {
+				break
+			}
+		}
+		if i == len(lanes) {
+			lanes = append(lanes, nil)
+		}
+		lanes[i] = append(lanes[i], meta)
+	}
+
+	lset := labelpb.ZLabelsToPromLabels(s.Labels)
+	series := make([]storage.ChunkSeries, 0, len(lanes))
+	for _, lane := range lanes {
+		lane := lane
+		series = append(series, &storage.ChunkSeriesEntry{
+			Lset: lset,
+			ChunkIteratorFn: func(chunks.Iterator) chunks.Iterator {
+				return storage.NewListChunkSeriesIterator(lane...)
+			},
+		})
+	}
+
+	hasher := hashPool.Get().(hash.Hash64)
+	defer hashPool.Put(hasher)
+
+	merged := &storepb.Series{Labels: s.Labels}
+	it := mergeFunc(series...).Iterator(nil)
+	for it.Next() {
+		meta := it.At()
+		b := meta.Chunk.Bytes()
+		merged.Chunks = append(merged.Chunks, storepb.AggrChunk{
+			MinTime: meta.MinTime,
+			MaxTime: meta.MaxTime,
+			Raw: &storepb.Chunk{
+				Type: storepb.Chunk_Encoding(meta.Chunk.Encoding() - 1),
+				Data: b,
+				Hash: hashChunk(hasher, b, calculateChecksum),
+			},
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, false, errors.Wrap(err, "merge overlapping chunks")
+	}
+	return merged, true, nil
+}
+
+// hasOverlappingRawChunks returns true if the given chunks, sorted by min time, are raw and some of them overlap in
+// time.
+func hasOverlappingRawChunks(chks []storepb.AggrChunk) bool {
+	var (
+		overlap bool
+		maxt    int64
+	)
+	for i, c := range chks {
+		if c.Raw == nil {
+			return false
+		}
+		if i > 0 && c.MinTime <= maxt {
+			overlap = true
+		}
+		if i == 0 || c.MaxTime > maxt {
+			maxt = c.MaxTime
+		}
+	}
+	return overlap
+}
@@ -0,0 +1,203 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
+)
+
+func xorAggrChunk(t *testing.T, smpls ...sample) storepb.AggrChunk {
+	c := chunkenc.NewXORChunk()
+	app, err := c.Appender()
+	testutil.Ok(t, err)
+	for _, s := range smpls {
+		app.Append(s.t, s.v)
+	}
+	return storepb.AggrChunk{
+		MinTime: smpls[0].t,
+		MaxTime: smpls[len(smpls)-1].t,
+		Raw:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: c.Bytes()},
+	}
+}
+
+func TestMergeOverlappingChunks(t *testing.T) {
+	lset := labelpb.ZLabelsFromPromLabels(labels.FromStrings("a", "1"))
+
+	t.Run("not overlapping", func(t *testing.T) {
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{
+			xorAggrChunk(t, sample{0, 1}, sample{10, 1}),
+			xorAggrChunk(t, sample{20, 1}, sample{30, 1}),
+		}}
+		merged, ok, err := mergeOverlappingChunks(s, storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge), false)
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok)
+		testutil.Assert(t, merged == s)
+	})
+	t.Run("downsampled", func(t *testing.T) {
+		s := &storepb.Series{Labels: lset, Chunks: []storepb.AggrChunk{
+			{MinTime: 0, MaxTime: 10, Count: &storepb.Chunk{}},
+			{MinTime: 5, MaxTime: 15, Count: &storepb.Chunk{}},
+		}}
+		_, ok, err := mergeOverlappingChunks(s, storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge), false)
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok)
+	})
+
+	// Chunks of two replicas scraping every 15s, 7s apart.
+	overlapping := []storepb.AggrChunk{
+		xorAggrChunk(t, sample{0, 1}, sample{15000, 1}, sample{30000, 1}),
+		xorAggrChunk(t, sample{7000, 2}, sample{22000, 2}, sample{37000, 2}, sample{52000, 2}),
+		xorAggrChunk(t, sample{45000, 1}, sample{60000, 1}),
+	}
+	for _, tc := range []struct {
+		algorithm string
+		expected  []sample
+	}{
+		{
+			algorithm: VerticalMergeChain,
+			expected: []sample{
+				{0, 1}, {7000, 2}, {15000, 1}, {22000, 2}, {30000, 1}, {37000, 2}, {45000, 1}, {52000, 2}, {60000, 1},
+			},
+		},
+		{
+			algorithm: VerticalMergePenalty,
+			expected:  []sample{{0, 1}, {7000, 2}, {22000, 2}, {37000, 2}, {52000, 2}},
+		},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			mergeFunc, err := NewVerticalChunkSeriesMergeFunc(tc.algorithm)
+			testutil.Ok(t, err)
+
+			merged, ok, err := mergeOverlappingChunks(&storepb.Series{Labels: lset, Chunks: overlapping}, mergeFunc, true)
+			testutil.Ok(t, err)
+			testutil.Assert(t, ok)
+			testutil.Equals(t, lset, merged.Labels)
+
+			var smpls []sample
+			for _, c := range merged.Chunks {
+				testutil.Assert(t, c.Raw.Hash != 0)
+				smpls = append(smpls, chunkSamples(t, c.Raw)...)
+			}
+			testutil.Equals(t, tc.expected, smpls)
+		})
+	}
+}
+
+func TestNewVerticalChunkSeriesMergeFunc(t *testing.T) {
+	f, err := NewVerticalChunkSeriesMergeFunc("")
+	testutil.Ok(t, err)
+	testutil.Assert(t, f == nil)
+
+	_, err = NewVerticalChunkSeriesMergeFunc("unknown")
+	testutil.NotOk(t, err)
+}
+
+func TestBucketStore_VerticalMerge(t *testing.T) {
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	// Two vertically overlapping blocks with the same external labels, like the ones of two replicas scraping every
+	// 15s, 7s apart.
+	for i, offset := range []int64{0, 7000} {
+		headOpts := tsdb.DefaultHeadOptions()
+		headOpts.ChunkDirRoot = filepath.Join(tmpDir, fmt.Sprintf("head%d", i))
+		h, err := tsdb.NewHead(nil, nil, nil, nil, headOpts, nil)
+		testutil.Ok(t, err)
+		app := h.Appender(ctx)
+		for ts := offset; ts < 1500000; ts += 15000 {
+			_, err := app.Append(0, labels.FromStrings("__name__", "up"), ts, 1)
+			testutil.Ok(t, err)
+		}
+		testutil.Ok(t, app.Commit())
+
+		dir := filepath.Join(tmpDir, fmt.Sprintf("block%d", i))
+		id := storetestutil.CreateBlockFromHead(t, dir, h)
+		testutil.Ok(t, h.Close())
+		_, err = metadata.InjectThanos(logger, filepath.Join(dir, id.String()), metadata.Thanos{
+			Labels:     labels.FromStrings("ext1", "1").Map(),
+			Downsample: metadata.ThanosDownsample{Resolution: 0},
+			Source:     metadata.TestSource,
+		}, nil)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+	}
+
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  1500000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}
+	for _, tc := range []struct {
+		algorithm       string
+		expectedSamples int
+	}{
+		{algorithm: "", expectedSamples: 200},
+		{algorithm: VerticalMergeChain, expectedSamples: 200},
+		{algorithm: VerticalMergePenalty, expectedSamples: 101},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			mergeFunc, err := NewVerticalChunkSeriesMergeFunc(tc.algorithm)
+			testutil.Ok(t, err)
+
+			instrBkt := objstore.WithNoopInstr(bkt)
+			fetcher, err := block.NewRawMetaFetcher(logger, instrBkt, block.NewConcurrentLister(logger, instrBkt))
+			testutil.Ok(t, err)
+			store, err := NewBucketStore(
+				instrBkt,
+				fetcher,
+				t.TempDir(),
+				NewChunksLimiterFactory(0),
+				NewSeriesLimiterFactory(0),
+				NewBytesLimiterFactory(0),
+				NewGapBasedPartitioner(PartitionerMaxGapSize),
+				1,
+				false,
+				DefaultPostingOffsetInMemorySampling,
+				false,
+				false,
+				0,
+				WithLogger(logger),
+				WithVerticalMerge(mergeFunc),
+			)
+			testutil.Ok(t, err)
+			t.Cleanup(func() { testutil.Ok(t, store.Close()) })
+			testutil.Ok(t, store.SyncBlocks(ctx))
+
+			srv := newStoreSeriesServer(ctx)
+			testutil.Ok(t, store.Series(req, srv))
+			testutil.Equals(t, 1, len(srv.SeriesSet))
+
+			var smpls []sample
+			for _, c := range srv.SeriesSet[0].Chunks {
+				smpls = append(smpls, chunkSamples(t, c.Raw)...)
+			}
+			testutil.Equals(t, tc.expectedSamples, len(smpls))
+			if tc.algorithm == "" {
+				return
+			}
+			for i := 1; i < len(smpls); i++ {
+				testutil.Assert(t, smpls[i].t > smpls[i-1].t, "samples of merged chunks are not sorted")
+			}
+		})
+	}
+}
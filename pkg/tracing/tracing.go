@@ -8,6 +8,8 @@ import (
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 const (
@@ -56,6 +58,18 @@ func CopyTraceContext(trgt, src context.Context) context.Context {
 	return ctx
 }
 
+// TraceIDFromContext returns the ID of the trace of the span found within given context, if any and sampled.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", false
+	}
+	if t, ok := tracerFromContext(ctx).(Tracer); ok {
+		return t.GetTraceIDFromSpanContext(span.Context())
+	}
+	return migration.GetTraceIDFromBridgeSpan(span)
+}
+
 // StartSpan starts and returns span with `operationName` and hooking as child to a span found within given context if any.
 // It uses opentracing.Tracer propagated in context. If no found, it uses noop tracer without notification.
 func StartSpan(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (Span, context.Context) {
@@ -0,0 +1,75 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/route"
+
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/component"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+)
+
+//go:embed templates/compaction.html
+var compactionTemplate embed.FS
+
+// Compaction is a lightweight web UI page representing the compaction backlog of a compactor.
+type Compaction struct {
+	*BaseUI
+
+	backlog func() compact.CompactionBacklogStatus
+}
+
+// NewCompactionUI creates a page rendering the compaction backlog returned by the given function.
+func NewCompactionUI(logger log.Logger, externalPrefix, prefixHeader string, backlog func() compact.CompactionBacklogStatus) *Compaction {
+	tmplFuncs := queryTmplFuncs()
+	tmplFuncs["bytes"] = func(b int64) string { return humanize.IBytes(uint64(b)) }
+	tmplFuncs["seconds"] = func(s *float64) time.Duration { return time.Duration(*s * float64(time.Second)).Round(time.Second) }
+
+	return &Compaction{
+		BaseUI:  NewBaseUI(log.With(logger, "component", "compactionUI"), tmplFuncs, nil, externalPrefix, prefixHeader, component.Compact),
+		backlog: backlog,
+	}
+}
+
+// Register registers the http route of the compaction backlog page.
+func (c *Compaction) Register(r *route.Router, ins extpromhttp.InstrumentationMiddleware) {
+	r.Get("/compaction", instrf("compaction", ins, c.serveCompaction))
+}
+
+func (c *Compaction) serveCompaction(w http.ResponseWriter, req *http.Request) {
+	file, err := compactionTemplate.ReadFile("templates/compaction.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	prefix := GetWebPrefix(c.logger, c.externalPrefix, c.prefixHeader, req)
+
+	tmpl, err := template.New("").Funcs(c.tmplFuncs).
+		Funcs(template.FuncMap{"pathPrefix": absolutePrefix(prefix)}).
+		Parse(string(file))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Render first, not to serve a truncated page.
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, c.backlog()); err != nil {
+		level.Warn(c.logger).Log("msg", "template expansion failed", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,54 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/route"
+
+	"github.com/thanos-io/thanos/pkg/compact"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+)
+
+func TestCompactionUI(t *testing.T) {
+	drain := 3723.0
+	status := compact.CompactionBacklogStatus{
+		CalculatedAt: time.Now(),
+		Groups: []compact.GroupBacklog{{
+			Key:    "0@123",
+			Labels: map[string]string{"tenant": "a"},
+			Plans:  []compact.PlannedCompaction{{Blocks: 4, Level: 2, Bytes: 3 << 20}},
+			Blocks: 4,
+			Bytes:  3 << 20,
+		}},
+		Halted:                []compact.HaltedGroup{{Key: "0@456", Reason: "<overlapping blocks>", HaltedAt: time.Now()}},
+		PendingCompactions:    1,
+		EstimatedDrainSeconds: &drain,
+	}
+
+	r := route.New()
+	NewCompactionUI(log.NewNopLogger(), "/thanos", "", func() compact.CompactionBacklogStatus { return status }).Register(r, extpromhttp.NewNopInstrumentationMiddleware())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/compaction", nil))
+	testutil.Equals(t, http.StatusOK, w.Code)
+
+	page := w.Body.String()
+	for _, s := range []string{
+		`href="/thanos/api/v1/compaction/backlog"`,
+		"0@123", "map[tenant:a]", "4 &rarr; 2, 3.0 MiB",
+		"0@456", "&lt;overlapping blocks&gt;",
+		"1h2m3s",
+		"no compaction observed yet",
+	} {
+		testutil.Assert(t, strings.Contains(page, s), "%q not found in page", s)
+	}
+}
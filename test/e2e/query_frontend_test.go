@@ -30,6 +30,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/require"
 
+	"github.com/thanos-io/thanos/pkg/api/frontend"
 	"github.com/thanos-io/thanos/pkg/cacheutil"
 	"github.com/thanos-io/thanos/pkg/promclient"
 	"github.com/thanos-io/thanos/pkg/queryfrontend"
@@ -1201,3 +1202,44 @@ func TestQueryFrontendAnalyze(t *testing.T) {
 
 	require.Equal(t, true, r.MatchString(strings.TrimSpace(string(body))))
 }
+
+func TestQueryFrontendClient(t *testing.T) {
+	t.Parallel()
+
+	e, err := e2e.NewDockerEnvironment("qfe-client")
+	testutil.Ok(t, err)
+	t.Cleanup(e2ethanos.CleanScenario(t, e))
+
+	q := e2ethanos.NewQuerierBuilder(e, "1").Init()
+	testutil.Ok(t, e2e.StartAndWaitReady(q))
+
+	qfe := e2ethanos.NewQueryFrontend(e, "1", "http://"+q.InternalEndpoint("http"), queryfrontend.Config{}, queryfrontend.CacheProviderConfig{
+		Type: queryfrontend.INMEMORY,
+	})
+	testutil.Ok(t, e2e.StartAndWaitReady(qfe))
+
+	c, err := frontend.NewClient("http://" + qfe.Endpoint("http"))
+	require.NoError(t, err)
+
+	t.Run("explain", func(t *testing.T) {
+		resp, err := c.QueryExplain(context.Background(), frontend.QueryParams{Query: "time()", ThanosParams: frontend.ThanosParams{Engine: "thanos"}})
+		require.NoError(t, err)
+
+		require.Equal(t, "success", resp.Status)
+		require.Equal(t, `{"name":"[duplicateLabelCheck]","children":[{"name":"[noArgFunction]"}]}`, string(resp.Data))
+	})
+
+	t.Run("analyze", func(t *testing.T) {
+		resp, err := c.Query(context.Background(), frontend.QueryParams{Query: "time()", Analyze: true, ThanosParams: frontend.ThanosParams{Engine: "thanos"}})
+		require.NoError(t, err)
+
+		require.Equal(t, "success", resp.Status)
+
+		r := regexp.MustCompile(
+			`{"resultType":"scalar","result":\[.+,".+"\],"analysis":{"name":"\[duplicateLabelCheck\]","executionTime":".+","children":\[{"name":"\[noArgFunction\]","executionTime":".+","children":null}\]}}`,
+		)
+		t.Log(string(resp.Data))
+
+		require.Equal(t, true, r.MatchString(string(resp.Data)))
+	})
+}